@@ -0,0 +1,47 @@
+-- DataFlux Full-Text Search Indexes
+-- Indexes the query service's full-text, wildcard and fuzzy search rely on.
+--
+-- The indexes are built CONCURRENTLY so the tables stay writable while they
+-- build. CREATE INDEX CONCURRENTLY cannot run inside a transaction block, so
+-- run this file with plain psql, without --single-transaction:
+--
+--   psql "$DATABASE_URL" -f scripts/fulltext-indexes.sql
+--
+-- A build that fails leaves an INVALID index behind, which IF NOT EXISTS
+-- would skip; drop it (DROP INDEX CONCURRENTLY <name>) and run the file again.
+--
+-- The stemmed pairs at the end cover the default FULLTEXT_STEMMING_LANGUAGES
+-- (de,es,fr,it,nl,pt). For other languages, print the statements with
+--
+--   query-service -fulltext-indexes > fulltext-indexes.sql
+-- The index expressions must match the ones in the query service's fulltext
+-- package exactly, or the planner will not use them.
+
+-- Trigram operator classes
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Full-text search on asset filenames and upload context, and segment features
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_assets_fulltext ON assets USING gin((to_tsvector('simple', regexp_replace(coalesce(filename, '') || ' ' || coalesce(upload_context, ''), '[^[:alnum:]]+', ' ', 'g'))));
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_features_fulltext ON features USING gin((jsonb_to_tsvector('simple', feature_data, '["string"]'))) WHERE segment_id IS NOT NULL;
+
+-- Wildcard and fuzzy terms
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_assets_trgm ON assets USING gin((lower(coalesce(filename, '') || ' ' || coalesce(upload_context, ''))) gin_trgm_ops);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_features_trgm ON features USING gin((lower(feature_data::text)) gin_trgm_ops) WHERE segment_id IS NOT NULL;
+
+-- Tenant scoping and tag completions
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_entities_tenant ON entities ((metadata->>'tenant_id'));
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_entities_tags_trgm ON entities USING gin((lower(metadata->>'tags')) gin_trgm_ops);
+
+-- Stemmed full-text search, one pair per language
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_assets_fulltext_dutch ON assets USING gin((to_tsvector('dutch', regexp_replace(coalesce(filename, '') || ' ' || coalesce(upload_context, ''), '[^[:alnum:]]+', ' ', 'g'))));
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_features_fulltext_dutch ON features USING gin((jsonb_to_tsvector('dutch', feature_data, '["string"]'))) WHERE segment_id IS NOT NULL;
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_assets_fulltext_french ON assets USING gin((to_tsvector('french', regexp_replace(coalesce(filename, '') || ' ' || coalesce(upload_context, ''), '[^[:alnum:]]+', ' ', 'g'))));
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_features_fulltext_french ON features USING gin((jsonb_to_tsvector('french', feature_data, '["string"]'))) WHERE segment_id IS NOT NULL;
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_assets_fulltext_german ON assets USING gin((to_tsvector('german', regexp_replace(coalesce(filename, '') || ' ' || coalesce(upload_context, ''), '[^[:alnum:]]+', ' ', 'g'))));
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_features_fulltext_german ON features USING gin((jsonb_to_tsvector('german', feature_data, '["string"]'))) WHERE segment_id IS NOT NULL;
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_assets_fulltext_italian ON assets USING gin((to_tsvector('italian', regexp_replace(coalesce(filename, '') || ' ' || coalesce(upload_context, ''), '[^[:alnum:]]+', ' ', 'g'))));
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_features_fulltext_italian ON features USING gin((jsonb_to_tsvector('italian', feature_data, '["string"]'))) WHERE segment_id IS NOT NULL;
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_assets_fulltext_portuguese ON assets USING gin((to_tsvector('portuguese', regexp_replace(coalesce(filename, '') || ' ' || coalesce(upload_context, ''), '[^[:alnum:]]+', ' ', 'g'))));
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_features_fulltext_portuguese ON features USING gin((jsonb_to_tsvector('portuguese', feature_data, '["string"]'))) WHERE segment_id IS NOT NULL;
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_assets_fulltext_spanish ON assets USING gin((to_tsvector('spanish', regexp_replace(coalesce(filename, '') || ' ' || coalesce(upload_context, ''), '[^[:alnum:]]+', ' ', 'g'))));
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_features_fulltext_spanish ON features USING gin((jsonb_to_tsvector('spanish', feature_data, '["string"]'))) WHERE segment_id IS NOT NULL;
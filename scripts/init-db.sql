@@ -71,7 +71,8 @@ CREATE TABLE features (
     feature_type VARCHAR(100) NOT NULL, -- 'object_detection', 'sentiment', etc.
     feature_data JSONB NOT NULL DEFAULT '{}'::jsonb,
     confidence FLOAT NOT NULL DEFAULT 0.0,
-    analyzer_version VARCHAR(50) NOT NULL,
+    analyzer_version VARCHAR(50) NOT NULL, -- name of the analyzer that produced the feature
+    model_version VARCHAR(100), -- model version the analyzer reported, if any
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     
     CONSTRAINT valid_feature_domain CHECK (feature_domain IN ('visual', 'semantic', 'style', 'technical', 'audio', 'text')),
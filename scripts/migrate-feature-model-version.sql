@@ -0,0 +1,11 @@
+-- DataFlux Schema Migration
+-- Record the model version of each feature apart from its analyzer
+
+-- Step 1: Add the model_version column
+ALTER TABLE features ADD COLUMN IF NOT EXISTS model_version VARCHAR(100);
+
+-- Step 2: Split features written as <analyzer>@<model version> into both columns
+UPDATE features
+SET model_version = NULLIF(split_part(analyzer_version, '@', 2), ''),
+    analyzer_version = split_part(analyzer_version, '@', 1)
+WHERE analyzer_version LIKE '%@%';
@@ -231,6 +231,10 @@ class APIAssetProcessor:
                 'metadata': {'status': 'fallback', 'analyzer': 'fallback'}
             }
     
+    def _model_version(self, metadata):
+        """Model version the analyzer reported, if any, so searches can filter on it"""
+        return metadata.get('model') or metadata.get('version')
+
     async def _store_analysis_results(self, asset_id, results):
         """Store analysis results in database"""
         try:
@@ -273,8 +277,8 @@ class APIAssetProcessor:
                         """, asset_id)
                     
                     await conn.execute("""
-                        INSERT INTO features (id, asset_id, segment_id, feature_domain, feature_type, feature_data, confidence, analyzer_version, created_at)
-                        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+                        INSERT INTO features (id, asset_id, segment_id, feature_domain, feature_type, feature_data, confidence, analyzer_version, model_version, created_at)
+                        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
                     """,
                     str(uuid.uuid4()),
                     asset_id,
@@ -283,7 +287,8 @@ class APIAssetProcessor:
                     feature.get('type', 'unknown'),
                     json.dumps(feature.get('data', {})),
                     feature.get('confidence', 0.0),
-                    feature.get('metadata', {}).get('analyzer', 'unknown')
+                    feature.get('metadata', {}).get('analyzer', 'unknown'),
+                    self._model_version(feature.get('metadata', {}))
                     )
                 
                 # Store embeddings
@@ -0,0 +1,262 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrShed is returned when a request is turned away to protect the backends
+var ErrShed = errors.New("search capacity exhausted; retry later")
+
+// Priorities a client may ask for
+const (
+	// PriorityHigh is for interactive requests a user is waiting on
+	PriorityHigh = "high"
+	// PriorityNormal is the default
+	PriorityNormal = "normal"
+	// PriorityLow is for bulk and background clients, which are queued and
+	// shed first and get tighter backend budgets
+	PriorityLow = "low"
+)
+
+// Valid reports whether priority is empty or one of the known priorities
+func Valid(priority string) bool {
+	switch priority {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// rank orders priorities, higher first; empty is normal
+func rank(priority string) int {
+	switch priority {
+	case PriorityHigh:
+		return 2
+	case PriorityLow:
+		return 0
+	}
+	return 1
+}
+
+// Config bounds the searches running and waiting at once
+type Config struct {
+	// MaxConcurrent is how many searches run at once; zero disables admission control
+	MaxConcurrent int
+	// LowShare is the fraction of MaxConcurrent low-priority searches may
+	// hold, so bulk clients never take every slot
+	LowShare float64
+	// MaxQueue is how many searches wait for a slot before the lowest
+	// priority waiter is shed
+	MaxQueue int
+	// MaxWait sheds a search that waited this long; zero waits until the
+	// request's context ends
+	MaxWait time.Duration
+}
+
+// Controller admits searches by priority. When every slot is taken searches
+// wait in priority order; a full queue sheds its lowest-priority, newest
+// waiter, so low-priority requests are turned away before interactive ones.
+type Controller struct {
+	config   Config
+	lowLimit int
+
+	mu         sync.Mutex
+	running    int
+	runningLow int
+	queue      []*waiter
+}
+
+type waiter struct {
+	rank  int
+	ready chan struct{}
+	// err is set before ready is closed when the waiter is shed
+	err error
+}
+
+// New creates a controller; nil is returned when MaxConcurrent is zero, and
+// a nil controller admits everything
+func New(config Config) *Controller {
+	if config.MaxConcurrent <= 0 {
+		return nil
+	}
+	lowLimit := int(float64(config.MaxConcurrent) * config.LowShare)
+	if lowLimit < 1 {
+		lowLimit = 1
+	}
+	if lowLimit > config.MaxConcurrent {
+		lowLimit = config.MaxConcurrent
+	}
+	return &Controller{config: config, lowLimit: lowLimit}
+}
+
+// Acquire waits for a slot for a search of the given priority and returns
+// the function releasing it. It fails with ErrShed when the search is shed,
+// or with the context's error when the context ends first.
+func (c *Controller) Acquire(ctx context.Context, priority string) (func(), error) {
+	if c == nil {
+		return func() {}, nil
+	}
+	w := &waiter{rank: rank(priority), ready: make(chan struct{})}
+
+	c.mu.Lock()
+	if c.admissible(w.rank) && !c.queuedAhead(w.rank) {
+		c.start(w.rank)
+		c.mu.Unlock()
+		return c.releaser(w.rank), nil
+	}
+	if len(c.queue) >= c.config.MaxQueue {
+		victim := c.lowestWaiter()
+		if victim < 0 || c.queue[victim].rank >= w.rank {
+			c.mu.Unlock()
+			return nil, ErrShed
+		}
+		c.shed(victim)
+	}
+	c.enqueue(w)
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if c.config.MaxWait > 0 {
+		timer := time.NewTimer(c.config.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case <-w.ready:
+		if w.err != nil {
+			return nil, w.err
+		}
+		return c.releaser(w.rank), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrShed
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-w.ready:
+		// Granted or shed while giving up; a granted slot is handed on
+		if w.err == nil {
+			c.finish(w.rank)
+		}
+	default:
+		c.remove(w)
+	}
+	return nil, err
+}
+
+// Busy reports whether searches are waiting for a slot or the slots low
+// priority may use are all taken
+func (c *Controller) Busy() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queue) > 0 || c.running >= c.lowLimit
+}
+
+// Stats is a snapshot of the searches running and waiting
+type Stats struct {
+	Running int `json:"running"`
+	Queued  int `json:"queued"`
+}
+
+// Stats returns the searches running and waiting
+func (c *Controller) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{Running: c.running, Queued: len(c.queue)}
+}
+
+func (c *Controller) admissible(rank int) bool {
+	if c.running >= c.config.MaxConcurrent {
+		return false
+	}
+	return rank > 0 || c.runningLow < c.lowLimit
+}
+
+// queuedAhead reports whether a waiter of at least rank is queued, which a
+// new arrival must not overtake
+func (c *Controller) queuedAhead(rank int) bool {
+	return len(c.queue) > 0 && c.queue[0].rank >= rank
+}
+
+func (c *Controller) start(rank int) {
+	c.running++
+	if rank == 0 {
+		c.runningLow++
+	}
+}
+
+func (c *Controller) releaser(rank int) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.finish(rank)
+		})
+	}
+}
+
+// finish frees a slot and grants free slots to the waiters, highest
+// priority first; low-priority waiters over their share are passed over
+func (c *Controller) finish(rank int) {
+	c.running--
+	if rank == 0 {
+		c.runningLow--
+	}
+	for i := 0; i < len(c.queue) && c.running < c.config.MaxConcurrent; {
+		w := c.queue[i]
+		if !c.admissible(w.rank) {
+			i++
+			continue
+		}
+		c.queue = append(c.queue[:i], c.queue[i+1:]...)
+		c.start(w.rank)
+		close(w.ready)
+	}
+}
+
+// enqueue inserts w after every waiter of the same or higher priority
+func (c *Controller) enqueue(w *waiter) {
+	i := len(c.queue)
+	for i > 0 && c.queue[i-1].rank < w.rank {
+		i--
+	}
+	c.queue = append(c.queue, nil)
+	copy(c.queue[i+1:], c.queue[i:])
+	c.queue[i] = w
+}
+
+// lowestWaiter is the index of the newest waiter of the lowest priority,
+// which is always last in the queue
+func (c *Controller) lowestWaiter() int {
+	return len(c.queue) - 1
+}
+
+func (c *Controller) shed(i int) {
+	w := c.queue[i]
+	c.queue = append(c.queue[:i], c.queue[i+1:]...)
+	w.err = ErrShed
+	close(w.ready)
+}
+
+func (c *Controller) remove(w *waiter) {
+	for i, queued := range c.queue {
+		if queued == w {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return
+		}
+	}
+}
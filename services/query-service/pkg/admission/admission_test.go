@@ -0,0 +1,109 @@
+package admission
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNilControllerAdmitsEverything(t *testing.T) {
+	controller := New(Config{})
+	assert.Nil(t, controller)
+	release, err := controller.Acquire(context.Background(), PriorityLow)
+	require.NoError(t, err)
+	release()
+	assert.False(t, controller.Busy())
+}
+
+func TestLowPriorityShare(t *testing.T) {
+	controller := New(Config{MaxConcurrent: 2, LowShare: 0.5, MaxQueue: 4})
+
+	releaseLow, err := controller.Acquire(context.Background(), PriorityLow)
+	require.NoError(t, err)
+	assert.True(t, controller.Busy())
+
+	// The second low-priority search waits although a slot is free
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = controller.Acquire(ctx, PriorityLow)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// while an interactive one takes it
+	releaseHigh, err := controller.Acquire(context.Background(), PriorityHigh)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Running: 2}, controller.Stats())
+	releaseHigh()
+	releaseLow()
+	assert.Equal(t, Stats{}, controller.Stats())
+}
+
+func TestWaitersAreGrantedByPriority(t *testing.T) {
+	controller := New(Config{MaxConcurrent: 1, LowShare: 1, MaxQueue: 4})
+	release, err := controller.Acquire(context.Background(), PriorityNormal)
+	require.NoError(t, err)
+
+	order := make(chan string, 2)
+	for _, priority := range []string{PriorityLow, PriorityHigh} {
+		priority := priority
+		go func() {
+			next, err := controller.Acquire(context.Background(), priority)
+			if err == nil {
+				order <- priority
+				next()
+			}
+		}()
+		// Queued in this order
+		require.Eventually(t, func() bool {
+			return controller.Stats().Queued > 0 && (priority == PriorityLow || controller.Stats().Queued == 2)
+		}, time.Second, time.Millisecond)
+	}
+
+	release()
+	assert.Equal(t, PriorityHigh, <-order)
+	assert.Equal(t, PriorityLow, <-order)
+}
+
+func TestFullQueueShedsLowPriorityFirst(t *testing.T) {
+	controller := New(Config{MaxConcurrent: 1, LowShare: 1, MaxQueue: 1})
+	release, err := controller.Acquire(context.Background(), PriorityNormal)
+	require.NoError(t, err)
+	defer release()
+
+	shed := make(chan error, 1)
+	go func() {
+		_, err := controller.Acquire(context.Background(), PriorityLow)
+		shed <- err
+	}()
+	require.Eventually(t, func() bool { return controller.Stats().Queued == 1 }, time.Second, time.Millisecond)
+
+	// A normal search takes the low-priority search's place in the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := controller.Acquire(ctx, PriorityNormal)
+		waiting <- err
+	}()
+	assert.ErrorIs(t, <-shed, ErrShed)
+
+	// and a low-priority arrival at a full queue is turned away at once
+	_, err = controller.Acquire(context.Background(), PriorityLow)
+	assert.ErrorIs(t, err, ErrShed)
+
+	cancel()
+	assert.ErrorIs(t, <-waiting, context.Canceled)
+	assert.Equal(t, Stats{Running: 1}, controller.Stats())
+}
+
+func TestMaxWaitSheds(t *testing.T) {
+	controller := New(Config{MaxConcurrent: 1, LowShare: 1, MaxQueue: 1, MaxWait: 10 * time.Millisecond})
+	release, err := controller.Acquire(context.Background(), PriorityHigh)
+	require.NoError(t, err)
+	defer release()
+
+	_, err = controller.Acquire(context.Background(), PriorityHigh)
+	assert.ErrorIs(t, err, ErrShed)
+	assert.Equal(t, Stats{Running: 1}, controller.Stats())
+}
@@ -0,0 +1,377 @@
+package aggregate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+	"dataflux/query-service/pkg/filter"
+	"dataflux/query-service/pkg/fulltext"
+)
+
+// Aggregation types
+const (
+	TypeCount         = "count"
+	TypeDistinctCount = "distinct_count"
+	TypeSumDuration   = "sum_duration"
+	TypeDateHistogram = "date_histogram"
+)
+
+// Targets are the corpus tables aggregations run over
+const (
+	TargetAssets   = "assets"
+	TargetSegments = "segments"
+)
+
+// MaxAggregations bounds the aggregations in one request
+const MaxAggregations = 20
+
+// maxBuckets bounds the buckets returned by one histogram
+const maxBuckets = 1000
+
+// distinctFields lists the fields distinct_count may count per target
+var distinctFields = map[string][]string{
+	TargetAssets:   {"collection_id", "mime_type", "processing_status"},
+	TargetSegments: {"asset_id", "collection_id", "mime_type", "segment_type"},
+}
+
+// filterColumns lists the filter fields each corpus table has, with the
+// value the sync writes when the source value is missing
+var filterColumns = map[string]map[string]string{
+	TargetAssets: {
+		filter.FieldMimeType:     "''",
+		filter.FieldCollectionID: "''",
+		filter.FieldFileSize:     "0",
+		filter.FieldDuration:     "0",
+		filter.FieldCreatedAt:    "",
+	},
+	TargetSegments: {
+		filter.FieldMimeType:     "''",
+		filter.FieldCollectionID: "''",
+		filter.FieldDuration:     "0",
+		filter.FieldCreatedAt:    "",
+	},
+}
+
+// filterTypes are the ClickHouse parameter types of each filter kind
+var filterTypes = map[filter.Kind]string{
+	filter.KindString: "String",
+	filter.KindNumber: "Float64",
+	filter.KindTime:   "DateTime64(3, 'UTC')",
+}
+
+// intervals maps histogram intervals to ClickHouse rounding functions
+var intervals = map[string]string{
+	"day":   "toStartOfDay",
+	"week":  "toMonday",
+	"month": "toStartOfMonth",
+	"year":  "toStartOfYear",
+}
+
+// Aggregation is one requested aggregation
+type Aggregation struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Field is the field counted by distinct_count
+	Field string `json:"field,omitempty"`
+	// Interval is the date_histogram bucket size: day, week, month or year
+	Interval string `json:"interval,omitempty"`
+}
+
+// Request runs aggregations over the corpus matching the search filters
+type Request struct {
+	// Target is assets (default) or segments
+	Target       string        `json:"target"`
+	MediaTypes   []string      `json:"media_types"`
+	Filters      filter.Set    `json:"filters"`
+	Aggregations []Aggregation `json:"aggregations" binding:"required"`
+}
+
+// Bucket is one date_histogram bucket
+type Bucket struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// Result is the outcome of one aggregation
+type Result struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Value   *float64 `json:"value,omitempty"`
+	Buckets []Bucket `json:"buckets,omitempty"`
+}
+
+// Response holds the results in request order
+type Response struct {
+	Target  string   `json:"target"`
+	Results []Result `json:"results"`
+	TookMs  int64    `json:"took_ms"`
+}
+
+// ErrDisabled is returned when no ClickHouse URL is configured
+var ErrDisabled = errors.New("clickhouse is not configured")
+
+// ValidationError marks a request the client has to fix
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Aggregator runs aggregations against the corpus tables in ClickHouse
+type Aggregator struct {
+	client *clickhouse.Client
+}
+
+// NewAggregator creates an aggregator
+func NewAggregator(client *clickhouse.Client) *Aggregator {
+	return &Aggregator{client: client}
+}
+
+// Validate checks the request and fills in defaults
+func Validate(req *Request) error {
+	if req.Target == "" {
+		req.Target = TargetAssets
+	}
+	if _, ok := distinctFields[req.Target]; !ok {
+		return &ValidationError{Message: fmt.Sprintf("target must be %s or %s", TargetAssets, TargetSegments)}
+	}
+	for field := range req.Filters {
+		if _, ok := filterColumns[req.Target][field]; !ok {
+			return &ValidationError{Message: fmt.Sprintf("%s cannot be filtered on %s", req.Target, field)}
+		}
+	}
+	if len(req.Aggregations) == 0 || len(req.Aggregations) > MaxAggregations {
+		return &ValidationError{Message: fmt.Sprintf("between 1 and %d aggregations are required", MaxAggregations)}
+	}
+
+	names := map[string]bool{}
+	for i := range req.Aggregations {
+		agg := &req.Aggregations[i]
+		if agg.Name == "" {
+			agg.Name = agg.Type
+		}
+		if names[agg.Name] {
+			return &ValidationError{Message: fmt.Sprintf("duplicate aggregation name %q", agg.Name)}
+		}
+		names[agg.Name] = true
+
+		switch agg.Type {
+		case TypeCount, TypeSumDuration:
+		case TypeDistinctCount:
+			if !contains(distinctFields[req.Target], agg.Field) {
+				return &ValidationError{Message: fmt.Sprintf("distinct_count field must be one of %s", strings.Join(distinctFields[req.Target], ", "))}
+			}
+		case TypeDateHistogram:
+			if agg.Interval == "" {
+				agg.Interval = "day"
+			}
+			if _, ok := intervals[agg.Interval]; !ok {
+				return &ValidationError{Message: "date_histogram interval must be day, week, month or year"}
+			}
+		default:
+			return &ValidationError{Message: fmt.Sprintf("unknown aggregation type %q", agg.Type)}
+		}
+	}
+	return nil
+}
+
+// Run validates the request and executes its aggregations: all scalar
+// aggregations in one query and one query per histogram
+func (a *Aggregator) Run(ctx context.Context, req Request) (Response, error) {
+	start := time.Now()
+	if err := Validate(&req); err != nil {
+		return Response{}, err
+	}
+	if !a.client.Enabled() {
+		return Response{}, ErrDisabled
+	}
+
+	table, err := a.client.Table(corpusTable(req.Target))
+	if err != nil {
+		return Response{}, err
+	}
+	where, params := buildWhere(req.Target, fulltext.FiltersFromRequest(req.MediaTypes, req.Filters))
+
+	results := make([]Result, len(req.Aggregations))
+	var scalars []string
+	var scalarIndexes []int
+	for i, agg := range req.Aggregations {
+		results[i] = Result{Name: agg.Name, Type: agg.Type}
+		if agg.Type == TypeDateHistogram {
+			buckets, err := a.histogram(ctx, table, where, params, agg.Interval)
+			if err != nil {
+				return Response{}, err
+			}
+			results[i].Buckets = buckets
+			continue
+		}
+		scalars = append(scalars, fmt.Sprintf("%s AS a%d", scalarExpression(agg), i))
+		scalarIndexes = append(scalarIndexes, i)
+	}
+
+	if len(scalars) > 0 {
+		rows, err := a.query(ctx, fmt.Sprintf("SELECT %s FROM %s FINAL WHERE %s", strings.Join(scalars, ", "), table, where), params)
+		if err != nil {
+			return Response{}, err
+		}
+		for _, i := range scalarIndexes {
+			var value float64
+			if len(rows) > 0 {
+				value = number(rows[0]["a"+strconv.Itoa(i)])
+			}
+			results[i].Value = &value
+		}
+	}
+
+	return Response{Target: req.Target, Results: results, TookMs: time.Since(start).Milliseconds()}, nil
+}
+
+func (a *Aggregator) histogram(ctx context.Context, table, where string, params map[string]string, interval string) ([]Bucket, error) {
+	statement := fmt.Sprintf(
+		"SELECT toString(toDate(%s(created_at))) AS key, count() AS count FROM %s FINAL WHERE %s GROUP BY key ORDER BY key LIMIT %d",
+		intervals[interval], table, where, maxBuckets)
+	rows, err := a.query(ctx, statement, params)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]Bucket, 0, len(rows))
+	for _, row := range rows {
+		key, _ := row["key"].(string)
+		buckets = append(buckets, Bucket{Key: key, Count: uint64(number(row["count"]))})
+	}
+	return buckets, nil
+}
+
+func (a *Aggregator) query(ctx context.Context, statement string, params map[string]string) ([]map[string]interface{}, error) {
+	body, err := a.client.Exec(ctx, statement+" FORMAT JSON", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run aggregation: %v", err)
+	}
+
+	var result struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode aggregation result: %v", err)
+	}
+	return result.Data, nil
+}
+
+func scalarExpression(agg Aggregation) string {
+	switch agg.Type {
+	case TypeDistinctCount:
+		return "uniqExact(" + agg.Field + ")"
+	case TypeSumDuration:
+		return "sum(duration)"
+	}
+	return "count()"
+}
+
+// buildWhere translates the search filters into a ClickHouse condition with
+// bound parameters. Validate has checked the fields exist on the target.
+func buildWhere(target string, filters fulltext.Filters) (string, map[string]string) {
+	conditions := []string{"1 = 1"}
+	params := map[string]string{}
+	if len(filters.MimePatterns) > 0 {
+		conditions = append(conditions, "arrayExists(p -> mime_type LIKE p, {mime_patterns:Array(String)})")
+		params["mime_patterns"] = clickhouse.ArrayParam(filters.MimePatterns)
+	}
+
+	for i, clause := range filters.Clauses {
+		column := clause.Field
+		name := "f" + strconv.Itoa(i)
+		param := func(suffix, chType string, value interface{}) string {
+			params[name+suffix] = paramValue(value)
+			return "{" + name + suffix + ":" + chType + "}"
+		}
+
+		switch clause.Op {
+		case filter.OpEq:
+			conditions = append(conditions, column+" = "+param("", filterTypes[clause.Kind], clause.Values[0]))
+		case filter.OpIn:
+			values := make([]string, len(clause.Values))
+			for j, value := range clause.Values {
+				values[j] = paramValue(value)
+			}
+			if clause.Kind == filter.KindNumber {
+				params[name] = "[" + strings.Join(values, ",") + "]"
+			} else {
+				params[name] = clickhouse.ArrayParam(values)
+			}
+			conditions = append(conditions, column+" IN {"+name+":Array("+filterTypes[clause.Kind]+")}")
+		case filter.OpPrefix:
+			conditions = append(conditions, "startsWith("+column+", "+param("", "String", clause.Values[0])+")")
+		case filter.OpExists:
+			conditions = append(conditions, existsCondition(column, filterColumns[target][column], clause.Exists))
+		case filter.OpRange:
+			bounds := []struct {
+				suffix, operator string
+				value            interface{}
+			}{{"_gt", ">", clause.Range.Gt}, {"_gte", ">=", clause.Range.Gte}, {"_lt", "<", clause.Range.Lt}, {"_lte", "<=", clause.Range.Lte}}
+			for _, bound := range bounds {
+				if bound.value != nil {
+					conditions = append(conditions, column+" "+bound.operator+" "+param(bound.suffix, filterTypes[clause.Kind], bound.value))
+				}
+			}
+		}
+	}
+	return strings.Join(conditions, " AND "), params
+}
+
+// existsCondition compares against the placeholder of missing values;
+// columns without one are always present
+func existsCondition(column, missing string, exists bool) string {
+	switch {
+	case missing == "" && exists:
+		return "1 = 1"
+	case missing == "":
+		return "1 = 0"
+	case exists:
+		return column + " != " + missing
+	}
+	return column + " = " + missing
+}
+
+func paramValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return formatTime(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// number reads a JSON value ClickHouse may quote, such as UInt64 counts
+func number(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.000")
+}
+
+func contains(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package aggregate
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+	"dataflux/query-service/pkg/filter"
+	"dataflux/query-service/pkg/fulltext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	req := Request{Aggregations: []Aggregation{{Type: TypeCount}, {Name: "per_day", Type: TypeDateHistogram}}}
+	require.NoError(t, Validate(&req))
+	assert.Equal(t, TargetAssets, req.Target)
+	assert.Equal(t, "count", req.Aggregations[0].Name)
+	assert.Equal(t, "day", req.Aggregations[1].Interval)
+
+	invalid := []Request{
+		{Target: "features", Aggregations: []Aggregation{{Type: TypeCount}}},
+		{Aggregations: []Aggregation{{Type: TypeDistinctCount, Field: "filename"}}},
+		{Target: TargetSegments, Aggregations: []Aggregation{{Type: TypeDistinctCount, Field: "processing_status"}}},
+		{Aggregations: []Aggregation{{Type: TypeDateHistogram, Interval: "hour"}}},
+		{Aggregations: []Aggregation{{Type: TypeCount}, {Type: TypeCount}}},
+		{Aggregations: []Aggregation{{Type: "avg"}}},
+		{Target: TargetSegments, Filters: filter.Set{filter.FieldFileSize: {Op: filter.OpExists, Exists: true}}, Aggregations: []Aggregation{{Type: TypeCount}}},
+		{Filters: filter.Set{filter.FieldTags: {Op: filter.OpEq, Values: []interface{}{"beach"}}}, Aggregations: []Aggregation{{Type: TypeCount}}},
+		{},
+	}
+	for _, req := range invalid {
+		err := Validate(&req)
+		assert.IsType(t, &ValidationError{}, err)
+	}
+}
+
+func TestBuildWhere(t *testing.T) {
+	set, err := filter.FromMap(map[string]interface{}{
+		"collection_id": []interface{}{"c1", "c2"},
+		"duration":      map[string]interface{}{"exists": true},
+		"file_size":     map[string]interface{}{"in": []interface{}{1024, 2048}},
+		"mime_type":     map[string]interface{}{"prefix": "video/"},
+	})
+	require.NoError(t, err)
+
+	where, params := buildWhere(TargetAssets, fulltext.FiltersFromRequest(nil, set))
+
+	assert.Equal(t, "1 = 1 AND collection_id IN {f0:Array(String)} AND duration != 0 "+
+		"AND file_size IN {f2:Array(Float64)} AND startsWith(mime_type, {f3:String})", where)
+	assert.Equal(t, map[string]string{"f0": "['c1','c2']", "f2": "[1024,2048]", "f3": "video/"}, params)
+}
+
+func TestRun(t *testing.T) {
+	var statements []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		statements = append(statements, string(body))
+		if strings.Contains(string(body), "GROUP BY key") {
+			assert.Equal(t, "['video/%']", r.URL.Query().Get("param_mime_patterns"))
+			w.Write([]byte(`{"data":[{"key":"2024-05-01","count":"3"},{"key":"2024-06-01","count":"5"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":[{"a0":"8","a1":"2","a2":512.5}]}`))
+	}))
+	defer server.Close()
+
+	aggregator := NewAggregator(clickhouse.NewClient(server.URL, "", "", "dataflux"))
+	response, err := aggregator.Run(context.Background(), Request{
+		MediaTypes: []string{"video"},
+		Filters: filter.Set{
+			filter.FieldCreatedAt: {Op: filter.OpRange, Range: filter.Range{Gte: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}},
+		},
+		Aggregations: []Aggregation{
+			{Name: "assets", Type: TypeCount},
+			{Name: "collections", Type: TypeDistinctCount, Field: "collection_id"},
+			{Name: "runtime", Type: TypeSumDuration},
+			{Name: "per_month", Type: TypeDateHistogram, Interval: "month"},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, statements, 2)
+	assert.Equal(t, "SELECT toString(toDate(toStartOfMonth(created_at))) AS key, count() AS count FROM dataflux.corpus_assets FINAL "+
+		"WHERE 1 = 1 AND arrayExists(p -> mime_type LIKE p, {mime_patterns:Array(String)}) AND created_at >= {f0_gte:DateTime64(3, 'UTC')} "+
+		"GROUP BY key ORDER BY key LIMIT 1000 FORMAT JSON", statements[0])
+	assert.True(t, strings.HasPrefix(statements[1], "SELECT count() AS a0, uniqExact(collection_id) AS a1, sum(duration) AS a2 FROM dataflux.corpus_assets FINAL"))
+
+	assert.Equal(t, 8.0, *response.Results[0].Value)
+	assert.Equal(t, 2.0, *response.Results[1].Value)
+	assert.Equal(t, 512.5, *response.Results[2].Value)
+	assert.Equal(t, []Bucket{{Key: "2024-05-01", Count: 3}, {Key: "2024-06-01", Count: 5}}, response.Results[3].Buckets)
+}
@@ -0,0 +1,209 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// syncBatchSize is the number of rows copied per INSERT
+const syncBatchSize = 5000
+
+// corpusTable is the ClickHouse table mirroring a target
+func corpusTable(target string) string {
+	return "corpus_" + target
+}
+
+// corpusSchemas create the ClickHouse mirrors of the asset and segment
+// tables. ReplacingMergeTree keeps the latest copy of rows synced twice.
+var corpusSchemas = map[string]string{
+	TargetAssets: `
+		CREATE TABLE IF NOT EXISTS %s (
+			asset_id String,
+			collection_id String,
+			mime_type LowCardinality(String),
+			processing_status LowCardinality(String),
+			file_size UInt64,
+			duration Float64,
+			created_at DateTime64(3, 'UTC'),
+			updated_at DateTime64(3, 'UTC')
+		) ENGINE = ReplacingMergeTree(updated_at)
+		ORDER BY asset_id`,
+	TargetSegments: `
+		CREATE TABLE IF NOT EXISTS %s (
+			segment_id String,
+			asset_id String,
+			collection_id String,
+			mime_type LowCardinality(String),
+			segment_type LowCardinality(String),
+			duration Float64,
+			created_at DateTime64(3, 'UTC'),
+			updated_at DateTime64(3, 'UTC')
+		) ENGINE = ReplacingMergeTree(updated_at)
+		ORDER BY segment_id`,
+}
+
+// sourceQueries read rows after the ($1, $2) keyset position from
+// PostgreSQL, oldest change first.
+// An asset's duration comes from its metadata when numeric.
+var sourceQueries = map[string]string{
+	TargetAssets: `
+		SELECT json_build_object(
+			'asset_id', a.id::text,
+			'collection_id', COALESCE(e.parent_id::text, ''),
+			'mime_type', a.mime_type,
+			'processing_status', COALESCE(a.processing_status, ''),
+			'file_size', a.file_size,
+			'duration', CASE WHEN e.metadata->>'duration' ~ '^[0-9]+(\.[0-9]+)?$' THEN (e.metadata->>'duration')::float ELSE 0 END,
+			'created_at', to_char(e.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS.MS'),
+			'updated_at', to_char(e.updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS.MS')
+		)::text, e.updated_at, e.id::text
+		FROM assets a
+		JOIN entities e ON e.id = a.id
+		WHERE (e.updated_at, e.id) > ($1, $2::uuid)
+		ORDER BY e.updated_at, e.id
+		LIMIT $3`,
+	TargetSegments: `
+		SELECT json_build_object(
+			'segment_id', s.id::text,
+			'asset_id', s.asset_id::text,
+			'collection_id', COALESCE(ae.parent_id::text, ''),
+			'mime_type', a.mime_type,
+			'segment_type', s.segment_type,
+			'duration', COALESCE(s.duration, 0),
+			'created_at', to_char(e.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS.MS'),
+			'updated_at', to_char(e.updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS.MS')
+		)::text, e.updated_at, e.id::text
+		FROM segments s
+		JOIN entities e ON e.id = s.id
+		JOIN assets a ON a.id = s.asset_id
+		JOIN entities ae ON ae.id = a.id
+		WHERE (e.updated_at, e.id) > ($1, $2::uuid)
+		ORDER BY e.updated_at, e.id
+		LIMIT $3`,
+}
+
+// watermark is the last copied row of a target
+type watermark struct {
+	updatedAt time.Time
+	id        string
+}
+
+// Syncer copies the asset and segment corpus from PostgreSQL into ClickHouse
+// incrementally by updated_at. The first run after a restart copies
+// everything again, which the ReplacingMergeTree tables absorb.
+type Syncer struct {
+	pool   *pgxpool.Pool
+	client *clickhouse.Client
+
+	mu         sync.Mutex
+	watermarks map[string]watermark
+}
+
+// NewSyncer creates a syncer
+func NewSyncer(pool *pgxpool.Pool, client *clickhouse.Client) *Syncer {
+	return &Syncer{pool: pool, client: client, watermarks: map[string]watermark{}}
+}
+
+// EnsureSchema creates the corpus tables in ClickHouse
+func (s *Syncer) EnsureSchema(ctx context.Context) error {
+	for _, target := range []string{TargetAssets, TargetSegments} {
+		table, err := s.client.Table(corpusTable(target))
+		if err != nil {
+			return err
+		}
+		if _, err := s.client.Exec(ctx, fmt.Sprintf(corpusSchemas[target], table), nil); err != nil {
+			return fmt.Errorf("failed to create %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// Sync copies the rows changed since the last sync and returns how many
+func (s *Syncer) Sync(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for _, target := range []string{TargetAssets, TargetSegments} {
+		for {
+			copied, err := s.syncBatch(ctx, target)
+			total += copied
+			if err != nil {
+				return total, err
+			}
+			if copied < syncBatchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+func (s *Syncer) syncBatch(ctx context.Context, target string) (int, error) {
+	table, err := s.client.Table(corpusTable(target))
+	if err != nil {
+		return 0, err
+	}
+
+	last, ok := s.watermarks[target]
+	if !ok {
+		last = watermark{id: "00000000-0000-0000-0000-000000000000"}
+	}
+	rows, err := s.pool.Query(ctx, sourceQueries[target], last.updatedAt, last.id, syncBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %v", target, err)
+	}
+	defer rows.Close()
+
+	var body strings.Builder
+	count := 0
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row, &last.updatedAt, &last.id); err != nil {
+			return 0, fmt.Errorf("failed to scan %s: %v", target, err)
+		}
+		body.WriteString(row)
+		body.WriteByte('\n')
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	if _, err := s.client.Exec(ctx, fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow\n%s", table, body.String()), nil); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %v", table, err)
+	}
+	s.watermarks[target] = last
+	return count, nil
+}
+
+// Start runs Sync every interval until ctx is cancelled
+func (s *Syncer) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if copied, err := s.Sync(ctx); err != nil {
+				log.Printf("Warning: corpus sync to ClickHouse failed: %v", err)
+			} else if copied > 0 {
+				log.Printf("Synced %d corpus rows to ClickHouse", copied)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package analytics
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// SearchEvent is one analytics row per executed search
+type SearchEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	TraceID   string    `json:"trace_id"`
+	SpanID    string    `json:"span_id"`
+	UserID    string    `json:"user_id"`
+	// CollectionID is set when the search was restricted to one collection
+	CollectionID string `json:"collection_id"`
+	Endpoint     string `json:"endpoint"`
+	Query        string `json:"query"`
+	ResultCount  int    `json:"result_count"`
+	LatencyMs    int64  `json:"latency_ms"`
+	CacheHit     bool   `json:"cache_hit"`
+}
+
+// AuditEvent records a state-changing request
+type AuditEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	TraceID   string    `json:"trace_id"`
+	SpanID    string    `json:"span_id"`
+	UserID    string    `json:"user_id"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"`
+	Status    int       `json:"status"`
+	ClientIP  string    `json:"client_ip"`
+}
+
+// Click sources
+const (
+	// ClickSearch is a search result the user opened
+	ClickSearch = "search"
+	// ClickSeen is an asset the client marked seen
+	ClickSeen = "seen"
+)
+
+// ClickEvent records a user opening an asset
+type ClickEvent struct {
+	Timestamp    time.Time `json:"timestamp"`
+	UserID       string    `json:"user_id"`
+	CollectionID string    `json:"collection_id"`
+	AssetID      string    `json:"asset_id"`
+	Source       string    `json:"source"`
+	// Position is the rank of a clicked search result, from 0
+	Position int `json:"position"`
+}
+
+// Recorder receives analytics and audit events
+type Recorder interface {
+	RecordSearch(event SearchEvent)
+	RecordAudit(event AuditEvent)
+	RecordClick(event ClickEvent)
+}
+
+// LogRecorder writes events as JSON lines to the standard logger
+type LogRecorder struct{}
+
+// NewLogRecorder creates a recorder that logs events
+func NewLogRecorder() *LogRecorder {
+	return &LogRecorder{}
+}
+
+// RecordSearch logs a search event
+func (l *LogRecorder) RecordSearch(event SearchEvent) {
+	logEvent("search", event)
+}
+
+// RecordAudit logs an audit event
+func (l *LogRecorder) RecordAudit(event AuditEvent) {
+	logEvent("audit", event)
+}
+
+// RecordClick logs a click event
+func (l *LogRecorder) RecordClick(event ClickEvent) {
+	logEvent("click", event)
+}
+
+func logEvent(kind string, event interface{}) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Warning: failed to encode %s event: %v", kind, err)
+		return
+	}
+	log.Printf("%s %s", kind, data)
+}
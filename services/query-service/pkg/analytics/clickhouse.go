@@ -0,0 +1,209 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+)
+
+// ClickHouse tables the recorder writes to
+const (
+	SearchTable = "search_events"
+	AuditTable  = "audit_events"
+	ClickTable  = "click_events"
+)
+
+// timestampFormat is accepted by DateTime64 columns in JSONEachRow input
+const timestampFormat = "2006-01-02 15:04:05.000"
+
+// schemas create the event tables. All are partitioned by month so
+// retention and erasure mutations only touch the partitions they need.
+var schemas = map[string]string{
+	SearchTable: `
+		CREATE TABLE IF NOT EXISTS %s (
+			timestamp DateTime64(3, 'UTC'),
+			trace_id String,
+			span_id String,
+			user_id String,
+			collection_id String,
+			endpoint LowCardinality(String),
+			query String,
+			result_count UInt32,
+			latency_ms UInt32,
+			cache_hit Bool
+		) ENGINE = MergeTree
+		PARTITION BY toYYYYMM(timestamp)
+		ORDER BY (timestamp, user_id)`,
+	AuditTable: `
+		CREATE TABLE IF NOT EXISTS %s (
+			timestamp DateTime64(3, 'UTC'),
+			trace_id String,
+			span_id String,
+			user_id String,
+			action LowCardinality(String),
+			resource String,
+			status UInt16,
+			client_ip String
+		) ENGINE = MergeTree
+		PARTITION BY toYYYYMM(timestamp)
+		ORDER BY (timestamp, user_id)`,
+	// Clicks are looked up by asset
+	ClickTable: `
+		CREATE TABLE IF NOT EXISTS %s (
+			timestamp DateTime64(3, 'UTC'),
+			user_id String,
+			collection_id String,
+			asset_id String,
+			source LowCardinality(String),
+			position UInt32
+		) ENGINE = MergeTree
+		PARTITION BY toYYYYMM(timestamp)
+		ORDER BY (asset_id, timestamp)`,
+}
+
+type searchRow struct {
+	SearchEvent
+	Timestamp string `json:"timestamp"`
+}
+
+type auditRow struct {
+	AuditEvent
+	Timestamp string `json:"timestamp"`
+}
+
+type clickRow struct {
+	ClickEvent
+	Timestamp string `json:"timestamp"`
+}
+
+type queuedRow struct {
+	table string
+	row   interface{}
+}
+
+// ClickHouseRecorder queues events and writes them to ClickHouse in batches,
+// so recording never adds a round trip to the request
+type ClickHouseRecorder struct {
+	client        *clickhouse.Client
+	queue         chan queuedRow
+	batchSize     int
+	flushInterval time.Duration
+	dropped       uint64
+	stop          chan struct{}
+	stopOnce      sync.Once
+	done          chan struct{}
+}
+
+// NewClickHouseRecorder creates a recorder; events beyond queueSize pending
+// ones are dropped. A batch is written once it holds batchSize events or
+// flushInterval has passed.
+func NewClickHouseRecorder(client *clickhouse.Client, queueSize, batchSize int, flushInterval time.Duration) *ClickHouseRecorder {
+	return &ClickHouseRecorder{
+		client:        client,
+		queue:         make(chan queuedRow, queueSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// EnsureSchema creates the event tables
+func (r *ClickHouseRecorder) EnsureSchema(ctx context.Context) error {
+	for _, name := range []string{SearchTable, AuditTable, ClickTable} {
+		table, err := r.client.Table(name)
+		if err != nil {
+			return err
+		}
+		if _, err := r.client.Exec(ctx, fmt.Sprintf(schemas[name], table), nil); err != nil {
+			return fmt.Errorf("failed to create %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// RecordSearch queues a search event
+func (r *ClickHouseRecorder) RecordSearch(event SearchEvent) {
+	r.enqueue(SearchTable, searchRow{SearchEvent: event, Timestamp: event.Timestamp.UTC().Format(timestampFormat)})
+}
+
+// RecordAudit queues an audit event
+func (r *ClickHouseRecorder) RecordAudit(event AuditEvent) {
+	r.enqueue(AuditTable, auditRow{AuditEvent: event, Timestamp: event.Timestamp.UTC().Format(timestampFormat)})
+}
+
+// RecordClick queues a click event
+func (r *ClickHouseRecorder) RecordClick(event ClickEvent) {
+	r.enqueue(ClickTable, clickRow{ClickEvent: event, Timestamp: event.Timestamp.UTC().Format(timestampFormat)})
+}
+
+func (r *ClickHouseRecorder) enqueue(table string, row interface{}) {
+	select {
+	case r.queue <- queuedRow{table: table, row: row}:
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+	}
+}
+
+// Start writes queued events until ctx is cancelled or Close is called
+func (r *ClickHouseRecorder) Start(ctx context.Context) {
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.flushInterval)
+		defer ticker.Stop()
+
+		batches := map[string][]interface{}{}
+		pending := 0
+		flush := func(ctx context.Context) {
+			for table, rows := range batches {
+				if err := r.client.Insert(ctx, table, rows...); err != nil {
+					log.Printf("Warning: failed to write %d analytics events: %v", len(rows), err)
+				}
+				delete(batches, table)
+			}
+			pending = 0
+			if dropped := atomic.SwapUint64(&r.dropped, 0); dropped > 0 {
+				log.Printf("Warning: dropped %d analytics events, queue full", dropped)
+			}
+		}
+
+		for {
+			select {
+			case queued := <-r.queue:
+				batches[queued.table] = append(batches[queued.table], queued.row)
+				if pending++; pending >= r.batchSize {
+					flush(ctx)
+				}
+			case <-ticker.C:
+				flush(ctx)
+			case <-ctx.Done():
+				return
+			case <-r.stop:
+				// Drain what is already queued so a clean shutdown loses nothing
+				for drained := false; !drained; {
+					select {
+					case queued := <-r.queue:
+						batches[queued.table] = append(batches[queued.table], queued.row)
+					default:
+						drained = true
+					}
+				}
+				flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				flush(flushCtx)
+				cancel()
+				return
+			}
+		}
+	}()
+}
+
+// Close writes the events still queued and stops a started recorder
+func (r *ClickHouseRecorder) Close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
@@ -0,0 +1,88 @@
+package analytics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type statementLog struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (l *statementLog) server() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		l.mu.Lock()
+		l.statements = append(l.statements, string(body))
+		l.mu.Unlock()
+	}))
+}
+
+func (l *statementLog) all() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.statements...)
+}
+
+func TestClickHouseRecorderWritesFullBatches(t *testing.T) {
+	var sink statementLog
+	server := sink.server()
+	defer server.Close()
+
+	recorder := NewClickHouseRecorder(clickhouse.NewClient(server.URL, "", "", "dataflux"), 10, 2, time.Hour)
+	recorder.Start(context.Background())
+	defer recorder.Close()
+
+	timestamp := time.Date(2026, 3, 1, 12, 30, 0, 250e6, time.UTC)
+	recorder.RecordSearch(SearchEvent{Timestamp: timestamp, Query: "beach", ResultCount: 3, CacheHit: true})
+	recorder.RecordSearch(SearchEvent{Timestamp: timestamp, Query: "sunset"})
+
+	require.Eventually(t, func() bool { return len(sink.all()) == 1 }, time.Second, 10*time.Millisecond)
+	statement := sink.all()[0]
+	assert.True(t, strings.HasPrefix(statement, "INSERT INTO dataflux.search_events FORMAT JSONEachRow\n"))
+	assert.Contains(t, statement, `"timestamp":"2026-03-01 12:30:00.250"`)
+	assert.Contains(t, statement, `"query":"beach"`)
+	assert.Contains(t, statement, `"cache_hit":true`)
+	assert.Equal(t, 3, strings.Count(statement, "\n"))
+}
+
+func TestClickHouseRecorderFlushesOnClose(t *testing.T) {
+	var sink statementLog
+	server := sink.server()
+	defer server.Close()
+
+	recorder := NewClickHouseRecorder(clickhouse.NewClient(server.URL, "", "", "dataflux"), 10, 100, time.Hour)
+	recorder.Start(context.Background())
+	recorder.RecordSearch(SearchEvent{Query: "beach"})
+	recorder.RecordAudit(AuditEvent{Action: "POST /api/v1/me/pins", Status: 201})
+	recorder.RecordClick(ClickEvent{AssetID: "asset-1", Source: ClickSearch, Position: 2})
+	recorder.Close()
+
+	statements := sink.all()
+	require.Len(t, statements, 3)
+	joined := strings.Join(statements, "")
+	assert.Contains(t, joined, "INSERT INTO dataflux.search_events")
+	assert.Contains(t, joined, "INSERT INTO dataflux.audit_events")
+	assert.Contains(t, joined, `"status":201`)
+	assert.Contains(t, joined, "INSERT INTO dataflux.click_events")
+	assert.Contains(t, joined, `"asset_id":"asset-1"`)
+}
+
+func TestClickHouseRecorderDropsWhenQueueFull(t *testing.T) {
+	recorder := NewClickHouseRecorder(clickhouse.NewClient("http://localhost:1", "", "", ""), 1, 10, time.Hour)
+	recorder.RecordSearch(SearchEvent{Query: "a"})
+	recorder.RecordSearch(SearchEvent{Query: "b"})
+	assert.Equal(t, uint64(1), recorder.dropped)
+}
@@ -0,0 +1,126 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+)
+
+// seriesMetrics are the search log aggregates SearchSeries charts, by name
+var seriesMetrics = map[string]string{
+	"searches":         "count()",
+	"zero_result_rate": "countIf(result_count = 0) / greatest(count(), 1)",
+	"cache_hit_rate":   "countIf(cache_hit) / greatest(count(), 1)",
+	"latency_p50_ms":   "ifNotFinite(quantile(0.5)(latency_ms), 0)",
+	"latency_p95_ms":   "ifNotFinite(quantile(0.95)(latency_ms), 0)",
+}
+
+// SeriesMetrics lists the metrics SearchSeries can chart
+func SeriesMetrics() []string {
+	names := make([]string, 0, len(seriesMetrics))
+	for name := range seriesMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Point is the value of a metric over the step starting at Time
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// SearchSeries aggregates a metric of the searches logged from from until
+// to in steps of step, rounded down to whole seconds. Steps without
+// searches are left out.
+func SearchSeries(ctx context.Context, client *clickhouse.Client, metric string, from, to time.Time, step time.Duration) ([]Point, error) {
+	expression, ok := seriesMetrics[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", metric)
+	}
+	if !client.Enabled() {
+		return nil, ErrDisabled
+	}
+	table, err := client.Table(SearchTable)
+	if err != nil {
+		return nil, err
+	}
+	seconds := int64(step / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	var result struct {
+		Data []struct {
+			Bucket int64   `json:"bucket"`
+			Value  float64 `json:"value"`
+		} `json:"data"`
+	}
+	err = query(ctx, client, fmt.Sprintf(`
+		SELECT toUnixTimestamp(toStartOfInterval(timestamp, INTERVAL {step:UInt32} SECOND)) AS bucket,
+		       toFloat64(%s) AS value
+		FROM %s
+		WHERE timestamp >= {from:DateTime64(3, 'UTC')} AND timestamp < {to:DateTime64(3, 'UTC')}
+		GROUP BY bucket
+		ORDER BY bucket`, expression, table), map[string]string{
+		"from": from.UTC().Format(timestampFormat),
+		"to":   to.UTC().Format(timestampFormat),
+		"step": strconv.FormatInt(seconds, 10),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]Point, 0, len(result.Data))
+	for _, row := range result.Data {
+		points = append(points, Point{Time: time.Unix(row.Bucket, 0).UTC(), Value: row.Value})
+	}
+	return points, nil
+}
+
+// AuditLog returns up to limit audit events from from until to, newest
+// first, of resources starting with resourcePrefix when it is not empty
+func AuditLog(ctx context.Context, client *clickhouse.Client, from, to time.Time, resourcePrefix string, limit int) ([]AuditEvent, error) {
+	if !client.Enabled() {
+		return nil, ErrDisabled
+	}
+	table, err := client.Table(AuditTable)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Data []auditRow `json:"data"`
+	}
+	err = query(ctx, client, fmt.Sprintf(`
+		SELECT timestamp, trace_id, span_id, user_id, action, resource, status, client_ip
+		FROM %s
+		WHERE timestamp >= {from:DateTime64(3, 'UTC')} AND timestamp < {to:DateTime64(3, 'UTC')}
+		  AND startsWith(resource, {prefix:String})
+		ORDER BY timestamp DESC
+		LIMIT {limit:UInt32}`, table), map[string]string{
+		"from":   from.UTC().Format(timestampFormat),
+		"to":     to.UTC().Format(timestampFormat),
+		"prefix": resourcePrefix,
+		"limit":  strconv.Itoa(limit),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]AuditEvent, 0, len(result.Data))
+	for _, row := range result.Data {
+		event := row.AuditEvent
+		event.Timestamp, err = time.Parse(timestampFormat, row.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit timestamp %q", row.Timestamp)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
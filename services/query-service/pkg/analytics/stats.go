@@ -0,0 +1,120 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+)
+
+// NormalizedQuery is the ClickHouse expression for a logged query in the
+// form cache.NormalizeText produces, so spellings of one query group together
+const NormalizedQuery = `lowerUTF8(trimBoth(replaceRegexpAll(query, '\\s+', ' ')))`
+
+// ErrDisabled is returned when no ClickHouse URL is configured
+var ErrDisabled = errors.New("clickhouse is not configured")
+
+// QueryCount is how often a query was searched for in the window
+type QueryCount struct {
+	Query       string `json:"query"`
+	Searches    int64  `json:"searches"`
+	ZeroResults int64  `json:"zero_results"`
+}
+
+// Stats summarises the search log over a window
+type Stats struct {
+	Since          time.Time    `json:"since"`
+	Searches       int64        `json:"searches"`
+	ZeroResultRate float64      `json:"zero_result_rate"`
+	CacheHitRate   float64      `json:"cache_hit_rate"`
+	LatencyP50Ms   float64      `json:"latency_p50_ms"`
+	LatencyP95Ms   float64      `json:"latency_p95_ms"`
+	TopQueries     []QueryCount `json:"top_queries"`
+}
+
+// SearchStats aggregates the searches logged since the given time, with the
+// top most frequent queries
+func SearchStats(ctx context.Context, client *clickhouse.Client, since time.Time, top int) (Stats, error) {
+	stats := Stats{Since: since.UTC(), TopQueries: []QueryCount{}}
+	if !client.Enabled() {
+		return stats, ErrDisabled
+	}
+	table, err := client.Table(SearchTable)
+	if err != nil {
+		return stats, err
+	}
+	params := map[string]string{
+		"since": since.UTC().Format(timestampFormat),
+		"top":   strconv.Itoa(top),
+	}
+
+	// Quantiles of an empty window are NaN, which JSON cannot carry
+	var totals struct {
+		Data []struct {
+			Searches       json.Number `json:"searches"`
+			ZeroResultRate float64     `json:"zero_result_rate"`
+			CacheHitRate   float64     `json:"cache_hit_rate"`
+			P50            float64     `json:"p50"`
+			P95            float64     `json:"p95"`
+		} `json:"data"`
+	}
+	err = query(ctx, client, fmt.Sprintf(`
+		SELECT count() AS searches,
+		       countIf(result_count = 0) / greatest(count(), 1) AS zero_result_rate,
+		       countIf(cache_hit) / greatest(count(), 1) AS cache_hit_rate,
+		       ifNotFinite(quantile(0.5)(latency_ms), 0) AS p50,
+		       ifNotFinite(quantile(0.95)(latency_ms), 0) AS p95
+		FROM %s
+		WHERE timestamp >= {since:DateTime64(3, 'UTC')}`, table), params, &totals)
+	if err != nil {
+		return stats, err
+	}
+	if len(totals.Data) > 0 {
+		row := totals.Data[0]
+		stats.Searches, _ = row.Searches.Int64()
+		stats.ZeroResultRate = row.ZeroResultRate
+		stats.CacheHitRate = row.CacheHitRate
+		stats.LatencyP50Ms = row.P50
+		stats.LatencyP95Ms = row.P95
+	}
+
+	var queries struct {
+		Data []struct {
+			Query       string      `json:"normalized"`
+			Searches    json.Number `json:"searches"`
+			ZeroResults json.Number `json:"zero_results"`
+		} `json:"data"`
+	}
+	err = query(ctx, client, fmt.Sprintf(`
+		SELECT %s AS normalized, count() AS searches, countIf(result_count = 0) AS zero_results
+		FROM %s
+		WHERE timestamp >= {since:DateTime64(3, 'UTC')} AND normalized != ''
+		GROUP BY normalized
+		ORDER BY searches DESC, normalized
+		LIMIT {top:UInt32}`, NormalizedQuery, table), params, &queries)
+	if err != nil {
+		return stats, err
+	}
+	for _, row := range queries.Data {
+		count := QueryCount{Query: row.Query}
+		count.Searches, _ = row.Searches.Int64()
+		count.ZeroResults, _ = row.ZeroResults.Int64()
+		stats.TopQueries = append(stats.TopQueries, count)
+	}
+	return stats, nil
+}
+
+func query(ctx context.Context, client *clickhouse.Client, statement string, params map[string]string, result interface{}) error {
+	body, err := client.Exec(ctx, statement+" FORMAT JSON", params)
+	if err != nil {
+		return fmt.Errorf("failed to query search log: %v", err)
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("failed to decode search log result: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package analytics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchStats(t *testing.T) {
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "2026-03-01 00:00:00.000", r.URL.Query().Get("param_since"))
+		if strings.Contains(string(body), "GROUP BY normalized") {
+			assert.Equal(t, "5", r.URL.Query().Get("param_top"))
+			w.Write([]byte(`{"data":[{"normalized":"beach","searches":"40","zero_results":"0"},{"normalized":"snow","searches":"12","zero_results":"12"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":[{"searches":"120","zero_result_rate":0.1,"cache_hit_rate":0.4,"p50":35,"p95":180.5}]}`))
+	}))
+	defer server.Close()
+
+	stats, err := SearchStats(context.Background(), clickhouse.NewClient(server.URL, "", "", "dataflux"), since, 5)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(120), stats.Searches)
+	assert.Equal(t, 0.1, stats.ZeroResultRate)
+	assert.Equal(t, 0.4, stats.CacheHitRate)
+	assert.Equal(t, 35.0, stats.LatencyP50Ms)
+	assert.Equal(t, 180.5, stats.LatencyP95Ms)
+	require.Len(t, stats.TopQueries, 2)
+	assert.Equal(t, QueryCount{Query: "snow", Searches: 12, ZeroResults: 12}, stats.TopQueries[1])
+}
+
+func TestSearchStatsDisabled(t *testing.T) {
+	_, err := SearchStats(context.Background(), clickhouse.NewClient("", "", "", ""), time.Now(), 5)
+	assert.ErrorIs(t, err, ErrDisabled)
+}
@@ -0,0 +1,152 @@
+package archival
+
+import (
+	"context"
+	"time"
+
+	"dataflux/query-service/pkg/storage"
+)
+
+// pageSize is how many assets are checked against the click log at a time
+const pageSize = 500
+
+// Candidate is an asset nobody has opened for a while whose media is still
+// in a tier warmer than archived
+type Candidate struct {
+	AssetID      string    `json:"asset_id"`
+	Filename     string    `json:"filename"`
+	MimeType     string    `json:"mime_type"`
+	CollectionID string    `json:"collection_id,omitempty"`
+	FileSize     int64     `json:"file_size"`
+	StorageClass string    `json:"storage_class"`
+	Tier         string    `json:"tier"`
+	CreatedAt    time.Time `json:"created_at"`
+	// LastViewedAt is the last time the asset was opened, if it ever was
+	LastViewedAt *time.Time `json:"last_viewed_at,omitempty"`
+	// SuggestedTier is the next colder tier
+	SuggestedTier string `json:"suggested_tier"`
+}
+
+// Query selects the assets to consider, largest first
+type Query struct {
+	// CreatedBefore leaves out assets too new to have gone unviewed
+	CreatedBefore time.Time
+	CollectionID  string
+	MinFileSize   int64
+	Offset        int
+	Limit         int
+}
+
+// Assets lists assets whose media is not archived
+type Assets interface {
+	Unarchived(ctx context.Context, query Query) ([]Candidate, error)
+}
+
+// Views reads when assets were last opened
+type Views interface {
+	LastViewed(ctx context.Context, assetIDs []string) (map[string]time.Time, error)
+}
+
+// Options narrow a report
+type Options struct {
+	// IdleMonths is how long an asset has gone without views
+	IdleMonths   int
+	CollectionID string
+	MinFileSize  int64
+	Limit        int
+}
+
+// Report lists the archival candidates, largest first
+type Report struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	IdleMonths  int       `json:"idle_months"`
+	// Cutoff is the time since which candidates have had no views
+	Cutoff     time.Time   `json:"cutoff"`
+	Candidates []Candidate `json:"candidates"`
+	// Bytes is the total size of the candidates, and BytesByTier splits it
+	// by their current tier
+	Bytes       int64            `json:"bytes"`
+	BytesByTier map[string]int64 `json:"bytes_by_tier"`
+	// Truncated is set when there are more candidates than the limit
+	Truncated bool `json:"truncated"`
+}
+
+// Finder combines the storage metadata of assets with the click log to find
+// media worth moving to a colder tier
+type Finder struct {
+	assets Assets
+	views  Views
+}
+
+// NewFinder creates a finder
+func NewFinder(assets Assets, views Views) *Finder {
+	return &Finder{assets: assets, views: views}
+}
+
+// Find reports the assets created before the cutoff, IdleMonths before now,
+// that have not been opened since. Assets are checked largest first, so the
+// candidates freeing the most storage come first.
+func (f *Finder) Find(ctx context.Context, opts Options, now time.Time) (*Report, error) {
+	now = now.UTC()
+	cutoff := now.AddDate(0, -opts.IdleMonths, 0)
+	report := &Report{
+		GeneratedAt: now,
+		IdleMonths:  opts.IdleMonths,
+		Cutoff:      cutoff,
+		Candidates:  []Candidate{},
+		BytesByTier: map[string]int64{},
+	}
+
+	query := Query{CreatedBefore: cutoff, CollectionID: opts.CollectionID, MinFileSize: opts.MinFileSize, Limit: pageSize}
+	for {
+		assets, err := f.assets.Unarchived(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(assets) == 0 {
+			return report, nil
+		}
+		ids := make([]string, len(assets))
+		for i, asset := range assets {
+			ids[i] = asset.AssetID
+		}
+		views, err := f.views.LastViewed(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, asset := range assets {
+			last, viewed := views[asset.AssetID]
+			if viewed && !last.Before(cutoff) {
+				continue
+			}
+			if len(report.Candidates) == opts.Limit {
+				report.Truncated = true
+				return report, nil
+			}
+			if viewed {
+				last = last.UTC()
+				asset.LastViewedAt = &last
+			}
+			asset.Tier = storage.TierOf(asset.StorageClass)
+			asset.SuggestedTier = colderTier(asset.Tier)
+			report.Candidates = append(report.Candidates, asset)
+			report.Bytes += asset.FileSize
+			report.BytesByTier[asset.Tier] += asset.FileSize
+		}
+		if len(assets) < pageSize {
+			return report, nil
+		}
+		query.Offset += len(assets)
+	}
+}
+
+// colderTier is the tier after tier in storage.Tiers
+func colderTier(tier string) string {
+	for i, candidate := range storage.Tiers[:len(storage.Tiers)-1] {
+		if candidate == tier {
+			return storage.Tiers[i+1]
+		}
+	}
+	return storage.TierArchived
+}
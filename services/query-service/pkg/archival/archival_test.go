@@ -0,0 +1,121 @@
+package archival
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+	"dataflux/query-service/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+// fakeAssets pages through assets already sorted largest first
+type fakeAssets struct {
+	assets  []Candidate
+	queries []Query
+}
+
+func (f *fakeAssets) Unarchived(ctx context.Context, query Query) ([]Candidate, error) {
+	f.queries = append(f.queries, query)
+	var page []Candidate
+	for _, asset := range f.assets {
+		if asset.CreatedAt.Before(query.CreatedBefore) && asset.FileSize >= query.MinFileSize {
+			page = append(page, asset)
+		}
+	}
+	if query.Offset >= len(page) {
+		return nil, nil
+	}
+	page = page[query.Offset:]
+	if len(page) > query.Limit {
+		page = page[:query.Limit]
+	}
+	return page, nil
+}
+
+type fakeViews map[string]time.Time
+
+func (f fakeViews) LastViewed(ctx context.Context, assetIDs []string) (map[string]time.Time, error) {
+	views := map[string]time.Time{}
+	for _, id := range assetIDs {
+		if last, ok := f[id]; ok {
+			views[id] = last
+		}
+	}
+	return views, nil
+}
+
+func TestFindReportsAssetsWithoutRecentViews(t *testing.T) {
+	old := now.AddDate(-2, 0, 0)
+	assets := &fakeAssets{assets: []Candidate{
+		{AssetID: "never-viewed", FileSize: 900, StorageClass: "STANDARD", CreatedAt: old},
+		{AssetID: "viewed-recently", FileSize: 800, StorageClass: "STANDARD", CreatedAt: old},
+		{AssetID: "viewed-long-ago", FileSize: 700, StorageClass: "STANDARD_IA", CreatedAt: old},
+		{AssetID: "too-new", FileSize: 600, StorageClass: "STANDARD", CreatedAt: now.AddDate(0, -1, 0)},
+	}}
+	views := fakeViews{
+		"viewed-recently": now.AddDate(0, -1, 0),
+		"viewed-long-ago": now.AddDate(-1, 0, 0),
+	}
+
+	report, err := NewFinder(assets, views).Find(context.Background(), Options{IdleMonths: 6, Limit: 10}, now)
+	require.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, -6, 0), report.Cutoff)
+	require.Len(t, report.Candidates, 2)
+
+	assert.Equal(t, "never-viewed", report.Candidates[0].AssetID)
+	assert.Nil(t, report.Candidates[0].LastViewedAt)
+	assert.Equal(t, storage.TierOnline, report.Candidates[0].Tier)
+	assert.Equal(t, storage.TierNearline, report.Candidates[0].SuggestedTier)
+
+	assert.Equal(t, "viewed-long-ago", report.Candidates[1].AssetID)
+	require.NotNil(t, report.Candidates[1].LastViewedAt)
+	assert.Equal(t, views["viewed-long-ago"], *report.Candidates[1].LastViewedAt)
+	assert.Equal(t, storage.TierNearline, report.Candidates[1].Tier)
+	assert.Equal(t, storage.TierArchived, report.Candidates[1].SuggestedTier)
+
+	assert.Equal(t, int64(1600), report.Bytes)
+	assert.Equal(t, map[string]int64{storage.TierOnline: 900, storage.TierNearline: 700}, report.BytesByTier)
+	assert.False(t, report.Truncated)
+}
+
+func TestFindPagesUntilTheLimit(t *testing.T) {
+	assets := &fakeAssets{}
+	for i := 0; i < pageSize+10; i++ {
+		assets.assets = append(assets.assets, Candidate{AssetID: string(rune('a' + i%26)), FileSize: int64(10000 - i), CreatedAt: now.AddDate(-1, 0, 0)})
+	}
+
+	report, err := NewFinder(assets, fakeViews{}).Find(context.Background(), Options{IdleMonths: 3, Limit: pageSize + 5}, now)
+	require.NoError(t, err)
+	assert.Len(t, report.Candidates, pageSize+5)
+	assert.True(t, report.Truncated)
+	require.Len(t, assets.queries, 2)
+	assert.Equal(t, pageSize, assets.queries[1].Offset)
+
+	report, err = NewFinder(assets, fakeViews{}).Find(context.Background(), Options{IdleMonths: 3, Limit: 1000}, now)
+	require.NoError(t, err)
+	assert.Len(t, report.Candidates, pageSize+10)
+	assert.False(t, report.Truncated)
+}
+
+func TestClickHouseViews(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "['asset-1','asset-2']", r.URL.Query().Get("param_ids"))
+		w.Write([]byte(`{"data": [{"asset_id": "asset-1", "last_viewed": "2026-03-01 12:30:00.25"}]}`))
+	}))
+	defer server.Close()
+
+	views, err := NewClickHouseViews(clickhouse.NewClient(server.URL, "", "", "dataflux")).LastViewed(context.Background(), []string{"asset-1", "asset-2"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"asset-1": time.Date(2026, 3, 1, 12, 30, 0, 250e6, time.UTC)}, views)
+
+	_, err = NewClickHouseViews(clickhouse.NewClient("", "", "", "dataflux")).LastViewed(context.Background(), []string{"asset-1"})
+	assert.Error(t, err)
+}
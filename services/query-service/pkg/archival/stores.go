@@ -0,0 +1,112 @@
+package archival
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"dataflux/query-service/pkg/analytics"
+	"dataflux/query-service/pkg/clickhouse"
+	"dataflux/query-service/pkg/storage"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PostgresAssets reads assets and the storage class in their metadata
+type PostgresAssets struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresAssets creates an asset source
+func NewPostgresAssets(pool *pgxpool.Pool) *PostgresAssets {
+	return &PostgresAssets{pool: pool}
+}
+
+// Unarchived lists the assets matching query whose storage class is not an
+// archive class, largest first
+func (p *PostgresAssets) Unarchived(ctx context.Context, query Query) ([]Candidate, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT a.id::text, a.filename, a.mime_type, a.file_size,
+		       COALESCE(e.metadata->>'storage_class', ''), COALESCE(e.parent_id::text, ''), e.created_at
+		FROM assets a
+		JOIN entities e ON e.id = a.id
+		WHERE e.created_at < $1
+		  AND upper(COALESCE(e.metadata->>'storage_class', '')) <> ALL($2)
+		  AND ($3 = '' OR e.parent_id::text = $3)
+		  AND a.file_size >= $4
+		ORDER BY a.file_size DESC, a.id
+		OFFSET $5 LIMIT $6
+	`, query.CreatedBefore, storage.ClassesIn(storage.TierArchived), query.CollectionID, query.MinFileSize, query.Offset, query.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assets: %v", err)
+	}
+	defer rows.Close()
+
+	var assets []Candidate
+	for rows.Next() {
+		var asset Candidate
+		if err := rows.Scan(&asset.AssetID, &asset.Filename, &asset.MimeType, &asset.FileSize,
+			&asset.StorageClass, &asset.CollectionID, &asset.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read asset: %v", err)
+		}
+		asset.StorageClass = storage.NormalizeClass(asset.StorageClass)
+		assets = append(assets, asset)
+	}
+	return assets, rows.Err()
+}
+
+// ClickHouseViews reads the last views from the click log
+type ClickHouseViews struct {
+	client *clickhouse.Client
+}
+
+// NewClickHouseViews creates a view source
+func NewClickHouseViews(client *clickhouse.Client) *ClickHouseViews {
+	return &ClickHouseViews{client: client}
+}
+
+// LastViewed returns when each of the assets was last opened; assets never
+// opened are left out
+func (v *ClickHouseViews) LastViewed(ctx context.Context, assetIDs []string) (map[string]time.Time, error) {
+	if !v.client.Enabled() {
+		return nil, analytics.ErrDisabled
+	}
+	table, err := v.client.Table(analytics.ClickTable)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := v.client.Exec(ctx, fmt.Sprintf(`
+		SELECT asset_id, toString(max(timestamp)) AS last_viewed
+		FROM %s
+		WHERE asset_id IN {ids:Array(String)}
+		GROUP BY asset_id
+		FORMAT JSON`, table), map[string]string{"ids": clickhouse.ArrayParam(assetIDs)})
+	if clickhouse.IsUnknownTable(err) {
+		// No click has been recorded yet
+		return map[string]time.Time{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query click log: %v", err)
+	}
+
+	var result struct {
+		Data []struct {
+			AssetID    string `json:"asset_id"`
+			LastViewed string `json:"last_viewed"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode click log result: %v", err)
+	}
+	views := make(map[string]time.Time, len(result.Data))
+	for _, row := range result.Data {
+		last, err := time.Parse("2006-01-02 15:04:05.999", row.LastViewed)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected view time %q: %v", row.LastViewed, err)
+		}
+		views[row.AssetID] = last
+	}
+	return views, nil
+}
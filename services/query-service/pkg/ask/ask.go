@@ -0,0 +1,185 @@
+package ask
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dataflux/query-service/pkg/querysyntax"
+	"dataflux/query-service/pkg/ranking"
+	"dataflux/query-service/pkg/transcripts"
+)
+
+// Retrievals that find passages for a question
+const (
+	RetrievalKeyword = "keyword"
+	RetrievalVector  = "vector"
+)
+
+// KeywordQuery turns a question into a full-text query matching any of its
+// words, since a passage rarely holds every word of a question. The text
+// search configuration drops the stop words and ranking favours passages
+// matching more of the rest.
+func KeywordQuery(question string) string {
+	return strings.Join(querysyntax.Words(question), " or ")
+}
+
+// Key identifies a passage across retrievals: its segment, or its
+// transcript when that covers a whole asset
+func Key(transcriptID, segmentID string) string {
+	if segmentID != "" {
+		return "segment:" + segmentID
+	}
+	return "transcript:" + transcriptID
+}
+
+// Source is a transcript passage an answer may cite
+type Source struct {
+	// Number is how the prompt and the answer refer to the source, from 1
+	Number       int      `json:"number"`
+	TranscriptID string   `json:"transcript_id"`
+	AssetID      string   `json:"asset_id"`
+	SegmentID    string   `json:"segment_id,omitempty"`
+	StartTime    *float64 `json:"start_time,omitempty"`
+	EndTime      *float64 `json:"end_time,omitempty"`
+	Language     string   `json:"language"`
+	Text         string   `json:"text"`
+	// Score is the fused relevance, 1 for the best source
+	Score float64 `json:"score"`
+	// RetrievedBy names the retrievals that found the passage
+	RetrievedBy []string `json:"retrieved_by"`
+}
+
+// Citation points from an answer to a source it cites
+type Citation struct {
+	Source    int      `json:"source"`
+	AssetID   string   `json:"asset_id"`
+	SegmentID string   `json:"segment_id,omitempty"`
+	StartTime *float64 `json:"start_time,omitempty"`
+	EndTime   *float64 `json:"end_time,omitempty"`
+	// Timecode is the cited time range as hh:mm:ss-hh:mm:ss
+	Timecode string `json:"timecode,omitempty"`
+}
+
+// Select fuses the hits of the retrievals by reciprocal rank, keyed by Key,
+// and returns the best limit passages as numbered sources. Hits without a
+// passage, such as segments without speech, are skipped.
+func Select(hits []ranking.Hit, passages []transcripts.Passage, limit int) []Source {
+	byKey := map[string]transcripts.Passage{}
+	for _, passage := range passages {
+		key := Key(passage.TranscriptID, passage.SegmentID)
+		if _, ok := byKey[key]; !ok {
+			byKey[key] = passage
+		}
+	}
+	retrievedBy := map[string][]string{}
+	for _, hit := range hits {
+		if !contains(retrievedBy[hit.Key], hit.Source) {
+			retrievedBy[hit.Key] = append(retrievedBy[hit.Key], hit.Source)
+		}
+	}
+
+	fused := ranking.Profile{}.Fuse(hits)
+	keys := make([]string, 0, len(fused))
+	for key := range fused {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if fused[keys[i]] != fused[keys[j]] {
+			return fused[keys[i]] > fused[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	sources := []Source{}
+	for _, key := range keys {
+		passage, ok := byKey[key]
+		if !ok {
+			continue
+		}
+		sort.Strings(retrievedBy[key])
+		sources = append(sources, Source{
+			Number:       len(sources) + 1,
+			TranscriptID: passage.TranscriptID,
+			AssetID:      passage.AssetID,
+			SegmentID:    passage.SegmentID,
+			StartTime:    passage.StartTime,
+			EndTime:      passage.EndTime,
+			Language:     passage.Language,
+			Text:         passage.Text,
+			Score:        fused[key],
+			RetrievedBy:  retrievedBy[key],
+		})
+		if len(sources) == limit {
+			break
+		}
+	}
+	return sources
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// citationPattern matches citations such as [2] and [1, 3]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// CitedNumbers returns the numbers from 1 to count that text cites as [n]
+// or [n, m], in the order first cited
+func CitedNumbers(text string, count int) []int {
+	var numbers []int
+	cited := map[int]bool{}
+	for _, match := range citationPattern.FindAllStringSubmatch(text, -1) {
+		for _, field := range strings.Split(match[1], ",") {
+			number, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || number < 1 || number > count || cited[number] {
+				continue
+			}
+			cited[number] = true
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers
+}
+
+// Citations returns the sources an answer cites, in the order first cited.
+// Numbers that match no source are ignored.
+func Citations(answer string, sources []Source) []Citation {
+	citations := []Citation{}
+	for _, number := range CitedNumbers(answer, len(sources)) {
+		source := sources[number-1]
+		citations = append(citations, Citation{
+			Source:    number,
+			AssetID:   source.AssetID,
+			SegmentID: source.SegmentID,
+			StartTime: source.StartTime,
+			EndTime:   source.EndTime,
+			Timecode:  timeRange(source.StartTime, source.EndTime),
+		})
+	}
+	return citations
+}
+
+// Timecode formats seconds as hh:mm:ss
+func Timecode(seconds float64) string {
+	total := int(seconds)
+	return fmt.Sprintf("%02d:%02d:%02d", total/3600, total/60%60, total%60)
+}
+
+func timeRange(start, end *float64) string {
+	switch {
+	case start == nil:
+		return ""
+	case end == nil:
+		return Timecode(*start)
+	default:
+		return Timecode(*start) + "-" + Timecode(*end)
+	}
+}
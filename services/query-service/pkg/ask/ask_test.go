@@ -0,0 +1,74 @@
+package ask
+
+import (
+	"strings"
+	"testing"
+
+	"dataflux/query-service/pkg/llm"
+	"dataflux/query-service/pkg/ranking"
+	"dataflux/query-service/pkg/transcripts"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seconds(s float64) *float64 {
+	return &s
+}
+
+func TestKeywordQuery(t *testing.T) {
+	assert.Equal(t, "what or did or the or mayor or say", KeywordQuery("What did the mayor say?"))
+}
+
+func TestSelectFusesRetrievals(t *testing.T) {
+	hits := []ranking.Hit{
+		{Key: Key("t1", "s1"), Source: RetrievalKeyword, Score: 0.9},
+		{Key: Key("t2", ""), Source: RetrievalKeyword, Score: 0.5},
+		{Key: Key("", "s3"), Source: RetrievalVector, Score: 0.95},
+		{Key: Key("", "s1"), Source: RetrievalVector, Score: 0.8},
+		{Key: Key("", "s4"), Source: RetrievalVector, Score: 0.7},
+	}
+	passages := []transcripts.Passage{
+		{TranscriptID: "t1", AssetID: "a1", SegmentID: "s1", Text: "flood", StartTime: seconds(65), EndTime: seconds(90)},
+		{TranscriptID: "t2", AssetID: "a2", Text: "whole asset"},
+		{TranscriptID: "t3", AssetID: "a3", SegmentID: "s3", Text: "mayor"},
+	}
+
+	sources := Select(hits, passages, 10)
+	// s4 has no transcript
+	require.Len(t, sources, 3)
+	assert.Equal(t, "t1", sources[0].TranscriptID)
+	assert.Equal(t, 1, sources[0].Number)
+	assert.Equal(t, 1.0, sources[0].Score)
+	assert.Equal(t, []string{RetrievalKeyword, RetrievalVector}, sources[0].RetrievedBy)
+	assert.Equal(t, 3, sources[2].Number)
+
+	assert.Len(t, Select(hits, passages, 1), 1)
+}
+
+func TestCitations(t *testing.T) {
+	sources := []Source{
+		{Number: 1, AssetID: "a1", SegmentID: "s1", StartTime: seconds(65), EndTime: seconds(90)},
+		{Number: 2, AssetID: "a2"},
+		{Number: 3, AssetID: "a3", StartTime: seconds(3725)},
+	}
+	citations := Citations("The river rose [3]. The mayor blamed the dam [1, 3] [7] and later [1].", sources)
+	require.Len(t, citations, 2)
+	assert.Equal(t, 3, citations[0].Source)
+	assert.Equal(t, "01:02:05", citations[0].Timecode)
+	assert.Equal(t, Citation{Source: 1, AssetID: "a1", SegmentID: "s1", StartTime: seconds(65), EndTime: seconds(90), Timecode: "00:01:05-00:01:30"}, citations[1])
+
+	assert.Empty(t, Citations("No sources cited.", sources))
+}
+
+func TestPrompt(t *testing.T) {
+	messages := Prompt("Why did it flood?", []Source{
+		{Number: 1, AssetID: "a1", StartTime: seconds(65), EndTime: seconds(90), Text: "the dam failed"},
+		{Number: 2, AssetID: "a2", Text: strings.Repeat("x", 3000)},
+	})
+	require.Len(t, messages, 2)
+	assert.Equal(t, llm.RoleSystem, messages[0].Role)
+	assert.Contains(t, messages[1].Content, "[1] asset a1, 00:01:05-00:01:30\nthe dam failed")
+	assert.Contains(t, messages[1].Content, "[2] asset a2\n"+strings.Repeat("x", maxPromptRunes)+"…")
+	assert.True(t, strings.HasSuffix(messages[1].Content, "Question: Why did it flood?"))
+}
@@ -0,0 +1,53 @@
+package ask
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"dataflux/query-service/pkg/llm"
+)
+
+// maxPromptRunes is how much of a passage the model is shown
+const maxPromptRunes = 2000
+
+const systemPrompt = `You answer questions about a media archive using only the numbered transcript excerpts you are given.
+Cite the excerpt behind every statement by its number in square brackets, such as [1] or [2, 3].
+If the excerpts do not answer the question, say so instead of guessing.
+Answer in the language of the question.`
+
+// Prompt builds the chat messages asking for an answer from the sources
+func Prompt(question string, sources []Source) []llm.Message {
+	var excerpts strings.Builder
+	for _, source := range sources {
+		fmt.Fprintf(&excerpts, "[%d] asset %s", source.Number, source.AssetID)
+		if span := timeRange(source.StartTime, source.EndTime); span != "" {
+			fmt.Fprintf(&excerpts, ", %s", span)
+		}
+		text := []rune(source.Text)
+		if len(text) > maxPromptRunes {
+			text = append(text[:maxPromptRunes], '…')
+		}
+		fmt.Fprintf(&excerpts, "\n%s\n\n", string(text))
+	}
+	return []llm.Message{
+		{Role: llm.RoleSystem, Content: systemPrompt},
+		{Role: llm.RoleUser, Content: "Excerpts:\n\n" + excerpts.String() + "Question: " + question},
+	}
+}
+
+// Answerer answers questions from sources with a chat model
+type Answerer struct {
+	model llm.Completer
+}
+
+// NewAnswerer creates an answerer asking the model
+func NewAnswerer(model llm.Completer) *Answerer {
+	return &Answerer{model: model}
+}
+
+// Answer asks the model to answer the question from the sources, citing
+// them by number
+func (a *Answerer) Answer(ctx context.Context, question string, sources []Source) (string, error) {
+	return a.model.Complete(ctx, Prompt(question, sources))
+}
@@ -0,0 +1,360 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// KeyHeader carries the API key on REST requests; gRPC callers send it as
+// x-api-key metadata
+const KeyHeader = "X-API-Key"
+
+// ErrInvalidKey is returned for unknown, revoked and expired keys
+var ErrInvalidKey = errors.New("invalid API key")
+
+// ErrInvalidToken is returned for bearer tokens that fail verification
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// tenantPattern limits tenant IDs to what can be part of Weaviate class
+// names and Neo4j labels
+var tenantPattern = regexp.MustCompile(`^[a-z0-9_]{1,40}$`)
+
+// ValidTenantID reports whether id can name a tenant
+func ValidTenantID(id string) bool {
+	return tenantPattern.MatchString(id)
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	KeyID string
+	// Subject is the sub claim of a bearer token
+	Subject string
+	Name    string
+	UserID  string
+	Roles   []string
+	Limit   Limit
+	// Scoped principals may only see assets in Collections. API keys are
+	// never scoped.
+	Scoped      bool
+	Collections []string
+	// TenantID confines the caller to one tenant's assets; empty means the
+	// caller operates the deployment rather than belonging to a tenant
+	TenantID string
+	// Widget principals come from widget tokens and may only call the
+	// routes allowed to widgets
+	Widget bool
+}
+
+// Authenticated reports whether the principal presented a key or token
+func (p Principal) Authenticated() bool {
+	return p.KeyID != "" || p.Subject != ""
+}
+
+// HasRole reports whether the principal holds the role
+func (p Principal) HasRole(role string) bool {
+	for _, held := range p.Roles {
+		if held == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal stores the principal in the context
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal stored by the middleware or interceptor
+func FromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// Authenticator resolves an API key to its principal
+type Authenticator interface {
+	Authenticate(ctx context.Context, key string) (Principal, error)
+}
+
+// TokenVerifier checks a bearer token and returns its principal
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (Principal, error)
+}
+
+// Limiter takes one request from a token bucket
+type Limiter interface {
+	Allow(ctx context.Context, bucket string, limit Limit) (Decision, error)
+}
+
+// Config controls who may call the service and how often
+type Config struct {
+	// Required rejects requests without a key or token; otherwise they are
+	// served anonymously under AnonymousLimit, per client IP
+	Required bool
+	// KeyLimit applies to keys without a limit of their own and to tokens,
+	// per subject
+	KeyLimit       Limit
+	AnonymousLimit Limit
+	// TenantRequired refuses callers without a tenant on the endpoints
+	// guarded by RequireTenant and on every gRPC method
+	TenantRequired bool
+}
+
+// Rejection is why a request was refused, with its HTTP status
+type Rejection struct {
+	Status     int
+	Message    string
+	RetryAfter time.Duration
+}
+
+// Guard authenticates API keys and bearer tokens and applies per-caller
+// rate limits
+type Guard struct {
+	keys    Authenticator
+	tokens  TokenVerifier
+	widgets TokenVerifier
+	limiter Limiter
+	config  Config
+}
+
+// NewGuard creates a guard. tokens may be nil to leave bearer tokens
+// unsupported and limiter nil to disable rate limiting.
+func NewGuard(keys Authenticator, tokens TokenVerifier, limiter Limiter, config Config) *Guard {
+	return &Guard{keys: keys, tokens: tokens, limiter: limiter, config: config}
+}
+
+// WithWidgets accepts the widget tokens verified by widgets as bearer
+// tokens, whether or not JWTs are supported
+func (g *Guard) WithWidgets(widgets TokenVerifier) *Guard {
+	g.widgets = widgets
+	return g
+}
+
+// Admit authenticates the key or bearer token, if any, and takes a token
+// from the caller's bucket. Anonymous callers get a zero principal. A failing
+// limiter lets requests through rather than take the service down with it.
+func (g *Guard) Admit(ctx context.Context, key, token, clientIP string) (Principal, *Rejection) {
+	var principal Principal
+	bucket := "ip:" + clientIP
+	limit := g.config.AnonymousLimit
+
+	if key == "" && IsWidgetToken(token) && g.widgets != nil {
+		var err error
+		principal, err = g.widgets.Verify(ctx, token)
+		if err != nil {
+			return Principal{}, &Rejection{Status: http.StatusUnauthorized, Message: err.Error()}
+		}
+		// A widget token is shared by a site's visitors, each limited alone
+		bucket = principal.Subject + ":" + clientIP
+		limit = principal.Limit
+	} else if key == "" && token != "" && g.tokens != nil {
+		var err error
+		principal, err = g.tokens.Verify(ctx, token)
+		if errors.Is(err, ErrInvalidToken) {
+			return Principal{}, &Rejection{Status: http.StatusUnauthorized, Message: err.Error()}
+		}
+		if err != nil {
+			log.Printf("Warning: bearer token verification failed: %v", err)
+			return Principal{}, &Rejection{Status: http.StatusServiceUnavailable, Message: "authentication is unavailable", RetryAfter: 5 * time.Second}
+		}
+		// Subjects are only unique within their issuer's tenant
+		bucket = "sub:" + principal.Subject
+		if principal.TenantID != "" {
+			bucket = "sub:" + principal.TenantID + "/" + principal.Subject
+		}
+		limit = g.config.KeyLimit
+	} else if key != "" {
+		var err error
+		principal, err = g.keys.Authenticate(ctx, key)
+		if errors.Is(err, ErrInvalidKey) {
+			return Principal{}, &Rejection{Status: http.StatusUnauthorized, Message: err.Error()}
+		}
+		if err != nil {
+			log.Printf("Warning: API key lookup failed: %v", err)
+			return Principal{}, &Rejection{Status: http.StatusServiceUnavailable, Message: "authentication is unavailable", RetryAfter: 5 * time.Second}
+		}
+		bucket = "key:" + principal.KeyID
+		limit = principal.Limit
+		if limit.PerMinute == 0 {
+			limit = g.config.KeyLimit
+		}
+	} else if g.config.Required {
+		return principal, &Rejection{Status: http.StatusUnauthorized, Message: "an API key or bearer token is required"}
+	}
+
+	if g.limiter != nil && limit.PerMinute > 0 {
+		decision, err := g.limiter.Allow(ctx, bucket, limit)
+		if err != nil {
+			log.Printf("Warning: rate limit check failed: %v", err)
+		} else if !decision.Allowed {
+			return principal, &Rejection{Status: http.StatusTooManyRequests, Message: "rate limit exceeded", RetryAfter: decision.RetryAfter}
+		}
+	}
+	return principal, nil
+}
+
+// Middleware authenticates REST requests with the X-API-Key header, an
+// "Authorization: ApiKey <key>" header or, when tokens are supported, an
+// "Authorization: Bearer <jwt>" header
+func (g *Guard) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, token := g.credentials(c.GetHeader(KeyHeader), c.GetHeader("Authorization"))
+		principal, rejection := g.Admit(c.Request.Context(), key, token, c.ClientIP())
+		if rejection != nil {
+			if rejection.RetryAfter > 0 {
+				c.Header("Retry-After", retryAfterSeconds(rejection.RetryAfter))
+			}
+			c.AbortWithStatusJSON(rejection.Status, gin.H{"error": rejection.Message})
+			return
+		}
+		if principal.Authenticated() {
+			c.Request = c.Request.WithContext(WithPrincipal(c.Request.Context(), principal))
+		}
+		c.Next()
+	}
+}
+
+// RequireRole refuses callers without the role. Anonymous callers are
+// refused too, even when keys are optional elsewhere. A nil guard lets
+// everyone through.
+func (g *Guard) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if g == nil {
+			c.Next()
+			return
+		}
+		principal, ok := FromContext(c.Request.Context())
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "an API key or bearer token is required"})
+			return
+		}
+		if !principal.HasRole(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "the " + role + " role is required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireTenant refuses callers without a tenant when the guard is
+// configured with TenantRequired. A nil guard lets everyone through.
+func (g *Guard) RequireTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if g == nil || !g.config.TenantRequired {
+			c.Next()
+			return
+		}
+		if principal, _ := FromContext(c.Request.Context()); principal.TenantID == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "a tenant is required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyTenants refuses callers that belong to a tenant, for endpoints that
+// span the whole deployment
+func (g *Guard) DenyTenants() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal, _ := FromContext(c.Request.Context()); principal.TenantID != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not available to tenant callers"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// UnaryInterceptor authenticates gRPC calls with x-api-key or authorization
+// metadata. The health and reflection services stay open so probes keep
+// working.
+func (g *Guard) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if strings.HasPrefix(info.FullMethod, "/grpc.health.") || strings.HasPrefix(info.FullMethod, "/grpc.reflection.") {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var keyHeader, authorization string
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		keyHeader = values[0]
+	}
+	if values := md.Get("authorization"); len(values) > 0 {
+		authorization = values[0]
+	}
+	key, token := g.credentials(keyHeader, authorization)
+	var clientIP string
+	if p, ok := peer.FromContext(ctx); ok {
+		clientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(clientIP); err == nil {
+			clientIP = host
+		}
+	}
+
+	principal, rejection := g.Admit(ctx, key, token, clientIP)
+	if rejection != nil {
+		code := codes.Unavailable
+		switch rejection.Status {
+		case http.StatusUnauthorized:
+			code = codes.Unauthenticated
+		case http.StatusTooManyRequests:
+			code = codes.ResourceExhausted
+		}
+		if rejection.RetryAfter > 0 {
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfterSeconds(rejection.RetryAfter)))
+		}
+		return nil, status.Error(code, rejection.Message)
+	}
+	if g.config.TenantRequired && principal.TenantID == "" {
+		return nil, status.Error(codes.PermissionDenied, "a tenant is required")
+	}
+	// Widget tokens are for browsers, which do not speak gRPC
+	if principal.Widget {
+		return nil, status.Error(codes.PermissionDenied, "not available to widget tokens")
+	}
+	if principal.Authenticated() {
+		ctx = WithPrincipal(ctx, principal)
+	}
+	return handler(ctx, req)
+}
+
+// credentials picks the API key or bearer token out of the key and
+// authorization headers. Bearer tokens are ignored unless a verifier is
+// configured, as some clients send them to every service they call; widget
+// tokens only need widgets to be accepted.
+func (g *Guard) credentials(keyHeader, authorization string) (key, token string) {
+	if key := strings.TrimSpace(keyHeader); key != "" {
+		return key, ""
+	}
+	scheme, value, found := strings.Cut(authorization, " ")
+	switch {
+	case !found:
+	case strings.EqualFold(scheme, "ApiKey"):
+		return strings.TrimSpace(value), ""
+	case strings.EqualFold(scheme, "Bearer") && g.widgets != nil && IsWidgetToken(strings.TrimSpace(value)):
+		return "", strings.TrimSpace(value)
+	case strings.EqualFold(scheme, "Bearer") && g.tokens != nil:
+		return "", strings.TrimSpace(value)
+	}
+	return "", ""
+}
+
+// retryAfterSeconds rounds up, so clients never retry before a token is back
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeKeys map[string]Principal
+
+func (f fakeKeys) Authenticate(ctx context.Context, key string) (Principal, error) {
+	if key == "broken" {
+		return Principal{}, errors.New("connection refused")
+	}
+	principal, ok := f[key]
+	if !ok {
+		return Principal{}, ErrInvalidKey
+	}
+	return principal, nil
+}
+
+// fakeLimiter allows the first allowed requests of each bucket
+type fakeLimiter struct {
+	allowed int
+	taken   map[string]int
+	limits  map[string]Limit
+}
+
+func (f *fakeLimiter) Allow(ctx context.Context, bucket string, limit Limit) (Decision, error) {
+	f.taken[bucket]++
+	f.limits[bucket] = limit
+	if f.taken[bucket] > f.allowed {
+		return Decision{RetryAfter: 1500 * time.Millisecond}, nil
+	}
+	return Decision{Allowed: true}, nil
+}
+
+var keys = fakeKeys{
+	"reader": {KeyID: "k1", UserID: "user-1", Roles: []string{"viewer"}},
+	"admin":  {KeyID: "k2", Roles: []string{"admin"}, Limit: Limit{PerMinute: 5}},
+	"acme":   {KeyID: "k3", UserID: "user-3", TenantID: "acme"},
+}
+
+func newRouter(guard *Guard) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(guard.Middleware())
+	router.GET("/whoami", func(c *gin.Context) {
+		principal, _ := FromContext(c.Request.Context())
+		c.String(http.StatusOK, principal.UserID)
+	})
+	router.GET("/admin", guard.RequireRole("admin"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return router
+}
+
+func get(router *gin.Engine, path string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddlewareRequiresValidKey(t *testing.T) {
+	router := newRouter(NewGuard(keys, nil, nil, Config{Required: true}))
+
+	assert.Equal(t, http.StatusUnauthorized, get(router, "/whoami").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(router, "/whoami", KeyHeader, "stolen").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, get(router, "/whoami", KeyHeader, "broken").Code)
+
+	rec := get(router, "/whoami", KeyHeader, "reader")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "user-1", rec.Body.String())
+
+	rec = get(router, "/whoami", "Authorization", "ApiKey reader")
+	assert.Equal(t, "user-1", rec.Body.String())
+}
+
+func TestMiddlewareRateLimitsPerKey(t *testing.T) {
+	limiter := &fakeLimiter{allowed: 2, taken: map[string]int{}, limits: map[string]Limit{}}
+	router := newRouter(NewGuard(keys, nil, limiter, Config{KeyLimit: Limit{PerMinute: 60, Burst: 10}, AnonymousLimit: Limit{PerMinute: 6}}))
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, get(router, "/whoami", KeyHeader, "reader").Code)
+	}
+	rec := get(router, "/whoami", KeyHeader, "reader")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	// Other keys and anonymous callers have buckets of their own
+	assert.Equal(t, http.StatusOK, get(router, "/whoami", KeyHeader, "admin").Code)
+	assert.Equal(t, http.StatusOK, get(router, "/whoami").Code)
+
+	assert.Equal(t, Limit{PerMinute: 60, Burst: 10}, limiter.limits["key:k1"])
+	assert.Equal(t, Limit{PerMinute: 5}, limiter.limits["key:k2"])
+	assert.Equal(t, Limit{PerMinute: 6}, limiter.limits["ip:192.0.2.1"])
+}
+
+func TestRequireRole(t *testing.T) {
+	router := newRouter(NewGuard(keys, nil, nil, Config{}))
+
+	assert.Equal(t, http.StatusForbidden, get(router, "/admin", KeyHeader, "reader").Code)
+	assert.Equal(t, http.StatusNoContent, get(router, "/admin", KeyHeader, "admin").Code)
+	// Keys are optional here, but not for routes needing a role
+	assert.Equal(t, http.StatusUnauthorized, get(router, "/admin").Code)
+
+	var guard *Guard
+	gin.SetMode(gin.TestMode)
+	open := gin.New()
+	open.GET("/admin", guard.RequireRole("admin"), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	assert.Equal(t, http.StatusNoContent, get(open, "/admin").Code)
+}
+
+func TestTenantGuards(t *testing.T) {
+	for _, required := range []bool{false, true} {
+		guard := NewGuard(keys, nil, nil, Config{TenantRequired: required})
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.Use(guard.Middleware())
+		router.GET("/search", guard.RequireTenant(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+		router.GET("/stats", guard.DenyTenants(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+		assert.Equal(t, http.StatusNoContent, get(router, "/search", KeyHeader, "acme").Code)
+		assert.Equal(t, http.StatusForbidden, get(router, "/stats", KeyHeader, "acme").Code)
+		assert.Equal(t, http.StatusNoContent, get(router, "/stats", KeyHeader, "reader").Code)
+
+		want := http.StatusNoContent
+		if required {
+			want = http.StatusForbidden
+		}
+		assert.Equal(t, want, get(router, "/search", KeyHeader, "reader").Code)
+		assert.Equal(t, want, get(router, "/search").Code)
+	}
+
+	assert.True(t, ValidTenantID("acme_2"))
+	assert.False(t, ValidTenantID(""))
+	assert.False(t, ValidTenantID("Acme"))
+	assert.False(t, ValidTenantID("acme`) MATCH (n"))
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	guard := NewGuard(keys, nil, nil, Config{Required: true})
+	info := &grpc.UnaryServerInfo{FullMethod: "/dataflux.query.v1.QueryService/Search"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		principal, _ := FromContext(ctx)
+		return principal.UserID, nil
+	}
+
+	_, err := guard.UnaryInterceptor(context.Background(), nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "reader"))
+	userID, err := guard.UnaryInterceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", userID)
+
+	health := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	_, err = guard.UnaryInterceptor(context.Background(), nil, health, handler)
+	assert.NoError(t, err)
+
+	tenanted := NewGuard(keys, nil, nil, Config{Required: true, TenantRequired: true})
+	_, err = tenanted.UnaryInterceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "acme"))
+	userID, err = tenanted.UnaryInterceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "user-3", userID)
+}
+
+func TestHashAndGenerateKey(t *testing.T) {
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", HashKey(""))
+
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "dfx_"))
+	assert.Len(t, key, 52)
+
+	other, err := GenerateKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
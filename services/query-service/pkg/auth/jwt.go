@@ -0,0 +1,401 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keyRefetchInterval bounds the JWKS refetches triggered by unknown key
+// IDs, so tokens with made-up kids cannot hammer the issuer
+const keyRefetchInterval = time.Minute
+
+// signingHashes are the supported JWS algorithms; HMAC and "none" are
+// refused since the service only ever holds public keys
+var signingHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// ecdsaCurves maps the ES algorithms to the only curve each may use
+var ecdsaCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+// JWTConfig controls which bearer tokens are accepted and how their claims
+// map to a principal
+type JWTConfig struct {
+	// Issuer and Audience must match the iss and aud claims when set
+	Issuer   string
+	Audience string
+	// JWKSURL serves the issuer's public signing keys
+	JWKSURL string
+	// CollectionsClaim lists the collections the token may see, as an array
+	// or a space or comma separated string. "*" grants every collection and
+	// a missing claim grants none. Dots walk into nested objects.
+	CollectionsClaim string
+	// RolesClaim lists the caller's roles, in the same forms
+	RolesClaim string
+	// TenantClaim names the caller's tenant; tokens without it belong to no
+	// tenant
+	TenantClaim string
+	// Leeway tolerates clock skew on exp and nbf
+	Leeway time.Duration
+	// RefreshInterval is how long fetched keys are used before refetching
+	RefreshInterval time.Duration
+}
+
+// JWTVerifier verifies RS and ES signed JWTs against the issuer's JWKS
+type JWTVerifier struct {
+	config JWTConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewJWTVerifier creates a verifier; keys are fetched on first use
+func NewJWTVerifier(config JWTConfig, client *http.Client) *JWTVerifier {
+	if config.CollectionsClaim == "" {
+		config.CollectionsClaim = "collections"
+	}
+	if config.RolesClaim == "" {
+		config.RolesClaim = "roles"
+	}
+	if config.TenantClaim == "" {
+		config.TenantClaim = "tenant_id"
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = time.Hour
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &JWTVerifier{config: config, client: client, now: time.Now}
+}
+
+// Verify checks the token's signature and claims and returns its principal
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, invalidToken("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, invalidToken("malformed header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, invalidToken("malformed signature")
+	}
+	if _, ok := signingHashes[header.Alg]; !ok {
+		return Principal{}, invalidToken("unsupported algorithm " + header.Alg)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return Principal{}, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return Principal{}, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, invalidToken("malformed claims")
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return Principal{}, err
+	}
+	return v.principal(claims), nil
+}
+
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}) error {
+	now := v.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return invalidToken("exp is required")
+	}
+	if now.Add(-v.config.Leeway).After(time.Unix(int64(exp), 0)) {
+		return invalidToken("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return invalidToken("token is not valid yet")
+	}
+	if v.config.Issuer != "" && claims["iss"] != v.config.Issuer {
+		return invalidToken("unexpected issuer")
+	}
+	if v.config.Audience != "" && !containsValue(claimStrings(claims["aud"]), v.config.Audience) {
+		return invalidToken("unexpected audience")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return invalidToken("sub is required")
+	}
+	if tenant := claimValue(claims, v.config.TenantClaim); tenant != nil {
+		if id, _ := tenant.(string); !ValidTenantID(id) {
+			return invalidToken("invalid tenant")
+		}
+	}
+	return nil
+}
+
+// principal maps verified claims to a principal. Tokens are always scoped
+// to their collections unless they hold "*".
+func (v *JWTVerifier) principal(claims map[string]interface{}) Principal {
+	subject := claims["sub"].(string)
+	principal := Principal{
+		Subject:     subject,
+		UserID:      subject,
+		Roles:       claimStrings(claimValue(claims, v.config.RolesClaim)),
+		Scoped:      true,
+		Collections: []string{},
+	}
+	if name, ok := claims["name"].(string); ok {
+		principal.Name = name
+	}
+	principal.TenantID, _ = claimValue(claims, v.config.TenantClaim).(string)
+	for _, collection := range claimStrings(claimValue(claims, v.config.CollectionsClaim)) {
+		if collection == "*" {
+			principal.Scoped = false
+			principal.Collections = nil
+			break
+		}
+		principal.Collections = append(principal.Collections, collection)
+	}
+	return principal
+}
+
+// key returns the signing key with the ID, refetching the JWKS when the
+// cached keys are stale or do not know the ID. Stale keys stay in use while
+// the issuer cannot be reached.
+func (v *JWTVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	key, found := v.lookup(kid)
+	age := now.Sub(v.fetchedAt)
+	if age > v.config.RefreshInterval || (!found && age > keyRefetchInterval) {
+		keys, err := v.fetch(ctx)
+		switch {
+		case err != nil && !found:
+			return nil, err
+		case err != nil:
+			log.Printf("Warning: %v; using cached signing keys", err)
+		default:
+			v.keys, v.fetchedAt = keys, now
+			key, found = v.lookup(kid)
+		}
+	}
+	if !found {
+		return nil, invalidToken("unknown signing key")
+	}
+	return key, nil
+}
+
+// lookup finds a cached key; tokens without a kid match a lone key
+func (v *JWTVerifier) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// jwk is one key of a JWKS document
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (v *JWTVerifier) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.config.JWKSURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build JWKS request: %v", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %v", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(document.Keys))
+	for _, entry := range document.Keys {
+		if entry.Use != "" && entry.Use != "sig" {
+			continue
+		}
+		key, err := entry.publicKey()
+		if err != nil {
+			log.Printf("Warning: skipping JWKS key %q: %v", entry.Kid, err)
+			continue
+		}
+		keys[entry.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		for _, candidate := range ecdsaCurves {
+			if candidate.Params().Name == k.Crv {
+				curve = candidate
+			}
+		}
+		if curve == nil {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	hash := signingHashes[alg]
+	hasher := hash.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		// ES signatures are r and s concatenated, each padded to the curve size
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if ecdsaCurves[alg] == key.Curve && len(signature) == 2*size {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if ecdsa.Verify(key, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return invalidToken("bad signature")
+}
+
+// claimValue looks up a claim, walking into nested objects at each dot
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// claimStrings reads a claim holding an array of strings or a space or
+// comma separated string
+func claimStrings(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		values = strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok && str != "" {
+				values = append(values, str)
+			}
+		}
+	}
+	return values
+}
+
+func containsValue(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func invalidToken(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidToken, reason)
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// issuer serves a JWKS and signs tokens with its keys
+type issuer struct {
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	fetches int32
+	server  *httptest.Server
+}
+
+func newIssuer(t *testing.T) *issuer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	iss := &issuer{rsaKey: rsaKey, ecKey: ecKey}
+	iss.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&iss.fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": encode(ecKey.X.Bytes()), "y": encode(ecKey.Y.Bytes())},
+			{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		}})
+	}))
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+func (iss *issuer) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, iss.ecKey, digest[:])
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	require.NoError(t, err)
+	return signed + "." + encode(signature)
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func claims(overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss":         "https://id.example.com",
+		"aud":         []string{"dataflux", "other"},
+		"sub":         "user-7",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+		"roles":       "viewer editor",
+		"collections": []string{"c1", "c2"},
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	return claims
+}
+
+func newVerifier(iss *issuer) *JWTVerifier {
+	return NewJWTVerifier(JWTConfig{Issuer: "https://id.example.com", Audience: "dataflux", JWKSURL: iss.server.URL}, nil)
+}
+
+func TestJWTVerifierAcceptsSignedTokens(t *testing.T) {
+	iss := newIssuer(t)
+	verifier := newVerifier(iss)
+
+	principal, err := verifier.Verify(context.Background(), iss.sign(t, "RS256", "rsa-1", claims(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, "user-7", principal.Subject)
+	assert.Equal(t, "user-7", principal.UserID)
+	assert.Equal(t, []string{"viewer", "editor"}, principal.Roles)
+	assert.True(t, principal.Scoped)
+	assert.Equal(t, []string{"c1", "c2"}, principal.Collections)
+
+	principal, err = verifier.Verify(context.Background(), iss.sign(t, "ES256", "ec-1", claims(map[string]interface{}{"collections": "c3,*"})))
+	require.NoError(t, err)
+	assert.False(t, principal.Scoped)
+
+	// Without the claim the token sees no collection at all
+	principal, err = verifier.Verify(context.Background(), iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"collections": nil})))
+	require.NoError(t, err)
+	assert.True(t, principal.Scoped)
+	assert.Empty(t, principal.Collections)
+	assert.Empty(t, principal.TenantID)
+
+	principal, err = verifier.Verify(context.Background(), iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"tenant_id": "acme"})))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", principal.TenantID)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&iss.fetches))
+}
+
+func TestJWTVerifierNestedClaims(t *testing.T) {
+	iss := newIssuer(t)
+	verifier := NewJWTVerifier(JWTConfig{JWKSURL: iss.server.URL, CollectionsClaim: "dataflux.collections", RolesClaim: "realm_access.roles"}, nil)
+
+	token := iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{
+		"dataflux":     map[string]interface{}{"collections": []string{"c9"}},
+		"realm_access": map[string]interface{}{"roles": []string{"admin"}},
+	}))
+	principal, err := verifier.Verify(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c9"}, principal.Collections)
+	assert.Equal(t, []string{"admin"}, principal.Roles)
+}
+
+func TestJWTVerifierRejectsInvalidTokens(t *testing.T) {
+	iss := newIssuer(t)
+	verifier := newVerifier(iss)
+	other := newIssuer(t)
+
+	for name, token := range map[string]string{
+		"expired":        iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"not yet valid":  iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"no expiry":      iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"exp": nil})),
+		"wrong issuer":   iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"iss": "https://evil.example.com"})),
+		"wrong audience": iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"aud": "billing"})),
+		"no subject":     iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"sub": nil})),
+		"bad tenant":     iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"tenant_id": "Acme Corp"})),
+		"tenant list":    iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"tenant_id": []string{"acme"}})),
+		"foreign key":    other.sign(t, "RS256", "rsa-1", claims(nil)),
+		"algorithm swap": iss.sign(t, "RS256", "ec-1", claims(nil)),
+		"hmac":           "eyJhbGciOiJIUzI1NiIsImtpZCI6ImhtYWMifQ.e30.c2ln",
+		"malformed":      "not-a-token",
+	} {
+		_, err := verifier.Verify(context.Background(), token)
+		assert.True(t, errors.Is(err, ErrInvalidToken), "%s: %v", name, err)
+	}
+}
+
+func TestJWTVerifierRefetchesUnknownKeys(t *testing.T) {
+	iss := newIssuer(t)
+	verifier := newVerifier(iss)
+	now := time.Now()
+	verifier.now = func() time.Time { return now }
+
+	_, err := verifier.Verify(context.Background(), iss.sign(t, "RS256", "rsa-1", claims(nil)))
+	require.NoError(t, err)
+
+	// Unknown kids only refetch once the refetch interval has passed
+	_, err = verifier.Verify(context.Background(), iss.sign(t, "RS256", "rsa-2", claims(nil)))
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&iss.fetches))
+
+	now = now.Add(2 * keyRefetchInterval)
+	_, err = verifier.Verify(context.Background(), iss.sign(t, "RS256", "rsa-2", claims(nil)))
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&iss.fetches))
+
+	// Cached keys keep working while the issuer is down
+	iss.server.Close()
+	now = now.Add(2 * time.Hour)
+	_, err = verifier.Verify(context.Background(), iss.sign(t, "RS256", "rsa-1", claims(map[string]interface{}{"exp": now.Add(time.Hour).Unix()})))
+	assert.NoError(t, err)
+}
+
+func TestMiddlewareAcceptsBearerTokens(t *testing.T) {
+	iss := newIssuer(t)
+	token := iss.sign(t, "RS256", "rsa-1", claims(nil))
+
+	router := newRouter(NewGuard(keys, newVerifier(iss), nil, Config{Required: true}))
+	rec := get(router, "/whoami", "Authorization", "Bearer "+token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "user-7", rec.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, get(router, "/whoami", "Authorization", "Bearer "+token+"x").Code)
+
+	// Without a verifier bearer tokens are ignored as before
+	router = newRouter(NewGuard(keys, nil, nil, Config{Required: true}))
+	assert.Equal(t, http.StatusUnauthorized, get(router, "/whoami", "Authorization", "Bearer "+token).Code)
+}
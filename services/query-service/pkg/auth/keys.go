@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// keyPrefix starts every generated key so leaked keys are easy to spot
+const keyPrefix = "dfx_"
+
+// displayLength is how much of a key is kept to tell keys apart in listings
+const displayLength = len(keyPrefix) + 8
+
+// ErrNotFound is returned when revoking an unknown key
+var ErrNotFound = errors.New("API key not found")
+
+// APIKey describes a stored key; the key itself is only known at creation
+type APIKey struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	UserID string   `json:"user_id,omitempty"`
+	Roles  []string `json:"roles"`
+	// TenantID confines the key to one tenant's assets
+	TenantID string `json:"tenant_id,omitempty"`
+	// RateLimit is in requests per minute; zero uses the service default
+	RateLimit int        `json:"rate_limit,omitempty"`
+	Burst     int        `json:"burst,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HashKey returns the hex SHA-256 of a key. Keys are random and long, so an
+// unsalted hash is enough to make a leaked table useless.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateKey returns a new random key
+func GenerateKey() (string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	return keyPrefix + hex.EncodeToString(random), nil
+}
+
+// KeyStore keeps hashed API keys in PostgreSQL
+type KeyStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewKeyStore creates a key store
+func NewKeyStore(pool *pgxpool.Pool) *KeyStore {
+	return &KeyStore{pool: pool}
+}
+
+// EnsureSchema creates the query_api_keys table, kept apart from the
+// auth service's api_keys table in the same database, and adds the tenant
+// column to tables created before it existed
+func (s *KeyStore) EnsureSchema(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS query_api_keys (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			name VARCHAR(255) NOT NULL,
+			key_hash CHAR(64) NOT NULL UNIQUE,
+			prefix VARCHAR(32) NOT NULL,
+			user_id VARCHAR(255) NOT NULL DEFAULT '',
+			roles TEXT[] NOT NULL DEFAULT '{}',
+			tenant_id VARCHAR(40) NOT NULL DEFAULT '',
+			rate_limit INTEGER NOT NULL DEFAULT 0,
+			burst INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			expires_at TIMESTAMP WITH TIME ZONE,
+			revoked_at TIMESTAMP WITH TIME ZONE,
+			CONSTRAINT valid_rate_limit CHECK (rate_limit >= 0 AND burst >= 0)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, `ALTER TABLE query_api_keys ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(40) NOT NULL DEFAULT ''`)
+	return err
+}
+
+// Authenticate resolves a key to its principal. Unknown, revoked and
+// expired keys give ErrInvalidKey.
+func (s *KeyStore) Authenticate(ctx context.Context, key string) (Principal, error) {
+	var principal Principal
+	err := s.pool.QueryRow(ctx, `
+		SELECT id::text, name, user_id, roles, tenant_id, rate_limit, burst
+		FROM query_api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`, HashKey(key)).Scan(&principal.KeyID, &principal.Name, &principal.UserID, &principal.Roles, &principal.TenantID,
+		&principal.Limit.PerMinute, &principal.Limit.Burst)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Principal{}, ErrInvalidKey
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("failed to look up API key: %v", err)
+	}
+	return principal, nil
+}
+
+// Create stores a new key for the description and returns the key, which
+// cannot be recovered later
+func (s *KeyStore) Create(ctx context.Context, description APIKey) (string, APIKey, error) {
+	if description.TenantID != "" && !ValidTenantID(description.TenantID) {
+		return "", APIKey{}, fmt.Errorf("invalid tenant ID %q", description.TenantID)
+	}
+	key, err := GenerateKey()
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	if description.Roles == nil {
+		description.Roles = []string{}
+	}
+	description.Prefix = key[:displayLength]
+
+	err = s.pool.QueryRow(ctx, `
+		INSERT INTO query_api_keys (name, key_hash, prefix, user_id, roles, tenant_id, rate_limit, burst, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id::text, created_at
+	`, description.Name, HashKey(key), description.Prefix, description.UserID, description.Roles, description.TenantID,
+		description.RateLimit, description.Burst, description.ExpiresAt).Scan(&description.ID, &description.CreatedAt)
+	if err != nil {
+		return "", APIKey{}, fmt.Errorf("failed to create API key: %v", err)
+	}
+	return key, description, nil
+}
+
+// List returns every key, newest first
+func (s *KeyStore) List(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id::text, name, prefix, user_id, roles, tenant_id, rate_limit, burst, created_at, expires_at, revoked_at
+		FROM query_api_keys
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.UserID, &key.Roles, &key.TenantID, &key.RateLimit, &key.Burst,
+			&key.CreatedAt, &key.ExpiresAt, &key.RevokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke disables a key immediately
+func (s *KeyStore) Revoke(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, `UPDATE query_api_keys SET revoked_at = NOW() WHERE id::text = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
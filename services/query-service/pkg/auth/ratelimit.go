@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// rateLimitPrefix namespaces the Redis token buckets
+const rateLimitPrefix = "ratelimit:"
+
+// Limit is a token bucket refilled at PerMinute tokens a minute that holds
+// at most Burst tokens. A zero PerMinute means no limit.
+type Limit struct {
+	PerMinute int
+	Burst     int
+}
+
+// Decision is the outcome of taking a token
+type Decision struct {
+	Allowed bool
+	// RetryAfter is how long until a token is available when not allowed
+	RetryAfter time.Duration
+}
+
+// tokenBucket refills the bucket for the time elapsed since it was last
+// touched and takes a token when one is available. The clock is Redis's, so
+// every instance of the service agrees on it. It returns whether the token
+// was taken and, if not, the milliseconds until one is.
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1]) / 60000
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate) + 1000)
+return {allowed, wait}
+`)
+
+// RateLimiter keeps token buckets in Redis so limits hold across instances
+type RateLimiter struct {
+	client *redis.Client
+}
+
+// NewRateLimiter creates a limiter over the Redis client
+func NewRateLimiter(client *redis.Client) *RateLimiter {
+	return &RateLimiter{client: client}
+}
+
+// Allow takes a token from the named bucket
+func (l *RateLimiter) Allow(ctx context.Context, bucket string, limit Limit) (Decision, error) {
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = limit.PerMinute
+	}
+	result, err := tokenBucket.Run(ctx, l.client, []string{rateLimitPrefix + bucket}, limit.PerMinute, burst).Int64Slice()
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to take rate limit token: %v", err)
+	}
+	if len(result) != 2 {
+		return Decision{}, fmt.Errorf("unexpected rate limit result %v", result)
+	}
+	return Decision{Allowed: result[0] == 1, RetryAfter: time.Duration(result[1]) * time.Millisecond}, nil
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// widgetPrefix starts every widget token, telling them apart from JWTs
+const widgetPrefix = "dfw_"
+
+// WidgetToken describes what a widget token grants. Widget tokens are
+// handed to browsers on external sites, so they are short-lived, read-only
+// and confined to a few collections.
+type WidgetToken struct {
+	ID          string   `json:"id"`
+	TenantID    string   `json:"tenant_id,omitempty"`
+	Collections []string `json:"collection_ids"`
+	// RateLimit is in requests per minute for each visitor's IP
+	RateLimit int       `json:"rate_limit"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// widgetClaims is the signed payload of a widget token
+type widgetClaims struct {
+	ID          string   `json:"jti"`
+	TenantID    string   `json:"tid,omitempty"`
+	Collections []string `json:"col"`
+	RateLimit   int      `json:"rpm"`
+	ExpiresAt   int64    `json:"exp"`
+}
+
+// WidgetIssuer mints and verifies widget tokens. They are signed with a
+// secret rather than stored, so any instance sharing the secret accepts
+// them and they cannot be revoked before they expire.
+type WidgetIssuer struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// NewWidgetIssuer creates an issuer signing with secret
+func NewWidgetIssuer(secret string) *WidgetIssuer {
+	return &WidgetIssuer{secret: []byte(secret), now: time.Now}
+}
+
+// Issue signs a token for the grant, giving it a random ID
+func (w *WidgetIssuer) Issue(grant WidgetToken) (string, WidgetToken, error) {
+	if len(grant.Collections) == 0 {
+		return "", WidgetToken{}, fmt.Errorf("a widget token needs at least one collection")
+	}
+	if grant.TenantID != "" && !ValidTenantID(grant.TenantID) {
+		return "", WidgetToken{}, fmt.Errorf("invalid tenant ID %q", grant.TenantID)
+	}
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return "", WidgetToken{}, fmt.Errorf("failed to generate widget token: %v", err)
+	}
+	grant.ID = hex.EncodeToString(random)
+	grant.ExpiresAt = grant.ExpiresAt.UTC().Truncate(time.Second)
+
+	payload, err := json.Marshal(widgetClaims{
+		ID:          grant.ID,
+		TenantID:    grant.TenantID,
+		Collections: grant.Collections,
+		RateLimit:   grant.RateLimit,
+		ExpiresAt:   grant.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return "", WidgetToken{}, fmt.Errorf("failed to encode widget token: %v", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return widgetPrefix + encoded + "." + w.sign(encoded), grant, nil
+}
+
+// Verify checks a widget token's signature and expiry and returns its
+// principal, which is scoped to the token's collections
+func (w *WidgetIssuer) Verify(ctx context.Context, token string) (Principal, error) {
+	encoded, signature, found := strings.Cut(strings.TrimPrefix(token, widgetPrefix), ".")
+	if !IsWidgetToken(token) || !found {
+		return Principal{}, invalidToken("malformed widget token")
+	}
+	if !hmac.Equal([]byte(signature), []byte(w.sign(encoded))) {
+		return Principal{}, invalidToken("bad widget token signature")
+	}
+	var claims widgetClaims
+	if err := decodeSegment(encoded, &claims); err != nil {
+		return Principal{}, invalidToken("malformed widget token")
+	}
+	if !w.now().Before(time.Unix(claims.ExpiresAt, 0)) {
+		return Principal{}, invalidToken("widget token expired")
+	}
+	return Principal{
+		Subject:     "widget:" + claims.ID,
+		Widget:      true,
+		Limit:       Limit{PerMinute: claims.RateLimit},
+		Scoped:      true,
+		Collections: claims.Collections,
+		TenantID:    claims.TenantID,
+	}, nil
+}
+
+// sign returns the HMAC-SHA256 of the encoded payload
+func (w *WidgetIssuer) sign(encoded string) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IsWidgetToken reports whether a bearer token is a widget token
+func IsWidgetToken(token string) bool {
+	return strings.HasPrefix(token, widgetPrefix)
+}
+
+// AllowWidgets refuses widget callers on every route but routes, given as
+// "METHOD /path" with the path as registered. A nil guard lets everyone
+// through.
+func (g *Guard) AllowWidgets(routes ...string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		allowed[route] = true
+	}
+	return func(c *gin.Context) {
+		if g == nil {
+			c.Next()
+			return
+		}
+		if principal, _ := FromContext(c.Request.Context()); principal.Widget && !allowed[c.Request.Method+" "+c.FullPath()] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not available to widget tokens"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWidgetTokens(t *testing.T) {
+	issuer := NewWidgetIssuer("secret")
+	expires := time.Now().Add(time.Hour)
+	token, grant, err := issuer.Issue(WidgetToken{TenantID: "acme", Collections: []string{"harbour"}, RateLimit: 30, ExpiresAt: expires})
+	require.NoError(t, err)
+	assert.True(t, IsWidgetToken(token))
+	assert.Len(t, grant.ID, 24)
+
+	principal, err := issuer.Verify(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, Principal{
+		Subject:     "widget:" + grant.ID,
+		Widget:      true,
+		Limit:       Limit{PerMinute: 30},
+		Scoped:      true,
+		Collections: []string{"harbour"},
+		TenantID:    "acme",
+	}, principal)
+
+	// Another secret, a changed payload and an expired token are refused
+	_, err = NewWidgetIssuer("other").Verify(context.Background(), token)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+	forged := strings.Replace(token, ".", "e30.", 1)
+	_, err = issuer.Verify(context.Background(), forged)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+	issuer.now = func() time.Time { return expires.Add(time.Second) }
+	_, err = issuer.Verify(context.Background(), token)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+
+	_, _, err = issuer.Issue(WidgetToken{ExpiresAt: expires})
+	assert.Error(t, err)
+}
+
+func TestMiddlewareAcceptsWidgetTokens(t *testing.T) {
+	issuer := NewWidgetIssuer("secret")
+	token, grant, err := issuer.Issue(WidgetToken{Collections: []string{"harbour"}, RateLimit: 30, ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	// Without a JWT verifier, widget tokens are still accepted
+	limiter := &fakeLimiter{allowed: 10, taken: map[string]int{}, limits: map[string]Limit{}}
+	guard := NewGuard(keys, nil, limiter, Config{Required: true}).WithWidgets(issuer)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(guard.Middleware(), guard.AllowWidgets("GET /search"))
+	router.GET("/search", func(c *gin.Context) {
+		principal, _ := FromContext(c.Request.Context())
+		c.String(http.StatusOK, strings.Join(principal.Collections, ","))
+	})
+	router.GET("/stats", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	rec := get(router, "/search", "Authorization", "Bearer "+token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "harbour", rec.Body.String())
+	assert.Equal(t, Limit{PerMinute: 30}, limiter.limits["widget:"+grant.ID+":192.0.2.1"])
+
+	assert.Equal(t, http.StatusForbidden, get(router, "/stats", "Authorization", "Bearer "+token).Code)
+	assert.Equal(t, http.StatusNoContent, get(router, "/stats", KeyHeader, "reader").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(router, "/search", "Authorization", "Bearer dfw_forged.sig").Code)
+}
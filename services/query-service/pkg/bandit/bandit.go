@@ -0,0 +1,488 @@
+package bandit
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Decision kinds
+const (
+	// KindAllocate shifts traffic between the arms
+	KindAllocate = "allocate"
+	// KindRollback takes an arm out of traffic for doing worse than the control
+	KindRollback = "rollback"
+	// KindReset clears the statistics and reinstates every arm
+	KindReset = "reset"
+)
+
+// samples is how many Thompson draws estimate each arm's chance of being best
+const samples = 2000
+
+// minShift is the smallest change in an arm's share that is recorded as a
+// decision; smaller ones are noise
+const minShift = 0.01
+
+// ArmStats is the traffic and clicks of one arm
+type ArmStats struct {
+	Impressions int64 `json:"impressions"`
+	Clicks      int64 `json:"clicks"`
+}
+
+// CTR is the clicks per impression
+func (s ArmStats) CTR() float64 {
+	if s.Impressions == 0 {
+		return 0
+	}
+	return float64(s.Clicks) / float64(s.Impressions)
+}
+
+// State is the traffic split the controller decided on, shared by replicas
+type State struct {
+	Allocation map[string]float64 `json:"allocation"`
+	RolledBack []string           `json:"rolled_back,omitempty"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
+
+// Decision is an audited change of the traffic split
+type Decision struct {
+	At         time.Time           `json:"at"`
+	Kind       string              `json:"kind"`
+	Arm        string              `json:"arm,omitempty"`
+	Reason     string              `json:"reason"`
+	Allocation map[string]float64  `json:"allocation"`
+	Stats      map[string]ArmStats `json:"stats"`
+}
+
+// Store keeps the statistics and state shared between replicas
+type Store interface {
+	// Add counts impressions and clicks of an arm
+	Add(ctx context.Context, arm string, impressions, clicks int64) error
+	Stats(ctx context.Context) (map[string]ArmStats, error)
+	// Clear removes the statistics and the state
+	Clear(ctx context.Context) error
+	SaveState(ctx context.Context, state State) error
+	// LoadState returns the saved state, if there is one
+	LoadState(ctx context.Context) (State, bool, error)
+	// Lock reports whether this replica may update the state for ttl
+	Lock(ctx context.Context, ttl time.Duration) (bool, error)
+}
+
+// AuditLog records decisions
+type AuditLog interface {
+	Record(ctx context.Context, decision Decision) error
+	List(ctx context.Context, limit int) ([]Decision, error)
+}
+
+// Config sets the arms and guardrails of a controller
+type Config struct {
+	// Arms are the ranking profiles traffic is split between
+	Arms []string
+	// Control is the arm the others are compared with; it is never rolled
+	// back. Empty uses the first arm.
+	Control string
+	// MinShare is the least traffic every arm still in play receives
+	MinShare float64
+	// MinImpressions is the traffic every arm gets evenly before traffic is
+	// shifted, and that an arm and the control need before it is judged
+	MinImpressions int64
+	// MaxDegradation rolls an arm back once its click-through rate is this
+	// fraction below the control's, as 0.2 for 20% worse
+	MaxDegradation float64
+}
+
+// Controller splits searches between ranking profiles with Thompson
+// sampling: each arm gets the share of traffic equal to its chance of
+// having the best click-through rate, so traffic moves to the profiles
+// users click on while the others are still explored.
+type Controller struct {
+	config Config
+	store  Store
+	audit  AuditLog
+
+	mu    sync.RWMutex
+	state State
+}
+
+// New creates a controller starting with an even split
+func New(config Config, store Store, audit AuditLog) (*Controller, error) {
+	if len(config.Arms) < 2 {
+		return nil, fmt.Errorf("a ranking bandit needs at least two profiles")
+	}
+	seen := map[string]bool{}
+	for _, arm := range config.Arms {
+		if arm == "" || seen[arm] {
+			return nil, fmt.Errorf("ranking bandit profiles must be named and distinct")
+		}
+		seen[arm] = true
+	}
+	if config.Control == "" {
+		config.Control = config.Arms[0]
+	}
+	if !seen[config.Control] {
+		return nil, fmt.Errorf("control profile %q is not one of the bandit's profiles", config.Control)
+	}
+	if config.MinShare < 0 || config.MinShare*float64(len(config.Arms)) > 1 {
+		return nil, fmt.Errorf("minimum share must be between 0 and 1/%d", len(config.Arms))
+	}
+	if config.MaxDegradation <= 0 || config.MaxDegradation >= 1 {
+		return nil, fmt.Errorf("maximum degradation must be between 0 and 1")
+	}
+	arms := append([]string(nil), config.Arms...)
+	sort.Strings(arms)
+	config.Arms = arms
+	return &Controller{config: config, store: store, audit: audit, state: State{Allocation: even(arms)}}, nil
+}
+
+// Arms returns the profiles traffic is split between
+func (c *Controller) Arms() []string {
+	return c.config.Arms
+}
+
+// Has reports whether profile is one of the arms
+func (c *Controller) Has(profile string) bool {
+	for _, arm := range c.config.Arms {
+		if arm == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// Choose picks the arm of a search. The same key, such as a user ID, gets
+// the same arm while the split stays the same; an empty key gets a random one.
+func (c *Controller) Choose(key string) string {
+	u := rand.Float64()
+	if key != "" {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		u = float64(h.Sum64()%1_000_000) / 1_000_000
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cumulative := 0.0
+	chosen := c.config.Control
+	for _, arm := range c.config.Arms {
+		share := c.state.Allocation[arm]
+		if share == 0 {
+			continue
+		}
+		chosen = arm
+		cumulative += share
+		if u < cumulative {
+			break
+		}
+	}
+	return chosen
+}
+
+// Served counts an impression of an arm
+func (c *Controller) Served(ctx context.Context, arm string) {
+	if err := c.store.Add(ctx, arm, 1, 0); err != nil {
+		log.Printf("Warning: failed to count ranking bandit impression: %v", err)
+	}
+}
+
+// Clicked counts a click on a result ranked by an arm
+func (c *Controller) Clicked(ctx context.Context, arm string) error {
+	return c.store.Add(ctx, arm, 0, 1)
+}
+
+// Status is the current split with the statistics behind it
+type Status struct {
+	Arms    []string            `json:"arms"`
+	Control string              `json:"control"`
+	State   State               `json:"state"`
+	Stats   map[string]ArmStats `json:"stats"`
+}
+
+// Status returns the current split and statistics
+func (c *Controller) Status(ctx context.Context) (Status, error) {
+	stats, err := c.store.Stats(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	return Status{Arms: c.config.Arms, Control: c.config.Control, State: c.current(), Stats: stats}, nil
+}
+
+func (c *Controller) current() State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
+}
+
+func (c *Controller) set(state State) {
+	c.mu.Lock()
+	c.state = state
+	c.mu.Unlock()
+}
+
+// Update applies the guardrails to the latest statistics and shifts traffic,
+// recording every rollback and noticeable shift. It returns the decisions made.
+func (c *Controller) Update(ctx context.Context) ([]Decision, error) {
+	stats, err := c.store.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	previous := c.current()
+	state := State{RolledBack: append([]string(nil), previous.RolledBack...), UpdatedAt: time.Now().UTC()}
+	rolledBack := map[string]bool{}
+	for _, arm := range state.RolledBack {
+		rolledBack[arm] = true
+	}
+
+	var decisions []Decision
+	control := stats[c.config.Control]
+	for _, arm := range c.config.Arms {
+		arm := arm
+		current := stats[arm]
+		if arm == c.config.Control || rolledBack[arm] || current.Impressions < c.config.MinImpressions || control.Impressions < c.config.MinImpressions {
+			continue
+		}
+		if current.CTR() < control.CTR()*(1-c.config.MaxDegradation) {
+			rolledBack[arm] = true
+			state.RolledBack = append(state.RolledBack, arm)
+			decisions = append(decisions, Decision{Kind: KindRollback, Arm: arm, Reason: fmt.Sprintf(
+				"click-through rate %.4f is more than %.0f%% below the control's %.4f",
+				current.CTR(), c.config.MaxDegradation*100, control.CTR())})
+		}
+	}
+
+	var live []string
+	for _, arm := range c.config.Arms {
+		if !rolledBack[arm] {
+			live = append(live, arm)
+		}
+	}
+	reason := "chance of the best click-through rate"
+	state.Allocation = c.allocate(live, stats)
+	for _, arm := range live {
+		if stats[arm].Impressions < c.config.MinImpressions {
+			reason = "even split until every profile has the minimum traffic"
+		}
+	}
+	if len(decisions) > 0 || shifted(previous.Allocation, state.Allocation) {
+		decisions = append(decisions, Decision{Kind: KindAllocate, Reason: reason})
+	}
+
+	if err := c.store.SaveState(ctx, state); err != nil {
+		return nil, err
+	}
+	c.set(state)
+	for i := range decisions {
+		decisions[i].At = state.UpdatedAt
+		decisions[i].Allocation = state.Allocation
+		decisions[i].Stats = stats
+		c.record(ctx, decisions[i])
+	}
+	return decisions, nil
+}
+
+// allocate splits traffic between the live arms by their chance of being
+// best, evenly while any has less than the minimum traffic, with every arm
+// getting at least the minimum share
+func (c *Controller) allocate(live []string, stats map[string]ArmStats) map[string]float64 {
+	allocation := map[string]float64{}
+	for _, arm := range c.config.Arms {
+		allocation[arm] = 0
+	}
+	explored := true
+	for _, arm := range live {
+		explored = explored && stats[arm].Impressions >= c.config.MinImpressions
+	}
+	if !explored {
+		for arm, share := range even(live) {
+			allocation[arm] = share
+		}
+		return allocation
+	}
+
+	for arm, share := range ProbabilityBest(live, stats) {
+		allocation[arm] = share
+	}
+	// Arms under the minimum share are raised to it, at the expense of the others
+	floor := c.config.MinShare
+	var raised float64
+	var rest float64
+	for _, arm := range live {
+		if allocation[arm] < floor {
+			raised += floor - allocation[arm]
+		} else {
+			rest += allocation[arm] - floor
+		}
+	}
+	for _, arm := range live {
+		if allocation[arm] < floor {
+			allocation[arm] = floor
+		} else if rest > 0 {
+			allocation[arm] -= raised * (allocation[arm] - floor) / rest
+		}
+	}
+	return allocation
+}
+
+// ProbabilityBest estimates each arm's chance of having the highest
+// click-through rate by sampling it from a Beta(clicks+1, misses+1)
+// posterior. The draws are seeded by the statistics, so replicas and
+// repeated updates over the same statistics agree.
+func ProbabilityBest(arms []string, stats map[string]ArmStats) map[string]float64 {
+	seed := int64(1)
+	for _, arm := range arms {
+		seed = seed*31 + stats[arm].Impressions*7 + stats[arm].Clicks
+	}
+	random := rand.New(rand.NewSource(seed))
+
+	wins := make(map[string]int, len(arms))
+	for i := 0; i < samples; i++ {
+		best, bestDraw := "", -1.0
+		for _, arm := range arms {
+			s := stats[arm]
+			misses := s.Impressions - s.Clicks
+			if misses < 0 {
+				misses = 0
+			}
+			if draw := betaSample(random, float64(s.Clicks)+1, float64(misses)+1); draw > bestDraw {
+				best, bestDraw = arm, draw
+			}
+		}
+		wins[best]++
+	}
+	chances := make(map[string]float64, len(arms))
+	for _, arm := range arms {
+		chances[arm] = float64(wins[arm]) / samples
+	}
+	return chances
+}
+
+// betaSample draws from Beta(a, b) as the ratio of two gamma draws
+func betaSample(random *rand.Rand, a, b float64) float64 {
+	x := gammaSample(random, a)
+	y := gammaSample(random, b)
+	return x / (x + y)
+}
+
+// gammaSample draws from Gamma(shape, 1) by Marsaglia and Tsang's method,
+// for shapes of at least one
+func gammaSample(random *rand.Rand, shape float64) float64 {
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := random.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := random.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// Reset clears the statistics and reinstates every arm with an even split,
+// as after the profiles were changed
+func (c *Controller) Reset(ctx context.Context, reason string) (Decision, error) {
+	if err := c.store.Clear(ctx); err != nil {
+		return Decision{}, err
+	}
+	state := State{Allocation: even(c.config.Arms), UpdatedAt: time.Now().UTC()}
+	if err := c.store.SaveState(ctx, state); err != nil {
+		return Decision{}, err
+	}
+	c.set(state)
+	decision := Decision{At: state.UpdatedAt, Kind: KindReset, Reason: reason, Allocation: state.Allocation, Stats: map[string]ArmStats{}}
+	c.record(ctx, decision)
+	return decision, nil
+}
+
+// Refresh adopts the state saved by the replica updating it
+func (c *Controller) Refresh(ctx context.Context) error {
+	state, ok, err := c.store.LoadState(ctx)
+	if err != nil || !ok {
+		return err
+	}
+	c.set(state)
+	return nil
+}
+
+// Start updates the split every interval until ctx is cancelled. Replicas
+// share a lock so only one of them updates and audits each cycle; the
+// others adopt its state.
+func (c *Controller) Start(ctx context.Context, interval time.Duration) {
+	if err := c.Refresh(ctx); err != nil {
+		log.Printf("Warning: failed to load ranking bandit state: %v", err)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.sync(ctx, interval)
+			}
+		}
+	}()
+}
+
+func (c *Controller) sync(ctx context.Context, interval time.Duration) {
+	leader, err := c.store.Lock(ctx, interval/2)
+	if err != nil {
+		log.Printf("Warning: ranking bandit lock failed: %v", err)
+		return
+	}
+	if !leader {
+		if err := c.Refresh(ctx); err != nil {
+			log.Printf("Warning: failed to load ranking bandit state: %v", err)
+		}
+		return
+	}
+	if _, err := c.Update(ctx); err != nil {
+		log.Printf("Warning: ranking bandit update failed: %v", err)
+	}
+}
+
+func (c *Controller) record(ctx context.Context, decision Decision) {
+	log.Printf("Ranking bandit %s %s: %s allocation=%v", decision.Kind, decision.Arm, decision.Reason, decision.Allocation)
+	if c.audit == nil {
+		return
+	}
+	if err := c.audit.Record(ctx, decision); err != nil {
+		log.Printf("Warning: failed to audit ranking bandit decision: %v", err)
+	}
+}
+
+// Decisions lists the latest audited decisions, newest first
+func (c *Controller) Decisions(ctx context.Context, limit int) ([]Decision, error) {
+	if c.audit == nil {
+		return []Decision{}, nil
+	}
+	return c.audit.List(ctx, limit)
+}
+
+func even(arms []string) map[string]float64 {
+	allocation := make(map[string]float64, len(arms))
+	for _, arm := range arms {
+		allocation[arm] = 1 / float64(len(arms))
+	}
+	return allocation
+}
+
+// shifted reports whether any arm's share moved by at least minShift
+func shifted(before, after map[string]float64) bool {
+	for arm, share := range after {
+		if math.Abs(share-before[arm]) >= minShift {
+			return true
+		}
+	}
+	return false
+}
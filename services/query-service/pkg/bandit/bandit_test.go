@@ -0,0 +1,285 @@
+package bandit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps the statistics and state in memory
+type memoryStore struct {
+	mu     sync.Mutex
+	stats  map[string]ArmStats
+	state  *State
+	locked bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{stats: map[string]ArmStats{}}
+}
+
+func (s *memoryStore) Add(ctx context.Context, arm string, impressions, clicks int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats[arm]
+	stats.Impressions += impressions
+	stats.Clicks += clicks
+	s.stats[arm] = stats
+	return nil
+}
+
+func (s *memoryStore) Stats(ctx context.Context) (map[string]ArmStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := map[string]ArmStats{}
+	for arm, value := range s.stats {
+		stats[arm] = value
+	}
+	return stats, nil
+}
+
+func (s *memoryStore) Clear(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = map[string]ArmStats{}
+	s.state = nil
+	return nil
+}
+
+func (s *memoryStore) SaveState(ctx context.Context, state State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = &state
+	return nil
+}
+
+func (s *memoryStore) LoadState(ctx context.Context) (State, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil {
+		return State{}, false, nil
+	}
+	return *s.state, true, nil
+}
+
+func (s *memoryStore) Lock(ctx context.Context, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked {
+		return false, nil
+	}
+	s.locked = true
+	return true, nil
+}
+
+// memoryAudit keeps the decisions in memory, newest last
+type memoryAudit struct {
+	mu        sync.Mutex
+	decisions []Decision
+}
+
+func (a *memoryAudit) Record(ctx context.Context, decision Decision) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.decisions = append(a.decisions, decision)
+	return nil
+}
+
+func (a *memoryAudit) List(ctx context.Context, limit int) ([]Decision, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	decisions := []Decision{}
+	for i := len(a.decisions) - 1; i >= 0 && len(decisions) < limit; i-- {
+		decisions = append(decisions, a.decisions[i])
+	}
+	return decisions, nil
+}
+
+func newController(t *testing.T) (*Controller, *memoryStore, *memoryAudit) {
+	store, audit := newMemoryStore(), &memoryAudit{}
+	controller, err := New(Config{
+		Arms:           []string{"default", "recent", "popular"},
+		MinShare:       0.05,
+		MinImpressions: 100,
+		MaxDegradation: 0.2,
+	}, store, audit)
+	require.NoError(t, err)
+	return controller, store, audit
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	_, err := New(Config{Arms: []string{"default"}, MaxDegradation: 0.2}, nil, nil)
+	assert.Error(t, err)
+	_, err = New(Config{Arms: []string{"default", "default"}, MaxDegradation: 0.2}, nil, nil)
+	assert.Error(t, err)
+	_, err = New(Config{Arms: []string{"default", "recent"}, Control: "popular", MaxDegradation: 0.2}, nil, nil)
+	assert.Error(t, err)
+	_, err = New(Config{Arms: []string{"default", "recent"}, MinShare: 0.6, MaxDegradation: 0.2}, nil, nil)
+	assert.Error(t, err)
+	_, err = New(Config{Arms: []string{"default", "recent"}}, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestChooseIsStickyAndFollowsAllocation(t *testing.T) {
+	controller, _, _ := newController(t)
+	assert.Equal(t, "default", controller.config.Control)
+	assert.Equal(t, controller.Choose("user-1"), controller.Choose("user-1"))
+
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		counts[controller.Choose(fmt.Sprintf("user-%d", i))]++
+	}
+	for _, arm := range controller.Arms() {
+		assert.InDelta(t, 1000, counts[arm], 150, arm)
+	}
+
+	controller.set(State{Allocation: map[string]float64{"default": 1, "popular": 0, "recent": 0}})
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "default", controller.Choose(fmt.Sprintf("user-%d", i)))
+	}
+}
+
+func TestUpdateExploresEvenlyFirst(t *testing.T) {
+	controller, store, audit := newController(t)
+	store.Add(context.Background(), "default", 500, 50)
+	store.Add(context.Background(), "recent", 50, 40)
+
+	decisions, err := controller.Update(context.Background())
+	require.NoError(t, err)
+	// The split does not change, so nothing is audited
+	assert.Empty(t, decisions)
+	assert.Empty(t, audit.decisions)
+	assert.InDelta(t, 1.0/3, controller.current().Allocation["recent"], 1e-9)
+}
+
+func TestUpdateShiftsTrafficToBestArm(t *testing.T) {
+	controller, store, audit := newController(t)
+	ctx := context.Background()
+	store.Add(ctx, "default", 1000, 50)
+	store.Add(ctx, "recent", 1000, 90)
+	store.Add(ctx, "popular", 1000, 48)
+
+	decisions, err := controller.Update(ctx)
+	require.NoError(t, err)
+	require.Len(t, decisions, 1)
+	assert.Equal(t, KindAllocate, decisions[0].Kind)
+	assert.Equal(t, int64(90), decisions[0].Stats["recent"].Clicks)
+	allocation := controller.current().Allocation
+	assert.Greater(t, allocation["recent"], 0.8)
+	// Every arm keeps exploring with the minimum share
+	assert.InDelta(t, 0.05, allocation["popular"], 1e-9)
+	assert.InDelta(t, 1, allocation["default"]+allocation["recent"]+allocation["popular"], 1e-9)
+	assert.Len(t, audit.decisions, 1)
+
+	// The same statistics give the same split
+	decisions, err = controller.Update(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, decisions)
+
+	state, ok, err := store.LoadState(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, allocation, state.Allocation)
+}
+
+func TestUpdateRollsBackDegradedArm(t *testing.T) {
+	controller, store, audit := newController(t)
+	ctx := context.Background()
+	store.Add(ctx, "default", 1000, 100)
+	store.Add(ctx, "recent", 1000, 95)
+	store.Add(ctx, "popular", 1000, 70)
+
+	decisions, err := controller.Update(ctx)
+	require.NoError(t, err)
+	require.Len(t, decisions, 2)
+	assert.Equal(t, KindRollback, decisions[0].Kind)
+	assert.Equal(t, "popular", decisions[0].Arm)
+	assert.Contains(t, decisions[0].Reason, "20% below the control's 0.1000")
+	assert.Equal(t, KindAllocate, decisions[1].Kind)
+	assert.Equal(t, 0.0, controller.current().Allocation["popular"])
+	assert.Equal(t, []string{"popular"}, controller.current().RolledBack)
+
+	for i := 0; i < 200; i++ {
+		assert.NotEqual(t, "popular", controller.Choose(fmt.Sprintf("user-%d", i)))
+	}
+
+	// A rolled back arm stays out even if it recovers
+	store.Add(ctx, "popular", 0, 100)
+	_, err = controller.Update(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, controller.current().Allocation["popular"])
+
+	listed, err := controller.Decisions(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, len(audit.decisions), len(listed))
+	assert.Equal(t, KindRollback, listed[len(listed)-1].Kind)
+}
+
+func TestControlIsNeverRolledBack(t *testing.T) {
+	controller, store, _ := newController(t)
+	ctx := context.Background()
+	store.Add(ctx, "default", 1000, 10)
+	store.Add(ctx, "recent", 1000, 100)
+	store.Add(ctx, "popular", 1000, 100)
+
+	decisions, err := controller.Update(ctx)
+	require.NoError(t, err)
+	for _, decision := range decisions {
+		assert.NotEqual(t, KindRollback, decision.Kind)
+	}
+	assert.InDelta(t, 0.05, controller.current().Allocation["default"], 1e-9)
+}
+
+func TestReset(t *testing.T) {
+	controller, store, audit := newController(t)
+	ctx := context.Background()
+	store.Add(ctx, "default", 1000, 100)
+	store.Add(ctx, "popular", 1000, 10)
+	store.Add(ctx, "recent", 1000, 100)
+	_, err := controller.Update(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, controller.current().RolledBack)
+
+	decision, err := controller.Reset(ctx, "profiles changed")
+	require.NoError(t, err)
+	assert.Equal(t, KindReset, decision.Kind)
+	assert.Empty(t, controller.current().RolledBack)
+	assert.InDelta(t, 1.0/3, controller.current().Allocation["popular"], 1e-9)
+	stats, _ := store.Stats(ctx)
+	assert.Empty(t, stats)
+	assert.Equal(t, KindReset, audit.decisions[len(audit.decisions)-1].Kind)
+}
+
+func TestReplicasShareState(t *testing.T) {
+	leader, store, _ := newController(t)
+	follower, err := New(leader.config, store, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	store.Add(ctx, "default", 1000, 50)
+	store.Add(ctx, "recent", 1000, 90)
+	store.Add(ctx, "popular", 1000, 48)
+
+	leader.sync(ctx, time.Minute)
+	follower.sync(ctx, time.Minute)
+	assert.Equal(t, leader.current(), follower.current())
+}
+
+func TestProbabilityBest(t *testing.T) {
+	chances := ProbabilityBest([]string{"a", "b"}, map[string]ArmStats{
+		"a": {Impressions: 100, Clicks: 10},
+		"b": {Impressions: 100, Clicks: 10},
+	})
+	assert.InDelta(t, 0.5, chances["a"], 0.05)
+	assert.InDelta(t, 1, chances["a"]+chances["b"], 1e-9)
+
+	chances = ProbabilityBest([]string{"a", "b"}, map[string]ArmStats{
+		"a": {Impressions: 10000, Clicks: 500},
+		"b": {Impressions: 10000, Clicks: 700},
+	})
+	assert.Greater(t, chances["b"], 0.99)
+}
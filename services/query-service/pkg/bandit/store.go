@@ -0,0 +1,178 @@
+package bandit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// statsKey holds the impressions and clicks of every arm in Redis
+	statsKey = "ranking:bandit:stats"
+	// stateKey holds the split decided by the replica updating it
+	stateKey = "ranking:bandit:state"
+	// lockKey makes sure only one replica updates the split at a time
+	lockKey = "ranking:bandit:lock"
+)
+
+// RedisStore shares the statistics and split of a controller between
+// replicas in Redis
+type RedisStore struct {
+	client   *redis.Client
+	instance string
+}
+
+// NewRedisStore creates a store on client
+func NewRedisStore(client *redis.Client) *RedisStore {
+	instance, _ := os.Hostname()
+	return &RedisStore{client: client, instance: instance}
+}
+
+// Add counts impressions and clicks of an arm
+func (s *RedisStore) Add(ctx context.Context, arm string, impressions, clicks int64) error {
+	pipe := s.client.TxPipeline()
+	if impressions != 0 {
+		pipe.HIncrBy(ctx, statsKey, arm+":impressions", impressions)
+	}
+	if clicks != 0 {
+		pipe.HIncrBy(ctx, statsKey, arm+":clicks", clicks)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Stats returns the impressions and clicks of every arm served so far
+func (s *RedisStore) Stats(ctx context.Context) (map[string]ArmStats, error) {
+	values, err := s.client.HGetAll(ctx, statsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ranking bandit statistics: %v", err)
+	}
+	stats := map[string]ArmStats{}
+	for field, value := range values {
+		i := strings.LastIndex(field, ":")
+		if i < 0 {
+			continue
+		}
+		n, _ := strconv.ParseInt(value, 10, 64)
+		arm := stats[field[:i]]
+		switch field[i+1:] {
+		case "impressions":
+			arm.Impressions = n
+		case "clicks":
+			arm.Clicks = n
+		}
+		stats[field[:i]] = arm
+	}
+	return stats, nil
+}
+
+// Clear removes the statistics and the split
+func (s *RedisStore) Clear(ctx context.Context) error {
+	return s.client.Del(ctx, statsKey, stateKey).Err()
+}
+
+// SaveState stores the split for the other replicas
+func (s *RedisStore) SaveState(ctx context.Context, state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, stateKey, data, 0).Err()
+}
+
+// LoadState returns the split saved last, if any
+func (s *RedisStore) LoadState(ctx context.Context) (State, bool, error) {
+	data, err := s.client.Get(ctx, stateKey).Bytes()
+	if err == redis.Nil {
+		return State{}, false, nil
+	}
+	if err != nil {
+		return State{}, false, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, false, fmt.Errorf("failed to decode ranking bandit state: %v", err)
+	}
+	return state, true, nil
+}
+
+// Lock reports whether this replica holds the update lock for ttl
+func (s *RedisStore) Lock(ctx context.Context, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, lockKey, s.instance, ttl).Result()
+}
+
+// PostgresAudit keeps the decisions of a controller in PostgreSQL
+type PostgresAudit struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresAudit creates an audit log on pool
+func NewPostgresAudit(pool *pgxpool.Pool) *PostgresAudit {
+	return &PostgresAudit{pool: pool}
+}
+
+// EnsureSchema creates the decision table if it does not exist
+func (a *PostgresAudit) EnsureSchema(ctx context.Context) error {
+	_, err := a.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS ranking_bandit_decisions (
+			id BIGSERIAL PRIMARY KEY,
+			decided_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			kind VARCHAR(16) NOT NULL,
+			arm TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			decision JSONB NOT NULL
+		)
+	`)
+	return err
+}
+
+// Record stores a decision
+func (a *PostgresAudit) Record(ctx context.Context, decision Decision) error {
+	data, err := json.Marshal(decision)
+	if err != nil {
+		return err
+	}
+	_, err = a.pool.Exec(ctx, `
+		INSERT INTO ranking_bandit_decisions (decided_at, kind, arm, reason, decision)
+		VALUES ($1, $2, $3, $4, $5)
+	`, decision.At, decision.Kind, decision.Arm, decision.Reason, data)
+	if err != nil {
+		return fmt.Errorf("failed to record ranking bandit decision: %v", err)
+	}
+	return nil
+}
+
+// List returns the latest decisions, newest first
+func (a *PostgresAudit) List(ctx context.Context, limit int) ([]Decision, error) {
+	rows, err := a.pool.Query(ctx, `
+		SELECT decision
+		FROM ranking_bandit_decisions
+		ORDER BY decided_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ranking bandit decisions: %v", err)
+	}
+	defer rows.Close()
+
+	decisions := []Decision{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var decision Decision
+		if err := json.Unmarshal(data, &decision); err != nil {
+			return nil, fmt.Errorf("failed to decode ranking bandit decision: %v", err)
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, rows.Err()
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdMagic starts every zstd frame; JSON payloads never begin with it, so
+// entries written before compression was enabled still decode as plain data
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// CompressionStats reports how much cache payload compression saves
+type CompressionStats struct {
+	Compressed   uint64  `json:"compressed"`
+	Uncompressed uint64  `json:"uncompressed"`
+	BytesIn      uint64  `json:"bytes_in"`
+	BytesOut     uint64  `json:"bytes_out"`
+	Ratio        float64 `json:"ratio"`
+}
+
+// Codec compresses cache payloads at or above a size threshold with zstd
+type Codec struct {
+	threshold int
+	encoder   *zstd.Encoder
+	decoder   *zstd.Decoder
+
+	compressed   uint64
+	uncompressed uint64
+	bytesIn      uint64
+	bytesOut     uint64
+}
+
+// NewCodec creates a codec; payloads smaller than threshold bytes are stored as-is
+func NewCodec(threshold int) (*Codec, error) {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %v", err)
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %v", err)
+	}
+	return &Codec{threshold: threshold, encoder: encoder, decoder: decoder}, nil
+}
+
+// Encode returns the payload to store in Redis
+func (c *Codec) Encode(data []byte) []byte {
+	if len(data) < c.threshold {
+		atomic.AddUint64(&c.uncompressed, 1)
+		return data
+	}
+
+	encoded := c.encoder.EncodeAll(data, make([]byte, 0, len(data)/4))
+	atomic.AddUint64(&c.compressed, 1)
+	atomic.AddUint64(&c.bytesIn, uint64(len(data)))
+	atomic.AddUint64(&c.bytesOut, uint64(len(encoded)))
+	return encoded
+}
+
+// Decode returns the original payload, decompressing it if it is a zstd frame
+func (c *Codec) Decode(payload []byte) ([]byte, error) {
+	if !bytes.HasPrefix(payload, zstdMagic) {
+		return payload, nil
+	}
+	data, err := c.decoder.DecodeAll(payload, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress cache payload: %v", err)
+	}
+	return data, nil
+}
+
+// Stats returns compression counters; Ratio is original size over stored size
+func (c *Codec) Stats() CompressionStats {
+	stats := CompressionStats{
+		Compressed:   atomic.LoadUint64(&c.compressed),
+		Uncompressed: atomic.LoadUint64(&c.uncompressed),
+		BytesIn:      atomic.LoadUint64(&c.bytesIn),
+		BytesOut:     atomic.LoadUint64(&c.bytesOut),
+	}
+	if stats.BytesOut > 0 {
+		stats.Ratio = float64(stats.BytesIn) / float64(stats.BytesOut)
+	}
+	return stats
+}
@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	codec, err := NewCodec(64)
+	require.NoError(t, err)
+
+	large := bytes.Repeat([]byte(`{"id":"asset","score":0.9},`), 100)
+	encoded := codec.Encode(large)
+	assert.Less(t, len(encoded), len(large))
+
+	decoded, err := codec.Decode(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, large, decoded)
+
+	stats := codec.Stats()
+	assert.Equal(t, uint64(1), stats.Compressed)
+	assert.Greater(t, stats.Ratio, 1.0)
+}
+
+func TestCodecKeepsSmallAndLegacyPayloads(t *testing.T) {
+	codec, err := NewCodec(64)
+	require.NoError(t, err)
+
+	small := []byte(`{"results":[]}`)
+	assert.Equal(t, small, codec.Encode(small))
+
+	decoded, err := codec.Decode(small)
+	require.NoError(t, err)
+	assert.Equal(t, small, decoded)
+	assert.Equal(t, uint64(1), codec.Stats().Uncompressed)
+}
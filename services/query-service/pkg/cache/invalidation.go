@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Asset change types announced on the invalidation channel
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// AnyCollection tags entries of searches not restricted to collections,
+// which a new asset in any collection can change
+const AnyCollection = "*"
+
+// tagPrefix namespaces the Redis sets listing the cache keys per tag
+const tagPrefix = "cachetag:"
+
+// AssetChange announces that an asset was created, updated or deleted
+type AssetChange struct {
+	Type         string `json:"type" binding:"required"`
+	AssetID      string `json:"asset_id" binding:"required"`
+	CollectionID string `json:"collection_id,omitempty"`
+	// TenantID routes the change to the tenant's webhooks; it does not
+	// change what is purged
+	TenantID string `json:"tenant_id,omitempty"`
+}
+
+// Validate checks the change type
+func (c AssetChange) Validate() error {
+	switch c.Type {
+	case ChangeCreated, ChangeUpdated, ChangeDeleted:
+		return nil
+	}
+	return fmt.Errorf("change type must be %s, %s or %s", ChangeCreated, ChangeUpdated, ChangeDeleted)
+}
+
+// CollectionTag tags entries of searches over a collection
+func CollectionTag(collectionID string) string {
+	return "collection:" + collectionID
+}
+
+// AssetTag tags entries whose results include an asset
+func AssetTag(assetID string) string {
+	return "asset:" + assetID
+}
+
+// Tags returns the tags of the entries a change can make stale. A new asset
+// can enter the results of any search over its collection; a deleted one
+// only affects the searches that returned it; an update can do both.
+func (c AssetChange) Tags() []string {
+	var tags []string
+	if c.Type != ChangeDeleted {
+		tags = append(tags, CollectionTag(AnyCollection))
+		if c.CollectionID != "" {
+			tags = append(tags, CollectionTag(c.CollectionID))
+		}
+	}
+	if c.Type != ChangeCreated {
+		tags = append(tags, AssetTag(c.AssetID))
+	}
+	return tags
+}
+
+// Invalidator records which cache keys depend on which assets and
+// collections, and purges them when asset changes are announced
+type Invalidator struct {
+	client  *redis.Client
+	channel string
+	tagTTL  time.Duration
+}
+
+// NewInvalidator creates an invalidator. Tag sets expire after tagTTL, which
+// should be at least the longest cache TTL.
+func NewInvalidator(client *redis.Client, channel string, tagTTL time.Duration) *Invalidator {
+	return &Invalidator{client: client, channel: channel, tagTTL: tagTTL}
+}
+
+// Tag records that the cache key depends on the tags
+func (i *Invalidator) Tag(ctx context.Context, key string, tags []string) error {
+	pipe := i.client.Pipeline()
+	for _, tag := range tags {
+		pipe.SAdd(ctx, tagPrefix+tag, key)
+		pipe.Expire(ctx, tagPrefix+tag, i.tagTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Publish announces a change to every replica
+func (i *Invalidator) Publish(ctx context.Context, change AssetChange) error {
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return i.client.Publish(ctx, i.channel, payload).Err()
+}
+
+// Invalidate deletes the cache entries a change can make stale and returns
+// how many were deleted
+func (i *Invalidator) Invalidate(ctx context.Context, change AssetChange) (int64, error) {
+	var deleted int64
+	for _, tag := range change.Tags() {
+		setKey := tagPrefix + tag
+		keys, err := i.client.SMembers(ctx, setKey).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to read cache tag %s: %v", tag, err)
+		}
+
+		// The tag set is dropped first so keys tagged meanwhile start a new set
+		if err := i.client.Del(ctx, setKey).Err(); err != nil {
+			return deleted, fmt.Errorf("failed to drop cache tag %s: %v", tag, err)
+		}
+		for start := 0; start < len(keys); start += 500 {
+			end := start + 500
+			if end > len(keys) {
+				end = len(keys)
+			}
+			n, err := i.client.Del(ctx, keys[start:end]...).Result()
+			if err != nil {
+				return deleted, fmt.Errorf("failed to purge cache entries for %s: %v", tag, err)
+			}
+			deleted += n
+		}
+	}
+	return deleted, nil
+}
+
+// Listen invalidates the entries of every announced change until ctx is cancelled
+func (i *Invalidator) Listen(ctx context.Context) {
+	pubsub := i.client.Subscribe(ctx, i.channel)
+
+	go func() {
+		defer pubsub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-pubsub.Channel():
+				if !ok {
+					return
+				}
+				var change AssetChange
+				if err := json.Unmarshal([]byte(msg.Payload), &change); err != nil || change.Validate() != nil || change.AssetID == "" {
+					log.Printf("Warning: ignoring malformed asset change %q", msg.Payload)
+					continue
+				}
+				if _, err := i.Invalidate(ctx, change); err != nil {
+					log.Printf("Warning: cache invalidation for asset %s failed: %v", change.AssetID, err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,23 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssetChangeTags(t *testing.T) {
+	created := AssetChange{Type: ChangeCreated, AssetID: "a1", CollectionID: "c1"}
+	assert.Equal(t, []string{"collection:*", "collection:c1"}, created.Tags())
+
+	updated := AssetChange{Type: ChangeUpdated, AssetID: "a1"}
+	assert.Equal(t, []string{"collection:*", "asset:a1"}, updated.Tags())
+
+	deleted := AssetChange{Type: ChangeDeleted, AssetID: "a1", CollectionID: "c1"}
+	assert.Equal(t, []string{"asset:a1"}, deleted.Tags())
+}
+
+func TestAssetChangeValidate(t *testing.T) {
+	assert.NoError(t, AssetChange{Type: ChangeDeleted, AssetID: "a1"}.Validate())
+	assert.Error(t, AssetChange{Type: "moved", AssetID: "a1"}.Validate())
+}
@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Key hashes a normalized request into a compact cache key of the form
+// namespace:version:sha256. Bumping version orphans every entry written
+// with an older request schema. value is encoded as JSON, so struct fields
+// keep their order and map keys are sorted; values JSON cannot encode fall
+// back to their Go syntax, which may miss but never collides.
+func Key(namespace, version string, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%#v", value))
+	}
+	sum := sha256.Sum256(data)
+	return namespace + ":" + version + ":" + hex.EncodeToString(sum[:])
+}
+
+// NormalizeText lower-cases text and collapses runs of whitespace
+func NormalizeText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
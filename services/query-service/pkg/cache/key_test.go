@@ -0,0 +1,22 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyIsCompactAndStable(t *testing.T) {
+	a := Key("search", "v1", map[string]interface{}{"query": "cats", "filters": map[string]string{"b": "2", "a": "1"}})
+	b := Key("search", "v1", map[string]interface{}{"filters": map[string]string{"a": "1", "b": "2"}, "query": "cats"})
+
+	assert.Equal(t, a, b)
+	assert.Len(t, a, len("search:v1:")+64)
+
+	assert.NotEqual(t, a, Key("search", "v2", map[string]interface{}{"query": "cats", "filters": map[string]string{"a": "1", "b": "2"}}))
+	assert.NotEqual(t, a, Key("search", "v1", map[string]interface{}{"query": "cats"}))
+}
+
+func TestNormalizeText(t *testing.T) {
+	assert.Equal(t, "red truck", NormalizeText("  Red \t TRUCK\n"))
+}
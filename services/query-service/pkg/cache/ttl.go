@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TTLPolicy derives a cache TTL from how often a key has been requested
+// within the counting window. Hot keys get short TTLs so they are refreshed
+// often, long-tail keys are kept longer because recomputing them rarely pays off.
+type TTLPolicy struct {
+	MinTTL   time.Duration
+	MaxTTL   time.Duration
+	HotHits  int64
+	ColdHits int64
+	Window   time.Duration
+}
+
+// DefaultTTLPolicy returns the policy used when no overrides are configured
+func DefaultTTLPolicy() TTLPolicy {
+	return TTLPolicy{
+		MinTTL:   1 * time.Minute,
+		MaxTTL:   30 * time.Minute,
+		HotHits:  50,
+		ColdHits: 2,
+		Window:   1 * time.Hour,
+	}
+}
+
+// TTL returns the TTL for a key that has been requested hits times
+func (p TTLPolicy) TTL(hits int64) time.Duration {
+	if hits >= p.HotHits {
+		return p.MinTTL
+	}
+	if hits <= p.ColdHits || p.HotHits <= p.ColdHits {
+		return p.MaxTTL
+	}
+
+	// Linear interpolation between the cold and hot thresholds
+	ratio := float64(hits-p.ColdHits) / float64(p.HotHits-p.ColdHits)
+	span := float64(p.MaxTTL - p.MinTTL)
+	return p.MaxTTL - time.Duration(ratio*span)
+}
+
+// HitCounter tracks per-key request counts in Redis
+type HitCounter struct {
+	client *redis.Client
+	policy TTLPolicy
+}
+
+// NewHitCounter creates a new hit counter
+func NewHitCounter(client *redis.Client, policy TTLPolicy) *HitCounter {
+	return &HitCounter{client: client, policy: policy}
+}
+
+// Policy returns the TTL policy of the counter
+func (h *HitCounter) Policy() TTLPolicy {
+	return h.policy
+}
+
+// Record increments the counter for key and returns the count within the window
+func (h *HitCounter) Record(ctx context.Context, key string) (int64, error) {
+	counterKey := "hits:" + key
+
+	pipe := h.client.TxPipeline()
+	incr := pipe.Incr(ctx, counterKey)
+	pipe.ExpireNX(ctx, counterKey, h.policy.Window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+// TTLFor records a request for key and returns the TTL the entry should be stored with
+func (h *HitCounter) TTLFor(ctx context.Context, key string) time.Duration {
+	hits, err := h.Record(ctx, key)
+	if err != nil {
+		return h.policy.TTL(0)
+	}
+	return h.policy.TTL(hits)
+}
@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTLPolicy(t *testing.T) {
+	policy := TTLPolicy{
+		MinTTL:   1 * time.Minute,
+		MaxTTL:   11 * time.Minute,
+		HotHits:  12,
+		ColdHits: 2,
+	}
+
+	assert.Equal(t, 11*time.Minute, policy.TTL(0))
+	assert.Equal(t, 11*time.Minute, policy.TTL(2))
+	assert.Equal(t, 6*time.Minute, policy.TTL(7))
+	assert.Equal(t, 1*time.Minute, policy.TTL(12))
+	assert.Equal(t, 1*time.Minute, policy.TTL(1000))
+}
+
+func TestTTLPolicyDegenerateThresholds(t *testing.T) {
+	policy := TTLPolicy{MinTTL: time.Minute, MaxTTL: time.Hour, HotHits: 5, ColdHits: 5}
+
+	assert.Equal(t, time.Minute, policy.TTL(5))
+	assert.Equal(t, time.Hour, policy.TTL(4))
+}
@@ -0,0 +1,327 @@
+package calibration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// updatesChannel carries the analyzers whose mapping changed on any replica
+const updatesChannel = "calibration:mappings:updated"
+
+// Point pins a raw analyzer confidence to its calibrated value
+type Point struct {
+	Raw        float64 `json:"raw"`
+	Calibrated float64 `json:"calibrated"`
+}
+
+// Mapping calibrates the confidences one analyzer reports. Scores between
+// points are interpolated linearly; (0,0) and (1,1) are implied unless the
+// points say otherwise.
+type Mapping struct {
+	// Analyzer is the feature type the analyzer writes, e.g. face or object
+	Analyzer  string    `json:"analyzer"`
+	Points    []Point   `json:"points"`
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate checks that the points describe a monotonic curve within [0,1]
+func (m Mapping) Validate() error {
+	if m.Analyzer == "" {
+		return fmt.Errorf("analyzer is required")
+	}
+	if len(m.Points) == 0 {
+		return fmt.Errorf("at least one point is required")
+	}
+	for i, point := range m.Points {
+		for _, value := range []float64{point.Raw, point.Calibrated} {
+			if math.IsNaN(value) || value < 0 || value > 1 {
+				return fmt.Errorf("point %d must lie within [0,1]", i)
+			}
+		}
+		if i == 0 {
+			continue
+		}
+		if point.Raw <= m.Points[i-1].Raw {
+			return fmt.Errorf("raw confidences must be strictly increasing")
+		}
+		if point.Calibrated < m.Points[i-1].Calibrated {
+			return fmt.Errorf("calibrated confidences must not decrease")
+		}
+	}
+	return nil
+}
+
+// curve returns the points with the implied end points added
+func (m Mapping) curve() []Point {
+	curve := make([]Point, 0, len(m.Points)+2)
+	if m.Points[0].Raw > 0 {
+		curve = append(curve, Point{Raw: 0, Calibrated: 0})
+	}
+	curve = append(curve, m.Points...)
+	if m.Points[len(m.Points)-1].Raw < 1 {
+		curve = append(curve, Point{Raw: 1, Calibrated: 1})
+	}
+	return curve
+}
+
+// Apply calibrates a raw confidence
+func (m Mapping) Apply(raw float64) float64 {
+	if len(m.Points) == 0 {
+		return raw
+	}
+	raw = math.Max(0, math.Min(1, raw))
+	curve := m.curve()
+	for i := 1; i < len(curve); i++ {
+		lo, hi := curve[i-1], curve[i]
+		if raw <= hi.Raw {
+			return lo.Calibrated + (hi.Calibrated-lo.Calibrated)*(raw-lo.Raw)/(hi.Raw-lo.Raw)
+		}
+	}
+	return curve[len(curve)-1].Calibrated
+}
+
+// Table is every mapping flattened into line pieces, one row per pair of
+// neighbouring points, so the calibration can be evaluated inside SQL
+type Table struct {
+	Analyzers      []string
+	LowRaw         []float64
+	LowCalibrated  []float64
+	HighRaw        []float64
+	HighCalibrated []float64
+	// Fingerprint changes whenever any mapping does, for cache keys
+	Fingerprint string
+}
+
+// Registry holds the active mappings, persisted in PostgreSQL and kept in
+// sync across replicas through Redis
+type Registry struct {
+	pool  *pgxpool.Pool
+	redis *redis.Client
+
+	mu       sync.RWMutex
+	mappings map[string]Mapping
+}
+
+// NewRegistry creates an empty registry; analyzers without a mapping keep
+// their raw confidences
+func NewRegistry(pool *pgxpool.Pool, redisClient *redis.Client) *Registry {
+	return &Registry{pool: pool, redis: redisClient, mappings: map[string]Mapping{}}
+}
+
+// EnsureSchema creates the mapping table if it does not exist
+func (r *Registry) EnsureSchema(ctx context.Context) error {
+	_, err := r.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS confidence_calibrations (
+			analyzer VARCHAR(100) PRIMARY KEY,
+			mapping JSONB NOT NULL,
+			version INTEGER NOT NULL DEFAULT 1,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+// LoadAll replaces the in-memory mappings with the persisted ones
+func (r *Registry) LoadAll(ctx context.Context) error {
+	rows, err := r.pool.Query(ctx, `SELECT mapping, version, updated_at FROM confidence_calibrations`)
+	if err != nil {
+		return fmt.Errorf("failed to load calibrations: %v", err)
+	}
+	defer rows.Close()
+
+	loaded := map[string]Mapping{}
+	for rows.Next() {
+		mapping, err := scanMapping(rows)
+		if err != nil {
+			return err
+		}
+		loaded[mapping.Analyzer] = mapping
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.mappings = loaded
+	r.mu.Unlock()
+	return nil
+}
+
+// Get returns the analyzer's mapping, if it has one
+func (r *Registry) Get(analyzer string) (Mapping, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	mapping, ok := r.mappings[analyzer]
+	return mapping, ok
+}
+
+// List returns every active mapping ordered by analyzer
+func (r *Registry) List() []Mapping {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	mappings := make([]Mapping, 0, len(r.mappings))
+	for _, mapping := range r.mappings {
+		mappings = append(mappings, mapping)
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].Analyzer < mappings[j].Analyzer })
+	return mappings
+}
+
+// Apply calibrates a raw confidence reported by the analyzer
+func (r *Registry) Apply(analyzer string, raw float64) float64 {
+	mapping, _ := r.Get(analyzer)
+	return mapping.Apply(raw)
+}
+
+// Table flattens the active mappings for use in SQL
+func (r *Registry) Table() Table {
+	var table Table
+	hash := fnv.New64a()
+	for _, mapping := range r.List() {
+		fmt.Fprintf(hash, "%s:%d;", mapping.Analyzer, mapping.Version)
+		curve := mapping.curve()
+		for i := 1; i < len(curve); i++ {
+			table.Analyzers = append(table.Analyzers, mapping.Analyzer)
+			table.LowRaw = append(table.LowRaw, curve[i-1].Raw)
+			table.LowCalibrated = append(table.LowCalibrated, curve[i-1].Calibrated)
+			table.HighRaw = append(table.HighRaw, curve[i].Raw)
+			table.HighCalibrated = append(table.HighCalibrated, curve[i].Calibrated)
+		}
+	}
+	if len(table.Analyzers) > 0 {
+		table.Fingerprint = fmt.Sprintf("%x", hash.Sum64())
+	}
+	return table
+}
+
+// Put persists a mapping, activates it locally and notifies the other replicas
+func (r *Registry) Put(ctx context.Context, mapping Mapping) (Mapping, error) {
+	if err := mapping.Validate(); err != nil {
+		return Mapping{}, err
+	}
+
+	data, err := json.Marshal(mapping)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("failed to encode mapping: %v", err)
+	}
+
+	err = r.pool.QueryRow(ctx, `
+		INSERT INTO confidence_calibrations (analyzer, mapping)
+		VALUES ($1, $2)
+		ON CONFLICT (analyzer) DO UPDATE
+		SET mapping = EXCLUDED.mapping,
+		    version = confidence_calibrations.version + 1,
+		    updated_at = NOW()
+		RETURNING version, updated_at
+	`, mapping.Analyzer, data).Scan(&mapping.Version, &mapping.UpdatedAt)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("failed to store mapping: %v", err)
+	}
+
+	r.mu.Lock()
+	r.mappings[mapping.Analyzer] = mapping
+	r.mu.Unlock()
+
+	r.broadcast(ctx, mapping.Analyzer)
+	return mapping, nil
+}
+
+// Delete removes an analyzer's mapping so its raw confidences apply again.
+// It reports whether there was a mapping to remove.
+func (r *Registry) Delete(ctx context.Context, analyzer string) (bool, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM confidence_calibrations WHERE analyzer = $1`, analyzer)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete mapping: %v", err)
+	}
+
+	r.mu.Lock()
+	delete(r.mappings, analyzer)
+	r.mu.Unlock()
+
+	r.broadcast(ctx, analyzer)
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *Registry) broadcast(ctx context.Context, analyzer string) {
+	if err := r.redis.Publish(ctx, updatesChannel, analyzer).Err(); err != nil {
+		log.Printf("Warning: failed to broadcast calibration of %s: %v", analyzer, err)
+	}
+}
+
+// Subscribe reloads mappings announced by other replicas until ctx is cancelled
+func (r *Registry) Subscribe(ctx context.Context) {
+	pubsub := r.redis.Subscribe(ctx, updatesChannel)
+
+	go func() {
+		defer pubsub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-pubsub.Channel():
+				if !ok {
+					return
+				}
+				if err := r.reload(ctx, msg.Payload); err != nil {
+					log.Printf("Warning: failed to reload calibration of %s: %v", msg.Payload, err)
+				}
+			}
+		}
+	}()
+}
+
+func (r *Registry) reload(ctx context.Context, analyzer string) error {
+	row := r.pool.QueryRow(ctx, `SELECT mapping, version, updated_at FROM confidence_calibrations WHERE analyzer = $1`, analyzer)
+	mapping, err := scanMapping(row)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		delete(r.mappings, analyzer)
+	case err != nil:
+		return err
+	default:
+		r.mappings[mapping.Analyzer] = mapping
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMapping(row scanner) (Mapping, error) {
+	var data []byte
+	var version int
+	var updatedAt time.Time
+	if err := row.Scan(&data, &version, &updatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Mapping{}, err
+		}
+		return Mapping{}, fmt.Errorf("failed to scan mapping: %v", err)
+	}
+
+	var mapping Mapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return Mapping{}, fmt.Errorf("failed to decode mapping: %v", err)
+	}
+	mapping.Version = version
+	mapping.UpdatedAt = updatedAt
+	return mapping, nil
+}
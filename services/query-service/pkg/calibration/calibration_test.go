@@ -0,0 +1,58 @@
+package calibration
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappingValidate(t *testing.T) {
+	valid := Mapping{Analyzer: "face", Points: []Point{{0.5, 0.2}, {0.9, 0.8}}}
+	assert.NoError(t, valid.Validate())
+
+	assert.Error(t, Mapping{Points: valid.Points}.Validate())
+	assert.Error(t, Mapping{Analyzer: "face"}.Validate())
+	assert.Error(t, Mapping{Analyzer: "face", Points: []Point{{0.5, 0.5}, {0.5, 0.6}}}.Validate())
+	assert.Error(t, Mapping{Analyzer: "face", Points: []Point{{0.4, 0.6}, {0.5, 0.5}}}.Validate())
+	assert.Error(t, Mapping{Analyzer: "face", Points: []Point{{1.2, 0.5}}}.Validate())
+	assert.Error(t, Mapping{Analyzer: "face", Points: []Point{{0.5, math.NaN()}}}.Validate())
+}
+
+func TestMappingApply(t *testing.T) {
+	mapping := Mapping{Analyzer: "face", Points: []Point{{0.5, 0.2}, {0.9, 0.8}}}
+
+	assert.InDelta(t, 0.0, mapping.Apply(0), 1e-9)
+	assert.InDelta(t, 0.1, mapping.Apply(0.25), 1e-9)
+	assert.InDelta(t, 0.2, mapping.Apply(0.5), 1e-9)
+	assert.InDelta(t, 0.5, mapping.Apply(0.7), 1e-9)
+	assert.InDelta(t, 0.9, mapping.Apply(0.95), 1e-9)
+	assert.InDelta(t, 1.0, mapping.Apply(1.5), 1e-9)
+
+	// Explicit end points replace the implied ones
+	flat := Mapping{Analyzer: "ocr", Points: []Point{{0, 0.3}, {1, 0.6}}}
+	assert.InDelta(t, 0.45, flat.Apply(0.5), 1e-9)
+
+	assert.Equal(t, 0.42, Mapping{}.Apply(0.42))
+}
+
+func TestRegistryTable(t *testing.T) {
+	registry := NewRegistry(nil, nil)
+	assert.Equal(t, Table{}, registry.Table())
+	assert.Equal(t, 0.7, registry.Apply("face", 0.7))
+
+	registry.mappings["face"] = Mapping{Analyzer: "face", Points: []Point{{0.5, 0.2}}, Version: 1}
+	registry.mappings["asr"] = Mapping{Analyzer: "asr", Points: []Point{{0, 0.1}, {1, 0.9}}, Version: 3}
+
+	table := registry.Table()
+	assert.Equal(t, []string{"asr", "face", "face"}, table.Analyzers)
+	assert.Equal(t, []float64{0, 0, 0.5}, table.LowRaw)
+	assert.Equal(t, []float64{0.1, 0, 0.2}, table.LowCalibrated)
+	assert.Equal(t, []float64{1, 0.5, 1}, table.HighRaw)
+	assert.Equal(t, []float64{0.9, 0.2, 1}, table.HighCalibrated)
+	assert.NotEmpty(t, table.Fingerprint)
+
+	registry.mappings["face"] = Mapping{Analyzer: "face", Points: []Point{{0.5, 0.3}}, Version: 2}
+	assert.NotEqual(t, table.Fingerprint, registry.Table().Fingerprint)
+	assert.InDelta(t, 0.3, registry.Apply("face", 0.5), 1e-9)
+}
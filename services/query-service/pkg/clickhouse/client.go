@@ -0,0 +1,197 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"dataflux/query-service/pkg/retry"
+)
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Client talks to ClickHouse over its HTTP interface
+type Client struct {
+	url        string
+	database   string
+	httpClient *http.Client
+
+	mu       sync.RWMutex
+	user     string
+	password string
+}
+
+// Error is returned when ClickHouse rejects a statement
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("clickhouse returned %d: %s", e.StatusCode, e.Message)
+}
+
+// NewClient creates a client; an empty url disables it
+func NewClient(url, user, password, database string) *Client {
+	return &Client{
+		url:        strings.TrimRight(url, "/"),
+		user:       user,
+		password:   password,
+		database:   database,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetCredentials replaces the user and password, as when they are rotated
+func (c *Client) SetCredentials(user, password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.user, c.password = user, password
+}
+
+// Enabled reports whether a ClickHouse URL is configured
+func (c *Client) Enabled() bool {
+	return c != nil && c.url != ""
+}
+
+// Database returns the configured database, empty for the server's default
+func (c *Client) Database() string {
+	return c.database
+}
+
+// Table returns the database-qualified name of a table, rejecting anything
+// that is not a plain identifier so it can be interpolated into statements
+func (c *Client) Table(name string) (string, error) {
+	if !identifierPattern.MatchString(name) {
+		return "", fmt.Errorf("invalid clickhouse table name %q", name)
+	}
+	if c.database == "" {
+		return name, nil
+	}
+	if !identifierPattern.MatchString(c.database) {
+		return "", fmt.Errorf("invalid clickhouse database name %q", c.database)
+	}
+	return c.database + "." + name, nil
+}
+
+// Exec runs a statement and returns the raw response body. Values in params
+// are bound to {name:Type} placeholders in the statement.
+func (c *Client) Exec(ctx context.Context, statement string, params map[string]string) ([]byte, error) {
+	query := url.Values{}
+	for name, value := range params {
+		query.Set("param_"+name, value)
+	}
+	return c.do(ctx, statement, query, false)
+}
+
+// Select runs a statement in the client's database with readonly=2, so
+// ClickHouse refuses anything that writes, and returns the raw response
+// body. Settings such as max_execution_time apply to the statement alone.
+// Being read-only, the statement is retried after transient failures.
+func (c *Client) Select(ctx context.Context, statement string, settings map[string]string) ([]byte, error) {
+	query := url.Values{}
+	for name, value := range settings {
+		query.Set(name, value)
+	}
+	query.Set("readonly", "2")
+	if c.database != "" {
+		query.Set("database", c.database)
+	}
+	return c.do(ctx, statement, query, true)
+}
+
+func (c *Client) do(ctx context.Context, statement string, query url.Values, idempotent bool) ([]byte, error) {
+	newRequest := func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/?"+query.Encode(), strings.NewReader(statement))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		c.mu.RLock()
+		if c.user != "" {
+			req.SetBasicAuth(c.user, c.password)
+		}
+		c.mu.RUnlock()
+		return req, nil
+	}
+
+	var resp *http.Response
+	var err error
+	if idempotent {
+		resp, err = retry.Default.Send(ctx, "clickhouse", c.httpClient, newRequest)
+	} else {
+		var req *http.Request
+		if req, err = newRequest(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = c.httpClient.Do(req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return body, nil
+}
+
+// Ping checks that ClickHouse accepts statements with the configured credentials
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Exec(ctx, "SELECT 1", nil)
+	return err
+}
+
+// Insert writes rows to a table in a single JSONEachRow INSERT; each row is
+// encoded as a JSON object whose keys are the column names
+func (c *Client) Insert(ctx context.Context, name string, rows ...interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	table, err := c.Table(name)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	body.WriteString("INSERT INTO " + table + " FORMAT JSONEachRow\n")
+	for _, row := range rows {
+		encoded, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("failed to encode row for %s: %v", table, err)
+		}
+		body.Write(encoded)
+		body.WriteByte('\n')
+	}
+	if _, err := c.Exec(ctx, body.String(), nil); err != nil {
+		return fmt.Errorf("failed to insert into %s: %v", table, err)
+	}
+	return nil
+}
+
+// IsUnknownTable reports whether err means the statement referenced a missing table
+func IsUnknownTable(err error) bool {
+	chErr, ok := err.(*Error)
+	return ok && strings.Contains(chErr.Message, "UNKNOWN_TABLE")
+}
+
+// ArrayParam formats values as a ClickHouse Array(String) parameter
+func ArrayParam(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		value = strings.ReplaceAll(value, `\`, `\\`)
+		quoted[i] = "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+	}
+	return "[" + strings.Join(quoted, ",") + "]"
+}
@@ -0,0 +1,118 @@
+package clickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTable(t *testing.T) {
+	client := NewClient("http://localhost:8123", "", "", "dataflux")
+
+	table, err := client.Table("search_events")
+	require.NoError(t, err)
+	assert.Equal(t, "dataflux.search_events", table)
+
+	_, err = client.Table("events; DROP TABLE x")
+	assert.Error(t, err)
+
+	table, err = NewClient("http://localhost:8123", "", "", "").Table("audit_events")
+	require.NoError(t, err)
+	assert.Equal(t, "audit_events", table)
+}
+
+func TestExecBindsParameters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "user-1", r.URL.Query().Get("param_subject"))
+		user, _, _ := r.BasicAuth()
+		assert.Equal(t, "reader", user)
+		w.Write([]byte("42\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "reader", "secret", "")
+	body, err := client.Exec(context.Background(), "SELECT count() FROM t WHERE user_id = {subject:String}", map[string]string{"subject": "user-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "42\n", string(body))
+}
+
+func TestSelectIsReadOnly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.URL.Query().Get("readonly"))
+		assert.Equal(t, "dataflux", r.URL.Query().Get("database"))
+		assert.Equal(t, "5", r.URL.Query().Get("max_execution_time"))
+		w.Write([]byte("1\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", "", "dataflux")
+	body, err := client.Select(context.Background(), "SELECT 1", map[string]string{"max_execution_time": "5", "readonly": "0"})
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", string(body))
+}
+
+func TestOnlySelectIsRetried(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("1\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", "", "")
+	body, err := client.Select(context.Background(), "SELECT 1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", string(body))
+	assert.Equal(t, 2, requests)
+
+	requests = 0
+	_, err = client.Exec(context.Background(), "INSERT INTO t VALUES (1)", nil)
+	var chErr *Error
+	require.ErrorAs(t, err, &chErr)
+	assert.Equal(t, http.StatusServiceUnavailable, chErr.StatusCode)
+	assert.Equal(t, 1, requests)
+}
+
+func TestExecReportsUnknownTable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Code: 60. DB::Exception: Table dataflux.missing does not exist. (UNKNOWN_TABLE)", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, "", "", "").Exec(context.Background(), "SELECT 1 FROM missing", nil)
+	require.Error(t, err)
+	assert.True(t, IsUnknownTable(err))
+}
+
+func TestInsertWritesJSONEachRow(t *testing.T) {
+	var statement string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		statement = string(body)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", "", "dataflux")
+	err := client.Insert(context.Background(), "search_events",
+		map[string]interface{}{"query": "beach"},
+		map[string]interface{}{"query": "sunset"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO dataflux.search_events FORMAT JSONEachRow\n{\"query\":\"beach\"}\n{\"query\":\"sunset\"}\n", statement)
+
+	assert.Error(t, client.Insert(context.Background(), "bad name", map[string]interface{}{}))
+}
+
+func TestArrayParam(t *testing.T) {
+	assert.Equal(t, "[]", ArrayParam(nil))
+	assert.Equal(t, `['a','it\'s','back\\slash']`, ArrayParam([]string{"a", "it's", `back\slash`}))
+}
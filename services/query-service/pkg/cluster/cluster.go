@@ -0,0 +1,232 @@
+package cluster
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// labelTags is the number of tags joined into a cluster label
+const labelTags = 3
+
+// Point is an item to cluster, usually a search result with its embedding
+type Point struct {
+	ID     string
+	Vector []float64
+	Tags   []string
+}
+
+// Cluster is a group of similar points labeled by their characteristic tags
+type Cluster struct {
+	ID      int      `json:"id"`
+	Label   string   `json:"label"`
+	Tags    []string `json:"tags"`
+	Size    int      `json:"size"`
+	Members []string `json:"members"`
+}
+
+// DefaultK picks a cluster count for n points: the square root of n/2,
+// at least 2 and at most max
+func DefaultK(n, max int) int {
+	k := int(math.Round(math.Sqrt(float64(n) / 2)))
+	if k < 2 {
+		k = 2
+	}
+	if k > max {
+		k = max
+	}
+	return k
+}
+
+// Group clusters the points into at most k groups with spherical k-means
+// and labels each group. Points without a vector, or whose vector does not
+// match the dimension of the first one, are left out. Members keep their
+// input order, and clusters are ordered by their first member, so with
+// ranked input the cluster of the best result comes first.
+func Group(points []Point, k, iterations int) []Cluster {
+	var usable []Point
+	for _, point := range points {
+		if len(point.Vector) > 0 && (len(usable) == 0 || len(point.Vector) == len(usable[0].Vector)) {
+			usable = append(usable, point)
+		}
+	}
+	if len(usable) == 0 || k < 1 {
+		return []Cluster{}
+	}
+	if k > len(usable) {
+		k = len(usable)
+	}
+
+	vectors := make([][]float64, len(usable))
+	for i, point := range usable {
+		vectors[i] = normalize(point.Vector)
+	}
+	assignments := KMeans(vectors, k, iterations)
+
+	// Renumber clusters in order of their first member
+	order := map[int]int{}
+	var clusters []Cluster
+	for i, assigned := range assignments {
+		index, ok := order[assigned]
+		if !ok {
+			index = len(clusters)
+			order[assigned] = index
+			clusters = append(clusters, Cluster{ID: index, Members: []string{}})
+		}
+		clusters[index].Members = append(clusters[index].Members, usable[i].ID)
+		clusters[index].Size++
+	}
+
+	label(clusters, usable, assignments, order)
+	return clusters
+}
+
+// KMeans assigns each unit-length vector to one of k clusters by cosine
+// similarity. Centroids start from the first vector and then the vector
+// farthest from those already chosen, so the result is deterministic.
+func KMeans(vectors [][]float64, k, iterations int) []int {
+	assignments := make([]int, len(vectors))
+	if len(vectors) == 0 {
+		return assignments
+	}
+
+	centroids := [][]float64{vectors[0]}
+	for len(centroids) < k {
+		farthest, farthestSimilarity := -1, math.Inf(1)
+		for i, vector := range vectors {
+			best := math.Inf(-1)
+			for _, centroid := range centroids {
+				best = math.Max(best, dot(vector, centroid))
+			}
+			if best < farthestSimilarity {
+				farthest, farthestSimilarity = i, best
+			}
+		}
+		centroids = append(centroids, vectors[farthest])
+	}
+
+	for iteration := 0; iteration < iterations; iteration++ {
+		changed := false
+		for i, vector := range vectors {
+			nearest, nearestSimilarity := 0, math.Inf(-1)
+			for c, centroid := range centroids {
+				if similarity := dot(vector, centroid); similarity > nearestSimilarity {
+					nearest, nearestSimilarity = c, similarity
+				}
+			}
+			if assignments[i] != nearest {
+				assignments[i] = nearest
+				changed = true
+			}
+		}
+		if iteration > 0 && !changed {
+			break
+		}
+
+		// An emptied cluster keeps its previous centroid
+		sums := make([][]float64, k)
+		for i, vector := range vectors {
+			c := assignments[i]
+			if sums[c] == nil {
+				sums[c] = make([]float64, len(vector))
+			}
+			for d, value := range vector {
+				sums[c][d] += value
+			}
+		}
+		for c, sum := range sums {
+			if sum != nil {
+				centroids[c] = normalize(sum)
+			}
+		}
+	}
+	return assignments
+}
+
+// label names each cluster after the tags that are both common in it and
+// concentrated in it: a tag scores its share of the cluster's members times
+// the share of its occurrences that fall in the cluster
+func label(clusters []Cluster, points []Point, assignments []int, order map[int]int) {
+	totals := map[string]int{}
+	counts := make([]map[string]int, len(clusters))
+	for i := range clusters {
+		counts[i] = map[string]int{}
+	}
+	for i, point := range points {
+		index := order[assignments[i]]
+		for _, tag := range uniqueTags(point.Tags) {
+			totals[tag]++
+			counts[index][tag]++
+		}
+	}
+
+	for i := range clusters {
+		type scored struct {
+			tag   string
+			score float64
+		}
+		var candidates []scored
+		for tag, count := range counts[i] {
+			share := float64(count) / float64(clusters[i].Size)
+			concentration := float64(count) / float64(totals[tag])
+			candidates = append(candidates, scored{tag, share * concentration})
+		}
+		sort.Slice(candidates, func(a, b int) bool {
+			if candidates[a].score != candidates[b].score {
+				return candidates[a].score > candidates[b].score
+			}
+			return candidates[a].tag < candidates[b].tag
+		})
+
+		clusters[i].Tags = []string{}
+		for _, candidate := range candidates {
+			if len(clusters[i].Tags) == labelTags {
+				break
+			}
+			clusters[i].Tags = append(clusters[i].Tags, candidate.tag)
+		}
+		clusters[i].Label = strings.Join(clusters[i].Tags, ", ")
+		if clusters[i].Label == "" {
+			clusters[i].Label = fmt.Sprintf("Cluster %d", i+1)
+		}
+	}
+}
+
+func uniqueTags(tags []string) []string {
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+	return unique
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func normalize(vector []float64) []float64 {
+	var norm float64
+	for _, value := range vector {
+		norm += value * value
+	}
+	norm = math.Sqrt(norm)
+
+	normalized := make([]float64, len(vector))
+	if norm == 0 {
+		return normalized
+	}
+	for i, value := range vector {
+		normalized[i] = value / norm
+	}
+	return normalized
+}
@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultK(t *testing.T) {
+	assert.Equal(t, 2, DefaultK(3, 10))
+	assert.Equal(t, 5, DefaultK(50, 10))
+	assert.Equal(t, 10, DefaultK(1000, 10))
+}
+
+func TestGroupSeparatesAndLabels(t *testing.T) {
+	points := []Point{
+		{ID: "no-vector"},
+		{ID: "beach-1", Vector: []float64{1, 0.1, 0}, Tags: []string{"beach", "sunset", "outdoor"}},
+		{ID: "snow-1", Vector: []float64{0, 0.1, 1}, Tags: []string{"snow", "outdoor"}},
+		{ID: "beach-2", Vector: []float64{0.9, 0, 0.1}, Tags: []string{"Beach", "surf"}},
+		{ID: "snow-2", Vector: []float64{0.1, 0, 0.9}, Tags: []string{"snow", "ski"}},
+	}
+
+	clusters := Group(points, 2, 10)
+
+	require.Len(t, clusters, 2)
+	assert.Equal(t, 0, clusters[0].ID)
+	assert.Equal(t, []string{"beach-1", "beach-2"}, clusters[0].Members)
+	assert.Equal(t, 2, clusters[0].Size)
+	assert.Equal(t, "beach", clusters[0].Tags[0])
+	assert.Equal(t, []string{"snow-1", "snow-2"}, clusters[1].Members)
+	assert.Equal(t, "snow", clusters[1].Tags[0])
+	assert.NotContains(t, clusters[1].Tags[:1], "outdoor")
+}
+
+func TestGroupWithoutTags(t *testing.T) {
+	clusters := Group([]Point{{ID: "a", Vector: []float64{1, 0}}}, 3, 10)
+	require.Len(t, clusters, 1)
+	assert.Equal(t, "Cluster 1", clusters[0].Label)
+	assert.Empty(t, clusters[0].Tags)
+}
+
+func TestGroupSkipsMismatchedDimensions(t *testing.T) {
+	clusters := Group([]Point{
+		{ID: "a", Vector: []float64{1, 0}},
+		{ID: "b", Vector: []float64{1, 0, 0}},
+	}, 2, 10)
+	require.Len(t, clusters, 1)
+	assert.Equal(t, []string{"a"}, clusters[0].Members)
+}
+
+func TestGroupEmpty(t *testing.T) {
+	assert.Empty(t, Group(nil, 2, 10))
+}
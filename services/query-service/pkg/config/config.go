@@ -0,0 +1,504 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dataflux/query-service/pkg/vault"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of options read from outside the environment and the file
+const (
+	// SourceSecretFile is the file named by the option's _FILE variable,
+	// as Docker and Kubernetes mount secrets
+	SourceSecretFile = "secret_file"
+	// SourceVault is a secret in Vault named by a vault:<path>#<key> value
+	SourceVault = "vault"
+)
+
+// vaultTimeout bounds every read from Vault
+const vaultTimeout = 10 * time.Second
+
+// Config holds the service's listen port and backend connections. Every
+// other option is read by environment variable name through Setting.
+//
+// Any option can instead be read from a file named by the same variable
+// with a _FILE suffix, or from Vault when its value is a reference such as
+// vault:database/creds/query-service#password. Refresh reads those again.
+type Config struct {
+	Port       string           `yaml:"port" env:"PORT"`
+	Postgres   PostgresConfig   `yaml:"postgres"`
+	Redis      RedisConfig      `yaml:"redis"`
+	Neo4j      Neo4jConfig      `yaml:"neo4j"`
+	Weaviate   WeaviateConfig   `yaml:"weaviate"`
+	ClickHouse ClickHouseConfig `yaml:"clickhouse"`
+	Storage    StorageConfig    `yaml:"storage"`
+	// Settings sets other options in the file, keyed by the name of their
+	// environment variable
+	Settings map[string]string `yaml:"settings"`
+
+	file     string
+	getenv   func(string) string
+	mu       sync.Mutex
+	resolved map[string]Setting
+
+	// vault is nil unless VAULT_ADDR is set
+	vault *vault.Client
+	// secrets are the options read from files or Vault, by variable name
+	secrets map[string]secretSource
+	// vaultSecrets caches Vault secrets by path, so options taken from one
+	// secret, such as a database user and its password, always agree
+	vaultSecrets map[string]*vault.Secret
+	secretErrs   []error
+}
+
+// secretSource is where an option read from a file or Vault comes from
+type secretSource struct {
+	file      string
+	reference string
+	// value is the typed option holding the secret; nil for settings
+	value *string
+}
+
+// PostgresConfig is the PostgreSQL connection
+type PostgresConfig struct {
+	URL string `yaml:"url" env:"DATABASE_URL"`
+}
+
+// RedisConfig is the Redis connection
+type RedisConfig struct {
+	URL string `yaml:"url" env:"REDIS_URL"`
+}
+
+// Neo4jConfig is the Neo4j connection; the Bolt URI serves the driver and
+// the HTTP URL the Cypher endpoint of the database
+type Neo4jConfig struct {
+	URI      string `yaml:"uri" env:"NEO4J_URI"`
+	HTTPURL  string `yaml:"http_url" env:"NEO4J_HTTP_URL"`
+	Database string `yaml:"database" env:"NEO4J_DATABASE"`
+	User     string `yaml:"user" env:"NEO4J_USER"`
+	Password string `yaml:"password" env:"NEO4J_PASSWORD" secret:"true"`
+}
+
+// WeaviateConfig is the Weaviate connection
+type WeaviateConfig struct {
+	URL string `yaml:"url" env:"WEAVIATE_URL"`
+}
+
+// ClickHouseConfig is the ClickHouse connection; an empty URL disables analytics
+type ClickHouseConfig struct {
+	URL      string `yaml:"url" env:"CLICKHOUSE_URL"`
+	User     string `yaml:"user" env:"CLICKHOUSE_USER"`
+	Password string `yaml:"password" env:"CLICKHOUSE_PASSWORD" secret:"true"`
+	Database string `yaml:"database" env:"CLICKHOUSE_DATABASE"`
+}
+
+// StorageConfig is the S3-compatible object storage holding asset files
+type StorageConfig struct {
+	Endpoint  string `yaml:"endpoint" env:"MINIO_URL"`
+	Region    string `yaml:"region" env:"MINIO_REGION"`
+	AccessKey string `yaml:"access_key" env:"MINIO_ACCESS_KEY" secret:"true"`
+	SecretKey string `yaml:"secret_key" env:"MINIO_SECRET_KEY" secret:"true"`
+	Bucket    string `yaml:"bucket" env:"MINIO_BUCKET"`
+}
+
+// Setting is the value an option resolved to and where it came from: env,
+// file or default
+type Setting struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Default returns the configuration of a local development stack. It holds
+// no credentials; those come from the file or the environment.
+func Default() *Config {
+	return &Config{
+		Port:       "8002",
+		Postgres:   PostgresConfig{URL: "postgresql://dataflux_user@localhost:2001/dataflux"},
+		Redis:      RedisConfig{URL: "redis://localhost:2002/0"},
+		Neo4j:      Neo4jConfig{URI: "bolt://localhost:2008", HTTPURL: "http://localhost:2007", Database: "neo4j", User: "neo4j"},
+		Weaviate:   WeaviateConfig{URL: "http://localhost:2005"},
+		ClickHouse: ClickHouseConfig{URL: "http://localhost:2011", User: "dataflux_user", Database: "dataflux"},
+		Storage:    StorageConfig{Endpoint: "http://localhost:2003", Region: "us-east-1", Bucket: "dataflux-assets"},
+	}
+}
+
+// Load reads the defaults, then the YAML file at path unless it is empty,
+// then the environment variables read through getenv, each overriding the
+// last. The configuration is returned even when the file cannot be read, so
+// callers can report the error after their own initialization.
+func Load(path string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+	cfg.file = path
+	cfg.getenv = getenv
+	cfg.resolved = map[string]Setting{}
+	cfg.secrets = map[string]secretSource{}
+	cfg.vaultSecrets = map[string]*vault.Secret{}
+	if addr := getenv("VAULT_ADDR"); addr != "" {
+		cfg.vault = vault.NewClient(addr, getenv("VAULT_TOKEN"), getenv("VAULT_TOKEN_FILE"), getenv("VAULT_NAMESPACE"), vaultTimeout)
+	}
+
+	var err error
+	if path != "" {
+		err = cfg.readFile(path)
+	}
+	cfg.fields(func(f field) {
+		if override := getenv(f.env); override != "" {
+			*f.value = override
+		}
+		if value, source, err := cfg.resolveSecret(f.env, *f.value, f.value); err != nil {
+			cfg.secretErrs = append(cfg.secretErrs, err)
+		} else if source != "" {
+			*f.value = value
+		}
+	})
+	return cfg, err
+}
+
+// resolveSecret reads option key from the file named by key_FILE, or from
+// Vault when value is a reference, and remembers where it came from for
+// Refresh. The source is empty when value is used as it is.
+func (c *Config) resolveSecret(key, value string, target *string) (string, string, error) {
+	var source secretSource
+	var name string
+	switch {
+	case c.getenv(key+"_FILE") != "":
+		if c.getenv(key) != "" {
+			return value, "", fmt.Errorf("set either %s or %s_FILE, not both", key, key)
+		}
+		source, name = secretSource{file: c.getenv(key + "_FILE"), value: target}, SourceSecretFile
+	case vault.IsReference(value):
+		source, name = secretSource{reference: value, value: target}, SourceVault
+	default:
+		return value, "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+	value, err := c.readSecret(ctx, key, source)
+	if err != nil {
+		return value, "", err
+	}
+	c.secrets[key] = source
+	return value, name, nil
+}
+
+// readSecret reads an option from its file, or from the cached Vault
+// secret, reading that first when it is not cached yet
+func (c *Config) readSecret(ctx context.Context, key string, source secretSource) (string, error) {
+	if source.file != "" {
+		content, err := os.ReadFile(source.file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_FILE: %v", key, err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	path, name, err := vault.ParseReference(source.reference)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", key, err)
+	}
+	if c.vault == nil {
+		return "", fmt.Errorf("%s refers to Vault but VAULT_ADDR is not set", key)
+	}
+	secret, ok := c.vaultSecrets[path]
+	if !ok {
+		if secret, err = c.vault.Read(ctx, path); err != nil {
+			return "", fmt.Errorf("%s: %v", key, err)
+		}
+		c.vaultSecrets[path] = secret
+	}
+	value, ok := secret.Data[name]
+	if !ok {
+		return "", fmt.Errorf("%s: Vault secret %s has no key %q", key, path, name)
+	}
+	return value, nil
+}
+
+// Current returns the present value of the typed option read from the named
+// variable, which Refresh may have changed since Load
+func (c *Config) Current(name string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var value string
+	c.fields(func(f field) {
+		if f.env == name {
+			value = *f.value
+		}
+	})
+	return value
+}
+
+// Refresh reads the options taken from files and Vault again, so rotated
+// credentials are picked up. Vault secrets without a lease are read on
+// every call, leased ones such as dynamic database credentials once two
+// thirds of the lease have passed. It returns the variable names of the
+// options that changed; options that cannot be read keep their value.
+func (c *Config) Refresh(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	now := time.Now()
+	for path, secret := range c.vaultSecrets {
+		if secret.LeaseDuration > 0 && !secret.Stale(now) {
+			continue
+		}
+		fresh, err := c.vault.Read(ctx, path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c.vaultSecrets[path] = fresh
+	}
+
+	var changed []string
+	for key, source := range c.secrets {
+		value, err := c.readSecret(ctx, key, source)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if source.value != nil {
+			if *source.value != value {
+				*source.value = value
+				changed = append(changed, key)
+			}
+			continue
+		}
+		if setting := c.resolved[key]; setting.Value != value {
+			setting.Value = value
+			c.resolved[key] = setting
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed, errors.Join(errs...)
+}
+
+// Reload reads the file and the environment again, as Load does, and takes
+// the port and connections from them, so a backend can be moved or given
+// new credentials without a restart. Other settings keep the values they
+// were first read with. It returns the variable names of the options that
+// changed; when the file or a secret cannot be read nothing changes.
+func (c *Config) Reload() ([]string, error) {
+	fresh, err := Load(c.file, c.getenv)
+	if err == nil {
+		err = errors.Join(fresh.secretErrs...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	fresh.fields(func(f field) { values[f.env] = *f.value })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var changed []string
+	targets := map[string]*string{}
+	c.fields(func(f field) {
+		targets[f.env] = f.value
+		if *f.value != values[f.env] {
+			*f.value = values[f.env]
+			changed = append(changed, f.env)
+		}
+	})
+
+	// Refresh reads the options from where the file now says they come from
+	for key, source := range c.secrets {
+		if source.value != nil {
+			delete(c.secrets, key)
+		}
+	}
+	for key, source := range fresh.secrets {
+		if source.value != nil {
+			source.value = targets[key]
+			c.secrets[key] = source
+		}
+	}
+	for path, secret := range fresh.vaultSecrets {
+		c.vaultSecrets[path] = secret
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	// Unknown keys are rejected so that a misspelt option is not silently ignored
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// field is a typed option; section is the YAML key of the connection it
+// belongs to, or service for top-level options
+type field struct {
+	section string
+	name    string
+	env     string
+	secret  bool
+	value   *string
+}
+
+// fields calls fn for every typed option
+func (c *Config) fields(fn func(field)) {
+	var visit func(section string, v reflect.Value)
+	visit = func(section string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			structField := v.Type().Field(i)
+			switch {
+			case structField.Type.Kind() == reflect.Struct && structField.IsExported():
+				visit(structField.Tag.Get("yaml"), v.Field(i))
+			case structField.Tag.Get("env") != "":
+				fn(field{
+					section: section,
+					name:    structField.Tag.Get("yaml"),
+					env:     structField.Tag.Get("env"),
+					secret:  structField.Tag.Get("secret") == "true",
+					value:   v.Field(i).Addr().Interface().(*string),
+				})
+			}
+		}
+	}
+	visit("service", reflect.ValueOf(c).Elem())
+}
+
+// Validate checks that every connection is usable, reporting all problems
+// at once
+func (c *Config) Validate() error {
+	c.mu.Lock()
+	errs := append([]error(nil), c.secretErrs...)
+	c.mu.Unlock()
+	check := func(name, value string, required bool, schemes ...string) {
+		if value == "" {
+			if required {
+				errs = append(errs, fmt.Errorf("%s is required", name))
+			}
+			return
+		}
+		parsed, err := url.Parse(value)
+		if err != nil || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("%s is not a valid URL", name))
+			return
+		}
+		for _, scheme := range schemes {
+			if parsed.Scheme == scheme {
+				return
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s must use one of the schemes %v", name, schemes))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be a port number, got %q", c.Port))
+	}
+	check("DATABASE_URL", c.Postgres.URL, true, "postgres", "postgresql")
+	check("REDIS_URL", c.Redis.URL, true, "redis", "rediss")
+	check("NEO4J_URI", c.Neo4j.URI, true, "bolt", "bolt+s", "neo4j", "neo4j+s")
+	check("NEO4J_HTTP_URL", c.Neo4j.HTTPURL, true, "http", "https")
+	if c.Neo4j.Database == "" {
+		errs = append(errs, fmt.Errorf("NEO4J_DATABASE must name a database"))
+	}
+	check("WEAVIATE_URL", c.Weaviate.URL, true, "http", "https")
+	check("CLICKHOUSE_URL", c.ClickHouse.URL, false, "http", "https")
+	check("MINIO_URL", c.Storage.Endpoint, true, "http", "https")
+	return errors.Join(errs...)
+}
+
+// Setting returns the option named by an environment variable: its value
+// in the environment, else in the file's settings, else defaultValue. The
+// file named by key_FILE or a Vault reference in that value is read instead.
+// Secrets that cannot be read are reported by Validate.
+func (c *Config) Setting(key, defaultValue string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.secrets[key]; ok {
+		return c.resolved[key].Value
+	}
+
+	setting := Setting{Value: defaultValue, Source: "default"}
+	if value := c.getenv(key); value != "" {
+		setting = Setting{Value: value, Source: "env"}
+	} else if value, ok := c.Settings[key]; ok {
+		setting = Setting{Value: value, Source: "file"}
+	}
+	if value, source, err := c.resolveSecret(key, setting.Value, nil); err != nil {
+		c.secretErrs = append(c.secretErrs, err)
+	} else if source != "" {
+		setting = Setting{Value: value, Source: source}
+	}
+
+	c.resolved[key] = setting
+	return setting.Value
+}
+
+// sensitiveSetting matches the names of options holding credentials
+var sensitiveSetting = regexp.MustCompile(`PASSWORD|SECRET|TOKEN|API_KEY|ACCESS_KEY|PRIVATE_KEY`)
+
+// redacted is shown in place of a credential
+const redacted = "[redacted]"
+
+// Sanitized is the configuration with credentials removed, for debugging
+type Sanitized struct {
+	File        string                       `json:"file,omitempty"`
+	Connections map[string]map[string]string `json:"connections"`
+	// Settings lists every option the service has read so far
+	Settings map[string]Setting `json:"settings"`
+}
+
+// Sanitized returns the configuration with secrets, URL passwords and
+// every option read from a file or Vault redacted
+func (c *Config) Sanitized() Sanitized {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sanitized := Sanitized{File: c.file, Connections: map[string]map[string]string{}, Settings: map[string]Setting{}}
+	c.fields(func(f field) {
+		if sanitized.Connections[f.section] == nil {
+			sanitized.Connections[f.section] = map[string]string{}
+		}
+		_, fromSecret := c.secrets[f.env]
+		sanitized.Connections[f.section][f.name] = sanitize(*f.value, f.secret || fromSecret)
+	})
+	for key, setting := range c.resolved {
+		_, fromSecret := c.secrets[key]
+		setting.Value = sanitize(setting.Value, sensitiveSetting.MatchString(key) || fromSecret)
+		sanitized.Settings[key] = setting
+	}
+	return sanitized
+}
+
+// sanitize redacts secrets and the password of URLs
+func sanitize(value string, secret bool) string {
+	if value == "" {
+		return ""
+	}
+	if secret {
+		return redacted
+	}
+	if parsed, err := url.Parse(value); err == nil && parsed.User != nil {
+		return parsed.Redacted()
+	}
+	return value
+}
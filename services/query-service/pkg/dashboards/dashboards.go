@@ -0,0 +1,297 @@
+package dashboards
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"dataflux/query-service/pkg/aggregate"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// MaxPanels bounds the aggregate queries of one dashboard
+const MaxPanels = 20
+
+const (
+	// snapshotPrefix keys the cached results of each dashboard in Redis
+	snapshotPrefix = "dashboards:snapshot:"
+	// lockKey makes sure only one replica refreshes the snapshots at a time
+	lockKey = "dashboards:refresh:lock"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Panel is one aggregate query of a dashboard
+type Panel struct {
+	Name    string            `json:"name"`
+	Title   string            `json:"title,omitempty"`
+	Request aggregate.Request `json:"request"`
+}
+
+// Dashboard is a named set of aggregate queries the UI loads together
+type Dashboard struct {
+	Name        string    `json:"name"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Panels      []Panel   `json:"panels"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PanelResult is the outcome of one panel; a failed panel does not fail
+// the dashboard
+type PanelResult struct {
+	Name     string              `json:"name"`
+	Title    string              `json:"title,omitempty"`
+	Response *aggregate.Response `json:"response,omitempty"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// Snapshot is a dashboard with the results of all its panels
+type Snapshot struct {
+	Dashboard   Dashboard     `json:"dashboard"`
+	Panels      []PanelResult `json:"panels"`
+	RefreshedAt time.Time     `json:"refreshed_at"`
+}
+
+// Validate checks the dashboard and fills in defaults of its requests
+func Validate(dashboard *Dashboard) error {
+	if !namePattern.MatchString(dashboard.Name) {
+		return &aggregate.ValidationError{Message: "dashboard name must be 1-64 lower-case letters, digits, - or _"}
+	}
+	if len(dashboard.Panels) == 0 || len(dashboard.Panels) > MaxPanels {
+		return &aggregate.ValidationError{Message: fmt.Sprintf("between 1 and %d panels are required", MaxPanels)}
+	}
+
+	names := map[string]bool{}
+	for i := range dashboard.Panels {
+		panel := &dashboard.Panels[i]
+		if panel.Name == "" || names[panel.Name] {
+			return &aggregate.ValidationError{Message: fmt.Sprintf("panel %d needs a unique name", i)}
+		}
+		names[panel.Name] = true
+		if err := aggregate.Validate(&panel.Request); err != nil {
+			return &aggregate.ValidationError{Message: fmt.Sprintf("panel %s: %v", panel.Name, err)}
+		}
+	}
+	return nil
+}
+
+// Service stores dashboards in PostgreSQL and caches their results in Redis
+type Service struct {
+	pool       *pgxpool.Pool
+	redis      *redis.Client
+	aggregator *aggregate.Aggregator
+	ttl        time.Duration
+	instance   string
+}
+
+// NewService creates a dashboard service; cached snapshots expire after ttl
+// unless refreshed before
+func NewService(pool *pgxpool.Pool, redisClient *redis.Client, aggregator *aggregate.Aggregator, ttl time.Duration) *Service {
+	instance, _ := os.Hostname()
+	return &Service{pool: pool, redis: redisClient, aggregator: aggregator, ttl: ttl, instance: instance}
+}
+
+// EnsureSchema creates the dashboard table if it does not exist
+func (s *Service) EnsureSchema(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS aggregation_dashboards (
+			name VARCHAR(64) PRIMARY KEY,
+			title TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			panels JSONB NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+// List returns every dashboard definition
+func (s *Service) List(ctx context.Context) ([]Dashboard, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT name, title, description, panels, updated_at
+		FROM aggregation_dashboards
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dashboards: %v", err)
+	}
+	defer rows.Close()
+
+	dashboards := []Dashboard{}
+	for rows.Next() {
+		dashboard, err := scanDashboard(rows)
+		if err != nil {
+			return nil, err
+		}
+		dashboards = append(dashboards, dashboard)
+	}
+	return dashboards, rows.Err()
+}
+
+// Get returns a dashboard definition, or nil if it does not exist
+func (s *Service) Get(ctx context.Context, name string) (*Dashboard, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT name, title, description, panels, updated_at
+		FROM aggregation_dashboards
+		WHERE name = $1
+	`, name)
+	dashboard, err := scanDashboard(row)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dashboard, nil
+}
+
+// Put creates or replaces a dashboard and drops its cached results
+func (s *Service) Put(ctx context.Context, dashboard Dashboard) (Dashboard, error) {
+	if err := Validate(&dashboard); err != nil {
+		return Dashboard{}, err
+	}
+	panels, err := json.Marshal(dashboard.Panels)
+	if err != nil {
+		return Dashboard{}, fmt.Errorf("failed to encode panels: %v", err)
+	}
+
+	err = s.pool.QueryRow(ctx, `
+		INSERT INTO aggregation_dashboards (name, title, description, panels)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE
+		SET title = EXCLUDED.title, description = EXCLUDED.description,
+		    panels = EXCLUDED.panels, updated_at = NOW()
+		RETURNING updated_at
+	`, dashboard.Name, dashboard.Title, dashboard.Description, panels).Scan(&dashboard.UpdatedAt)
+	if err != nil {
+		return Dashboard{}, fmt.Errorf("failed to store dashboard: %v", err)
+	}
+
+	s.redis.Del(ctx, snapshotPrefix+dashboard.Name)
+	return dashboard, nil
+}
+
+// Delete removes a dashboard; it reports whether one existed
+func (s *Service) Delete(ctx context.Context, name string) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM aggregation_dashboards WHERE name = $1`, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete dashboard: %v", err)
+	}
+	s.redis.Del(ctx, snapshotPrefix+name)
+	return tag.RowsAffected() > 0, nil
+}
+
+// Snapshot returns the cached results of a dashboard, computing them when
+// the cache is empty or older than the definition. It returns nil if the
+// dashboard does not exist.
+func (s *Service) Snapshot(ctx context.Context, name string) (*Snapshot, error) {
+	dashboard, err := s.Get(ctx, name)
+	if err != nil || dashboard == nil {
+		return nil, err
+	}
+
+	if payload, err := s.redis.Get(ctx, snapshotPrefix+name).Bytes(); err == nil {
+		var snapshot Snapshot
+		if json.Unmarshal(payload, &snapshot) == nil && !snapshot.Dashboard.UpdatedAt.Before(dashboard.UpdatedAt) {
+			return &snapshot, nil
+		}
+	}
+
+	snapshot := s.compute(ctx, *dashboard)
+	s.store(ctx, snapshot)
+	return &snapshot, nil
+}
+
+// Refresh recomputes and caches the results of every dashboard
+func (s *Service) Refresh(ctx context.Context) error {
+	dashboards, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, dashboard := range dashboards {
+		s.store(ctx, s.compute(ctx, dashboard))
+	}
+	return nil
+}
+
+// Start refreshes the snapshots every interval until ctx is cancelled.
+// Replicas share a Redis lock so only one of them refreshes each cycle.
+func (s *Service) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				acquired, err := s.redis.SetNX(ctx, lockKey, s.instance, interval/2).Result()
+				if err != nil {
+					log.Printf("Warning: dashboard refresh lock failed: %v", err)
+					continue
+				}
+				if !acquired {
+					continue
+				}
+				if err := s.Refresh(ctx); err != nil {
+					log.Printf("Warning: dashboard refresh failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *Service) compute(ctx context.Context, dashboard Dashboard) Snapshot {
+	snapshot := Snapshot{Dashboard: dashboard, Panels: make([]PanelResult, len(dashboard.Panels))}
+	for i, panel := range dashboard.Panels {
+		result := PanelResult{Name: panel.Name, Title: panel.Title}
+		response, err := s.aggregator.Run(ctx, panel.Request)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Response = &response
+		}
+		snapshot.Panels[i] = result
+	}
+	snapshot.RefreshedAt = time.Now().UTC()
+	return snapshot
+}
+
+func (s *Service) store(ctx context.Context, snapshot Snapshot) {
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Printf("Warning: failed to encode dashboard %s: %v", snapshot.Dashboard.Name, err)
+		return
+	}
+	if err := s.redis.Set(ctx, snapshotPrefix+snapshot.Dashboard.Name, payload, s.ttl).Err(); err != nil {
+		log.Printf("Warning: failed to cache dashboard %s: %v", snapshot.Dashboard.Name, err)
+	}
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDashboard(row scanner) (Dashboard, error) {
+	var dashboard Dashboard
+	var panels []byte
+	if err := row.Scan(&dashboard.Name, &dashboard.Title, &dashboard.Description, &panels, &dashboard.UpdatedAt); err != nil {
+		if err == pgx.ErrNoRows {
+			return Dashboard{}, err
+		}
+		return Dashboard{}, fmt.Errorf("failed to scan dashboard: %v", err)
+	}
+	if err := json.Unmarshal(panels, &dashboard.Panels); err != nil {
+		return Dashboard{}, fmt.Errorf("failed to decode dashboard %s: %v", dashboard.Name, err)
+	}
+	return dashboard, nil
+}
@@ -0,0 +1,54 @@
+package dashboards
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dataflux/query-service/pkg/aggregate"
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func countPanel(name string) Panel {
+	return Panel{Name: name, Request: aggregate.Request{Aggregations: []aggregate.Aggregation{{Type: aggregate.TypeCount}}}}
+}
+
+func TestValidate(t *testing.T) {
+	dashboard := Dashboard{Name: "library-overview", Panels: []Panel{countPanel("assets")}}
+	require.NoError(t, Validate(&dashboard))
+	assert.Equal(t, aggregate.TargetAssets, dashboard.Panels[0].Request.Target)
+
+	invalid := []Dashboard{
+		{Name: "Library Overview", Panels: []Panel{countPanel("assets")}},
+		{Name: "empty"},
+		{Name: "duplicate", Panels: []Panel{countPanel("assets"), countPanel("assets")}},
+		{Name: "bad-request", Panels: []Panel{{Name: "assets", Request: aggregate.Request{Target: "features"}}}},
+	}
+	for _, dashboard := range invalid {
+		assert.IsType(t, &aggregate.ValidationError{}, Validate(&dashboard), dashboard.Name)
+	}
+}
+
+func TestComputeKeepsFailedPanels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"a0":"42"}]}`))
+	}))
+	defer server.Close()
+
+	service := NewService(nil, nil, aggregate.NewAggregator(clickhouse.NewClient(server.URL, "", "", "dataflux")), 0)
+	failing := countPanel("segments")
+	failing.Request.Target = "features"
+
+	snapshot := service.compute(context.Background(), Dashboard{Name: "overview", Panels: []Panel{countPanel("assets"), failing}})
+
+	require.Len(t, snapshot.Panels, 2)
+	assert.Equal(t, 42.0, *snapshot.Panels[0].Response.Results[0].Value)
+	assert.Empty(t, snapshot.Panels[0].Error)
+	assert.Nil(t, snapshot.Panels[1].Response)
+	assert.NotEmpty(t, snapshot.Panels[1].Error)
+	assert.False(t, snapshot.RefreshedAt.IsZero())
+}
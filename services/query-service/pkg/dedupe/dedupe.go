@@ -0,0 +1,142 @@
+package dedupe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"dataflux/query-service/pkg/neo4j"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// lockKey makes sure only one replica prunes the graph at a time
+const lockKey = "graph:dedupe:lock"
+
+// Graph merges duplicate similarity edges
+type Graph interface {
+	CountDuplicateSimilarities(ctx context.Context) (pairs, duplicates int, err error)
+	MergeDuplicateSimilarities(ctx context.Context, batch int) (pairs, pruned int, err error)
+}
+
+var _ Graph = (*neo4j.Neo4jClient)(nil)
+
+// Report summarizes one run. In a dry run, Pairs and Pruned are what a run
+// would merge and remove.
+type Report struct {
+	DryRun     bool      `json:"dry_run"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	// Pairs is the number of asset pairs whose parallel edges were merged
+	Pairs int `json:"pairs"`
+	// Pruned is the number of duplicate edges removed
+	Pruned int `json:"pruned"`
+	// Batches is the number of transactions the merge took
+	Batches int    `json:"batches"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Job merges the parallel SIMILAR_TO edges repeated similarity computations
+// leave between two assets, in batches so no transaction grows with the
+// graph. The edge kept has the best score and the history of the others.
+type Job struct {
+	graph     Graph
+	redis     *redis.Client
+	batchSize int
+	instance  string
+
+	mu         sync.RWMutex
+	lastReport *Report
+}
+
+// NewJob creates a job merging batchSize pairs per transaction
+func NewJob(graph Graph, redisClient *redis.Client, batchSize int) *Job {
+	instance, _ := os.Hostname()
+	return &Job{graph: graph, redis: redisClient, batchSize: batchSize, instance: instance}
+}
+
+// LastReport returns the report of the most recent run, if any
+func (j *Job) LastReport() *Report {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.lastReport
+}
+
+// Run merges every duplicate once. With dryRun set nothing is changed and
+// the report only counts the duplicates. A run that fails part way keeps
+// the batches already merged, and the report says how far it got.
+func (j *Job) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	report := &Report{DryRun: dryRun, StartedAt: time.Now().UTC()}
+	err := j.run(ctx, report)
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	j.mu.Lock()
+	j.lastReport = report
+	j.mu.Unlock()
+	return report, err
+}
+
+func (j *Job) run(ctx context.Context, report *Report) error {
+	if report.DryRun {
+		pairs, duplicates, err := j.graph.CountDuplicateSimilarities(ctx)
+		report.Pairs, report.Pruned = pairs, duplicates
+		return err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		pairs, pruned, err := j.graph.MergeDuplicateSimilarities(ctx, j.batchSize)
+		if err != nil {
+			return fmt.Errorf("batch %d: %v", report.Batches+1, err)
+		}
+		report.Batches++
+		report.Pairs += pairs
+		report.Pruned += pruned
+		if pairs < j.batchSize {
+			return nil
+		}
+	}
+}
+
+// Start runs the job every interval until ctx is cancelled. Replicas share
+// a Redis lock so only one of them runs each cycle.
+func (j *Job) Start(ctx context.Context, interval time.Duration, dryRun bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				j.runScheduled(ctx, interval, dryRun)
+			}
+		}
+	}()
+}
+
+func (j *Job) runScheduled(ctx context.Context, interval time.Duration, dryRun bool) {
+	acquired, err := j.redis.SetNX(ctx, lockKey, j.instance, interval/2).Result()
+	if err != nil {
+		log.Printf("Warning: graph dedupe lock failed: %v", err)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	report, err := j.Run(ctx, dryRun)
+	if err != nil {
+		log.Printf("Warning: graph dedupe failed after %d pairs: %v", report.Pairs, err)
+		return
+	}
+	log.Printf("Graph dedupe dry_run=%t pairs=%d pruned=%d batches=%d", report.DryRun, report.Pairs, report.Pruned, report.Batches)
+}
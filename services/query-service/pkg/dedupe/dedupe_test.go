@@ -0,0 +1,67 @@
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGraph holds a number of pairs with one duplicate edge each
+type fakeGraph struct {
+	pairs   int
+	batches []int
+	failAt  int
+}
+
+func (f *fakeGraph) CountDuplicateSimilarities(ctx context.Context) (int, int, error) {
+	return f.pairs, f.pairs, nil
+}
+
+func (f *fakeGraph) MergeDuplicateSimilarities(ctx context.Context, batch int) (int, int, error) {
+	if f.failAt > 0 && len(f.batches)+1 == f.failAt {
+		return 0, 0, errors.New("connection reset")
+	}
+	merged := min(batch, f.pairs)
+	f.pairs -= merged
+	f.batches = append(f.batches, merged)
+	return merged, merged, nil
+}
+
+func TestRun(t *testing.T) {
+	graph := &fakeGraph{pairs: 25}
+	job := NewJob(graph, nil, 10)
+	assert.Nil(t, job.LastReport())
+
+	report, err := job.Run(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, 25, report.Pruned)
+	assert.Empty(t, graph.batches)
+
+	report, err = job.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []int{10, 10, 5}, graph.batches)
+	assert.Equal(t, 25, report.Pairs)
+	assert.Equal(t, 25, report.Pruned)
+	assert.Equal(t, 3, report.Batches)
+	assert.Same(t, report, job.LastReport())
+
+	// A batch that comes out exactly full is followed by an empty one
+	graph = &fakeGraph{pairs: 10}
+	report, err = NewJob(graph, nil, 10).Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []int{10, 0}, graph.batches)
+	assert.Equal(t, 10, report.Pruned)
+}
+
+func TestRunKeepsProgressOnFailure(t *testing.T) {
+	graph := &fakeGraph{pairs: 25, failAt: 2}
+	job := NewJob(graph, nil, 10)
+
+	report, err := job.Run(context.Background(), false)
+	assert.EqualError(t, err, "batch 2: connection reset")
+	assert.Equal(t, 10, report.Pruned)
+	assert.Equal(t, "batch 2: connection reset", job.LastReport().Error)
+}
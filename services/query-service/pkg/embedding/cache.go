@@ -0,0 +1,70 @@
+package embedding
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// queryEmbeddingPrefix namespaces the cached query embeddings in Redis
+const queryEmbeddingPrefix = "query_embedding:"
+
+// CachedTextEmbedder keeps the embeddings of query texts in Redis, so a
+// repeated query is embedded once per model rather than on every search
+type CachedTextEmbedder struct {
+	next   TextEmbedder
+	client *redis.Client
+	model  string
+	ttl    time.Duration
+}
+
+// NewCachedTextEmbedder caches the embeddings of next for ttl. model names
+// the vector space, so switching models does not serve stale vectors.
+func NewCachedTextEmbedder(next TextEmbedder, client *redis.Client, model string, ttl time.Duration) *CachedTextEmbedder {
+	return &CachedTextEmbedder{next: next, client: client, model: model, ttl: ttl}
+}
+
+// EmbedText returns the cached embedding of the text, embedding it on a
+// miss. Redis failures only cost the cache. Texts hinted to be in different
+// languages are cached apart, as the hint may change their embedding.
+func (c *CachedTextEmbedder) EmbedText(ctx context.Context, text string) ([]float64, error) {
+	text = strings.Join(strings.Fields(text), " ")
+	key := queryEmbeddingKey(c.model, Language(ctx), text)
+	if cached, err := c.client.Get(ctx, key).Bytes(); err == nil {
+		var vector []float64
+		if err := json.Unmarshal(cached, &vector); err == nil && len(vector) > 0 {
+			return vector, nil
+		}
+	} else if err != redis.Nil {
+		log.Printf("Warning: failed to read cached query embedding: %v", err)
+	}
+
+	vector, err := c.next.EmbedText(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(vector)
+	if err == nil {
+		err = c.client.Set(ctx, key, encoded, c.ttl).Err()
+	}
+	if err != nil {
+		log.Printf("Warning: failed to cache query embedding: %v", err)
+	}
+	return vector, nil
+}
+
+// queryEmbeddingKey is the Redis key of a text's embedding under a model
+// and language hint; texts without a hint keep the keys they had before hints
+func queryEmbeddingKey(model, language, text string) string {
+	if language != "" {
+		model += "\x00" + language
+	}
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return queryEmbeddingPrefix + hex.EncodeToString(sum[:])
+}
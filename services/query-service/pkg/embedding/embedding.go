@@ -0,0 +1,114 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned when the embedding service cannot embed the
+// file's media type
+var ErrUnsupported = errors.New("media type not supported by the embedding service")
+
+// Client asks the embedding service for the vector of an example file, in
+// the same space as the vectors indexed in Weaviate
+type Client struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the embedding service at url
+func NewClient(url string, timeout time.Duration) *Client {
+	return &Client{
+		url:        strings.TrimRight(url, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Embed uploads the file to POST <url>/embed as the multipart field file and
+// returns the vector the service answers with as {"vector": [...]}
+func (c *Client) Embed(ctx context.Context, filename, contentType string, content io.Reader) ([]float64, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filename))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return nil, fmt.Errorf("failed to read example: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/embed", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding service request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnsupportedMediaType {
+		return nil, ErrUnsupported
+	}
+	return readVector(resp)
+}
+
+// EmbedText posts the text to POST <url>/embed/text as {"text": ...} and
+// returns the vector the service answers with as {"vector": [...]}. The
+// language hint of ctx is sent along as "language".
+func (c *Client) EmbedText(ctx context.Context, text string) ([]float64, error) {
+	request := map[string]string{"text": text}
+	if language := Language(ctx); language != "" {
+		request["language"] = language
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/embed/text", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding service request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	return readVector(resp)
+}
+
+// readVector decodes the {"vector": [...]} answer of the embedding service
+func readVector(resp *http.Response) ([]float64, error) {
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("embedding service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var result struct {
+		Vector []float64 `json:"vector"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding: %v", err)
+	}
+	if len(result.Vector) == 0 {
+		return nil, fmt.Errorf("embedding service returned an empty vector")
+	}
+	return result.Vector, nil
+}
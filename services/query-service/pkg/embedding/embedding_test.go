@@ -0,0 +1,130 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/embed", r.URL.Path)
+		file, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		content, _ := io.ReadAll(file)
+		assert.Equal(t, "pixels", string(content))
+		assert.Equal(t, "harbour.jpg", header.Filename)
+		assert.Equal(t, "image/jpeg", header.Header.Get("Content-Type"))
+		w.Write([]byte(`{"vector":[0.5,0.25]}`))
+	}))
+	defer server.Close()
+
+	vector, err := NewClient(server.URL+"/", time.Second).Embed(context.Background(), "harbour.jpg", "image/jpeg", strings.NewReader("pixels"))
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 0.25}, vector)
+}
+
+func TestEmbedErrors(t *testing.T) {
+	status := http.StatusUnsupportedMediaType
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"vector":[]}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, time.Second)
+
+	_, err := client.Embed(context.Background(), "a.xyz", "application/x-xyz", strings.NewReader("?"))
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	status = http.StatusInternalServerError
+	_, err = client.Embed(context.Background(), "a.jpg", "image/jpeg", strings.NewReader("?"))
+	assert.ErrorContains(t, err, "returned 500")
+
+	status = http.StatusOK
+	_, err = client.Embed(context.Background(), "a.jpg", "image/jpeg", strings.NewReader("?"))
+	assert.ErrorContains(t, err, "empty vector")
+}
+
+func TestEmbedText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/embed/text", r.URL.Path)
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "boats at dusk", body["text"])
+		w.Write([]byte(`{"vector":[0.1,0.9]}`))
+	}))
+	defer server.Close()
+
+	embedder, err := NewTextEmbedder(TextConfig{Provider: ProviderHTTP, URL: server.URL, Timeout: time.Second})
+	require.NoError(t, err)
+	vector, err := embedder.EmbedText(context.Background(), "boats at dusk")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.1, 0.9}, vector)
+}
+
+func TestEmbedTextSendsLanguageHint(t *testing.T) {
+	var body map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"vector":[0.1,0.9]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, time.Second)
+	_, err := client.EmbedText(WithLanguage(context.Background(), "de"), "Boote in der Dämmerung")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"text": "Boote in der Dämmerung", "language": "de"}, body)
+
+	_, err = client.EmbedText(context.Background(), "boats at dusk")
+	require.NoError(t, err)
+	assert.NotContains(t, body, "language")
+}
+
+func TestOpenAIEmbedText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]string{"model": "text-embedding-3-small", "input": "boats at dusk"}, body)
+		w.Write([]byte(`{"data":[{"embedding":[0.3,0.4]}]}`))
+	}))
+	defer server.Close()
+
+	embedder, err := NewTextEmbedder(TextConfig{Provider: ProviderOpenAI, URL: server.URL + "/v1", Model: "text-embedding-3-small", APIKey: "sk-test", Timeout: time.Second})
+	require.NoError(t, err)
+	vector, err := embedder.EmbedText(context.Background(), "boats at dusk")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.3, 0.4}, vector)
+}
+
+func TestNewTextEmbedder(t *testing.T) {
+	embedder, err := NewTextEmbedder(TextConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, embedder)
+
+	for _, config := range []TextConfig{
+		{Provider: ProviderHTTP},
+		{Provider: ProviderOpenAI},
+		{Provider: "word2vec"},
+	} {
+		_, err := NewTextEmbedder(config)
+		assert.Error(t, err, config.Provider)
+	}
+}
+
+func TestQueryEmbeddingKey(t *testing.T) {
+	assert.Equal(t, queryEmbeddingKey("m1", "", "boats"), queryEmbeddingKey("m1", "", "boats"))
+	assert.NotEqual(t, queryEmbeddingKey("m1", "", "boats"), queryEmbeddingKey("m2", "", "boats"))
+	assert.NotEqual(t, queryEmbeddingKey("m1", "", "boats"), queryEmbeddingKey("m1", "de", "boats"))
+	assert.True(t, strings.HasPrefix(queryEmbeddingKey("m1", "", "boats"), queryEmbeddingPrefix))
+}
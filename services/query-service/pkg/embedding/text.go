@@ -0,0 +1,131 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TextEmbedder turns query text into a vector comparable to the indexed ones
+type TextEmbedder interface {
+	EmbedText(ctx context.Context, text string) ([]float64, error)
+}
+
+type languageKey struct{}
+
+// WithLanguage hints the embedders that texts embedded with the returned
+// context are written in language, an ISO 639-1 code. Providers without a
+// way to take the hint ignore it.
+func WithLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, languageKey{}, language)
+}
+
+// Language returns the language hint of ctx, or "" without one
+func Language(ctx context.Context) string {
+	language, _ := ctx.Value(languageKey{}).(string)
+	return language
+}
+
+// Text embedding providers
+const (
+	// ProviderHTTP is the embedding service also used for example files.
+	// Local models, ONNX ones included, are served behind its protocol.
+	ProviderHTTP = "http"
+	// ProviderOpenAI is any API compatible with OpenAI's /embeddings
+	ProviderOpenAI = "openai"
+)
+
+// TextConfig selects and configures a text embedding provider
+type TextConfig struct {
+	Provider string
+	URL      string
+	// Model is sent to OpenAI-compatible APIs and names the cache entries
+	Model   string
+	APIKey  string
+	Timeout time.Duration
+}
+
+// NewTextEmbedder creates the embedder of the configured provider, or nil
+// when no provider is configured
+func NewTextEmbedder(config TextConfig) (TextEmbedder, error) {
+	switch config.Provider {
+	case "":
+		return nil, nil
+	case ProviderHTTP:
+		if config.URL == "" {
+			return nil, fmt.Errorf("the %s text embedder needs a URL", config.Provider)
+		}
+		return NewClient(config.URL, config.Timeout), nil
+	case ProviderOpenAI:
+		if config.Model == "" {
+			return nil, fmt.Errorf("the %s text embedder needs a model", config.Provider)
+		}
+		return NewOpenAIClient(config.URL, config.Model, config.APIKey, config.Timeout), nil
+	}
+	return nil, fmt.Errorf("unknown text embedding provider %q", config.Provider)
+}
+
+// OpenAIClient embeds text through an OpenAI-compatible /embeddings API
+type OpenAIClient struct {
+	url        string
+	model      string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewOpenAIClient creates a client for the API at url, which defaults to
+// OpenAI's own
+func NewOpenAIClient(url, model, apiKey string, timeout time.Duration) *OpenAIClient {
+	if url == "" {
+		url = "https://api.openai.com/v1"
+	}
+	return &OpenAIClient{
+		url:        strings.TrimRight(url, "/"),
+		model:      model,
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// EmbedText returns the embedding of the text from POST <url>/embeddings
+func (c *OpenAIClient) EmbedText(ctx context.Context, text string) ([]float64, error) {
+	body, err := json.Marshal(map[string]interface{}{"model": c.model, "input": text})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding API request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("embedding API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var result struct {
+		Data []struct {
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding: %v", err)
+	}
+	if len(result.Data) == 0 || len(result.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("embedding API returned an empty vector")
+	}
+	return result.Data[0].Embedding, nil
+}
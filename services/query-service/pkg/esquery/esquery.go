@@ -0,0 +1,570 @@
+// Package esquery translates a subset of the Elasticsearch search DSL into
+// DataFlux searches, so Elasticsearch and OpenSearch clients can query the
+// service during migrations
+package esquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/filter"
+)
+
+// Error types, as Elasticsearch names them
+const (
+	ParsingException         = "parsing_exception"
+	IllegalArgumentException = "illegal_argument_exception"
+)
+
+// DefaultSize is the number of hits returned when size is not given
+const DefaultSize = 10
+
+// mediaTypeFields select media types rather than filter metadata
+var mediaTypeFields = map[string]bool{"media_type": true, "media_types": true, "type": true}
+
+// unsupportedParameters are request body keys that would change the
+// results in ways a translation cannot honour; other unknown keys, such as
+// highlight or timeout, are ignored
+var unsupportedParameters = []string{
+	"aggs", "aggregations", "collapse", "knn", "pit", "rescore",
+	"runtime_mappings", "script_fields", "search_after", "suggest",
+}
+
+// Error is a request the translation rejects, reported in Elasticsearch's
+// error format
+type Error struct {
+	Type   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+func parsingError(format string, args ...interface{}) error {
+	return &Error{Type: ParsingException, Reason: fmt.Sprintf(format, args...)}
+}
+
+func illegalArgument(format string, args ...interface{}) error {
+	return &Error{Type: IllegalArgumentException, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Search is a translated request
+type Search struct {
+	// Text is the query string, in DataFlux query syntax
+	Text       string
+	MediaTypes []string
+	Filters    filter.Set
+	From       int
+	Size       int
+	// NoSource leaves _source out of the hits
+	NoSource bool
+	// Fields narrows _source to these metadata keys
+	Fields []string
+	// TrackTotalHits is the DataFlux track_total_hits value: empty, estimate
+	// or exact
+	TrackTotalHits string
+	// NoTotal leaves hits.total out, for track_total_hits false
+	NoTotal bool
+}
+
+// request is the part of a search body the translation reads
+type request struct {
+	Query          json.RawMessage `json:"query"`
+	PostFilter     json.RawMessage `json:"post_filter"`
+	From           *int            `json:"from"`
+	Size           *int            `json:"size"`
+	Source         json.RawMessage `json:"_source"`
+	TrackTotalHits json.RawMessage `json:"track_total_hits"`
+	Sort           json.RawMessage `json:"sort"`
+}
+
+// translator collects the text and filters of a query's clauses
+type translator struct {
+	text       []string
+	mediaTypes []string
+	filters    map[string]map[string]interface{}
+}
+
+// Translate reads a search body and the URI parameters q, from, size,
+// _source and track_total_hits, which override the body as they do in
+// Elasticsearch
+func Translate(body []byte, params url.Values) (Search, error) {
+	var req request
+	if len(bytes.TrimSpace(body)) > 0 {
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(body, &keys); err != nil {
+			return Search{}, parsingError("request body is not a JSON object: %v", err)
+		}
+		for _, key := range unsupportedParameters {
+			if _, ok := keys[key]; ok {
+				return Search{}, illegalArgument("[%s] is not supported", key)
+			}
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return Search{}, parsingError("%v", err)
+		}
+	}
+
+	t := &translator{filters: map[string]map[string]interface{}{}}
+	if q := params.Get("q"); q != "" {
+		t.addText(q)
+	} else if len(req.Query) > 0 {
+		if err := t.query(req.Query, false); err != nil {
+			return Search{}, err
+		}
+	}
+	if len(req.PostFilter) > 0 {
+		if err := t.query(req.PostFilter, false); err != nil {
+			return Search{}, err
+		}
+	}
+	if len(t.text) == 0 {
+		return Search{}, illegalArgument("a search needs text: use a match, multi_match or query_string query")
+	}
+
+	search := Search{Text: strings.Join(t.text, " "), MediaTypes: t.mediaTypes, Size: DefaultSize}
+	if len(t.filters) > 0 {
+		raw := make(map[string]interface{}, len(t.filters))
+		for field, condition := range t.filters {
+			raw[field] = condition
+		}
+		filters, err := filter.FromMap(raw)
+		if err != nil {
+			return Search{}, illegalArgument("%v", err)
+		}
+		search.Filters = filters
+	}
+
+	if err := sortByScore(req.Sort); err != nil {
+		return Search{}, err
+	}
+	if req.From != nil {
+		search.From = *req.From
+	}
+	if req.Size != nil {
+		search.Size = *req.Size
+	}
+	for name, target := range map[string]*int{"from": &search.From, "size": &search.Size} {
+		if value := params.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return Search{}, illegalArgument("[%s] must be an integer", name)
+			}
+			*target = n
+		}
+	}
+	if search.From < 0 || search.Size < 0 {
+		return Search{}, illegalArgument("[from] and [size] must not be negative")
+	}
+
+	source := req.Source
+	if value := params.Get("_source"); value != "" {
+		source = sourceParam(value)
+	}
+	if err := search.source(source); err != nil {
+		return Search{}, err
+	}
+	total := req.TrackTotalHits
+	if value := params.Get("track_total_hits"); value != "" {
+		total = json.RawMessage(value)
+	}
+	if err := search.trackTotalHits(total); err != nil {
+		return Search{}, err
+	}
+	return search, nil
+}
+
+// query translates a query clause. In a should clause only text queries
+// are allowed, since DataFlux filters cannot be combined with or.
+func (t *translator) query(raw json.RawMessage, should bool) error {
+	kind, body, err := single(raw, "query")
+	if err != nil {
+		return err
+	}
+	if should && !isTextQuery(kind) && kind != "bool" {
+		return illegalArgument("[%s] is not supported in a should clause", kind)
+	}
+
+	switch kind {
+	case "match_all":
+		return nil
+	case "match", "match_phrase", "match_phrase_prefix", "match_bool_prefix":
+		_, value, err := single(body, kind)
+		if err != nil {
+			return err
+		}
+		text, err := stringOrField(value, "query")
+		if err != nil {
+			return parsingError("[%s] %v", kind, err)
+		}
+		if kind == "match" || kind == "match_bool_prefix" {
+			t.addText(text)
+		} else {
+			t.addPhrase(text)
+		}
+	case "multi_match", "query_string", "simple_query_string":
+		var params struct {
+			Query string `json:"query"`
+			Type  string `json:"type"`
+		}
+		if err := json.Unmarshal(body, &params); err != nil || params.Query == "" {
+			return parsingError("[%s] requires a query", kind)
+		}
+		if kind == "multi_match" && strings.HasPrefix(params.Type, "phrase") {
+			t.addPhrase(params.Query)
+		} else if strings.TrimSpace(params.Query) != "*" {
+			t.addText(params.Query)
+		}
+	case "bool":
+		return t.boolQuery(body, should)
+	case "term", "prefix":
+		field, value, err := single(body, kind)
+		if err != nil {
+			return err
+		}
+		var object map[string]json.RawMessage
+		if json.Unmarshal(value, &object) == nil {
+			if value = object["value"]; value == nil {
+				return parsingError("[%s] requires a value", kind)
+			}
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(value, &decoded); err != nil {
+			return parsingError("[%s] %v", kind, err)
+		}
+		if kind == "term" {
+			return t.filter(field, filter.OpEq, decoded)
+		}
+		return t.filter(field, filter.OpPrefix, decoded)
+	case "terms":
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return parsingError("[terms] %v", err)
+		}
+		delete(fields, "boost")
+		if len(fields) != 1 {
+			return parsingError("[terms] query requires exactly one field")
+		}
+		for field, value := range fields {
+			var values []interface{}
+			if err := json.Unmarshal(value, &values); err != nil {
+				return parsingError("[terms] values of %s must be an array", field)
+			}
+			return t.filter(field, filter.OpIn, values)
+		}
+	case "range":
+		field, value, err := single(body, kind)
+		if err != nil {
+			return err
+		}
+		return t.rangeFilter(field, value)
+	case "exists":
+		var params struct {
+			Field string `json:"field"`
+		}
+		if err := json.Unmarshal(body, &params); err != nil || params.Field == "" {
+			return parsingError("[exists] requires a field")
+		}
+		return t.filter(params.Field, filter.OpExists, true)
+	default:
+		return illegalArgument("[%s] queries are not supported", kind)
+	}
+	return nil
+}
+
+func isTextQuery(kind string) bool {
+	switch kind {
+	case "match", "match_phrase", "match_phrase_prefix", "match_bool_prefix", "multi_match", "query_string", "simple_query_string", "match_all":
+		return true
+	}
+	return false
+}
+
+func (t *translator) boolQuery(body json.RawMessage, should bool) error {
+	var clauses map[string]json.RawMessage
+	if err := json.Unmarshal(body, &clauses); err != nil {
+		return parsingError("[bool] %v", err)
+	}
+	for _, occur := range []string{"must", "filter", "should", "must_not"} {
+		queries, err := list(clauses[occur])
+		if err != nil {
+			return parsingError("[bool] %s %v", occur, err)
+		}
+		for _, query := range queries {
+			switch {
+			case occur == "must_not":
+				if err := t.mustNot(query); err != nil {
+					return err
+				}
+			case occur == "should" || should:
+				if err := t.query(query, true); err != nil {
+					return err
+				}
+			default:
+				if err := t.query(query, false); err != nil {
+					return err
+				}
+			}
+		}
+		delete(clauses, occur)
+	}
+	delete(clauses, "boost")
+	delete(clauses, "minimum_should_match")
+	delete(clauses, "_name")
+	for key := range clauses {
+		return parsingError("[bool] does not support [%s]", key)
+	}
+	return nil
+}
+
+// mustNot translates a must_not clause; only exists can be negated
+func (t *translator) mustNot(raw json.RawMessage) error {
+	kind, body, err := single(raw, "query")
+	if err != nil {
+		return err
+	}
+	if kind != "exists" {
+		return illegalArgument("only [exists] queries can be negated in must_not")
+	}
+	var params struct {
+		Field string `json:"field"`
+	}
+	if err := json.Unmarshal(body, &params); err != nil || params.Field == "" {
+		return parsingError("[exists] requires a field")
+	}
+	return t.filter(params.Field, filter.OpExists, false)
+}
+
+func (t *translator) rangeFilter(field string, raw json.RawMessage) error {
+	var bounds map[string]interface{}
+	if err := json.Unmarshal(raw, &bounds); err != nil {
+		return parsingError("[range] %v", err)
+	}
+	format, _ := bounds["format"].(string)
+	delete(bounds, "format")
+	delete(bounds, "boost")
+	name := fieldName(field)
+	for op, value := range bounds {
+		if op != "gt" && op != "gte" && op != "lt" && op != "lte" {
+			return parsingError("[range] does not support [%s]", op)
+		}
+		// Dates in epoch milliseconds, as Kibana-style UIs send them
+		if millis, ok := value.(float64); ok && filter.Fields[name] == filter.KindTime {
+			if format != "" && !strings.Contains(format, "epoch_millis") {
+				return illegalArgument("[range] %s must be a date string for format %s", field, format)
+			}
+			bounds[op] = time.UnixMilli(int64(millis)).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return t.filter(field, filter.OpRange, bounds)
+}
+
+// filter records a condition on a field; a field takes one condition
+func (t *translator) filter(field, op string, value interface{}) error {
+	name := fieldName(field)
+	if mediaTypeFields[name] {
+		switch v := value.(type) {
+		case string:
+			t.mediaTypes = append(t.mediaTypes, v)
+			return nil
+		case []interface{}:
+			for _, item := range v {
+				mediaType, ok := item.(string)
+				if !ok {
+					return illegalArgument("[%s] values must be strings", field)
+				}
+				t.mediaTypes = append(t.mediaTypes, mediaType)
+			}
+			return nil
+		}
+		return illegalArgument("[%s] only supports term and terms queries", field)
+	}
+	if _, ok := filter.Fields[name]; !ok {
+		return illegalArgument("field [%s] cannot be filtered; filterable fields are %s", field, strings.Join(filter.FieldNames(), ", "))
+	}
+	if _, ok := t.filters[name]; ok {
+		return illegalArgument("field [%s] has more than one condition", field)
+	}
+	t.filters[name] = map[string]interface{}{op: value}
+	return nil
+}
+
+// fieldName maps a field as indexed in Elasticsearch to a DataFlux filter
+// field: metadata.mime_type and mime_type.keyword are both mime_type
+func fieldName(field string) string {
+	field = strings.TrimPrefix(field, "metadata.")
+	return strings.TrimSuffix(field, ".keyword")
+}
+
+func (t *translator) addText(text string) {
+	if text = strings.TrimSpace(text); text != "" {
+		t.text = append(t.text, text)
+	}
+}
+
+func (t *translator) addPhrase(text string) {
+	if text = strings.TrimSpace(strings.ReplaceAll(text, `"`, " ")); text != "" {
+		t.text = append(t.text, `"`+text+`"`)
+	}
+}
+
+func (s *Search) source(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var enabled bool
+	if json.Unmarshal(raw, &enabled) == nil {
+		s.NoSource = !enabled
+		return nil
+	}
+	var field string
+	if json.Unmarshal(raw, &field) == nil {
+		s.Fields = []string{field}
+		return nil
+	}
+	if json.Unmarshal(raw, &s.Fields) == nil {
+		return nil
+	}
+	var filtering struct {
+		Includes []string `json:"includes"`
+		Excludes []string `json:"excludes"`
+	}
+	if err := json.Unmarshal(raw, &filtering); err != nil {
+		return parsingError("[_source] must be a boolean, a field list or an object of includes")
+	}
+	if len(filtering.Excludes) > 0 {
+		return illegalArgument("[_source] excludes are not supported")
+	}
+	s.Fields = filtering.Includes
+	return nil
+}
+
+// sourceParam converts the _source URI parameter to its body form
+func sourceParam(value string) json.RawMessage {
+	if value == "true" || value == "false" {
+		return json.RawMessage(value)
+	}
+	fields, _ := json.Marshal(strings.Split(value, ","))
+	return fields
+}
+
+// trackTotalHits maps true to an exact count and a threshold to an estimate
+func (s *Search) trackTotalHits(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var enabled bool
+	if json.Unmarshal(raw, &enabled) == nil {
+		if enabled {
+			s.TrackTotalHits = "exact"
+		} else {
+			s.NoTotal = true
+		}
+		return nil
+	}
+	var threshold int
+	if err := json.Unmarshal(raw, &threshold); err != nil {
+		return parsingError("[track_total_hits] must be a boolean or an integer")
+	}
+	s.TrackTotalHits = "estimate"
+	return nil
+}
+
+// sortByScore accepts the sorts DataFlux can honour: by descending score
+func sortByScore(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	sorts, err := list(raw)
+	if err != nil {
+		var field string
+		if json.Unmarshal(raw, &field) == nil && field == "_score" {
+			return nil
+		}
+		return parsingError("[sort] %v", err)
+	}
+	for _, sortClause := range sorts {
+		var field string
+		if json.Unmarshal(sortClause, &field) == nil && field == "_score" {
+			continue
+		}
+		var object map[string]json.RawMessage
+		if json.Unmarshal(sortClause, &object) == nil && len(object) == 1 && object["_score"] != nil {
+			var order struct {
+				Order string `json:"order"`
+			}
+			var direction string
+			if json.Unmarshal(object["_score"], &direction) != nil {
+				json.Unmarshal(object["_score"], &order)
+				direction = order.Order
+			}
+			if direction == "" || direction == "desc" {
+				continue
+			}
+		}
+		return illegalArgument("only sorting by descending _score is supported")
+	}
+	return nil
+}
+
+// single decodes an object with exactly one key, ignoring boost and _name
+func single(raw json.RawMessage, context string) (string, json.RawMessage, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return "", nil, parsingError("[%s] must be an object", context)
+	}
+	delete(object, "boost")
+	delete(object, "_name")
+	if len(object) != 1 {
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return "", nil, parsingError("[%s] must have exactly one key, got %v", context, keys)
+	}
+	for key, value := range object {
+		return key, value, nil
+	}
+	return "", nil, nil
+}
+
+// stringOrField reads a value given either bare or as {"<field>": value}
+func stringOrField(raw json.RawMessage, field string) (string, error) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text, nil
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return "", fmt.Errorf("must be a string or an object")
+	}
+	text, ok := object[field].(string)
+	if !ok {
+		return "", fmt.Errorf("requires a string %s", field)
+	}
+	return text, nil
+}
+
+// list reads a clause list, which may also be a single clause
+func list(raw json.RawMessage) ([]json.RawMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '{' {
+		return []json.RawMessage{raw}, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("must be an object or an array")
+	}
+	return items, nil
+}
@@ -0,0 +1,89 @@
+package esquery
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/filter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslate(t *testing.T) {
+	search, err := Translate([]byte(`{
+		"from": 20,
+		"size": 5,
+		"_source": {"includes": ["filename", "tags"]},
+		"track_total_hits": true,
+		"sort": [{"_score": {"order": "desc"}}],
+		"highlight": {"fields": {"*": {}}},
+		"query": {"bool": {
+			"must": [
+				{"match": {"content": {"query": "sunset beach", "operator": "and"}}},
+				{"match_phrase": {"title": "golden \"hour\""}}
+			],
+			"should": {"multi_match": {"query": "harbour", "fields": ["*"]}},
+			"filter": [
+				{"term": {"metadata.mime_type.keyword": {"value": "image/jpeg"}}},
+				{"terms": {"media_type": ["image", "video"]}},
+				{"range": {"created_at": {"gte": 1772323200000, "lt": 1772409600000, "format": "epoch_millis"}}}
+			],
+			"must_not": [{"exists": {"field": "duration"}}]
+		}}
+	}`), url.Values{})
+	require.NoError(t, err)
+
+	assert.Equal(t, `sunset beach "golden  hour" harbour`, search.Text)
+	assert.Equal(t, []string{"image", "video"}, search.MediaTypes)
+	assert.Equal(t, 20, search.From)
+	assert.Equal(t, 5, search.Size)
+	assert.Equal(t, []string{"filename", "tags"}, search.Fields)
+	assert.Equal(t, "exact", search.TrackTotalHits)
+
+	assert.Equal(t, []interface{}{"image/jpeg"}, search.Filters[filter.FieldMimeType].Values)
+	assert.Equal(t, false, search.Filters[filter.FieldDuration].Exists)
+	created := search.Filters[filter.FieldCreatedAt].Range
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), created.Gte)
+	assert.Equal(t, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), created.Lt)
+}
+
+func TestTranslateURIParameters(t *testing.T) {
+	search, err := Translate(nil, url.Values{"q": {"beach"}, "size": {"3"}, "_source": {"false"}, "track_total_hits": {"false"}})
+	require.NoError(t, err)
+	assert.Equal(t, Search{Text: "beach", Size: 3, NoSource: true, NoTotal: true}, search)
+
+	search, err = Translate([]byte(`{"query": {"query_string": {"query": "repor* AND beach"}}}`), url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, "repor* AND beach", search.Text)
+	assert.Equal(t, DefaultSize, search.Size)
+}
+
+func TestTranslateRejectsUnsupported(t *testing.T) {
+	for name, body := range map[string]string{
+		"aggregations":       `{"query": {"match": {"f": "beach"}}, "aggs": {"types": {"terms": {"field": "mime_type"}}}}`,
+		"no text":            `{"query": {"match_all": {}}}`,
+		"unknown query":      `{"query": {"fuzzy": {"f": "beach"}}}`,
+		"should filter":      `{"query": {"bool": {"must": {"match": {"f": "beach"}}, "should": [{"term": {"mime_type": "image/png"}}]}}}`,
+		"negated term":       `{"query": {"bool": {"must": {"match": {"f": "beach"}}, "must_not": {"term": {"mime_type": "image/png"}}}}}`,
+		"unfilterable field": `{"query": {"bool": {"must": {"match": {"f": "beach"}}, "filter": {"term": {"owner": "ann"}}}}}`,
+		"two conditions":     `{"query": {"bool": {"must": {"match": {"f": "beach"}}, "filter": [{"term": {"mime_type": "a"}}, {"prefix": {"mime_type": "b"}}]}}}`,
+		"sort by field":      `{"query": {"match": {"f": "beach"}}, "sort": [{"created_at": "desc"}]}`,
+		"two query types":    `{"query": {"match": {"f": "beach"}, "term": {"mime_type": "a"}}}`,
+		"negative size":      `{"query": {"match": {"f": "beach"}}, "size": -1}`,
+		"invalid filter":     `{"query": {"bool": {"must": {"match": {"f": "beach"}}, "filter": {"range": {"file_size": {"gte": "big"}}}}}}`,
+	} {
+		_, err := Translate([]byte(body), url.Values{})
+		var translation *Error
+		assert.True(t, errors.As(err, &translation), name)
+	}
+}
+
+func TestNewErrorBody(t *testing.T) {
+	_, err := Translate([]byte(`{"query": {"match_all": {}}}`), url.Values{})
+	body := NewErrorBody(400, err, "exception")
+	assert.Equal(t, IllegalArgumentException, body.Error.Type)
+	assert.Equal(t, "exception", NewErrorBody(502, errors.New("down"), "exception").Error.Type)
+}
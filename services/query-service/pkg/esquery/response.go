@@ -0,0 +1,100 @@
+package esquery
+
+import "errors"
+
+// Version is the OpenSearch version the compatibility endpoints report,
+// which clients check before sending searches
+const Version = "2.11.0"
+
+// Info is the body of the root endpoint
+type Info struct {
+	Name        string      `json:"name"`
+	ClusterName string      `json:"cluster_name"`
+	Version     InfoVersion `json:"version"`
+	Tagline     string      `json:"tagline"`
+}
+
+// InfoVersion is the version part of Info
+type InfoVersion struct {
+	Distribution string `json:"distribution"`
+	Number       string `json:"number"`
+	// LuceneVersion is reported because some clients require it
+	LuceneVersion string `json:"lucene_version"`
+}
+
+// NewInfo describes the service as an OpenSearch cluster
+func NewInfo(name string) Info {
+	return Info{
+		Name:        name,
+		ClusterName: "dataflux",
+		Version:     InfoVersion{Distribution: "opensearch", Number: Version, LuceneVersion: "9.7.0"},
+		Tagline:     "The OpenSearch Project: https://opensearch.org/",
+	}
+}
+
+// Response is a search response
+type Response struct {
+	Took     int64  `json:"took"`
+	TimedOut bool   `json:"timed_out"`
+	Shards   Shards `json:"_shards"`
+	Hits     Hits   `json:"hits"`
+}
+
+// Shards reports the DataFlux backends a search ran on as shards
+type Shards struct {
+	Total      int `json:"total"`
+	Successful int `json:"successful"`
+	Skipped    int `json:"skipped"`
+	Failed     int `json:"failed"`
+}
+
+// Hits holds the page of hits and, unless disabled, their total
+type Hits struct {
+	Total    *Total   `json:"total,omitempty"`
+	MaxScore *float64 `json:"max_score"`
+	Hits     []Hit    `json:"hits"`
+}
+
+// Total is the number of matching documents; Relation is eq or gte
+type Total struct {
+	Value    int64  `json:"value"`
+	Relation string `json:"relation"`
+}
+
+// Hit is a search result; _source holds the asset's metadata
+type Hit struct {
+	Index     string                 `json:"_index"`
+	ID        string                 `json:"_id"`
+	Score     float64                `json:"_score"`
+	Source    map[string]interface{} `json:"_source,omitempty"`
+	Highlight map[string][]string    `json:"highlight,omitempty"`
+}
+
+// CountResponse is the body of _count
+type CountResponse struct {
+	Count  int64  `json:"count"`
+	Shards Shards `json:"_shards"`
+}
+
+// ErrorBody is an error in Elasticsearch's format
+type ErrorBody struct {
+	Error  ErrorCause `json:"error"`
+	Status int        `json:"status"`
+}
+
+// ErrorCause describes an error
+type ErrorCause struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// NewErrorBody reports err with the given status; errors from Translate
+// keep their type
+func NewErrorBody(status int, err error, fallbackType string) ErrorBody {
+	cause := ErrorCause{Type: fallbackType, Reason: err.Error()}
+	var translation *Error
+	if errors.As(err, &translation) {
+		cause.Type = translation.Type
+	}
+	return ErrorBody{Error: cause, Status: status}
+}
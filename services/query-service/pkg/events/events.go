@@ -0,0 +1,250 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Lifecycle event types emitted by the query service
+const (
+	TypeIndexSynced      = "index_synced"
+	TypeReindexCompleted = "reindex_completed"
+	TypeBackendDegraded  = "backend_degraded"
+	TypeExportReady      = "export_ready"
+	TypeReanalysisDone   = "reanalysis_done"
+)
+
+// Header names used on webhook deliveries
+const (
+	SignatureHeader = "X-DataFlux-Signature"
+	EventHeader     = "X-DataFlux-Event"
+	DeliveryHeader  = "X-DataFlux-Delivery"
+)
+
+// Event is a lifecycle notification for other DataFlux services
+type Event struct {
+	ID     string                 `json:"id"`
+	Type   string                 `json:"type"`
+	Source string                 `json:"source"`
+	Time   time.Time              `json:"time"`
+	Data   map[string]interface{} `json:"data"`
+}
+
+// Sink delivers encoded events to one destination
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, event Event, payload []byte) error
+}
+
+// Sign computes the webhook signature header value for a payload
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header against the payload and rejects
+// signatures older than tolerance
+func Verify(secret, header string, payload []byte, tolerance time.Duration, now time.Time) error {
+	var ts, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || signature == "" {
+		return fmt.Errorf("malformed signature header")
+	}
+	timestamp := time.Unix(unix, 0)
+	if now.Sub(timestamp) > tolerance || timestamp.Sub(now) > tolerance {
+		return fmt.Errorf("signature timestamp outside tolerance")
+	}
+
+	expected := Sign(secret, timestamp, payload)
+	if !hmac.Equal([]byte(expected), []byte("t="+ts+",v1="+signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// WebhookSink POSTs HMAC-signed events to an HTTP endpoint
+type WebhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookSink creates a webhook sink
+func NewWebhookSink(url, secret string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{url: url, secret: secret, client: &http.Client{Timeout: timeout}}
+}
+
+// Name identifies the sink in logs
+func (w *WebhookSink) Name() string {
+	return "webhook " + w.url
+}
+
+// Deliver sends the event and treats any non-2xx response as a failure
+func (w *WebhookSink) Deliver(ctx context.Context, event Event, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, event.ID)
+	req.Header.Set(SignatureHeader, Sign(w.secret, time.Now(), payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver event: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// StreamSink appends events to a Redis stream that other services consume
+type StreamSink struct {
+	redis  *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewStreamSink creates an event bus sink writing to stream
+func NewStreamSink(redisClient *redis.Client, stream string, maxLen int64) *StreamSink {
+	return &StreamSink{redis: redisClient, stream: stream, maxLen: maxLen}
+}
+
+// Name identifies the sink in logs
+func (s *StreamSink) Name() string {
+	return "stream " + s.stream
+}
+
+// Deliver adds the event to the stream, trimming it to roughly maxLen entries
+func (s *StreamSink) Deliver(ctx context.Context, event Event, payload []byte) error {
+	return s.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"id":      event.ID,
+			"type":    event.Type,
+			"payload": payload,
+		},
+	}).Err()
+}
+
+// Emitter queues events and delivers them to every sink with retries
+type Emitter struct {
+	source      string
+	sinks       []Sink
+	queue       chan Event
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewEmitter creates an emitter; events beyond queueSize pending ones are dropped
+func NewEmitter(source string, queueSize int, sinks ...Sink) *Emitter {
+	return &Emitter{
+		source:      source,
+		sinks:       sinks,
+		queue:       make(chan Event, queueSize),
+		maxAttempts: 5,
+		backoff:     500 * time.Millisecond,
+	}
+}
+
+// Start delivers queued events until ctx is cancelled
+func (e *Emitter) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-e.queue:
+				e.deliver(ctx, event)
+			}
+		}
+	}()
+}
+
+// Emit queues an event without blocking the caller
+func (e *Emitter) Emit(eventType string, data map[string]interface{}) {
+	if e == nil || len(e.sinks) == 0 {
+		return
+	}
+
+	event := Event{
+		ID:     newEventID(),
+		Type:   eventType,
+		Source: e.source,
+		Time:   time.Now().UTC(),
+		Data:   data,
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		log.Printf("Warning: event queue full, dropping %s event %s", event.Type, event.ID)
+	}
+}
+
+func (e *Emitter) deliver(ctx context.Context, event Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Warning: failed to encode %s event: %v", event.Type, err)
+		return
+	}
+
+	for _, sink := range e.sinks {
+		backoff := e.backoff
+		for attempt := 1; ; attempt++ {
+			err := sink.Deliver(ctx, event, payload)
+			if err == nil {
+				break
+			}
+			if attempt >= e.maxAttempts || ctx.Err() != nil {
+				log.Printf("Warning: giving up on %s event %s for %s: %v", event.Type, event.ID, sink.Name(), err)
+				break
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+}
+
+func newEventID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := []byte(`{"type":"index_synced"}`)
+	header := Sign("secret", now, payload)
+
+	assert.NoError(t, Verify("secret", header, payload, time.Minute, now.Add(30*time.Second)))
+	assert.Error(t, Verify("other", header, payload, time.Minute, now))
+	assert.Error(t, Verify("secret", header, []byte(`{}`), time.Minute, now))
+	assert.Error(t, Verify("secret", header, payload, time.Minute, now.Add(2*time.Minute)))
+	assert.Error(t, Verify("secret", "garbage", payload, time.Minute, now))
+}
+
+func TestEmitterRetriesSignedWebhookDeliveries(t *testing.T) {
+	var attempts int32
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, Verify("secret", r.Header.Get(SignatureHeader), body, time.Minute, time.Now()))
+
+		var event Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, event.Type, r.Header.Get(EventHeader))
+		received <- event
+	}))
+	defer server.Close()
+
+	emitter := NewEmitter("query-service", 10, NewWebhookSink(server.URL, "secret", time.Second))
+	emitter.backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	emitter.Start(ctx)
+
+	emitter.Emit(TypeBackendDegraded, map[string]interface{}{"backend": "postgres"})
+
+	select {
+	case event := <-received:
+		assert.Equal(t, TypeBackendDegraded, event.Type)
+		assert.Equal(t, "query-service", event.Source)
+		assert.Equal(t, "postgres", event.Data["backend"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
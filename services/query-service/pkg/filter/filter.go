@@ -0,0 +1,456 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operators a condition can apply
+const (
+	OpEq     = "eq"
+	OpIn     = "in"
+	OpRange  = "range"
+	OpExists = "exists"
+	OpPrefix = "prefix"
+)
+
+// Kind is the value type of a filterable field
+type Kind int
+
+const (
+	KindString Kind = iota
+	// KindStringList fields hold several strings and match when any does
+	KindStringList
+	KindNumber
+	KindTime
+)
+
+// Filterable fields
+const (
+	FieldMimeType     = "mime_type"
+	FieldCollectionID = "collection_id"
+	FieldTags         = "tags"
+	FieldFileSize     = "file_size"
+	FieldDuration     = "duration"
+	FieldCreatedAt    = "created_at"
+	// FieldAvailability is the storage tier of an asset's media: online,
+	// nearline or archived
+	FieldAvailability = "availability"
+)
+
+// Fields maps the filterable fields to their kinds
+var Fields = map[string]Kind{
+	FieldMimeType:     KindString,
+	FieldCollectionID: KindString,
+	FieldTags:         KindStringList,
+	FieldFileSize:     KindNumber,
+	FieldDuration:     KindNumber,
+	FieldCreatedAt:    KindTime,
+	FieldAvailability: KindString,
+}
+
+// MaxValues bounds the values of one in condition
+const MaxValues = 100
+
+// Range bounds a number or timestamp; unset bounds are open
+type Range struct {
+	Gt  interface{} `json:"gt,omitempty"`
+	Gte interface{} `json:"gte,omitempty"`
+	Lt  interface{} `json:"lt,omitempty"`
+	Lte interface{} `json:"lte,omitempty"`
+}
+
+// Condition applies one operator to a field. Once validated, values and
+// range bounds are strings, float64 or time.Time according to the field kind.
+type Condition struct {
+	Op     string
+	Values []interface{}
+	Range  Range
+	Exists bool
+}
+
+// Clause is a condition on a named field
+type Clause struct {
+	Field string
+	Kind  Kind
+	Condition
+}
+
+// Set holds the filters of a request keyed by field. Clients send each
+// field as {"<operator>": value}; a bare value is shorthand for eq and a
+// bare list for in.
+type Set map[string]Condition
+
+// Error reports an invalid filter
+type Error struct {
+	Field   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid filter %s: %s", e.Field, e.Message)
+}
+
+// legacyDateBounds are the date filters accepted before created_at ranges
+var legacyDateBounds = map[string]string{
+	"date_from": "gte",
+	"date_to":   "lt",
+}
+
+// UnmarshalJSON decodes and validates the filters
+func (s *Set) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	set := Set{}
+	dates := map[string]json.RawMessage{}
+	for field, value := range raw {
+		if bound, ok := legacyDateBounds[field]; ok {
+			dates[bound] = value
+			continue
+		}
+		if field == "collection_ids" {
+			field = FieldCollectionID
+		}
+		if _, ok := set[field]; ok {
+			return &Error{Field: field, Message: "is given more than once"}
+		}
+
+		var condition Condition
+		if err := decodeCondition(value, &condition); err != nil {
+			return &Error{Field: field, Message: err.Error()}
+		}
+		set[field] = condition
+	}
+
+	if len(dates) > 0 {
+		if _, ok := set[FieldCreatedAt]; ok {
+			return &Error{Field: FieldCreatedAt, Message: "cannot be combined with date_from or date_to"}
+		}
+		bounds, _ := json.Marshal(dates)
+		condition := Condition{Op: OpRange}
+		if err := decode(bounds, &condition.Range); err != nil {
+			return &Error{Field: FieldCreatedAt, Message: err.Error()}
+		}
+		set[FieldCreatedAt] = condition
+	}
+
+	if err := set.Validate(); err != nil {
+		return err
+	}
+	*s = set
+	return nil
+}
+
+// MarshalJSON writes the condition in its explicit operator form. In values
+// are sorted so equal sets encode identically.
+func (c Condition) MarshalJSON() ([]byte, error) {
+	switch c.Op {
+	case OpEq, OpPrefix:
+		if len(c.Values) == 1 {
+			return json.Marshal(map[string]interface{}{c.Op: c.Values[0]})
+		}
+	case OpIn:
+		values := append([]interface{}(nil), c.Values...)
+		sort.SliceStable(values, func(i, j int) bool {
+			return fmt.Sprint(values[i]) < fmt.Sprint(values[j])
+		})
+		return json.Marshal(map[string]interface{}{c.Op: values})
+	case OpRange:
+		return json.Marshal(map[string]interface{}{c.Op: c.Range})
+	case OpExists:
+		return json.Marshal(map[string]interface{}{c.Op: c.Exists})
+	}
+	return nil, fmt.Errorf("invalid %q condition", c.Op)
+}
+
+// String is the canonical JSON form, stable enough for cache keys
+func (s Set) String() string {
+	data, err := json.Marshal(map[string]Condition(s))
+	if err != nil {
+		return fmt.Sprintf("invalid filters: %v", err)
+	}
+	return string(data)
+}
+
+// FromMap builds a validated set from a decoded JSON object, as received
+// from the gRPC and GraphQL APIs
+func FromMap(filters map[string]interface{}) (Set, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return nil, err
+	}
+	var set Set
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Validate checks every condition against its field's kind and normalizes
+// values in place
+func (s Set) Validate() error {
+	for field, condition := range s {
+		kind, ok := Fields[field]
+		if !ok {
+			return &Error{Field: field, Message: "unknown field, expected one of " + strings.Join(FieldNames(), ", ")}
+		}
+		if err := condition.normalize(kind); err != nil {
+			return &Error{Field: field, Message: err.Error()}
+		}
+		s[field] = condition
+	}
+	return nil
+}
+
+// Clauses returns the conditions ordered by field
+func (s Set) Clauses() []Clause {
+	clauses := make([]Clause, 0, len(s))
+	for _, field := range sortedKeys(s) {
+		clauses = append(clauses, Clause{Field: field, Kind: Fields[field], Condition: s[field]})
+	}
+	return clauses
+}
+
+// Strings returns the values of an eq or in condition on a string field
+func (s Set) Strings(field string) []string {
+	condition, ok := s[field]
+	if !ok || (condition.Op != OpEq && condition.Op != OpIn) {
+		return nil
+	}
+	values := make([]string, 0, len(condition.Values))
+	for _, value := range condition.Values {
+		if str, ok := value.(string); ok {
+			values = append(values, str)
+		}
+	}
+	return values
+}
+
+// SetIn replaces the field's condition with an in condition
+func (s Set) SetIn(field string, values []string) {
+	condition := Condition{Op: OpIn, Values: make([]interface{}, len(values))}
+	for i, value := range values {
+		condition.Values[i] = value
+	}
+	s[field] = condition
+}
+
+// Restrict returns a copy of the set whose condition on a string field only
+// admits the allowed values, keeping those the existing condition matched.
+// It reports false when none of them did, so the request can match nothing.
+func (s Set) Restrict(field string, allowed []string) (Set, bool) {
+	restricted := make(Set, len(s)+1)
+	for name, condition := range s {
+		restricted[name] = condition
+	}
+
+	condition, filtered := s[field]
+	var values []string
+	for _, value := range allowed {
+		if !filtered || condition.admits(value) {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return restricted, false
+	}
+	restricted.SetIn(field, values)
+	return restricted, true
+}
+
+// admits reports whether a validated condition on a string field matches value
+func (c Condition) admits(value string) bool {
+	switch c.Op {
+	case OpEq, OpIn:
+		for _, candidate := range c.Values {
+			if candidate == value {
+				return true
+			}
+		}
+	case OpPrefix:
+		prefix, _ := c.Values[0].(string)
+		return strings.HasPrefix(value, prefix)
+	case OpExists:
+		return c.Exists
+	}
+	return false
+}
+
+// FieldNames lists the filterable fields alphabetically
+func FieldNames() []string {
+	names := make([]string, 0, len(Fields))
+	for field := range Fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func decodeCondition(data []byte, condition *Condition) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return fmt.Errorf("value is required")
+	case bytes.HasPrefix(data, []byte("[")):
+		condition.Op = OpIn
+		return decode(data, &condition.Values)
+	case !bytes.HasPrefix(data, []byte("{")):
+		condition.Op = OpEq
+		var value interface{}
+		err := decode(data, &value)
+		condition.Values = []interface{}{value}
+		return err
+	}
+
+	var operators map[string]json.RawMessage
+	if err := json.Unmarshal(data, &operators); err != nil {
+		return err
+	}
+	if len(operators) != 1 {
+		return fmt.Errorf("exactly one operator is required")
+	}
+	for op, value := range operators {
+		condition.Op = op
+		switch op {
+		case OpEq, OpPrefix:
+			var v interface{}
+			if err := decode(value, &v); err != nil {
+				return err
+			}
+			condition.Values = []interface{}{v}
+		case OpIn:
+			return decode(value, &condition.Values)
+		case OpRange:
+			return decode(value, &condition.Range)
+		case OpExists:
+			return json.Unmarshal(value, &condition.Exists)
+		default:
+			return fmt.Errorf("unknown operator %q", op)
+		}
+	}
+	return nil
+}
+
+// decode keeps numbers as json.Number so integers survive exactly
+func decode(data []byte, target interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
+
+func (c *Condition) normalize(kind Kind) error {
+	switch c.Op {
+	case OpEq:
+		if len(c.Values) != 1 {
+			return fmt.Errorf("eq takes one value")
+		}
+	case OpIn:
+		if len(c.Values) == 0 || len(c.Values) > MaxValues {
+			return fmt.Errorf("in takes between 1 and %d values", MaxValues)
+		}
+	case OpPrefix:
+		if kind != KindString && kind != KindStringList {
+			return fmt.Errorf("prefix applies to text fields only")
+		}
+		if len(c.Values) != 1 {
+			return fmt.Errorf("prefix takes one value")
+		}
+		if str, ok := c.Values[0].(string); !ok || str == "" {
+			return fmt.Errorf("prefix must be a non-empty string")
+		}
+		return nil
+	case OpRange:
+		if kind != KindNumber && kind != KindTime {
+			return fmt.Errorf("range applies to number and date fields only")
+		}
+		return c.Range.normalize(kind)
+	case OpExists:
+		return nil
+	default:
+		return fmt.Errorf("unknown operator %q", c.Op)
+	}
+
+	for i, value := range c.Values {
+		normalized, err := normalizeValue(kind, value)
+		if err != nil {
+			return err
+		}
+		c.Values[i] = normalized
+	}
+	return nil
+}
+
+func (r *Range) normalize(kind Kind) error {
+	if r.Gt == nil && r.Gte == nil && r.Lt == nil && r.Lte == nil {
+		return fmt.Errorf("range needs at least one of gt, gte, lt or lte")
+	}
+	if (r.Gt != nil && r.Gte != nil) || (r.Lt != nil && r.Lte != nil) {
+		return fmt.Errorf("range takes one lower and one upper bound")
+	}
+	for _, bound := range []*interface{}{&r.Gt, &r.Gte, &r.Lt, &r.Lte} {
+		if *bound == nil {
+			continue
+		}
+		normalized, err := normalizeValue(kind, *bound)
+		if err != nil {
+			return err
+		}
+		*bound = normalized
+	}
+	return nil
+}
+
+func normalizeValue(kind Kind, value interface{}) (interface{}, error) {
+	switch kind {
+	case KindNumber:
+		switch v := value.(type) {
+		case json.Number:
+			return v.Float64()
+		case float64:
+			return v, nil
+		}
+		return nil, fmt.Errorf("%v is not a number", value)
+	case KindTime:
+		switch v := value.(type) {
+		case string:
+			return ParseTime(v)
+		case time.Time:
+			return v, nil
+		}
+		return nil, fmt.Errorf("%v is not a date", value)
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	return nil, fmt.Errorf("%v is not a string", value)
+}
+
+// ParseTime accepts RFC 3339 timestamps or plain YYYY-MM-DD dates
+func ParseTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not an RFC 3339 timestamp or YYYY-MM-DD date", value)
+}
+
+func sortedKeys(s Set) []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
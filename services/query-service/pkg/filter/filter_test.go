@@ -0,0 +1,117 @@
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalOperatorsAndShorthands(t *testing.T) {
+	var set Set
+	err := json.Unmarshal([]byte(`{
+		"mime_type": "image/png",
+		"tags": ["beach", "sunset"],
+		"file_size": {"range": {"gte": 1024}},
+		"duration": {"exists": true},
+		"collection_id": {"prefix": "c-"}
+	}`), &set)
+	require.NoError(t, err)
+
+	assert.Equal(t, Condition{Op: OpEq, Values: []interface{}{"image/png"}}, set[FieldMimeType])
+	assert.Equal(t, []string{"beach", "sunset"}, set.Strings(FieldTags))
+	assert.Equal(t, 1024.0, set[FieldFileSize].Range.Gte)
+	assert.True(t, set[FieldDuration].Exists)
+	assert.Equal(t, OpPrefix, set[FieldCollectionID].Op)
+
+	var fields []string
+	for _, clause := range set.Clauses() {
+		fields = append(fields, clause.Field)
+	}
+	assert.Equal(t, []string{"collection_id", "duration", "file_size", "mime_type", "tags"}, fields)
+}
+
+func TestUnmarshalLegacyKeys(t *testing.T) {
+	var set Set
+	err := json.Unmarshal([]byte(`{"date_from": "2024-01-01", "date_to": "2024-02-01T00:00:00Z", "collection_ids": ["c1"]}`), &set)
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), set[FieldCreatedAt].Range.Gte)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), set[FieldCreatedAt].Range.Lt)
+	assert.Equal(t, []string{"c1"}, set.Strings(FieldCollectionID))
+}
+
+func TestUnmarshalRejectsInvalidFilters(t *testing.T) {
+	cases := map[string]string{
+		"unknown field":      `{"color": "red"}`,
+		"unknown operator":   `{"mime_type": {"like": "image"}}`,
+		"two operators":      `{"mime_type": {"eq": "a", "prefix": "b"}}`,
+		"range on text":      `{"mime_type": {"range": {"gte": "a"}}}`,
+		"prefix on number":   `{"file_size": {"prefix": "1"}}`,
+		"string for number":  `{"file_size": "large"}`,
+		"invalid date":       `{"created_at": {"range": {"gte": "yesterday"}}}`,
+		"empty range":        `{"duration": {"range": {}}}`,
+		"unknown bound":      `{"duration": {"range": {"from": 1}}}`,
+		"two lower bounds":   `{"duration": {"range": {"gt": 1, "gte": 2}}}`,
+		"empty in":           `{"tags": {"in": []}}`,
+		"null value":         `{"tags": null}`,
+		"legacy and typed":   `{"date_from": "2024-01-01", "created_at": {"exists": true}}`,
+		"empty prefix":       `{"tags": {"prefix": ""}}`,
+		"non-boolean exists": `{"tags": {"exists": "yes"}}`,
+	}
+	for name, body := range cases {
+		var set Set
+		assert.Error(t, json.Unmarshal([]byte(body), &set), name)
+	}
+}
+
+func TestStringIsCanonical(t *testing.T) {
+	a, err := FromMap(map[string]interface{}{"tags": "beach", "file_size": map[string]interface{}{"range": map[string]interface{}{"lt": 10}}})
+	require.NoError(t, err)
+	b, err := FromMap(map[string]interface{}{"file_size": map[string]interface{}{"range": map[string]interface{}{"lt": 10.0}}, "tags": map[string]interface{}{"eq": "beach"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"file_size":{"range":{"lt":10}},"tags":{"eq":"beach"}}`, a.String())
+	assert.Equal(t, a.String(), b.String())
+
+	c, err := FromMap(map[string]interface{}{"tags": []interface{}{"b", "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"tags":{"in":["a","b"]}}`, c.String())
+}
+
+func TestSetIn(t *testing.T) {
+	set := Set{}
+	set.SetIn(FieldTags, []string{"a", "b"})
+
+	assert.Equal(t, []string{"a", "b"}, set.Strings(FieldTags))
+	assert.NoError(t, set.Validate())
+}
+
+func TestRestrict(t *testing.T) {
+	var none Set
+	restricted, ok := none.Restrict(FieldCollectionID, []string{"c1", "c2"})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"c1", "c2"}, restricted.Strings(FieldCollectionID))
+
+	var set Set
+	require.NoError(t, json.Unmarshal([]byte(`{"collection_id": ["c2", "c3"], "mime_type": "video/mp4"}`), &set))
+	restricted, ok = set.Restrict(FieldCollectionID, []string{"c1", "c2"})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"c2"}, restricted.Strings(FieldCollectionID))
+	assert.Equal(t, []string{"video/mp4"}, restricted.Strings(FieldMimeType))
+	// The original set is left alone
+	assert.Equal(t, []string{"c2", "c3"}, set.Strings(FieldCollectionID))
+
+	require.NoError(t, json.Unmarshal([]byte(`{"collection_id": {"prefix": "press-"}}`), &set))
+	restricted, ok = set.Restrict(FieldCollectionID, []string{"press-eu", "archive"})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"press-eu"}, restricted.Strings(FieldCollectionID))
+
+	require.NoError(t, json.Unmarshal([]byte(`{"collection_id": "c9"}`), &set))
+	_, ok = set.Restrict(FieldCollectionID, []string{"c1"})
+	assert.False(t, ok)
+	_, ok = Set{}.Restrict(FieldCollectionID, nil)
+	assert.False(t, ok)
+}
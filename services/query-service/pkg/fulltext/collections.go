@@ -0,0 +1,134 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+)
+
+// AssetCollections returns the collection of each asset among assetIDs that
+// belongs to one
+func (s *Store) AssetCollections(ctx context.Context, assetIDs []string) (map[string]string, error) {
+	collections := map[string]string{}
+	if len(assetIDs) == 0 {
+		return collections, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT e.id::text, e.parent_id::text
+		FROM entities e
+		WHERE e.id::text = ANY($1) AND e.parent_id IS NOT NULL AND `+fmt.Sprintf(TenantCondition, 2), assetIDs, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up asset collections: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var assetID, collectionID string
+		if err := rows.Scan(&assetID, &collectionID); err != nil {
+			return nil, fmt.Errorf("failed to scan asset collection: %v", err)
+		}
+		collections[assetID] = collectionID
+	}
+	return collections, rows.Err()
+}
+
+// TagOverlap is a collection whose assets share tags with another's
+type TagOverlap struct {
+	CollectionID string
+	// Shared lists the shared tags, at most maxSharedTags of them
+	Shared []string
+	// SharedCount is how many distinct tags the collections share
+	SharedCount int
+	// Jaccard is the shared tags over the tags of either collection
+	Jaccard float64
+}
+
+// maxSharedTags bounds the tags listed for each overlap
+const maxSharedTags = 5
+
+// collectionTags are the distinct lower-cased tags of the assets of each
+// collection in the tenant, given as the numbered argument
+const collectionTags = `
+		SELECT DISTINCT e.parent_id AS collection_id, lower(tag.value) AS tag
+		FROM entities e
+		CROSS JOIN LATERAL jsonb_array_elements_text(
+			CASE WHEN jsonb_typeof(e.metadata->'tags') = 'array' THEN e.metadata->'tags' ELSE '[]'::jsonb END
+		) AS tag(value)
+		WHERE e.parent_id IS NOT NULL AND ` + TenantCondition
+
+// CollectionsSharingTags returns up to limit collections whose assets share
+// tags with those of collectionID, by the Jaccard similarity of their tag
+// sets. A non-nil collectionIDs keeps only those collections.
+func (s *Store) CollectionsSharingTags(ctx context.Context, collectionID string, collectionIDs []string, limit int) ([]TagOverlap, error) {
+	rows, err := s.pool.Query(ctx, `
+		WITH tags AS (`+fmt.Sprintf(collectionTags, 1)+`),
+		target AS (
+			SELECT tag FROM tags WHERE collection_id::text = $2
+		),
+		sizes AS (
+			SELECT collection_id, count(*) AS tags FROM tags GROUP BY collection_id
+		)
+		SELECT t.collection_id::text,
+		       (array_agg(t.tag ORDER BY t.tag))[1:$3],
+		       count(*),
+		       count(*)::float8 / (sz.tags + (SELECT count(*) FROM target) - count(*))
+		FROM tags t
+		JOIN target USING (tag)
+		JOIN sizes sz ON sz.collection_id = t.collection_id
+		WHERE t.collection_id::text <> $2
+		  AND ($4::text[] IS NULL OR t.collection_id::text = ANY($4))
+		GROUP BY t.collection_id, sz.tags
+		ORDER BY 4 DESC, 1
+		LIMIT $5`, s.tenant, collectionID, maxSharedTags, collectionIDs, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare collection tags: %v", err)
+	}
+	defer rows.Close()
+
+	overlaps := []TagOverlap{}
+	for rows.Next() {
+		var overlap TagOverlap
+		if err := rows.Scan(&overlap.CollectionID, &overlap.Shared, &overlap.SharedCount, &overlap.Jaccard); err != nil {
+			return nil, fmt.Errorf("failed to scan tag overlap: %v", err)
+		}
+		overlaps = append(overlaps, overlap)
+	}
+	return overlaps, rows.Err()
+}
+
+// Collection describes a collection for navigation
+type Collection struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	AssetCount  int    `json:"asset_count"`
+}
+
+// Collections returns the collections among ids that hold assets of the
+// tenant, so collections found through shared logs never reach another
+// tenant
+func (s *Store) Collections(ctx context.Context, ids []string) (map[string]Collection, error) {
+	collections := map[string]Collection{}
+	if len(ids) == 0 {
+		return collections, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT c.id::text, c.name, COALESCE(c.description, ''), COALESCE(c.asset_count, 0)
+		FROM collections c
+		WHERE c.id::text = ANY($1)
+		  AND EXISTS (SELECT 1 FROM entities e WHERE e.parent_id = c.id AND `+fmt.Sprintf(TenantCondition, 2)+`)`, ids, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up collections: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var collection Collection
+		if err := rows.Scan(&collection.ID, &collection.Name, &collection.Description, &collection.AssetCount); err != nil {
+			return nil, fmt.Errorf("failed to scan collection: %v", err)
+		}
+		collections[collection.ID] = collection
+	}
+	return collections, rows.Err()
+}
@@ -0,0 +1,112 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Fields a completion comes from
+const (
+	CompletionFilename = "filename"
+	CompletionTag      = "tag"
+)
+
+// Completion is a filename or tag containing a typed prefix
+type Completion struct {
+	Field string
+	Text  string
+	// Assets counts the assets with the filename or tag
+	Assets int
+}
+
+// tagsTextColumn is the tags of the entity aliased e as lower-cased JSON
+// text, which the trigram index on entities covers
+const tagsTextColumn = `lower(e.metadata->>'tags')`
+
+// Completions returns up to limit filenames and up to limit tags containing
+// prefix, those starting with it first and then the most common. Filenames
+// match anywhere, as in beach_sunset.mp4 for "sun"; tags match at their
+// start. The trigram indexes on filenames and tags keep this fast from three
+// characters on. A non-nil collectionIDs confines the assets looked at.
+func (s *Store) Completions(ctx context.Context, prefix string, collectionIDs []string, hideEmbargoed bool, limit int) ([]Completion, error) {
+	prefix = strings.ToLower(prefix)
+	contains := "%" + likePrefix(prefix)
+	starts := likePrefix(prefix)
+	scope := `($3::text[] IS NULL OR e.parent_id::text = ANY($3))
+			  AND ` + fmt.Sprintf(TenantCondition, 4) + `
+			  AND NOT ($5 AND ` + EmbargoActive + `)`
+
+	rows, err := s.pool.Query(ctx, `
+		(SELECT '`+CompletionFilename+`', a.filename, count(*)::int
+		 FROM assets a
+		 JOIN entities e ON e.id = a.id
+		 WHERE a.filename ILIKE $1 AND `+scope+`
+		 GROUP BY a.filename
+		 ORDER BY lower(a.filename) LIKE $2 DESC, count(*) DESC, a.filename
+		 LIMIT $6)
+		UNION ALL
+		(SELECT '`+CompletionTag+`', tag, count(DISTINCT e.id)::int
+		 FROM assets a
+		 JOIN entities e ON e.id = a.id
+		 CROSS JOIN LATERAL unnest(`+tagsColumn+`) tag
+		 WHERE `+tagsTextColumn+` LIKE $1 AND lower(tag) LIKE $2 AND `+scope+`
+		 GROUP BY tag
+		 ORDER BY count(DISTINCT e.id) DESC, tag
+		 LIMIT $6)
+	`, contains, starts, collectionIDs, s.tenant, hideEmbargoed, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete %q: %v", prefix, err)
+	}
+	defer rows.Close()
+
+	completions := []Completion{}
+	for rows.Next() {
+		var completion Completion
+		if err := rows.Scan(&completion.Field, &completion.Text, &completion.Assets); err != nil {
+			return nil, fmt.Errorf("failed to scan completion: %v", err)
+		}
+		completions = append(completions, completion)
+	}
+	return completions, rows.Err()
+}
+
+// Vocabulary counts the words of tags and filenames across the assets that
+// are not under embargo, returning the limit most common of at least three
+// letters. It feeds spelling correction, which only suggests words that
+// occur in the index.
+func (s *Store) Vocabulary(ctx context.Context, limit int) (map[string]int, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT word, count(*)::int
+		FROM (
+			SELECT regexp_split_to_table(lower(tag), '[^[:alpha:]]+') AS word
+			FROM entities e
+			CROSS JOIN LATERAL unnest(`+tagsColumn+`) tag
+			WHERE `+fmt.Sprintf(TenantCondition, 1)+` AND NOT `+EmbargoActive+`
+			UNION ALL
+			SELECT regexp_split_to_table(lower(a.filename), '[^[:alpha:]]+')
+			FROM assets a
+			JOIN entities e ON e.id = a.id
+			WHERE `+fmt.Sprintf(TenantCondition, 1)+` AND NOT `+EmbargoActive+`
+		) words
+		WHERE length(word) >= 3
+		GROUP BY word
+		ORDER BY count(*) DESC
+		LIMIT $2
+	`, s.tenant, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vocabulary: %v", err)
+	}
+	defer rows.Close()
+
+	vocabulary := map[string]int{}
+	for rows.Next() {
+		var word string
+		var count int
+		if err := rows.Scan(&word, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan vocabulary: %v", err)
+		}
+		vocabulary[word] = count
+	}
+	return vocabulary, rows.Err()
+}
@@ -0,0 +1,61 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// embargoPattern matches the embargo_until values PostgreSQL can cast: a
+// date, or an RFC 3339 timestamp
+const embargoPattern = `^\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2}))?$`
+
+// EmbargoActive is true while the entity aliased e is under embargo. Dates
+// lift at midnight UTC. An embargo_until value that is not a date or
+// timestamp never lifts, so a typo hides an asset rather than publishing it early.
+const EmbargoActive = `(CASE
+			WHEN e.metadata->>'embargo_until' IS NULL THEN false
+			WHEN e.metadata->>'embargo_until' ~ '` + embargoPattern + `' THEN
+			  (e.metadata->>'embargo_until' || CASE WHEN length(e.metadata->>'embargo_until') = 10 THEN 'T00:00:00Z' ELSE '' END)::timestamptz > now()
+			ELSE true
+		  END)`
+
+// Embargoes returns the assets among assetIDs that are still under embargo,
+// with the time their embargo lifts. The time is zero when embargo_until
+// cannot be parsed, which keeps the asset embargoed indefinitely.
+func (s *Store) Embargoes(ctx context.Context, assetIDs []string) (map[string]time.Time, error) {
+	embargoes := map[string]time.Time{}
+	if len(assetIDs) == 0 {
+		return embargoes, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT e.id::text, e.metadata->>'embargo_until'
+		FROM entities e
+		WHERE e.id::text = ANY($1) AND `+EmbargoActive, assetIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up embargoes: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var assetID, until string
+		if err := rows.Scan(&assetID, &until); err != nil {
+			return nil, fmt.Errorf("failed to scan embargo: %v", err)
+		}
+		embargoes[assetID] = ParseEmbargo(until)
+	}
+	return embargoes, rows.Err()
+}
+
+// ParseEmbargo reads an embargo_until value in either form embargoPattern
+// accepts; dates are taken as midnight UTC. It returns the zero time for
+// anything else.
+func ParseEmbargo(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if until, err := time.Parse(layout, value); err == nil {
+			return until.UTC()
+		}
+	}
+	return time.Time{}
+}
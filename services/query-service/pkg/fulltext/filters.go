@@ -0,0 +1,139 @@
+package fulltext
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/filter"
+	"dataflux/query-service/pkg/storage"
+)
+
+// filterColumns are the expressions filters apply to; assets are aliased a
+// and their entities e. An asset's duration comes from its metadata when
+// numeric, and its availability from the storage class in its metadata.
+var filterColumns = map[string]string{
+	filter.FieldMimeType:     "a.mime_type",
+	filter.FieldCollectionID: "e.parent_id::text",
+	filter.FieldTags:         "e.metadata->'tags'",
+	filter.FieldFileSize:     "a.file_size",
+	filter.FieldDuration:     `(CASE WHEN e.metadata->>'duration' ~ '^[0-9]+(\.[0-9]+)?$' THEN (e.metadata->>'duration')::float END)`,
+	filter.FieldCreatedAt:    "e.created_at",
+	filter.FieldAvailability: availabilityColumn("e.metadata->>'storage_class'"),
+}
+
+// availabilityColumn maps a storage class expression to its tier the way
+// storage.TierOf does, so unknown and missing classes are online
+func availabilityColumn(class string) string {
+	var cases strings.Builder
+	cases.WriteString("(CASE upper(coalesce(" + class + ", ''))")
+	for _, tier := range []string{storage.TierNearline, storage.TierArchived} {
+		for _, name := range storage.ClassesIn(tier) {
+			cases.WriteString(" WHEN '" + name + "' THEN '" + tier + "'")
+		}
+	}
+	cases.WriteString(" ELSE '" + storage.TierOnline + "' END)")
+	return cases.String()
+}
+
+// filterSQL translates filter clauses into AND-ed conditions with
+// placeholders numbered from firstArg
+func filterSQL(clauses []filter.Clause, firstArg int) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	next := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(firstArg+len(args)-1)
+	}
+
+	for _, clause := range clauses {
+		column, ok := filterColumns[clause.Field]
+		if !ok {
+			continue
+		}
+		if clause.Kind == filter.KindStringList {
+			conditions = append(conditions, listCondition(column, clause, next))
+			continue
+		}
+
+		switch clause.Op {
+		case filter.OpEq:
+			conditions = append(conditions, column+" = "+next(clause.Values[0]))
+		case filter.OpIn:
+			conditions = append(conditions, column+" = ANY("+next(typedArray(clause.Kind, clause.Values))+")")
+		case filter.OpPrefix:
+			conditions = append(conditions, column+" LIKE "+next(likePrefix(clause.Values[0].(string))))
+		case filter.OpExists:
+			conditions = append(conditions, column+existsSuffix(clause.Exists))
+		case filter.OpRange:
+			for _, bound := range []struct {
+				operator string
+				value    interface{}
+			}{{">", clause.Range.Gt}, {">=", clause.Range.Gte}, {"<", clause.Range.Lt}, {"<=", clause.Range.Lte}} {
+				if bound.value != nil {
+					conditions = append(conditions, column+" "+bound.operator+" "+next(bound.value))
+				}
+			}
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "\n\t\t  AND " + strings.Join(conditions, "\n\t\t  AND "), args
+}
+
+// listCondition matches a JSON array of strings, which is true when any
+// element matches
+func listCondition(column string, clause filter.Clause, next func(interface{}) string) string {
+	array := fmt.Sprintf("(CASE WHEN jsonb_typeof(%[1]s) = 'array' THEN %[1]s END)", column)
+	switch clause.Op {
+	case filter.OpEq:
+		return column + " ? " + next(clause.Values[0])
+	case filter.OpIn:
+		return column + " ?| " + next(typedArray(clause.Kind, clause.Values))
+	case filter.OpPrefix:
+		return "EXISTS (SELECT 1 FROM jsonb_array_elements_text(" + array + ") v WHERE v LIKE " + next(likePrefix(clause.Values[0].(string))) + ")"
+	}
+	exists := "coalesce(jsonb_array_length(" + array + "), 0) > 0"
+	if !clause.Exists {
+		return "NOT " + exists
+	}
+	return exists
+}
+
+func existsSuffix(exists bool) string {
+	if exists {
+		return " IS NOT NULL"
+	}
+	return " IS NULL"
+}
+
+// typedArray converts validated values to a slice pgx can encode
+func typedArray(kind filter.Kind, values []interface{}) interface{} {
+	switch kind {
+	case filter.KindNumber:
+		numbers := make([]float64, len(values))
+		for i, value := range values {
+			numbers[i] = value.(float64)
+		}
+		return numbers
+	case filter.KindTime:
+		times := make([]time.Time, len(values))
+		for i, value := range values {
+			times[i] = value.(time.Time)
+		}
+		return times
+	}
+	strs := make([]string, len(values))
+	for i, value := range values {
+		strs[i] = value.(string)
+	}
+	return strs
+}
+
+// likePrefix escapes LIKE wildcards in a literal prefix
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
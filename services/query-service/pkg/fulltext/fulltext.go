@@ -0,0 +1,405 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"dataflux/query-service/pkg/calibration"
+	"dataflux/query-service/pkg/filter"
+	"dataflux/query-service/pkg/querysyntax"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// assetVector and featureVector build the searched expressions in a text
+// search configuration with an optional column prefix. Queries must use the
+// same expressions as the indexes in EnsureSchema, otherwise PostgreSQL falls
+// back to sequential scans.
+func assetVector(config, prefix string) string {
+	return fmt.Sprintf(`to_tsvector('%[1]s', regexp_replace(coalesce(%[2]sfilename, '') || ' ' || coalesce(%[2]supload_context, ''), '[^[:alnum:]]+', ' ', 'g'))`, config, prefix)
+}
+
+func featureVector(config, prefix string) string {
+	return fmt.Sprintf(`jsonb_to_tsvector('%s', %sfeature_data, '["string"]')`, config, prefix)
+}
+
+// mediaTypePatterns maps the coarse media types used by the API to MIME patterns
+var mediaTypePatterns = map[string][]string{
+	"image":    {"image/%"},
+	"video":    {"video/%"},
+	"audio":    {"audio/%"},
+	"document": {"application/%", "text/%"},
+}
+
+// Filters restricts which assets are searched
+type Filters struct {
+	MimePatterns []string
+	Clauses      []filter.Clause
+}
+
+// Query is a keyword search with paging. Phrases and Near pairs are required
+// positional matches; of the keywords, wildcard and fuzzy terms any one has
+// to match.
+type Query struct {
+	Keywords  []string
+	Phrases   [][]string
+	Near      []querysyntax.Near
+	Wildcards []string
+	Fuzzy     []querysyntax.Fuzzy
+	// Excluded terms must not appear in an asset's text or features
+	Excluded []string
+	// Language is the ISO 639-1 code of the query. Languages the store stems
+	// are matched through their stemmed indexes, the others word for word.
+	Language string
+	Filters  Filters
+	Limit    int
+	Offset   int
+	// HideEmbargoed leaves out assets whose embargo has not lifted yet
+	HideEmbargoed bool
+	// ConfidenceMin drops segment hits none of whose matching features
+	// reach this calibrated confidence; 0 keeps them all
+	ConfidenceMin float64
+	// Calibration maps each analyzer's feature confidences onto a common
+	// scale before they are filtered and ranked on
+	Calibration calibration.Table
+	// Provenance limits which analyzers and models segment hits may match
+	// through; asset hits are not produced by an analyzer and keep matching
+	Provenance Provenance
+}
+
+// Hit is an asset, or a segment of an asset, whose text matched the query
+type Hit struct {
+	AssetID       string
+	SegmentID     string
+	Filename      string
+	MimeType      string
+	ThumbnailPath string
+	CollectionID  string
+	CreatedAt     time.Time
+	// StorageClass is the S3 storage class of the asset's media, if recorded
+	StorageClass string
+	Rank         float64
+	// Confidence is the best calibrated confidence of a segment hit's
+	// matching features; asset hits leave it 0
+	Confidence float64
+}
+
+// TenantCondition holds for entities e of the tenant given as the numbered
+// argument, or for every entity when it is empty
+const TenantCondition = `($%[1]d::text = '' OR e.metadata->>'tenant_id' = $%[1]d)`
+
+// Store runs full-text search over assets and segment features
+type Store struct {
+	pool   *pgxpool.Pool
+	tenant string
+	// stemming maps language codes to the text search configurations their
+	// queries are stemmed in
+	stemming map[string]string
+}
+
+// NewStore creates a new full-text search store
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// ForTenant returns a store that only sees the assets whose metadata names
+// the tenant in tenant_id
+func (s *Store) ForTenant(tenant string) *Store {
+	scoped := *s
+	scoped.tenant = tenant
+	return &scoped
+}
+
+// WithStemming returns a store that matches queries in the languages of
+// configs, which maps ISO 639-1 codes to PostgreSQL text search
+// configurations such as "german", with the stop words and stemming of that
+// configuration. Each configuration needs indexes of its own, listed by
+// IndexStatements.
+func (s *Store) WithStemming(configs map[string]string) *Store {
+	stemmed := *s
+	stemmed.stemming = configs
+	return &stemmed
+}
+
+// textSearchConfig is the configuration a query in the language is matched
+// in; "de-AT" is matched like "de"
+func (s *Store) textSearchConfig(language string) string {
+	language = strings.ToLower(language)
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		language = language[:i]
+	}
+	if config, ok := s.stemming[language]; ok {
+		return config
+	}
+	return "simple"
+}
+
+// EnsureSchema creates the distance function used by fuzzy terms. The
+// indexes are built by IndexMigration.
+func (s *Store) EnsureSchema(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, osaDistanceFunction)
+	return err
+}
+
+// hitsSQL is the union of the asset and segment hits of a query, numbering
+// its arguments from $1
+type hitsSQL struct {
+	sql       string
+	args      []interface{}
+	threshold float64
+}
+
+// newHitsSQL builds the hits of the query; ok is false when the query has
+// nothing to match
+func (s *Store) newHitsSQL(query Query) (hitsSQL, bool) {
+	conditions, filterArgs := filterSQL(query.Filters.Clauses, 2)
+	match := newMatchClause(query, 2+len(filterArgs))
+	match.config = s.textSearchConfig(query.Language)
+	if match.empty() {
+		return hitsSQL{}, false
+	}
+
+	args := append([]interface{}{nullIfEmpty(query.Filters.MimePatterns)}, filterArgs...)
+	args = append(args, match.args...)
+	args = append(args, s.tenant)
+	filters := `
+		  AND ($1::text[] IS NULL OR a.mime_type LIKE ANY($1))` + conditions + `
+		  AND ` + fmt.Sprintf(TenantCondition, len(args))
+	if query.HideEmbargoed {
+		filters += `
+		  AND NOT ` + EmbargoActive
+	}
+
+	calibrated, confidenceArgs := calibratedConfidence("f.", query.Calibration, len(args)+1)
+	args = append(args, confidenceArgs...)
+	var provenance string
+	if !query.Provenance.Empty() {
+		var provenanceArgs []interface{}
+		provenance, provenanceArgs = provenanceSQL(query.Provenance, len(args)+1)
+		args = append(args, provenanceArgs...)
+	}
+	var assetExclusion, segmentExclusion string
+	if excluded := BuildExclusionTSQuery(query.Excluded); excluded != "" {
+		args = append(args, excluded)
+		assetExclusion, segmentExclusion = exclusionSQL(len(args))
+	}
+	args = append(args, query.ConfidenceMin)
+	return hitsSQL{
+		sql: `
+			SELECT a.id::text AS asset_id, NULL::text AS segment_id, a.filename, a.mime_type,
+			       a.thumbnail_path, e.parent_id::text AS collection_id, e.created_at,
+			       e.metadata->>'storage_class' AS storage_class,
+			       ` + match.rank(assetVector(match.config, "a."), assetText("a.")) + ` AS rank,
+			       0::float8 AS confidence
+			FROM assets a
+			JOIN entities e ON e.id = a.id
+			WHERE ` + match.where(assetVector(match.config, "a."), assetText("a.")) + filters + assetExclusion + `
+			UNION ALL
+			SELECT a.id::text, s.id::text, a.filename, a.mime_type,
+			       a.thumbnail_path, e.parent_id::text, e.created_at,
+			       e.metadata->>'storage_class',
+			       max(` + match.rank(featureVector(match.config, "f."), featureText("f.")) + ` * c.confidence),
+			       max(c.confidence)
+			FROM features f
+			CROSS JOIN LATERAL (SELECT ` + calibrated + ` AS confidence) c
+			JOIN segments s ON s.id = f.segment_id
+			JOIN assets a ON a.id = s.asset_id
+			JOIN entities e ON e.id = a.id
+			WHERE f.segment_id IS NOT NULL
+			  AND ` + match.where(featureVector(match.config, "f."), featureText("f.")) + filters + provenance + segmentExclusion + fmt.Sprintf(`
+			  AND c.confidence >= $%d`, len(args)) + `
+			GROUP BY a.id, s.id, e.parent_id, e.created_at, e.metadata->>'storage_class'`,
+		args:      args,
+		threshold: match.threshold,
+	}, true
+}
+
+// begin opens the transaction a query's hits are read in. Fuzzy terms lower
+// the trigram threshold for this query only.
+func (s *Store) begin(ctx context.Context, hits hitsSQL) (pgx.Tx, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if hits.threshold > 0 {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`SET LOCAL pg_trgm.word_similarity_threshold = %.2f`, hits.threshold)); err != nil {
+			tx.Rollback(ctx)
+			return nil, fmt.Errorf("failed to set fuzzy threshold: %v", err)
+		}
+	}
+	return tx, nil
+}
+
+// Search returns assets and segments matching the query, best first
+func (s *Store) Search(ctx context.Context, query Query) ([]Hit, error) {
+	union, ok := s.newHitsSQL(query)
+	if !ok {
+		return []Hit{}, nil
+	}
+	tx, err := s.begin(ctx, union)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run full-text search: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	args := append(union.args, query.Limit, query.Offset)
+	rows, err := tx.Query(ctx, `
+		SELECT asset_id, segment_id, filename, mime_type, thumbnail_path, collection_id, created_at, storage_class, rank, confidence
+		FROM (`+union.sql+`
+		) hits
+		ORDER BY rank DESC, asset_id, segment_id NULLS FIRST
+		`+fmt.Sprintf(`LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run full-text search: %v", err)
+	}
+	defer rows.Close()
+
+	hits := []Hit{}
+	for rows.Next() {
+		var hit Hit
+		var segmentID, thumbnailPath, collectionID, storageClass *string
+		var createdAt *time.Time
+		var rank float32
+		var confidence float64
+		if err := rows.Scan(
+			&hit.AssetID,
+			&segmentID,
+			&hit.Filename,
+			&hit.MimeType,
+			&thumbnailPath,
+			&collectionID,
+			&createdAt,
+			&storageClass,
+			&rank,
+			&confidence,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan full-text hit: %v", err)
+		}
+		if segmentID != nil {
+			hit.SegmentID = *segmentID
+		}
+		if thumbnailPath != nil {
+			hit.ThumbnailPath = *thumbnailPath
+		}
+		if collectionID != nil {
+			hit.CollectionID = *collectionID
+		}
+		if createdAt != nil {
+			hit.CreatedAt = *createdAt
+		}
+		if storageClass != nil {
+			hit.StorageClass = *storageClass
+		}
+		hit.Rank = float64(rank)
+		hit.Confidence = confidence
+		hits = append(hits, hit)
+	}
+
+	return hits, rows.Err()
+}
+
+// calibratedConfidence returns the SQL expression calibrating a feature's
+// confidence along the table's line pieces, with its arguments numbered from
+// first. Features of analyzers without a mapping keep their raw confidence.
+func calibratedConfidence(prefix string, table calibration.Table, first int) (string, []interface{}) {
+	expression := fmt.Sprintf(`COALESCE((
+				SELECT p.low_cal + (p.high_cal - p.low_cal) * (%[1]sconfidence - p.low_raw) / (p.high_raw - p.low_raw)
+				FROM unnest($%[2]d::text[], $%[3]d::float8[], $%[4]d::float8[], $%[5]d::float8[], $%[6]d::float8[])
+				     AS p(analyzer, low_raw, low_cal, high_raw, high_cal)
+				WHERE p.analyzer = %[1]sfeature_type AND %[1]sconfidence BETWEEN p.low_raw AND p.high_raw
+				ORDER BY p.low_raw
+				LIMIT 1
+			), %[1]sconfidence)`, prefix, first, first+1, first+2, first+3, first+4)
+	return expression, []interface{}{
+		table.Analyzers, table.LowRaw, table.LowCalibrated, table.HighRaw, table.HighCalibrated,
+	}
+}
+
+// BuildTSQuery turns keywords into a to_tsquery expression that matches any
+// keyword. Words inside a multi-word keyword must all match, and the last
+// word of each keyword is prefix-matched.
+func BuildTSQuery(keywords []string) string {
+	var alternatives []string
+	seen := map[string]bool{}
+	for _, keyword := range keywords {
+		words := lexemes(keyword)
+		if len(words) == 0 {
+			continue
+		}
+		words[len(words)-1] += ":*"
+		alternative := strings.Join(words, " & ")
+		if len(words) > 1 {
+			alternative = "(" + alternative + ")"
+		}
+		if !seen[alternative] {
+			seen[alternative] = true
+			alternatives = append(alternatives, alternative)
+		}
+	}
+	return strings.Join(alternatives, " | ")
+}
+
+// BuildPositionalTSQuery turns phrases and proximity pairs into a to_tsquery
+// expression requiring all of them. A phrase becomes the <-> chain that
+// phraseto_tsquery produces; a pair at most N words apart becomes the
+// alternatives <1> to <N> in both orders.
+func BuildPositionalTSQuery(phrases [][]string, near []querysyntax.Near) string {
+	var required []string
+	for _, phrase := range phrases {
+		words := lexemes(strings.Join(phrase, " "))
+		switch len(words) {
+		case 0:
+		case 1:
+			required = append(required, words[0])
+		default:
+			required = append(required, "("+strings.Join(words, " <-> ")+")")
+		}
+	}
+	for _, pair := range near {
+		left, right := lexemes(pair.Left), lexemes(pair.Right)
+		if len(left) != 1 || len(right) != 1 {
+			continue
+		}
+		var alternatives []string
+		for distance := 1; distance <= pair.Distance; distance++ {
+			alternatives = append(alternatives,
+				fmt.Sprintf("%s <%d> %s", left[0], distance, right[0]),
+				fmt.Sprintf("%s <%d> %s", right[0], distance, left[0]))
+		}
+		required = append(required, "("+strings.Join(alternatives, " | ")+")")
+	}
+	return strings.Join(required, " & ")
+}
+
+func lexemes(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// FiltersFromRequest combines the coarse request media types, which may
+// also be MIME patterns, with the validated filter set
+func FiltersFromRequest(mediaTypes []string, filters filter.Set) Filters {
+	var result Filters
+	for _, value := range mediaTypes {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if patterns, ok := mediaTypePatterns[value]; ok {
+			result.MimePatterns = append(result.MimePatterns, patterns...)
+		} else if value != "" && value != "all" {
+			result.MimePatterns = append(result.MimePatterns, value)
+		}
+	}
+	result.Clauses = filters.Clauses()
+	return result
+}
+
+func nullIfEmpty(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
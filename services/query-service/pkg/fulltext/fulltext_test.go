@@ -0,0 +1,178 @@
+package fulltext
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/calibration"
+	"dataflux/query-service/pkg/filter"
+	"dataflux/query-service/pkg/querysyntax"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTSQuery(t *testing.T) {
+	assert.Equal(t, "", BuildTSQuery(nil))
+	assert.Equal(t, "car:* | (red & truck:*)", BuildTSQuery([]string{"Car", "red truck", "car"}))
+	assert.Equal(t, "drop:* | table:*", BuildTSQuery([]string{"drop'); --", "table", "!!"}))
+}
+
+func TestFiltersFromRequest(t *testing.T) {
+	set, err := filter.FromMap(map[string]interface{}{
+		"collection_id": []interface{}{"c1", "c2"},
+		"date_from":     "2024-01-01",
+	})
+	require.NoError(t, err)
+
+	filters := FiltersFromRequest([]string{"image", "all", "video/mp4"}, set)
+
+	assert.Equal(t, []string{"image/%", "video/mp4"}, filters.MimePatterns)
+	require.Len(t, filters.Clauses, 2)
+	assert.Equal(t, filter.FieldCollectionID, filters.Clauses[0].Field)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), filters.Clauses[1].Range.Gte)
+}
+
+func TestFilterSQL(t *testing.T) {
+	set, err := filter.FromMap(map[string]interface{}{
+		"mime_type":  map[string]interface{}{"prefix": "image/"},
+		"file_size":  map[string]interface{}{"range": map[string]interface{}{"gte": 1024, "lt": 1048576}},
+		"tags":       []interface{}{"beach", "sunset"},
+		"duration":   map[string]interface{}{"exists": false},
+		"created_at": map[string]interface{}{"eq": "2024-01-01"},
+	})
+	require.NoError(t, err)
+
+	sql, args := filterSQL(set.Clauses(), 4)
+
+	assert.Equal(t, "\n\t\t  AND e.created_at = $4"+
+		"\n\t\t  AND "+filterColumns[filter.FieldDuration]+" IS NULL"+
+		"\n\t\t  AND a.file_size >= $5"+
+		"\n\t\t  AND a.file_size < $6"+
+		"\n\t\t  AND a.mime_type LIKE $7"+
+		"\n\t\t  AND e.metadata->'tags' ?| $8", sql)
+	assert.Equal(t, []interface{}{
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 1024.0, 1048576.0, "image/%", []string{"beach", "sunset"},
+	}, args)
+
+	sql, args = filterSQL(nil, 4)
+	assert.Empty(t, sql)
+	assert.Empty(t, args)
+}
+
+func TestAvailabilityColumn(t *testing.T) {
+	assert.Equal(t, "(CASE upper(coalesce(class, ''))"+
+		" WHEN 'GLACIER_IR' THEN 'nearline' WHEN 'ONEZONE_IA' THEN 'nearline' WHEN 'STANDARD_IA' THEN 'nearline'"+
+		" WHEN 'DEEP_ARCHIVE' THEN 'archived' WHEN 'GLACIER' THEN 'archived'"+
+		" ELSE 'online' END)", availabilityColumn("class"))
+
+	set, err := filter.FromMap(map[string]interface{}{"availability": []interface{}{"online", "nearline"}})
+	require.NoError(t, err)
+	sql, args := filterSQL(set.Clauses(), 4)
+	assert.Equal(t, "\n\t\t  AND "+filterColumns[filter.FieldAvailability]+" = ANY($4)", sql)
+	assert.Equal(t, []interface{}{[]string{"online", "nearline"}}, args)
+}
+
+func TestLikePrefixEscapesWildcards(t *testing.T) {
+	assert.Equal(t, `100\%\_off%`, likePrefix("100%_off"))
+}
+
+func TestBuildPositionalTSQuery(t *testing.T) {
+	tsquery := BuildPositionalTSQuery(
+		[][]string{{"prime", "minister", "speech"}, {"budget"}},
+		[]querysyntax.Near{{Left: "tax", Right: "cuts", Distance: 2}},
+	)
+
+	assert.Equal(t, "(prime <-> minister <-> speech) & budget & (tax <1> cuts | cuts <1> tax | tax <2> cuts | cuts <2> tax)", tsquery)
+	assert.Empty(t, BuildPositionalTSQuery(nil, nil))
+}
+
+func TestParseEmbargoAgreesWithSQLPattern(t *testing.T) {
+	pattern := regexp.MustCompile(embargoPattern)
+	for value, want := range map[string]time.Time{
+		"2030-01-02":                time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC),
+		"2030-01-02T10:00:00Z":      time.Date(2030, 1, 2, 10, 0, 0, 0, time.UTC),
+		"2030-01-02T10:00:00+02:00": time.Date(2030, 1, 2, 8, 0, 0, 0, time.UTC),
+		"2030-01-02T10:00:00.5Z":    time.Date(2030, 1, 2, 10, 0, 0, 5e8, time.UTC),
+		"next tuesday":              {},
+		"2030-01-02 10:00":          {},
+	} {
+		assert.Equal(t, want, ParseEmbargo(value), value)
+		assert.Equal(t, !want.IsZero(), pattern.MatchString(value), value)
+	}
+}
+
+func TestCalibratedConfidence(t *testing.T) {
+	table := calibration.Table{
+		Analyzers:      []string{"face", "face"},
+		LowRaw:         []float64{0, 0.5},
+		LowCalibrated:  []float64{0, 0.2},
+		HighRaw:        []float64{0.5, 1},
+		HighCalibrated: []float64{0.2, 1},
+	}
+
+	sql, args := calibratedConfidence("f.", table, 9)
+
+	assert.Contains(t, sql, "unnest($9::text[], $10::float8[], $11::float8[], $12::float8[], $13::float8[])")
+	assert.Contains(t, sql, "p.analyzer = f.feature_type")
+	assert.Contains(t, sql, "), f.confidence)")
+	assert.Equal(t, []interface{}{table.Analyzers, table.LowRaw, table.LowCalibrated, table.HighRaw, table.HighCalibrated}, args)
+}
+
+func TestProvenanceSQL(t *testing.T) {
+	provenance := Provenance{Analyzers: []string{"yolo_analyzer"}, ExcludeModels: []string{"yolo_analyzer@yolov8n"}}
+
+	sql, args := provenanceSQL(provenance, 5)
+
+	assert.Contains(t, sql, "($5::text[] IS NULL OR f.analyzer_version = ANY($5))")
+	assert.Contains(t, sql, "($6::text[] IS NULL OR COALESCE(f.analyzer_version || '@' || f.model_version, f.analyzer_version) = ANY($6))")
+	assert.Contains(t, sql, "COALESCE(f.analyzer_version || '@' || f.model_version, f.analyzer_version) <> ALL(COALESCE($8::text[], '{}'))")
+	assert.Equal(t, []interface{}{[]string{"yolo_analyzer"}, []string(nil), []string(nil), []string{"yolo_analyzer@yolov8n"}}, args)
+}
+
+func TestProvenanceValidate(t *testing.T) {
+	assert.True(t, Provenance{}.Empty())
+	assert.NoError(t, Provenance{Analyzers: []string{"exif_analyzer"}, Models: []string{"yolo_analyzer@yolov8n"}}.Validate())
+
+	assert.Error(t, Provenance{Analyzers: []string{""}}.Validate())
+	assert.Error(t, Provenance{Analyzers: []string{"yolo_analyzer@yolov8n"}}.Validate())
+	assert.Error(t, Provenance{ExcludeModels: []string{"yolo_analyzer"}}.Validate())
+	assert.Error(t, Provenance{Models: []string{"@yolov8n"}}.Validate())
+	assert.Error(t, Provenance{Models: []string{"yolo_analyzer@"}}.Validate())
+}
+
+func TestPlanRows(t *testing.T) {
+	rows, err := planRows([]byte(`[{"Plan": {"Node Type": "Unique", "Plan Rows": 1234.6, "Plans": [{"Plan Rows": 5000}]}}]`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1235), rows)
+
+	_, err = planRows([]byte(`[]`))
+	assert.Error(t, err)
+}
+
+func TestValidStratum(t *testing.T) {
+	assert.True(t, ValidStratum("", false))
+	assert.True(t, ValidStratum("mime_type", false))
+	assert.True(t, ValidStratum("collection_id", true))
+	assert.True(t, ValidStratum("segment_type", true))
+	assert.False(t, ValidStratum("segment_type", false))
+	assert.False(t, ValidStratum("filename", false))
+}
+
+func TestIndexMigrationMatchesIndexes(t *testing.T) {
+	migration, err := os.ReadFile(filepath.Join("..", "..", "..", "..", IndexMigration))
+	require.NoError(t, err)
+
+	// The stemmed pairs of the default FULLTEXT_STEMMING_LANGUAGES
+	statements := NewStore(nil).WithStemming(map[string]string{
+		"de": "german", "es": "spanish", "fr": "french", "it": "italian", "nl": "dutch", "pt": "portuguese",
+	}).IndexStatements()
+	require.Len(t, statements, 18)
+	for _, statement := range statements {
+		assert.Contains(t, string(migration), statement+";\n")
+	}
+	assert.Contains(t, string(migration), "CREATE EXTENSION IF NOT EXISTS pg_trgm;")
+}
@@ -0,0 +1,85 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// IndexMigration is the script that builds the indexes search relies on,
+// with the stemmed pairs of the default languages. Building them locks their
+// tables against writes unless done concurrently, which cannot happen at
+// startup inside the service.
+const IndexMigration = "scripts/fulltext-indexes.sql"
+
+// index is a named index and what follows its name in CREATE INDEX
+type index struct {
+	name       string
+	definition string
+}
+
+// indexes returns the GIN indexes backing the search expressions, one pair
+// per stemmed configuration, the trigram indexes used by wildcard and fuzzy
+// terms, and the trigram index on tags used by completions
+func (s *Store) indexes() []index {
+	indexes := []index{
+		{"idx_assets_fulltext", `ON assets USING gin((` + assetVector("simple", "") + `))`},
+		{"idx_features_fulltext", `ON features USING gin((` + featureVector("simple", "") + `)) WHERE segment_id IS NOT NULL`},
+		{"idx_assets_trgm", `ON assets USING gin((` + assetText("") + `) gin_trgm_ops)`},
+		{"idx_features_trgm", `ON features USING gin((` + featureText("") + `) gin_trgm_ops) WHERE segment_id IS NOT NULL`},
+		{"idx_entities_tenant", `ON entities ((metadata->>'tenant_id'))`},
+		{"idx_entities_tags_trgm", `ON entities USING gin((lower(metadata->>'tags')) gin_trgm_ops)`},
+	}
+	for _, config := range s.stemmedConfigs() {
+		indexes = append(indexes,
+			index{"idx_assets_fulltext_" + config, `ON assets USING gin((` + assetVector(config, "") + `))`},
+			index{"idx_features_fulltext_" + config, `ON features USING gin((` + featureVector(config, "") + `)) WHERE segment_id IS NOT NULL`})
+	}
+	return indexes
+}
+
+// stemmedConfigs returns the distinct stemming configurations in order
+func (s *Store) stemmedConfigs() []string {
+	seen := map[string]bool{}
+	var configs []string
+	for _, config := range s.stemming {
+		if !seen[config] {
+			seen[config] = true
+			configs = append(configs, config)
+		}
+	}
+	sort.Strings(configs)
+	return configs
+}
+
+// IndexStatements returns the statements of IndexMigration that build the
+// indexes without blocking writes
+func (s *Store) IndexStatements() []string {
+	statements := make([]string, 0, len(s.indexes()))
+	for _, index := range s.indexes() {
+		statements = append(statements, "CREATE INDEX CONCURRENTLY IF NOT EXISTS "+index.name+" "+index.definition)
+	}
+	return statements
+}
+
+// MissingIndexes returns the names of the indexes search relies on that do
+// not exist yet, or are left invalid by a failed concurrent build
+func (s *Store) MissingIndexes(ctx context.Context) ([]string, error) {
+	var missing []string
+	for _, index := range s.indexes() {
+		var valid bool
+		err := s.pool.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM pg_index i
+				WHERE i.indexrelid = to_regclass($1) AND i.indisvalid
+			)
+		`, index.name).Scan(&valid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up index %s: %v", index.name, err)
+		}
+		if !valid {
+			missing = append(missing, index.name)
+		}
+	}
+	return missing, nil
+}
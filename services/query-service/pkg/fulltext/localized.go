@@ -0,0 +1,45 @@
+package fulltext
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// LocalizedMetadata returns, for each asset among assetIDs, the metadata
+// keys that hold one of fields in any language: the field itself and its
+// field.<language> keys
+func (s *Store) LocalizedMetadata(ctx context.Context, assetIDs, fields []string) (map[string]map[string]interface{}, error) {
+	metadata := map[string]map[string]interface{}{}
+	if len(assetIDs) == 0 || len(fields) == 0 {
+		return metadata, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT e.id::text, m.fields
+		FROM entities e
+		CROSS JOIN LATERAL (
+			SELECT jsonb_object_agg(key, value) AS fields
+			FROM jsonb_each(e.metadata)
+			WHERE split_part(key, '.', 1) = ANY($2)
+		) m
+		WHERE e.id::text = ANY($1) AND m.fields IS NOT NULL AND `+fmt.Sprintf(TenantCondition, 3), assetIDs, fields, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load localized metadata: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var assetID string
+		var encoded []byte
+		if err := rows.Scan(&assetID, &encoded); err != nil {
+			return nil, fmt.Errorf("failed to scan localized metadata: %v", err)
+		}
+		var values map[string]interface{}
+		if err := json.Unmarshal(encoded, &values); err != nil {
+			return nil, fmt.Errorf("failed to decode localized metadata: %v", err)
+		}
+		metadata[assetID] = values
+	}
+	return metadata, rows.Err()
+}
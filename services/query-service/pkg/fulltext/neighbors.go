@@ -0,0 +1,102 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// captureColumn is when the entity aliased e was captured: captured_at in its
+// metadata when PostgreSQL can cast it, otherwise when it was ingested
+const captureColumn = `(CASE
+			WHEN e.metadata->>'captured_at' ~ '` + embargoPattern + `' THEN (e.metadata->>'captured_at')::timestamptz
+			ELSE e.created_at
+		  END)`
+
+// tagsColumn is the tags of the entity aliased e as a text array
+const tagsColumn = `ARRAY(SELECT jsonb_array_elements_text(CASE WHEN jsonb_typeof(e.metadata->'tags') = 'array' THEN e.metadata->'tags' ELSE '[]'::jsonb END))`
+
+// Neighbor is an asset related to another by its metadata alone, for assets
+// that have no embeddings to compare yet
+type Neighbor struct {
+	AssetID       string
+	Filename      string
+	MimeType      string
+	ThumbnailPath string
+	CollectionID  string
+	CapturedAt    time.Time
+	// SharedTags are the tags both assets carry
+	SharedTags     []string
+	SameCollection bool
+	// Score adds half the share of tags in common, 0.3 for a shared
+	// collection and up to 0.2 as the capture times near each other, so
+	// it runs from 0 to 1
+	Score float64
+}
+
+// MetadataNeighbors returns the assets sharing tags or the collection with
+// an asset, or captured within window of it, best first. A non-nil
+// collectionIDs confines both the asset and its neighbors to those
+// collections; mimePatterns restricts the neighbors' MIME types. Embargoed
+// assets are left out. An asset that is not found has no neighbors.
+func (s *Store) MetadataNeighbors(ctx context.Context, assetID string, collectionIDs, mimePatterns []string, window time.Duration, limit int) ([]Neighbor, error) {
+	rows, err := s.pool.Query(ctx, `
+		WITH source AS (
+			SELECT e.id, e.parent_id, `+tagsColumn+` AS tags, `+captureColumn+` AS captured_at
+			FROM assets a
+			JOIN entities e ON e.id = a.id
+			WHERE a.id::text = $1 AND ($2::text[] IS NULL OR e.parent_id::text = ANY($2))
+			  AND `+fmt.Sprintf(TenantCondition, 4)+`
+		), candidates AS (
+			SELECT a.id::text AS asset_id, a.filename, a.mime_type, a.thumbnail_path,
+			       e.parent_id::text AS collection_id, `+captureColumn+` AS captured_at,
+			       ARRAY(SELECT unnest(`+tagsColumn+`) INTERSECT SELECT unnest(source.tags) ORDER BY 1) AS shared_tags,
+			       cardinality(ARRAY(SELECT unnest(`+tagsColumn+`) UNION SELECT unnest(source.tags))) AS all_tags,
+			       COALESCE(e.parent_id = source.parent_id, false) AS same_collection,
+			       source.captured_at AS source_captured_at
+			FROM source, assets a
+			JOIN entities e ON e.id = a.id
+			WHERE a.id <> source.id
+			  AND ($2::text[] IS NULL OR e.parent_id::text = ANY($2))
+			  AND ($3::text[] IS NULL OR a.mime_type LIKE ANY($3))
+			  AND `+fmt.Sprintf(TenantCondition, 4)+`
+			  AND NOT `+EmbargoActive+`
+			  AND (e.metadata->'tags' ?| source.tags
+			       OR e.parent_id = source.parent_id
+			       OR `+captureColumn+` BETWEEN source.captured_at - $5 * interval '1 second' AND source.captured_at + $5 * interval '1 second')
+		)
+		SELECT asset_id, filename, mime_type, thumbnail_path, collection_id, captured_at, shared_tags, same_collection,
+		       0.5 * cardinality(shared_tags)::float8 / GREATEST(all_tags, 1)
+		       + 0.3 * same_collection::int
+		       + 0.2 * GREATEST(0, 1 - abs(extract(epoch FROM captured_at - source_captured_at)) / NULLIF($5, 0)) AS score
+		FROM candidates
+		ORDER BY score DESC, asset_id
+		LIMIT $6
+	`, assetID, collectionIDs, nullIfEmpty(mimePatterns), s.tenant, window.Seconds(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find metadata neighbors: %v", err)
+	}
+	defer rows.Close()
+
+	neighbors := []Neighbor{}
+	for rows.Next() {
+		var neighbor Neighbor
+		var thumbnailPath, collectionID *string
+		var capturedAt *time.Time
+		if err := rows.Scan(&neighbor.AssetID, &neighbor.Filename, &neighbor.MimeType, &thumbnailPath, &collectionID,
+			&capturedAt, &neighbor.SharedTags, &neighbor.SameCollection, &neighbor.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan metadata neighbor: %v", err)
+		}
+		if thumbnailPath != nil {
+			neighbor.ThumbnailPath = *thumbnailPath
+		}
+		if collectionID != nil {
+			neighbor.CollectionID = *collectionID
+		}
+		if capturedAt != nil {
+			neighbor.CapturedAt = *capturedAt
+		}
+		neighbors = append(neighbors, neighbor)
+	}
+	return neighbors, rows.Err()
+}
@@ -0,0 +1,223 @@
+package fulltext
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"dataflux/query-service/pkg/querysyntax"
+)
+
+// assetText and featureText are the lower-cased texts behind the trigram
+// indexes used by wildcard and fuzzy terms
+func assetText(prefix string) string {
+	return fmt.Sprintf(`lower(coalesce(%[1]sfilename, '') || ' ' || coalesce(%[1]supload_context, ''))`, prefix)
+}
+
+func featureText(prefix string) string {
+	return fmt.Sprintf(`lower(%sfeature_data::text)`, prefix)
+}
+
+// osaDistanceFunction is the optimal string alignment distance: Levenshtein
+// plus adjacent transpositions. It only runs on rows the trigram index has
+// already narrowed down.
+const osaDistanceFunction = `
+CREATE OR REPLACE FUNCTION osa_distance(a text, b text) RETURNS integer AS $$
+DECLARE
+	la integer := length(a);
+	lb integer := length(b);
+	w integer := length(b) + 1;
+	d integer[];
+	cost integer;
+BEGIN
+	IF la = 0 THEN RETURN lb; END IF;
+	IF lb = 0 THEN RETURN la; END IF;
+	d := array_fill(0, ARRAY[(la + 1) * w]);
+	FOR i IN 0..la LOOP d[i * w + 1] := i; END LOOP;
+	FOR j IN 0..lb LOOP d[j + 1] := j; END LOOP;
+	FOR i IN 1..la LOOP
+		FOR j IN 1..lb LOOP
+			cost := CASE WHEN substr(a, i, 1) = substr(b, j, 1) THEN 0 ELSE 1 END;
+			d[i * w + j + 1] := least(d[(i - 1) * w + j + 1] + 1, d[i * w + j] + 1, d[(i - 1) * w + j] + cost);
+			IF i > 1 AND j > 1 AND substr(a, i, 1) = substr(b, j - 1, 1) AND substr(a, i - 1, 1) = substr(b, j, 1) THEN
+				d[i * w + j + 1] := least(d[i * w + j + 1], d[(i - 2) * w + j - 1] + 1);
+			END IF;
+		END LOOP;
+	END LOOP;
+	RETURN d[la * w + lb + 1];
+END
+$$ LANGUAGE plpgsql IMMUTABLE STRICT`
+
+// WildcardRegex turns a wildcard term into a PostgreSQL regular expression
+// anchored at word boundaries, which pg_trgm can answer from the index
+func WildcardRegex(pattern string) string {
+	var parts []string
+	for _, part := range strings.Split(strings.ToLower(pattern), "*") {
+		if part != "" {
+			parts = append(parts, regexp.QuoteMeta(part))
+		}
+	}
+	expression := `\m` + strings.Join(parts, `[[:alnum:]]*`)
+	if !strings.HasSuffix(pattern, "*") {
+		expression += `\M`
+	}
+	return expression
+}
+
+// FuzzyThreshold is the trigram word similarity a word within the term's
+// edit distance is guaranteed to reach: a word of n characters has n+1
+// trigrams and one edit changes at most four of them
+func FuzzyThreshold(fuzzy querysyntax.Fuzzy) float64 {
+	trigrams := float64(utf8.RuneCountInString(fuzzy.Term) + 1)
+	threshold := (trigrams - 4*float64(fuzzy.Distance)) / trigrams
+	if threshold < 0.1 {
+		return 0.1
+	}
+	return threshold
+}
+
+// BuildExclusionTSQuery turns excluded terms into a to_tsquery expression
+// matching any of them. Unlike keywords, they are matched as whole words,
+// so excluding "car" leaves "cartoon" alone.
+func BuildExclusionTSQuery(terms []string) string {
+	var alternatives []string
+	seen := map[string]bool{}
+	for _, term := range terms {
+		words := lexemes(term)
+		if len(words) == 0 {
+			continue
+		}
+		alternative := strings.Join(words, " & ")
+		if len(words) > 1 {
+			alternative = "(" + alternative + ")"
+		}
+		if !seen[alternative] {
+			seen[alternative] = true
+			alternatives = append(alternatives, alternative)
+		}
+	}
+	return strings.Join(alternatives, " | ")
+}
+
+// exclusionSQL returns the conditions leaving out asset and segment hits
+// that match the exclusion tsquery in the numbered argument. An asset is
+// left out when its text or any of its features match; a segment when the
+// asset's text, its own features or the asset-level features do.
+func exclusionSQL(arg int) (asset, segment string) {
+	excluded := fmt.Sprintf(`to_tsquery('simple', $%d)`, arg)
+	notAssetText := `
+		  AND NOT ` + assetVector("simple", "a.") + ` @@ ` + excluded
+	asset = notAssetText + `
+		  AND NOT EXISTS (SELECT 1 FROM features xf WHERE xf.asset_id = a.id AND ` + featureVector("simple", "xf.") + ` @@ ` + excluded + `)`
+	segment = notAssetText + `
+		  AND NOT EXISTS (SELECT 1 FROM features xf WHERE xf.asset_id = a.id AND (xf.segment_id IS NULL OR xf.segment_id = s.id)
+		                  AND ` + featureVector("simple", "xf.") + ` @@ ` + excluded + `)`
+	return asset, segment
+}
+
+// matchClause builds the match condition and rank expression for a query.
+// Phrases and proximity pairs are required; of the keywords, wildcard and
+// fuzzy terms any one has to match. Words are matched in the text search
+// configuration config.
+type matchClause struct {
+	config    string
+	args      []interface{}
+	required  string
+	keywords  string
+	ranked    string
+	regexes   string
+	fuzzy     [][2]string
+	threshold float64
+}
+
+func newMatchClause(query Query, firstArg int) *matchClause {
+	m := &matchClause{config: "simple"}
+	next := func(value interface{}) string {
+		m.args = append(m.args, value)
+		return "$" + strconv.Itoa(firstArg+len(m.args)-1)
+	}
+
+	required := BuildPositionalTSQuery(query.Phrases, query.Near)
+	if required != "" {
+		m.required = next(required)
+	}
+	keywords := BuildTSQuery(query.Keywords)
+	if keywords != "" {
+		m.keywords = next(keywords)
+	}
+
+	var prefixes []string
+	for _, pattern := range query.Wildcards {
+		prefixes = append(prefixes, querysyntax.WildcardPrefix(pattern))
+	}
+	var ranked []string
+	for _, part := range []string{required, keywords, BuildTSQuery(prefixes)} {
+		if part != "" {
+			ranked = append(ranked, "("+part+")")
+		}
+	}
+	if len(ranked) > 0 {
+		m.ranked = next(strings.Join(ranked, " | "))
+	}
+
+	if len(query.Wildcards) > 0 {
+		regexes := make([]string, 0, len(query.Wildcards))
+		for _, pattern := range query.Wildcards {
+			regexes = append(regexes, WildcardRegex(pattern))
+		}
+		m.regexes = next(regexes)
+	}
+	for _, fuzzy := range query.Fuzzy {
+		m.fuzzy = append(m.fuzzy, [2]string{next(fuzzy.Term), next(fuzzy.Distance)})
+		if threshold := FuzzyThreshold(fuzzy); m.threshold == 0 || threshold < m.threshold {
+			m.threshold = threshold
+		}
+	}
+	return m
+}
+
+func (m *matchClause) empty() bool {
+	return m.required == "" && m.keywords == "" && m.regexes == "" && len(m.fuzzy) == 0
+}
+
+// where is the match condition against one tsvector and trigram-indexed text
+func (m *matchClause) where(vector, text string) string {
+	var alternatives []string
+	if m.keywords != "" {
+		alternatives = append(alternatives, vector+` @@ to_tsquery('`+m.config+`', `+m.keywords+`)`)
+	}
+	if m.regexes != "" {
+		alternatives = append(alternatives, text+` ~ ANY(`+m.regexes+`::text[])`)
+	}
+	for _, fuzzy := range m.fuzzy {
+		alternatives = append(alternatives, fmt.Sprintf(
+			`(%[1]s::text <%% %[3]s AND EXISTS (SELECT 1 FROM regexp_split_to_table(%[3]s, '[^[:alnum:]]+') AS word WHERE osa_distance(word, %[1]s::text) <= %[2]s::int))`,
+			fuzzy[0], fuzzy[1], text))
+	}
+
+	var conditions []string
+	if m.required != "" {
+		conditions = append(conditions, vector+` @@ to_tsquery('`+m.config+`', `+m.required+`)`)
+	}
+	if len(alternatives) > 0 {
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// rank scores a match by ts_rank plus the word similarity of fuzzy terms
+func (m *matchClause) rank(vector, text string) string {
+	var parts []string
+	if m.ranked != "" {
+		parts = append(parts, `ts_rank(`+vector+`, to_tsquery('`+m.config+`', `+m.ranked+`))`)
+	}
+	for _, fuzzy := range m.fuzzy {
+		parts = append(parts, `word_similarity(`+fuzzy[0]+`::text, `+text+`)`)
+	}
+	if len(parts) == 0 {
+		return "0::real"
+	}
+	return strings.Join(parts, " + ")
+}
@@ -0,0 +1,72 @@
+package fulltext
+
+import (
+	"testing"
+
+	"dataflux/query-service/pkg/querysyntax"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWildcardRegex(t *testing.T) {
+	assert.Equal(t, `\mrepor`, WildcardRegex("repor*"))
+	assert.Equal(t, `\mcol[[:alnum:]]*r\M`, WildcardRegex("Col*r"))
+}
+
+func TestFuzzyThresholdAdmitsTransposition(t *testing.T) {
+	// "reprot" and "report" share 3 of 7 trigrams
+	assert.InDelta(t, 3.0/7, FuzzyThreshold(querysyntax.Fuzzy{Term: "reprot", Distance: 1}), 1e-9)
+	assert.Equal(t, 0.1, FuzzyThreshold(querysyntax.Fuzzy{Term: "abc", Distance: 2}))
+}
+
+func TestMatchClause(t *testing.T) {
+	match := newMatchClause(Query{
+		Keywords:  []string{"budget"},
+		Phrases:   [][]string{{"prime", "minister"}},
+		Wildcards: []string{"repor*"},
+		Fuzzy:     []querysyntax.Fuzzy{{Term: "reprot", Distance: 1}},
+	}, 7)
+
+	assert.Equal(t, []interface{}{
+		"(prime <-> minister)",
+		"budget:*",
+		"((prime <-> minister)) | (budget:*) | (repor:*)",
+		[]string{`\mrepor`},
+		"reprot",
+		1,
+	}, match.args)
+	assert.Equal(t, "v @@ to_tsquery('simple', $7) AND (v @@ to_tsquery('simple', $8) OR t ~ ANY($10::text[]) OR "+
+		"($11::text <% t AND EXISTS (SELECT 1 FROM regexp_split_to_table(t, '[^[:alnum:]]+') AS word WHERE osa_distance(word, $11::text) <= $12::int)))",
+		match.where("v", "t"))
+	assert.Equal(t, "ts_rank(v, to_tsquery('simple', $9)) + word_similarity($11::text, t)", match.rank("v", "t"))
+
+	assert.True(t, newMatchClause(Query{Keywords: []string{"!!"}}, 7).empty())
+}
+
+func TestStemmedLanguages(t *testing.T) {
+	store := NewStore(nil).WithStemming(map[string]string{"de": "german"})
+	assert.Equal(t, "german", store.textSearchConfig("de-AT"))
+	assert.Equal(t, "german", store.ForTenant("acme").textSearchConfig("DE"))
+	assert.Equal(t, "simple", store.textSearchConfig("fr"))
+	assert.Equal(t, "simple", store.textSearchConfig(""))
+
+	hits, ok := store.newHitsSQL(Query{Keywords: []string{"häuser"}, Language: "de"})
+	require.True(t, ok)
+	assert.Contains(t, hits.sql, assetVector("german", "a.")+" @@ to_tsquery('german', $2)")
+	assert.Contains(t, hits.sql, featureVector("german", "f.")+" @@ to_tsquery('german', $2)")
+
+	hits, ok = store.newHitsSQL(Query{Keywords: []string{"maisons"}, Language: "fr"})
+	require.True(t, ok)
+	assert.Contains(t, hits.sql, assetVector("simple", "a.")+" @@ to_tsquery('simple', $2)")
+}
+
+func TestExclusion(t *testing.T) {
+	assert.Equal(t, "", BuildExclusionTSQuery([]string{"!!"}))
+	assert.Equal(t, "people | (red & car)", BuildExclusionTSQuery([]string{"People", "red car", "people"}))
+
+	asset, segment := exclusionSQL(9)
+	assert.Contains(t, asset, "AND NOT "+assetVector("simple", "a.")+" @@ to_tsquery('simple', $9)")
+	assert.Contains(t, asset, "FROM features xf WHERE xf.asset_id = a.id AND "+featureVector("simple", "xf.")+" @@ to_tsquery('simple', $9)")
+	assert.Contains(t, segment, "(xf.segment_id IS NULL OR xf.segment_id = s.id)")
+}
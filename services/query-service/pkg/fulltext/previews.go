@@ -0,0 +1,48 @@
+package fulltext
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"dataflux/query-service/pkg/storage"
+)
+
+// SpriteManifests returns the preview sprite manifests of the assets among
+// assetIDs that have one. Manifests that do not validate are skipped.
+func (s *Store) SpriteManifests(ctx context.Context, assetIDs []string) (map[string]storage.SpriteManifest, error) {
+	manifests := map[string]storage.SpriteManifest{}
+	if len(assetIDs) == 0 {
+		return manifests, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT e.id::text, e.metadata->'preview_sprites'
+		FROM entities e
+		WHERE e.id::text = ANY($1) AND jsonb_typeof(e.metadata->'preview_sprites') = 'object'
+		  AND `+fmt.Sprintf(TenantCondition, 2), assetIDs, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up preview sprites: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var assetID string
+		var raw []byte
+		if err := rows.Scan(&assetID, &raw); err != nil {
+			return nil, fmt.Errorf("failed to scan preview sprites: %v", err)
+		}
+		var manifest storage.SpriteManifest
+		if err := json.Unmarshal(raw, &manifest); err != nil {
+			log.Printf("Warning: preview sprites of asset %s are unreadable: %v", assetID, err)
+			continue
+		}
+		if err := manifest.Validate(); err != nil {
+			log.Printf("Warning: preview sprites of asset %s are invalid: %v", assetID, err)
+			continue
+		}
+		manifests[assetID] = manifest
+	}
+	return manifests, rows.Err()
+}
@@ -0,0 +1,128 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/filter"
+)
+
+// Features record the analyzer that produced them in analyzer_version and
+// the model version it reported in model_version, which is NULL for
+// features written before model versions were recorded. featureModel names
+// the model as <analyzer>@<model version>, or just the analyzer without one.
+const (
+	featureAnalyzerColumn = "f.analyzer_version"
+	featureModelColumn    = "f.model_version"
+	featureModel          = "COALESCE(f.analyzer_version || '@' || f.model_version, f.analyzer_version)"
+)
+
+// Provenance restricts segment hits to features produced by some analyzers
+// or models, or leaves out those of others. Models name one model version
+// of an analyzer as <analyzer>@<model version>.
+type Provenance struct {
+	Analyzers        []string `json:"analyzers,omitempty"`
+	Models           []string `json:"models,omitempty"`
+	ExcludeAnalyzers []string `json:"exclude_analyzers,omitempty"`
+	ExcludeModels    []string `json:"exclude_models,omitempty"`
+}
+
+// Empty reports whether the provenance restricts nothing
+func (p Provenance) Empty() bool {
+	return len(p.Analyzers) == 0 && len(p.Models) == 0 && len(p.ExcludeAnalyzers) == 0 && len(p.ExcludeModels) == 0
+}
+
+// Validate checks the analyzer and model names
+func (p Provenance) Validate() error {
+	for name, values := range map[string][]string{
+		"analyzers":         p.Analyzers,
+		"models":            p.Models,
+		"exclude_analyzers": p.ExcludeAnalyzers,
+		"exclude_models":    p.ExcludeModels,
+	} {
+		if len(values) > filter.MaxValues {
+			return fmt.Errorf("provenance %s allows at most %d values", name, filter.MaxValues)
+		}
+		model := strings.HasSuffix(name, "models")
+		for _, value := range values {
+			analyzer, version, versioned := strings.Cut(value, "@")
+			switch {
+			case analyzer == "":
+				return fmt.Errorf("provenance %s must not hold empty analyzer names", name)
+			case model && (!versioned || version == ""):
+				return fmt.Errorf("provenance %s must be given as <analyzer>@<model version>, got %q", name, value)
+			case !model && versioned:
+				return fmt.Errorf("provenance %s takes analyzer names without a model version, got %q", name, value)
+			}
+		}
+	}
+	return nil
+}
+
+// provenanceSQL returns the conditions a feature f must meet, with their
+// arguments numbered from first
+func provenanceSQL(p Provenance, first int) (string, []interface{}) {
+	conditions := fmt.Sprintf(`
+			  AND ($%[1]d::text[] IS NULL OR %[5]s = ANY($%[1]d))
+			  AND ($%[2]d::text[] IS NULL OR %[6]s = ANY($%[2]d))
+			  AND %[5]s <> ALL(COALESCE($%[3]d::text[], '{}'))
+			  AND %[6]s <> ALL(COALESCE($%[4]d::text[], '{}'))`,
+		first, first+1, first+2, first+3, featureAnalyzerColumn, featureModel)
+	return conditions, []interface{}{
+		nullIfEmpty(p.Analyzers), nullIfEmpty(p.Models), nullIfEmpty(p.ExcludeAnalyzers), nullIfEmpty(p.ExcludeModels),
+	}
+}
+
+// ModelCoverage counts what one model version of an analyzer detected
+type ModelCoverage struct {
+	Analyzer string `json:"analyzer"`
+	// ModelVersion is empty for features that did not record one
+	ModelVersion  string    `json:"model_version"`
+	Features      int64     `json:"features"`
+	Segments      int64     `json:"segments"`
+	Assets        int64     `json:"assets"`
+	AvgConfidence float64   `json:"avg_confidence"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// ModelCoverage returns per analyzer and model version how many features,
+// segments and assets it produced, most features first. A non-nil
+// collectionIDs only counts assets in those collections.
+func (s *Store) ModelCoverage(ctx context.Context, collectionIDs []string) ([]ModelCoverage, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+featureAnalyzerColumn+`, COALESCE(`+featureModelColumn+`, ''),
+		       count(*), count(DISTINCT f.segment_id), count(DISTINCT f.asset_id),
+		       COALESCE(avg(f.confidence), 0), min(f.created_at), max(f.created_at)
+		FROM features f
+		JOIN entities e ON e.id = f.asset_id
+		WHERE ($1::text[] IS NULL OR e.parent_id::text = ANY($1))
+		  AND `+fmt.Sprintf(TenantCondition, 2)+`
+		GROUP BY 1, 2
+		ORDER BY 3 DESC, 1, 2
+	`, collectionIDs, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count model coverage: %v", err)
+	}
+	defer rows.Close()
+
+	coverage := []ModelCoverage{}
+	for rows.Next() {
+		var row ModelCoverage
+		var firstSeen, lastSeen *time.Time
+		if err := rows.Scan(&row.Analyzer, &row.ModelVersion, &row.Features, &row.Segments, &row.Assets,
+			&row.AvgConfidence, &firstSeen, &lastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan model coverage: %v", err)
+		}
+		if firstSeen != nil {
+			row.FirstSeen = *firstSeen
+		}
+		if lastSeen != nil {
+			row.LastSeen = *lastSeen
+		}
+		coverage = append(coverage, row)
+	}
+	return coverage, rows.Err()
+}
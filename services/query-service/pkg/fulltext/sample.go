@@ -0,0 +1,134 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+)
+
+// Strata a sample can be balanced over, mapped to their expressions; assets
+// are aliased a, their entities e and segments s
+var sampleStrata = map[string]string{
+	"mime_type":     "a.mime_type",
+	"collection_id": "COALESCE(e.parent_id::text, '')",
+	"segment_type":  "s.segment_type",
+}
+
+// SampleQuery draws a uniform random sample of the assets, or segments,
+// matching the filters
+type SampleQuery struct {
+	Segments bool
+	Filters  Filters
+	// Size is the number drawn, per stratum when Stratify is set
+	Size int
+	// Seed fixes the draw: the same seed over the same corpus draws the same
+	// sample, and a new seed an independent one
+	Seed string
+	// Stratify draws Size from each value of mime_type, collection_id or,
+	// for segments, segment_type, so rare values are not drowned out
+	Stratify      string
+	HideEmbargoed bool
+}
+
+// Sample is an asset, or a segment of one, drawn into a sample
+type Sample struct {
+	AssetID      string
+	SegmentID    string
+	SegmentType  string
+	Filename     string
+	MimeType     string
+	CollectionID string
+	StartTime    float64
+	EndTime      float64
+	// Stratum is the value of the stratified column the sample was drawn for
+	Stratum string
+}
+
+// ValidStratum reports whether a sample of assets, or of segments, can be
+// stratified by the column; empty means unstratified
+func ValidStratum(stratify string, segments bool) bool {
+	if stratify == "" {
+		return true
+	}
+	if stratify == "segment_type" {
+		return segments
+	}
+	_, ok := sampleStrata[stratify]
+	return ok
+}
+
+// Sample draws the sample and returns it with the number of matching assets
+// or segments it was drawn from. Every match gets a key hashed from its ID
+// and the seed, and the lowest keys are kept, which is reservoir sampling
+// in a single pass that PostgreSQL can run for the whole corpus.
+func (s *Store) Sample(ctx context.Context, query SampleQuery) ([]Sample, int64, error) {
+	stratum := "''"
+	if query.Stratify != "" {
+		if !ValidStratum(query.Stratify, query.Segments) {
+			return nil, 0, fmt.Errorf("cannot stratify by %s", query.Stratify)
+		}
+		stratum = sampleStrata[query.Stratify]
+	}
+
+	conditions, filterArgs := filterSQL(query.Filters.Clauses, 5)
+	args := append([]interface{}{nullIfEmpty(query.Filters.MimePatterns), s.tenant, query.Seed, query.Size}, filterArgs...)
+	id := "a.id"
+	from := `assets a
+			JOIN entities e ON e.id = a.id`
+	columns := `a.id::text AS asset_id, NULL::text AS segment_id, NULL::text AS segment_type,
+			       0::float8 AS start_time, 0::float8 AS end_time`
+	if query.Segments {
+		id = "s.id"
+		from = `segments s
+			JOIN assets a ON a.id = s.asset_id
+			JOIN entities e ON e.id = a.id`
+		columns = `a.id::text AS asset_id, s.id::text AS segment_id, s.segment_type,
+			       COALESCE((s.start_marker->>'time')::float, 0) AS start_time,
+			       COALESCE((s.end_marker->>'time')::float, 0) AS end_time`
+	}
+	embargo := ""
+	if query.HideEmbargoed {
+		embargo = `
+			  AND NOT ` + EmbargoActive
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT asset_id, segment_id, segment_type, filename, mime_type, collection_id, start_time, end_time, stratum, population
+		FROM (
+			SELECT `+columns+`, a.filename, a.mime_type, e.parent_id::text AS collection_id,
+			       `+stratum+` AS stratum,
+			       row_number() OVER (PARTITION BY `+stratum+` ORDER BY md5(`+id+`::text || $3), `+id+`) AS draw,
+			       count(*) OVER () AS population
+			FROM `+from+`
+			WHERE ($1::text[] IS NULL OR a.mime_type LIKE ANY($1))`+conditions+`
+			  AND `+fmt.Sprintf(TenantCondition, 2)+embargo+`
+		) drawn
+		WHERE draw <= $4
+		ORDER BY stratum, draw
+	`, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to draw sample: %v", err)
+	}
+	defer rows.Close()
+
+	samples := []Sample{}
+	var population int64
+	for rows.Next() {
+		var sample Sample
+		var segmentID, segmentType, collectionID *string
+		if err := rows.Scan(&sample.AssetID, &segmentID, &segmentType, &sample.Filename, &sample.MimeType,
+			&collectionID, &sample.StartTime, &sample.EndTime, &sample.Stratum, &population); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan sample: %v", err)
+		}
+		if segmentID != nil {
+			sample.SegmentID = *segmentID
+		}
+		if segmentType != nil {
+			sample.SegmentType = *segmentType
+		}
+		if collectionID != nil {
+			sample.CollectionID = *collectionID
+		}
+		samples = append(samples, sample)
+	}
+	return samples, population, rows.Err()
+}
@@ -0,0 +1,68 @@
+package fulltext
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// CountAssets returns how many distinct assets match the query, ignoring its
+// paging. The count reads every hit, so it costs about as much as the search
+// without a limit.
+func (s *Store) CountAssets(ctx context.Context, query Query) (int64, error) {
+	union, ok := s.newHitsSQL(query)
+	if !ok {
+		return 0, nil
+	}
+	tx, err := s.begin(ctx, union)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count full-text hits: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var count int64
+	if err := tx.QueryRow(ctx, `SELECT count(DISTINCT asset_id) FROM (`+union.sql+`
+		) hits`, union.args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count full-text hits: %v", err)
+	}
+	return count, nil
+}
+
+// EstimateAssets returns the planner's estimate of how many distinct assets
+// match the query. Nothing is executed, so it is as cheap as planning the
+// search and as good as the table statistics ANALYZE last gathered.
+func (s *Store) EstimateAssets(ctx context.Context, query Query) (int64, error) {
+	union, ok := s.newHitsSQL(query)
+	if !ok {
+		return 0, nil
+	}
+	tx, err := s.begin(ctx, union)
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate full-text hits: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var plan []byte
+	if err := tx.QueryRow(ctx, `EXPLAIN (FORMAT JSON) SELECT DISTINCT asset_id FROM (`+union.sql+`
+		) hits`, union.args...).Scan(&plan); err != nil {
+		return 0, fmt.Errorf("failed to estimate full-text hits: %v", err)
+	}
+	return planRows(plan)
+}
+
+// planRows reads the estimated rows of the top node of a JSON query plan
+func planRows(plan []byte) (int64, error) {
+	var plans []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &plans); err != nil {
+		return 0, fmt.Errorf("failed to parse query plan: %v", err)
+	}
+	if len(plans) == 0 {
+		return 0, fmt.Errorf("failed to parse query plan: no plan")
+	}
+	return int64(math.Round(plans[0].Plan.Rows)), nil
+}
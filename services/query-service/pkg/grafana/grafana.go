@@ -0,0 +1,214 @@
+package grafana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/analytics"
+	"dataflux/query-service/pkg/clickhouse"
+)
+
+// TopQueriesTarget is the table of the most frequent queries since the
+// range starts
+const TopQueriesTarget = "top_queries"
+
+// Bounds of a response: rows of the top queries table and annotations
+const (
+	topQueriesLimit  = 100
+	annotationsLimit = 500
+)
+
+// ErrInvalidRequest is returned for requests naming unknown targets or
+// invalid ranges
+var ErrInvalidRequest = errors.New("invalid request")
+
+// Range is the time range of a panel
+type Range struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Target is a metric a panel charts
+type Target struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	// Type is timeserie or table
+	Type string `json:"type"`
+}
+
+// QueryRequest is the body of /query
+type QueryRequest struct {
+	Range         Range    `json:"range"`
+	IntervalMs    int64    `json:"intervalMs"`
+	MaxDataPoints int64    `json:"maxDataPoints"`
+	Targets       []Target `json:"targets"`
+}
+
+// TimeSeries is a metric as [value, unix milliseconds] pairs
+type TimeSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// Column is a column of a table response
+type Column struct {
+	Text string `json:"text"`
+	// Type is string, number or time
+	Type string `json:"type"`
+}
+
+// Table is a table response
+type Table struct {
+	Type    string          `json:"type"`
+	Columns []Column        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// SearchRequest is the body of /search
+type SearchRequest struct {
+	Target string `json:"target"`
+}
+
+// AnnotationQuery is the annotation a dashboard asks for; Query is a
+// resource prefix such as /api/v1/admin, empty for every audited request
+type AnnotationQuery struct {
+	Name   string `json:"name"`
+	Query  string `json:"query"`
+	Enable bool   `json:"enable"`
+}
+
+// AnnotationRequest is the body of /annotations
+type AnnotationRequest struct {
+	Range      Range           `json:"range"`
+	Annotation AnnotationQuery `json:"annotation"`
+}
+
+// Annotation marks an audited request on a dashboard
+type Annotation struct {
+	Annotation AnnotationQuery `json:"annotation"`
+	// Time is in unix milliseconds
+	Time  int64    `json:"time"`
+	Title string   `json:"title"`
+	Text  string   `json:"text"`
+	Tags  []string `json:"tags"`
+}
+
+// Datasource serves the search log and audit trail in the contract of
+// Grafana's JSON datasources
+type Datasource struct {
+	client *clickhouse.Client
+}
+
+// NewDatasource creates a datasource over the analytics ClickHouse
+func NewDatasource(client *clickhouse.Client) *Datasource {
+	return &Datasource{client: client}
+}
+
+// Search lists the targets whose name contains the given text
+func (d *Datasource) Search(text string) []string {
+	names := []string{}
+	for _, name := range append(analytics.SeriesMetrics(), TopQueriesTarget) {
+		if strings.Contains(name, text) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Query returns a TimeSeries or Table per target. Series are aggregated in
+// steps of the panel's interval, widened so there are no more points than
+// it can draw.
+func (d *Datasource) Query(ctx context.Context, req QueryRequest) ([]interface{}, error) {
+	if !req.Range.To.After(req.Range.From) {
+		return nil, fmt.Errorf("%w: range must end after it starts", ErrInvalidRequest)
+	}
+	step := time.Duration(req.IntervalMs) * time.Millisecond
+	if req.MaxDataPoints > 0 {
+		if minimum := req.Range.To.Sub(req.Range.From) / time.Duration(req.MaxDataPoints); step < minimum {
+			step = minimum
+		}
+	}
+
+	responses := []interface{}{}
+	for _, target := range req.Targets {
+		if target.Target == TopQueriesTarget {
+			table, err := d.topQueries(ctx, req.Range)
+			if err != nil {
+				return nil, err
+			}
+			responses = append(responses, table)
+			continue
+		}
+		if !isSeriesMetric(target.Target) {
+			return nil, fmt.Errorf("%w: unknown target %q", ErrInvalidRequest, target.Target)
+		}
+		points, err := analytics.SearchSeries(ctx, d.client, target.Target, req.Range.From, req.Range.To, step)
+		if err != nil {
+			return nil, err
+		}
+		series := TimeSeries{Target: target.Target, Datapoints: make([][2]float64, 0, len(points))}
+		for _, point := range points {
+			series.Datapoints = append(series.Datapoints, [2]float64{point.Value, float64(point.Time.UnixMilli())})
+		}
+		responses = append(responses, series)
+	}
+	return responses, nil
+}
+
+func (d *Datasource) topQueries(ctx context.Context, span Range) (Table, error) {
+	stats, err := analytics.SearchStats(ctx, d.client, span.From, topQueriesLimit)
+	if err != nil {
+		return Table{}, err
+	}
+	table := Table{
+		Type:    "table",
+		Columns: []Column{{Text: "Query", Type: "string"}, {Text: "Searches", Type: "number"}, {Text: "Zero results", Type: "number"}},
+		Rows:    [][]interface{}{},
+	}
+	for _, query := range stats.TopQueries {
+		table.Rows = append(table.Rows, []interface{}{query.Query, query.Searches, query.ZeroResults})
+	}
+	return table, nil
+}
+
+// Annotations marks the audited requests in the range whose resource
+// starts with the annotation's query, newest first
+func (d *Datasource) Annotations(ctx context.Context, req AnnotationRequest) ([]Annotation, error) {
+	if !req.Range.To.After(req.Range.From) {
+		return nil, fmt.Errorf("%w: range must end after it starts", ErrInvalidRequest)
+	}
+	events, err := analytics.AuditLog(ctx, d.client, req.Range.From, req.Range.To, strings.TrimSpace(req.Annotation.Query), annotationsLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := make([]Annotation, 0, len(events))
+	for _, event := range events {
+		status := strconv.Itoa(event.Status)
+		text := "Status " + status
+		if event.UserID != "" {
+			text = fmt.Sprintf("By %s, status %s", event.UserID, status)
+		}
+		annotations = append(annotations, Annotation{
+			Annotation: req.Annotation,
+			Time:       event.Timestamp.UnixMilli(),
+			Title:      event.Action + " " + event.Resource,
+			Text:       text,
+			Tags:       []string{strings.ToLower(event.Action), status},
+		})
+	}
+	return annotations, nil
+}
+
+func isSeriesMetric(name string) bool {
+	for _, metric := range analytics.SeriesMetrics() {
+		if metric == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package grafana
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	datasource := NewDatasource(clickhouse.NewClient("", "", "", ""))
+	assert.Equal(t, []string{"latency_p50_ms", "latency_p95_ms"}, datasource.Search("latency"))
+	assert.Contains(t, datasource.Search(""), TopQueriesTarget)
+}
+
+func TestQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(body), "toStartOfInterval"):
+			// An hour drawn in at most 60 points is charted by the minute
+			assert.Equal(t, "60", r.URL.Query().Get("param_step"))
+			w.Write([]byte(`{"data":[{"bucket":1772323200,"value":4},{"bucket":1772323260,"value":7}]}`))
+		case strings.Contains(string(body), "GROUP BY normalized"):
+			w.Write([]byte(`{"data":[{"normalized":"beach","searches":"40","zero_results":"2"}]}`))
+		default:
+			w.Write([]byte(`{"data":[{"searches":"40"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	datasource := NewDatasource(clickhouse.NewClient(server.URL, "", "", "dataflux"))
+	responses, err := datasource.Query(context.Background(), QueryRequest{
+		Range:         Range{From: from, To: from.Add(time.Hour)},
+		IntervalMs:    10000,
+		MaxDataPoints: 60,
+		Targets:       []Target{{Target: "searches", RefID: "A"}, {Target: TopQueriesTarget, RefID: "B", Type: "table"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	assert.Equal(t, TimeSeries{Target: "searches", Datapoints: [][2]float64{{4, 1772323200000}, {7, 1772323260000}}}, responses[0])
+	table := responses[1].(Table)
+	assert.Equal(t, "table", table.Type)
+	assert.Equal(t, []interface{}{"beach", int64(40), int64(2)}, table.Rows[0])
+
+	_, err = datasource.Query(context.Background(), QueryRequest{Range: Range{From: from, To: from.Add(time.Hour)}, Targets: []Target{{Target: "cpu"}}})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+	_, err = datasource.Query(context.Background(), QueryRequest{Range: Range{From: from, To: from}})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func TestAnnotations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/admin", r.URL.Query().Get("param_prefix"))
+		w.Write([]byte(`{"data":[{"timestamp":"2026-03-01 00:30:00.000","user_id":"ops","action":"PUT","resource":"/api/v1/admin/ranking/profiles/default","status":200}]}`))
+	}))
+	defer server.Close()
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	annotations, err := NewDatasource(clickhouse.NewClient(server.URL, "", "", "")).Annotations(context.Background(), AnnotationRequest{
+		Range:      Range{From: from, To: from.Add(time.Hour)},
+		Annotation: AnnotationQuery{Name: "Admin changes", Query: "/api/v1/admin", Enable: true},
+	})
+	require.NoError(t, err)
+	require.Len(t, annotations, 1)
+	assert.Equal(t, Annotation{
+		Annotation: AnnotationQuery{Name: "Admin changes", Query: "/api/v1/admin", Enable: true},
+		Time:       from.Add(30 * time.Minute).UnixMilli(),
+		Title:      "PUT /api/v1/admin/ranking/profiles/default",
+		Text:       "By ops, status 200",
+		Tags:       []string{"put", "200"},
+	}, annotations[0])
+}
@@ -0,0 +1,85 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+
+	"dataflux/query-service/pkg/graph/model"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/playground"
+)
+
+// Backend is the query service logic the resolvers delegate to, so GraphQL
+// shares search, caching and ranking with the REST and gRPC APIs
+type Backend interface {
+	// Search runs a search; withGraphContext batches segments and similar assets into the hits
+	Search(ctx context.Context, input model.SearchInput, withGraphContext bool) (*model.SearchResponse, error)
+	// Asset returns nil without an error when the asset does not exist
+	Asset(ctx context.Context, id string, withGraphContext bool) (*model.Asset, error)
+	// Segment returns nil without an error when the segment does not exist
+	Segment(ctx context.Context, id string) (*model.Segment, error)
+	Relationships(ctx context.Context, entityID string, limit int) ([]*model.Relationship, error)
+}
+
+// Resolver is the root resolver
+type Resolver struct {
+	Backend Backend
+}
+
+// graphContextFields are resolved from the batched graph context query
+var graphContextFields = []string{"segments", "related"}
+
+// selects reports whether the current field selects any of the given fields
+func selects(ctx context.Context, fields ...string) bool {
+	for _, child := range graphql.CollectFieldsCtx(ctx, nil) {
+		if containsField(fields, child.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsBelow reports whether the child field named parent selects any of
+// the given fields
+func selectsBelow(ctx context.Context, parent string, fields ...string) bool {
+	opCtx := graphql.GetOperationContext(ctx)
+	for _, child := range graphql.CollectFieldsCtx(ctx, nil) {
+		if child.Name != parent {
+			continue
+		}
+		for _, grandchild := range graphql.CollectFields(opCtx, child.Selections, nil) {
+			if containsField(fields, grandchild.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsField(fields []string, name string) bool {
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func limitOrDefault(limit *int, fallback int) int {
+	if limit == nil || *limit <= 0 {
+		return fallback
+	}
+	return *limit
+}
+
+// NewHandler serves the schema over HTTP with the given backend
+func NewHandler(backend Backend) http.Handler {
+	return handler.NewDefaultServer(NewExecutableSchema(Config{Resolvers: &Resolver{Backend: backend}}))
+}
+
+// NewPlaygroundHandler serves the GraphQL playground for the endpoint
+func NewPlaygroundHandler(endpoint string) http.Handler {
+	return playground.Handler("DataFlux GraphQL", endpoint)
+}
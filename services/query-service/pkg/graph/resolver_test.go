@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dataflux/query-service/pkg/graph/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBackend struct {
+	withGraphContext bool
+	relationshipIDs  []string
+}
+
+func (f *fakeBackend) Search(ctx context.Context, input model.SearchInput, withGraphContext bool) (*model.SearchResponse, error) {
+	f.withGraphContext = withGraphContext
+	return &model.SearchResponse{
+		Results: []*model.SearchHit{{
+			ID:       "asset-1",
+			Type:     "asset",
+			Score:    0.9,
+			Segments: []*model.Segment{{ID: "segment-1", EndTime: 4}},
+			Related:  []*model.RelatedAsset{},
+		}},
+		Total:   1,
+		Sources: []*model.SourceStatus{},
+	}, nil
+}
+
+func (f *fakeBackend) Asset(ctx context.Context, id string, withGraphContext bool) (*model.Asset, error) {
+	f.withGraphContext = withGraphContext
+	return nil, nil
+}
+
+func (f *fakeBackend) Segment(ctx context.Context, id string) (*model.Segment, error) {
+	return nil, nil
+}
+
+func (f *fakeBackend) Relationships(ctx context.Context, entityID string, limit int) ([]*model.Relationship, error) {
+	f.relationshipIDs = append(f.relationshipIDs, entityID)
+	return []*model.Relationship{{SourceID: entityID, TargetID: "asset-2", Type: "SIMILAR_TO", Strength: 0.8}}, nil
+}
+
+func query(t *testing.T, backend Backend, q string) map[string]interface{} {
+	body, _ := json.Marshal(map[string]string{"query": q})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	NewHandler(backend).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &out))
+	require.Nil(t, out["errors"])
+	return out["data"].(map[string]interface{})
+}
+
+func TestSearchFetchesGraphContextOnlyWhenSelected(t *testing.T) {
+	backend := &fakeBackend{}
+
+	query(t, backend, `{ search(input: {query: "sunset"}) { total results { id score } } }`)
+	assert.False(t, backend.withGraphContext)
+
+	data := query(t, backend, `{ search(input: {query: "sunset"}) { results { id segments { id endTime } } } }`)
+	assert.True(t, backend.withGraphContext)
+
+	hit := data["search"].(map[string]interface{})["results"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "segment-1", hit["segments"].([]interface{})[0].(map[string]interface{})["id"])
+}
+
+func TestNestedRelationships(t *testing.T) {
+	backend := &fakeBackend{}
+
+	query(t, backend, `{ search(input: {query: "sunset"}) { results { id relationships(limit: 5) { targetId type } } } }`)
+	assert.Equal(t, []string{"asset-1"}, backend.relationshipIDs)
+}
+
+func TestMissingAssetIsNull(t *testing.T) {
+	data := query(t, &fakeBackend{}, `{ asset(id: "missing") { id related { assetId } } }`)
+	assert.Nil(t, data["asset"])
+}
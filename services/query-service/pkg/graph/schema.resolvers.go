@@ -0,0 +1,58 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"dataflux/query-service/pkg/graph/model"
+)
+
+// Relationships is the resolver for the relationships field.
+func (r *assetResolver) Relationships(ctx context.Context, obj *model.Asset, limit *int) ([]*model.Relationship, error) {
+	return r.Backend.Relationships(ctx, obj.ID, limitOrDefault(limit, 20))
+}
+
+// Search is the resolver for the search field.
+func (r *queryResolver) Search(ctx context.Context, input model.SearchInput) (*model.SearchResponse, error) {
+	if strings.TrimSpace(input.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	return r.Backend.Search(ctx, input, selectsBelow(ctx, "results", graphContextFields...))
+}
+
+// Asset is the resolver for the asset field.
+func (r *queryResolver) Asset(ctx context.Context, id string) (*model.Asset, error) {
+	return r.Backend.Asset(ctx, id, selects(ctx, graphContextFields...))
+}
+
+// Segment is the resolver for the segment field.
+func (r *queryResolver) Segment(ctx context.Context, id string) (*model.Segment, error) {
+	return r.Backend.Segment(ctx, id)
+}
+
+// Relationships is the resolver for the relationships field.
+func (r *queryResolver) Relationships(ctx context.Context, entityID string, limit *int) ([]*model.Relationship, error) {
+	return r.Backend.Relationships(ctx, entityID, limitOrDefault(limit, 20))
+}
+
+// Relationships is the resolver for the relationships field.
+func (r *searchHitResolver) Relationships(ctx context.Context, obj *model.SearchHit, limit *int) ([]*model.Relationship, error) {
+	return r.Backend.Relationships(ctx, obj.ID, limitOrDefault(limit, 20))
+}
+
+// Asset returns AssetResolver implementation.
+func (r *Resolver) Asset() AssetResolver { return &assetResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// SearchHit returns SearchHitResolver implementation.
+func (r *Resolver) SearchHit() SearchHitResolver { return &searchHitResolver{r} }
+
+type assetResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type searchHitResolver struct{ *Resolver }
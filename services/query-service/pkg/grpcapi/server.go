@@ -0,0 +1,122 @@
+package grpcapi
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/tracing"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Caller identifies who issued a gRPC call; it is the gRPC counterpart of
+// the X-User-ID, X-User-Roles, X-Session-ID and traceparent headers on the
+// REST API. Roles are as claimed by the caller; only those of an
+// authenticated principal should be trusted.
+type Caller struct {
+	UserID    string
+	Roles     []string
+	SessionID string
+	Method    string
+	Span      tracing.SpanContext
+}
+
+type callerKey struct{}
+
+// CallerFromContext returns the caller stored by UnaryInterceptor
+func CallerFromContext(ctx context.Context) Caller {
+	if caller, ok := ctx.Value(callerKey{}).(Caller); ok {
+		return caller
+	}
+	return Caller{Span: tracing.NewRoot()}
+}
+
+// NewServer creates a gRPC server with caller identity, trace propagation,
+// panic recovery and request logging, plus the standard health and
+// reflection services
+func NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	// Our interceptor runs first so panics and traces cover the ones passed in
+	opts = append([]grpc.ServerOption{grpc.ChainUnaryInterceptor(UnaryInterceptor)}, opts...)
+	server := grpc.NewServer(opts...)
+
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	return server
+}
+
+// UnaryInterceptor reads the caller from the incoming metadata, continues or
+// starts a trace and turns panics into Internal errors
+func UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	ctx, otelSpan, span := tracing.StartServer(ctx, metadataCarrier(md), info.FullMethod, semconv.RPCSystemGRPC)
+	defer func() {
+		tracing.End(otelSpan, err)
+	}()
+
+	caller := Caller{
+		UserID:    first(md, "x-user-id"),
+		Roles:     ParseRoles(first(md, "x-user-roles")),
+		SessionID: first(md, "x-session-id"),
+		Method:    info.FullMethod,
+		Span:      span,
+	}
+	ctx = context.WithValue(ctx, callerKey{}, caller)
+	_ = grpc.SetHeader(ctx, metadata.Pairs("traceparent", span.Traceparent(), "x-trace-id", span.TraceID))
+
+	start := time.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			err = status.Errorf(codes.Internal, "panic: %v", p)
+		}
+		log.Printf("gRPC %s %s %v trace_id=%s span_id=%s", info.FullMethod, status.Code(err), time.Since(start), span.TraceID, span.SpanID)
+	}()
+
+	return handler(ctx, req)
+}
+
+// metadataCarrier reads trace context from incoming gRPC metadata
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	return first(metadata.MD(m), key)
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// ParseRoles splits a comma-separated role list into lower-case roles
+func ParseRoles(value string) []string {
+	var roles []string
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.ToLower(strings.TrimSpace(role)); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package grpcapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var info = &grpc.UnaryServerInfo{FullMethod: "/dataflux.query.v1.QueryService/Search"}
+
+func TestInterceptorExtractsCaller(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-user-id", "user-7",
+		"x-user-roles", "Editor, admin",
+		"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	))
+
+	var caller Caller
+	_, err := UnaryInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		caller = CallerFromContext(ctx)
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "user-7", caller.UserID)
+	assert.Equal(t, []string{"editor", "admin"}, caller.Roles)
+	assert.Equal(t, info.FullMethod, caller.Method)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", caller.Span.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", caller.Span.ParentSpanID)
+}
+
+func TestInterceptorRecoversPanics(t *testing.T) {
+	_, err := UnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestCallerFromContextWithoutInterceptor(t *testing.T) {
+	caller := CallerFromContext(context.Background())
+
+	assert.Empty(t, caller.UserID)
+	assert.NotEmpty(t, caller.Span.TraceID)
+}
@@ -0,0 +1,187 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// refusedWrites are the SQLSTATEs PostgreSQL refuses writes with for as
+// long as a condition lasts: 25006 on a standby or with
+// default_transaction_read_only set, 53100 when the disk is full and 42501
+// when the role lost its write privileges. Reads still work in all three.
+var refusedWrites = map[string]bool{
+	"25006": true,
+	"53100": true,
+	"42501": true,
+}
+
+// Mode describes what the service can currently do against PostgreSQL
+type Mode string
+
+const (
+	ModeReadWrite   Mode = "read_write"
+	ModeReadOnly    Mode = "read_only"
+	ModeUnavailable Mode = "unavailable"
+)
+
+// Status is a snapshot of the last write-capability check
+type Status struct {
+	Mode      Mode      `json:"mode"`
+	CheckedAt time.Time `json:"checked_at"`
+	Since     time.Time `json:"since"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// database is the part of the pool the probes use
+type database interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// WriteMonitor periodically probes PostgreSQL and flips the service into
+// read-only mode when the server refuses writes but reads still succeed
+type WriteMonitor struct {
+	pool     database
+	interval time.Duration
+	timeout  time.Duration
+	instance string
+
+	mu       sync.RWMutex
+	status   Status
+	onChange func(previous, current Status)
+}
+
+// NewWriteMonitor creates a new monitor; the service starts in read-write mode
+func NewWriteMonitor(pool *pgxpool.Pool, interval time.Duration) *WriteMonitor {
+	instance, _ := os.Hostname()
+	now := time.Now().UTC()
+	return &WriteMonitor{
+		pool:     pool,
+		interval: interval,
+		timeout:  3 * time.Second,
+		instance: instance,
+		status:   Status{Mode: ModeReadWrite, CheckedAt: now, Since: now},
+	}
+}
+
+// EnsureSchema creates the heartbeat table used by the write probe
+func (m *WriteMonitor) EnsureSchema(ctx context.Context) error {
+	_, err := m.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS query_service_heartbeat (
+			instance VARCHAR(255) PRIMARY KEY,
+			checked_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)
+	`)
+	return err
+}
+
+// OnModeChange registers a callback invoked after every mode transition
+func (m *WriteMonitor) OnModeChange(fn func(previous, current Status)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = fn
+}
+
+// Start runs the probe loop until ctx is cancelled
+func (m *WriteMonitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		m.Check(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.Check(ctx)
+			}
+		}
+	}()
+}
+
+// Check probes reads and writes once and updates the mode
+func (m *WriteMonitor) Check(ctx context.Context) Status {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	mode, reason := m.probe(ctx)
+
+	m.mu.Lock()
+	previous := m.status
+	now := time.Now().UTC()
+	if mode == "" {
+		// The probe was inconclusive; keep the mode but report why
+		mode = m.status.Mode
+	}
+	if mode != m.status.Mode {
+		log.Printf("PostgreSQL mode changed from %s to %s: %s", m.status.Mode, mode, reason)
+		m.status.Since = now
+	}
+	m.status.Mode = mode
+	m.status.Reason = reason
+	m.status.CheckedAt = now
+	current, onChange := m.status, m.onChange
+	m.mu.Unlock()
+
+	if onChange != nil && previous.Mode != current.Mode {
+		onChange(previous, current)
+	}
+	return current
+}
+
+func (m *WriteMonitor) probe(ctx context.Context) (Mode, string) {
+	var one int
+	if err := m.pool.QueryRow(ctx, "SELECT 1").Scan(&one); err != nil {
+		return ModeUnavailable, fmt.Sprintf("read probe failed: %v", err)
+	}
+
+	var inRecovery bool
+	if err := m.pool.QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery); err == nil && inRecovery {
+		return ModeReadOnly, "server is in recovery"
+	}
+
+	_, err := m.pool.Exec(ctx, `
+		INSERT INTO query_service_heartbeat (instance, checked_at)
+		VALUES ($1, NOW())
+		ON CONFLICT (instance) DO UPDATE SET checked_at = EXCLUDED.checked_at
+	`, m.instance)
+	if err != nil {
+		// Only a refused write means the server is read-only; timeouts, lock
+		// waits and dropped connections say nothing about the mode
+		if readOnlyError(err) {
+			return ModeReadOnly, fmt.Sprintf("write probe failed: %v", err)
+		}
+		return "", fmt.Sprintf("write probe inconclusive: %v", err)
+	}
+
+	return ModeReadWrite, ""
+}
+
+// readOnlyError reports whether err is PostgreSQL refusing a write until
+// the server, its disk or the role's privileges change
+func readOnlyError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && refusedWrites[pgErr.Code]
+}
+
+// Status returns the last known status
+func (m *WriteMonitor) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// Writable reports whether mutating requests should be accepted
+func (m *WriteMonitor) Writable() bool {
+	return m.Status().Mode == ModeReadWrite
+}
@@ -0,0 +1,130 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRow struct {
+	value interface{}
+	err   error
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	switch d := dest[0].(type) {
+	case *int:
+		*d = r.value.(int)
+	case *bool:
+		*d = r.value.(bool)
+	}
+	return nil
+}
+
+// fakeDatabase answers the read probe, the recovery check and the heartbeat
+// write with the configured errors
+type fakeDatabase struct {
+	readErr    error
+	inRecovery bool
+	writeErr   error
+}
+
+func (f *fakeDatabase) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if strings.Contains(sql, "pg_is_in_recovery") {
+		return fakeRow{value: f.inRecovery}
+	}
+	return fakeRow{value: 1, err: f.readErr}
+}
+
+func (f *fakeDatabase) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return nil, f.writeErr
+}
+
+func newTestMonitor(db *fakeDatabase) *WriteMonitor {
+	monitor := NewWriteMonitor(nil, time.Minute)
+	monitor.pool = db
+	return monitor
+}
+
+func TestReadOnlyError(t *testing.T) {
+	readOnly := &pgconn.PgError{Code: "25006", Message: "cannot execute INSERT in a read-only transaction"}
+	assert.True(t, readOnlyError(readOnly))
+	assert.True(t, readOnlyError(fmt.Errorf("heartbeat: %w", readOnly)))
+	assert.True(t, readOnlyError(&pgconn.PgError{Code: "53100", Message: "could not extend file: No space left on device"}))
+	assert.True(t, readOnlyError(&pgconn.PgError{Code: "42501", Message: "permission denied for table query_service_heartbeat"}))
+
+	assert.False(t, readOnlyError(&pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"}))
+	assert.False(t, readOnlyError(&pgconn.PgError{Code: "55P03", Message: "lock not available"}))
+	assert.False(t, readOnlyError(&pgconn.PgError{Code: "53300", Message: "too many connections"}))
+	assert.False(t, readOnlyError(context.DeadlineExceeded))
+	assert.False(t, readOnlyError(errors.New("conn closed")))
+}
+
+func TestCheckModes(t *testing.T) {
+	db := &fakeDatabase{}
+	monitor := newTestMonitor(db)
+	assert.Equal(t, ModeReadWrite, monitor.Check(context.Background()).Mode)
+	assert.True(t, monitor.Writable())
+
+	db.inRecovery = true
+	status := monitor.Check(context.Background())
+	assert.Equal(t, ModeReadOnly, status.Mode)
+	assert.Equal(t, "server is in recovery", status.Reason)
+
+	db.inRecovery = false
+	db.writeErr = &pgconn.PgError{Code: "25006", Message: "cannot execute INSERT in a read-only transaction"}
+	assert.Equal(t, ModeReadOnly, monitor.Check(context.Background()).Mode)
+	assert.False(t, monitor.Writable())
+
+	// A full disk keeps the service read-only until space is freed
+	db.writeErr = &pgconn.PgError{Code: "53100", Message: "could not extend file: No space left on device"}
+	status = monitor.Check(context.Background())
+	assert.Equal(t, ModeReadOnly, status.Mode)
+	assert.Contains(t, status.Reason, "No space left on device")
+
+	db.readErr = errors.New("connection refused")
+	assert.Equal(t, ModeUnavailable, monitor.Check(context.Background()).Mode)
+}
+
+func TestCheckKeepsModeOnInconclusiveWrite(t *testing.T) {
+	db := &fakeDatabase{}
+	monitor := newTestMonitor(db)
+	var changes []Mode
+	monitor.OnModeChange(func(previous, current Status) {
+		changes = append(changes, current.Mode)
+	})
+
+	// A statement timeout on the heartbeat does not mean the server is read-only
+	db.writeErr = &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"}
+	status := monitor.Check(context.Background())
+	assert.Equal(t, ModeReadWrite, status.Mode)
+	assert.Contains(t, status.Reason, "write probe inconclusive")
+	assert.True(t, monitor.Writable())
+
+	db.writeErr = context.DeadlineExceeded
+	assert.Equal(t, ModeReadWrite, monitor.Check(context.Background()).Mode)
+	assert.Empty(t, changes)
+
+	// Nor does it end a read-only period
+	db.writeErr = &pgconn.PgError{Code: "25006"}
+	monitor.Check(context.Background())
+	db.writeErr = errors.New("conn closed")
+	assert.Equal(t, ModeReadOnly, monitor.Check(context.Background()).Mode)
+
+	db.writeErr = nil
+	status = monitor.Check(context.Background())
+	assert.Equal(t, ModeReadWrite, status.Mode)
+	assert.Empty(t, status.Reason)
+	require.Equal(t, []Mode{ModeReadOnly, ModeReadWrite}, changes)
+}
@@ -0,0 +1,216 @@
+package indexstatus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ComparedFields are the asset fields expected to agree across stores
+var ComparedFields = []string{
+	"filename",
+	"mime_type",
+	"file_size",
+	"processing_status",
+	"collection_id",
+	"created_at",
+}
+
+// LookupFunc fetches an asset's fields from one store. It returns a nil map
+// without an error when the asset does not exist there.
+type LookupFunc func(ctx context.Context, assetID string) (map[string]interface{}, error)
+
+// StoreStatus is what one store knows about the asset
+type StoreStatus struct {
+	Exists     bool                   `json:"exists"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMs int64                  `json:"duration_ms"`
+}
+
+// FieldDiff lists the differing values of one field, keyed by store
+type FieldDiff struct {
+	Field  string                 `json:"field"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// Report describes where an asset is indexed and where the copies disagree
+type Report struct {
+	AssetID   string                 `json:"asset_id"`
+	CheckedAt time.Time              `json:"checked_at"`
+	InSync    bool                   `json:"in_sync"`
+	Missing   []string               `json:"missing"`
+	Stores    map[string]StoreStatus `json:"stores"`
+	Diffs     []FieldDiff            `json:"diffs"`
+}
+
+type store struct {
+	name   string
+	lookup LookupFunc
+}
+
+// Checker compares one asset across the registered stores
+type Checker struct {
+	timeout time.Duration
+	stores  []store
+}
+
+// NewChecker creates a checker with a per-store timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a store under the name used in reports
+func (c *Checker) Add(name string, lookup LookupFunc) {
+	c.stores = append(c.stores, store{name: name, lookup: lookup})
+}
+
+// Check looks the asset up in every store concurrently and diffs the results
+func (c *Checker) Check(ctx context.Context, assetID string) Report {
+	report := Report{
+		AssetID:   assetID,
+		CheckedAt: time.Now().UTC(),
+		Missing:   []string{},
+		Stores:    make(map[string]StoreStatus, len(c.stores)),
+		Diffs:     []FieldDiff{},
+	}
+
+	statuses := make([]StoreStatus, len(c.stores))
+	var wg sync.WaitGroup
+	for i, s := range c.stores {
+		wg.Add(1)
+		go func(i int, s store) {
+			defer wg.Done()
+			statuses[i] = c.lookup(ctx, s, assetID)
+		}(i, s)
+	}
+	wg.Wait()
+
+	for i, s := range c.stores {
+		report.Stores[s.name] = statuses[i]
+		if !statuses[i].Exists {
+			report.Missing = append(report.Missing, s.name)
+		}
+	}
+	report.Diffs = diff(c.stores, statuses)
+	report.InSync = len(report.Missing) == 0 && len(report.Diffs) == 0
+	return report
+}
+
+// lookup bounds a store call by the timeout even if the client ignores ctx
+func (c *Checker) lookup(ctx context.Context, s store, assetID string) StoreStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type outcome struct {
+		fields map[string]interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- outcome{err: fmt.Errorf("panic: %v", p)}
+			}
+		}()
+		fields, err := s.lookup(ctx, assetID)
+		done <- outcome{fields: fields, err: err}
+	}()
+
+	var status StoreStatus
+	select {
+	case out := <-done:
+		if out.err != nil {
+			status.Error = out.err.Error()
+		} else if out.fields != nil {
+			status.Exists = true
+			status.Fields = make(map[string]interface{}, len(out.fields))
+			for field, value := range out.fields {
+				status.Fields[field] = Normalize(value)
+			}
+		}
+	case <-ctx.Done():
+		status.Error = fmt.Sprintf("lookup timed out: %v", ctx.Err())
+	}
+	status.DurationMs = time.Since(start).Milliseconds()
+	return status
+}
+
+// diff compares the compared fields between the stores that returned them
+func diff(stores []store, statuses []StoreStatus) []FieldDiff {
+	diffs := []FieldDiff{}
+	for _, field := range ComparedFields {
+		values := map[string]interface{}{}
+		var first interface{}
+		differs := false
+		for i, s := range stores {
+			if !statuses[i].Exists {
+				continue
+			}
+			value, ok := statuses[i].Fields[field]
+			if !ok {
+				continue
+			}
+			if len(values) == 0 {
+				first = value
+			} else if !reflect.DeepEqual(first, value) {
+				differs = true
+			}
+			values[s.name] = value
+		}
+		if differs {
+			diffs = append(diffs, FieldDiff{Field: field, Values: values})
+		}
+	}
+	return diffs
+}
+
+// Normalize converts store-specific representations to comparable values:
+// numbers become float64, timestamps RFC 3339 in UTC and lists sorted strings
+func Normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+		return v
+	case []string:
+		sorted := append([]string(nil), v...)
+		sort.Strings(sorted)
+		return sorted
+	case []interface{}:
+		sorted := make([]string, 0, len(v))
+		for _, item := range v {
+			sorted = append(sorted, fmt.Sprint(item))
+		}
+		sort.Strings(sorted)
+		return sorted
+	}
+	return value
+}
@@ -0,0 +1,66 @@
+package indexstatus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fixed(fields map[string]interface{}) LookupFunc {
+	return func(ctx context.Context, assetID string) (map[string]interface{}, error) {
+		return fields, nil
+	}
+}
+
+func TestCheckReportsFieldDiffs(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Add("postgres", fixed(map[string]interface{}{
+		"filename":   "beach.mp4",
+		"file_size":  int64(1024),
+		"created_at": time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("CEST", 2*3600)),
+	}))
+	checker.Add("weaviate", fixed(map[string]interface{}{
+		"filename":   "beach-old.mp4",
+		"file_size":  float64(1024),
+		"created_at": "2024-05-01T08:00:00Z",
+	}))
+
+	report := checker.Check(context.Background(), "asset-1")
+
+	assert.False(t, report.InSync)
+	assert.Empty(t, report.Missing)
+	assert.Len(t, report.Diffs, 1)
+	assert.Equal(t, "filename", report.Diffs[0].Field)
+	assert.Equal(t, "beach-old.mp4", report.Diffs[0].Values["weaviate"])
+}
+
+func TestCheckReportsMissingAndFailedStores(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	checker.Add("postgres", fixed(map[string]interface{}{"filename": "a.jpg"}))
+	checker.Add("weaviate", fixed(nil))
+	checker.Add("neo4j", func(ctx context.Context, assetID string) (map[string]interface{}, error) {
+		return nil, errors.New("connection refused")
+	})
+	checker.Add("slow", func(ctx context.Context, assetID string) (map[string]interface{}, error) {
+		time.Sleep(time.Second)
+		return map[string]interface{}{}, nil
+	})
+
+	report := checker.Check(context.Background(), "asset-1")
+
+	assert.False(t, report.InSync)
+	assert.Equal(t, []string{"weaviate", "neo4j", "slow"}, report.Missing)
+	assert.Equal(t, "connection refused", report.Stores["neo4j"].Error)
+	assert.Contains(t, report.Stores["slow"].Error, "timed out")
+	assert.True(t, report.Stores["postgres"].Exists)
+}
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, float64(3), Normalize(int64(3)))
+	assert.Equal(t, float64(3), Normalize("3"))
+	assert.Equal(t, "2024-05-01T08:00:00Z", Normalize("2024-05-01T10:00:00+02:00"))
+	assert.Equal(t, []string{"a", "b"}, Normalize([]interface{}{"b", "a"}))
+}
@@ -0,0 +1,88 @@
+package indexstatus
+
+import (
+	"context"
+	"time"
+
+	neo4jclient "dataflux/query-service/pkg/neo4j"
+	"dataflux/query-service/pkg/weaviate"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PostgresLookup reads the asset row, the system of record
+func PostgresLookup(pool *pgxpool.Pool) LookupFunc {
+	return func(ctx context.Context, assetID string) (map[string]interface{}, error) {
+		var filename, mimeType, processingStatus string
+		var fileSize int64
+		var collectionID *string
+		var createdAt time.Time
+		err := pool.QueryRow(ctx, `
+			SELECT a.filename, a.mime_type, a.file_size, COALESCE(a.processing_status, ''),
+			       e.parent_id::text, e.created_at
+			FROM assets a
+			JOIN entities e ON e.id = a.id
+			WHERE a.id::text = $1
+		`, assetID).Scan(&filename, &mimeType, &fileSize, &processingStatus, &collectionID, &createdAt)
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fields := map[string]interface{}{
+			"filename":          filename,
+			"mime_type":         mimeType,
+			"file_size":         fileSize,
+			"processing_status": processingStatus,
+			"created_at":        createdAt,
+		}
+		if collectionID != nil {
+			fields["collection_id"] = *collectionID
+		}
+		return fields, nil
+	}
+}
+
+// WeaviateLookup reads the Asset object indexed for the entity
+func WeaviateLookup(client *weaviate.WeaviateClient) LookupFunc {
+	return func(ctx context.Context, assetID string) (map[string]interface{}, error) {
+		object, err := client.GetAssetByEntityID(assetID)
+		if err != nil || object == nil {
+			return nil, err
+		}
+
+		fields := map[string]interface{}{
+			"object_id":         object.Additional.ID,
+			"filename":          object.Filename,
+			"mime_type":         object.MimeType,
+			"file_size":         object.FileSize,
+			"processing_status": object.ProcessingStatus,
+			"created_at":        object.CreatedAt,
+			"tags":              object.Tags,
+		}
+		if object.CollectionID != "" {
+			fields["collection_id"] = object.CollectionID
+		}
+		return fields, nil
+	}
+}
+
+// Neo4jLookup reads the Asset node's properties
+func Neo4jLookup(client *neo4jclient.Neo4jClient) LookupFunc {
+	return func(ctx context.Context, assetID string) (map[string]interface{}, error) {
+		properties, err := client.GetAssetProperties(assetID)
+		if err != nil || properties == nil {
+			return nil, err
+		}
+
+		// Metadata is stored as a nested map and is not compared
+		delete(properties, "metadata")
+		if collectionID, ok := properties["collection_id"].(string); ok && collectionID == "" {
+			delete(properties, "collection_id")
+		}
+		return properties, nil
+	}
+}
@@ -0,0 +1,126 @@
+package indexsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// maxBackoff caps the wait between attempts at one event
+const maxBackoff = time.Minute
+
+// Config is where the consumer reads ingestion events from and how hard it
+// tries to apply each one
+type Config struct {
+	Brokers []string
+	Topics  []string
+	// GroupID is the consumer group; replicas sharing it split the
+	// partitions between them
+	GroupID string
+	// MaxAttempts bounds the attempts at an event before it is skipped
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, doubling after each
+	Backoff time.Duration
+}
+
+// reader is the part of a Kafka reader the consumer uses
+type reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// Consumer reads ingestion events from Kafka and applies them through an
+// indexer, one at a time so that each partition's order is kept. An
+// event's offset is committed once it is applied, skipped as invalid or
+// given up on, so delivery is at least once.
+type Consumer struct {
+	reader      reader
+	indexer     *Indexer
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewConsumer creates a consumer joining the configured group
+func NewConsumer(config Config, indexer *Indexer) *Consumer {
+	return &Consumer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     config.Brokers,
+			GroupID:     config.GroupID,
+			GroupTopics: config.Topics,
+			StartOffset: kafka.FirstOffset,
+			MaxBytes:    10e6,
+		}),
+		indexer:     indexer,
+		maxAttempts: config.MaxAttempts,
+		backoff:     config.Backoff,
+	}
+}
+
+// Start consumes events until ctx is cancelled, calling onApplied after
+// each event is written to the indexes
+func (c *Consumer) Start(ctx context.Context, onApplied func(Event)) {
+	go func() {
+		defer c.reader.Close()
+		for ctx.Err() == nil {
+			message, err := c.reader.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Warning: failed to read ingestion events: %v", err)
+					time.Sleep(time.Second)
+				}
+				continue
+			}
+			if !c.handle(ctx, message, onApplied) {
+				return
+			}
+			if err := c.reader.CommitMessages(ctx, message); err != nil && ctx.Err() == nil {
+				log.Printf("Warning: failed to commit ingestion event %s/%d@%d: %v", message.Topic, message.Partition, message.Offset, err)
+			}
+		}
+	}()
+}
+
+// handle applies one message, retrying with backoff, and reports whether
+// its offset may be committed; it may not when ctx is cancelled first
+func (c *Consumer) handle(ctx context.Context, message kafka.Message, onApplied func(Event)) bool {
+	var event Event
+	err := json.Unmarshal(message.Value, &event)
+	if err == nil {
+		err = event.Validate()
+	}
+	if err != nil {
+		log.Printf("Warning: skipping ingestion event %s/%d@%d: %v", message.Topic, message.Partition, message.Offset, err)
+		return true
+	}
+
+	backoff := c.backoff
+	for attempt := 1; ; attempt++ {
+		err := c.indexer.Apply(ctx, event)
+		if err == nil {
+			if onApplied != nil {
+				onApplied(event)
+			}
+			return true
+		}
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) || attempt >= c.maxAttempts {
+			log.Printf("Warning: giving up on %s event for asset %s after %d attempts: %v", event.Type, event.SubjectID(), attempt, err)
+			return true
+		}
+		log.Printf("Warning: attempt %d at %s event for asset %s failed: %v", attempt, event.Type, event.SubjectID(), err)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package indexsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	neo4jclient "dataflux/query-service/pkg/neo4j"
+	"dataflux/query-service/pkg/weaviate"
+)
+
+// Types of ingestion events
+const (
+	EventAssetUpserted   = "asset.upserted"
+	EventSegmentUpserted = "segment.upserted"
+	EventAssetDeleted    = "asset.deleted"
+)
+
+// Event is a message on an ingestion topic: an asset or segment to index,
+// or an asset to remove with its segments. Producers should key messages
+// by asset ID so that an asset's events arrive in order.
+type Event struct {
+	Type string `json:"type"`
+	// TenantID is the tenant owning the asset, empty for none
+	TenantID string   `json:"tenant_id,omitempty"`
+	Asset    *Asset   `json:"asset,omitempty"`
+	Segment  *Segment `json:"segment,omitempty"`
+	// AssetID names the asset an asset.deleted event removes
+	AssetID string `json:"asset_id,omitempty"`
+}
+
+// Asset is an asset to index, with its embedding when it has one
+type Asset struct {
+	neo4jclient.Asset
+	Vector []float64 `json:"vector,omitempty"`
+}
+
+// Segment is a segment to index, with its embedding when it has one
+type Segment struct {
+	neo4jclient.Segment
+	Vector []float64 `json:"vector,omitempty"`
+}
+
+// ValidationError reports an event that can never be applied
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Validate checks that the event names what it indexes or removes, and
+// fills in entity IDs left out, which default to the asset or segment ID
+func (e *Event) Validate() error {
+	switch e.Type {
+	case EventAssetUpserted:
+		if e.Asset == nil || e.Asset.AssetID == "" {
+			return &ValidationError{Message: "asset.upserted needs an asset with an asset_id"}
+		}
+		if e.Asset.EntityID == "" {
+			e.Asset.EntityID = e.Asset.AssetID
+		}
+	case EventSegmentUpserted:
+		if e.Segment == nil || e.Segment.SegmentID == "" || e.Segment.AssetID == "" {
+			return &ValidationError{Message: "segment.upserted needs a segment with a segment_id and asset_id"}
+		}
+		if e.Segment.EntityID == "" {
+			e.Segment.EntityID = e.Segment.SegmentID
+		}
+	case EventAssetDeleted:
+		if e.AssetID == "" {
+			return &ValidationError{Message: "asset.deleted needs an asset_id"}
+		}
+	default:
+		return &ValidationError{Message: fmt.Sprintf("unknown event type %q", e.Type)}
+	}
+	return nil
+}
+
+// SubjectID returns the ID of the asset the event changes
+func (e Event) SubjectID() string {
+	switch {
+	case e.Asset != nil:
+		return e.Asset.AssetID
+	case e.Segment != nil:
+		return e.Segment.AssetID
+	}
+	return e.AssetID
+}
+
+// Graph writes the asset graph
+type Graph interface {
+	CreateAsset(asset neo4jclient.Asset) error
+	CreateSegment(segment neo4jclient.Segment) error
+	CreateAssetSegmentRelationship(assetID, segmentID string, sequence int) error
+	DeleteAsset(assetID string) error
+}
+
+// Vectors writes the vector index
+type Vectors interface {
+	UpsertObject(ctx context.Context, class, key string, properties map[string]interface{}, vector []float64) error
+	DeleteObjectByKey(ctx context.Context, class, key string) error
+	DeleteObjectsWhere(ctx context.Context, class, property, value string) error
+}
+
+// Indexer applies ingestion events to the graph and vector index of the
+// event's tenant. Every write replaces what an earlier one wrote, so an
+// event can be applied again safely.
+type Indexer struct {
+	graph   func(tenantID string) Graph
+	vectors func(tenantID string) Vectors
+}
+
+// NewIndexer creates an indexer writing through the backends returned for
+// each tenant
+func NewIndexer(graph func(tenantID string) Graph, vectors func(tenantID string) Vectors) *Indexer {
+	return &Indexer{graph: graph, vectors: vectors}
+}
+
+// Apply writes a validated event to both backends
+func (i *Indexer) Apply(ctx context.Context, event Event) error {
+	graph, vectors := i.graph(event.TenantID), i.vectors(event.TenantID)
+	switch event.Type {
+	case EventAssetUpserted:
+		asset := event.Asset
+		if err := graph.CreateAsset(asset.Asset); err != nil {
+			return fmt.Errorf("failed to index asset %s in the graph: %v", asset.AssetID, err)
+		}
+		if err := vectors.UpsertObject(ctx, weaviate.AssetClass, asset.AssetID, assetProperties(asset.Asset), asset.Vector); err != nil {
+			return fmt.Errorf("failed to index asset %s in the vector index: %v", asset.AssetID, err)
+		}
+
+	case EventSegmentUpserted:
+		segment := event.Segment
+		if err := graph.CreateSegment(segment.Segment); err != nil {
+			return fmt.Errorf("failed to index segment %s in the graph: %v", segment.SegmentID, err)
+		}
+		// The asset's own event may still be on its way
+		err := graph.CreateAssetSegmentRelationship(segment.AssetID, segment.SegmentID, segment.SequenceNumber)
+		if errors.Is(err, neo4jclient.ErrNotFound) {
+			return fmt.Errorf("asset %s of segment %s is not indexed yet", segment.AssetID, segment.SegmentID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to link segment %s to its asset: %v", segment.SegmentID, err)
+		}
+		if err := vectors.UpsertObject(ctx, weaviate.SegmentClass, segment.SegmentID, segmentProperties(segment.Segment), segment.Vector); err != nil {
+			return fmt.Errorf("failed to index segment %s in the vector index: %v", segment.SegmentID, err)
+		}
+
+	case EventAssetDeleted:
+		if err := graph.DeleteAsset(event.AssetID); err != nil {
+			return fmt.Errorf("failed to remove asset %s from the graph: %v", event.AssetID, err)
+		}
+		if err := vectors.DeleteObjectsWhere(ctx, weaviate.SegmentClass, "asset_id", event.AssetID); err != nil {
+			return fmt.Errorf("failed to remove the segments of asset %s from the vector index: %v", event.AssetID, err)
+		}
+		if err := vectors.DeleteObjectByKey(ctx, weaviate.AssetClass, event.AssetID); err != nil {
+			return fmt.Errorf("failed to remove asset %s from the vector index: %v", event.AssetID, err)
+		}
+	}
+	return nil
+}
+
+// assetProperties are the properties of an Asset object
+func assetProperties(asset neo4jclient.Asset) map[string]interface{} {
+	return map[string]interface{}{
+		"entity_id":         asset.EntityID,
+		"filename":          asset.Filename,
+		"mime_type":         asset.MimeType,
+		"file_size":         asset.FileSize,
+		"processing_status": asset.ProcessingStatus,
+		"created_at":        asset.CreatedAt,
+		"metadata":          asset.Metadata,
+		"tags":              asset.Tags,
+		"collection_id":     asset.CollectionID,
+	}
+}
+
+// segmentProperties are the properties of a Segment object
+func segmentProperties(segment neo4jclient.Segment) map[string]interface{} {
+	return map[string]interface{}{
+		"segment_id":          segment.SegmentID,
+		"asset_id":            segment.AssetID,
+		"segment_type":        segment.SegmentType,
+		"sequence_number":     segment.SequenceNumber,
+		"start_time":          segment.StartTime,
+		"end_time":            segment.EndTime,
+		"confidence_score":    segment.ConfidenceScore,
+		"content_description": segment.ContentDescription,
+	}
+}
@@ -0,0 +1,234 @@
+package indexsync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	neo4jclient "dataflux/query-service/pkg/neo4j"
+	"dataflux/query-service/pkg/weaviate"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIndexes records writes to both backends, keyed by tenant
+type fakeIndexes struct {
+	tenant   string
+	assets   map[string]neo4jclient.Asset
+	segments map[string]neo4jclient.Segment
+	links    map[string]string
+	objects  map[string]map[string]interface{}
+	vectors  map[string][]float64
+	// failures fail that many graph writes before succeeding
+	failures int
+}
+
+func newFakeIndexes() *fakeIndexes {
+	return &fakeIndexes{
+		assets:   map[string]neo4jclient.Asset{},
+		segments: map[string]neo4jclient.Segment{},
+		links:    map[string]string{},
+		objects:  map[string]map[string]interface{}{},
+		vectors:  map[string][]float64{},
+	}
+}
+
+func (f *fakeIndexes) CreateAsset(asset neo4jclient.Asset) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("neo4j unavailable")
+	}
+	f.assets[asset.AssetID] = asset
+	return nil
+}
+
+func (f *fakeIndexes) CreateSegment(segment neo4jclient.Segment) error {
+	f.segments[segment.SegmentID] = segment
+	return nil
+}
+
+func (f *fakeIndexes) CreateAssetSegmentRelationship(assetID, segmentID string, sequence int) error {
+	if _, ok := f.assets[assetID]; !ok {
+		return neo4jclient.ErrNotFound
+	}
+	f.links[segmentID] = assetID
+	return nil
+}
+
+func (f *fakeIndexes) DeleteAsset(assetID string) error {
+	delete(f.assets, assetID)
+	for segmentID, linked := range f.links {
+		if linked == assetID {
+			delete(f.segments, segmentID)
+			delete(f.links, segmentID)
+		}
+	}
+	return nil
+}
+
+func (f *fakeIndexes) UpsertObject(ctx context.Context, class, key string, properties map[string]interface{}, vector []float64) error {
+	f.objects[class+"/"+key] = properties
+	f.vectors[class+"/"+key] = vector
+	return nil
+}
+
+func (f *fakeIndexes) DeleteObjectByKey(ctx context.Context, class, key string) error {
+	delete(f.objects, class+"/"+key)
+	return nil
+}
+
+func (f *fakeIndexes) DeleteObjectsWhere(ctx context.Context, class, property, value string) error {
+	for key, properties := range f.objects {
+		if properties[property] == value {
+			delete(f.objects, key)
+		}
+	}
+	return nil
+}
+
+func (f *fakeIndexes) indexer() *Indexer {
+	return NewIndexer(
+		func(tenantID string) Graph { f.tenant = tenantID; return f },
+		func(tenantID string) Vectors { return f },
+	)
+}
+
+func TestValidate(t *testing.T) {
+	event := Event{Type: EventAssetUpserted, Asset: &Asset{Asset: neo4jclient.Asset{AssetID: "asset-1"}}}
+	require.NoError(t, event.Validate())
+	assert.Equal(t, "asset-1", event.Asset.EntityID)
+
+	for _, invalid := range []Event{
+		{Type: "asset.renamed", AssetID: "asset-1"},
+		{Type: EventAssetUpserted},
+		{Type: EventSegmentUpserted, Segment: &Segment{Segment: neo4jclient.Segment{SegmentID: "seg-1"}}},
+		{Type: EventAssetDeleted},
+	} {
+		var validationErr *ValidationError
+		assert.True(t, errors.As(invalid.Validate(), &validationErr), "%+v", invalid)
+	}
+}
+
+func TestIndexerApply(t *testing.T) {
+	indexes := newFakeIndexes()
+	indexer := indexes.indexer()
+	ctx := context.Background()
+
+	segment := Event{Type: EventSegmentUpserted, TenantID: "acme", Segment: &Segment{
+		Segment: neo4jclient.Segment{SegmentID: "seg-1", AssetID: "asset-1", SegmentType: "scene"},
+		Vector:  []float64{0.25},
+	}}
+	require.NoError(t, segment.Validate())
+	// The segment waits for its asset
+	assert.Error(t, indexer.Apply(ctx, segment))
+
+	asset := Event{Type: EventAssetUpserted, TenantID: "acme", Asset: &Asset{
+		Asset:  neo4jclient.Asset{AssetID: "asset-1", Filename: "dock.mp4", Tags: []string{"harbour"}},
+		Vector: []float64{0.5},
+	}}
+	require.NoError(t, asset.Validate())
+	require.NoError(t, indexer.Apply(ctx, asset))
+	require.NoError(t, indexer.Apply(ctx, segment))
+	// Applying an event again changes nothing
+	require.NoError(t, indexer.Apply(ctx, asset))
+
+	assert.Equal(t, "acme", indexes.tenant)
+	assert.Equal(t, "dock.mp4", indexes.assets["asset-1"].Filename)
+	assert.Equal(t, "asset-1", indexes.links["seg-1"])
+	assert.Len(t, indexes.objects, 2)
+	assert.Equal(t, "asset-1", indexes.objects[weaviate.AssetClass+"/asset-1"]["entity_id"])
+	assert.Equal(t, []float64{0.25}, indexes.vectors[weaviate.SegmentClass+"/seg-1"])
+
+	require.NoError(t, indexer.Apply(ctx, Event{Type: EventAssetDeleted, TenantID: "acme", AssetID: "asset-1"}))
+	assert.Empty(t, indexes.assets)
+	assert.Empty(t, indexes.segments)
+	assert.Empty(t, indexes.objects)
+}
+
+// fakeReader serves messages and records the committed ones
+type fakeReader struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed []int64
+}
+
+func (f *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	f.mu.Lock()
+	if len(f.messages) > 0 {
+		message := f.messages[0]
+		f.messages = f.messages[1:]
+		f.mu.Unlock()
+		return message, nil
+	}
+	f.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (f *fakeReader) CommitMessages(ctx context.Context, messages ...kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, message := range messages {
+		f.committed = append(f.committed, message.Offset)
+	}
+	return nil
+}
+
+func (f *fakeReader) Close() error {
+	return nil
+}
+
+func TestConsumerRetriesAndSkips(t *testing.T) {
+	indexes := newFakeIndexes()
+	indexes.failures = 1
+	consumer := &Consumer{indexer: indexes.indexer(), maxAttempts: 2, backoff: time.Millisecond}
+	var applied []string
+	onApplied := func(event Event) { applied = append(applied, event.SubjectID()) }
+	ctx := context.Background()
+
+	// A transient failure is retried
+	ok := consumer.handle(ctx, kafka.Message{Value: []byte(`{"type":"asset.upserted","asset":{"asset_id":"asset-1"}}`)}, onApplied)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"asset-1"}, applied)
+
+	// Malformed and invalid events are skipped without attempts
+	assert.True(t, consumer.handle(ctx, kafka.Message{Value: []byte(`not json`)}, onApplied))
+	assert.True(t, consumer.handle(ctx, kafka.Message{Value: []byte(`{"type":"asset.upserted"}`)}, onApplied))
+
+	// An event that keeps failing is given up on after the last attempt
+	assert.True(t, consumer.handle(ctx, kafka.Message{Value: []byte(`{"type":"segment.upserted","segment":{"segment_id":"seg-9","asset_id":"asset-9"}}`)}, onApplied))
+	assert.Equal(t, []string{"asset-1"}, applied)
+
+	// A cancelled consumer leaves the event uncommitted
+	indexes.failures = 5
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, consumer.handle(cancelled, kafka.Message{Value: []byte(`{"type":"asset.upserted","asset":{"asset_id":"asset-2"}}`)}, onApplied))
+}
+
+func TestConsumerCommitsHandledMessages(t *testing.T) {
+	indexes := newFakeIndexes()
+	reader := &fakeReader{messages: []kafka.Message{
+		{Offset: 1, Value: []byte(`{"type":"asset.upserted","asset":{"asset_id":"asset-1"}}`)},
+		{Offset: 2, Value: []byte(`{"type":"asset.renamed"}`)},
+	}}
+	consumer := &Consumer{reader: reader, indexer: indexes.indexer(), maxAttempts: 1, backoff: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	applied := make(chan Event, 2)
+	consumer.Start(ctx, func(event Event) { applied <- event })
+	assert.Equal(t, "asset-1", (<-applied).SubjectID())
+
+	// The skipped event is committed too
+	assert.Eventually(t, func() bool {
+		reader.mu.Lock()
+		defer reader.mu.Unlock()
+		return len(reader.committed) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []int64{1, 2}, reader.committed)
+}
@@ -0,0 +1,442 @@
+// Package lakeexport writes nightly snapshots of the corpus to object
+// storage as Parquet files partitioned by snapshot date, for Spark, DuckDB
+// and other data lake engines
+package lakeexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"dataflux/query-service/pkg/parquet"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// lockKey makes sure only one replica exports each night
+const lockKey = "lakeexport:lock"
+
+// rowGroupRows bounds the rows a reader decodes at a time
+const rowGroupRows = 10000
+
+// ErrRunning is returned when an export is started while one is running
+var ErrRunning = errors.New("an export is already running")
+
+// column is a Parquet column and the SQL expression that reads it
+type column struct {
+	name string
+	kind parquet.Type
+	expr string
+}
+
+// table is an exported table, read in one statement ordered by id
+type table struct {
+	name    string
+	from    string
+	order   string
+	columns []column
+}
+
+// tables are the corpus tables every snapshot holds. JSON columns are
+// exported as strings.
+var tables = []table{
+	{
+		name:  "assets",
+		from:  "assets a JOIN entities e ON e.id = a.id",
+		order: "a.id",
+		columns: []column{
+			{"asset_id", parquet.String, "a.id::text"},
+			{"collection_id", parquet.String, "e.parent_id::text"},
+			{"tenant_id", parquet.String, "e.metadata->>'tenant_id'"},
+			{"filename", parquet.String, "a.filename"},
+			{"file_hash", parquet.String, "a.file_hash"},
+			{"file_size", parquet.Int64, "a.file_size::bigint"},
+			{"mime_type", parquet.String, "a.mime_type"},
+			{"processing_status", parquet.String, "a.processing_status"},
+			{"confidence_score", parquet.Float64, "a.confidence_score::float8"},
+			{"version", parquet.Int64, "e.version::bigint"},
+			{"is_latest", parquet.Bool, "e.is_latest"},
+			{"metadata", parquet.String, "e.metadata::text"},
+			{"created_at", parquet.Timestamp, "e.created_at"},
+			{"updated_at", parquet.Timestamp, "e.updated_at"},
+		},
+	},
+	{
+		name:  "segments",
+		from:  "segments s JOIN entities e ON e.id = s.id",
+		order: "s.id",
+		columns: []column{
+			{"segment_id", parquet.String, "s.id::text"},
+			{"asset_id", parquet.String, "s.asset_id::text"},
+			{"segment_type", parquet.String, "s.segment_type"},
+			{"sequence_number", parquet.Int64, "s.sequence_number::bigint"},
+			{"start_marker", parquet.String, "s.start_marker::text"},
+			{"end_marker", parquet.String, "s.end_marker::text"},
+			{"confidence_score", parquet.Float64, "s.confidence_score::float8"},
+			{"duration", parquet.Float64, "s.duration::float8"},
+			{"created_at", parquet.Timestamp, "e.created_at"},
+		},
+	},
+	{
+		name:  "features",
+		from:  "features f",
+		order: "f.id",
+		columns: []column{
+			{"feature_id", parquet.String, "f.id::text"},
+			{"asset_id", parquet.String, "f.asset_id::text"},
+			{"segment_id", parquet.String, "f.segment_id::text"},
+			{"feature_domain", parquet.String, "f.feature_domain"},
+			{"feature_type", parquet.String, "f.feature_type"},
+			{"feature_data", parquet.String, "f.feature_data::text"},
+			{"confidence", parquet.Float64, "f.confidence::float8"},
+			{"analyzer_version", parquet.String, "f.analyzer_version"},
+			{"model_version", parquet.String, "COALESCE(f.model_version, '')"},
+			{"created_at", parquet.Timestamp, "f.created_at"},
+		},
+	},
+	{
+		name:  "relationships",
+		from:  "relationships r",
+		order: "r.id",
+		columns: []column{
+			{"relationship_id", parquet.String, "r.id::text"},
+			{"source_id", parquet.String, "r.source_id::text"},
+			{"target_id", parquet.String, "r.target_id::text"},
+			{"relationship_type", parquet.String, "r.relationship_type"},
+			{"strength", parquet.Float64, "r.strength::float8"},
+			{"metadata", parquet.String, "r.metadata::text"},
+			{"created_at", parquet.Timestamp, "r.created_at"},
+		},
+	},
+}
+
+func (t table) query() string {
+	selected := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		selected[i] = c.expr + " AS " + c.name
+	}
+	return fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", strings.Join(selected, ", "), t.from, t.order)
+}
+
+// Column describes a column of an exported table
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// File is a Parquet file of a snapshot
+type File struct {
+	Key   string `json:"key"`
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Table is a table of a snapshot and the files holding it
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []Column `json:"columns"`
+	Rows    int64    `json:"rows"`
+	Files   []File   `json:"files"`
+}
+
+// Manifest describes a snapshot. It is written once every file is, so a
+// snapshot date without a manifest is incomplete.
+type Manifest struct {
+	SnapshotDate string    `json:"snapshot_date"`
+	Bucket       string    `json:"bucket"`
+	Format       string    `json:"format"`
+	Compression  string    `json:"compression"`
+	StartedAt    time.Time `json:"started_at"`
+	CompletedAt  time.Time `json:"completed_at"`
+	Tables       []Table   `json:"tables"`
+}
+
+// Store is the object storage snapshots are written to
+type Store interface {
+	Bucket() string
+	Put(ctx context.Context, objectKey, contentType string, body []byte) error
+}
+
+// rowSource is the result of a table's query, as pgx.Rows provides it
+type rowSource interface {
+	Next() bool
+	Values() ([]interface{}, error)
+	Err() error
+}
+
+// Exporter writes snapshots under prefix: each table's files are at
+// <table>/snapshot_date=<date>/part-<n>.parquet, and manifests at
+// _manifests/<date>.json and _manifests/latest.json
+type Exporter struct {
+	pool        *pgxpool.Pool
+	redis       *redis.Client
+	store       Store
+	prefix      string
+	rowsPerFile int
+	instance    string
+
+	mu       sync.RWMutex
+	status   Status
+	onExport func(*Manifest)
+}
+
+// Status reports whether an export is running and how the last one ended
+type Status struct {
+	Running      bool      `json:"running"`
+	LastManifest *Manifest `json:"last_manifest,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// NewExporter creates an exporter writing files of up to rowsPerFile rows
+func NewExporter(pool *pgxpool.Pool, redisClient *redis.Client, store Store, prefix string, rowsPerFile int) *Exporter {
+	instance, _ := os.Hostname()
+	return &Exporter{
+		pool:        pool,
+		redis:       redisClient,
+		store:       store,
+		prefix:      strings.Trim(prefix, "/"),
+		rowsPerFile: rowsPerFile,
+		instance:    instance,
+	}
+}
+
+// Status returns the state of this replica's exports
+func (e *Exporter) Status() Status {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.status
+}
+
+// OnExport registers a callback invoked after every successful export
+func (e *Exporter) OnExport(fn func(*Manifest)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onExport = fn
+}
+
+// Run exports every table as of now. The tables are read in one
+// repeatable-read transaction, so the snapshot is consistent across them.
+func (e *Exporter) Run(ctx context.Context, now time.Time) (*Manifest, error) {
+	if !e.claim() {
+		return nil, ErrRunning
+	}
+	return e.finish(e.run(ctx, now.UTC()))
+}
+
+// Trigger starts an export in the background
+func (e *Exporter) Trigger(now time.Time) error {
+	if !e.claim() {
+		return ErrRunning
+	}
+	go func() {
+		if _, err := e.finish(e.run(context.Background(), now.UTC())); err != nil {
+			log.Printf("Warning: lake export failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (e *Exporter) claim() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.status.Running {
+		return false
+	}
+	e.status.Running = true
+	return true
+}
+
+func (e *Exporter) finish(manifest *Manifest, err error) (*Manifest, error) {
+	e.mu.Lock()
+	e.status.Running = false
+	if err != nil {
+		e.status.LastError = err.Error()
+		e.mu.Unlock()
+		return nil, err
+	}
+	e.status.LastManifest, e.status.LastError = manifest, ""
+	onExport := e.onExport
+	e.mu.Unlock()
+
+	if onExport != nil {
+		onExport(manifest)
+	}
+	return manifest, nil
+}
+
+func (e *Exporter) run(ctx context.Context, now time.Time) (*Manifest, error) {
+	manifest := &Manifest{
+		SnapshotDate: now.Format("2006-01-02"),
+		Bucket:       e.store.Bucket(),
+		Format:       "parquet",
+		Compression:  "zstd",
+		StartedAt:    now,
+		Tables:       make([]Table, 0, len(tables)),
+	}
+
+	tx, err := e.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin snapshot transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, t := range tables {
+		rows, err := tx.Query(ctx, t.query())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", t.name, err)
+		}
+		exported, err := e.writeTable(ctx, t, manifest.SnapshotDate, rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		manifest.Tables = append(manifest.Tables, exported)
+	}
+
+	manifest.CompletedAt = time.Now().UTC()
+	body, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{manifest.SnapshotDate, "latest"} {
+		if err := e.store.Put(ctx, e.ManifestKey(name), "application/json", body); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// writeTable uploads a table's rows as files of up to rowsPerFile rows. A
+// table without rows still gets one empty file, so readers see its schema.
+func (e *Exporter) writeTable(ctx context.Context, t table, date string, rows rowSource) (Table, error) {
+	exported := Table{Name: t.name, Columns: make([]Column, len(t.columns)), Files: []File{}}
+	columns := make([]parquet.Column, len(t.columns))
+	for i, c := range t.columns {
+		columns[i] = parquet.Column{Name: c.name, Type: c.kind}
+		exported.Columns[i] = Column{Name: c.name, Type: c.kind.String()}
+	}
+
+	var buf bytes.Buffer
+	var writer *parquet.Writer
+	var fileRows int64
+	upload := func() error {
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		key := e.key(t.name, "snapshot_date="+date, fmt.Sprintf("part-%05d.parquet", len(exported.Files)))
+		if err := e.store.Put(ctx, key, "application/vnd.apache.parquet", buf.Bytes()); err != nil {
+			return err
+		}
+		exported.Files = append(exported.Files, File{Key: key, Rows: fileRows, Bytes: int64(buf.Len())})
+		writer, fileRows = nil, 0
+		return nil
+	}
+
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return Table{}, fmt.Errorf("failed to read %s: %v", t.name, err)
+		}
+		if writer == nil {
+			buf.Reset()
+			if writer, err = parquet.NewWriter(&buf, columns, rowGroupRows); err != nil {
+				return Table{}, err
+			}
+		}
+		if err := writer.Write(values); err != nil {
+			return Table{}, fmt.Errorf("failed to export %s: %v", t.name, err)
+		}
+		fileRows++
+		exported.Rows++
+		if fileRows == int64(e.rowsPerFile) {
+			if err := upload(); err != nil {
+				return Table{}, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Table{}, fmt.Errorf("failed to read %s: %v", t.name, err)
+	}
+
+	if writer == nil && len(exported.Files) == 0 {
+		buf.Reset()
+		var err error
+		if writer, err = parquet.NewWriter(&buf, columns, rowGroupRows); err != nil {
+			return Table{}, err
+		}
+	}
+	if writer != nil {
+		if err := upload(); err != nil {
+			return Table{}, err
+		}
+	}
+	return exported, nil
+}
+
+// ManifestKey returns the object key of the manifest for a snapshot date
+func (e *Exporter) ManifestKey(date string) string {
+	return e.key("_manifests", date+".json")
+}
+
+func (e *Exporter) key(parts ...string) string {
+	if e.prefix != "" {
+		parts = append([]string{e.prefix}, parts...)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Start exports every night at hour:00 UTC until ctx is cancelled.
+// Replicas share a Redis lock so only one of them exports each night.
+func (e *Exporter) Start(ctx context.Context, hour int) {
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(NextRun(time.Now(), hour)))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				e.runScheduled(ctx)
+			}
+		}
+	}()
+}
+
+// NextRun returns the first hour:00 UTC after now
+func NextRun(now time.Time, hour int) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (e *Exporter) runScheduled(ctx context.Context) {
+	acquired, err := e.redis.SetNX(ctx, lockKey, e.instance, 12*time.Hour).Result()
+	if err != nil {
+		log.Printf("Warning: lake export lock failed: %v", err)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	manifest, err := e.Run(ctx, time.Now())
+	if err != nil {
+		log.Printf("Warning: lake export failed: %v", err)
+		return
+	}
+	for _, t := range manifest.Tables {
+		log.Printf("Lake export %s table=%s rows=%d files=%d", manifest.SnapshotDate, t.Name, t.Rows, len(t.Files))
+	}
+}
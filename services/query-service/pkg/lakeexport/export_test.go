@@ -0,0 +1,108 @@
+package lakeexport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore map[string][]byte
+
+func (s fakeStore) Bucket() string {
+	return "lake"
+}
+
+func (s fakeStore) Put(ctx context.Context, objectKey, contentType string, body []byte) error {
+	s[objectKey] = append([]byte(nil), body...)
+	return nil
+}
+
+type fakeRows struct {
+	rows [][]interface{}
+	next int
+}
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *fakeRows) Values() ([]interface{}, error) {
+	return r.rows[r.next-1], nil
+}
+
+func (r *fakeRows) Err() error {
+	return nil
+}
+
+func relationshipRow(id string) []interface{} {
+	return []interface{}{id, "asset-1", "asset-2", "similar_to", 0.8, nil, time.Now()}
+}
+
+func TestWriteTableSplitsFiles(t *testing.T) {
+	store := fakeStore{}
+	exporter := NewExporter(nil, nil, store, "/corpus/", 2)
+	relationships := tables[3]
+
+	rows := &fakeRows{rows: [][]interface{}{relationshipRow("r1"), relationshipRow("r2"), relationshipRow("r3")}}
+	exported, err := exporter.writeTable(context.Background(), relationships, "2026-03-01", rows)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), exported.Rows)
+	require.Len(t, exported.Files, 2)
+	assert.Equal(t, "corpus/relationships/snapshot_date=2026-03-01/part-00000.parquet", exported.Files[0].Key)
+	assert.Equal(t, int64(2), exported.Files[0].Rows)
+	assert.Equal(t, int64(1), exported.Files[1].Rows)
+	assert.Equal(t, Column{Name: "strength", Type: "float64"}, exported.Columns[4])
+	for _, file := range exported.Files {
+		assert.Equal(t, "PAR1", string(store[file.Key][:4]))
+		assert.Equal(t, file.Bytes, int64(len(store[file.Key])))
+	}
+
+	// An empty table still gets a file carrying its schema
+	exported, err = exporter.writeTable(context.Background(), relationships, "2026-03-02", &fakeRows{})
+	require.NoError(t, err)
+	require.Len(t, exported.Files, 1)
+	assert.Equal(t, int64(0), exported.Files[0].Rows)
+
+	_, err = exporter.writeTable(context.Background(), relationships, "2026-03-03", &fakeRows{rows: [][]interface{}{{"r1"}}})
+	assert.Error(t, err)
+}
+
+func TestTableQueriesMatchColumns(t *testing.T) {
+	assert.Equal(t, "SELECT r.id::text AS relationship_id, r.source_id::text AS source_id, r.target_id::text AS target_id, "+
+		"r.relationship_type AS relationship_type, r.strength::float8 AS strength, r.metadata::text AS metadata, "+
+		"r.created_at AS created_at FROM relationships r ORDER BY r.id", tables[3].query())
+}
+
+func TestNextRun(t *testing.T) {
+	now := time.Date(2026, 3, 1, 1, 30, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC), NextRun(now, 2))
+	assert.Equal(t, time.Date(2026, 3, 2, 1, 0, 0, 0, time.UTC), NextRun(now, 1))
+}
+
+func TestFinishNotifiesOnExport(t *testing.T) {
+	exporter := NewExporter(nil, nil, fakeStore{}, "lake", 10)
+	var exported []*Manifest
+	exporter.OnExport(func(manifest *Manifest) {
+		// The status is already updated when the callback runs
+		assert.False(t, exporter.Status().Running)
+		exported = append(exported, manifest)
+	})
+
+	require.True(t, exporter.claim())
+	_, err := exporter.finish(nil, assert.AnError)
+	assert.Equal(t, assert.AnError, err)
+	assert.Empty(t, exported)
+
+	manifest := &Manifest{SnapshotDate: "2026-03-01", Bucket: "lake"}
+	require.True(t, exporter.claim())
+	got, err := exporter.finish(manifest, nil)
+	require.NoError(t, err)
+	assert.Same(t, manifest, got)
+	assert.Equal(t, []*Manifest{manifest}, exported)
+	assert.Same(t, manifest, exporter.Status().LastManifest)
+	assert.Equal(t, "lake/_manifests/2026-03-01.json", exporter.ManifestKey(manifest.SnapshotDate))
+}
@@ -0,0 +1,82 @@
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+
+	"dataflux/query-service/pkg/tokenizer"
+)
+
+// MinScore is how much evidence a language needs before a query is read in
+// it: two of its function words, or one and a letter only it uses
+const MinScore = 2
+
+// letters are the accented letters that point to the languages using them
+var letters = map[rune][]string{
+	'ß': {"de"}, 'ä': {"de"}, 'ö': {"de"}, 'ü': {"de"},
+	'ñ': {"es"}, '¿': {"es"}, '¡': {"es"},
+	'ç': {"fr", "pt"}, 'ê': {"fr", "pt"}, 'â': {"fr", "pt"}, 'ô': {"fr", "pt"},
+	'è': {"fr", "it"}, 'à': {"fr", "it", "pt"}, 'ù': {"fr", "it"},
+	'î': {"fr"}, 'ï': {"fr"}, 'œ': {"fr"}, 'ë': {"fr", "nl"},
+	'ã': {"pt"}, 'õ': {"pt"},
+	'ì': {"it"}, 'ò': {"it"},
+}
+
+// stopWords are the built-in lists of the tokenizer, which are what a
+// detected language changes
+var stopWords = func() map[string]map[string]bool {
+	lists := map[string][]string{"en": tokenizer.DefaultStopWords}
+	for language, words := range tokenizer.BuiltinStopWords {
+		lists[language] = words
+	}
+	sets := make(map[string]map[string]bool, len(lists))
+	for language, words := range lists {
+		sets[language] = map[string]bool{}
+		for _, word := range words {
+			sets[language][word] = true
+		}
+	}
+	return sets
+}()
+
+// Detect returns the ISO 639-1 code of the language a query is written in,
+// scoring each language by the function words and accented letters the
+// query contains. It returns "" when no language scores MinScore or two
+// languages score the same, as "en la playa" could be Spanish or French.
+func Detect(query string) string {
+	scores := map[string]int{}
+	query = strings.ToLower(query)
+	for _, word := range strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		for language, words := range stopWords {
+			if words[word] {
+				scores[language]++
+			}
+		}
+	}
+	seen := map[rune]bool{}
+	for _, r := range query {
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		for _, language := range letters[r] {
+			scores[language]++
+		}
+	}
+
+	best, bestScore, tied := "", 0, false
+	for language, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = language, score, false
+		case score == bestScore:
+			tied = true
+		}
+	}
+	if bestScore < MinScore || tied {
+		return ""
+	}
+	return best
+}
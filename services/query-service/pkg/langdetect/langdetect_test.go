@@ -0,0 +1,38 @@
+package langdetect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		query    string
+		language string
+	}{
+		{"dogs playing in the snow", "en"},
+		{"der Hund im Schnee", "de"},
+		{"Straße bei Nacht", "de"},
+		{"un chien dans la neige", "fr"},
+		{"los perros con sus dueños", "es"},
+		{"il gatto sul divano della nonna", "it"},
+		{"hond in de sneeuw", "nl"},
+		{"praia com os pássaros ao pôr do sol", "pt"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.language, Detect(test.query), test.query)
+	}
+}
+
+func TestDetectNeedsEnoughEvidence(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"beach scenes without people",
+		"die hard",
+		"perro en la playa",
+		"IMG_2041.jpg",
+	} {
+		assert.Empty(t, Detect(query), query)
+	}
+}
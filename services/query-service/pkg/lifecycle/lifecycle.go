@@ -0,0 +1,334 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Table outcome values
+const (
+	StatusOK      = "ok"
+	StatusDryRun  = "dry_run"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// lockKey makes sure only one replica manages the tables at a time
+const lockKey = "clickhouse:lifecycle:lock"
+
+// monthlyKey is how the partition key of a table partitioned by month starts
+const monthlyKey = "toYYYYMM("
+
+// monthPattern matches the IDs of monthly partitions, which are the only
+// values interpolated into statements
+var monthPattern = regexp.MustCompile(`^[0-9]{6}$`)
+
+// Table is the lifecycle of one ClickHouse table partitioned by month
+type Table struct {
+	Name string `json:"name"`
+	// RetentionMonths keeps the partition of the current month and this
+	// many before it; zero keeps every partition
+	RetentionMonths int `json:"retention_months"`
+}
+
+// ParseTables reads tables in the form "search_events:13,audit_events", where
+// a table without a retention keeps every partition
+func ParseTables(spec string) ([]Table, error) {
+	var tables []Table
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, months, found := strings.Cut(field, ":")
+		table := Table{Name: strings.TrimSpace(name)}
+		if found {
+			retention, err := strconv.Atoi(strings.TrimSpace(months))
+			if err != nil || retention < 0 {
+				return nil, fmt.Errorf("invalid retention in months for table %s: %q", table.Name, months)
+			}
+			table.RetentionMonths = retention
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// Partition is the active data of one month of a table
+type Partition struct {
+	ID    string `json:"id"`
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+	Parts int    `json:"parts"`
+}
+
+// TableReport is what one run found and did for a table. In a dry run,
+// Dropped and Optimized list what a run would drop and optimize.
+type TableReport struct {
+	Table           string      `json:"table"`
+	RetentionMonths int         `json:"retention_months"`
+	PartitionKey    string      `json:"partition_key,omitempty"`
+	Status          string      `json:"status"`
+	Partitions      []Partition `json:"partitions"`
+	Rows            int64       `json:"rows"`
+	Bytes           int64       `json:"bytes"`
+	Dropped         []string    `json:"dropped,omitempty"`
+	Optimized       []string    `json:"optimized,omitempty"`
+	Detail          string      `json:"detail,omitempty"`
+	Error           string      `json:"error,omitempty"`
+}
+
+// Report summarizes one run
+type Report struct {
+	DryRun     bool          `json:"dry_run"`
+	StartedAt  time.Time     `json:"started_at"`
+	DurationMs int64         `json:"duration_ms"`
+	Failed     int           `json:"failed"`
+	Tables     []TableReport `json:"tables"`
+}
+
+// Manager keeps ClickHouse tables partitioned by month from growing without
+// bound. Each run drops the partitions past a table's retention and merges
+// the parts of the closed months still kept into one, so old months cost
+// neither disk nor merge work. ClickHouse creates the partition of a month
+// with its first insert, so none are created ahead.
+type Manager struct {
+	client   *clickhouse.Client
+	redis    *redis.Client
+	tables   []Table
+	instance string
+
+	mu         sync.RWMutex
+	lastReport *Report
+}
+
+// NewManager creates a manager for the tables
+func NewManager(client *clickhouse.Client, redisClient *redis.Client, tables []Table) *Manager {
+	instance, _ := os.Hostname()
+	return &Manager{client: client, redis: redisClient, tables: tables, instance: instance}
+}
+
+// Tables returns the managed tables
+func (m *Manager) Tables() []Table {
+	return m.tables
+}
+
+// LastReport returns the report of the most recent run, if any
+func (m *Manager) LastReport() *Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastReport
+}
+
+// Run manages every table once. With dryRun set nothing is dropped or
+// optimized and the report only shows what would be.
+func (m *Manager) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	if !m.client.Enabled() {
+		return nil, fmt.Errorf("clickhouse not configured")
+	}
+	report := &Report{DryRun: dryRun, StartedAt: time.Now().UTC(), Tables: make([]TableReport, 0, len(m.tables))}
+	for _, table := range m.tables {
+		tableReport := m.manage(ctx, table, report.StartedAt, dryRun)
+		if tableReport.Status == StatusFailed {
+			report.Failed++
+		}
+		report.Tables = append(report.Tables, tableReport)
+	}
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	m.mu.Lock()
+	m.lastReport = report
+	m.mu.Unlock()
+	return report, nil
+}
+
+func (m *Manager) manage(ctx context.Context, table Table, now time.Time, dryRun bool) TableReport {
+	report := TableReport{Table: table.Name, RetentionMonths: table.RetentionMonths, Partitions: []Partition{}}
+	fail := func(err error) TableReport {
+		report.Status = StatusFailed
+		report.Error = err.Error()
+		return report
+	}
+
+	qualified, err := m.client.Table(table.Name)
+	if err != nil {
+		return fail(err)
+	}
+	key, exists, err := m.partitionKey(ctx, table.Name)
+	if err != nil {
+		return fail(err)
+	}
+	if !exists {
+		report.Status = StatusSkipped
+		report.Detail = "table does not exist"
+		return report
+	}
+	report.PartitionKey = key
+
+	if report.Partitions, err = m.partitions(ctx, table.Name); err != nil {
+		return fail(err)
+	}
+	for _, partition := range report.Partitions {
+		report.Rows += partition.Rows
+		report.Bytes += partition.Bytes
+	}
+	if !strings.HasPrefix(key, monthlyKey) {
+		report.Status = StatusSkipped
+		report.Detail = "table is not partitioned by month"
+		return report
+	}
+
+	current := Month(now)
+	var oldest string
+	if table.RetentionMonths > 0 {
+		oldest = Month(now.AddDate(0, -table.RetentionMonths, 0))
+	}
+	for _, partition := range report.Partitions {
+		if !monthPattern.MatchString(partition.ID) {
+			continue
+		}
+		switch {
+		case oldest != "" && partition.ID < oldest:
+			report.Dropped = append(report.Dropped, partition.ID)
+		case partition.ID < current && partition.Parts > 1:
+			report.Optimized = append(report.Optimized, partition.ID)
+		}
+	}
+
+	report.Status = StatusDryRun
+	if dryRun {
+		return report
+	}
+	report.Status = StatusOK
+	for _, id := range report.Dropped {
+		if _, err := m.client.Exec(ctx, fmt.Sprintf("ALTER TABLE %s DROP PARTITION ID '%s'", qualified, id), nil); err != nil {
+			return fail(fmt.Errorf("failed to drop partition %s of %s: %v", id, table.Name, err))
+		}
+	}
+	for _, id := range report.Optimized {
+		if _, err := m.client.Exec(ctx, fmt.Sprintf("OPTIMIZE TABLE %s PARTITION ID '%s' FINAL", qualified, id), nil); err != nil {
+			return fail(fmt.Errorf("failed to optimize partition %s of %s: %v", id, table.Name, err))
+		}
+	}
+	return report
+}
+
+// Month is the ID of the monthly partition holding t
+func Month(t time.Time) string {
+	return t.UTC().Format("200601")
+}
+
+// inDatabase is the client's database in the system tables, the server's
+// current one when none is configured
+const inDatabase = `if(empty({database:String}), currentDatabase(), {database:String})`
+
+// partitionKey reads the partition key of a table and whether it exists
+func (m *Manager) partitionKey(ctx context.Context, table string) (string, bool, error) {
+	body, err := m.client.Exec(ctx, `
+		SELECT partition_key
+		FROM system.tables
+		WHERE database = `+inDatabase+` AND name = {table:String}
+		FORMAT JSON`, map[string]string{"table": table, "database": m.client.Database()})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read table %s: %v", table, err)
+	}
+	var result struct {
+		Data []struct {
+			PartitionKey string `json:"partition_key"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", false, fmt.Errorf("failed to decode table %s: %v", table, err)
+	}
+	if len(result.Data) == 0 {
+		return "", false, nil
+	}
+	return result.Data[0].PartitionKey, true, nil
+}
+
+// partitions lists the active partitions of a table, oldest first
+func (m *Manager) partitions(ctx context.Context, table string) ([]Partition, error) {
+	body, err := m.client.Exec(ctx, `
+		SELECT partition_id, sum(rows) AS rows, sum(bytes_on_disk) AS bytes, count() AS parts
+		FROM system.parts
+		WHERE database = `+inDatabase+` AND table = {table:String} AND active
+		GROUP BY partition_id
+		ORDER BY partition_id
+		FORMAT JSON`, map[string]string{"table": table, "database": m.client.Database()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %s: %v", table, err)
+	}
+	var result struct {
+		Data []struct {
+			PartitionID string      `json:"partition_id"`
+			Rows        json.Number `json:"rows"`
+			Bytes       json.Number `json:"bytes"`
+			Parts       json.Number `json:"parts"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode partitions of %s: %v", table, err)
+	}
+	partitions := make([]Partition, 0, len(result.Data))
+	for _, row := range result.Data {
+		rows, _ := row.Rows.Int64()
+		bytes, _ := row.Bytes.Int64()
+		parts, _ := row.Parts.Int64()
+		partitions = append(partitions, Partition{ID: row.PartitionID, Rows: rows, Bytes: bytes, Parts: int(parts)})
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].ID < partitions[j].ID })
+	return partitions, nil
+}
+
+// Start runs the lifecycle every interval until ctx is cancelled. Replicas
+// share a Redis lock so only one of them runs each cycle.
+func (m *Manager) Start(ctx context.Context, interval time.Duration, dryRun bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.runScheduled(ctx, interval, dryRun)
+			}
+		}
+	}()
+}
+
+func (m *Manager) runScheduled(ctx context.Context, interval time.Duration, dryRun bool) {
+	acquired, err := m.redis.SetNX(ctx, lockKey, m.instance, interval/2).Result()
+	if err != nil {
+		log.Printf("Warning: clickhouse lifecycle lock failed: %v", err)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	report, err := m.Run(ctx, dryRun)
+	if err != nil {
+		log.Printf("Warning: clickhouse lifecycle failed: %v", err)
+		return
+	}
+	for _, table := range report.Tables {
+		log.Printf("ClickHouse lifecycle %s table=%s partitions=%d rows=%d bytes=%d dropped=%v optimized=%v %s%s",
+			table.Status, table.Table, len(table.Partitions), table.Rows, table.Bytes,
+			table.Dropped, table.Optimized, table.Detail, table.Error)
+	}
+}
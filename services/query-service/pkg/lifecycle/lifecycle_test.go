@@ -0,0 +1,141 @@
+package lifecycle
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTables(t *testing.T) {
+	tables, err := ParseTables(" search_events:13, audit_events ,")
+	require.NoError(t, err)
+	assert.Equal(t, []Table{{Name: "search_events", RetentionMonths: 13}, {Name: "audit_events"}}, tables)
+
+	_, err = ParseTables("search_events:a year")
+	assert.Error(t, err)
+	_, err = ParseTables("search_events:-1")
+	assert.Error(t, err)
+}
+
+// fakeClickHouse answers the system table queries and records the other statements
+type fakeClickHouse struct {
+	mu         sync.Mutex
+	statements []string
+	tables     map[string]string
+	partitions string
+}
+
+func (f *fakeClickHouse) server() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		statement := string(body)
+		table := r.URL.Query().Get("param_table")
+		switch {
+		case strings.Contains(statement, "FROM system.tables"):
+			if key, ok := f.tables[table]; ok {
+				w.Write([]byte(`{"data":[{"partition_key":"` + key + `"}]}`))
+				return
+			}
+			w.Write([]byte(`{"data":[]}`))
+		case strings.Contains(statement, "FROM system.parts"):
+			w.Write([]byte(f.partitions))
+		default:
+			f.mu.Lock()
+			f.statements = append(f.statements, statement)
+			f.mu.Unlock()
+		}
+	}))
+}
+
+func (f *fakeClickHouse) executed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.statements...)
+}
+
+func TestRun(t *testing.T) {
+	now := time.Now().UTC()
+	current := Month(now)
+	lastMonth := Month(now.AddDate(0, -1, 0))
+	expired := Month(now.AddDate(0, -14, 0))
+	kept := Month(now.AddDate(0, -13, 0))
+
+	fake := &fakeClickHouse{
+		tables: map[string]string{
+			"search_events": "toYYYYMM(timestamp)",
+			"asset_stats":   "",
+		},
+		partitions: `{"data":[
+			{"partition_id":"` + current + `","rows":"10","bytes":"100","parts":"4"},
+			{"partition_id":"` + lastMonth + `","rows":"20","bytes":"200","parts":"3"},
+			{"partition_id":"` + kept + `","rows":"30","bytes":"300","parts":"1"},
+			{"partition_id":"` + expired + `","rows":"40","bytes":"400","parts":"2"}]}`,
+	}
+	server := fake.server()
+	defer server.Close()
+
+	manager := NewManager(clickhouse.NewClient(server.URL, "", "", "dataflux"), nil, []Table{
+		{Name: "search_events", RetentionMonths: 13},
+		{Name: "asset_stats", RetentionMonths: 13},
+		{Name: "click_events", RetentionMonths: 13},
+	})
+	assert.Nil(t, manager.LastReport())
+
+	report, err := manager.Run(context.Background(), true)
+	require.NoError(t, err)
+	assert.Empty(t, fake.executed())
+	require.Len(t, report.Tables, 3)
+	events := report.Tables[0]
+	assert.Equal(t, StatusDryRun, events.Status)
+	assert.Equal(t, []string{expired}, events.Dropped)
+	// The current month is still written to, and a single part is merged already
+	assert.Equal(t, []string{lastMonth}, events.Optimized)
+	assert.Equal(t, int64(100), events.Rows)
+	assert.Equal(t, int64(1000), events.Bytes)
+	assert.Equal(t, expired, events.Partitions[0].ID)
+
+	assert.Equal(t, StatusSkipped, report.Tables[1].Status)
+	assert.Equal(t, "table is not partitioned by month", report.Tables[1].Detail)
+	assert.Equal(t, StatusSkipped, report.Tables[2].Status)
+	assert.Equal(t, "table does not exist", report.Tables[2].Detail)
+
+	report, err = manager.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, StatusOK, report.Tables[0].Status)
+	assert.Equal(t, 0, report.Failed)
+	assert.Equal(t, []string{
+		"ALTER TABLE dataflux.search_events DROP PARTITION ID '" + expired + "'",
+		"OPTIMIZE TABLE dataflux.search_events PARTITION ID '" + lastMonth + "' FINAL",
+	}, fake.executed())
+	assert.Same(t, report, manager.LastReport())
+}
+
+func TestRunWithoutRetentionKeepsPartitions(t *testing.T) {
+	fake := &fakeClickHouse{
+		tables:     map[string]string{"audit_events": "toYYYYMM(timestamp)"},
+		partitions: `{"data":[{"partition_id":"201901","rows":"1","bytes":"1","parts":"1"}]}`,
+	}
+	server := fake.server()
+	defer server.Close()
+
+	manager := NewManager(clickhouse.NewClient(server.URL, "", "", ""), nil, []Table{{Name: "audit_events"}})
+	report, err := manager.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Empty(t, report.Tables[0].Dropped)
+	assert.Empty(t, fake.executed())
+}
+
+func TestRunWithoutClickHouse(t *testing.T) {
+	_, err := NewManager(clickhouse.NewClient("", "", "", ""), nil, nil).Run(context.Background(), true)
+	assert.Error(t, err)
+}
@@ -0,0 +1,207 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Message is one message of a chat with a model
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Roles of chat messages
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Completer has a chat model reply to messages
+type Completer interface {
+	Complete(ctx context.Context, messages []Message) (string, error)
+	// Model names the model, to key cached replies
+	Model() string
+}
+
+// Chat model providers
+const (
+	// ProviderOpenAI is any API compatible with OpenAI's /chat/completions,
+	// which local model servers commonly offer
+	ProviderOpenAI = "openai"
+	// ProviderAnthropic is Anthropic's /messages API
+	ProviderAnthropic = "anthropic"
+)
+
+// Config selects and configures a chat model provider
+type Config struct {
+	Provider string
+	// URL of the API; empty means the provider's own
+	URL     string
+	Model   string
+	APIKey  string
+	Timeout time.Duration
+	// MaxTokens bounds the length of replies
+	MaxTokens int
+}
+
+// defaultMaxTokens bounds replies when the configuration does not
+const defaultMaxTokens = 1024
+
+// New creates the completer of the configured provider, or nil when no
+// model is configured
+func New(config Config) (Completer, error) {
+	if config.Model == "" {
+		return nil, nil
+	}
+	if config.MaxTokens <= 0 {
+		config.MaxTokens = defaultMaxTokens
+	}
+	client := client{config: config, httpClient: &http.Client{Timeout: config.Timeout}}
+	switch config.Provider {
+	case "", ProviderOpenAI:
+		client.config.URL = baseURL(config.URL, "https://api.openai.com/v1")
+		return openAI{client}, nil
+	case ProviderAnthropic:
+		client.config.URL = baseURL(config.URL, "https://api.anthropic.com/v1")
+		return anthropic{client}, nil
+	}
+	return nil, fmt.Errorf("unknown LLM provider %q", config.Provider)
+}
+
+func baseURL(url, fallback string) string {
+	if url == "" {
+		return fallback
+	}
+	return strings.TrimRight(url, "/")
+}
+
+type client struct {
+	config     Config
+	httpClient *http.Client
+}
+
+func (c client) Model() string {
+	return c.config.Model
+}
+
+// post sends body as JSON to path and decodes the reply into result
+func (c client) post(ctx context.Context, path string, header http.Header, body, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.URL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("LLM request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("LLM API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode LLM response: %v", err)
+	}
+	return nil
+}
+
+func reply(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("LLM API returned no reply")
+	}
+	return text, nil
+}
+
+// openAI talks to an OpenAI-compatible /chat/completions API
+type openAI struct {
+	client
+}
+
+func (o openAI) Complete(ctx context.Context, messages []Message) (string, error) {
+	header := http.Header{}
+	if o.config.APIKey != "" {
+		header.Set("Authorization", "Bearer "+o.config.APIKey)
+	}
+	var result struct {
+		Choices []struct {
+			Message Message `json:"message"`
+		} `json:"choices"`
+	}
+	err := o.post(ctx, "/chat/completions", header, map[string]interface{}{
+		"model":       o.config.Model,
+		"messages":    messages,
+		"max_tokens":  o.config.MaxTokens,
+		"temperature": 0,
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("LLM API returned no reply")
+	}
+	return reply(result.Choices[0].Message.Content)
+}
+
+// anthropicVersion is the Messages API version requested
+const anthropicVersion = "2023-06-01"
+
+// anthropic talks to Anthropic's /messages API, which takes the system
+// prompt apart from the messages
+type anthropic struct {
+	client
+}
+
+func (a anthropic) Complete(ctx context.Context, messages []Message) (string, error) {
+	var system []string
+	var chat []Message
+	for _, message := range messages {
+		if message.Role == RoleSystem {
+			system = append(system, message.Content)
+		} else {
+			chat = append(chat, message)
+		}
+	}
+	header := http.Header{}
+	header.Set("x-api-key", a.config.APIKey)
+	header.Set("anthropic-version", anthropicVersion)
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	body := map[string]interface{}{
+		"model":       a.config.Model,
+		"messages":    chat,
+		"max_tokens":  a.config.MaxTokens,
+		"temperature": 0,
+	}
+	if len(system) > 0 {
+		body["system"] = strings.Join(system, "\n\n")
+	}
+	if err := a.post(ctx, "/messages", header, body, &result); err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return reply(text.String())
+}
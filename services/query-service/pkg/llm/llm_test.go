@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var messages = []Message{
+	{Role: RoleSystem, Content: "Be brief."},
+	{Role: RoleUser, Content: "Summarize."},
+}
+
+func TestNew(t *testing.T) {
+	completer, err := New(Config{Provider: ProviderOpenAI})
+	require.NoError(t, err)
+	assert.Nil(t, completer)
+
+	_, err = New(Config{Provider: "cohere", Model: "m"})
+	assert.Error(t, err)
+
+	completer, err = New(Config{Model: "small-model"})
+	require.NoError(t, err)
+	assert.Equal(t, "small-model", completer.Model())
+}
+
+func TestOpenAI(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":" A flood. "}}]}`))
+	}))
+	defer server.Close()
+
+	completer, err := New(Config{URL: server.URL + "/v1/", Model: "small-model", APIKey: "key", Timeout: time.Second})
+	require.NoError(t, err)
+	text, err := completer.Complete(context.Background(), messages)
+	require.NoError(t, err)
+	assert.Equal(t, "A flood.", text)
+	assert.Equal(t, "small-model", body["model"])
+	assert.Equal(t, float64(defaultMaxTokens), body["max_tokens"])
+	assert.Len(t, body["messages"], 2)
+}
+
+func TestAnthropic(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages", r.URL.Path)
+		assert.Equal(t, "key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"content":[{"type":"text","text":"A flood "},{"type":"text","text":"in May."}]}`))
+	}))
+	defer server.Close()
+
+	completer, err := New(Config{Provider: ProviderAnthropic, URL: server.URL, Model: "small-model", APIKey: "key", MaxTokens: 300, Timeout: time.Second})
+	require.NoError(t, err)
+	text, err := completer.Complete(context.Background(), messages)
+	require.NoError(t, err)
+	assert.Equal(t, "A flood in May.", text)
+	// The system prompt travels apart from the messages
+	assert.Equal(t, "Be brief.", body["system"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"role": "user", "content": "Summarize."}}, body["messages"])
+	assert.Equal(t, float64(300), body["max_tokens"])
+}
+
+func TestCompleteFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty/chat/completions" {
+			w.Write([]byte(`{"choices":[{"message":{"content":"  "}}]}`))
+			return
+		}
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	completer, _ := New(Config{URL: server.URL, Model: "m", Timeout: time.Second})
+	_, err := completer.Complete(context.Background(), messages)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "429")
+
+	completer, _ = New(Config{URL: server.URL + "/empty", Model: "m", Timeout: time.Second})
+	_, err = completer.Complete(context.Background(), messages)
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package localize
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fields are the metadata fields that may be given in several languages,
+// as title.de and title.en
+var Fields = []string{"title", "description"}
+
+// Variants returns a field's values by language. A value may be stored
+// under field.<language> keys, as an object of languages under field, or
+// as a plain string under field, which is kept under the empty language.
+// Languages are lower-cased.
+func Variants(metadata map[string]interface{}, field string) map[string]string {
+	variants := map[string]string{}
+	switch value := metadata[field].(type) {
+	case string:
+		if value != "" {
+			variants[""] = value
+		}
+	case map[string]interface{}:
+		for language, text := range value {
+			if text, ok := text.(string); ok && text != "" {
+				variants[strings.ToLower(language)] = text
+			}
+		}
+	}
+	for key, value := range metadata {
+		language, ok := strings.CutPrefix(key, field+".")
+		if text, isText := value.(string); ok && isText && language != "" && text != "" {
+			variants[strings.ToLower(language)] = text
+		}
+	}
+	return variants
+}
+
+// Preferences orders the languages a caller wants: those named by the
+// request first, then the Accept-Language header by weight, then fallback.
+// Each regional tag is followed by its primary language, so "fr-CA" also
+// accepts "fr". Duplicates and "*" are dropped.
+func Preferences(requested []string, acceptLanguage, fallback string) []string {
+	var preferences []string
+	seen := map[string]bool{}
+	add := func(tag string) {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			return
+		}
+		primary, _, _ := strings.Cut(tag, "-")
+		for _, candidate := range []string{tag, primary} {
+			if !seen[candidate] {
+				seen[candidate] = true
+				preferences = append(preferences, candidate)
+			}
+		}
+	}
+	for _, tag := range requested {
+		add(tag)
+	}
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		add(tag)
+	}
+	add(fallback)
+	return preferences
+}
+
+// ValidTag reports whether tag looks like a BCP 47 language tag such as
+// "de" or "pt-BR": a primary language of 2 to 8 letters followed by
+// subtags of 1 to 8 letters or digits
+func ValidTag(tag string) bool {
+	for i, subtag := range strings.Split(tag, "-") {
+		if len(subtag) < 1 || len(subtag) > 8 || (i == 0 && len(subtag) < 2) {
+			return false
+		}
+		for _, c := range subtag {
+			letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+			if !letter && (i == 0 || c < '0' || c > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseAcceptLanguage returns the tags of an Accept-Language header,
+// highest weight first, leaving out those weighted 0
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag    string
+		weight float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if tag = strings.TrimSpace(tag); tag != "" && weight > 0 {
+			tags = append(tags, weighted{tag: tag, weight: weight})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].weight > tags[j].weight })
+	ordered := make([]string, len(tags))
+	for i, tag := range tags {
+		ordered[i] = tag.tag
+	}
+	return ordered
+}
+
+// Resolve picks the variant for the first preference it has. A preferred
+// primary language also takes a regional variant, so "de" finds "de-at".
+// Without any preferred variant it falls back to the untagged value, then
+// to the first language alphabetically, so something is always returned
+// when there are variants. ok is false only when there are none.
+func Resolve(variants map[string]string, preferences []string) (value, language string, ok bool) {
+	if len(variants) == 0 {
+		return "", "", false
+	}
+	languages := make([]string, 0, len(variants))
+	for language := range variants {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	for _, preference := range preferences {
+		if value, ok := variants[preference]; ok {
+			return value, preference, true
+		}
+		for _, language := range languages {
+			if strings.HasPrefix(language, preference+"-") {
+				return variants[language], language, true
+			}
+		}
+	}
+	if value, ok := variants[""]; ok {
+		return value, "", true
+	}
+	return variants[languages[0]], languages[0], true
+}
@@ -0,0 +1,59 @@
+package localize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariants(t *testing.T) {
+	metadata := map[string]interface{}{
+		"title":       "Harbour",
+		"title.de":    "Hafen",
+		"title.FR-ca": "Port",
+		"titles.es":   "Puerto",
+		"description": map[string]interface{}{"en": "Cranes at dusk", "it": ""},
+	}
+	assert.Equal(t, map[string]string{"": "Harbour", "de": "Hafen", "fr-ca": "Port"}, Variants(metadata, "title"))
+	assert.Equal(t, map[string]string{"en": "Cranes at dusk"}, Variants(metadata, "description"))
+	assert.Empty(t, Variants(metadata, "caption"))
+}
+
+func TestPreferences(t *testing.T) {
+	assert.Equal(t, []string{"fr-ca", "fr", "de", "en"}, Preferences([]string{"fr-CA"}, "de;q=0.8, *;q=0.1, es;q=0", "en"))
+	assert.Equal(t, []string{"nl", "de", "en"}, Preferences(nil, "de;q=0.5,nl", "en"))
+	assert.Equal(t, []string{"en"}, Preferences(nil, "", "en"))
+}
+
+func TestResolve(t *testing.T) {
+	variants := map[string]string{"": "Harbour", "de-at": "Hafen", "fr": "Port"}
+
+	value, language, ok := Resolve(variants, []string{"es", "de"})
+	assert.True(t, ok)
+	assert.Equal(t, "Hafen", value)
+	assert.Equal(t, "de-at", language)
+
+	value, language, _ = Resolve(variants, []string{"fr-ca", "fr"})
+	assert.Equal(t, "Port", value)
+	assert.Equal(t, "fr", language)
+
+	// Without a preferred variant the untagged one is used, then any
+	value, language, _ = Resolve(variants, []string{"es"})
+	assert.Equal(t, "Harbour", value)
+	assert.Equal(t, "", language)
+	value, language, _ = Resolve(map[string]string{"it": "Porto", "de": "Hafen"}, []string{"es"})
+	assert.Equal(t, "Hafen", value)
+	assert.Equal(t, "de", language)
+
+	_, _, ok = Resolve(map[string]string{}, []string{"en"})
+	assert.False(t, ok)
+}
+
+func TestValidTag(t *testing.T) {
+	for _, tag := range []string{"de", "pt-BR", "zh-Hant-TW", "es-419"} {
+		assert.True(t, ValidTag(tag), tag)
+	}
+	for _, tag := range []string{"", "d", "1a", "de-", "en_US", "de-toolongsubtag"} {
+		assert.False(t, ValidTag(tag), tag)
+	}
+}
@@ -0,0 +1,255 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ProtocolVersion is the newest Model Context Protocol revision served;
+// clients asking for an older supported one get theirs
+const ProtocolVersion = "2025-06-18"
+
+var supportedVersions = map[string]bool{ProtocolVersion: true, "2025-03-26": true, "2024-11-05": true}
+
+// JSON-RPC error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+)
+
+// DefaultMaxTokens is the token budget of a tool result when the call sets none
+const DefaultMaxTokens = 4000
+
+// Tool is a capability offered to LLM agents. InputSchema is the JSON
+// Schema of its arguments; Call receives them undecoded and returns a
+// value that is sent as JSON, trimmed to the caller's token budget.
+type Tool struct {
+	Name        string
+	Description string
+	InputSchema map[string]interface{}
+	Call        func(ctx context.Context, arguments json.RawMessage) (interface{}, error)
+}
+
+// Server answers MCP requests with a fixed set of tools
+type Server struct {
+	name      string
+	version   string
+	maxTokens int
+	tools     []Tool
+}
+
+// NewServer creates a server; maxTokens is the default token budget of
+// tool results, which calls may lower or raise with a max_tokens argument
+func NewServer(name, version string, maxTokens int, tools ...Tool) *Server {
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens
+	}
+	return &Server{name: name, version: version, maxTokens: maxTokens, tools: tools}
+}
+
+// request is a JSON-RPC request or, without an id, a notification
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Content is a block of a tool result
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// CallResult is the result of tools/call; IsError marks failures of the
+// tool itself, which the model should see, as opposed to protocol errors
+type CallResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// toolInfo is a tool as listed by tools/list
+type toolInfo struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// Handle answers one JSON-RPC message. It returns nil for notifications,
+// which get no response.
+func (s *Server) Handle(ctx context.Context, message []byte) []byte {
+	var req request
+	if err := json.Unmarshal(message, &req); err != nil {
+		return encode(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: CodeParseError, Message: "invalid JSON: " + err.Error()}})
+	}
+	if len(req.ID) == 0 {
+		return nil
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return encode(response{JSONRPC: "2.0", ID: req.ID, Error: &Error{Code: CodeInvalidRequest, Message: "not a JSON-RPC 2.0 request"}})
+	}
+
+	result, err := s.dispatch(ctx, req)
+	if err != nil {
+		return encode(response{JSONRPC: "2.0", ID: req.ID, Error: err})
+	}
+	return encode(response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func encode(resp response) []byte {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(response{JSONRPC: "2.0", ID: resp.ID, Error: &Error{Code: -32603, Message: err.Error()}})
+	}
+	return data
+}
+
+func (s *Server) dispatch(ctx context.Context, req request) (interface{}, *Error) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := ProtocolVersion
+		if supportedVersions[params.ProtocolVersion] {
+			version = params.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{"listChanged": false}},
+			"serverInfo":      map[string]string{"name": s.name, "version": s.version},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		tools := make([]toolInfo, len(s.tools))
+		for i, tool := range s.tools {
+			tools[i] = toolInfo{Name: tool.Name, Description: tool.Description, InputSchema: withMaxTokens(tool.InputSchema)}
+		}
+		return map[string]interface{}{"tools": tools}, nil
+	case "tools/call":
+		return s.call(ctx, req.Params)
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+// withMaxTokens adds the max_tokens argument every tool accepts
+func withMaxTokens(schema map[string]interface{}) map[string]interface{} {
+	extended := map[string]interface{}{}
+	for key, value := range schema {
+		extended[key] = value
+	}
+	properties := map[string]interface{}{}
+	if existing, ok := schema["properties"].(map[string]interface{}); ok {
+		for key, value := range existing {
+			properties[key] = value
+		}
+	}
+	properties["max_tokens"] = map[string]interface{}{
+		"type":        "integer",
+		"minimum":     100,
+		"description": "Approximate token budget of the result; longer results are trimmed",
+	}
+	extended["properties"] = properties
+	return extended
+}
+
+func (s *Server) call(ctx context.Context, params json.RawMessage) (*CallResult, *Error) {
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	var tool *Tool
+	for i := range s.tools {
+		if s.tools[i].Name == call.Name {
+			tool = &s.tools[i]
+		}
+	}
+	if tool == nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: "unknown tool: " + call.Name}
+	}
+
+	arguments := call.Arguments
+	if len(arguments) == 0 || bytes.Equal(arguments, []byte("null")) {
+		arguments = json.RawMessage("{}")
+	}
+	var budget struct {
+		MaxTokens int `json:"max_tokens"`
+	}
+	if err := json.Unmarshal(arguments, &budget); err != nil {
+		return failure(fmt.Errorf("arguments must be an object: %v", err)), nil
+	}
+	maxTokens := s.maxTokens
+	if budget.MaxTokens > 0 {
+		maxTokens = budget.MaxTokens
+	}
+
+	value, err := tool.Call(ctx, arguments)
+	if err != nil {
+		return failure(err), nil
+	}
+	text, trimmed, err := Trim(value, maxTokens)
+	if err != nil {
+		return failure(err), nil
+	}
+	result := &CallResult{Content: []Content{{Type: "text", Text: text}}}
+	if trimmed {
+		result.Content = append(result.Content, Content{Type: "text", Text: fmt.Sprintf(
+			"The result was trimmed to about %d tokens. Ask for fewer results or set a larger max_tokens for the rest.", maxTokens)})
+	}
+	return result, nil
+}
+
+func failure(err error) *CallResult {
+	return &CallResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}
+}
+
+// Serve answers newline-delimited messages from r on w until r ends or ctx
+// is done, as the stdio transport does
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if reply := s.Handle(ctx, line); reply != nil {
+			if _, err := w.Write(append(reply, '\n')); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
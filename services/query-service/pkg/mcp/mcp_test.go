@@ -0,0 +1,161 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoServer() *Server {
+	return NewServer("test", "1.0.0", 0, Tool{
+		Name:        "echo",
+		Description: "Returns its arguments",
+		InputSchema: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}},
+			"required":   []string{"text"},
+		},
+		Call: func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+			var args struct {
+				Text  string `json:"text"`
+				Count int    `json:"count"`
+			}
+			json.Unmarshal(arguments, &args)
+			if args.Text == "" {
+				return nil, errors.New("text is required")
+			}
+			items := make([]string, args.Count)
+			for i := range items {
+				items[i] = fmt.Sprintf("%s %d", args.Text, i)
+			}
+			return map[string]interface{}{"text": args.Text, "items": items}, nil
+		},
+	})
+}
+
+func handle(t *testing.T, s *Server, message string) map[string]interface{} {
+	reply := s.Handle(context.Background(), []byte(message))
+	require.NotNil(t, reply)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(reply, &decoded))
+	return decoded
+}
+
+func TestInitialize(t *testing.T) {
+	s := echoServer()
+	reply := handle(t, s, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`)
+	result := reply["result"].(map[string]interface{})
+	assert.Equal(t, "2025-03-26", result["protocolVersion"])
+	assert.Equal(t, map[string]interface{}{"name": "test", "version": "1.0.0"}, result["serverInfo"])
+
+	reply = handle(t, s, `{"jsonrpc":"2.0","id":"a","method":"initialize","params":{"protocolVersion":"1999-01-01"}}`)
+	assert.Equal(t, "a", reply["id"])
+	assert.Equal(t, ProtocolVersion, reply["result"].(map[string]interface{})["protocolVersion"])
+
+	assert.Nil(t, s.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)))
+}
+
+func TestListTools(t *testing.T) {
+	reply := handle(t, echoServer(), `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	tools := reply["result"].(map[string]interface{})["tools"].([]interface{})
+	require.Len(t, tools, 1)
+	schema := tools[0].(map[string]interface{})["inputSchema"].(map[string]interface{})
+	properties := schema["properties"].(map[string]interface{})
+	assert.Contains(t, properties, "text")
+	assert.Contains(t, properties, "max_tokens")
+	assert.Equal(t, []interface{}{"text"}, schema["required"])
+}
+
+func TestCallTool(t *testing.T) {
+	s := echoServer()
+	reply := handle(t, s, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"beach","count":2}}}`)
+	result := reply["result"].(map[string]interface{})
+	assert.Nil(t, result["isError"])
+	content := result["content"].([]interface{})
+	require.Len(t, content, 1)
+	assert.JSONEq(t, `{"text":"beach","items":["beach 0","beach 1"]}`, content[0].(map[string]interface{})["text"].(string))
+
+	// The tool's own failure goes to the model as an error result
+	reply = handle(t, s, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo"}}`)
+	result = reply["result"].(map[string]interface{})
+	assert.Equal(t, true, result["isError"])
+
+	// A small budget trims the result and says so
+	reply = handle(t, s, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"echo","arguments":{"text":"beach","count":500,"max_tokens":100}}}`)
+	content = reply["result"].(map[string]interface{})["content"].([]interface{})
+	require.Len(t, content, 2)
+	assert.LessOrEqual(t, EstimateTokens(content[0].(map[string]interface{})["text"].(string)), 100)
+	assert.Contains(t, content[1].(map[string]interface{})["text"], "trimmed")
+}
+
+func TestProtocolErrors(t *testing.T) {
+	s := echoServer()
+	for message, code := range map[string]float64{
+		`{"jsonrpc":"2.0","id":1,"method":"resources/list"}`:                      CodeMethodNotFound,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"nope"}}`: CodeInvalidParams,
+		`{"id":1,"method":"ping"}`:                                                CodeInvalidRequest,
+		`{"jsonrpc":"2.0","id":1,"method":`:                                       CodeParseError,
+	} {
+		reply := handle(t, s, message)
+		assert.Equal(t, code, reply["error"].(map[string]interface{})["code"], message)
+	}
+}
+
+func TestServe(t *testing.T) {
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+		``,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+	}, "\n")
+	var output strings.Builder
+	require.NoError(t, echoServer().Serve(context.Background(), strings.NewReader(input), &output))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{}}`, lines[0])
+	assert.Contains(t, lines[1], `"id":2`)
+}
+
+func TestTrim(t *testing.T) {
+	text, trimmed, err := Trim(map[string]interface{}{"a": 1}, 10)
+	require.NoError(t, err)
+	assert.False(t, trimmed)
+	assert.Equal(t, `{"a":1}`, text)
+
+	// Long strings are cut before any element is dropped
+	long := strings.Repeat("x", 2000)
+	text, trimmed, err = Trim([]map[string]string{{"id": "a", "text": long}, {"id": "b", "text": long}}, 200)
+	require.NoError(t, err)
+	assert.True(t, trimmed)
+	var cut []map[string]string
+	require.NoError(t, json.Unmarshal([]byte(text), &cut))
+	require.Len(t, cut, 2)
+	assert.Equal(t, strings.Repeat("x", 300)+"…", cut[0]["text"])
+
+	// Then the longest list loses elements from its end
+	results := make([]map[string]interface{}, 100)
+	for i := range results {
+		results[i] = map[string]interface{}{"id": fmt.Sprintf("asset-%d", i), "tags": []string{"a", "b"}}
+	}
+	text, trimmed, err = Trim(map[string]interface{}{"results": results, "total": 100}, 150)
+	require.NoError(t, err)
+	assert.True(t, trimmed)
+	assert.LessOrEqual(t, EstimateTokens(text), 150)
+	var kept struct {
+		Results []struct {
+			ID string `json:"id"`
+		} `json:"results"`
+		Total int `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(text), &kept))
+	assert.Equal(t, 100, kept.Total)
+	require.NotEmpty(t, kept.Results)
+	assert.Equal(t, "asset-0", kept.Results[0].ID)
+}
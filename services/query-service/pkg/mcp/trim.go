@@ -0,0 +1,111 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// charsPerToken approximates how many bytes of JSON make up one token
+const charsPerToken = 4
+
+// stringLimits are the lengths long strings are cut to in turn, so
+// descriptions and transcripts shrink before any result is dropped
+var stringLimits = []int{1000, 300, 100}
+
+// EstimateTokens approximates the tokens a model spends reading text
+func EstimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// Trim encodes value as JSON of about maxTokens tokens at most. Long
+// strings are cut first, then elements are dropped from the end of the
+// longest lists, which keeps the best ranked results. It reports whether
+// anything was cut.
+func Trim(value interface{}, maxTokens int) (string, bool, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to encode result: %v", err)
+	}
+	if EstimateTokens(string(encoded)) <= maxTokens {
+		return string(encoded), false, nil
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(encoded, &generic); err != nil {
+		return "", false, fmt.Errorf("failed to decode result: %v", err)
+	}
+	for _, limit := range stringLimits {
+		generic = cutStrings(generic, limit)
+		if encoded, _ = json.Marshal(generic); EstimateTokens(string(encoded)) <= maxTokens {
+			return string(encoded), true, nil
+		}
+	}
+
+	for {
+		length, shorten := longestList(&generic)
+		if length == 0 {
+			return string(encoded), true, nil
+		}
+		// Shrink in proportion to the overshoot, always by at least one
+		keep := length * maxTokens / EstimateTokens(string(encoded))
+		if keep >= length {
+			keep = length - 1
+		}
+		shorten(keep)
+		if encoded, _ = json.Marshal(generic); EstimateTokens(string(encoded)) <= maxTokens {
+			return string(encoded), true, nil
+		}
+	}
+}
+
+// cutStrings shortens strings longer than limit bytes, marking the cut
+func cutStrings(value interface{}, limit int) interface{} {
+	switch v := value.(type) {
+	case string:
+		if len(v) > limit {
+			runes := []rune(v)
+			if len(runes) > limit {
+				return string(runes[:limit]) + "…"
+			}
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = cutStrings(v[i], limit)
+		}
+		return v
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = cutStrings(v[key], limit)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// longestList finds the list with the most elements anywhere in value;
+// shorten truncates it in place. The length is zero when every list is empty.
+func longestList(value *interface{}) (length int, shorten func(keep int)) {
+	var visit func(v interface{}, set func(interface{}))
+	visit = func(v interface{}, set func(interface{})) {
+		switch v := v.(type) {
+		case []interface{}:
+			if len(v) > length {
+				length = len(v)
+				shorten = func(keep int) { set(v[:keep]) }
+			}
+			for i := range v {
+				i := i
+				visit(v[i], func(element interface{}) { v[i] = element })
+			}
+		case map[string]interface{}:
+			for key, element := range v {
+				key := key
+				visit(element, func(element interface{}) { v[key] = element })
+			}
+		}
+	}
+	visit(*value, func(v interface{}) { *value = v })
+	return length, shorten
+}
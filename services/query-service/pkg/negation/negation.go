@@ -0,0 +1,129 @@
+package negation
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxWords bounds how many words one excluded term takes after its cue
+const MaxWords = 3
+
+// cues start an exclusion, as in "beach scenes without people"
+var cues = map[string]bool{
+	"without": true, "excluding": true, "except": true, "minus": true, "no": true, "not": true,
+}
+
+// separators join several excluded terms under one cue, as in
+// "without people or cars"
+var separators = map[string]bool{"or": true, "nor": true, "and": true}
+
+// boundaries end an exclusion, so "without people in the water" only
+// excludes people
+var boundaries = map[string]bool{
+	"but": true, "with": true, "in": true, "on": true, "at": true, "from": true, "of": true,
+	"for": true, "near": true, "by": true, "during": true, "to": true, "showing": true,
+	"that": true, "which": true, "where": true, "while": true,
+}
+
+// determiners after a cue are not part of the excluded term
+var determiners = map[string]bool{
+	"a": true, "an": true, "the": true, "any": true, "some": true, "other": true, "more": true,
+}
+
+// Extract finds the terms an English query excludes, through a cue such as
+// "without" or a leading minus as in "-people". It returns them lower-cased
+// with the query without the exclusions.
+func Extract(text string) ([]string, string) {
+	var excluded, rest []string
+	fields := strings.Fields(text)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if term := strings.TrimLeft(field, "-"); term != field && len(field)-len(term) == 1 {
+			if word := clean(term); word != "" {
+				excluded = appendTerm(excluded, word)
+				continue
+			}
+		}
+		if !cues[clean(field)] {
+			rest = append(rest, field)
+			continue
+		}
+
+		terms, next := scope(fields, i+1)
+		if len(terms) == 0 {
+			// A cue with nothing to exclude, as in "yes or no", is kept
+			rest = append(rest, field)
+			continue
+		}
+		for _, term := range terms {
+			excluded = appendTerm(excluded, term)
+		}
+		i = next - 1
+	}
+	return excluded, strings.Join(rest, " ")
+}
+
+// scope reads the terms a cue excludes from fields[start:] and returns the
+// index of the first field after them
+func scope(fields []string, start int) ([]string, int) {
+	var terms []string
+	var words []string
+	end := func() {
+		if len(words) > 0 {
+			terms = append(terms, strings.Join(words, " "))
+			words = nil
+		}
+	}
+
+	i := start
+	for ; i < len(fields); i++ {
+		word := clean(fields[i])
+		switch {
+		case word == "" || boundaries[word] || (cues[word] && len(words) > 0):
+			end()
+			return terms, i
+		case separators[word]:
+			end()
+			// "no people and no cars" continues with the next cue
+			if i+1 < len(fields) && cues[clean(fields[i+1])] {
+				i++
+			}
+		case cues[word]:
+			// "not without" and the like are read as the next cue alone
+		case determiners[word] && len(words) == 0:
+		case len(words) == MaxWords:
+			end()
+			return terms, i
+		default:
+			words = append(words, word)
+		}
+		if endsClause(fields[i]) {
+			end()
+			return terms, i + 1
+		}
+	}
+	end()
+	return terms, i
+}
+
+// clean lower-cases a field and trims punctuation around it
+func clean(field string) string {
+	return strings.ToLower(strings.TrimFunc(field, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+}
+
+// endsClause reports whether a field ends in punctuation closing the
+// exclusion, as the comma in "without people, at sunset"
+func endsClause(field string) bool {
+	return strings.HasSuffix(field, ",") || strings.HasSuffix(field, ";") || strings.HasSuffix(field, ".")
+}
+
+func appendTerm(terms []string, term string) []string {
+	for _, existing := range terms {
+		if existing == term {
+			return terms
+		}
+	}
+	return append(terms, term)
+}
@@ -0,0 +1,43 @@
+package negation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		query    string
+		excluded []string
+		rest     string
+	}{
+		{"beach scenes without people", []string{"people"}, "beach scenes"},
+		{"beach without people in the water", []string{"people"}, "beach in the water"},
+		{"street photos without any cars or bikes", []string{"cars", "bikes"}, "street photos"},
+		{"harbour, no people and no boats", []string{"people", "boats"}, "harbour,"},
+		{"Forest excluding red deer, at dawn", []string{"red deer"}, "Forest at dawn"},
+		{"mountains -snow -clouds", []string{"snow", "clouds"}, "mountains"},
+		{"interviews not outdoors", []string{"outdoors"}, "interviews"},
+		{"city without people without people", []string{"people"}, "city"},
+		{"concert without large crowd noise today", []string{"large crowd noise"}, "concert today"},
+	}
+	for _, test := range tests {
+		excluded, rest := Extract(test.query)
+		assert.Equal(t, test.excluded, excluded, test.query)
+		assert.Equal(t, test.rest, rest, test.query)
+	}
+}
+
+func TestExtractLeavesQueriesWithoutExclusionsAlone(t *testing.T) {
+	for _, query := range []string{
+		"beach scenes with people",
+		"t-shirt mockups",
+		"yes or no",
+		"people walking",
+	} {
+		excluded, rest := Extract(query)
+		assert.Empty(t, excluded, query)
+		assert.Equal(t, query, rest)
+	}
+}
@@ -2,51 +2,130 @@ package neo4j
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"sync/atomic"
 	"time"
+
+	"dataflux/query-service/pkg/retry"
 )
 
+// DefaultDatabase is the database Cypher runs in unless SetDatabase names
+// another
+const DefaultDatabase = "neo4j"
+
 // Neo4jConfig holds Neo4j configuration
 type Neo4jConfig struct {
 	URL      string
-	Username string
-	Password string
+	Database string
 	Timeout  time.Duration
 }
 
-// Neo4jClient handles Neo4j operations
-type Neo4jClient struct {
+// endpoint is the server a client talks to, the credentials it logs in
+// with and its connection pool. It is replaced as a whole, so a request
+// uses one endpoint from start to finish.
+type endpoint struct {
 	config     Neo4jConfig
 	httpClient *http.Client
+	username   string
+	password   string
+}
+
+// Neo4jClient handles Neo4j operations
+type Neo4jClient struct {
+	// current is shared by the client and its tenant views, so a new
+	// endpoint reaches every view
+	current *atomic.Pointer[endpoint]
+	tenant  string
 }
 
 // NewNeo4jClient creates a new Neo4j client
 func NewNeo4jClient(url, username, password string) *Neo4jClient {
-	return &Neo4jClient{
+	n := &Neo4jClient{current: &atomic.Pointer[endpoint]{}}
+	n.current.Store(newEndpoint(url, username, password))
+	return n
+}
+
+func newEndpoint(url, username, password string) *endpoint {
+	return &endpoint{
 		config: Neo4jConfig{
 			URL:      url,
-			Username: username,
-			Password: password,
+			Database: DefaultDatabase,
 			Timeout:  30 * time.Second,
 		},
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
 		},
+		username: username,
+		password: password,
+	}
+}
+
+// SetCredentials replaces the username and password of the client and its
+// tenant views, as when they are rotated
+func (n *Neo4jClient) SetCredentials(username, password string) {
+	for {
+		old := n.current.Load()
+		next := *old
+		next.username, next.password = username, password
+		if n.current.CompareAndSwap(old, &next) {
+			return
+		}
+	}
+}
+
+// SetDatabase selects the database the client and its tenant views run
+// Cypher in
+func (n *Neo4jClient) SetDatabase(database string) {
+	for {
+		old := n.current.Load()
+		next := *old
+		next.config.Database = database
+		if n.current.CompareAndSwap(old, &next) {
+			return
+		}
 	}
 }
 
+// Reconfigure points the client and its tenant views at a server, with a
+// new connection pool, keeping the database. Requests already sent finish
+// on the old pool, whose connections are closed once they have timed out.
+func (n *Neo4jClient) Reconfigure(url, username, password string) {
+	next := newEndpoint(url, username, password)
+	for {
+		old := n.current.Load()
+		next.config.Database = old.config.Database
+		if n.current.CompareAndSwap(old, next) {
+			time.AfterFunc(old.config.Timeout, old.httpClient.CloseIdleConnections)
+			return
+		}
+	}
+}
+
+// URL returns the server the client talks to
+func (n *Neo4jClient) URL() string {
+	return n.current.Load().config.URL
+}
+
+func (e *endpoint) setBasicAuth(req *http.Request) {
+	req.SetBasicAuth(e.username, e.password)
+}
+
 // HealthCheck checks if Neo4j is healthy
 func (n *Neo4jClient) HealthCheck() bool {
-	req, err := http.NewRequest("GET", n.config.URL+"/db/data/", nil)
+	e := n.current.Load()
+	req, err := http.NewRequest("GET", e.config.URL+"/db/data/", nil)
 	if err != nil {
 		return false
 	}
-	req.SetBasicAuth(n.config.Username, n.config.Password)
+	e.setBasicAuth(req)
 
-	resp, err := n.httpClient.Do(req)
+	resp, err := e.httpClient.Do(req)
 	if err != nil {
 		return false
 	}
@@ -77,7 +156,33 @@ type CypherResponse struct {
 
 // ExecuteCypher executes a Cypher query
 func (n *Neo4jClient) ExecuteCypher(query string, parameters map[string]interface{}) (*CypherResponse, error) {
-	url := n.config.URL + "/db/data/transaction/commit"
+	return n.ExecuteCypherContext(context.Background(), query, parameters)
+}
+
+// ExecuteCypherContext executes a Cypher query, giving up when ctx is done
+func (n *Neo4jClient) ExecuteCypherContext(ctx context.Context, query string, parameters map[string]interface{}) (*CypherResponse, error) {
+	return n.execute(ctx, query, parameters, false, 0)
+}
+
+// readCypher executes a statement that only reads in a read-only transaction
+func (n *Neo4jClient) readCypher(query string, parameters map[string]interface{}) (*CypherResponse, error) {
+	return n.readCypherContext(context.Background(), query, parameters)
+}
+
+// readCypherContext is readCypher giving up when ctx is done
+func (n *Neo4jClient) readCypherContext(ctx context.Context, query string, parameters map[string]interface{}) (*CypherResponse, error) {
+	return n.execute(ctx, query, parameters, true, 0)
+}
+
+// execute runs a statement in its own transaction through the transactional
+// HTTP endpoint of the database, /db/{name}/tx/commit. A read-only
+// transaction is opened with the access-mode: READ header, so the server
+// refuses any write, which makes it safe to retry after a transient
+// failure; a maxBytes above zero fails responses larger than that with
+// ErrResultTooLarge. Cancelling ctx abandons the request.
+func (n *Neo4jClient) execute(ctx context.Context, query string, parameters map[string]interface{}, readOnly bool, maxBytes int64) (*CypherResponse, error) {
+	e := n.current.Load()
+	url := e.config.URL + "/db/" + neturl.PathEscape(e.config.Database) + "/tx/commit"
 
 	payload := map[string]interface{}{
 		"statements": []CypherRequest{
@@ -93,23 +198,45 @@ func (n *Neo4jClient) ExecuteCypher(query string, parameters map[string]interfac
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+	newRequest := func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		e.setBasicAuth(req)
+		req.Header.Set("Content-Type", "application/json")
+		if readOnly {
+			req.Header.Set("access-mode", "READ")
+		}
+		return req, nil
 	}
-	req.SetBasicAuth(n.config.Username, n.config.Password)
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := n.httpClient.Do(req)
+	var resp *http.Response
+	if readOnly {
+		resp, err = retry.Default.Send(ctx, "neo4j", e.httpClient, newRequest)
+	} else {
+		var req *http.Request
+		if req, err = newRequest(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = e.httpClient.Do(req)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %v", err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	reader := io.Reader(resp.Body)
+	if maxBytes > 0 {
+		reader = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	body, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
+	if maxBytes > 0 && int64(len(body)) > maxBytes {
+		return nil, ErrResultTooLarge
+	}
 
 	var cypherResp CypherResponse
 	if err := json.Unmarshal(body, &cypherResp); err != nil {
@@ -117,7 +244,7 @@ func (n *Neo4jClient) ExecuteCypher(query string, parameters map[string]interfac
 	}
 
 	if len(cypherResp.Errors) > 0 {
-		return nil, fmt.Errorf("cypher error: %s", cypherResp.Errors[0].Message)
+		return nil, &CypherError{Code: cypherResp.Errors[0].Code, Message: cypherResp.Errors[0].Message}
 	}
 
 	return &cypherResp, nil
@@ -171,24 +298,31 @@ type Recommendation struct {
 	Tags            []string `json:"tags"`
 	SimilarityScore float64  `json:"similarity_score"`
 	SimilarityType  string   `json:"similarity_type"`
+	CollectionID    string   `json:"collection_id,omitempty"`
 }
 
-// CreateAsset creates an asset node
+// CreateAsset creates an asset node, or updates the one with the same
+// asset_id, so indexing an asset again changes nothing. A tenant view
+// labels the node with its tenant. Metadata is stored as JSON, as node
+// properties cannot be maps.
 func (n *Neo4jClient) CreateAsset(asset Asset) error {
+	metadata, err := json.Marshal(asset.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal asset metadata: %v", err)
+	}
 	query := `
-		CREATE (a:Asset:Entity {
-			entity_id: $entity_id,
-			asset_id: $asset_id,
-			filename: $filename,
-			mime_type: $mime_type,
-			file_size: $file_size,
-			processing_status: $processing_status,
-			created_at: $created_at,
-			updated_at: $updated_at,
-			metadata: $metadata,
-			tags: $tags,
-			collection_id: $collection_id
-		})
+		MERGE (a:Asset {asset_id: $asset_id})
+		ON CREATE SET a.created_at = $created_at
+		SET a:Entity` + n.tenantLabel("a") + `,
+			a.entity_id = $entity_id,
+			a.filename = $filename,
+			a.mime_type = $mime_type,
+			a.file_size = $file_size,
+			a.processing_status = $processing_status,
+			a.updated_at = $updated_at,
+			a.metadata = $metadata,
+			a.tags = $tags,
+			a.collection_id = $collection_id
 		RETURN a
 	`
 
@@ -201,33 +335,33 @@ func (n *Neo4jClient) CreateAsset(asset Asset) error {
 		"processing_status": asset.ProcessingStatus,
 		"created_at":        asset.CreatedAt,
 		"updated_at":        asset.UpdatedAt,
-		"metadata":          asset.Metadata,
+		"metadata":          string(metadata),
 		"tags":              asset.Tags,
 		"collection_id":     asset.CollectionID,
 	}
 
-	_, err := n.ExecuteCypher(query, parameters)
+	_, err = n.ExecuteCypher(query, parameters)
 	return err
 }
 
-// CreateSegment creates a segment node
+// CreateSegment creates a segment node, or updates the one with the same
+// segment_id
 func (n *Neo4jClient) CreateSegment(segment Segment) error {
 	query := `
-		CREATE (s:Segment:Entity {
-			entity_id: $entity_id,
-			segment_id: $segment_id,
-			asset_id: $asset_id,
-			segment_type: $segment_type,
-			sequence_number: $sequence_number,
-			start_time: $start_time,
-			end_time: $end_time,
-			confidence_score: $confidence_score,
-			content_description: $content_description,
-			detected_objects: $detected_objects,
-			detected_text: $detected_text,
-			created_at: $created_at,
-			updated_at: $updated_at
-		})
+		MERGE (s:Segment {segment_id: $segment_id})
+		ON CREATE SET s.created_at = $created_at
+		SET s:Entity` + n.tenantLabel("s") + `,
+			s.entity_id = $entity_id,
+			s.asset_id = $asset_id,
+			s.segment_type = $segment_type,
+			s.sequence_number = $sequence_number,
+			s.start_time = $start_time,
+			s.end_time = $end_time,
+			s.confidence_score = $confidence_score,
+			s.content_description = $content_description,
+			s.detected_objects = $detected_objects,
+			s.detected_text = $detected_text,
+			s.updated_at = $updated_at
 		RETURN s
 	`
 
@@ -251,25 +385,43 @@ func (n *Neo4jClient) CreateSegment(segment Segment) error {
 	return err
 }
 
-// CreateAssetSegmentRelationship creates a relationship between asset and segment
+// CreateAssetSegmentRelationship links an asset to its segment once; it
+// fails with ErrNotFound when either node is missing
 func (n *Neo4jClient) CreateAssetSegmentRelationship(assetID, segmentID string, sequence int) error {
 	query := `
 		MATCH (a:Asset {asset_id: $asset_id}), (s:Segment {segment_id: $segment_id})
-		CREATE (a)-[:CONTAINS {
-			relationship_type: 'contains',
-			sequence: $sequence,
-			created_at: datetime()
-		}]->(s)
-		RETURN a, s
+		WHERE ` + n.inTenant("a") + ` AND ` + n.inTenant("s") + `
+		MERGE (a)-[r:CONTAINS]->(s)
+		ON CREATE SET r.relationship_type = 'contains', r.created_at = datetime()
+		SET r.sequence = $sequence
+		RETURN r.sequence
 	`
 
 	parameters := map[string]interface{}{
-		"asset_id":  assetID,
+		"asset_id":   assetID,
 		"segment_id": segmentID,
-		"sequence":  sequence,
+		"sequence":   sequence,
 	}
 
-	_, err := n.ExecuteCypher(query, parameters)
+	resp, err := n.ExecuteCypher(query, parameters)
+	if err != nil {
+		return err
+	}
+	if len(resp.Results) == 0 || len(resp.Results[0].Data) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteAsset removes an asset node with its segments and relationships;
+// a missing asset is not an error
+func (n *Neo4jClient) DeleteAsset(assetID string) error {
+	query := `
+		MATCH (a:Asset {asset_id: $asset_id}) WHERE ` + n.inTenant("a") + `
+		OPTIONAL MATCH (a)-[:CONTAINS]->(s:Segment)
+		DETACH DELETE s, a
+	`
+	_, err := n.ExecuteCypher(query, map[string]interface{}{"asset_id": assetID})
 	return err
 }
 
@@ -313,7 +465,7 @@ func (n *Neo4jClient) FindSimilarAssets(assetID string, threshold float64, limit
 		"limit":     limit,
 	}
 
-	resp, err := n.ExecuteCypher(query, parameters)
+	resp, err := n.readCypher(query, parameters)
 	if err != nil {
 		return nil, err
 	}
@@ -335,49 +487,46 @@ func (n *Neo4jClient) FindSimilarAssets(assetID string, threshold float64, limit
 	return similarAssets, nil
 }
 
-// GetRecommendations gets content recommendations based on similarity
-func (n *Neo4jClient) GetRecommendations(assetID string, limit int) ([]Recommendation, error) {
+// GetRecommendations returns the assets most similar to one by their
+// SIMILAR_TO edges, most similar first. A non-nil collectionIDs keeps only
+// assets in those collections.
+func (n *Neo4jClient) GetRecommendations(assetID string, collectionIDs []string, limit int) ([]Recommendation, error) {
 	query := `
 		MATCH (a1:Asset {asset_id: $asset_id})-[r:SIMILAR_TO]->(a2:Asset)
 		WHERE r.similarity_score >= 0.6
+		  AND ` + n.inTenant("a1") + ` AND ` + n.inTenant("a2") + ` AND ` + inCollections("a2") + `
 		RETURN a2.asset_id, a2.filename, a2.mime_type, a2.tags,
-		       r.similarity_score, r.similarity_type
+		       r.similarity_score, r.similarity_type, a2.collection_id
 		ORDER BY r.similarity_score DESC
 		LIMIT $limit
 	`
 
 	parameters := map[string]interface{}{
-		"asset_id": assetID,
-		"limit":    limit,
+		"asset_id":       assetID,
+		"collection_ids": collectionIDs,
+		"limit":          limit,
 	}
 
-	resp, err := n.ExecuteCypher(query, parameters)
+	resp, err := n.readCypher(query, parameters)
 	if err != nil {
 		return nil, err
 	}
 
-	var recommendations []Recommendation
-	if len(resp.Results) > 0 && len(resp.Results[0].Data) > 0 {
+	recommendations := []Recommendation{}
+	if len(resp.Results) > 0 {
 		for _, row := range resp.Results[0].Data {
-			if len(row.Row) >= 6 {
-				tags := []string{}
-				if tagsInterface, ok := row.Row[3].([]interface{}); ok {
-					for _, tag := range tagsInterface {
-						if tagStr, ok := tag.(string); ok {
-							tags = append(tags, tagStr)
-						}
-					}
-				}
-
-				recommendations = append(recommendations, Recommendation{
-					AssetID:         row.Row[0].(string),
-					Filename:        row.Row[1].(string),
-					MimeType:        row.Row[2].(string),
-					Tags:            tags,
-					SimilarityScore: row.Row[4].(float64),
-					SimilarityType:  row.Row[5].(string),
-				})
+			if len(row.Row) < 7 {
+				continue
 			}
+			recommendations = append(recommendations, Recommendation{
+				AssetID:         stringValue(row.Row[0]),
+				Filename:        stringValue(row.Row[1]),
+				MimeType:        stringValue(row.Row[2]),
+				Tags:            stringValues(row.Row[3]),
+				SimilarityScore: floatValue(row.Row[4]),
+				SimilarityType:  stringValue(row.Row[5]),
+				CollectionID:    stringValue(row.Row[6]),
+			})
 		}
 	}
 
@@ -401,7 +550,7 @@ func (n *Neo4jClient) FindObjectsInSegments(objectName string, limit int) ([]map
 		"limit":       limit,
 	}
 
-	resp, err := n.ExecuteCypher(query, parameters)
+	resp, err := n.readCypher(query, parameters)
 	if err != nil {
 		return nil, err
 	}
@@ -446,7 +595,7 @@ func (n *Neo4jClient) GetAssetSegments(assetID string) ([]map[string]interface{}
 		"asset_id": assetID,
 	}
 
-	resp, err := n.ExecuteCypher(query, parameters)
+	resp, err := n.readCypher(query, parameters)
 	if err != nil {
 		return nil, err
 	}
@@ -470,6 +619,145 @@ func (n *Neo4jClient) GetAssetSegments(assetID string) ([]map[string]interface{}
 	return segments, nil
 }
 
+// GetAssetProperties returns the properties of an asset node, or nil when the
+// asset is not in the graph
+func (n *Neo4jClient) GetAssetProperties(assetID string) (map[string]interface{}, error) {
+	query := `
+		MATCH (a:Asset)
+		WHERE a.asset_id = $asset_id OR a.entity_id = $asset_id
+		RETURN properties(a)
+		LIMIT 1
+	`
+
+	resp, err := n.readCypher(query, map[string]interface{}{"asset_id": assetID})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Results) == 0 || len(resp.Results[0].Data) == 0 || len(resp.Results[0].Data[0].Row) == 0 {
+		return nil, nil
+	}
+	properties, _ := resp.Results[0].Data[0].Row[0].(map[string]interface{})
+	return properties, nil
+}
+
+// AssetContext is the graph neighbourhood of one asset used to enrich search results
+type AssetContext struct {
+	AssetID  string         `json:"asset_id"`
+	Segments []Segment      `json:"segments"`
+	Related  []SimilarAsset `json:"related"`
+}
+
+// GetAssetContexts fetches segments and similar assets for all given assets in
+// one round trip. A non-nil collectionIDs leaves out assets, and similar
+// assets, outside those collections.
+func (n *Neo4jClient) GetAssetContexts(assetIDs, collectionIDs []string, segmentLimit, relatedLimit int) (map[string]AssetContext, error) {
+	contexts := make(map[string]AssetContext, len(assetIDs))
+	if len(assetIDs) == 0 {
+		return contexts, nil
+	}
+
+	query := `
+		UNWIND $asset_ids AS asset_id
+		MATCH (a:Asset {asset_id: asset_id}) WHERE ` + n.inTenant("a") + ` AND ` + inCollections("a") + `
+		OPTIONAL MATCH (a)-[:CONTAINS]->(s:Segment)
+		WITH a, asset_id, s
+		ORDER BY s.sequence_number
+		WITH a, asset_id,
+		     collect(s {.segment_id, .segment_type, .sequence_number, .start_time, .end_time,
+		                .confidence_score, .content_description, .detected_objects})[..$segment_limit] AS segments
+		OPTIONAL MATCH (a)-[r:SIMILAR_TO]->(b:Asset) WHERE ` + n.inTenant("b") + ` AND ` + inCollections("b") + `
+		WITH asset_id, segments, r, b
+		ORDER BY r.similarity_score DESC
+		RETURN asset_id, segments,
+		       collect(CASE WHEN b IS NULL THEN NULL ELSE {
+		           asset_id: b.asset_id, filename: b.filename,
+		           mime_type: b.mime_type, similarity_score: r.similarity_score
+		       } END)[..$related_limit] AS related
+	`
+
+	parameters := map[string]interface{}{
+		"asset_ids":      assetIDs,
+		"collection_ids": collectionIDs,
+		"segment_limit":  segmentLimit,
+		"related_limit":  relatedLimit,
+	}
+
+	resp, err := n.readCypher(query, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Results) > 0 {
+		for _, row := range resp.Results[0].Data {
+			if len(row.Row) < 3 {
+				continue
+			}
+			assetID, _ := row.Row[0].(string)
+			assetContext := AssetContext{AssetID: assetID}
+
+			segments, _ := row.Row[1].([]interface{})
+			for _, item := range segments {
+				props, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				assetContext.Segments = append(assetContext.Segments, Segment{
+					SegmentID:          stringValue(props["segment_id"]),
+					AssetID:            assetID,
+					SegmentType:        stringValue(props["segment_type"]),
+					SequenceNumber:     int(floatValue(props["sequence_number"])),
+					StartTime:          floatValue(props["start_time"]),
+					EndTime:            floatValue(props["end_time"]),
+					ConfidenceScore:    floatValue(props["confidence_score"]),
+					ContentDescription: stringValue(props["content_description"]),
+					DetectedObjects:    stringValues(props["detected_objects"]),
+				})
+			}
+
+			related, _ := row.Row[2].([]interface{})
+			for _, item := range related {
+				props, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				assetContext.Related = append(assetContext.Related, SimilarAsset{
+					AssetID:         stringValue(props["asset_id"]),
+					Filename:        stringValue(props["filename"]),
+					MimeType:        stringValue(props["mime_type"]),
+					SimilarityScore: floatValue(props["similarity_score"]),
+				})
+			}
+
+			contexts[assetID] = assetContext
+		}
+	}
+
+	return contexts, nil
+}
+
+func stringValue(value interface{}) string {
+	str, _ := value.(string)
+	return str
+}
+
+// floatValue reads a number decoded from the JSON transactional endpoint
+func floatValue(value interface{}) float64 {
+	number, _ := value.(float64)
+	return number
+}
+
+func stringValues(value interface{}) []string {
+	items, _ := value.([]interface{})
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			values = append(values, str)
+		}
+	}
+	return values
+}
+
 // GetGraphStatistics gets graph database statistics
 func (n *Neo4jClient) GetGraphStatistics() (map[string]interface{}, error) {
 	query := `
@@ -482,7 +770,7 @@ func (n *Neo4jClient) GetGraphStatistics() (map[string]interface{}, error) {
 		ORDER BY count DESC
 	`
 
-	resp, err := n.ExecuteCypher(query, nil)
+	resp, err := n.readCypher(query, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -575,7 +863,42 @@ func (m *MockNeo4jClient) FindSimilarAssets(assetID string, threshold float64, l
 	return []SimilarAsset{}, nil
 }
 
-func (m *MockNeo4jClient) GetRecommendations(assetID string, limit int) ([]Recommendation, error) {
+func (m *MockNeo4jClient) GetAssetContexts(assetIDs, collectionIDs []string, segmentLimit, relatedLimit int) (map[string]AssetContext, error) {
+	contexts := make(map[string]AssetContext, len(assetIDs))
+	for _, assetID := range assetIDs {
+		asset, ok := m.assets[assetID]
+		if !ok || (collectionIDs != nil && !containsString(collectionIDs, asset.CollectionID)) {
+			continue
+		}
+		assetContext := AssetContext{AssetID: assetID}
+		for _, segment := range m.segments {
+			if segment.AssetID == assetID && len(assetContext.Segments) < segmentLimit {
+				assetContext.Segments = append(assetContext.Segments, segment)
+			}
+		}
+		contexts[assetID] = assetContext
+	}
+	return contexts, nil
+}
+
+func (m *MockNeo4jClient) GetAssetProperties(assetID string) (map[string]interface{}, error) {
+	asset, ok := m.assets[assetID]
+	if !ok {
+		return nil, nil
+	}
+	return map[string]interface{}{
+		"entity_id":         asset.EntityID,
+		"asset_id":          asset.AssetID,
+		"filename":          asset.Filename,
+		"mime_type":         asset.MimeType,
+		"file_size":         asset.FileSize,
+		"processing_status": asset.ProcessingStatus,
+		"created_at":        asset.CreatedAt,
+		"collection_id":     asset.CollectionID,
+	}, nil
+}
+
+func (m *MockNeo4jClient) GetRecommendations(assetID string, collectionIDs []string, limit int) ([]Recommendation, error) {
 	// Mock implementation - return empty results
 	return []Recommendation{}, nil
 }
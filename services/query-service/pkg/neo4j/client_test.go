@@ -0,0 +1,124 @@
+package neo4j
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconfigureReachesTenantViews(t *testing.T) {
+	logins := map[string]string{}
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			user, password, _ := r.BasicAuth()
+			logins[name] = user + ":" + password
+			w.Write([]byte(`{"results": [{"data": []}], "errors": []}`))
+		}
+	}
+	old := httptest.NewServer(handler("old"))
+	defer old.Close()
+	rotated := httptest.NewServer(handler("rotated"))
+	defer rotated.Close()
+
+	client := NewNeo4jClient(old.URL, "neo4j", "secret")
+	view := client.ForTenant("acme")
+	_, err := view.ExecuteCypher("RETURN 1", nil)
+	require.NoError(t, err)
+
+	client.SetCredentials("neo4j", "rotated")
+	_, err = view.ExecuteCypher("RETURN 1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "neo4j:rotated", logins["old"])
+
+	client.Reconfigure(rotated.URL, "reader", "fresh")
+	_, err = view.ExecuteCypher("RETURN 1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "reader:fresh", logins["rotated"])
+	assert.Equal(t, rotated.URL, view.URL())
+}
+
+func TestCreateAssetMergesIntoTenant(t *testing.T) {
+	var request struct {
+		Statements []CypherRequest `json:"statements"`
+	}
+	response := `{"results": [{"data": [{"row": [1]}]}], "errors": []}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+	client := NewNeo4jClient(server.URL, "", "").ForTenant("acme")
+
+	require.NoError(t, client.CreateAsset(Asset{AssetID: "asset-1", Metadata: map[string]interface{}{"camera": "A7"}}))
+	statement := request.Statements[0]
+	assert.Contains(t, statement.Statement, "MERGE (a:Asset {asset_id: $asset_id})")
+	assert.Contains(t, statement.Statement, "SET a:Entity, a:`Tenant_acme`")
+	// Node properties cannot be maps
+	assert.Equal(t, `{"camera":"A7"}`, statement.Parameters["metadata"])
+
+	require.NoError(t, client.CreateAssetSegmentRelationship("asset-1", "seg-1", 1))
+	assert.Contains(t, request.Statements[0].Statement, "MERGE (a)-[r:CONTAINS]->(s)")
+	response = `{"results": [{"data": []}], "errors": []}`
+	assert.ErrorIs(t, client.CreateAssetSegmentRelationship("asset-2", "seg-1", 1), ErrNotFound)
+}
+
+func TestGetAssetContextsBatchesAssets(t *testing.T) {
+	var requests []CypherRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Statements []CypherRequest `json:"statements"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request.Statements...)
+		// asset-3 is not in the graph, so it gets no row
+		w.Write([]byte(`{"results": [{"data": [
+			{"row": ["asset-2", [], []]},
+			{"row": ["asset-1",
+				[{"segment_id": "seg-1", "segment_type": "scene", "sequence_number": 1, "start_time": 0, "end_time": 4.5, "detected_objects": ["boat"]},
+				 {"segment_id": "seg-2", "segment_type": "scene", "sequence_number": 2, "start_time": 4.5, "end_time": 9}],
+				[{"asset_id": "asset-9", "filename": "harbour.mp4", "mime_type": "video/mp4", "similarity_score": 0.8}]]}
+		]}], "errors": []}`))
+	}))
+	defer server.Close()
+	client := NewNeo4jClient(server.URL, "", "")
+
+	contexts, err := client.GetAssetContexts([]string{"asset-1", "asset-2", "asset-3"}, nil, 5, 3)
+	require.NoError(t, err)
+
+	// One statement covers every asset
+	require.Len(t, requests, 1)
+	assert.Contains(t, requests[0].Statement, "UNWIND $asset_ids AS asset_id")
+	assert.Equal(t, []interface{}{"asset-1", "asset-2", "asset-3"}, requests[0].Parameters["asset_ids"])
+
+	// Each row maps back to its own asset, whatever order they come in
+	require.Len(t, contexts, 2)
+	first := contexts["asset-1"]
+	assert.Equal(t, "asset-1", first.AssetID)
+	require.Len(t, first.Segments, 2)
+	assert.Equal(t, "seg-1", first.Segments[0].SegmentID)
+	assert.Equal(t, "asset-1", first.Segments[0].AssetID)
+	assert.Equal(t, []string{"boat"}, first.Segments[0].DetectedObjects)
+	assert.Equal(t, 9.0, first.Segments[1].EndTime)
+	require.Len(t, first.Related, 1)
+	assert.Equal(t, "asset-9", first.Related[0].AssetID)
+	assert.Equal(t, 0.8, first.Related[0].SimilarityScore)
+
+	second := contexts["asset-2"]
+	assert.Equal(t, "asset-2", second.AssetID)
+	assert.Empty(t, second.Segments)
+	assert.Empty(t, second.Related)
+
+	// An asset without a node has no context at all
+	_, ok := contexts["asset-3"]
+	assert.False(t, ok)
+
+	// Nothing to look up makes no request
+	contexts, err = client.GetAssetContexts(nil, nil, 5, 3)
+	require.NoError(t, err)
+	assert.Empty(t, contexts)
+	assert.Len(t, requests, 1)
+}
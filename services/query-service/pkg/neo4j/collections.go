@@ -0,0 +1,55 @@
+package neo4j
+
+// CollectionLink is a collection whose assets are linked to another's by
+// similarity edges
+type CollectionLink struct {
+	CollectionID string `json:"collection_id"`
+	// Edges counts the similarity edges between the two collections and
+	// Assets the distinct assets of this one they reach
+	Edges  int `json:"edges"`
+	Assets int `json:"assets"`
+	// Similarity sums the scores of the edges
+	Similarity float64 `json:"similarity"`
+}
+
+// CollectionSimilarity returns up to limit collections whose assets are
+// linked to those of collectionID by SIMILAR_TO edges, most strongly linked
+// first. Edges are counted once whichever way they point, and only edges
+// strong enough to recommend from. A non-nil collectionIDs keeps only those
+// collections.
+func (n *Neo4jClient) CollectionSimilarity(collectionID string, collectionIDs []string, limit int) ([]CollectionLink, error) {
+	query := `
+		MATCH (a1:Asset {collection_id: $collection_id})-[r:SIMILAR_TO]-(a2:Asset)
+		WHERE r.similarity_score >= 0.6
+		  AND a2.collection_id IS NOT NULL AND a2.collection_id <> $collection_id
+		  AND ` + n.inTenant("a1") + ` AND ` + n.inTenant("a2") + ` AND ` + inCollections("a2") + `
+		RETURN a2.collection_id, count(r) AS edges, count(DISTINCT a2), sum(r.similarity_score) AS similarity
+		ORDER BY similarity DESC, a2.collection_id
+		LIMIT $limit
+	`
+
+	resp, err := n.readCypher(query, map[string]interface{}{
+		"collection_id":  collectionID,
+		"collection_ids": collectionIDs,
+		"limit":          limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	links := []CollectionLink{}
+	if len(resp.Results) > 0 {
+		for _, row := range resp.Results[0].Data {
+			if len(row.Row) < 4 {
+				continue
+			}
+			links = append(links, CollectionLink{
+				CollectionID: stringValue(row.Row[0]),
+				Edges:        int(floatValue(row.Row[1])),
+				Assets:       int(floatValue(row.Row[2])),
+				Similarity:   floatValue(row.Row[3]),
+			})
+		}
+	}
+	return links, nil
+}
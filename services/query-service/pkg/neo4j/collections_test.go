@@ -0,0 +1,32 @@
+package neo4j
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectionSimilarity(t *testing.T) {
+	var request struct {
+		Statements []CypherRequest `json:"statements"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		w.Write([]byte(`{"results": [{"data": [{"row": ["harbours", 12, 5, 9.3]}, {"row": ["ships"]}]}], "errors": []}`))
+	}))
+	defer server.Close()
+
+	links, err := NewNeo4jClient(server.URL, "", "").ForTenant("acme").CollectionSimilarity("docks", []string{"harbours"}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []CollectionLink{{CollectionID: "harbours", Edges: 12, Assets: 5, Similarity: 9.3}}, links)
+
+	statement := request.Statements[0]
+	assert.Contains(t, statement.Statement, "-[r:SIMILAR_TO]-(a2:Asset)")
+	assert.Contains(t, statement.Statement, "a1:`Tenant_acme`")
+	assert.Equal(t, "docks", statement.Parameters["collection_id"])
+	assert.Equal(t, []interface{}{"harbours"}, statement.Parameters["collection_ids"])
+}
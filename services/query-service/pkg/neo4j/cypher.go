@@ -0,0 +1,201 @@
+package neo4j
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrResultTooLarge is returned when a response exceeds its size cap
+var ErrResultTooLarge = errors.New("result is too large")
+
+// ErrNotFound is returned when a node a write refers to does not exist
+var ErrNotFound = errors.New("node not found")
+
+// CypherError is an error the server reported for a statement
+type CypherError struct {
+	Code    string
+	Message string
+}
+
+func (e *CypherError) Error() string {
+	return fmt.Sprintf("cypher error: %s", e.Message)
+}
+
+// ClientError reports whether the statement itself was at fault, such as a
+// syntax error or a write refused in a read-only transaction
+func (e *CypherError) ClientError() bool {
+	return strings.HasPrefix(e.Code, "Neo.ClientError.")
+}
+
+// deniedCypherKeywords are the clauses a read-only statement may not use.
+// CALL is denied outright since procedures and subqueries can write, and USE
+// since it switches to another database, such as system.
+var deniedCypherKeywords = map[string]bool{
+	"CREATE":    true,
+	"MERGE":     true,
+	"DELETE":    true,
+	"DETACH":    true,
+	"SET":       true,
+	"REMOVE":    true,
+	"DROP":      true,
+	"FOREACH":   true,
+	"LOAD":      true,
+	"CALL":      true,
+	"USE":       true,
+	"ALTER":     true,
+	"RENAME":    true,
+	"GRANT":     true,
+	"DENY":      true,
+	"REVOKE":    true,
+	"START":     true,
+	"STOP":      true,
+	"TERMINATE": true,
+}
+
+// ReadOnlyResult is the outcome of a read-only statement
+type ReadOnlyResult struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	// Truncated is set when the statement matched more than the row cap
+	Truncated bool `json:"truncated"`
+}
+
+// PrepareReadOnly checks that a statement is a single read-only query and
+// bounds it to maxRows. The last RETURN gets a LIMIT of one row more than
+// maxRows, so a truncated result can be told apart; a LIMIT of its own must
+// be an integer literal of at most maxRows. Keywords inside strings,
+// comments and backticks are ignored, as are property names after a dot.
+func PrepareReadOnly(statement string, maxRows int) (string, error) {
+	statement = strings.TrimSpace(statement)
+	statement = strings.TrimSpace(strings.TrimSuffix(statement, ";"))
+	if statement == "" {
+		return "", fmt.Errorf("statement is empty")
+	}
+
+	words, err := cypherWords(statement)
+	if err != nil {
+		return "", err
+	}
+	lastReturn, limit := -1, -1
+	for i, word := range words {
+		switch {
+		case word.text == ";":
+			return "", fmt.Errorf("only one statement may be run at a time")
+		case word.afterDot:
+			// Property names are never clauses
+		case deniedCypherKeywords[strings.ToUpper(word.text)]:
+			return "", fmt.Errorf("%s is not allowed in a read-only statement", strings.ToUpper(word.text))
+		case strings.EqualFold(word.text, "RETURN"):
+			lastReturn, limit = i, -1
+		case strings.EqualFold(word.text, "LIMIT") && lastReturn >= 0:
+			limit = i
+		}
+	}
+	if lastReturn < 0 {
+		return "", fmt.Errorf("statement must RETURN its results")
+	}
+
+	if limit < 0 {
+		return statement + "\nLIMIT " + strconv.Itoa(maxRows+1), nil
+	}
+	if limit+1 >= len(words) {
+		return "", fmt.Errorf("LIMIT needs a value")
+	}
+	value, err := strconv.Atoi(words[limit+1].text)
+	if err != nil || limit+2 < len(words) {
+		return "", fmt.Errorf("LIMIT must end the statement with a whole number")
+	}
+	if value > maxRows {
+		return "", fmt.Errorf("LIMIT must be at most %d", maxRows)
+	}
+	return statement, nil
+}
+
+type cypherWord struct {
+	text string
+	// afterDot is set for property names, as in n.set
+	afterDot bool
+}
+
+// cypherWords splits a statement into words and semicolons, skipping string
+// literals, comments and backticked names
+func cypherWords(statement string) ([]cypherWord, error) {
+	var words []cypherWord
+	afterDot := false
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(statement) && statement[end] != c {
+				if statement[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			if end >= len(statement) {
+				return nil, fmt.Errorf("unterminated %c", c)
+			}
+			i = end + 1
+			afterDot = false
+		case strings.HasPrefix(statement[i:], "//"):
+			end := strings.IndexByte(statement[i:], '\n')
+			if end < 0 {
+				end = len(statement) - i
+			}
+			i += end
+		case strings.HasPrefix(statement[i:], "/*"):
+			end := strings.Index(statement[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case isWordByte(c):
+			end := i
+			for end < len(statement) && isWordByte(statement[end]) {
+				end++
+			}
+			words = append(words, cypherWord{text: statement[i:end], afterDot: afterDot})
+			i = end
+			afterDot = false
+		case c == ';':
+			words = append(words, cypherWord{text: ";"})
+			i++
+		default:
+			afterDot = c == '.'
+			i++
+		}
+	}
+	return words, nil
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// RunReadOnly runs a statement prepared by PrepareReadOnly in a read-only
+// transaction, so the server refuses writes the keyword check missed. It
+// returns at most maxRows rows and fails with ErrResultTooLarge when the
+// response exceeds maxBytes. The context bounds how long it runs.
+func (n *Neo4jClient) RunReadOnly(ctx context.Context, statement string, parameters map[string]interface{}, maxRows int, maxBytes int64) (*ReadOnlyResult, error) {
+	resp, err := n.execute(ctx, statement, parameters, true, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReadOnlyResult{Columns: []string{}, Rows: [][]interface{}{}}
+	if len(resp.Results) > 0 {
+		result.Columns = resp.Results[0].Columns
+		for _, data := range resp.Results[0].Data {
+			if len(result.Rows) == maxRows {
+				result.Truncated = true
+				break
+			}
+			result.Rows = append(result.Rows, data.Row)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package neo4j
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareReadOnly(t *testing.T) {
+	statement, err := PrepareReadOnly("MATCH (a:Asset) WHERE a.filename = 'CREATE.mp4' RETURN a.set, a.`delete`;", 100)
+	require.NoError(t, err)
+	assert.Equal(t, "MATCH (a:Asset) WHERE a.filename = 'CREATE.mp4' RETURN a.set, a.`delete`\nLIMIT 101", statement)
+
+	// A LIMIT before the last RETURN does not bound the result
+	statement, err = PrepareReadOnly("MATCH (a) WITH a LIMIT 5000 RETURN a // all of them", 100)
+	require.NoError(t, err)
+	assert.Equal(t, "MATCH (a) WITH a LIMIT 5000 RETURN a // all of them\nLIMIT 101", statement)
+
+	statement, err = PrepareReadOnly("MATCH (a) RETURN a ORDER BY a.created_at DESC LIMIT 10", 100)
+	require.NoError(t, err)
+	assert.Equal(t, "MATCH (a) RETURN a ORDER BY a.created_at DESC LIMIT 10", statement)
+
+	for name, statement := range map[string]string{
+		"empty":            " ; ",
+		"create":           "CREATE (a:Asset) RETURN a",
+		"detach delete":    "MATCH (a) detach delete a RETURN count(*)",
+		"set":              "MATCH (a) SET a.x = 1 RETURN a",
+		"procedure":        "CALL apoc.periodic.iterate('MATCH (a) RETURN a', 'DELETE a', {})",
+		"load csv":         "LOAD CSV FROM 'file:///x' AS row RETURN row",
+		"other database":   "USE system MATCH (u) RETURN u",
+		"two statements":   "MATCH (a) RETURN a; MATCH (a) DETACH DELETE a",
+		"no return":        "MATCH (a)",
+		"limit too high":   "MATCH (a) RETURN a LIMIT 1000",
+		"limit parameter":  "MATCH (a) RETURN a LIMIT $n",
+		"unterminated":     "MATCH (a) WHERE a.name = 'x RETURN a",
+		"comment unclosed": "MATCH (a) RETURN a /* DELETE",
+	} {
+		_, err := PrepareReadOnly(statement, 100)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRunReadOnlyUsesDatabaseEndpoint(t *testing.T) {
+	var paths, modes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		modes = append(modes, r.Header.Get("access-mode"))
+		w.Write([]byte(`{"results": [{"columns": ["n"], "data": [{"row": [1]}]}], "errors": []}`))
+	}))
+	defer server.Close()
+	client := NewNeo4jClient(server.URL, "", "")
+
+	result, err := client.RunReadOnly(context.Background(), "RETURN 1 AS n", nil, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]interface{}{{float64(1)}}, result.Rows)
+
+	client.SetDatabase("media")
+	_, err = client.ExecuteCypher("CREATE (a:Asset)", nil)
+	require.NoError(t, err)
+	client.Reconfigure(server.URL, "", "")
+	_, err = client.ForTenant("acme").ExecuteCypher("RETURN 1", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/db/neo4j/tx/commit", "/db/media/tx/commit", "/db/media/tx/commit"}, paths)
+	assert.Equal(t, []string{"READ", "", ""}, modes)
+
+	// A cancelled request is not sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.RunReadOnly(ctx, "RETURN 1", nil, 10, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, paths, 3)
+}
@@ -0,0 +1,83 @@
+package neo4j
+
+import (
+	"context"
+	"fmt"
+)
+
+// Repeated similarity computations create a new SIMILAR_TO edge each time,
+// so one pair of assets can end up with several edges of the same
+// similarity type. They are duplicates: traversals and recommendations
+// count the pair several times.
+
+// countDuplicateSimilarities counts the pairs with parallel edges and the
+// edges merging them would remove
+const countDuplicateSimilarities = `
+	MATCH (a:Asset)-[r:SIMILAR_TO]->(b:Asset)
+	WITH a, b, r.similarity_type AS type, count(r) AS edges
+	WHERE edges > 1
+	RETURN count(*) AS pairs, coalesce(sum(edges - 1), 0) AS duplicates
+`
+
+// mergeDuplicateSimilarities merges the parallel edges of up to $batch pairs
+// into the edge with the highest score, the latest of those scoring the
+// same. The kept edge records every score the pair was given in
+// score_history, which carries over the histories of earlier merges, and
+// when the pair was first and last computed.
+const mergeDuplicateSimilarities = `
+	MATCH (a:Asset)-[r:SIMILAR_TO]->(b:Asset)
+	WITH a, b, r
+	ORDER BY r.similarity_score DESC, r.created_at DESC
+	WITH a, b, r.similarity_type AS type, collect(r) AS edges
+	WHERE size(edges) > 1
+	WITH edges LIMIT $batch
+	WITH head(edges) AS kept, tail(edges) AS duplicates, edges,
+	     reduce(history = [], e IN edges | history + coalesce(e.score_history, [e.similarity_score])) AS history,
+	     reduce(first = null, e IN edges | CASE WHEN first IS NULL OR coalesce(e.first_created_at, e.created_at) < first
+	                                           THEN coalesce(e.first_created_at, e.created_at) ELSE first END) AS first,
+	     reduce(last = null, e IN edges | CASE WHEN last IS NULL OR e.created_at > last THEN e.created_at ELSE last END) AS last
+	SET kept.score_history = history,
+	    kept.first_created_at = first,
+	    kept.last_computed_at = last,
+	    kept.merged_count = coalesce(kept.merged_count, 0) + size(duplicates),
+	    kept.merged_at = datetime()
+	FOREACH (duplicate IN duplicates | DELETE duplicate)
+	RETURN count(kept) AS pairs, coalesce(sum(size(duplicates)), 0) AS pruned
+`
+
+// CountDuplicateSimilarities returns how many asset pairs have parallel
+// SIMILAR_TO edges of the same type, and how many edges merging them would
+// remove
+func (n *Neo4jClient) CountDuplicateSimilarities(ctx context.Context) (pairs, duplicates int, err error) {
+	resp, err := n.execute(ctx, countDuplicateSimilarities, nil, true, 0)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count duplicate similarities: %v", err)
+	}
+	return countPair(resp)
+}
+
+// MergeDuplicateSimilarities merges the parallel SIMILAR_TO edges of up to
+// batch asset pairs in one transaction. It returns how many pairs were
+// merged and how many edges removed; fewer pairs than batch means none are
+// left.
+func (n *Neo4jClient) MergeDuplicateSimilarities(ctx context.Context, batch int) (pairs, pruned int, err error) {
+	resp, err := n.execute(ctx, mergeDuplicateSimilarities, map[string]interface{}{"batch": batch}, false, 0)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to merge duplicate similarities: %v", err)
+	}
+	return countPair(resp)
+}
+
+// countPair reads a single row of two counts
+func countPair(resp *CypherResponse) (int, int, error) {
+	if len(resp.Results) == 0 || len(resp.Results[0].Data) == 0 || len(resp.Results[0].Data[0].Row) < 2 {
+		return 0, 0, nil
+	}
+	row := resp.Results[0].Data[0].Row
+	first, ok1 := row[0].(float64)
+	second, ok2 := row[1].(float64)
+	if !ok1 || !ok2 {
+		return 0, 0, fmt.Errorf("unexpected counts %v", row)
+	}
+	return int(first), int(second), nil
+}
@@ -0,0 +1,42 @@
+package neo4j
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeDuplicateSimilarities(t *testing.T) {
+	var request struct {
+		Statements []CypherRequest `json:"statements"`
+	}
+	var accessMode string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		accessMode = r.Header.Get("access-mode")
+		w.Write([]byte(`{"results": [{"columns": ["pairs", "pruned"], "data": [{"row": [3, 7]}]}], "errors": []}`))
+	}))
+	defer server.Close()
+	client := NewNeo4jClient(server.URL, "", "")
+
+	pairs, pruned, err := client.MergeDuplicateSimilarities(context.Background(), 500)
+	require.NoError(t, err)
+	assert.Equal(t, 3, pairs)
+	assert.Equal(t, 7, pruned)
+	assert.Empty(t, accessMode)
+	statement := request.Statements[0]
+	assert.Contains(t, statement.Statement, "ORDER BY r.similarity_score DESC")
+	assert.Contains(t, statement.Statement, "kept.score_history = history")
+	assert.Equal(t, float64(500), statement.Parameters["batch"])
+
+	pairs, duplicates, err := client.CountDuplicateSimilarities(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, pairs)
+	assert.Equal(t, 7, duplicates)
+	assert.Equal(t, "READ", accessMode)
+}
@@ -0,0 +1,146 @@
+package neo4j
+
+import (
+	"fmt"
+)
+
+// MaxExploreDepth bounds the hops Explore walks from its start
+const MaxExploreDepth = 5
+
+// ExploreNode is an asset or segment reached while exploring the graph
+type ExploreNode struct {
+	ID string `json:"id"`
+	// Kind is asset or segment
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	MimeType string `json:"mime_type,omitempty"`
+	// Depth is the number of hops from the start, which is at depth 0
+	Depth int `json:"depth"`
+}
+
+// ExploreEdge is a SIMILAR_TO or CONTAINS relationship between explored nodes
+type ExploreEdge struct {
+	Source   string  `json:"source"`
+	Target   string  `json:"target"`
+	Type     string  `json:"type"`
+	Strength float64 `json:"strength"`
+}
+
+// ExploreGraph is the neighbourhood of an asset or segment as nodes and
+// edges, the shape force-directed layouts take
+type ExploreGraph struct {
+	Nodes []ExploreNode `json:"nodes"`
+	Edges []ExploreEdge `json:"edges"`
+	// Truncated is set when a depth had more nodes than its limit
+	Truncated bool `json:"truncated"`
+}
+
+// exploreNode reads the id, kind, name and MIME type of node
+func exploreNode(node string) string {
+	return fmt.Sprintf(`coalesce(%[1]s.asset_id, %[1]s.segment_id),
+		       CASE WHEN %[1]s:Asset THEN 'asset' ELSE 'segment' END,
+		       coalesce(%[1]s.filename, %[1]s.content_description, ''),
+		       coalesce(%[1]s.mime_type, '')`, node)
+}
+
+// Explore walks SIMILAR_TO and CONTAINS relationships breadth first from an
+// asset or segment, up to depth hops. Each depth adds at most perDepth
+// nodes, the most strongly linked first. A node is only reached once, so
+// cycles end the walk instead of repeating it. A non-nil collectionIDs hides
+// assets and segments outside those collections. The graph is nil when the
+// start is not found.
+func (n *Neo4jClient) Explore(entityID string, collectionIDs []string, depth, perDepth int) (*ExploreGraph, error) {
+	if depth < 1 {
+		depth = 1
+	}
+	if depth > MaxExploreDepth {
+		depth = MaxExploreDepth
+	}
+
+	resp, err := n.readCypher(`
+		MATCH (e)
+		WHERE (e:Asset OR e:Segment)
+		  AND (e.entity_id = $id OR e.asset_id = $id OR e.segment_id = $id)
+		  AND `+n.inTenant("e")+` AND `+inCollections("e")+`
+		RETURN `+exploreNode("e")+`
+		LIMIT 1
+	`, map[string]interface{}{"id": entityID, "collection_ids": collectionIDs})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Results) == 0 || len(resp.Results[0].Data) == 0 || len(resp.Results[0].Data[0].Row) < 4 {
+		return nil, nil
+	}
+	row := resp.Results[0].Data[0].Row
+	start := ExploreNode{ID: stringValue(row[0]), Kind: stringValue(row[1]), Name: stringValue(row[2]), MimeType: stringValue(row[3])}
+
+	graph := &ExploreGraph{Nodes: []ExploreNode{start}, Edges: []ExploreEdge{}}
+	visited := []string{start.ID}
+	frontier := []string{start.ID}
+	for level := 1; level <= depth && len(frontier) > 0; level++ {
+		// Nodes already visited are left out, which ends cycles; each new
+		// node brings its edges to the frontier, strongest first
+		resp, err := n.readCypher(`
+			MATCH (f)
+			WHERE (f:Asset OR f:Segment) AND coalesce(f.asset_id, f.segment_id) IN $frontier
+			  AND `+n.inTenant("f")+`
+			MATCH (f)-[r:SIMILAR_TO|CONTAINS]-(m)
+			WHERE (m:Asset OR m:Segment) AND NOT coalesce(m.asset_id, m.segment_id) IN $visited
+			  AND `+n.inTenant("m")+` AND `+inCollections("m")+`
+			WITH m, collect([coalesce(startNode(r).asset_id, startNode(r).segment_id),
+			                 coalesce(endNode(r).asset_id, endNode(r).segment_id),
+			                 toLower(type(r)),
+			                 toFloat(coalesce(r.similarity_score, r.strength, 1.0))]) AS links
+			WITH m, links, reduce(best = 0.0, link IN links | CASE WHEN link[3] > best THEN link[3] ELSE best END) AS strength
+			RETURN `+exploreNode("m")+`, links
+			ORDER BY strength DESC
+			LIMIT $limit
+		`, map[string]interface{}{
+			"frontier":       frontier,
+			"visited":        visited,
+			"collection_ids": collectionIDs,
+			"limit":          perDepth + 1,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		frontier = nil
+		if len(resp.Results) == 0 {
+			break
+		}
+		for _, row := range resp.Results[0].Data {
+			if len(row.Row) < 5 {
+				continue
+			}
+			if len(frontier) == perDepth {
+				graph.Truncated = true
+				break
+			}
+			node := ExploreNode{
+				ID:       stringValue(row.Row[0]),
+				Kind:     stringValue(row.Row[1]),
+				Name:     stringValue(row.Row[2]),
+				MimeType: stringValue(row.Row[3]),
+				Depth:    level,
+			}
+			graph.Nodes = append(graph.Nodes, node)
+			frontier = append(frontier, node.ID)
+			links, _ := row.Row[4].([]interface{})
+			for _, link := range links {
+				fields, _ := link.([]interface{})
+				if len(fields) < 4 {
+					continue
+				}
+				graph.Edges = append(graph.Edges, ExploreEdge{
+					Source:   stringValue(fields[0]),
+					Target:   stringValue(fields[1]),
+					Type:     stringValue(fields[2]),
+					Strength: floatValue(fields[3]),
+				})
+			}
+		}
+		visited = append(visited, frontier...)
+	}
+	return graph, nil
+}
@@ -0,0 +1,121 @@
+package neo4j
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxPathHops bounds the length of a shortest path
+const MaxPathHops = 10
+
+// GraphPath is a chain of relationships between two assets or segments,
+// with Nodes in order from the start and Edges between consecutive nodes.
+// An edge runs from the node nearer the start, whichever way the
+// relationship points. Nodes between the ends may be other entities, of
+// kind entity.
+type GraphPath struct {
+	Nodes []ExploreNode `json:"nodes"`
+	Edges []ExploreEdge `json:"edges"`
+	// Length is the number of relationships along the path
+	Length int `json:"length"`
+	// Strength sums the strengths of the relationships along the path
+	Strength float64 `json:"strength"`
+}
+
+// pathNode reads the id, kind, name and MIME type of a node along a path
+func pathNode(node string) string {
+	return fmt.Sprintf(`coalesce(%[1]s.asset_id, %[1]s.segment_id, %[1]s.entity_id),
+		       CASE WHEN %[1]s:Asset THEN 'asset' WHEN %[1]s:Segment THEN 'segment' ELSE 'entity' END,
+		       coalesce(%[1]s.filename, %[1]s.content_description, %[1]s.name, ''),
+		       coalesce(%[1]s.mime_type, '')`, node)
+}
+
+// ValidPathTypes reports whether a shortest path may follow the
+// relationship types
+func ValidPathTypes(relTypes []string) bool {
+	for _, relType := range relTypes {
+		if !containsString(queryRelationships, relType) {
+			return false
+		}
+	}
+	return true
+}
+
+// ShortestPath finds a shortest path of at most maxHops relationships of the
+// given types, in either direction, between two assets or segments. Every
+// node along it is in the client's tenant, in collectionIDs when non-nil,
+// and not in excludeIDs. The path is nil when there is none.
+func (n *Neo4jClient) ShortestPath(fromID, toID string, relTypes, collectionIDs, excludeIDs []string, maxHops int) (*GraphPath, error) {
+	if len(relTypes) == 0 {
+		relTypes = queryRelationships
+	}
+	if !ValidPathTypes(relTypes) {
+		return nil, fmt.Errorf("relationship types must be among %s", strings.Join(queryRelationships, ", "))
+	}
+	if maxHops < 1 || maxHops > MaxPathHops {
+		maxHops = MaxPathHops
+	}
+
+	resp, err := n.readCypher(`
+		MATCH (a)
+		WHERE (a:Asset OR a:Segment) AND (a.asset_id = $from OR a.segment_id = $from)
+		  AND `+n.inTenant("a")+` AND `+inCollections("a")+`
+		MATCH (b)
+		WHERE (b:Asset OR b:Segment) AND (b.asset_id = $to OR b.segment_id = $to)
+		  AND `+n.inTenant("b")+` AND `+inCollections("b")+`
+		MATCH p = shortestPath((a)-[:`+strings.Join(relTypes, "|")+fmt.Sprintf("*..%d", maxHops)+`]-(b))
+		WHERE all(_n IN nodes(p) WHERE `+n.inTenant("_n")+` AND `+inCollections("_n")+`
+		          AND NOT coalesce(_n.asset_id, _n.segment_id, '') IN $exclude)
+		RETURN [_n IN nodes(p) | [`+pathNode("_n")+`]],
+		       [_r IN relationships(p) | [toLower(type(_r)), toFloat(coalesce(_r.similarity_score, _r.strength, 1.0))]]
+		LIMIT 1
+	`, map[string]interface{}{
+		"from":           fromID,
+		"to":             toID,
+		"collection_ids": collectionIDs,
+		"exclude":        append([]string{}, excludeIDs...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Results) == 0 || len(resp.Results[0].Data) == 0 || len(resp.Results[0].Data[0].Row) < 2 {
+		return nil, nil
+	}
+
+	row := resp.Results[0].Data[0].Row
+	path := &GraphPath{Nodes: []ExploreNode{}, Edges: []ExploreEdge{}}
+	nodes, _ := row[0].([]interface{})
+	for depth, node := range nodes {
+		fields, _ := node.([]interface{})
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("unexpected path node %v", node)
+		}
+		path.Nodes = append(path.Nodes, ExploreNode{
+			ID:       stringValue(fields[0]),
+			Kind:     stringValue(fields[1]),
+			Name:     stringValue(fields[2]),
+			MimeType: stringValue(fields[3]),
+			Depth:    depth,
+		})
+	}
+	relationships, _ := row[1].([]interface{})
+	if len(relationships) != len(path.Nodes)-1 {
+		return nil, fmt.Errorf("path has %d nodes but %d relationships", len(path.Nodes), len(relationships))
+	}
+	for i, relationship := range relationships {
+		fields, _ := relationship.([]interface{})
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("unexpected path relationship %v", relationship)
+		}
+		edge := ExploreEdge{
+			Source:   path.Nodes[i].ID,
+			Target:   path.Nodes[i+1].ID,
+			Type:     stringValue(fields[0]),
+			Strength: floatValue(fields[1]),
+		}
+		path.Edges = append(path.Edges, edge)
+		path.Strength += edge.Strength
+	}
+	path.Length = len(path.Edges)
+	return path, nil
+}
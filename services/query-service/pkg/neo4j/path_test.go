@@ -0,0 +1,41 @@
+package neo4j
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortestPath(t *testing.T) {
+	var request struct {
+		Statements []CypherRequest `json:"statements"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		w.Write([]byte(`{"results": [{"columns": ["nodes", "relationships"], "data": [{"row": [
+			[["asset-1", "asset", "a.mp4", "video/mp4"], ["person-1", "entity", "Ada", ""], ["asset-2", "asset", "b.mp4", "video/mp4"]],
+			[["related_to", 0.5], ["related_to", 0.75]]
+		]}]}], "errors": []}`))
+	}))
+	defer server.Close()
+
+	path, err := NewNeo4jClient(server.URL, "", "").ShortestPath("asset-1", "asset-2", []string{"RELATED_TO"}, nil, []string{"asset-3"}, 4)
+	require.NoError(t, err)
+	require.NotNil(t, path)
+	assert.Equal(t, 2, path.Length)
+	assert.Equal(t, 1.25, path.Strength)
+	assert.Equal(t, "person-1", path.Nodes[1].ID)
+	assert.Equal(t, 2, path.Nodes[2].Depth)
+	assert.Equal(t, ExploreEdge{Source: "person-1", Target: "asset-2", Type: "related_to", Strength: 0.75}, path.Edges[1])
+
+	statement := request.Statements[0]
+	assert.Contains(t, statement.Statement, "shortestPath((a)-[:RELATED_TO*..4]-(b))")
+	assert.Equal(t, []interface{}{"asset-3"}, statement.Parameters["exclude"])
+
+	_, err = NewNeo4jClient(server.URL, "", "").ShortestPath("asset-1", "asset-2", []string{"KNOWS"}, nil, nil, 4)
+	assert.Error(t, err)
+}
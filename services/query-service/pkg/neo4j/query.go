@@ -0,0 +1,324 @@
+package neo4j
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Bounds of a graph query
+const (
+	MaxQueryNodes = 5
+	MaxQueryPaths = 4
+	MaxQueryLimit = 500
+)
+
+// queryLabels and queryRelationships are the node labels and relationship
+// types a graph query may name
+var (
+	queryLabels        = []string{"Asset", "Segment", "Entity"}
+	queryRelationships = []string{"SIMILAR_TO", "RELATED_TO", "CONTAINS"}
+)
+
+var (
+	queryVariablePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,15}$`)
+	queryPropertyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+)
+
+// queryOperators maps predicate operators to Cypher, with %[1]s the
+// property and %[2]s the parameter
+var queryOperators = map[string]string{
+	"eq":          "%[1]s = %[2]s",
+	"ne":          "%[1]s <> %[2]s",
+	"gt":          "%[1]s > %[2]s",
+	"gte":         "%[1]s >= %[2]s",
+	"lt":          "%[1]s < %[2]s",
+	"lte":         "%[1]s <= %[2]s",
+	"in":          "%[1]s IN %[2]s",
+	"has":         "%[2]s IN %[1]s",
+	"contains":    "toString(%[1]s) CONTAINS %[2]s",
+	"starts_with": "toString(%[1]s) STARTS WITH %[2]s",
+	"exists":      "(%[1]s IS NOT NULL) = %[2]s",
+}
+
+// GraphQuery describes nodes and the paths between them, like a Cypher
+// MATCH, without letting callers write Cypher. Labels and relationship
+// types come from a fixed set, property names are plain identifiers and
+// every value is sent as a parameter.
+type GraphQuery struct {
+	Nodes []NodePattern `json:"nodes"`
+	Paths []PathPattern `json:"paths"`
+	// Return lists the nodes returned; empty returns all of them
+	Return []string `json:"return"`
+	Limit  int      `json:"limit"`
+}
+
+// NodePattern is a node the query binds to a variable
+type NodePattern struct {
+	Var   string      `json:"var"`
+	Label string      `json:"label"`
+	Where []Predicate `json:"where"`
+}
+
+// PathPattern links two nodes by a chain of MinHops to MaxHops
+// relationships of the given types; no types allows all of them.
+// Direction is out (the default), in or both.
+type PathPattern struct {
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	Types     []string `json:"types"`
+	MinHops   int      `json:"min_hops"`
+	MaxHops   int      `json:"max_hops"`
+	Direction string   `json:"direction"`
+}
+
+// Predicate compares a node property: eq, ne, gt, gte, lt, lte, in (value
+// is a list), has (a list property holds the value), contains (a substring),
+// starts_with or exists (value is true or false)
+type Predicate struct {
+	Property string      `json:"property"`
+	Op       string      `json:"op"`
+	Value    interface{} `json:"value"`
+}
+
+// QueryRow holds the properties of each returned node by variable
+type QueryRow map[string]map[string]interface{}
+
+// Validate checks the query against the DSL's bounds and vocabulary. Nodes
+// must all be joined by paths, so a query never matches a cross product.
+func (q GraphQuery) Validate() error {
+	if len(q.Nodes) == 0 || len(q.Nodes) > MaxQueryNodes {
+		return fmt.Errorf("a query has between 1 and %d nodes", MaxQueryNodes)
+	}
+	if len(q.Paths) > MaxQueryPaths {
+		return fmt.Errorf("a query has at most %d paths", MaxQueryPaths)
+	}
+	if q.Limit < 0 || q.Limit > MaxQueryLimit {
+		return fmt.Errorf("limit must be at most %d", MaxQueryLimit)
+	}
+
+	nodes := map[string]bool{}
+	for _, node := range q.Nodes {
+		if !queryVariablePattern.MatchString(node.Var) {
+			return fmt.Errorf("invalid variable %q: use up to 16 lower-case letters, digits and underscores", node.Var)
+		}
+		if nodes[node.Var] {
+			return fmt.Errorf("variable %s is declared twice", node.Var)
+		}
+		nodes[node.Var] = true
+		if node.Label != "" && !containsString(queryLabels, node.Label) {
+			return fmt.Errorf("label of %s must be one of %s", node.Var, strings.Join(queryLabels, ", "))
+		}
+		for _, predicate := range node.Where {
+			if !queryPropertyPattern.MatchString(predicate.Property) {
+				return fmt.Errorf("invalid property %q of %s", predicate.Property, node.Var)
+			}
+			if _, ok := queryOperators[predicate.Op]; !ok {
+				return fmt.Errorf("unsupported operator %q on %s.%s", predicate.Op, node.Var, predicate.Property)
+			}
+			if err := validateValue(predicate); err != nil {
+				return fmt.Errorf("%s.%s: %v", node.Var, predicate.Property, err)
+			}
+		}
+	}
+
+	// Union-find over the paths tells whether every node is joined
+	group := map[string]string{}
+	var find func(string) string
+	find = func(v string) string {
+		if group[v] == "" || group[v] == v {
+			return v
+		}
+		return find(group[v])
+	}
+	for i, path := range q.Paths {
+		if !nodes[path.From] || !nodes[path.To] {
+			return fmt.Errorf("path %d joins undeclared nodes", i+1)
+		}
+		if path.From == path.To {
+			return fmt.Errorf("path %d joins %s to itself", i+1, path.From)
+		}
+		for _, relType := range path.Types {
+			if !containsString(queryRelationships, relType) {
+				return fmt.Errorf("relationship types must be among %s", strings.Join(queryRelationships, ", "))
+			}
+		}
+		minHops, maxHops := path.hops()
+		if minHops < 1 || maxHops < minHops || maxHops > MaxTraversalHops {
+			return fmt.Errorf("path %d must span between 1 and %d hops", i+1, MaxTraversalHops)
+		}
+		switch path.Direction {
+		case "", "out", "in", "both":
+		default:
+			return fmt.Errorf("direction of path %d must be out, in or both", i+1)
+		}
+		group[find(path.From)] = find(path.To)
+	}
+	root := find(q.Nodes[0].Var)
+	for _, node := range q.Nodes[1:] {
+		if find(node.Var) != root {
+			return fmt.Errorf("node %s is not joined to the others by a path", node.Var)
+		}
+	}
+
+	for _, name := range q.Return {
+		if !nodes[name] {
+			return fmt.Errorf("cannot return undeclared node %s", name)
+		}
+	}
+	return nil
+}
+
+// hops returns the hop bounds, one hop when neither is given
+func (p PathPattern) hops() (int, int) {
+	minHops, maxHops := p.MinHops, p.MaxHops
+	if minHops == 0 {
+		minHops = 1
+	}
+	if maxHops == 0 {
+		maxHops = minHops
+	}
+	return minHops, maxHops
+}
+
+// validateValue checks that a predicate's value fits its operator
+func validateValue(predicate Predicate) error {
+	switch value := predicate.Value.(type) {
+	case nil:
+		return fmt.Errorf("%s needs a value", predicate.Op)
+	case []interface{}:
+		if predicate.Op != "in" {
+			return fmt.Errorf("only in takes a list")
+		}
+		for _, item := range value {
+			switch item.(type) {
+			case string, float64, bool:
+			default:
+				return fmt.Errorf("list values must be strings, numbers or booleans")
+			}
+		}
+	case bool:
+		if predicate.Op != "exists" && predicate.Op != "eq" && predicate.Op != "ne" {
+			return fmt.Errorf("%s does not take a boolean", predicate.Op)
+		}
+	case string, float64:
+		if predicate.Op == "in" {
+			return fmt.Errorf("in takes a list")
+		}
+		if predicate.Op == "exists" {
+			return fmt.Errorf("exists takes true or false")
+		}
+	default:
+		return fmt.Errorf("values must be strings, numbers, booleans or lists")
+	}
+	return nil
+}
+
+// compileQuery turns a validated query into parameterized Cypher confined to
+// the client's tenant and, for a non-nil collectionIDs, to those collections.
+// Nodes along variable-length paths are confined as well, so a path cannot
+// cross into another tenant's graph. Names the compiler adds start with an
+// underscore, which query variables cannot.
+func (n *Neo4jClient) compileQuery(q GraphQuery, collectionIDs []string) (string, map[string]interface{}) {
+	parameters := map[string]interface{}{"collection_ids": collectionIDs}
+	labels := map[string]string{}
+	for _, node := range q.Nodes {
+		if node.Label != "" {
+			labels[node.Var] = ":" + node.Label
+		}
+	}
+	// A node's label is written where it first appears
+	pattern := func(name string) string {
+		label := labels[name]
+		delete(labels, name)
+		return "(" + name + label + ")"
+	}
+
+	var statement strings.Builder
+	var conditions []string
+	for i, path := range q.Paths {
+		minHops, maxHops := path.hops()
+		relationship := fmt.Sprintf("[:%s*%d..%d]", strings.Join(path.Types, "|"), minHops, maxHops)
+		if len(path.Types) == 0 {
+			relationship = fmt.Sprintf("[:%s*%d..%d]", strings.Join(queryRelationships, "|"), minHops, maxHops)
+		}
+		from := pattern(path.From)
+		to := pattern(path.To)
+		switch path.Direction {
+		case "in":
+			relationship = "<-" + relationship + "-"
+		case "both":
+			relationship = "-" + relationship + "-"
+		default:
+			relationship = "-" + relationship + "->"
+		}
+		fmt.Fprintf(&statement, "MATCH _p%d = %s%s%s\n", i, from, relationship, to)
+		conditions = append(conditions, fmt.Sprintf("all(_n IN nodes(_p%d) WHERE %s AND %s)", i, n.inTenant("_n"), inCollections("_n")))
+	}
+	for _, node := range q.Nodes {
+		if !containsPath(q.Paths, node.Var) {
+			fmt.Fprintf(&statement, "MATCH %s\n", pattern(node.Var))
+		}
+		conditions = append(conditions, n.inTenant(node.Var), inCollections(node.Var))
+		for _, predicate := range node.Where {
+			parameter := fmt.Sprintf("_v%d", len(parameters)-1)
+			parameters[parameter] = predicate.Value
+			property := fmt.Sprintf("%s.`%s`", node.Var, predicate.Property)
+			conditions = append(conditions, fmt.Sprintf(queryOperators[predicate.Op], property, "$"+parameter))
+		}
+	}
+	fmt.Fprintf(&statement, "WHERE %s\n", strings.Join(conditions, "\n  AND "))
+
+	returned := q.Return
+	if len(returned) == 0 {
+		for _, node := range q.Nodes {
+			returned = append(returned, node.Var)
+		}
+	}
+	columns := make([]string, len(returned))
+	for i, name := range returned {
+		columns[i] = fmt.Sprintf("properties(%[1]s) AS %[1]s", name)
+	}
+	limit := q.Limit
+	if limit == 0 {
+		limit = 50
+	}
+	parameters["limit"] = limit
+	fmt.Fprintf(&statement, "RETURN DISTINCT %s\nLIMIT $limit", strings.Join(columns, ", "))
+	return statement.String(), parameters
+}
+
+func containsPath(paths []PathPattern, name string) bool {
+	for _, path := range paths {
+		if path.From == name || path.To == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RunQuery runs a validated graph query and returns the properties of the
+// returned nodes, one row per match
+func (n *Neo4jClient) RunQuery(q GraphQuery, collectionIDs []string) ([]QueryRow, error) {
+	statement, parameters := n.compileQuery(q, collectionIDs)
+	resp, err := n.readCypher(statement, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []QueryRow{}
+	if len(resp.Results) > 0 {
+		columns := resp.Results[0].Columns
+		for _, data := range resp.Results[0].Data {
+			row := QueryRow{}
+			for i, column := range columns {
+				if i < len(data.Row) {
+					properties, _ := data.Row[i].(map[string]interface{})
+					row[column] = properties
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,57 @@
+package neo4j
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileQuery(t *testing.T) {
+	query := GraphQuery{
+		Nodes: []NodePattern{
+			{Var: "a", Label: "Asset", Where: []Predicate{{Property: "mime_type", Op: "starts_with", Value: "video/"}}},
+			{Var: "s", Label: "Segment", Where: []Predicate{{Property: "detected_objects", Op: "has", Value: "boat"}}},
+		},
+		Paths:  []PathPattern{{From: "a", To: "s", Types: []string{"CONTAINS"}}},
+		Return: []string{"s"},
+	}
+	require.NoError(t, query.Validate())
+
+	statement, parameters := NewNeo4jClient("", "", "").ForTenant("acme").compileQuery(query, []string{"c1"})
+	assert.Contains(t, statement, "MATCH _p0 = (a:Asset)-[:CONTAINS*1..1]->(s:Segment)\n")
+	assert.Contains(t, statement, "all(_n IN nodes(_p0) WHERE _n:`Tenant_acme`")
+	assert.Contains(t, statement, "toString(a.`mime_type`) STARTS WITH $_v0")
+	assert.Contains(t, statement, "$_v1 IN s.`detected_objects`")
+	assert.True(t, strings.HasSuffix(statement, "RETURN DISTINCT properties(s) AS s\nLIMIT $limit"))
+	assert.Equal(t, "video/", parameters["_v0"])
+	assert.Equal(t, "boat", parameters["_v1"])
+	assert.Equal(t, []string{"c1"}, parameters["collection_ids"])
+	assert.Equal(t, 50, parameters["limit"])
+}
+
+func TestValidateQuery(t *testing.T) {
+	node := func(name string) NodePattern { return NodePattern{Var: name, Label: "Asset"} }
+	for name, query := range map[string]GraphQuery{
+		"no nodes":          {},
+		"unknown label":     {Nodes: []NodePattern{{Var: "a", Label: "User"}}},
+		"injected variable": {Nodes: []NodePattern{{Var: "a) DETACH DELETE (a"}}},
+		"injected property": {Nodes: []NodePattern{{Var: "a", Where: []Predicate{{Property: "x` = 1 OR true //", Op: "eq", Value: "y"}}}}},
+		"unknown operator":  {Nodes: []NodePattern{{Var: "a", Where: []Predicate{{Property: "x", Op: "regex", Value: ".*"}}}}},
+		"list for eq":       {Nodes: []NodePattern{{Var: "a", Where: []Predicate{{Property: "x", Op: "eq", Value: []interface{}{"y"}}}}}},
+		"cross product":     {Nodes: []NodePattern{node("a"), node("b")}},
+		"unknown type":      {Nodes: []NodePattern{node("a"), node("b")}, Paths: []PathPattern{{From: "a", To: "b", Types: []string{"OWNS"}}}},
+		"too many hops":     {Nodes: []NodePattern{node("a"), node("b")}, Paths: []PathPattern{{From: "a", To: "b", MaxHops: 10}}},
+		"undeclared return": {Nodes: []NodePattern{node("a")}, Return: []string{"b"}},
+		"limit":             {Nodes: []NodePattern{node("a")}, Limit: MaxQueryLimit + 1},
+	} {
+		assert.Error(t, query.Validate(), name)
+	}
+
+	joined := GraphQuery{
+		Nodes: []NodePattern{node("a"), node("b"), node("c")},
+		Paths: []PathPattern{{From: "a", To: "b", MaxHops: 2}, {From: "c", To: "b", Direction: "both"}},
+	}
+	assert.NoError(t, joined.Validate())
+}
@@ -0,0 +1,284 @@
+package neo4j
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MaxTraversalHops bounds variable-length traversals
+const MaxTraversalHops = 3
+
+// traversableTypes maps relationship intents to asset-to-asset relationship types
+var traversableTypes = map[string]string{
+	"similar_to": "SIMILAR_TO",
+	"related_to": "RELATED_TO",
+}
+
+// SeedAsset is an asset whose own properties or segments match the query keywords
+type SeedAsset struct {
+	AssetID    string   `json:"asset_id"`
+	Filename   string   `json:"filename"`
+	MimeType   string   `json:"mime_type"`
+	Score      float64  `json:"score"`
+	SegmentIDs []string `json:"segment_ids,omitempty"`
+}
+
+// GraphHit is an asset reached by traversing relationships from seed assets
+type GraphHit struct {
+	AssetID  string   `json:"asset_id"`
+	Filename string   `json:"filename"`
+	MimeType string   `json:"mime_type"`
+	Score    float64  `json:"score"`
+	Hops     int      `json:"hops"`
+	Via      []string `json:"via"`
+	SeedIDs  []string `json:"seed_ids"`
+}
+
+// Relationship is a live edge of an entity in the graph
+type Relationship struct {
+	SourceID   string                 `json:"source_id"`
+	TargetID   string                 `json:"target_id"`
+	Type       string                 `json:"type"`
+	Strength   float64                `json:"strength"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// TraversalTypes returns the graph relationship types for the given intents,
+// defaulting to all asset-to-asset types
+func TraversalTypes(intents []string) []string {
+	var types []string
+	for _, intent := range intents {
+		if relType, ok := traversableTypes[intent]; ok {
+			types = append(types, relType)
+		}
+	}
+	if len(types) == 0 && !containsString(intents, "contains") {
+		types = []string{"SIMILAR_TO", "RELATED_TO"}
+	}
+	return types
+}
+
+// inCollections is a Cypher predicate on node that holds when
+// $collection_ids is null or the node is an asset in one of the collections,
+// or a segment of such an asset. Other nodes, such as detected people, belong
+// to no collection and always pass.
+func inCollections(node string) string {
+	return fmt.Sprintf(`($collection_ids IS NULL
+		   OR NOT (%[1]s:Asset OR %[1]s:Segment)
+		   OR %[1]s.collection_id IN $collection_ids
+		   OR any(c IN [(owner:Asset)-[:CONTAINS]->(%[1]s) | owner.collection_id] WHERE c IN $collection_ids))`, node)
+}
+
+// ForTenant returns a client whose lookups only reach nodes labelled
+// Tenant_<tenant>
+func (n *Neo4jClient) ForTenant(tenant string) *Neo4jClient {
+	scoped := *n
+	scoped.tenant = tenant
+	return &scoped
+}
+
+// inTenant is a Cypher predicate on node that holds when the client is not
+// confined to a tenant or the node carries the tenant's label. Labels cannot
+// be parameters, so the tenant is quoted into the query.
+func (n *Neo4jClient) inTenant(node string) string {
+	if n.tenant == "" {
+		return "true"
+	}
+	return fmt.Sprintf("%s:`Tenant_%s`", node, strings.ReplaceAll(n.tenant, "`", "``"))
+}
+
+// tenantLabel is a SET item giving node the tenant's label, empty when the
+// client is not confined to a tenant
+func (n *Neo4jClient) tenantLabel(node string) string {
+	if n.tenant == "" {
+		return ""
+	}
+	return fmt.Sprintf(", %s:`Tenant_%s`", node, strings.ReplaceAll(n.tenant, "`", "``"))
+}
+
+// FindSeedAssets finds assets whose filename or tags, or whose segments'
+// detected objects and descriptions, match any of the keywords. A non-nil
+// collectionIDs keeps only assets in those collections.
+func (n *Neo4jClient) FindSeedAssets(ctx context.Context, keywords, collectionIDs []string, limit int) ([]SeedAsset, error) {
+	if len(keywords) == 0 {
+		return []SeedAsset{}, nil
+	}
+
+	lowered := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		lowered[i] = strings.ToLower(keyword)
+	}
+
+	query := `
+		MATCH (a:Asset) WHERE ` + n.inTenant("a") + ` AND ` + inCollections("a") + `
+		OPTIONAL MATCH (a)-[:CONTAINS]->(s:Segment)
+		WITH a, collect(s) AS segments,
+		     [k IN $keywords WHERE toLower(coalesce(a.filename, '')) CONTAINS k
+		                        OR k IN [t IN coalesce(a.tags, []) | toLower(t)]] AS asset_hits
+		WITH a, asset_hits,
+		     [s IN segments WHERE any(k IN $keywords
+		         WHERE k IN [o IN coalesce(s.detected_objects, []) | toLower(o)]
+		            OR toLower(coalesce(s.content_description, '')) CONTAINS k)] AS matched_segments
+		WHERE size(asset_hits) > 0 OR size(matched_segments) > 0
+		WITH a, matched_segments,
+		     toFloat(size(asset_hits) + CASE WHEN size(matched_segments) > 0 THEN 1 ELSE 0 END)
+		       / (size($keywords) + 1) AS score
+		RETURN a.asset_id, a.filename, a.mime_type, score,
+		       [s IN matched_segments | s.segment_id][..5]
+		ORDER BY score DESC
+		LIMIT $limit
+	`
+
+	resp, err := n.readCypherContext(ctx, query, map[string]interface{}{
+		"keywords":       lowered,
+		"collection_ids": collectionIDs,
+		"limit":          limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seeds := []SeedAsset{}
+	if len(resp.Results) > 0 {
+		for _, row := range resp.Results[0].Data {
+			if len(row.Row) < 5 {
+				continue
+			}
+			seeds = append(seeds, SeedAsset{
+				AssetID:    stringValue(row.Row[0]),
+				Filename:   stringValue(row.Row[1]),
+				MimeType:   stringValue(row.Row[2]),
+				Score:      floatValue(row.Row[3]),
+				SegmentIDs: stringValues(row.Row[4]),
+			})
+		}
+	}
+
+	return seeds, nil
+}
+
+// TraverseFromSeeds walks up to hops relationships of the given types from the
+// seed assets. A hit's score is the product of the edge strengths along its
+// strongest path. A non-nil collectionIDs keeps only hits in those collections.
+func (n *Neo4jClient) TraverseFromSeeds(ctx context.Context, seedIDs, relTypes, collectionIDs []string, hops, limit int) ([]GraphHit, error) {
+	if len(seedIDs) == 0 || len(relTypes) == 0 {
+		return []GraphHit{}, nil
+	}
+	if hops < 1 {
+		hops = 1
+	}
+	if hops > MaxTraversalHops {
+		hops = MaxTraversalHops
+	}
+	for _, relType := range relTypes {
+		if !containsString([]string{"SIMILAR_TO", "RELATED_TO"}, relType) {
+			return nil, fmt.Errorf("unsupported relationship type: %s", relType)
+		}
+	}
+
+	// Relationship types and hop bounds cannot be parameters; both are validated above
+	query := fmt.Sprintf(`
+		MATCH (seed:Asset) WHERE seed.asset_id IN $seed_ids AND %[3]s
+		MATCH path = (seed)-[:%[1]s*1..%[2]d]-(target:Asset)
+		WHERE NOT target.asset_id IN $seed_ids AND %[4]s AND %[5]s
+		WITH seed, target, length(path) AS hops,
+		     reduce(s = 1.0, r IN relationships(path) | s * coalesce(r.similarity_score, r.strength, 0.5)) AS strength,
+		     [r IN relationships(path) | toLower(type(r))] AS via
+		ORDER BY strength DESC
+		WITH target, max(strength) AS score, min(hops) AS hops,
+		     collect(DISTINCT seed.asset_id)[..5] AS seeds, head(collect(via)) AS via
+		RETURN target.asset_id, target.filename, target.mime_type, score, hops, via, seeds
+		ORDER BY score DESC
+		LIMIT $limit
+	`, strings.Join(relTypes, "|"), hops, n.inTenant("seed"), n.inTenant("target"), inCollections("target"))
+
+	resp, err := n.readCypherContext(ctx, query, map[string]interface{}{
+		"seed_ids":       seedIDs,
+		"collection_ids": collectionIDs,
+		"limit":          limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hits := []GraphHit{}
+	if len(resp.Results) > 0 {
+		for _, row := range resp.Results[0].Data {
+			if len(row.Row) < 7 {
+				continue
+			}
+			hits = append(hits, GraphHit{
+				AssetID:  stringValue(row.Row[0]),
+				Filename: stringValue(row.Row[1]),
+				MimeType: stringValue(row.Row[2]),
+				Score:    floatValue(row.Row[3]),
+				Hops:     int(floatValue(row.Row[4])),
+				Via:      stringValues(row.Row[5]),
+				SeedIDs:  stringValues(row.Row[6]),
+			})
+		}
+	}
+
+	return hits, nil
+}
+
+// GetRelationships returns the edges of an asset, segment or entity, strongest
+// first. A non-nil collectionIDs hides assets and segments outside those
+// collections, both as the entity asked for and at the other end of an edge.
+func (n *Neo4jClient) GetRelationships(ctx context.Context, entityID string, collectionIDs []string, limit int) ([]Relationship, error) {
+	query := `
+		MATCH (e)
+		WHERE (e:Asset OR e:Segment OR e:Entity)
+		  AND (e.entity_id = $id OR e.asset_id = $id OR e.segment_id = $id)
+		  AND ` + n.inTenant("e") + ` AND ` + inCollections("e") + `
+		MATCH (e)-[r]-(other)
+		WHERE ` + n.inTenant("other") + ` AND ` + inCollections("other") + `
+		WITH startNode(r) AS source, endNode(r) AS target, r
+		RETURN DISTINCT
+		       coalesce(source.asset_id, source.segment_id, source.entity_id, source.id),
+		       coalesce(target.asset_id, target.segment_id, target.entity_id, target.id),
+		       toLower(type(r)),
+		       toFloat(coalesce(r.similarity_score, r.strength, r.confidence, 1.0)) AS strength,
+		       properties(r)
+		ORDER BY strength DESC
+		LIMIT $limit
+	`
+
+	resp, err := n.readCypherContext(ctx, query, map[string]interface{}{
+		"id":             entityID,
+		"collection_ids": collectionIDs,
+		"limit":          limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	relationships := []Relationship{}
+	if len(resp.Results) > 0 {
+		for _, row := range resp.Results[0].Data {
+			if len(row.Row) < 5 {
+				continue
+			}
+			properties, _ := row.Row[4].(map[string]interface{})
+			relationships = append(relationships, Relationship{
+				SourceID:   stringValue(row.Row[0]),
+				TargetID:   stringValue(row.Row[1]),
+				Type:       stringValue(row.Row[2]),
+				Strength:   floatValue(row.Row[3]),
+				Properties: properties,
+			})
+		}
+	}
+
+	return relationships, nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package neo4j
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNeo4j answers every statement with response and records the last
+// request, its path and its access mode
+type fakeNeo4j struct {
+	response string
+	path     string
+	mode     string
+	request  struct {
+		Statements []CypherRequest `json:"statements"`
+	}
+}
+
+func (f *fakeNeo4j) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.path, f.mode = r.URL.Path, r.Header.Get("access-mode")
+	json.NewDecoder(r.Body).Decode(&f.request)
+	w.Write([]byte(f.response))
+}
+
+func TestTraversalTypes(t *testing.T) {
+	assert.Equal(t, []string{"SIMILAR_TO"}, TraversalTypes([]string{"similar_to", "contains"}))
+	assert.Equal(t, []string{"SIMILAR_TO", "RELATED_TO"}, TraversalTypes(nil))
+	assert.Empty(t, TraversalTypes([]string{"contains"}))
+}
+
+func TestFindSeedAssets(t *testing.T) {
+	fake := &fakeNeo4j{response: `{"results": [{"data": [
+		{"row": ["asset-1", "harbour.mp4", "video/mp4", 0.5, ["seg-1", "seg-2"]]},
+		{"row": ["short"]}
+	]}], "errors": []}`}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := NewNeo4jClient(server.URL, "", "").ForTenant("acme")
+
+	seeds, err := client.FindSeedAssets(context.Background(), []string{"Boat", "Harbour"}, []string{"col-1"}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []SeedAsset{{AssetID: "asset-1", Filename: "harbour.mp4", MimeType: "video/mp4", Score: 0.5, SegmentIDs: []string{"seg-1", "seg-2"}}}, seeds)
+	assert.Equal(t, "/db/neo4j/tx/commit", fake.path)
+	assert.Equal(t, "READ", fake.mode)
+
+	statement := fake.request.Statements[0]
+	assert.Contains(t, statement.Statement, "a:`Tenant_acme`")
+	assert.Equal(t, []interface{}{"boat", "harbour"}, statement.Parameters["keywords"])
+	assert.Equal(t, []interface{}{"col-1"}, statement.Parameters["collection_ids"])
+
+	// No keywords, no lookup
+	fake.path = ""
+	seeds, err = client.FindSeedAssets(context.Background(), nil, nil, 10)
+	require.NoError(t, err)
+	assert.Empty(t, seeds)
+	assert.Empty(t, fake.path)
+}
+
+func TestTraverseFromSeeds(t *testing.T) {
+	fake := &fakeNeo4j{response: `{"results": [{"data": [
+		{"row": ["asset-2", "dock.mp4", "video/mp4", 0.6, 2, ["similar_to", "related_to"], ["asset-1"]]}
+	]}], "errors": []}`}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := NewNeo4jClient(server.URL, "", "")
+
+	hits, err := client.TraverseFromSeeds(context.Background(), []string{"asset-1"}, []string{"SIMILAR_TO", "RELATED_TO"}, nil, 9, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []GraphHit{{
+		AssetID: "asset-2", Filename: "dock.mp4", MimeType: "video/mp4", Score: 0.6, Hops: 2,
+		Via: []string{"similar_to", "related_to"}, SeedIDs: []string{"asset-1"},
+	}}, hits)
+	// Hops are capped at MaxTraversalHops
+	assert.Contains(t, fake.request.Statements[0].Statement, "[:SIMILAR_TO|RELATED_TO*1..3]")
+
+	_, err = client.TraverseFromSeeds(context.Background(), []string{"asset-1"}, []string{"KNOWS"}, nil, 1, 10)
+	assert.Error(t, err)
+
+	hits, err = client.TraverseFromSeeds(context.Background(), nil, []string{"SIMILAR_TO"}, nil, 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+}
+
+func TestGetRelationships(t *testing.T) {
+	fake := &fakeNeo4j{response: `{"results": [{"data": [
+		{"row": ["asset-1", "seg-1", "contains", 1, {"sequence": 1}]}
+	]}], "errors": []}`}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := NewNeo4jClient(server.URL, "", "")
+
+	relationships, err := client.GetRelationships(context.Background(), "asset-1", nil, 20)
+	require.NoError(t, err)
+	assert.Equal(t, []Relationship{{
+		SourceID: "asset-1", TargetID: "seg-1", Type: "contains", Strength: 1,
+		Properties: map[string]interface{}{"sequence": float64(1)},
+	}}, relationships)
+	assert.Equal(t, "asset-1", fake.request.Statements[0].Parameters["id"])
+
+	fake.response = `{"results": [], "errors": [{"code": "Neo.ClientError.Statement.SyntaxError", "message": "bad"}]}`
+	_, err = client.GetRelationships(context.Background(), "asset-1", nil, 20)
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.GetRelationships(ctx, "asset-1", nil, 20)
+	assert.ErrorIs(t, err, context.Canceled)
+}
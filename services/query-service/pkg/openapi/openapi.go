@@ -0,0 +1,361 @@
+package openapi
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Operation describes one route. Request and Response are values of the Go
+// types the handler binds and writes, so the spec follows the structs.
+type Operation struct {
+	Method  string
+	Path    string
+	Summary string
+	Tag     string
+	Query   []Param
+	// Request is bound from the JSON body; nil when there is none
+	Request interface{}
+	// Response is written with Status; nil means an empty body
+	Response interface{}
+	Status   int
+	// ContentType of the response, application/json by default
+	ContentType string
+}
+
+// Error is the body every handler fails with
+type Error struct {
+	Error string `json:"error" binding:"required"`
+}
+
+// Param is a query parameter
+type Param struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+}
+
+// Schema is the subset of JSON Schema that OpenAPI 3.0 uses
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// Document is an OpenAPI 3.0 document
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components components                      `json:"components"`
+	Security   []map[string][]string           `json:"security,omitempty"`
+
+	// types maps component names to the Go types they describe
+	types map[string]reflect.Type
+}
+
+// Info names the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type operation struct {
+	Summary     string              `json:"summary,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []parameter         `json:"parameters,omitempty"`
+	RequestBody *body               `json:"requestBody,omitempty"`
+	Responses   map[string]response `json:"responses"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type body struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+}
+
+type securityScheme struct {
+	Type   string `json:"type"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// pathParam matches gin's :name path segments
+var pathParam = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	rawType       = reflect.TypeOf(json.RawMessage{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// Build assembles the document for the operations. Every operation accepts
+// an API key or a bearer token.
+func Build(info Info, operations []Operation) *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]map[string]operation{},
+		Components: components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]securityScheme{
+				"apiKey":     {Type: "apiKey", In: "header", Name: "X-API-Key"},
+				"bearerAuth": {Type: "http", Scheme: "bearer"},
+			},
+		},
+		Security: []map[string][]string{{"apiKey": {}}, {"bearerAuth": {}}},
+		types:    map[string]reflect.Type{},
+	}
+	// Claimed first so the error body keeps the bare name
+	errorSchema := doc.schemaOf(reflect.TypeOf(Error{}))
+
+	for _, op := range operations {
+		path := pathParam.ReplaceAllString(op.Path, "{$1}")
+		out := operation{Summary: op.Summary, Responses: map[string]response{}}
+		if op.Tag != "" {
+			out.Tags = []string{op.Tag}
+		}
+		for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+			out.Parameters = append(out.Parameters, parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+		for _, param := range op.Query {
+			kind := param.Type
+			if kind == "" {
+				kind = "string"
+			}
+			out.Parameters = append(out.Parameters, parameter{
+				Name: param.Name, In: "query", Description: param.Description, Required: param.Required, Schema: &Schema{Type: kind},
+			})
+		}
+		if op.Request != nil {
+			out.RequestBody = &body{Required: true, Content: map[string]mediaType{
+				"application/json": {Schema: doc.schemaOf(reflect.TypeOf(op.Request))},
+			}}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ok := response{Description: http.StatusText(status)}
+		if op.Response != nil {
+			contentType := op.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			ok.Content = map[string]mediaType{contentType: {Schema: doc.schemaOf(reflect.TypeOf(op.Response))}}
+		}
+		out.Responses[strconv.Itoa(status)] = ok
+		out.Responses["default"] = response{Description: "Error", Content: map[string]mediaType{
+			"application/json": {Schema: errorSchema},
+		}}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]operation{}
+		}
+		doc.Paths[path][strings.ToLower(op.Method)] = out
+	}
+	return doc
+}
+
+// schemaOf returns the schema of a Go type as encoding/json writes it.
+// Named structs become components referenced by $ref.
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "nanoseconds"}
+	case t == rawType:
+		return &Schema{}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) || reflect.PtrTo(t).Implements(unmarshalType):
+		// Custom encodings are only described by their shape
+		return d.customSchema(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		name := d.componentName(t)
+		if _, ok := d.Components.Schemas[name]; !ok {
+			// Registered first so recursive types refer to themselves
+			d.Components.Schemas[name] = &Schema{}
+			*d.Components.Schemas[name] = *d.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	// Interfaces hold any JSON value
+	return &Schema{}
+}
+
+func (d *Document) customSchema(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Map, reflect.Struct:
+		return &Schema{Type: "object"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: &Schema{}}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	}
+	return &Schema{}
+}
+
+// structSchema lists the fields encoding/json writes, flattening embedded
+// structs. Fields bound with binding:"required" are required.
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				flat := d.structSchema(embedded)
+				for property, value := range flat.Properties {
+					schema.Properties[property] = value
+				}
+				schema.Required = append(schema.Required, flat.Required...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := d.schemaOf(field.Type)
+		if options == "string" {
+			property = &Schema{Type: "string"}
+		}
+		if field.Type.Kind() == reflect.Ptr && property.Ref == "" {
+			property.Nullable = true
+		}
+		schema.Properties[name] = property
+		if strings.Contains(","+field.Tag.Get("binding")+",", ",required,") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// componentName is the type name, qualified by its package when another
+// type already took the bare name
+func (d *Document) componentName(t reflect.Type) string {
+	name := t.Name()
+	if seen, ok := d.types[name]; ok && seen != t {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	d.types[name] = t
+	return name
+}
+
+// Handler serves the document as JSON
+func Handler(doc *Document) gin.HandlerFunc {
+	encoded, err := json.Marshal(doc)
+	return func(c *gin.Context) {
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/json", encoded)
+	}
+}
+
+// UIHandler serves Swagger UI for the document at specURL
+func UIHandler(title, specURL string) gin.HandlerFunc {
+	page := []byte(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>` + html.EscapeString(title) + `</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: ` + strconv.Quote(specURL) + `, dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`)
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	}
+}
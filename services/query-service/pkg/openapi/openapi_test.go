@@ -0,0 +1,91 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type node struct {
+	base
+	Name     string            `json:"name" binding:"required,max=10"`
+	Hidden   string            `json:"-"`
+	Children []node            `json:"children"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Parent   *string           `json:"parent"`
+	Created  time.Time         `json:"created_at"`
+	Extra    interface{}       `json:"extra"`
+}
+
+func TestBuild(t *testing.T) {
+	doc := Build(Info{Title: "Test", Version: "1"}, []Operation{
+		{Method: "POST", Path: "/nodes", Summary: "Create a node", Request: node{}, Response: node{}, Status: http.StatusCreated},
+		{Method: "GET", Path: "/nodes/:id/children/:child_id", Query: []Param{{Name: "limit", Type: "integer"}}, Response: []node{}},
+		{Method: "DELETE", Path: "/nodes/:id", Status: http.StatusNoContent},
+	})
+
+	create := doc.Paths["/nodes"]["post"]
+	assert.Equal(t, "#/components/schemas/node", create.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Contains(t, create.Responses, "201")
+	assert.Equal(t, "#/components/schemas/Error", create.Responses["default"].Content["application/json"].Schema.Ref)
+
+	get := doc.Paths["/nodes/{id}/children/{child_id}"]["get"]
+	require.Len(t, get.Parameters, 3)
+	assert.Equal(t, "child_id", get.Parameters[1].Name)
+	assert.Equal(t, "query", get.Parameters[2].In)
+	assert.Equal(t, "array", get.Responses["200"].Content["application/json"].Schema.Type)
+
+	assert.Empty(t, doc.Paths["/nodes/{id}"]["delete"].Responses["204"].Content)
+
+	schema := doc.Components.Schemas["node"]
+	require.NotNil(t, schema)
+	assert.Equal(t, []string{"name"}, schema.Required)
+	assert.Contains(t, schema.Properties, "id")
+	assert.NotContains(t, schema.Properties, "Hidden")
+	assert.NotContains(t, schema.Properties, "-")
+	assert.Equal(t, "#/components/schemas/node", schema.Properties["children"].Items.Ref)
+	assert.Equal(t, "string", schema.Properties["labels"].AdditionalProperties.Type)
+	assert.True(t, schema.Properties["parent"].Nullable)
+	assert.Equal(t, "date-time", schema.Properties["created_at"].Format)
+	assert.Equal(t, &Schema{}, schema.Properties["extra"])
+}
+
+func TestHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/openapi.json", Handler(Build(Info{Title: "Test", Version: "1"}, nil)))
+	router.GET("/docs", UIHandler("Test <API>", "/openapi.json"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `url: "/openapi.json"`)
+	assert.Contains(t, w.Body.String(), "Test &lt;API&gt;")
+}
+
+func TestComponentNamesQualifyCollisions(t *testing.T) {
+	type Error struct {
+		Code int `json:"code"`
+	}
+	doc := Build(Info{}, []Operation{{Method: "GET", Path: "/", Response: Error{}}})
+
+	assert.Equal(t, []string{"error"}, doc.Components.Schemas["Error"].Required)
+	assert.Contains(t, doc.Components.Schemas["openapi.Error"].Properties, "code")
+}
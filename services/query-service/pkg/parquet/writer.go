@@ -0,0 +1,372 @@
+// Package parquet writes flat tables of optional columns as Parquet files,
+// zstd compressed, readable by Spark, DuckDB and other data lake engines
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Type is the type of a column's values
+type Type int
+
+// Column types. Timestamps are stored as UTC microseconds.
+const (
+	String Type = iota
+	Int64
+	Float64
+	Bool
+	Timestamp
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int64:
+		return "int64"
+	case Float64:
+		return "float64"
+	case Bool:
+		return "bool"
+	case Timestamp:
+		return "timestamp"
+	default:
+		return fmt.Sprintf("type(%d)", int(t))
+	}
+}
+
+// Column is a named column; every column may hold nulls
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Values of the format's enums
+const (
+	physicalBoolean   = 0
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMicros = 10
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	repetitionOptional = 1
+	codecZstd          = 6
+	pageData           = 0
+)
+
+var magic = []byte("PAR1")
+
+// columnBuffer holds a column's values in the current row group
+type columnBuffer struct {
+	// levels has 1 for each row with a value and 0 for each null
+	levels []byte
+	// values holds the values PLAIN encoded, except booleans
+	values bytes.Buffer
+	bools  []bool
+}
+
+type columnChunk struct {
+	offset       int64
+	values       int64
+	compressed   int64
+	uncompressed int64
+}
+
+type rowGroup struct {
+	chunks []columnChunk
+	rows   int64
+}
+
+// Writer writes rows to a Parquet file, buffering up to rowGroupSize rows
+// in memory at a time. Close must be called to write the footer.
+type Writer struct {
+	out          io.Writer
+	offset       int64
+	columns      []Column
+	rowGroupSize int
+	buffers      []columnBuffer
+	rows         int
+	rowGroups    []rowGroup
+	encoder      *zstd.Encoder
+}
+
+// NewWriter starts a Parquet file with the given columns
+func NewWriter(out io.Writer, columns []Column, rowGroupSize int) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("a file needs at least one column")
+	}
+	if rowGroupSize < 1 {
+		return nil, fmt.Errorf("row group size must be positive")
+	}
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		out:          out,
+		columns:      columns,
+		rowGroupSize: rowGroupSize,
+		buffers:      make([]columnBuffer, len(columns)),
+		encoder:      encoder,
+	}
+	if err := w.write(magic); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) write(p []byte) error {
+	n, err := w.out.Write(p)
+	w.offset += int64(n)
+	return err
+}
+
+// Write appends a row holding a value or nil for each column: string,
+// int64, float64, bool or time.Time as the column's type requires
+func (w *Writer) Write(row []interface{}) error {
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("row has %d values for %d columns", len(row), len(w.columns))
+	}
+	for i, value := range row {
+		if !accepts(w.columns[i].Type, value) {
+			return fmt.Errorf("column %s: cannot write %T as %s", w.columns[i].Name, value, w.columns[i].Type)
+		}
+	}
+
+	var scratch [8]byte
+	for i, value := range row {
+		buffer := &w.buffers[i]
+		if value == nil {
+			buffer.levels = append(buffer.levels, 0)
+			continue
+		}
+		buffer.levels = append(buffer.levels, 1)
+		switch v := value.(type) {
+		case string:
+			binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)))
+			buffer.values.Write(scratch[:4])
+			buffer.values.WriteString(v)
+		case int64:
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+			buffer.values.Write(scratch[:])
+		case float64:
+			binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+			buffer.values.Write(scratch[:])
+		case bool:
+			buffer.bools = append(buffer.bools, v)
+		case time.Time:
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v.UnixMicro()))
+			buffer.values.Write(scratch[:])
+		}
+	}
+
+	w.rows++
+	if w.rows == w.rowGroupSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func accepts(t Type, value interface{}) bool {
+	switch value.(type) {
+	case nil:
+		return true
+	case string:
+		return t == String
+	case int64:
+		return t == Int64
+	case float64:
+		return t == Float64
+	case bool:
+		return t == Bool
+	case time.Time:
+		return t == Timestamp
+	default:
+		return false
+	}
+}
+
+// flush writes the buffered rows as a row group of one page per column
+func (w *Writer) flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+	group := rowGroup{rows: int64(w.rows)}
+	for i := range w.buffers {
+		buffer := &w.buffers[i]
+		page := encodeLevels(buffer.levels)
+		if w.columns[i].Type == Bool {
+			page = append(page, packBools(buffer.bools)...)
+		} else {
+			page = append(page, buffer.values.Bytes()...)
+		}
+		compressed := w.encoder.EncodeAll(page, nil)
+
+		var header thriftWriter
+		header.begin()
+		header.i32(1, pageData)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(compressed)))
+		header.structField(5)
+		header.i32(1, int32(w.rows))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.end()
+		header.end()
+
+		chunk := columnChunk{
+			offset:       w.offset,
+			values:       int64(w.rows),
+			compressed:   int64(header.buf.Len() + len(compressed)),
+			uncompressed: int64(header.buf.Len() + len(page)),
+		}
+		if err := w.write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := w.write(compressed); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+
+		buffer.levels = buffer.levels[:0]
+		buffer.values.Reset()
+		buffer.bools = buffer.bools[:0]
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.rows = 0
+	return nil
+}
+
+// encodeLevels encodes definition levels as runs of the RLE/bit-packed
+// hybrid encoding, prefixed with their length
+func encodeLevels(levels []byte) []byte {
+	encoded := make([]byte, 4, 16)
+	var scratch [binary.MaxVarintLen64]byte
+	for start := 0; start < len(levels); {
+		end := start
+		for end < len(levels) && levels[end] == levels[start] {
+			end++
+		}
+		encoded = append(encoded, scratch[:binary.PutUvarint(scratch[:], uint64(end-start)<<1)]...)
+		encoded = append(encoded, levels[start])
+		start = end
+	}
+	binary.LittleEndian.PutUint32(encoded, uint32(len(encoded)-4))
+	return encoded
+}
+
+func packBools(values []bool) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// Close writes the remaining rows and the footer. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	defer w.encoder.Close()
+
+	var numRows int64
+	for _, group := range w.rowGroups {
+		numRows += group.rows
+	}
+
+	var footer thriftWriter
+	footer.begin()
+	footer.i32(1, 1)
+	footer.list(2, thriftStruct, len(w.columns)+1)
+	footer.begin()
+	footer.string(4, "schema")
+	footer.i32(5, int32(len(w.columns)))
+	footer.end()
+	for _, column := range w.columns {
+		physical, converted := physicalType(column.Type)
+		footer.begin()
+		footer.i32(1, physical)
+		footer.i32(3, repetitionOptional)
+		footer.string(4, column.Name)
+		if converted >= 0 {
+			footer.i32(6, converted)
+		}
+		footer.end()
+	}
+	footer.i64(3, numRows)
+	footer.list(4, thriftStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		var size int64
+		footer.begin()
+		footer.list(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			physical, _ := physicalType(w.columns[i].Type)
+			size += chunk.uncompressed
+			footer.begin()
+			footer.i64(2, chunk.offset)
+			footer.structField(3)
+			footer.i32(1, physical)
+			footer.list(2, thriftI32, 2)
+			footer.varint(encodingPlain)
+			footer.varint(encodingRLE)
+			footer.list(3, thriftBinary, 1)
+			footer.uvarint(uint64(len(w.columns[i].Name)))
+			footer.buf.WriteString(w.columns[i].Name)
+			footer.i32(4, codecZstd)
+			footer.i64(5, chunk.values)
+			footer.i64(6, chunk.uncompressed)
+			footer.i64(7, chunk.compressed)
+			footer.i64(9, chunk.offset)
+			footer.end()
+			footer.end()
+		}
+		footer.i64(2, size)
+		footer.i64(3, group.rows)
+		footer.end()
+	}
+	footer.string(6, "dataflux query-service")
+	footer.end()
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(footer.buf.Len()))
+	for _, part := range [][]byte{footer.buf.Bytes(), length[:], magic} {
+		if err := w.write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// physicalType returns a column type's physical and converted types; -1
+// means no converted type
+func physicalType(t Type) (int32, int32) {
+	switch t {
+	case String:
+		return physicalByteArray, convertedUTF8
+	case Int64:
+		return physicalInt64, -1
+	case Float64:
+		return physicalDouble, -1
+	case Bool:
+		return physicalBoolean, -1
+	default:
+		return physicalInt64, convertedTimestampMicros
+	}
+}
@@ -0,0 +1,55 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterFraming(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []Column{{Name: "id", Type: String}, {Name: "at", Type: Timestamp}}, 2)
+	require.NoError(t, err)
+	for _, row := range [][]interface{}{{"a", time.Now()}, {nil, nil}, {"c", time.Now()}} {
+		require.NoError(t, w.Write(row))
+	}
+	require.NoError(t, w.Close())
+
+	file := buf.Bytes()
+	assert.Equal(t, "PAR1", string(file[:4]))
+	assert.Equal(t, "PAR1", string(file[len(file)-4:]))
+	footerLength := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footer := file[len(file)-8-footerLength : len(file)-8]
+	assert.Contains(t, string(footer), "dataflux query-service")
+	// Three rows in row groups of two make two groups
+	assert.Len(t, w.rowGroups, 2)
+	assert.Equal(t, int64(1), w.rowGroups[1].rows)
+}
+
+func TestWriterRejectsMismatchedValues(t *testing.T) {
+	w, err := NewWriter(&bytes.Buffer{}, []Column{{Name: "size", Type: Int64}}, 10)
+	require.NoError(t, err)
+	assert.EqualError(t, w.Write([]interface{}{"big"}), "column size: cannot write string as int64")
+	assert.Error(t, w.Write([]interface{}{int64(1), int64(2)}))
+	assert.Empty(t, w.buffers[0].levels)
+}
+
+func TestEncodeLevels(t *testing.T) {
+	// Runs of 3 values, 1 null and 2 values
+	assert.Equal(t, []byte{6, 0, 0, 0, 6, 1, 2, 0, 4, 1}, encodeLevels([]byte{1, 1, 1, 0, 1, 1}))
+	assert.Equal(t, []byte{0b101, 0b1}, packBools([]bool{true, false, true, false, false, false, false, false, true}))
+}
+
+func TestThriftFieldHeaders(t *testing.T) {
+	var w thriftWriter
+	w.begin()
+	w.i32(1, -1)
+	// A jump of more than 15 ids spells the id out
+	w.i64(20, 1)
+	w.end()
+	assert.Equal(t, []byte{0x15, 0x01, 0x06, 0x28, 0x02, 0x00}, w.buf.Bytes())
+}
@@ -0,0 +1,51 @@
+package queryv1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// NewStruct converts free-form metadata into a protobuf Struct. Values that
+// structpb cannot represent directly, such as typed slices or structs, are
+// converted through their JSON form.
+func NewStruct(fields map[string]interface{}) (*structpb.Struct, error) {
+	if fields == nil {
+		return nil, nil
+	}
+
+	result := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(fields))}
+	for key, value := range fields {
+		converted, err := newValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert field %s: %v", key, err)
+		}
+		result.Fields[key] = converted
+	}
+	return result, nil
+}
+
+// AsMap converts a protobuf Struct back into metadata, nil for an absent Struct
+func AsMap(s *structpb.Struct) map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+	return s.AsMap()
+}
+
+func newValue(value interface{}) (*structpb.Value, error) {
+	if converted, err := structpb.NewValue(value); err == nil {
+		return converted, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return structpb.NewValue(generic)
+}
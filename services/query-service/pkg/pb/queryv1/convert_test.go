@@ -0,0 +1,34 @@
+package queryv1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStructFallsBackToJSON(t *testing.T) {
+	type related struct {
+		AssetID string  `json:"asset_id"`
+		Score   float64 `json:"score"`
+	}
+
+	s, err := NewStruct(map[string]interface{}{
+		"filename": "a.jpg",
+		"objects":  []string{"car", "person"},
+		"related":  []related{{AssetID: "b", Score: 0.5}},
+	})
+	require.NoError(t, err)
+
+	m := AsMap(s)
+	assert.Equal(t, "a.jpg", m["filename"])
+	assert.Equal(t, []interface{}{"car", "person"}, m["objects"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"asset_id": "b", "score": 0.5}}, m["related"])
+}
+
+func TestNewStructNil(t *testing.T) {
+	s, err := NewStruct(nil)
+	require.NoError(t, err)
+	assert.Nil(t, s)
+	assert.Nil(t, AsMap(s))
+}
@@ -0,0 +1,230 @@
+package personalization
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Pin keeps an asset at a fixed position for one user and one query
+type Pin struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Query     string    `json:"query" binding:"required"`
+	AssetID   string    `json:"asset_id" binding:"required"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Boost multiplies the score of results from one collection for one user
+type Boost struct {
+	UserID       string    `json:"user_id"`
+	CollectionID string    `json:"collection_id"`
+	Weight       float64   `json:"weight" binding:"required"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Profile is everything needed to personalize one search for one user
+type Profile struct {
+	Pins   []Pin
+	Boosts map[string]float64
+}
+
+// BoostFor returns the score multiplier for a collection, 1.0 when none is set
+func (p *Profile) BoostFor(collectionID string) float64 {
+	if p == nil || collectionID == "" {
+		return 1.0
+	}
+	if weight, ok := p.Boosts[collectionID]; ok {
+		return weight
+	}
+	return 1.0
+}
+
+// Empty reports whether the profile would leave results unchanged
+func (p *Profile) Empty() bool {
+	return p == nil || (len(p.Pins) == 0 && len(p.Boosts) == 0)
+}
+
+// NormalizeQuery lowercases and collapses whitespace so pins survive trivial query variations
+func NormalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// database is the part of the pool the store uses
+type database interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Store persists pins and boosts in PostgreSQL
+type Store struct {
+	pool database
+}
+
+// NewStore creates a new personalization store
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// EnsureSchema creates the personalization tables if they do not exist
+func (s *Store) EnsureSchema(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS user_pins (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id VARCHAR(255) NOT NULL,
+			query_key TEXT NOT NULL,
+			asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			UNIQUE (user_id, query_key, asset_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_pins_lookup ON user_pins(user_id, query_key);
+
+		CREATE TABLE IF NOT EXISTS user_boosts (
+			user_id VARCHAR(255) NOT NULL,
+			collection_id UUID NOT NULL,
+			weight FLOAT NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (user_id, collection_id),
+			CONSTRAINT valid_boost_weight CHECK (weight > 0 AND weight <= 10)
+		);
+	`)
+	return err
+}
+
+// Load returns the pins for the query and all collection boosts of a user
+func (s *Store) Load(ctx context.Context, userID, query string) (*Profile, error) {
+	profile := &Profile{Boosts: map[string]float64{}}
+
+	pins, err := s.listPins(ctx, userID, NormalizeQuery(query))
+	if err != nil {
+		return nil, err
+	}
+	profile.Pins = pins
+
+	boosts, err := s.ListBoosts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, boost := range boosts {
+		profile.Boosts[boost.CollectionID] = boost.Weight
+	}
+
+	return profile, nil
+}
+
+// ListPins lists every pin of a user
+func (s *Store) ListPins(ctx context.Context, userID string) ([]Pin, error) {
+	return s.listPins(ctx, userID, "")
+}
+
+func (s *Store) listPins(ctx context.Context, userID, queryKey string) ([]Pin, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id::text, user_id, query_key, asset_id::text, position, created_at
+		FROM user_pins
+		WHERE user_id = $1 AND ($2 = '' OR query_key = $2)
+		ORDER BY query_key, position, created_at
+	`, userID, queryKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pins: %v", err)
+	}
+	defer rows.Close()
+
+	pins := []Pin{}
+	for rows.Next() {
+		var pin Pin
+		if err := rows.Scan(&pin.ID, &pin.UserID, &pin.Query, &pin.AssetID, &pin.Position, &pin.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pin: %v", err)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, rows.Err()
+}
+
+// CreatePin pins an asset for a query, replacing the position of an existing pin
+func (s *Store) CreatePin(ctx context.Context, pin Pin) (*Pin, error) {
+	pin.Query = NormalizeQuery(pin.Query)
+	if pin.Position < 0 {
+		pin.Position = 0
+	}
+
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO user_pins (user_id, query_key, asset_id, position)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, query_key, asset_id) DO UPDATE SET position = EXCLUDED.position
+		RETURNING id::text, created_at
+	`, pin.UserID, pin.Query, pin.AssetID, pin.Position).Scan(&pin.ID, &pin.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pin: %v", err)
+	}
+
+	return &pin, nil
+}
+
+// DeletePin removes one pin owned by the user
+func (s *Store) DeletePin(ctx context.Context, userID, pinID string) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM user_pins WHERE id = $1 AND user_id = $2`, pinID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete pin: %v", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListBoosts lists the collection boosts of a user
+func (s *Store) ListBoosts(ctx context.Context, userID string) ([]Boost, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT user_id, collection_id::text, weight, updated_at
+		FROM user_boosts
+		WHERE user_id = $1
+		ORDER BY weight DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load boosts: %v", err)
+	}
+	defer rows.Close()
+
+	boosts := []Boost{}
+	for rows.Next() {
+		var boost Boost
+		if err := rows.Scan(&boost.UserID, &boost.CollectionID, &boost.Weight, &boost.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan boost: %v", err)
+		}
+		boosts = append(boosts, boost)
+	}
+	return boosts, rows.Err()
+}
+
+// SetBoost creates or updates the boost for one collection
+func (s *Store) SetBoost(ctx context.Context, boost Boost) (*Boost, error) {
+	if boost.Weight <= 0 || boost.Weight > 10 {
+		return nil, fmt.Errorf("boost weight must be in (0, 10]")
+	}
+
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO user_boosts (user_id, collection_id, weight)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, collection_id) DO UPDATE SET weight = EXCLUDED.weight, updated_at = NOW()
+		RETURNING updated_at
+	`, boost.UserID, boost.CollectionID, boost.Weight).Scan(&boost.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set boost: %v", err)
+	}
+
+	return &boost, nil
+}
+
+// DeleteBoost removes the boost for one collection
+func (s *Store) DeleteBoost(ctx context.Context, userID, collectionID string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM user_boosts WHERE user_id = $1 AND collection_id = $2`, userID, collectionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete boost: %v", err)
+	}
+	return nil
+}
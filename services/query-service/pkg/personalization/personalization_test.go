@@ -0,0 +1,164 @@
+package personalization
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB answers queries on user_pins and user_boosts with the rows held
+// for each table, in the order given, and records each query's arguments
+type fakeDB struct {
+	pins   [][]interface{}
+	boosts [][]interface{}
+	args   [][]interface{}
+}
+
+func (f *fakeDB) rows(sql string, args []interface{}) [][]interface{} {
+	f.args = append(f.args, args)
+	switch {
+	case strings.Contains(sql, "user_pins"):
+		return f.pins
+	case strings.Contains(sql, "user_boosts"):
+		return f.boosts
+	}
+	return nil
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	f.rows(sql, args)
+	return pgconn.CommandTag("DELETE 1"), nil
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return &fakeRows{data: f.rows(sql, args)}, nil
+}
+
+func (f *fakeDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return &fakeRows{data: f.rows(sql, args), next: 1}
+}
+
+// fakeRows scans its data into pointers of the same type
+type fakeRows struct {
+	pgx.Rows
+	data [][]interface{}
+	next int
+}
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.data)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	if r.next > len(r.data) {
+		return pgx.ErrNoRows
+	}
+	for i, value := range r.data[r.next-1] {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error { return nil }
+
+func (r *fakeRows) Close() {}
+
+func TestNormalizeQuery(t *testing.T) {
+	assert.Equal(t, "harbour at night", NormalizeQuery("  Harbour\tat   NIGHT "))
+	assert.Empty(t, NormalizeQuery("   "))
+}
+
+func TestProfileBoostFor(t *testing.T) {
+	profile := &Profile{Boosts: map[string]float64{"col-1": 2.5, "col-2": 0.5}}
+	assert.Equal(t, 2.5, profile.BoostFor("col-1"))
+	assert.Equal(t, 0.5, profile.BoostFor("col-2"))
+	// Unboosted collections and results without one keep their score
+	assert.Equal(t, 1.0, profile.BoostFor("col-3"))
+	assert.Equal(t, 1.0, profile.BoostFor(""))
+
+	var missing *Profile
+	assert.Equal(t, 1.0, missing.BoostFor("col-1"))
+	assert.True(t, missing.Empty())
+	assert.True(t, (&Profile{Boosts: map[string]float64{}}).Empty())
+	assert.False(t, profile.Empty())
+	assert.False(t, (&Profile{Pins: []Pin{{AssetID: "asset-1"}}}).Empty())
+}
+
+func TestLoadProfile(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	// The database returns the pins by position and the boosts by weight
+	db := &fakeDB{
+		pins: [][]interface{}{
+			{"pin-1", "u1", "harbour", "asset-3", 0, created},
+			{"pin-2", "u1", "harbour", "asset-1", 2, created},
+		},
+		boosts: [][]interface{}{
+			{"u1", "col-1", 3.0, created},
+			{"u1", "col-2", 0.5, created},
+		},
+	}
+	store := &Store{pool: db}
+
+	profile, err := store.Load(context.Background(), "u1", "  HARBOUR ")
+	require.NoError(t, err)
+	// Pins are only loaded for the normalized query and keep their order
+	assert.Equal(t, []interface{}{"u1", "harbour"}, db.args[0])
+	require.Len(t, profile.Pins, 2)
+	assert.Equal(t, "asset-3", profile.Pins[0].AssetID)
+	assert.Equal(t, 0, profile.Pins[0].Position)
+	assert.Equal(t, "asset-1", profile.Pins[1].AssetID)
+	assert.Equal(t, 2, profile.Pins[1].Position)
+	assert.Equal(t, map[string]float64{"col-1": 3.0, "col-2": 0.5}, profile.Boosts)
+
+	// Listing every pin does not filter by query
+	pins, err := store.ListPins(context.Background(), "u1")
+	require.NoError(t, err)
+	assert.Len(t, pins, 2)
+	assert.Equal(t, []interface{}{"u1", ""}, db.args[2])
+
+	profile, err = (&Store{pool: &fakeDB{}}).Load(context.Background(), "u2", "harbour")
+	require.NoError(t, err)
+	assert.True(t, profile.Empty())
+}
+
+func TestCreatePin(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	db := &fakeDB{pins: [][]interface{}{{"pin-1", created}}}
+	store := &Store{pool: db}
+
+	pin, err := store.CreatePin(context.Background(), Pin{UserID: "u1", Query: "Harbour  Night", AssetID: "asset-1", Position: -3})
+	require.NoError(t, err)
+	// Negative positions pin to the top
+	assert.Equal(t, &Pin{ID: "pin-1", UserID: "u1", Query: "harbour night", AssetID: "asset-1", Position: 0, CreatedAt: created}, pin)
+	assert.Equal(t, []interface{}{"u1", "harbour night", "asset-1", 0}, db.args[0])
+
+	// Pins are only deleted for their owner
+	deleted, err := store.DeletePin(context.Background(), "u1", "pin-1")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Equal(t, []interface{}{"pin-1", "u1"}, db.args[1])
+}
+
+func TestSetBoost(t *testing.T) {
+	updated := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	db := &fakeDB{boosts: [][]interface{}{{updated}}}
+	store := &Store{pool: db}
+
+	for _, weight := range []float64{0, -1, 10.5} {
+		_, err := store.SetBoost(context.Background(), Boost{UserID: "u1", CollectionID: "col-1", Weight: weight})
+		assert.EqualError(t, err, "boost weight must be in (0, 10]", "weight %v", weight)
+	}
+	assert.Empty(t, db.args)
+
+	boost, err := store.SetBoost(context.Background(), Boost{UserID: "u1", CollectionID: "col-1", Weight: 10})
+	require.NoError(t, err)
+	assert.Equal(t, &Boost{UserID: "u1", CollectionID: "col-1", Weight: 10, UpdatedAt: updated}, boost)
+}
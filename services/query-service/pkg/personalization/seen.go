@@ -0,0 +1,104 @@
+package personalization
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// seenPrefix namespaces the Redis sets of assets shown to each user or session
+const seenPrefix = "seen:"
+
+// SeenKey returns the Redis key of the assets shown to a user, narrowed to
+// one session when a session ID is given. It is empty for anonymous callers
+// without a session, whose history is not tracked.
+func SeenKey(userID, sessionID string) string {
+	switch {
+	case userID != "" && sessionID != "":
+		return seenPrefix + "user:" + userID + ":" + sessionID
+	case userID != "":
+		return seenPrefix + "user:" + userID
+	case sessionID != "":
+		return seenPrefix + "session:" + sessionID
+	}
+	return ""
+}
+
+// SeenTracker records the assets returned to each caller in Redis sets so
+// later searches can leave them out with one membership check per result
+type SeenTracker struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewSeenTracker creates a tracker; a history expires ttl after the last
+// asset was added to it
+func NewSeenTracker(client *redis.Client, ttl time.Duration) *SeenTracker {
+	return &SeenTracker{client: client, ttl: ttl}
+}
+
+// Mark adds assets to the history
+func (t *SeenTracker) Mark(ctx context.Context, key string, assetIDs []string) error {
+	if key == "" || len(assetIDs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(assetIDs))
+	for i, id := range assetIDs {
+		members[i] = id
+	}
+
+	pipe := t.client.Pipeline()
+	pipe.SAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, t.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record seen assets: %v", err)
+	}
+	return nil
+}
+
+// Count returns the number of assets in the history
+func (t *SeenTracker) Count(ctx context.Context, key string) (int64, error) {
+	if key == "" {
+		return 0, nil
+	}
+	return t.client.SCard(ctx, key).Result()
+}
+
+// Seen reports, for each asset, whether it is in the history
+func (t *SeenTracker) Seen(ctx context.Context, key string, assetIDs []string) ([]bool, error) {
+	if key == "" || len(assetIDs) == 0 {
+		return make([]bool, len(assetIDs)), nil
+	}
+	members := make([]interface{}, len(assetIDs))
+	for i, id := range assetIDs {
+		members[i] = id
+	}
+
+	seen, err := t.client.SMIsMember(ctx, key, members...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check seen assets: %v", err)
+	}
+	return seen, nil
+}
+
+// Clear forgets the history
+func (t *SeenTracker) Clear(ctx context.Context, key string) error {
+	if key == "" {
+		return nil
+	}
+	return t.client.Del(ctx, key).Err()
+}
+
+// OverfetchLimit is how many results to ask the backends for so that limit
+// unseen ones remain after dropping up to seen known assets, bounded by max
+func OverfetchLimit(limit int, seen int64, max int) int {
+	if seen > int64(max) {
+		return max
+	}
+	if overfetched := limit + int(seen); overfetched < max {
+		return overfetched
+	}
+	return max
+}
@@ -0,0 +1,36 @@
+package personalization
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeenKey(t *testing.T) {
+	assert.Equal(t, "seen:user:u1", SeenKey("u1", ""))
+	assert.Equal(t, "seen:user:u1:s1", SeenKey("u1", "s1"))
+	assert.Equal(t, "seen:session:s1", SeenKey("", "s1"))
+	assert.Empty(t, SeenKey("", ""))
+}
+
+func TestOverfetchLimit(t *testing.T) {
+	assert.Equal(t, 20, OverfetchLimit(20, 0, 100))
+	assert.Equal(t, 35, OverfetchLimit(20, 15, 100))
+	assert.Equal(t, 100, OverfetchLimit(20, 95, 100))
+	assert.Equal(t, 100, OverfetchLimit(20, 1<<40, 100))
+}
+
+func TestUntrackedCallerNeedsNoRedis(t *testing.T) {
+	tracker := NewSeenTracker(nil, 0)
+	ctx := context.Background()
+
+	seen, err := tracker.Seen(ctx, "", []string{"a", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false}, seen)
+	assert.NoError(t, tracker.Mark(ctx, "", []string{"a"}))
+
+	count, err := tracker.Count(ctx, "")
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+}
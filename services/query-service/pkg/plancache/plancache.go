@@ -0,0 +1,139 @@
+package plancache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats reports cache effectiveness
+type Stats struct {
+	Size   int    `json:"size"`
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+type entry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+// Cache is a size-bounded LRU of compiled query plans with a per-entry TTL
+type Cache[V any] struct {
+	capacity int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	hits    uint64
+	misses  uint64
+}
+
+// New creates a plan cache holding at most capacity plans for ttl each
+func New[V any](capacity int, ttl time.Duration) *Cache[V] {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &Cache[V]{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get returns the plan stored under key if it has not expired
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return zero, false
+	}
+
+	item := element.Value.(*entry[V])
+	if c.ttl > 0 && time.Now().After(item.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		c.misses++
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits++
+	return item.value, true
+}
+
+// Put stores a plan, evicting the least recently used one when full
+func (c *Cache[V]) Put(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		item := element.Value.(*entry[V])
+		item.value = value
+		item.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[V]{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry[V]).key)
+	}
+}
+
+// Purge drops every plan, e.g. after the vocabulary used for planning changed
+func (c *Cache[V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// Stats returns the current size and hit counters
+func (c *Cache[V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{Size: c.order.Len(), Hits: c.hits, Misses: c.misses}
+}
+
+// NormalizeQuery lowercases the query and collapses whitespace so that
+// requests differing only in spacing or case share a plan
+func NormalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// ShapeKey builds a stable key from the normalized query and the request
+// options that influence planning; option order does not matter
+func ShapeKey(query string, options map[string]string) string {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	hash.Write([]byte(NormalizeQuery(query)))
+	for _, name := range names {
+		hash.Write([]byte{0})
+		hash.Write([]byte(name))
+		hash.Write([]byte{'='})
+		hash.Write([]byte(options[name]))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,49 @@
+package plancache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := New[int](2, time.Minute)
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+
+	cache.Put("c", 3)
+
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	value, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	stats := cache.Stats()
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+}
+
+func TestCacheExpiresEntries(t *testing.T) {
+	cache := New[string](10, time.Millisecond)
+	cache.Put("plan", "value")
+	time.Sleep(5 * time.Millisecond)
+
+	_, ok := cache.Get("plan")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Stats().Size)
+}
+
+func TestShapeKeyIgnoresSpacingCaseAndOptionOrder(t *testing.T) {
+	a := ShapeKey("Red  Car", map[string]string{"expansion": "narrower", "depth": "2"})
+	b := ShapeKey(" red car ", map[string]string{"depth": "2", "expansion": "narrower"})
+	c := ShapeKey("red car", map[string]string{"depth": "3", "expansion": "narrower"})
+
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+}
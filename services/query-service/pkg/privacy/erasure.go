@@ -0,0 +1,324 @@
+package privacy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+	neo4jclient "dataflux/query-service/pkg/neo4j"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Step outcome values
+const (
+	StatusDeleted = "deleted"
+	// StatusScheduled marks ClickHouse mutations, which are applied asynchronously
+	StatusScheduled = "scheduled"
+	StatusSkipped   = "skipped"
+	StatusFailed    = "failed"
+)
+
+// personalTables lists the PostgreSQL tables holding rows owned by a user.
+// Watches are also matched by their address, for subjects known by email.
+var personalTables = []struct {
+	table  string
+	column string
+}{
+	{"feedback", "user_id"},
+	{"user_pins", "user_id"},
+	{"user_boosts", "user_id"},
+	{"search_history", "user_id"},
+	{"user_sessions", "user_id"},
+	{"search_watches", "user_id"},
+	{"search_watches", "email"},
+	{"saved_searches", "owner_id"},
+}
+
+// personalKeyPatterns lists the Redis key patterns scoped to a user,
+// including the sets of results already shown to them in each session
+var personalKeyPatterns = []string{"session:%s*", "user:%s:*", "seen:user:%s", "seen:user:%s:*"}
+
+// StepResult is the outcome of erasing one kind of data from one store
+type StepResult struct {
+	Store    string `json:"store"`
+	Target   string `json:"target"`
+	Status   string `json:"status"`
+	Affected int64  `json:"affected"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report documents an erasure run; the subject is only kept as a hash
+type Report struct {
+	ID          string       `json:"id"`
+	SubjectHash string       `json:"subject_hash"`
+	RequestedBy string       `json:"requested_by,omitempty"`
+	StartedAt   time.Time    `json:"started_at"`
+	CompletedAt time.Time    `json:"completed_at"`
+	Complete    bool         `json:"complete"`
+	Steps       []StepResult `json:"steps"`
+}
+
+// Eraser removes a data subject's personal data from every backend
+type Eraser struct {
+	pool            *pgxpool.Pool
+	redis           *redis.Client
+	graph           *neo4jclient.Neo4jClient
+	analytics       *clickhouse.Client
+	analyticsTables []string
+}
+
+// NewEraser creates an eraser; nil clients are reported as skipped steps.
+// analyticsTables names the ClickHouse tables keyed by user_id.
+func NewEraser(pool *pgxpool.Pool, redisClient *redis.Client, graph *neo4jclient.Neo4jClient, analytics *clickhouse.Client, analyticsTables []string) *Eraser {
+	return &Eraser{
+		pool:            pool,
+		redis:           redisClient,
+		graph:           graph,
+		analytics:       analytics,
+		analyticsTables: analyticsTables,
+	}
+}
+
+// EnsureSchema creates the table that keeps erasure reports for audits
+func (e *Eraser) EnsureSchema(ctx context.Context) error {
+	_, err := e.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS data_subject_erasures (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			subject_hash VARCHAR(64) NOT NULL,
+			requested_by VARCHAR(255),
+			complete BOOLEAN NOT NULL,
+			report JSONB NOT NULL,
+			started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			completed_at TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_data_subject_erasures_subject ON data_subject_erasures(subject_hash);
+	`)
+	return err
+}
+
+// SubjectHash identifies a subject in reports without retaining the identifier
+func SubjectHash(subjectID string) string {
+	sum := sha256.Sum256([]byte(subjectID))
+	return hex.EncodeToString(sum[:])
+}
+
+// Erase purges the subject from every store and persists the report
+func (e *Eraser) Erase(ctx context.Context, subjectID, requestedBy string) (*Report, error) {
+	subjectID = strings.TrimSpace(subjectID)
+	if subjectID == "" {
+		return nil, fmt.Errorf("subject id is required")
+	}
+
+	report := &Report{
+		SubjectHash: SubjectHash(subjectID),
+		RequestedBy: requestedBy,
+		StartedAt:   time.Now().UTC(),
+		Complete:    true,
+	}
+
+	for _, t := range personalTables {
+		report.Steps = append(report.Steps, e.erasePostgres(ctx, t.table, t.column, subjectID))
+	}
+	report.Steps = append(report.Steps, e.eraseRedis(ctx, subjectID))
+	for _, table := range e.analyticsTables {
+		report.Steps = append(report.Steps, e.eraseClickHouse(ctx, table, subjectID))
+	}
+	report.Steps = append(report.Steps, e.eraseGraph(ctx, subjectID)...)
+
+	for _, step := range report.Steps {
+		if step.Status == StatusFailed {
+			report.Complete = false
+		}
+	}
+	report.CompletedAt = time.Now().UTC()
+
+	if err := e.save(ctx, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// GetReport loads a stored erasure report
+func (e *Eraser) GetReport(ctx context.Context, id string) (*Report, error) {
+	var data []byte
+	err := e.pool.QueryRow(ctx, `SELECT report FROM data_subject_erasures WHERE id = $1`, id).Scan(&data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load erasure report: %v", err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to decode erasure report: %v", err)
+	}
+	report.ID = id
+	return &report, nil
+}
+
+func (e *Eraser) save(ctx context.Context, report *Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode erasure report: %v", err)
+	}
+
+	err = e.pool.QueryRow(ctx, `
+		INSERT INTO data_subject_erasures (subject_hash, requested_by, complete, report, started_at, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, report.SubjectHash, report.RequestedBy, report.Complete, data, report.StartedAt, report.CompletedAt).Scan(&report.ID)
+	if err != nil {
+		return fmt.Errorf("failed to store erasure report: %v", err)
+	}
+	return nil
+}
+
+func (e *Eraser) erasePostgres(ctx context.Context, table, column, subjectID string) StepResult {
+	result := StepResult{Store: "postgres", Target: table}
+	if e.pool == nil {
+		result.Status = StatusSkipped
+		result.Detail = "postgres not configured"
+		return result
+	}
+
+	// Tables owned by other services may not exist in every deployment
+	var exists bool
+	if err := e.pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+		return failed(result, err)
+	}
+	if !exists {
+		result.Status = StatusSkipped
+		result.Detail = "table does not exist"
+		return result
+	}
+
+	// Compare as text because user_id is a UUID in some tables and free-form in others
+	tag, err := e.pool.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s::text = $1`, table, column), subjectID)
+	if err != nil {
+		return failed(result, err)
+	}
+	result.Status = StatusDeleted
+	result.Affected = tag.RowsAffected()
+	return result
+}
+
+func (e *Eraser) eraseRedis(ctx context.Context, subjectID string) StepResult {
+	result := StepResult{Store: "redis", Target: "session and user keys"}
+	if e.redis == nil {
+		result.Status = StatusSkipped
+		result.Detail = "redis not configured"
+		return result
+	}
+
+	for _, pattern := range personalKeyPatterns {
+		iter := e.redis.Scan(ctx, 0, fmt.Sprintf(pattern, escapeGlob(subjectID)), 500).Iterator()
+		for iter.Next(ctx) {
+			deleted, err := e.redis.Del(ctx, iter.Val()).Result()
+			if err != nil {
+				return failed(result, err)
+			}
+			result.Affected += deleted
+		}
+		if err := iter.Err(); err != nil {
+			return failed(result, err)
+		}
+	}
+	result.Status = StatusDeleted
+	return result
+}
+
+// escapeGlob keeps a subject id from widening a Redis SCAN pattern
+func escapeGlob(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (e *Eraser) eraseClickHouse(ctx context.Context, table, subjectID string) StepResult {
+	result := StepResult{Store: "clickhouse", Target: table}
+	if !e.analytics.Enabled() {
+		result.Status = StatusSkipped
+		result.Detail = "clickhouse not configured"
+		return result
+	}
+
+	qualified, err := e.analytics.Table(table)
+	if err != nil {
+		return failed(result, err)
+	}
+
+	statement := fmt.Sprintf("ALTER TABLE %s DELETE WHERE user_id = {subject:String}", qualified)
+	if _, err := e.analytics.Exec(ctx, statement, map[string]string{"subject": subjectID}); err != nil {
+		if clickhouse.IsUnknownTable(err) {
+			result.Status = StatusSkipped
+			result.Detail = "table does not exist"
+			return result
+		}
+		return failed(result, err)
+	}
+
+	result.Status = StatusScheduled
+	result.Detail = "mutation submitted; rows are removed when ClickHouse applies it"
+	return result
+}
+
+func (e *Eraser) eraseGraph(ctx context.Context, subjectID string) []StepResult {
+	nodes := StepResult{Store: "neo4j", Target: "nodes"}
+	relationships := StepResult{Store: "neo4j", Target: "relationships"}
+	if e.graph == nil {
+		nodes.Status, relationships.Status = StatusSkipped, StatusSkipped
+		nodes.Detail, relationships.Detail = "neo4j not configured", "neo4j not configured"
+		return []StepResult{nodes, relationships}
+	}
+
+	params := map[string]interface{}{"subject": subjectID}
+
+	// Relationships first, so edges recorded by the user on shared nodes are counted
+	relationships = e.runGraphDelete(ctx, relationships, `
+		MATCH ()-[r]->()
+		WHERE r.user_id = $subject
+		DELETE r
+		RETURN count(r) AS affected
+	`, params)
+
+	nodes = e.runGraphDelete(ctx, nodes, `
+		MATCH (n)
+		WHERE n.user_id = $subject OR n.person_id = $subject
+		DETACH DELETE n
+		RETURN count(n) AS affected
+	`, params)
+
+	return []StepResult{nodes, relationships}
+}
+
+func (e *Eraser) runGraphDelete(ctx context.Context, result StepResult, query string, params map[string]interface{}) StepResult {
+	resp, err := e.graph.ExecuteCypherContext(ctx, query, params)
+	if err != nil {
+		return failed(result, err)
+	}
+	if len(resp.Results) > 0 && len(resp.Results[0].Data) > 0 && len(resp.Results[0].Data[0].Row) > 0 {
+		if count, ok := resp.Results[0].Data[0].Row[0].(float64); ok {
+			result.Affected = int64(count)
+		}
+	}
+	result.Status = StatusDeleted
+	return result
+}
+
+func failed(result StepResult, err error) StepResult {
+	result.Status = StatusFailed
+	result.Error = err.Error()
+	return result
+}
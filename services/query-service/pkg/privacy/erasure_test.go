@@ -0,0 +1,116 @@
+package privacy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	neo4jclient "dataflux/query-service/pkg/neo4j"
+	"dataflux/query-service/pkg/personalization"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubjectHashIsStableAndOpaque(t *testing.T) {
+	hash := SubjectHash("user-42")
+
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, SubjectHash("user-42"))
+	assert.NotEqual(t, hash, SubjectHash("user-43"))
+	assert.NotContains(t, hash, "user-42")
+}
+
+func TestEscapeGlob(t *testing.T) {
+	assert.Equal(t, "user-1", escapeGlob("user-1"))
+	assert.Equal(t, `\*`, escapeGlob("*"))
+	assert.Equal(t, `a\?b\[c\]\\`, escapeGlob(`a?b[c]\`))
+}
+
+// retainedUserColumns are user-keyed columns erasure leaves alone, and why
+var retainedUserColumns = map[string]string{
+	// API keys are credentials admins issue and revoke; erasing one would
+	// lock out the integration using it
+	"query_api_keys.user_id": "revoked through /admin/api-keys",
+}
+
+// TestPersonalTablesCoverSchemas fails when a table created by the service
+// has a user-keyed column that erasure does not clear
+func TestPersonalTablesCoverSchemas(t *testing.T) {
+	erased := map[string]bool{}
+	for _, personal := range personalTables {
+		erased[personal.table+"."+personal.column] = true
+	}
+
+	createTable := regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS (\w+)\s*\((.*?)\n\s*\)`)
+	userColumn := regexp.MustCompile(`(?m)^\s*(user_id|owner_id|email)\s`)
+	found := 0
+	err := filepath.Walk("..", func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(file, ".go") || strings.HasSuffix(file, "_test.go") {
+			return err
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		for _, match := range createTable.FindAllStringSubmatch(string(source), -1) {
+			for _, column := range userColumn.FindAllStringSubmatch(match[2], -1) {
+				found++
+				name := match[1] + "." + column[1]
+				if _, ok := retainedUserColumns[name]; !ok {
+					assert.True(t, erased[name], "%s (%s) is not erased", name, file)
+				}
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.NotZero(t, found)
+}
+
+func TestPersonalKeyPatternsCoverSeenSets(t *testing.T) {
+	erased := func(key string) bool {
+		for _, pattern := range personalKeyPatterns {
+			if ok, _ := path.Match(fmt.Sprintf(pattern, "user-1"), key); ok {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, erased(personalization.SeenKey("user-1", "")))
+	assert.True(t, erased(personalization.SeenKey("user-1", "session-9")))
+	assert.False(t, erased(personalization.SeenKey("user-12", "")))
+}
+
+func TestEraseGraph(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"results": [{"columns": ["affected"], "data": [{"row": [3]}]}], "errors": []}`))
+	}))
+	defer server.Close()
+	eraser := NewEraser(nil, nil, neo4jclient.NewNeo4jClient(server.URL, "", ""), nil, nil)
+
+	steps := eraser.eraseGraph(context.Background(), "user-1")
+	require.Len(t, steps, 2)
+	for _, step := range steps {
+		assert.Equal(t, StatusDeleted, step.Status)
+		assert.Equal(t, int64(3), step.Affected)
+	}
+	assert.Equal(t, []string{"/db/neo4j/tx/commit", "/db/neo4j/tx/commit"}, paths)
+
+	// An abandoned request is not sent, and the erasure is left incomplete
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, step := range eraser.eraseGraph(ctx, "user-1") {
+		assert.Equal(t, StatusFailed, step.Status)
+	}
+	assert.Len(t, paths, 2)
+}
@@ -0,0 +1,182 @@
+package projection
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AnonymousRole is the role redactions use for callers without any role
+const AnonymousRole = "anonymous"
+
+// fieldPattern is a metadata key, or a dot path into nested metadata
+var fieldPattern = regexp.MustCompile(`^[a-z0-9_]+(\.[a-z0-9_]+)*$`)
+
+// Redactions lists, per role, the metadata fields hidden from it
+type Redactions map[string][]string
+
+// ParseRedactions reads redactions written as
+// role=field,field;role=field, such as viewer=storage_class;anonymous=preview.sprite_url
+func ParseRedactions(spec string) (Redactions, error) {
+	redactions := Redactions{}
+	for _, entry := range strings.Split(spec, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		role, list, ok := strings.Cut(entry, "=")
+		role = strings.ToLower(strings.TrimSpace(role))
+		if !ok || role == "" {
+			return nil, fmt.Errorf("redaction %q must be role=field,field", entry)
+		}
+		var fields []string
+		for _, field := range strings.Split(list, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+		if err := ValidateFields(fields); err != nil {
+			return nil, fmt.Errorf("redaction of %s: %v", role, err)
+		}
+		redactions[role] = append(redactions[role], fields...)
+	}
+	return redactions, nil
+}
+
+// Hidden returns the fields hidden from a caller with the roles. A field is
+// hidden only when every role redacts it, so a role that may see a field
+// grants it; roles without redactions see everything.
+func (r Redactions) Hidden(roles []string) []string {
+	if len(roles) == 0 {
+		roles = []string{AnonymousRole}
+	}
+	counts := map[string]int{}
+	for _, role := range roles {
+		seen := map[string]bool{}
+		for _, field := range r[strings.ToLower(role)] {
+			if !seen[field] {
+				seen[field] = true
+				counts[field]++
+			}
+		}
+	}
+	var hidden []string
+	for field, count := range counts {
+		if count == len(roles) {
+			hidden = append(hidden, field)
+		}
+	}
+	return hidden
+}
+
+// ValidateFields checks that every field is a metadata key or dot path
+func ValidateFields(fields []string) error {
+	for _, field := range fields {
+		if !fieldPattern.MatchString(field) {
+			return fmt.Errorf("invalid field %q: use lower-case metadata keys, with dots for nested keys", field)
+		}
+	}
+	return nil
+}
+
+// Project returns the metadata narrowed to fields, all of it when fields is
+// empty, without the hidden fields. Fields missing from the metadata are
+// left out. The metadata itself is not modified.
+func Project(metadata map[string]interface{}, fields, hidden []string) map[string]interface{} {
+	if metadata == nil {
+		return nil
+	}
+	projected := copyMap(metadata)
+	if len(fields) > 0 {
+		projected = map[string]interface{}{}
+		for _, field := range fields {
+			if value, ok := lookup(metadata, strings.Split(field, ".")); ok {
+				projected = set(projected, strings.Split(field, "."), value)
+			}
+		}
+	}
+	for _, field := range hidden {
+		projected = remove(projected, strings.Split(field, "."))
+	}
+	return projected
+}
+
+// Lookup returns the value of a metadata key or dot path
+func Lookup(metadata map[string]interface{}, field string) (interface{}, bool) {
+	if metadata == nil {
+		return nil, false
+	}
+	return lookup(metadata, strings.Split(field, "."))
+}
+
+// lookup finds the value at a path of nested maps
+func lookup(metadata map[string]interface{}, path []string) (interface{}, bool) {
+	value, ok := metadata[path[0]]
+	if !ok || len(path) == 1 {
+		return value, ok
+	}
+	nested, isMap := asMap(value)
+	if !isMap {
+		return nil, false
+	}
+	return lookup(nested, path[1:])
+}
+
+// set returns a copy of metadata with the value placed at a path, creating
+// or copying the nested maps on the way
+func set(metadata map[string]interface{}, path []string, value interface{}) map[string]interface{} {
+	updated := copyMap(metadata)
+	if len(path) == 1 {
+		updated[path[0]] = value
+		return updated
+	}
+	nested, _ := updated[path[0]].(map[string]interface{})
+	updated[path[0]] = set(nested, path[1:], value)
+	return updated
+}
+
+// remove returns a copy of metadata without the value at a path, or the
+// metadata itself when there is nothing to remove
+func remove(metadata map[string]interface{}, path []string) map[string]interface{} {
+	value, ok := metadata[path[0]]
+	if !ok {
+		return metadata
+	}
+	if len(path) == 1 {
+		updated := copyMap(metadata)
+		delete(updated, path[0])
+		return updated
+	}
+	nested, isMap := asMap(value)
+	if !isMap {
+		return metadata
+	}
+	updated := copyMap(metadata)
+	updated[path[0]] = remove(nested, path[1:])
+	return updated
+}
+
+// asMap returns nested metadata as a map. Values such as structs are seen
+// as the JSON objects they are encoded to.
+func asMap(value interface{}) (map[string]interface{}, bool) {
+	if nested, ok := value.(map[string]interface{}); ok {
+		return nested, true
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil || len(encoded) == 0 || encoded[0] != '{' {
+		return nil, false
+	}
+	var nested map[string]interface{}
+	if err := json.Unmarshal(encoded, &nested); err != nil {
+		return nil, false
+	}
+	return nested, true
+}
+
+func copyMap(metadata map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(metadata)+1)
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	return copied
+}
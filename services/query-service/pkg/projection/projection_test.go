@@ -0,0 +1,86 @@
+package projection
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRedactions(t *testing.T) {
+	redactions, err := ParseRedactions(" Viewer=storage_class, preview.sprite_url ; anonymous=thumbnail_url;")
+	require.NoError(t, err)
+	assert.Equal(t, Redactions{
+		"viewer":    {"storage_class", "preview.sprite_url"},
+		"anonymous": {"thumbnail_url"},
+	}, redactions)
+
+	for _, spec := range []string{"viewer", "=storage_class", "viewer=Storage Class"} {
+		_, err := ParseRedactions(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestHidden(t *testing.T) {
+	redactions := Redactions{
+		"viewer":    {"storage_class", "thumbnail_url"},
+		"analyst":   {"thumbnail_url"},
+		"anonymous": {"collection_id"},
+	}
+	assert.ElementsMatch(t, []string{"storage_class", "thumbnail_url"}, redactions.Hidden([]string{"viewer"}))
+	// A field is hidden only when every role redacts it
+	assert.Equal(t, []string{"thumbnail_url"}, redactions.Hidden([]string{"viewer", "analyst"}))
+	assert.Empty(t, redactions.Hidden([]string{"viewer", "admin"}))
+	assert.Equal(t, []string{"collection_id"}, redactions.Hidden(nil))
+}
+
+func TestProject(t *testing.T) {
+	metadata := map[string]interface{}{
+		"filename":      "dock.mp4",
+		"storage_class": "GLACIER",
+		"preview":       map[string]interface{}{"sprite_url": "https://cdn/s.jpg", "x": 0},
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"filename": "dock.mp4",
+		"preview":  map[string]interface{}{"x": 0},
+	}, Project(metadata, nil, []string{"storage_class", "preview.sprite_url"}))
+
+	assert.Equal(t, map[string]interface{}{
+		"filename": "dock.mp4",
+		"preview":  map[string]interface{}{"sprite_url": "https://cdn/s.jpg"},
+	}, Project(metadata, []string{"filename", "preview.sprite_url", "missing", "filename.nested"}, nil))
+
+	// Requesting a hidden field does not reveal it
+	assert.Empty(t, Project(metadata, []string{"storage_class"}, []string{"storage_class"}))
+
+	// The original is left alone
+	assert.Len(t, metadata, 3)
+	assert.Len(t, metadata["preview"], 2)
+	assert.Nil(t, Project(nil, []string{"filename"}, nil))
+}
+
+func TestProjectStructs(t *testing.T) {
+	type frame struct {
+		URL string `json:"url"`
+		X   int    `json:"x"`
+	}
+	metadata := map[string]interface{}{"preview": &frame{URL: "https://cdn/s.jpg", X: 160}}
+
+	assert.Equal(t, map[string]interface{}{"preview": map[string]interface{}{"x": 160.0}},
+		Project(metadata, nil, []string{"preview.url"}))
+	assert.Equal(t, map[string]interface{}{"preview": map[string]interface{}{"url": "https://cdn/s.jpg"}},
+		Project(metadata, []string{"preview.url"}, nil))
+}
+
+func TestLookup(t *testing.T) {
+	metadata := map[string]interface{}{"filename": "dock.mp4", "preview": map[string]interface{}{"url": "https://cdn/s.jpg"}}
+
+	value, ok := Lookup(metadata, "preview.url")
+	assert.True(t, ok)
+	assert.Equal(t, "https://cdn/s.jpg", value)
+	_, ok = Lookup(metadata, "filename.ext")
+	assert.False(t, ok)
+	_, ok = Lookup(nil, "filename")
+	assert.False(t, ok)
+}
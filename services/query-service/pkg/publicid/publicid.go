@@ -0,0 +1,329 @@
+package publicid
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// shortLength is the number of base62 digits needed for 128 bits
+	shortLength = 22
+	// FormatHeader lets a client ask for uuid instead of short identifiers
+	FormatHeader = "X-ID-Format"
+	// shortenKey marks requests whose responses get short identifiers
+	shortenKey = "publicid.shorten"
+)
+
+var (
+	base     = big.NewInt(62)
+	maxValue = new(big.Int).Lsh(big.NewInt(1), 128)
+)
+
+// Encode converts a UUID into its 22-character base62 form
+func Encode(uuid string) (string, bool) {
+	raw, ok := parseUUID(uuid)
+	if !ok {
+		return "", false
+	}
+
+	value := new(big.Int).SetBytes(raw)
+	digits := make([]byte, shortLength)
+	mod := new(big.Int)
+	for i := shortLength - 1; i >= 0; i-- {
+		value.DivMod(value, base, mod)
+		digits[i] = alphabet[mod.Int64()]
+	}
+	return string(digits), true
+}
+
+// Decode accepts a UUID or a short identifier and returns the canonical UUID
+func Decode(id string) (string, error) {
+	if raw, ok := parseUUID(id); ok {
+		return formatUUID(raw), nil
+	}
+	if len(id) != shortLength {
+		return "", fmt.Errorf("invalid identifier: %s", id)
+	}
+
+	value := new(big.Int)
+	for i := 0; i < len(id); i++ {
+		digit := strings.IndexByte(alphabet, id[i])
+		if digit < 0 {
+			return "", fmt.Errorf("invalid identifier: %s", id)
+		}
+		value.Mul(value, base)
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+	if value.Cmp(maxValue) >= 0 {
+		return "", fmt.Errorf("invalid identifier: %s", id)
+	}
+
+	raw := make([]byte, 16)
+	value.FillBytes(raw)
+	return formatUUID(raw), nil
+}
+
+func parseUUID(value string) ([]byte, bool) {
+	if len(value) != 36 || value[8] != '-' || value[13] != '-' || value[18] != '-' || value[23] != '-' {
+		return nil, false
+	}
+	raw, err := hex.DecodeString(strings.ReplaceAll(value, "-", ""))
+	if err != nil {
+		return nil, false
+	}
+	return raw, true
+}
+
+func formatUUID(raw []byte) string {
+	h := hex.EncodeToString(raw)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// Fields lists where asset UUIDs appear. Only these are translated, since
+// other identifiers such as user ids, term ids and collection names may be
+// 22 base62 characters long without being short UUIDs.
+type Fields struct {
+	// Params maps routes, as gin reports them in FullPath, to their path
+	// parameters holding asset UUIDs
+	Params map[string][]string
+	// Request are the query parameters and JSON body fields holding asset
+	// UUIDs or lists of them
+	Request []string
+	// Response maps routes to the JSON response fields holding asset UUIDs;
+	// responses of other routes are sent unchanged
+	Response map[string][]string
+}
+
+func keySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+// Middleware translates short identifiers to UUIDs on input (path parameters,
+// query parameters and JSON bodies) and UUIDs to short identifiers in JSON
+// responses, touching only the fields listed in fields, so paths and signed
+// URLs that embed UUIDs stay intact. Clients sending X-ID-Format: uuid get
+// UUIDs back unchanged.
+func Middleware(enabled bool, fields Fields) gin.HandlerFunc {
+	params := make(map[string]map[string]bool, len(fields.Params))
+	for route, names := range fields.Params {
+		params[route] = keySet(names)
+	}
+	request := keySet(fields.Request)
+	responses := make(map[string]map[string]bool, len(fields.Response))
+	for route, keys := range fields.Response {
+		responses[route] = keySet(keys)
+	}
+
+	return func(c *gin.Context) {
+		translateRequest(c, params[c.FullPath()], request)
+
+		keys := responses[c.FullPath()]
+		if !enabled || keys == nil || strings.EqualFold(c.GetHeader(FormatHeader), "uuid") {
+			c.Next()
+			return
+		}
+
+		c.Set(shortenKey, keys)
+		writer := &shorteningWriter{ResponseWriter: c.Writer, keys: keys}
+		c.Writer = writer
+		c.Next()
+		writer.flush()
+	}
+}
+
+// Shorten rewrites the identifiers in a JSON document when the request gets
+// short identifiers. Only JSON responses are rewritten by the middleware, so
+// handlers streaming other content types shorten each JSON payload with it.
+func Shorten(c *gin.Context, body []byte) []byte {
+	value, _ := c.Get(shortenKey)
+	keys, _ := value.(map[string]bool)
+	if keys == nil {
+		return body
+	}
+	if shortened, ok := rewriteJSON(body, keys, Encode); ok {
+		return shortened
+	}
+	return body
+}
+
+func translateRequest(c *gin.Context, params, keys map[string]bool) {
+	for i, param := range c.Params {
+		if params[param.Key] {
+			if uuid, err := Decode(param.Value); err == nil {
+				c.Params[i].Value = uuid
+			}
+		}
+	}
+
+	query := c.Request.URL.Query()
+	changed := false
+	for key, values := range query {
+		if !keys[key] {
+			continue
+		}
+		for i, value := range values {
+			if uuid, err := Decode(value); err == nil && uuid != value {
+				values[i] = uuid
+				changed = true
+			}
+		}
+	}
+	if changed {
+		c.Request.URL.RawQuery = query.Encode()
+	}
+
+	if c.Request.Body == nil || !strings.Contains(c.ContentType(), "json") {
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if !json.Valid(body) {
+		return
+	}
+
+	if translated, ok := rewriteJSON(body, keys, func(value string) (string, bool) {
+		uuid, err := Decode(value)
+		return uuid, err == nil && uuid != value
+	}); ok {
+		c.Request.Body = io.NopCloser(bytes.NewReader(translated))
+		c.Request.ContentLength = int64(len(translated))
+	}
+}
+
+// rewriteJSON applies translate to the strings under keys, and to the
+// strings of arrays under them, in a valid JSON document. The rest of the
+// document is copied as it is, without decoding it, so key order and
+// formatting survive. It returns the new document if anything changed.
+func rewriteJSON(data []byte, keys map[string]bool, translate func(string) (string, bool)) ([]byte, bool) {
+	type frame struct {
+		object    bool
+		expectKey bool
+		// key is the current key of an object, or the key an array is under
+		key string
+	}
+	var (
+		stack   []frame
+		out     []byte
+		copied  int
+		pending string
+	)
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '{':
+			stack = append(stack, frame{object: true, expectKey: true})
+		case '[':
+			stack = append(stack, frame{key: pending})
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ',':
+			if len(stack) > 0 && stack[len(stack)-1].object {
+				stack[len(stack)-1].expectKey = true
+			}
+		case '"':
+			end := i + 1
+			for end < len(data) && data[end] != '"' {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(data) {
+				return nil, false
+			}
+			if len(stack) == 0 {
+				i = end
+				continue
+			}
+			top := &stack[len(stack)-1]
+			if top.object && top.expectKey {
+				var key string
+				if err := json.Unmarshal(data[i:end+1], &key); err != nil {
+					return nil, false
+				}
+				top.key, top.expectKey = key, false
+				i = end
+				continue
+			}
+			if keys[top.key] {
+				var value string
+				if err := json.Unmarshal(data[i:end+1], &value); err != nil {
+					return nil, false
+				}
+				if translated, ok := translate(value); ok {
+					quoted, _ := json.Marshal(translated)
+					out = append(append(out, data[copied:i]...), quoted...)
+					copied = end + 1
+				}
+			}
+			i = end
+		}
+		// Arrays opened next are under the current key of the object
+		if len(stack) > 0 && stack[len(stack)-1].object {
+			pending = stack[len(stack)-1].key
+		} else {
+			pending = ""
+		}
+	}
+	if out == nil {
+		return nil, false
+	}
+	return append(out, data[copied:]...), true
+}
+
+// shorteningWriter buffers JSON responses so identifiers can be shortened
+// before they are sent; other content types pass straight through
+type shorteningWriter struct {
+	gin.ResponseWriter
+	keys        map[string]bool
+	buffer      bytes.Buffer
+	passThrough bool
+	decided     bool
+}
+
+func (w *shorteningWriter) decide() {
+	if !w.decided {
+		w.decided = true
+		w.passThrough = !strings.Contains(w.Header().Get("Content-Type"), "json")
+	}
+}
+
+func (w *shorteningWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.passThrough {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buffer.Write(data)
+}
+
+func (w *shorteningWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *shorteningWriter) flush() {
+	if w.passThrough || w.buffer.Len() == 0 {
+		return
+	}
+
+	body := w.buffer.Bytes()
+	if shortened, ok := rewriteJSON(body, w.keys, Encode); ok {
+		body = shortened
+	}
+	w.ResponseWriter.Write(body)
+}
@@ -0,0 +1,143 @@
+package publicid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const uuid = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	short, ok := Encode(uuid)
+	require.True(t, ok)
+	assert.Len(t, short, 22)
+
+	decoded, err := Decode(short)
+	require.NoError(t, err)
+	assert.Equal(t, uuid, decoded)
+
+	decoded, err = Decode(strings.ToUpper(uuid))
+	require.NoError(t, err)
+	assert.Equal(t, uuid, decoded)
+
+	zero, _ := Encode("00000000-0000-0000-0000-000000000000")
+	assert.Equal(t, strings.Repeat("0", 22), zero)
+}
+
+func TestDecodeRejectsInvalidIdentifiers(t *testing.T) {
+	for _, id := range []string{"", "asset-1", "zzzzzzzzzzzzzzzzzzzzzz", "abc!defghijklmnopqrstu"} {
+		_, err := Decode(id)
+		assert.Error(t, err, id)
+	}
+}
+
+var testFields = Fields{
+	Params:   map[string][]string{"/assets/:id": {"id"}},
+	Request:  []string{"asset_id", "asset_ids"},
+	Response: map[string][]string{"/assets/:id": {"id", "asset_id", "asset_ids"}, "/stream": {"id"}},
+}
+
+func TestMiddlewareTranslatesInputAndOutput(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	short, _ := Encode(uuid)
+
+	router := gin.New()
+	router.Use(Middleware(true, testFields))
+	router.POST("/assets/:id", func(c *gin.Context) {
+		var body struct {
+			AssetIDs []string `json:"asset_ids"`
+		}
+		require.NoError(t, c.ShouldBindJSON(&body))
+		c.JSON(http.StatusOK, gin.H{
+			"id":            c.Param("id"),
+			"asset_ids":     body.AssetIDs,
+			"thumbnail_url": "http://minio/" + uuid + "/thumb.jpg",
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/assets/"+short, strings.NewReader(`{"asset_ids":["`+short+`"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"`+short+`","asset_ids":["`+short+`"],"thumbnail_url":"http://minio/`+uuid+`/thumb.jpg"}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/assets/"+uuid, strings.NewReader(`{"asset_ids":["`+uuid+`"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(FormatHeader, "uuid")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.JSONEq(t, `{"id":"`+uuid+`","asset_ids":["`+uuid+`"],"thumbnail_url":"http://minio/`+uuid+`/thumb.jpg"}`, rec.Body.String())
+}
+
+func TestMiddlewareLeavesOtherIdentifiers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// 22 base62 characters, but a term and a user, not short UUIDs
+	const term, user = "photographicequipments", "u0123456789abcdefghijk"
+
+	router := gin.New()
+	router.Use(Middleware(true, testFields))
+	router.POST("/terms/:id", func(c *gin.Context) {
+		var body map[string]interface{}
+		require.NoError(t, c.ShouldBindJSON(&body))
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "user_id": c.Query("user_id"), "body": body})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/terms/"+term+"?user_id="+user, strings.NewReader(`{"user_id":"`+user+`","collection_id":"`+term+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	// Nor are UUIDs shortened in responses of routes not listed
+	assert.JSONEq(t, `{"id":"`+term+`","user_id":"`+user+`","body":{"user_id":"`+user+`","collection_id":"`+term+`"}}`, rec.Body.String())
+	router.GET("/plain", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"id": uuid}) })
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/plain", nil))
+	assert.Equal(t, `{"id":"`+uuid+`"}`, rec.Body.String())
+}
+
+func TestRewriteJSONKeepsDocument(t *testing.T) {
+	short, _ := Encode(uuid)
+	keys := map[string]bool{"id": true, "asset_ids": true}
+	document := `{"took_ms":12, "results":[{"score":0.5,"id":"` + uuid + `","query_id":"` + uuid + `","tags":["` + uuid + `"]}],` +
+		`"asset_ids":["` + uuid + `",["nested"],"x\"y"],"note":"\"id\": \"` + uuid + `\""}`
+
+	rewritten, ok := rewriteJSON([]byte(document), keys, Encode)
+	require.True(t, ok)
+	// Key order, spacing and other fields are untouched
+	assert.Equal(t, `{"took_ms":12, "results":[{"score":0.5,"id":"`+short+`","query_id":"`+uuid+`","tags":["`+uuid+`"]}],`+
+		`"asset_ids":["`+short+`",["nested"],"x\"y"],"note":"\"id\": \"`+uuid+`\""}`, string(rewritten))
+
+	_, ok = rewriteJSON([]byte(`{"id":"asset-1","count":3}`), keys, Encode)
+	assert.False(t, ok)
+}
+
+func TestShortenFollowsRequestedFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	short, _ := Encode(uuid)
+
+	router := gin.New()
+	router.Use(Middleware(true, testFields))
+	router.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Writer.Write(append([]byte("data: "), Shorten(c, []byte(`{"id":"`+uuid+`"}`))...))
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Equal(t, `data: {"id":"`+short+`"}`, rec.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	req.Header.Set(FormatHeader, "uuid")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, `data: {"id":"`+uuid+`"}`, rec.Body.String())
+}
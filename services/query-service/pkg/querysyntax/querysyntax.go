@@ -0,0 +1,301 @@
+package querysyntax
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultNearDistance applies to a bare NEAR without /N
+	DefaultNearDistance = 5
+	// MaxNearDistance bounds the positional alternatives generated per pair
+	MaxNearDistance = 20
+
+	// MinWildcardPrefix is the number of literal characters required before
+	// the first *, so a pattern cannot match most of the index
+	MinWildcardPrefix = 3
+	// MinFuzzyLength is the shortest term accepted for fuzzy matching
+	MinFuzzyLength = 3
+	// DefaultFuzzyDistance applies to a bare ~ without a distance
+	DefaultFuzzyDistance = 1
+	// MaxFuzzyDistance bounds the edit distance of fuzzy terms
+	MaxFuzzyDistance = 2
+	// MaxPatternTerms bounds the wildcard and fuzzy terms per query; extra
+	// terms are searched as plain keywords
+	MaxPatternTerms = 5
+)
+
+var (
+	phrasePattern = regexp.MustCompile(`"([^"]*)"`)
+	nearPattern   = regexp.MustCompile(`^NEAR(?:/(\d+))?$`)
+	wildcardTerm  = regexp.MustCompile(`^[\p{L}\p{N}]*\*[\p{L}\p{N}*]*$`)
+	fuzzyTerm     = regexp.MustCompile(`^([\p{L}\p{N}]+)~(\d*)$`)
+)
+
+// Near requires two words to appear at most Distance words apart, in either order
+type Near struct {
+	Left     string `json:"left"`
+	Right    string `json:"right"`
+	Distance int    `json:"distance"`
+}
+
+// Query is a query string split into free text and positional constraints
+type Query struct {
+	// Text is the query without phrases and proximity operators
+	Text string `json:"text"`
+	// Phrases are quoted word sequences that must appear adjacently and in order
+	Phrases [][]string `json:"phrases,omitempty"`
+	Near    []Near     `json:"near,omitempty"`
+	// Wildcards are lower-case terms containing *, such as repor*
+	Wildcards []string `json:"wildcards,omitempty"`
+	Fuzzy     []Fuzzy  `json:"fuzzy,omitempty"`
+}
+
+// Fuzzy matches words within Distance edits of Term, counting an adjacent
+// transposition as one edit, so reprot~1 matches report
+type Fuzzy struct {
+	Term     string `json:"term"`
+	Distance int    `json:"distance"`
+}
+
+// Parse extracts quoted phrases ("prime minister speech"), proximity
+// operators (word1 NEAR/3 word2), wildcard terms (repor*) and fuzzy terms
+// (reprot~1) from a query. NEAR must be upper case so natural language such
+// as "photos near the beach" is left alone. Wildcard and fuzzy terms that
+// fail the safeguards are kept in Text as plain words.
+func Parse(query string) Query {
+	var parsed Query
+
+	for _, match := range phrasePattern.FindAllStringSubmatch(query, -1) {
+		if words := Words(match[1]); len(words) > 0 {
+			parsed.Phrases = append(parsed.Phrases, words)
+		}
+	}
+	rest := phrasePattern.ReplaceAllString(query, " ")
+	rest = strings.ReplaceAll(rest, `"`, " ")
+
+	fields := strings.Fields(rest)
+	used := make([]bool, len(fields))
+	for i := 0; i+2 < len(fields); i++ {
+		distance, ok := nearDistance(fields[i+1])
+		if !ok {
+			continue
+		}
+		left, right := Words(fields[i]), Words(fields[i+2])
+		if len(left) == 0 || len(right) == 0 {
+			continue
+		}
+		parsed.Near = append(parsed.Near, Near{
+			Left:     left[len(left)-1],
+			Right:    right[0],
+			Distance: distance,
+		})
+		used[i], used[i+1], used[i+2] = true, true, true
+		// Chains such as a NEAR b NEAR c continue from b
+		i++
+	}
+
+	var text []string
+	for i, field := range fields {
+		if used[i] {
+			continue
+		}
+		if !parsed.addPattern(strings.ToLower(field)) {
+			text = append(text, plainWord(field))
+		}
+	}
+	parsed.Text = strings.Join(strings.Fields(strings.Join(text, " ")), " ")
+	return parsed
+}
+
+// addPattern records a wildcard or fuzzy term if it passes the safeguards
+func (q *Query) addPattern(field string) bool {
+	if len(q.Wildcards)+len(q.Fuzzy) >= MaxPatternTerms {
+		return false
+	}
+	if wildcardTerm.MatchString(field) {
+		prefix := field[:strings.Index(field, "*")]
+		if utf8.RuneCountInString(prefix) < MinWildcardPrefix {
+			return false
+		}
+		q.Wildcards = append(q.Wildcards, field)
+		return true
+	}
+	if match := fuzzyTerm.FindStringSubmatch(field); match != nil {
+		if utf8.RuneCountInString(match[1]) < MinFuzzyLength {
+			return false
+		}
+		distance := DefaultFuzzyDistance
+		if match[2] != "" {
+			distance, _ = strconv.Atoi(match[2])
+		}
+		if distance < 1 {
+			return false
+		}
+		if distance > MaxFuzzyDistance {
+			distance = MaxFuzzyDistance
+		}
+		q.Fuzzy = append(q.Fuzzy, Fuzzy{Term: match[1], Distance: distance})
+		return true
+	}
+	return false
+}
+
+// plainWord strips wildcard and fuzzy operators from a rejected term
+func plainWord(field string) string {
+	if match := fuzzyTerm.FindStringSubmatch(field); match != nil {
+		return match[1]
+	}
+	return strings.ReplaceAll(field, "*", " ")
+}
+
+// WildcardPrefix is the literal part of a wildcard term before the first *
+func WildcardPrefix(pattern string) string {
+	if i := strings.Index(pattern, "*"); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+func nearDistance(field string) (int, bool) {
+	match := nearPattern.FindStringSubmatch(field)
+	if match == nil {
+		return 0, false
+	}
+	distance := DefaultNearDistance
+	if match[1] != "" {
+		distance, _ = strconv.Atoi(match[1])
+	}
+	if distance < 1 {
+		distance = 1
+	}
+	if distance > MaxNearDistance {
+		distance = MaxNearDistance
+	}
+	return distance, true
+}
+
+// HasPatterns reports whether the query contains wildcard or fuzzy terms
+func (q Query) HasPatterns() bool {
+	return len(q.Wildcards) > 0 || len(q.Fuzzy) > 0
+}
+
+// HasConstraints reports whether the query contains phrases or proximity operators
+func (q Query) HasConstraints() bool {
+	return len(q.Phrases) > 0 || len(q.Near) > 0
+}
+
+// BM25Text flattens the query into plain terms for engines without
+// positional operators, such as Weaviate's BM25
+func (q Query) BM25Text() string {
+	terms := []string{}
+	if q.Text != "" {
+		terms = append(terms, q.Text)
+	}
+	for _, phrase := range q.Phrases {
+		terms = append(terms, phrase...)
+	}
+	for _, near := range q.Near {
+		terms = append(terms, near.Left, near.Right)
+	}
+	terms = append(terms, q.patternWords()...)
+	return strings.Join(terms, " ")
+}
+
+// patternWords approximates wildcard and fuzzy terms by plain words for
+// engines without pattern support
+func (q Query) patternWords() []string {
+	var words []string
+	for _, pattern := range q.Wildcards {
+		words = append(words, WildcardPrefix(pattern))
+	}
+	for _, fuzzy := range q.Fuzzy {
+		words = append(words, fuzzy.Term)
+	}
+	return words
+}
+
+// WebSearchText renders the query for PostgreSQL websearch_to_tsquery, which
+// understands quoted phrases; proximity pairs degrade to requiring both words
+func (q Query) WebSearchText() string {
+	terms := []string{}
+	if q.Text != "" {
+		terms = append(terms, q.Text)
+	}
+	for _, phrase := range q.Phrases {
+		terms = append(terms, `"`+strings.Join(phrase, " ")+`"`)
+	}
+	for _, near := range q.Near {
+		terms = append(terms, near.Left, near.Right)
+	}
+	terms = append(terms, q.patternWords()...)
+	return strings.Join(terms, " ")
+}
+
+// Matches checks the positional constraints against text, for backends that
+// can only filter results after retrieving them
+func (q Query) Matches(text string) bool {
+	words := Words(text)
+	for _, phrase := range q.Phrases {
+		if !containsSequence(words, phrase) {
+			return false
+		}
+	}
+	for _, near := range q.Near {
+		if !withinDistance(words, near) {
+			return false
+		}
+	}
+	return true
+}
+
+// Words lowercases text and splits it on anything but letters and digits,
+// matching how the full-text indexes tokenize
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func containsSequence(words, sequence []string) bool {
+	for start := 0; start+len(sequence) <= len(words); start++ {
+		matched := true
+		for i, word := range sequence {
+			if words[start+i] != word {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func withinDistance(words []string, near Near) bool {
+	var lefts, rights []int
+	for i, word := range words {
+		if word == near.Left {
+			lefts = append(lefts, i)
+		}
+		if word == near.Right {
+			rights = append(rights, i)
+		}
+	}
+	for _, l := range lefts {
+		for _, r := range rights {
+			distance := r - l
+			if distance < 0 {
+				distance = -distance
+			}
+			if distance >= 1 && distance <= near.Distance {
+				return true
+			}
+		}
+	}
+	return false
+}
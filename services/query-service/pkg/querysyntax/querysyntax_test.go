@@ -0,0 +1,73 @@
+package querysyntax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePhrasesAndNear(t *testing.T) {
+	q := Parse(`"Prime Minister speech" budget election NEAR/3 results`)
+
+	assert.Equal(t, [][]string{{"prime", "minister", "speech"}}, q.Phrases)
+	assert.Equal(t, []Near{{Left: "election", Right: "results", Distance: 3}}, q.Near)
+	assert.Equal(t, "budget", q.Text)
+	assert.True(t, q.HasConstraints())
+}
+
+func TestParseLeavesNaturalLanguageAlone(t *testing.T) {
+	q := Parse(`photos near the beach with "unclosed quote`)
+
+	assert.False(t, q.HasConstraints())
+	assert.Equal(t, "photos near the beach with unclosed quote", q.Text)
+}
+
+func TestParseChainedAndBareNear(t *testing.T) {
+	q := Parse("storm NEAR coast NEAR/50 damage")
+
+	assert.Equal(t, []Near{
+		{Left: "storm", Right: "coast", Distance: DefaultNearDistance},
+		{Left: "coast", Right: "damage", Distance: MaxNearDistance},
+	}, q.Near)
+	assert.Empty(t, q.Text)
+}
+
+func TestRenderings(t *testing.T) {
+	q := Parse(`budget "prime minister" tax NEAR/2 cuts`)
+
+	assert.Equal(t, "budget prime minister tax cuts", q.BM25Text())
+	assert.Equal(t, `budget "prime minister" tax cuts`, q.WebSearchText())
+}
+
+func TestMatches(t *testing.T) {
+	q := Parse(`"prime minister" speech NEAR/2 budget`)
+
+	assert.True(t, q.Matches("The Prime Minister gave a budget speech"))
+	assert.False(t, q.Matches("The minister, prime among equals, gave a budget speech"))
+	assert.False(t, q.Matches("Prime minister speech on the coming year's budget"))
+}
+
+func TestParseWildcardAndFuzzy(t *testing.T) {
+	q := Parse("Repor* annual col*r reprot~1 budgte~ summary~9")
+
+	assert.Equal(t, []string{"repor*", "col*r"}, q.Wildcards)
+	assert.Equal(t, []Fuzzy{
+		{Term: "reprot", Distance: 1},
+		{Term: "budgte", Distance: DefaultFuzzyDistance},
+		{Term: "summary", Distance: MaxFuzzyDistance},
+	}, q.Fuzzy)
+	assert.Equal(t, "annual", q.Text)
+	assert.Equal(t, "annual repor col reprot budgte summary", q.BM25Text())
+}
+
+func TestParsePatternSafeguards(t *testing.T) {
+	q := Parse("*port re* ab~1 x~0 a* b* c* d* e*")
+
+	assert.Empty(t, q.Wildcards)
+	assert.Empty(t, q.Fuzzy)
+	assert.Equal(t, "port re ab x a b c d e", q.Text)
+
+	q = Parse("aaa* bbb* ccc* ddd* eee* fff*")
+	assert.Len(t, q.Wildcards, MaxPatternTerms)
+	assert.Equal(t, "fff", q.Text)
+}
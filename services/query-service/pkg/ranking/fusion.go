@@ -0,0 +1,117 @@
+package ranking
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Fusion methods for merging results from several backends
+const (
+	// FusionRRF scores a result by the sum of weight / (k + rank) over the backends that returned it
+	FusionRRF = "rrf"
+	// FusionWeighted min-max normalizes each backend's scores and sums them by weight
+	FusionWeighted = "weighted"
+)
+
+// DefaultRRFK is the rank constant from the original RRF paper
+const DefaultRRFK = 60
+
+// Hit is one backend result entering fusion. Key identifies the same
+// document across backends; Score is the backend's raw score, higher is better.
+type Hit struct {
+	Key    string
+	Source string
+	Score  float64
+}
+
+// FusionMethod returns the configured method, RRF when unset
+func (p Profile) FusionMethod() string {
+	if p.Fusion == "" {
+		return FusionRRF
+	}
+	return p.Fusion
+}
+
+func (p Profile) rrfK() float64 {
+	if p.RRFK <= 0 {
+		return DefaultRRFK
+	}
+	return p.RRFK
+}
+
+func validateFusion(p Profile) error {
+	switch p.Fusion {
+	case "", FusionRRF, FusionWeighted:
+	default:
+		return fmt.Errorf("fusion must be %q or %q", FusionRRF, FusionWeighted)
+	}
+	if p.RRFK < 0 {
+		return fmt.Errorf("rrf_k must not be negative")
+	}
+	return nil
+}
+
+// Fuse combines the hits of all backends into one score per key. Raw scores
+// are only compared within a backend, so Weaviate distances, PostgreSQL
+// ts_rank and Neo4j strengths never meet on the same scale. The fused
+// scores are scaled so the best key scores 1.
+func (p Profile) Fuse(hits []Hit) map[string]float64 {
+	bySource := map[string][]Hit{}
+	for _, hit := range hits {
+		bySource[hit.Source] = append(bySource[hit.Source], hit)
+	}
+
+	fused := map[string]float64{}
+	for source, sourceHits := range bySource {
+		weight := p.SourceWeight(source)
+		for key, score := range p.sourceScores(sourceHits) {
+			fused[key] += weight * score
+		}
+	}
+
+	best := 0.0
+	for _, score := range fused {
+		if score > best {
+			best = score
+		}
+	}
+	if best > 0 {
+		for key := range fused {
+			fused[key] /= best
+		}
+	}
+	return fused
+}
+
+// sourceScores turns one backend's raw scores into per-key contributions,
+// counting only the best hit of each key
+func (p Profile) sourceScores(hits []Hit) map[string]float64 {
+	sorted := append([]Hit(nil), hits...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Score > sorted[j].Score })
+
+	scores := make(map[string]float64, len(sorted))
+	if p.FusionMethod() == FusionWeighted {
+		low, high := sorted[len(sorted)-1].Score, sorted[0].Score
+		for _, hit := range sorted {
+			if _, seen := scores[hit.Key]; seen {
+				continue
+			}
+			if high > low {
+				scores[hit.Key] = (hit.Score - low) / (high - low)
+			} else {
+				scores[hit.Key] = 1
+			}
+		}
+		return scores
+	}
+
+	rank := 0
+	for _, hit := range sorted {
+		if _, seen := scores[hit.Key]; seen {
+			continue
+		}
+		rank++
+		scores[hit.Key] = 1 / (p.rrfK() + float64(rank))
+	}
+	return scores
+}
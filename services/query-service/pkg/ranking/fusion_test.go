@@ -0,0 +1,59 @@
+package ranking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuseRRFRewardsAgreement(t *testing.T) {
+	profile := DefaultProfile()
+	fused := profile.Fuse([]Hit{
+		{Key: "a", Source: "postgres", Score: 0.9},
+		{Key: "b", Source: "postgres", Score: 0.5},
+		{Key: "b", Source: "weaviate", Score: 12.3},
+		{Key: "c", Source: "weaviate", Score: 8.1},
+	})
+
+	// b is found by both backends, so it beats the top hit of either
+	assert.Equal(t, 1.0, fused["b"])
+	assert.InDelta(t, (1.0/61)/(1.0/62+1.0/61), fused["a"], 1e-9)
+	// Raw scores are not compared across backends: c's 8.1 ranks below a's 0.9
+	assert.Greater(t, fused["a"], fused["c"])
+}
+
+func TestFuseRRFCountsBestHitPerKey(t *testing.T) {
+	fused := DefaultProfile().Fuse([]Hit{
+		{Key: "a", Source: "postgres", Score: 0.9},
+		{Key: "a", Source: "postgres", Score: 0.8},
+		{Key: "b", Source: "postgres", Score: 0.7},
+	})
+
+	assert.InDelta(t, (1.0/62)/(1.0/61), fused["b"], 1e-9)
+}
+
+func TestFuseWeightedNormalizesPerSource(t *testing.T) {
+	profile := DefaultProfile()
+	profile.Fusion = FusionWeighted
+	profile.SourceWeights["neo4j"] = 0.5
+
+	fused := profile.Fuse([]Hit{
+		{Key: "a", Source: "postgres", Score: 0.02},
+		{Key: "b", Source: "postgres", Score: 0.01},
+		{Key: "c", Source: "neo4j", Score: 40},
+	})
+
+	assert.Equal(t, 1.0, fused["a"])
+	assert.Equal(t, 0.0, fused["b"])
+	assert.Equal(t, 0.5, fused["c"])
+}
+
+func TestValidateFusion(t *testing.T) {
+	profile := DefaultProfile()
+	profile.Fusion = "borda"
+	assert.Error(t, profile.Validate())
+
+	profile.Fusion = FusionWeighted
+	profile.RRFK = -1
+	assert.Error(t, profile.Validate())
+}
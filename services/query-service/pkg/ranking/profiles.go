@@ -0,0 +1,265 @@
+package ranking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// DefaultProfileName is used when a request does not name a profile
+const DefaultProfileName = "default"
+
+// updatesChannel carries the names of profiles changed on any replica
+const updatesChannel = "ranking:profiles:updated"
+
+// Profile holds the relevance tuning knobs applied when results are merged
+type Profile struct {
+	Name string `json:"name"`
+	// SourceWeights scale scores per backend (weaviate, postgres, neo4j, transcripts)
+	SourceWeights map[string]float64 `json:"source_weights"`
+	// RecencyHalfLifeDays halves the score of results this many days old; 0 disables decay
+	RecencyHalfLifeDays float64 `json:"recency_half_life_days"`
+	// FieldBoosts add to the score when the query appears in the named metadata field
+	FieldBoosts map[string]float64 `json:"field_boosts"`
+	// Fusion merges the backends' result lists: rrf (default) or weighted
+	Fusion string `json:"fusion,omitempty"`
+	// RRFK is the RRF rank constant; 0 uses DefaultRRFK
+	RRFK      float64   `json:"rrf_k,omitempty"`
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultProfile mirrors the behaviour before profiles were configurable
+func DefaultProfile() Profile {
+	return Profile{
+		Name: DefaultProfileName,
+		SourceWeights: map[string]float64{
+			"weaviate":    1.0,
+			"postgres":    1.0,
+			"neo4j":       1.0,
+			"transcripts": 1.0,
+		},
+		FieldBoosts: map[string]float64{
+			"filename": 0.1,
+		},
+	}
+}
+
+// Validate rejects profiles that would produce negative or undefined scores
+func (p Profile) Validate() error {
+	for source, weight := range p.SourceWeights {
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return fmt.Errorf("source weight for %s must be a non-negative number", source)
+		}
+	}
+	for field, boost := range p.FieldBoosts {
+		if math.IsNaN(boost) || math.IsInf(boost, 0) {
+			return fmt.Errorf("field boost for %s must be a finite number", field)
+		}
+	}
+	if p.RecencyHalfLifeDays < 0 {
+		return fmt.Errorf("recency_half_life_days must not be negative")
+	}
+	return validateFusion(p)
+}
+
+// SourceWeight returns the weight for a backend, 1.0 when unset
+func (p Profile) SourceWeight(source string) float64 {
+	if weight, ok := p.SourceWeights[source]; ok {
+		return weight
+	}
+	return 1.0
+}
+
+// RecencyFactor returns the decay multiplier for a result created at createdAt
+func (p Profile) RecencyFactor(createdAt, now time.Time) float64 {
+	if p.RecencyHalfLifeDays <= 0 || createdAt.IsZero() {
+		return 1.0
+	}
+	ageDays := now.Sub(createdAt).Hours() / 24
+	if ageDays <= 0 {
+		return 1.0
+	}
+	return math.Pow(0.5, ageDays/p.RecencyHalfLifeDays)
+}
+
+// Registry keeps the active profiles in memory and in sync across replicas
+type Registry struct {
+	pool  *pgxpool.Pool
+	redis *redis.Client
+
+	mu       sync.RWMutex
+	profiles map[string]Profile
+}
+
+// NewRegistry creates a registry seeded with the default profile
+func NewRegistry(pool *pgxpool.Pool, redisClient *redis.Client) *Registry {
+	return &Registry{
+		pool:     pool,
+		redis:    redisClient,
+		profiles: map[string]Profile{DefaultProfileName: DefaultProfile()},
+	}
+}
+
+// EnsureSchema creates the profile table if it does not exist
+func (r *Registry) EnsureSchema(ctx context.Context) error {
+	_, err := r.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS ranking_profiles (
+			name VARCHAR(100) PRIMARY KEY,
+			profile JSONB NOT NULL,
+			version INTEGER NOT NULL DEFAULT 1,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+// LoadAll replaces the in-memory profiles with the persisted ones
+func (r *Registry) LoadAll(ctx context.Context) error {
+	rows, err := r.pool.Query(ctx, `SELECT profile, version, updated_at FROM ranking_profiles`)
+	if err != nil {
+		return fmt.Errorf("failed to load ranking profiles: %v", err)
+	}
+	defer rows.Close()
+
+	loaded := map[string]Profile{DefaultProfileName: DefaultProfile()}
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return err
+		}
+		loaded[profile.Name] = profile
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.profiles = loaded
+	r.mu.Unlock()
+	return nil
+}
+
+// Get returns the named profile, falling back to the default profile
+func (r *Registry) Get(name string) Profile {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if name == "" {
+		name = DefaultProfileName
+	}
+	if profile, ok := r.profiles[name]; ok {
+		return profile
+	}
+	return r.profiles[DefaultProfileName]
+}
+
+// List returns every active profile
+func (r *Registry) List() []Profile {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	profiles := make([]Profile, 0, len(r.profiles))
+	for _, profile := range r.profiles {
+		profiles = append(profiles, profile)
+	}
+	return profiles
+}
+
+// Put persists a profile, activates it locally and notifies the other replicas
+func (r *Registry) Put(ctx context.Context, profile Profile) (Profile, error) {
+	if err := profile.Validate(); err != nil {
+		return Profile{}, err
+	}
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return Profile{}, fmt.Errorf("failed to encode profile: %v", err)
+	}
+
+	err = r.pool.QueryRow(ctx, `
+		INSERT INTO ranking_profiles (name, profile)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE
+		SET profile = EXCLUDED.profile,
+		    version = ranking_profiles.version + 1,
+		    updated_at = NOW()
+		RETURNING version, updated_at
+	`, profile.Name, data).Scan(&profile.Version, &profile.UpdatedAt)
+	if err != nil {
+		return Profile{}, fmt.Errorf("failed to store profile: %v", err)
+	}
+
+	r.mu.Lock()
+	r.profiles[profile.Name] = profile
+	r.mu.Unlock()
+
+	if err := r.redis.Publish(ctx, updatesChannel, profile.Name).Err(); err != nil {
+		log.Printf("Warning: failed to broadcast ranking profile %s: %v", profile.Name, err)
+	}
+
+	return profile, nil
+}
+
+// Subscribe reloads profiles announced by other replicas until ctx is cancelled
+func (r *Registry) Subscribe(ctx context.Context) {
+	pubsub := r.redis.Subscribe(ctx, updatesChannel)
+
+	go func() {
+		defer pubsub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-pubsub.Channel():
+				if !ok {
+					return
+				}
+				if err := r.reload(ctx, msg.Payload); err != nil {
+					log.Printf("Warning: failed to reload ranking profile %s: %v", msg.Payload, err)
+				}
+			}
+		}
+	}()
+}
+
+func (r *Registry) reload(ctx context.Context, name string) error {
+	row := r.pool.QueryRow(ctx, `SELECT profile, version, updated_at FROM ranking_profiles WHERE name = $1`, name)
+	profile, err := scanProfile(row)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.profiles[profile.Name] = profile
+	r.mu.Unlock()
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProfile(row scanner) (Profile, error) {
+	var data []byte
+	var version int
+	var updatedAt time.Time
+	if err := row.Scan(&data, &version, &updatedAt); err != nil {
+		return Profile{}, fmt.Errorf("failed to scan profile: %v", err)
+	}
+
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return Profile{}, fmt.Errorf("failed to decode profile: %v", err)
+	}
+	profile.Version = version
+	profile.UpdatedAt = updatedAt
+	return profile, nil
+}
@@ -0,0 +1,44 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileValidate(t *testing.T) {
+	assert.NoError(t, DefaultProfile().Validate())
+
+	negative := DefaultProfile()
+	negative.SourceWeights["neo4j"] = -1
+	assert.Error(t, negative.Validate())
+
+	nan := DefaultProfile()
+	nan.FieldBoosts["filename"] = math.NaN()
+	assert.Error(t, nan.Validate())
+
+	decay := DefaultProfile()
+	decay.RecencyHalfLifeDays = -3
+	assert.Error(t, decay.Validate())
+}
+
+func TestProfileRecencyFactor(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	profile := Profile{RecencyHalfLifeDays: 10}
+
+	assert.Equal(t, 1.0, profile.RecencyFactor(time.Time{}, now))
+	assert.Equal(t, 1.0, profile.RecencyFactor(now.Add(time.Hour), now))
+	assert.InDelta(t, 0.5, profile.RecencyFactor(now.AddDate(0, 0, -10), now), 1e-9)
+	assert.InDelta(t, 0.25, profile.RecencyFactor(now.AddDate(0, 0, -20), now), 1e-9)
+
+	assert.Equal(t, 1.0, Profile{}.RecencyFactor(now.AddDate(-1, 0, 0), now))
+}
+
+func TestProfileSourceWeightDefaultsToOne(t *testing.T) {
+	profile := Profile{SourceWeights: map[string]float64{"weaviate": 2}}
+
+	assert.Equal(t, 2.0, profile.SourceWeight("weaviate"))
+	assert.Equal(t, 1.0, profile.SourceWeight("postgres"))
+}
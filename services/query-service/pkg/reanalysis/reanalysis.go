@@ -0,0 +1,339 @@
+package reanalysis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/fulltext"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Job statuses. The pipeline moves a job from queued to running and then
+// to completed or failed.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// MaxAnalyzers bounds the analyzers one request may name
+const MaxAnalyzers = 20
+
+// consumerGroup is the group the query service replicas read results in, so
+// each result is handled once
+const consumerGroup = "query-service"
+
+var analyzerPattern = regexp.MustCompile(`^[a-z0-9_]{1,100}$`)
+
+// ErrNotFound is returned for assets and jobs the caller cannot see
+var ErrNotFound = errors.New("not found")
+
+// Job is one request to run analyzers on an asset again
+type Job struct {
+	ID      string `json:"id"`
+	AssetID string `json:"asset_id"`
+	// Analyzers to run; empty runs every analyzer
+	Analyzers    []string   `json:"analyzers"`
+	Status       string     `json:"status"`
+	Error        string     `json:"error,omitempty"`
+	RequestedBy  string     `json:"requested_by,omitempty"`
+	CollectionID string     `json:"collection_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// Done reports whether the pipeline has finished with the job
+func (j Job) Done() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed
+}
+
+// Request asks for an asset to be analyzed again. CollectionIDs and Tenant
+// confine the asset to what the caller may see, as in search.
+type Request struct {
+	AssetID       string
+	Analyzers     []string
+	RequestedBy   string
+	CollectionIDs []string
+	Tenant        string
+}
+
+// ValidateAnalyzers checks analyzer names and returns them sorted without
+// duplicates
+func ValidateAnalyzers(analyzers []string) ([]string, error) {
+	if len(analyzers) > MaxAnalyzers {
+		return nil, fmt.Errorf("at most %d analyzers may be requested", MaxAnalyzers)
+	}
+	seen := map[string]bool{}
+	valid := []string{}
+	for _, analyzer := range analyzers {
+		analyzer = strings.TrimSpace(analyzer)
+		if !analyzerPattern.MatchString(analyzer) {
+			return nil, fmt.Errorf("invalid analyzer name %q", analyzer)
+		}
+		if !seen[analyzer] {
+			seen[analyzer] = true
+			valid = append(valid, analyzer)
+		}
+	}
+	sort.Strings(valid)
+	return valid, nil
+}
+
+// Result is a status update the pipeline appends to the results stream
+type Result struct {
+	JobID  string
+	Status string
+	Error  string
+}
+
+// Store tracks re-analysis jobs in PostgreSQL and hands them to the
+// processing pipeline over Redis streams
+type Store struct {
+	pool          *pgxpool.Pool
+	redis         *redis.Client
+	requestStream string
+	resultStream  string
+}
+
+// NewStore creates a store publishing requests to requestStream and
+// reading status updates from resultStream
+func NewStore(pool *pgxpool.Pool, redisClient *redis.Client, requestStream, resultStream string) *Store {
+	return &Store{pool: pool, redis: redisClient, requestStream: requestStream, resultStream: resultStream}
+}
+
+// EnsureSchema creates the job table if it does not exist
+func (s *Store) EnsureSchema(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS reanalysis_jobs (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			asset_id UUID NOT NULL,
+			analyzers TEXT[] NOT NULL DEFAULT '{}',
+			status VARCHAR(20) NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			requested_by VARCHAR(255) NOT NULL DEFAULT '',
+			collection_id VARCHAR(255) NOT NULL DEFAULT '',
+			tenant_id VARCHAR(40) NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			completed_at TIMESTAMP WITH TIME ZONE
+		);
+		CREATE INDEX IF NOT EXISTS idx_reanalysis_jobs_asset ON reanalysis_jobs(asset_id, created_at DESC);
+	`)
+	return err
+}
+
+const jobColumns = `id::text, asset_id::text, analyzers, status, error, requested_by, collection_id, created_at, updated_at, completed_at`
+
+// Submit records a job and publishes it to the pipeline. A job still queued
+// or running for the same asset and analyzers is returned instead, with
+// created false.
+func (s *Store) Submit(ctx context.Context, req Request) (job Job, created bool, err error) {
+	analyzers, err := ValidateAnalyzers(req.Analyzers)
+	if err != nil {
+		return Job{}, false, err
+	}
+
+	var collectionID *string
+	err = s.pool.QueryRow(ctx, `
+		SELECT e.parent_id::text
+		FROM assets a
+		JOIN entities e ON e.id = a.id
+		WHERE a.id::text = $1 AND ($2::text[] IS NULL OR e.parent_id::text = ANY($2))
+		  AND `+fmt.Sprintf(fulltext.TenantCondition, 3), req.AssetID, req.CollectionIDs, req.Tenant).Scan(&collectionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, false, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, false, fmt.Errorf("failed to look up asset: %v", err)
+	}
+
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+jobColumns+`
+		FROM reanalysis_jobs
+		WHERE asset_id::text = $1 AND analyzers = $2 AND status IN ('queued', 'running')
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, req.AssetID, analyzers)
+	if job, err := scanJob(row); err == nil {
+		return job, false, nil
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, false, err
+	}
+
+	collection := ""
+	if collectionID != nil {
+		collection = *collectionID
+	}
+	row = s.pool.QueryRow(ctx, `
+		INSERT INTO reanalysis_jobs (asset_id, analyzers, status, requested_by, collection_id, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+jobColumns,
+		req.AssetID, analyzers, StatusQueued, req.RequestedBy, collection, req.Tenant)
+	job, err = scanJob(row)
+	if err != nil {
+		return Job{}, false, err
+	}
+
+	if err := s.publish(ctx, job); err != nil {
+		// A job the pipeline never heard of would stay queued forever
+		s.update(ctx, Result{JobID: job.ID, Status: StatusFailed, Error: err.Error()})
+		return Job{}, false, err
+	}
+	return job, true, nil
+}
+
+func (s *Store) publish(ctx context.Context, job Job) error {
+	analyzers, err := json.Marshal(job.Analyzers)
+	if err != nil {
+		return err
+	}
+	err = s.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.requestStream,
+		Values: map[string]interface{}{
+			"job_id":       job.ID,
+			"asset_id":     job.AssetID,
+			"analyzers":    analyzers,
+			"requested_at": job.CreatedAt.UTC().Format(time.RFC3339),
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish re-analysis request: %v", err)
+	}
+	return nil
+}
+
+// Get returns a job if its asset is visible with the collections and tenant
+func (s *Store) Get(ctx context.Context, id string, collectionIDs []string, tenant string) (Job, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+jobColumns+`
+		FROM reanalysis_jobs
+		WHERE id::text = $1 AND ($2::text[] IS NULL OR collection_id = ANY($2))
+		  AND ($3::text = '' OR tenant_id = $3)
+	`, id, collectionIDs, tenant)
+	job, err := scanJob(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	return job, err
+}
+
+// update applies a status update and returns the job; finished jobs are
+// left alone so a late running update cannot reopen them
+func (s *Store) update(ctx context.Context, result Result) (Job, error) {
+	row := s.pool.QueryRow(ctx, `
+		UPDATE reanalysis_jobs
+		SET status = $2, error = $3, updated_at = NOW(),
+		    completed_at = CASE WHEN $2 IN ('completed', 'failed') THEN NOW() END
+		WHERE id::text = $1 AND status IN ('queued', 'running')
+		RETURNING `+jobColumns,
+		result.JobID, result.Status, result.Error)
+	job, err := scanJob(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	return job, err
+}
+
+// Consume reads status updates from the results stream until ctx is
+// cancelled, calling onDone for every job that completed or failed. Replicas
+// share a consumer group, so each update is handled by one of them.
+func (s *Store) Consume(ctx context.Context, consumer string, onDone func(Job)) {
+	err := s.redis.XGroupCreateMkStream(ctx, s.resultStream, consumerGroup, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Printf("Warning: failed to create re-analysis consumer group: %v", err)
+		return
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			streams, err := s.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group:    consumerGroup,
+				Consumer: consumer,
+				Streams:  []string{s.resultStream, ">"},
+				Count:    100,
+				Block:    5 * time.Second,
+			}).Result()
+			if err != nil {
+				if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+					log.Printf("Warning: failed to read re-analysis results: %v", err)
+					time.Sleep(time.Second)
+				}
+				continue
+			}
+
+			for _, stream := range streams {
+				for _, message := range stream.Messages {
+					s.handle(ctx, message, onDone)
+					if err := s.redis.XAck(ctx, s.resultStream, consumerGroup, message.ID).Err(); err != nil {
+						log.Printf("Warning: failed to acknowledge re-analysis result %s: %v", message.ID, err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (s *Store) handle(ctx context.Context, message redis.XMessage, onDone func(Job)) {
+	result, err := parseResult(message.Values)
+	if err != nil {
+		log.Printf("Warning: ignoring re-analysis result %s: %v", message.ID, err)
+		return
+	}
+	job, err := s.update(ctx, result)
+	if errors.Is(err, ErrNotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("Warning: failed to update re-analysis job %s: %v", result.JobID, err)
+		return
+	}
+	if job.Done() {
+		onDone(job)
+	}
+}
+
+// parseResult reads a status update written by the pipeline
+func parseResult(values map[string]interface{}) (Result, error) {
+	field := func(name string) string {
+		value, _ := values[name].(string)
+		return value
+	}
+	result := Result{JobID: field("job_id"), Status: field("status"), Error: field("error")}
+	if result.JobID == "" {
+		return Result{}, fmt.Errorf("job_id is missing")
+	}
+	switch result.Status {
+	case StatusRunning, StatusCompleted, StatusFailed:
+		return result, nil
+	}
+	return Result{}, fmt.Errorf("unknown status %q", result.Status)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (Job, error) {
+	var job Job
+	err := row.Scan(&job.ID, &job.AssetID, &job.Analyzers, &job.Status, &job.Error, &job.RequestedBy,
+		&job.CollectionID, &job.CreatedAt, &job.UpdatedAt, &job.CompletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, err
+	}
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to scan re-analysis job: %v", err)
+	}
+	return job, nil
+}
@@ -0,0 +1,43 @@
+package reanalysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAnalyzers(t *testing.T) {
+	analyzers, err := ValidateAnalyzers([]string{"yolo_analyzer", " exif_analyzer", "yolo_analyzer"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"exif_analyzer", "yolo_analyzer"}, analyzers)
+
+	analyzers, err = ValidateAnalyzers(nil)
+	require.NoError(t, err)
+	assert.Empty(t, analyzers)
+
+	_, err = ValidateAnalyzers([]string{"Face Detection"})
+	assert.Error(t, err)
+	_, err = ValidateAnalyzers([]string{""})
+	assert.Error(t, err)
+	_, err = ValidateAnalyzers(make([]string, MaxAnalyzers+1))
+	assert.Error(t, err)
+}
+
+func TestParseResult(t *testing.T) {
+	result, err := parseResult(map[string]interface{}{"job_id": "job-1", "status": "failed", "error": "model crashed"})
+	require.NoError(t, err)
+	assert.Equal(t, Result{JobID: "job-1", Status: StatusFailed, Error: "model crashed"}, result)
+
+	_, err = parseResult(map[string]interface{}{"status": "completed"})
+	assert.Error(t, err)
+	_, err = parseResult(map[string]interface{}{"job_id": "job-1", "status": "queued"})
+	assert.Error(t, err)
+}
+
+func TestJobDone(t *testing.T) {
+	assert.False(t, Job{Status: StatusQueued}.Done())
+	assert.False(t, Job{Status: StatusRunning}.Done())
+	assert.True(t, Job{Status: StatusCompleted}.Done())
+	assert.True(t, Job{Status: StatusFailed}.Done())
+}
@@ -0,0 +1,77 @@
+package recommend
+
+import "sort"
+
+// Signals relating one collection to another
+const (
+	// SignalTags is how much the tags of their assets overlap
+	SignalTags = "shared_tags"
+	// SignalSimilarity is how strongly similarity edges link their assets
+	SignalSimilarity = "similarity"
+	// SignalCoSearch is how many users opened search results from both
+	SignalCoSearch = "co_search"
+)
+
+// CollectionCandidate is a collection related to another by one or more
+// signals
+type CollectionCandidate struct {
+	CollectionID string
+	// Signals holds the strength of each signal that found the collection,
+	// relative to the strongest collection that signal found
+	Signals map[string]float64
+	// Score blends the signals
+	Score float64
+}
+
+// BlendCollections scores the collections found by each signal, given as
+// raw strengths by collection. Each signal is scaled by the strongest
+// collection it found, then weighted by weights. Signals that found nothing
+// leave their weight to the others, so a collection nobody searched yet
+// still gets recommendations from its tags. Candidates are returned best
+// first.
+func BlendCollections(signals map[string]map[string]float64, weights map[string]float64) []CollectionCandidate {
+	total := 0.0
+	for signal, strengths := range signals {
+		if len(strengths) > 0 {
+			total += weights[signal]
+		}
+	}
+	if total == 0 {
+		return []CollectionCandidate{}
+	}
+
+	merged := map[string]*CollectionCandidate{}
+	for signal, strengths := range signals {
+		strongest := 0.0
+		for _, strength := range strengths {
+			if strength > strongest {
+				strongest = strength
+			}
+		}
+		if strongest <= 0 {
+			continue
+		}
+		for collectionID, strength := range strengths {
+			candidate, ok := merged[collectionID]
+			if !ok {
+				candidate = &CollectionCandidate{CollectionID: collectionID, Signals: map[string]float64{}}
+				merged[collectionID] = candidate
+			}
+			relative := strength / strongest
+			candidate.Signals[signal] = relative
+			candidate.Score += weights[signal] / total * relative
+		}
+	}
+
+	blended := make([]CollectionCandidate, 0, len(merged))
+	for _, candidate := range merged {
+		blended = append(blended, *candidate)
+	}
+	sort.Slice(blended, func(i, j int) bool {
+		if blended[i].Score != blended[j].Score {
+			return blended[i].Score > blended[j].Score
+		}
+		return blended[i].CollectionID < blended[j].CollectionID
+	})
+	return blended
+}
@@ -0,0 +1,172 @@
+package recommend
+
+import (
+	"sort"
+	"strings"
+)
+
+// mediaTypePrefixes maps the coarse media types used by the API to MIME prefixes
+var mediaTypePrefixes = map[string][]string{
+	"image":    {"image/"},
+	"video":    {"video/"},
+	"audio":    {"audio/"},
+	"document": {"application/", "text/"},
+}
+
+// Candidate is an asset recommended by graph similarity, vector similarity
+// or both
+type Candidate struct {
+	AssetID      string
+	MimeType     string
+	CollectionID string
+	Tags         []string
+	// Graph and Vector are the similarities each source found, zero when
+	// the source did not find the asset
+	Graph  float64
+	Vector float64
+	// Score blends Graph and Vector
+	Score float64
+}
+
+// ValidMediaType reports whether a media type can narrow recommendations
+func ValidMediaType(mediaType string) bool {
+	_, ok := mediaTypePrefixes[mediaType]
+	return ok
+}
+
+// MatchesMediaTypes reports whether a MIME type is of one of the media
+// types; no media types match everything
+func MatchesMediaTypes(mimeType string, mediaTypes []string) bool {
+	if len(mediaTypes) == 0 {
+		return true
+	}
+	for _, mediaType := range mediaTypes {
+		for _, prefix := range mediaTypePrefixes[mediaType] {
+			if strings.HasPrefix(mimeType, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Blend merges the graph and vector candidates by asset and scores each as
+// graphWeight times its graph similarity plus the rest times its vector
+// similarity. When one source found nothing, the other is scored alone, so
+// an asset not embedded yet still gets graph recommendations. Candidates
+// are returned best first.
+func Blend(graph, vector []Candidate, graphWeight float64) []Candidate {
+	if len(vector) == 0 {
+		graphWeight = 1
+	} else if len(graph) == 0 {
+		graphWeight = 0
+	}
+
+	merged := map[string]*Candidate{}
+	var order []string
+	// merge returns the asset's merged candidate, filling in what earlier
+	// sources did not know about it
+	merge := func(candidate Candidate) *Candidate {
+		existing, ok := merged[candidate.AssetID]
+		if !ok {
+			existing = &Candidate{AssetID: candidate.AssetID}
+			merged[candidate.AssetID] = existing
+			order = append(order, candidate.AssetID)
+		}
+		if existing.MimeType == "" {
+			existing.MimeType = candidate.MimeType
+		}
+		if existing.CollectionID == "" {
+			existing.CollectionID = candidate.CollectionID
+		}
+		if len(existing.Tags) == 0 {
+			existing.Tags = candidate.Tags
+		}
+		return existing
+	}
+	for _, candidate := range graph {
+		if existing := merge(candidate); candidate.Score > existing.Graph {
+			existing.Graph = candidate.Score
+		}
+	}
+	for _, candidate := range vector {
+		if existing := merge(candidate); candidate.Score > existing.Vector {
+			existing.Vector = candidate.Score
+		}
+	}
+
+	blended := make([]Candidate, 0, len(order))
+	for _, id := range order {
+		candidate := *merged[id]
+		candidate.Score = graphWeight*candidate.Graph + (1-graphWeight)*candidate.Vector
+		blended = append(blended, candidate)
+	}
+	sort.SliceStable(blended, func(i, j int) bool {
+		return blended[i].Score > blended[j].Score
+	})
+	return blended
+}
+
+// Diversify picks up to limit candidates by maximal marginal relevance: each
+// pick maximizes its score less diversity times its resemblance to the
+// candidates already picked. Diversity 0 keeps the ranking; 1 favors
+// assets unlike the ones above them over more similar ones.
+func Diversify(candidates []Candidate, diversity float64, limit int) []Candidate {
+	if limit > len(candidates) {
+		limit = len(candidates)
+	}
+	if diversity <= 0 {
+		return candidates[:limit]
+	}
+
+	remaining := append([]Candidate{}, candidates...)
+	picked := make([]Candidate, 0, limit)
+	for len(picked) < limit {
+		best, bestValue := 0, 0.0
+		for i, candidate := range remaining {
+			resemblance := 0.0
+			for _, chosen := range picked {
+				if r := resemble(candidate, chosen); r > resemblance {
+					resemblance = r
+				}
+			}
+			value := (1-diversity)*candidate.Score - diversity*resemblance
+			if i == 0 || value > bestValue {
+				best, bestValue = i, value
+			}
+		}
+		picked = append(picked, remaining[best])
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return picked
+}
+
+// resemble is the Jaccard similarity of two assets' media type, collection
+// and tags
+func resemble(a, b Candidate) float64 {
+	featuresA, featuresB := features(a), features(b)
+	if len(featuresA) == 0 && len(featuresB) == 0 {
+		return 0
+	}
+	shared := 0
+	for feature := range featuresA {
+		if featuresB[feature] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(featuresA)+len(featuresB)-shared)
+}
+
+func features(candidate Candidate) map[string]bool {
+	set := map[string]bool{}
+	if mediaType, _, _ := strings.Cut(candidate.MimeType, "/"); mediaType != "" {
+		set["media:"+mediaType] = true
+	}
+	if candidate.CollectionID != "" {
+		set["collection:"+candidate.CollectionID] = true
+	}
+	for _, tag := range candidate.Tags {
+		set["tag:"+strings.ToLower(tag)] = true
+	}
+	return set
+}
@@ -0,0 +1,82 @@
+package recommend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ids(candidates []Candidate) []string {
+	result := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		result[i] = candidate.AssetID
+	}
+	return result
+}
+
+func TestBlend(t *testing.T) {
+	graph := []Candidate{{AssetID: "a", Score: 0.9, Tags: []string{"harbour"}}, {AssetID: "b", Score: 0.6}}
+	vector := []Candidate{{AssetID: "b", Score: 0.9, MimeType: "video/mp4"}, {AssetID: "c", Score: 0.7}}
+
+	blended := Blend(graph, vector, 0.5)
+	assert.Equal(t, []string{"b", "a", "c"}, ids(blended))
+	assert.InDelta(t, 0.75, blended[0].Score, 1e-9)
+	assert.Equal(t, 0.6, blended[0].Graph)
+	assert.Equal(t, "video/mp4", blended[0].MimeType)
+	assert.Equal(t, []string{"harbour"}, blended[1].Tags)
+
+	// A source that found nothing does not halve the other's scores
+	alone := Blend(graph, nil, 0.5)
+	assert.Equal(t, 0.9, alone[0].Score)
+	alone = Blend(nil, vector, 0.5)
+	assert.Equal(t, 0.9, alone[0].Score)
+}
+
+func TestDiversify(t *testing.T) {
+	candidates := []Candidate{
+		{AssetID: "a", Score: 0.9, MimeType: "video/mp4", CollectionID: "c1", Tags: []string{"harbour"}},
+		{AssetID: "b", Score: 0.88, MimeType: "video/mp4", CollectionID: "c1", Tags: []string{"harbour"}},
+		{AssetID: "c", Score: 0.7, MimeType: "image/jpeg", CollectionID: "c2", Tags: []string{"crane"}},
+	}
+
+	assert.Equal(t, []string{"a", "b"}, ids(Diversify(candidates, 0, 2)))
+	assert.Equal(t, []string{"a", "c"}, ids(Diversify(candidates, 0.5, 2)))
+	assert.Len(t, Diversify(candidates, 0.5, 10), 3)
+}
+
+func TestMatchesMediaTypes(t *testing.T) {
+	assert.True(t, MatchesMediaTypes("video/mp4", nil))
+	assert.True(t, MatchesMediaTypes("text/plain", []string{"image", "document"}))
+	assert.False(t, MatchesMediaTypes("audio/mpeg", []string{"video"}))
+	assert.True(t, ValidMediaType("audio"))
+	assert.False(t, ValidMediaType("video/mp4"))
+}
+
+func TestBlendCollections(t *testing.T) {
+	weights := map[string]float64{SignalTags: 1, SignalSimilarity: 1, SignalCoSearch: 2}
+	blended := BlendCollections(map[string]map[string]float64{
+		SignalTags:       {"harbours": 0.5, "cranes": 0.25},
+		SignalSimilarity: {"harbours": 12, "ships": 3},
+		SignalCoSearch:   {},
+	}, weights)
+
+	require.Len(t, blended, 3)
+	assert.Equal(t, "harbours", blended[0].CollectionID)
+	assert.InDelta(t, 1.0, blended[0].Score, 1e-9)
+	assert.Equal(t, map[string]float64{SignalTags: 1, SignalSimilarity: 1}, blended[0].Signals)
+	assert.Equal(t, "cranes", blended[1].CollectionID)
+	assert.InDelta(t, 0.25, blended[1].Score, 1e-9)
+	assert.Equal(t, "ships", blended[2].CollectionID)
+	assert.InDelta(t, 0.125, blended[2].Score, 1e-9)
+
+	// Co-searches count double once they find anything
+	blended = BlendCollections(map[string]map[string]float64{
+		SignalTags:     {"cranes": 1},
+		SignalCoSearch: {"ships": 40},
+	}, weights)
+	assert.Equal(t, "ships", blended[0].CollectionID)
+	assert.InDelta(t, 2.0/3, blended[0].Score, 1e-9)
+
+	assert.Empty(t, BlendCollections(map[string]map[string]float64{SignalTags: {}}, weights))
+}
@@ -0,0 +1,79 @@
+package related
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"dataflux/query-service/pkg/analytics"
+	"dataflux/query-service/pkg/clickhouse"
+)
+
+// CollectionUsers is a collection whose search results were opened by users
+// who also opened results from another collection
+type CollectionUsers struct {
+	CollectionID string `json:"collection_id"`
+	// Users is how many distinct users opened results from both in the window
+	Users int `json:"users"`
+}
+
+// CoSearchedCollections returns up to limit collections whose search results
+// were opened by the users who opened results from collectionID, most
+// shared users first. Like related queries, a collection is only returned
+// once minUsers distinct users opened results from both.
+func (f *Finder) CoSearchedCollections(ctx context.Context, collectionID string, limit int) ([]CollectionUsers, error) {
+	if !f.client.Enabled() {
+		return nil, ErrDisabled
+	}
+	table, err := f.client.Table(analytics.ClickTable)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := f.client.Exec(ctx, fmt.Sprintf(`
+		SELECT collection_id, uniqExact(user_id) AS users
+		FROM %s
+		WHERE timestamp >= {since:DateTime('UTC')} AND user_id != '' AND source = {source:String}
+		  AND collection_id != '' AND collection_id != {collection:String}
+		  AND user_id IN (
+		    SELECT user_id FROM %[1]s
+		    WHERE timestamp >= {since:DateTime('UTC')} AND source = {source:String}
+		      AND collection_id = {collection:String}
+		  )
+		GROUP BY collection_id
+		HAVING users >= {min_users:UInt32}
+		ORDER BY users DESC, collection_id
+		LIMIT {limit:UInt32}
+		FORMAT JSON`, table), map[string]string{
+		"collection": collectionID,
+		"source":     analytics.ClickSearch,
+		"since":      time.Now().UTC().Add(-f.window).Format("2006-01-02 15:04:05"),
+		"min_users":  strconv.Itoa(f.minUsers),
+		"limit":      strconv.Itoa(limit),
+	})
+	if clickhouse.IsUnknownTable(err) {
+		// No click has been recorded yet
+		return []CollectionUsers{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query click log: %v", err)
+	}
+
+	var result struct {
+		Data []struct {
+			CollectionID string      `json:"collection_id"`
+			Users        json.Number `json:"users"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode click log result: %v", err)
+	}
+	collections := make([]CollectionUsers, 0, len(result.Data))
+	for _, row := range result.Data {
+		users, _ := row.Users.Int64()
+		collections = append(collections, CollectionUsers{CollectionID: row.CollectionID, Users: int(users)})
+	}
+	return collections, nil
+}
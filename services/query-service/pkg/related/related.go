@@ -0,0 +1,225 @@
+package related
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/analytics"
+	"dataflux/query-service/pkg/cache"
+	"dataflux/query-service/pkg/clickhouse"
+	"dataflux/query-service/pkg/taxonomy"
+)
+
+// Suggestion sources
+const (
+	// SourceCoSearch marks queries run by the users who also ran the query
+	SourceCoSearch = "co_search"
+	// SourceTaxonomy marks queries for terms next to the query in the taxonomy
+	SourceTaxonomy = "taxonomy"
+)
+
+// taxonomyWeight scales taxonomy suggestions below co-searches, which
+// reflect what users actually looked for next
+const taxonomyWeight = 0.5
+
+// ErrDisabled is returned when no ClickHouse URL is configured
+var ErrDisabled = errors.New("clickhouse is not configured")
+
+// Suggestion is a related search other users ran
+type Suggestion struct {
+	Query string  `json:"query"`
+	Score float64 `json:"score"`
+	// Users is how many distinct users ran the query in the window
+	Users   int      `json:"users"`
+	Sources []string `json:"sources"`
+}
+
+// Expander walks the taxonomy graph
+type Expander interface {
+	Expand(labels []string, direction taxonomy.Direction, depth int) ([]string, error)
+}
+
+// Finder suggests related queries from the search log in ClickHouse and the
+// taxonomy graph
+type Finder struct {
+	client   *clickhouse.Client
+	taxonomy Expander
+	window   time.Duration
+	minUsers int
+}
+
+// NewFinder creates a finder over the searches of the last window. A query is
+// only suggested once minUsers distinct users ran it, so rare and possibly
+// personal searches are never shown to others. expander may be nil.
+func NewFinder(client *clickhouse.Client, expander Expander, window time.Duration, minUsers int) *Finder {
+	return &Finder{client: client, taxonomy: expander, window: window, minUsers: minUsers}
+}
+
+// Related returns up to limit queries related to query, best first
+func (f *Finder) Related(ctx context.Context, query string, limit int) ([]Suggestion, error) {
+	if !f.client.Enabled() {
+		return nil, ErrDisabled
+	}
+	normalized := cache.NormalizeText(query)
+	if normalized == "" {
+		return []Suggestion{}, nil
+	}
+	table, err := f.client.Table(analytics.SearchTable)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{
+		"q":         normalized,
+		"since":     time.Now().UTC().Add(-f.window).Format("2006-01-02 15:04:05"),
+		"min_users": strconv.Itoa(f.minUsers),
+		"limit":     strconv.Itoa(limit),
+	}
+
+	// Queries run by the users who also ran this one
+	coSearches, err := f.counts(ctx, fmt.Sprintf(`
+		SELECT %[2]s AS normalized, uniqExact(user_id) AS users
+		FROM %[1]s
+		WHERE timestamp >= {since:DateTime('UTC')} AND user_id != ''
+		  AND normalized != {q:String}
+		  AND user_id IN (
+		    SELECT user_id FROM %[1]s
+		    WHERE timestamp >= {since:DateTime('UTC')} AND %[2]s = {q:String}
+		  )
+		GROUP BY normalized
+		HAVING users >= {min_users:UInt32}
+		ORDER BY users DESC, normalized
+		LIMIT {limit:UInt32}`, table, analytics.NormalizedQuery), params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Logged queries for the terms next to this one in the taxonomy
+	var taxonomySearches map[string]int
+	if terms := f.relatedTerms(normalized); len(terms) > 0 {
+		params["terms"] = clickhouse.ArrayParam(terms)
+		taxonomySearches, err = f.counts(ctx, fmt.Sprintf(`
+			SELECT %[2]s AS normalized, uniqExact(user_id) AS users
+			FROM %[1]s
+			WHERE timestamp >= {since:DateTime('UTC')} AND user_id != ''
+			  AND normalized IN {terms:Array(String)}
+			GROUP BY normalized
+			HAVING users >= {min_users:UInt32}`, table, analytics.NormalizedQuery), params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return Merge(coSearches, taxonomySearches, limit), nil
+}
+
+// relatedTerms returns the labels and synonyms of the terms one hop from the
+// query or its words, without the query itself. Taxonomy failures only cost
+// the taxonomy suggestions.
+func (f *Finder) relatedTerms(normalized string) []string {
+	if f.taxonomy == nil {
+		return nil
+	}
+	labels := []string{normalized}
+	if words := strings.Fields(normalized); len(words) > 1 {
+		labels = append(labels, words...)
+	}
+
+	expanded, err := f.taxonomy.Expand(labels, taxonomy.DirectionBoth, 1)
+	if err != nil {
+		log.Printf("Warning: taxonomy expansion for related queries failed: %v", err)
+		return nil
+	}
+
+	inputs := map[string]bool{}
+	for _, label := range labels {
+		inputs[label] = true
+	}
+	terms := make([]string, 0, len(expanded))
+	for _, term := range expanded {
+		if !inputs[term] {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func (f *Finder) counts(ctx context.Context, statement string, params map[string]string) (map[string]int, error) {
+	body, err := f.client.Exec(ctx, statement+" FORMAT JSON", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query search log: %v", err)
+	}
+
+	var result struct {
+		Data []struct {
+			Normalized string      `json:"normalized"`
+			Users      json.Number `json:"users"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode search log result: %v", err)
+	}
+
+	counts := make(map[string]int, len(result.Data))
+	for _, row := range result.Data {
+		users, _ := row.Users.Int64()
+		counts[row.Normalized] = int(users)
+	}
+	return counts, nil
+}
+
+// Merge scores co-searches by their share of the most common one and
+// taxonomy searches at taxonomyWeight of that; a query found both ways adds
+// both scores
+func Merge(coSearches, taxonomySearches map[string]int, limit int) []Suggestion {
+	maxUsers := 1
+	for _, counts := range []map[string]int{coSearches, taxonomySearches} {
+		for _, users := range counts {
+			if users > maxUsers {
+				maxUsers = users
+			}
+		}
+	}
+
+	byQuery := map[string]*Suggestion{}
+	add := func(query string, users int, source string, weight float64) {
+		suggestion, ok := byQuery[query]
+		if !ok {
+			suggestion = &Suggestion{Query: query}
+			byQuery[query] = suggestion
+		}
+		if users > suggestion.Users {
+			suggestion.Users = users
+		}
+		suggestion.Score += weight * float64(users) / float64(maxUsers)
+		suggestion.Sources = append(suggestion.Sources, source)
+	}
+	for query, users := range coSearches {
+		add(query, users, SourceCoSearch, 1)
+	}
+	for query, users := range taxonomySearches {
+		add(query, users, SourceTaxonomy, taxonomyWeight)
+	}
+
+	suggestions := make([]Suggestion, 0, len(byQuery))
+	for _, suggestion := range byQuery {
+		suggestions = append(suggestions, *suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Query < suggestions[j].Query
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
@@ -0,0 +1,116 @@
+package related
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dataflux/query-service/pkg/clickhouse"
+	"dataflux/query-service/pkg/taxonomy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeExpander struct {
+	terms []string
+	err   error
+}
+
+func (f fakeExpander) Expand(labels []string, direction taxonomy.Direction, depth int) ([]string, error) {
+	return append(labels, f.terms...), f.err
+}
+
+func TestMerge(t *testing.T) {
+	suggestions := Merge(
+		map[string]int{"sunset beach": 10, "surfing": 4},
+		map[string]int{"coast": 6, "surfing": 4},
+		3,
+	)
+
+	require.Len(t, suggestions, 3)
+	assert.Equal(t, "sunset beach", suggestions[0].Query)
+	assert.Equal(t, 1.0, suggestions[0].Score)
+	assert.Equal(t, "surfing", suggestions[1].Query)
+	assert.InDelta(t, 0.6, suggestions[1].Score, 1e-9)
+	assert.Equal(t, []string{SourceCoSearch, SourceTaxonomy}, suggestions[1].Sources)
+	assert.Equal(t, "coast", suggestions[2].Query)
+}
+
+func TestRelatedQueriesLogAndTaxonomy(t *testing.T) {
+	var statements []string
+	var params []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		statement := string(body)
+		statements = append(statements, statement)
+		params = append(params, r.URL.Query().Get("param_q"), r.URL.Query().Get("param_terms"))
+		if strings.Contains(statement, "{terms:Array(String)}") {
+			w.Write([]byte(`{"data":[{"normalized":"coast","users":"5"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":[{"normalized":"sunset","users":"8"}]}`))
+	}))
+	defer server.Close()
+
+	finder := NewFinder(clickhouse.NewClient(server.URL, "", "", "dataflux"), fakeExpander{terms: []string{"coast"}}, 0, 3)
+	suggestions, err := finder.Related(context.Background(), "  Beach ", 5)
+	require.NoError(t, err)
+
+	require.Len(t, statements, 2)
+	assert.Contains(t, statements[0], "FROM dataflux.search_events")
+	assert.Equal(t, "beach", params[0])
+	assert.Equal(t, "['coast']", params[3])
+	require.Len(t, suggestions, 2)
+	assert.Equal(t, "sunset", suggestions[0].Query)
+	assert.Equal(t, "coast", suggestions[1].Query)
+	assert.Equal(t, 5, suggestions[1].Users)
+}
+
+func TestRelatedQueriesWithoutTaxonomy(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer server.Close()
+
+	finder := NewFinder(clickhouse.NewClient(server.URL, "", "", "dataflux"), fakeExpander{err: errors.New("neo4j down")}, 0, 3)
+	suggestions, err := finder.Related(context.Background(), "beach", 5)
+	require.NoError(t, err)
+	assert.Empty(t, suggestions)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRelatedQueriesDisabled(t *testing.T) {
+	finder := NewFinder(clickhouse.NewClient("", "", "", "dataflux"), nil, 0, 3)
+	_, err := finder.Related(context.Background(), "beach", 5)
+	assert.ErrorIs(t, err, ErrDisabled)
+}
+
+func TestCoSearchedCollections(t *testing.T) {
+	var statement string
+	var collection, source string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		statement = string(body)
+		collection, source = r.URL.Query().Get("param_collection"), r.URL.Query().Get("param_source")
+		w.Write([]byte(`{"data":[{"collection_id":"harbours","users":"7"}]}`))
+	}))
+	defer server.Close()
+
+	finder := NewFinder(clickhouse.NewClient(server.URL, "", "", "dataflux"), nil, 0, 3)
+	collections, err := finder.CoSearchedCollections(context.Background(), "docks", 5)
+	require.NoError(t, err)
+	assert.Equal(t, []CollectionUsers{{CollectionID: "harbours", Users: 7}}, collections)
+	assert.Contains(t, statement, "FROM dataflux.click_events")
+	assert.Equal(t, "docks", collection)
+	assert.Equal(t, "search", source)
+
+	_, err = NewFinder(clickhouse.NewClient("", "", "", "dataflux"), nil, 0, 3).CoSearchedCollections(context.Background(), "docks", 5)
+	assert.ErrorIs(t, err, ErrDisabled)
+}
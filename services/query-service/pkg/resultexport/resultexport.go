@@ -0,0 +1,127 @@
+package resultexport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"dataflux/query-service/pkg/projection"
+)
+
+// Formats results can be exported in
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ContentTypes are the response content types of the formats
+var ContentTypes = map[string]string{
+	FormatCSV:    "text/csv; charset=utf-8",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+// Writer writes records, one row or line each. A record is a result's
+// metadata with its id, type and score alongside; columns pick values
+// from it by key or dot path.
+type Writer interface {
+	Write(record map[string]interface{}) error
+	// Flush sends the rows written so far on to the underlying writer
+	Flush() error
+}
+
+// NewWriter creates a writer for format. The CSV header is written
+// before the first row, or on the first flush when there are no rows.
+func NewWriter(w io.Writer, format string, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{csv: csv.NewWriter(w), columns: columns}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w), columns: columns}, nil
+	}
+	return nil, fmt.Errorf("format must be %s or %s", FormatCSV, FormatNDJSON)
+}
+
+type csvWriter struct {
+	csv     *csv.Writer
+	columns []string
+	started bool
+}
+
+func (w *csvWriter) Write(record map[string]interface{}) error {
+	if err := w.header(); err != nil {
+		return err
+	}
+	row := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		if value, ok := projection.Lookup(record, column); ok {
+			row[i] = Cell(value)
+		}
+	}
+	return w.csv.Write(row)
+}
+
+func (w *csvWriter) Flush() error {
+	if err := w.header(); err != nil {
+		return err
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// header writes the column names once
+func (w *csvWriter) header() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	return w.csv.Write(w.columns)
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+	columns []string
+}
+
+// Write encodes the record as an object keyed by column, leaving out the
+// columns it has no value for
+func (w *ndjsonWriter) Write(record map[string]interface{}) error {
+	line := make(map[string]interface{}, len(w.columns))
+	for _, column := range w.columns {
+		if value, ok := projection.Lookup(record, column); ok {
+			line[column] = value
+		}
+	}
+	return w.encoder.Encode(line)
+}
+
+// Flush has nothing to do; every line goes straight to the writer
+func (w *ndjsonWriter) Flush() error {
+	return nil
+}
+
+// Cell formats a value for a CSV cell: strings as they are, times in
+// RFC 3339, numbers without exponents and anything else as JSON
+func Cell(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case time.Time:
+		return value.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
+	case int, int32, int64, bool:
+		return fmt.Sprint(value)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
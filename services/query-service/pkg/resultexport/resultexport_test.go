@@ -0,0 +1,44 @@
+package resultexport
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, FormatCSV, []string{"id", "score", "filename", "tags", "preview.url"})
+	require.NoError(t, err)
+
+	require.NoError(t, w.Write(map[string]interface{}{"id": "asset-1", "score": 0.5, "filename": "dock, night.mp4", "tags": []string{"crane"}, "preview": map[string]interface{}{"url": "https://cdn/s.jpg"}}))
+	require.NoError(t, w.Write(map[string]interface{}{"id": "asset-2", "score": 1e-7}))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "id,score,filename,tags,preview.url\n"+
+		"asset-1,0.5,\"dock, night.mp4\",\"[\"\"crane\"\"]\",https://cdn/s.jpg\n"+
+		"asset-2,0.0000001,,,\n", out.String())
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, FormatNDJSON, []string{"id", "preview.url"})
+	require.NoError(t, err)
+
+	require.NoError(t, w.Write(map[string]interface{}{"id": "asset-1", "preview": map[string]interface{}{"url": "https://cdn/s.jpg"}}))
+	require.NoError(t, w.Write(map[string]interface{}{"id": "asset-2"}))
+	assert.Equal(t, "{\"id\":\"asset-1\",\"preview.url\":\"https://cdn/s.jpg\"}\n{\"id\":\"asset-2\"}\n", out.String())
+
+	_, err = NewWriter(&out, "xlsx", nil)
+	assert.Error(t, err)
+}
+
+func TestCell(t *testing.T) {
+	assert.Equal(t, "", Cell(nil))
+	assert.Equal(t, "42", Cell(42))
+	assert.Equal(t, "true", Cell(true))
+	assert.Equal(t, "2024-05-01T12:00:00Z", Cell(time.Date(2024, 5, 1, 14, 0, 0, 0, time.FixedZone("CEST", 7200))))
+	assert.Equal(t, `{"a":1}`, Cell(map[string]interface{}{"a": 1}))
+}
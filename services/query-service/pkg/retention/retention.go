@@ -0,0 +1,443 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// DefaultScope is the collection id of policies that cover every collection
+// without a policy of its own
+const DefaultScope = "*"
+
+// Item outcome values
+const (
+	StatusDeleted   = "deleted"
+	StatusScheduled = "scheduled"
+	StatusDryRun    = "dry_run"
+	StatusSkipped   = "skipped"
+	StatusFailed    = "failed"
+)
+
+// lockKey makes sure only one replica runs the scheduled cleanup at a time
+const lockKey = "retention:cleanup:lock"
+
+// Policy keeps rows of one dataset for RetentionDays in one collection
+type Policy struct {
+	CollectionID  string    `json:"collection_id"`
+	Dataset       string    `json:"dataset"`
+	RetentionDays int       `json:"retention_days"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Scope selects the rows a policy applies to. A default policy has no
+// CollectionID and excludes the collections that have their own policy.
+type Scope struct {
+	CollectionID string
+	Exclude      []string
+}
+
+// Outcome is what a target matched and removed for one policy
+type Outcome struct {
+	Status  string
+	Matched int64
+	Deleted int64
+	Detail  string
+}
+
+// Target removes expired rows of one dataset
+type Target interface {
+	// Expire counts rows older than cutoff in scope and, unless dryRun, deletes them
+	Expire(ctx context.Context, scope Scope, cutoff time.Time, dryRun bool) (Outcome, error)
+}
+
+// Item is the report line for one policy
+type Item struct {
+	Dataset       string    `json:"dataset"`
+	CollectionID  string    `json:"collection_id"`
+	RetentionDays int       `json:"retention_days"`
+	Cutoff        time.Time `json:"cutoff"`
+	Status        string    `json:"status"`
+	Matched       int64     `json:"matched"`
+	Deleted       int64     `json:"deleted"`
+	Detail        string    `json:"detail,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Report summarizes one cleanup run
+type Report struct {
+	DryRun     bool      `json:"dry_run"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Failed     int       `json:"failed"`
+	Items      []Item    `json:"items"`
+}
+
+// Manager stores retention policies and enforces them
+type Manager struct {
+	pool     *pgxpool.Pool
+	redis    *redis.Client
+	targets  map[string]Target
+	instance string
+
+	mu         sync.RWMutex
+	lastReport *Report
+}
+
+// NewManager creates a manager for the given datasets
+func NewManager(pool *pgxpool.Pool, redisClient *redis.Client, targets map[string]Target) *Manager {
+	instance, _ := os.Hostname()
+	return &Manager{
+		pool:     pool,
+		redis:    redisClient,
+		targets:  targets,
+		instance: instance,
+	}
+}
+
+// EnsureSchema creates the policy table if it does not exist
+func (m *Manager) EnsureSchema(ctx context.Context) error {
+	_, err := m.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS retention_policies (
+			collection_id VARCHAR(255) NOT NULL,
+			dataset VARCHAR(50) NOT NULL,
+			retention_days INTEGER NOT NULL CHECK (retention_days > 0),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (collection_id, dataset)
+		)
+	`)
+	return err
+}
+
+// Datasets returns the names of the datasets policies can target
+func (m *Manager) Datasets() []string {
+	names := make([]string, 0, len(m.targets))
+	for name := range m.targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate rejects policies for unknown datasets or without a positive retention
+func (m *Manager) Validate(policy Policy) error {
+	if _, ok := m.targets[policy.Dataset]; !ok {
+		return fmt.Errorf("unknown dataset %q, expected one of %s", policy.Dataset, strings.Join(m.Datasets(), ", "))
+	}
+	if policy.CollectionID == "" {
+		return fmt.Errorf("collection_id is required, use %q for the default policy", DefaultScope)
+	}
+	if policy.RetentionDays <= 0 {
+		return fmt.Errorf("retention_days must be positive")
+	}
+	return nil
+}
+
+// ListPolicies returns every configured policy
+func (m *Manager) ListPolicies(ctx context.Context) ([]Policy, error) {
+	rows, err := m.pool.Query(ctx, `
+		SELECT collection_id, dataset, retention_days, updated_at
+		FROM retention_policies
+		ORDER BY dataset, collection_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list retention policies: %v", err)
+	}
+	defer rows.Close()
+
+	policies := []Policy{}
+	for rows.Next() {
+		var policy Policy
+		if err := rows.Scan(&policy.CollectionID, &policy.Dataset, &policy.RetentionDays, &policy.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan retention policy: %v", err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, rows.Err()
+}
+
+// PutPolicy creates or replaces a policy
+func (m *Manager) PutPolicy(ctx context.Context, policy Policy) (Policy, error) {
+	if err := m.Validate(policy); err != nil {
+		return Policy{}, err
+	}
+
+	err := m.pool.QueryRow(ctx, `
+		INSERT INTO retention_policies (collection_id, dataset, retention_days)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (collection_id, dataset) DO UPDATE
+		SET retention_days = EXCLUDED.retention_days, updated_at = NOW()
+		RETURNING updated_at
+	`, policy.CollectionID, policy.Dataset, policy.RetentionDays).Scan(&policy.UpdatedAt)
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to store retention policy: %v", err)
+	}
+	return policy, nil
+}
+
+// DeletePolicy removes a policy; it reports whether one existed
+func (m *Manager) DeletePolicy(ctx context.Context, collectionID, dataset string) (bool, error) {
+	tag, err := m.pool.Exec(ctx, `DELETE FROM retention_policies WHERE collection_id = $1 AND dataset = $2`, collectionID, dataset)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete retention policy: %v", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// LastReport returns the report of the most recent run, if any
+func (m *Manager) LastReport() *Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastReport
+}
+
+// Run applies every policy once. With dryRun set nothing is deleted and the
+// report only shows how many rows each policy would remove.
+func (m *Manager) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	policies, err := m.ListPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		DryRun:    dryRun,
+		StartedAt: time.Now().UTC(),
+		Items:     make([]Item, 0, len(policies)),
+	}
+
+	for _, policy := range policies {
+		item := m.apply(ctx, policy, Scope{CollectionID: policy.CollectionID, Exclude: overridden(policies, policy)}, report.StartedAt, dryRun)
+		if item.Status == StatusFailed {
+			report.Failed++
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	m.mu.Lock()
+	m.lastReport = report
+	m.mu.Unlock()
+	return report, nil
+}
+
+func (m *Manager) apply(ctx context.Context, policy Policy, scope Scope, now time.Time, dryRun bool) Item {
+	cutoff := Cutoff(now, policy.RetentionDays)
+	item := Item{
+		Dataset:       policy.Dataset,
+		CollectionID:  policy.CollectionID,
+		RetentionDays: policy.RetentionDays,
+		Cutoff:        cutoff,
+	}
+
+	target, ok := m.targets[policy.Dataset]
+	if !ok {
+		item.Status = StatusSkipped
+		item.Detail = "dataset is not configured on this service"
+		return item
+	}
+	if scope.CollectionID == DefaultScope {
+		scope.CollectionID = ""
+	}
+
+	outcome, err := target.Expire(ctx, scope, cutoff, dryRun)
+	if err != nil {
+		item.Status = StatusFailed
+		item.Error = err.Error()
+		return item
+	}
+	item.Status = outcome.Status
+	item.Matched = outcome.Matched
+	item.Deleted = outcome.Deleted
+	item.Detail = outcome.Detail
+	return item
+}
+
+// overridden lists the collections with their own policy for the dataset of a
+// default policy, so the default does not shorten a longer per-collection retention
+func overridden(policies []Policy, policy Policy) []string {
+	if policy.CollectionID != DefaultScope {
+		return nil
+	}
+	var exclude []string
+	for _, other := range policies {
+		if other.Dataset == policy.Dataset && other.CollectionID != DefaultScope {
+			exclude = append(exclude, other.CollectionID)
+		}
+	}
+	return exclude
+}
+
+// Cutoff returns the instant before which rows are expired
+func Cutoff(now time.Time, retentionDays int) time.Time {
+	return now.UTC().AddDate(0, 0, -retentionDays)
+}
+
+// Start runs the cleanup every interval until ctx is cancelled. Replicas
+// share a Redis lock so only one of them runs each cycle.
+func (m *Manager) Start(ctx context.Context, interval time.Duration, dryRun bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.runScheduled(ctx, interval, dryRun)
+			}
+		}
+	}()
+}
+
+func (m *Manager) runScheduled(ctx context.Context, interval time.Duration, dryRun bool) {
+	acquired, err := m.redis.SetNX(ctx, lockKey, m.instance, interval/2).Result()
+	if err != nil {
+		log.Printf("Warning: retention lock failed: %v", err)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	report, err := m.Run(ctx, dryRun)
+	if err != nil {
+		log.Printf("Warning: retention cleanup failed: %v", err)
+		return
+	}
+	for _, item := range report.Items {
+		log.Printf("Retention %s collection=%s dataset=%s cutoff=%s matched=%d deleted=%d %s%s",
+			item.Status, item.CollectionID, item.Dataset, item.Cutoff.Format(time.RFC3339),
+			item.Matched, item.Deleted, item.Detail, item.Error)
+	}
+}
+
+// PostgresTarget expires rows of a PostgreSQL table
+type PostgresTarget struct {
+	pool             *pgxpool.Pool
+	table            string
+	timeColumn       string
+	collectionColumn string
+}
+
+// NewPostgresTarget creates a target for table; the names are trusted configuration
+func NewPostgresTarget(pool *pgxpool.Pool, table, timeColumn, collectionColumn string) *PostgresTarget {
+	return &PostgresTarget{pool: pool, table: table, timeColumn: timeColumn, collectionColumn: collectionColumn}
+}
+
+// Expire implements Target
+func (t *PostgresTarget) Expire(ctx context.Context, scope Scope, cutoff time.Time, dryRun bool) (Outcome, error) {
+	// The tables belong to other services and may not exist in every deployment
+	var exists bool
+	if err := t.pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, t.table).Scan(&exists); err != nil {
+		return Outcome{}, fmt.Errorf("failed to check table %s: %v", t.table, err)
+	}
+	if !exists {
+		return Outcome{Status: StatusSkipped, Detail: "table does not exist"}, nil
+	}
+
+	where, args := t.where(scope, cutoff)
+	if dryRun {
+		var matched int64
+		err := t.pool.QueryRow(ctx, fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, t.table, where), args...).Scan(&matched)
+		if err != nil {
+			return Outcome{}, fmt.Errorf("failed to count expired rows in %s: %v", t.table, err)
+		}
+		return Outcome{Status: StatusDryRun, Matched: matched}, nil
+	}
+
+	tag, err := t.pool.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s`, t.table, where), args...)
+	if err != nil {
+		return Outcome{}, fmt.Errorf("failed to delete expired rows in %s: %v", t.table, err)
+	}
+	return Outcome{Status: StatusDeleted, Matched: tag.RowsAffected(), Deleted: tag.RowsAffected()}, nil
+}
+
+func (t *PostgresTarget) where(scope Scope, cutoff time.Time) (string, []interface{}) {
+	clauses := []string{fmt.Sprintf("%s < $1", t.timeColumn)}
+	args := []interface{}{cutoff}
+
+	if scope.CollectionID != "" {
+		args = append(args, scope.CollectionID)
+		clauses = append(clauses, fmt.Sprintf("%s::text = $%d", t.collectionColumn, len(args)))
+	} else if len(scope.Exclude) > 0 {
+		args = append(args, scope.Exclude)
+		clauses = append(clauses, fmt.Sprintf("(%s IS NULL OR NOT %s::text = ANY($%d))", t.collectionColumn, t.collectionColumn, len(args)))
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+// ClickHouseTarget expires rows of a ClickHouse table with a delete mutation
+type ClickHouseTarget struct {
+	client           *clickhouse.Client
+	table            string
+	timeColumn       string
+	collectionColumn string
+}
+
+// NewClickHouseTarget creates a target for table; the names are trusted configuration
+func NewClickHouseTarget(client *clickhouse.Client, table, timeColumn, collectionColumn string) *ClickHouseTarget {
+	return &ClickHouseTarget{client: client, table: table, timeColumn: timeColumn, collectionColumn: collectionColumn}
+}
+
+// Expire implements Target. Mutations run asynchronously in ClickHouse, so
+// deleted rows are reported as scheduled.
+func (t *ClickHouseTarget) Expire(ctx context.Context, scope Scope, cutoff time.Time, dryRun bool) (Outcome, error) {
+	if !t.client.Enabled() {
+		return Outcome{Status: StatusSkipped, Detail: "clickhouse not configured"}, nil
+	}
+	table, err := t.client.Table(t.table)
+	if err != nil {
+		return Outcome{}, err
+	}
+
+	where, params := t.where(scope, cutoff)
+	body, err := t.client.Exec(ctx, fmt.Sprintf("SELECT count() FROM %s WHERE %s", table, where), params)
+	if err != nil {
+		if clickhouse.IsUnknownTable(err) {
+			return Outcome{Status: StatusSkipped, Detail: "table does not exist"}, nil
+		}
+		return Outcome{}, fmt.Errorf("failed to count expired rows in %s: %v", t.table, err)
+	}
+	matched, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+	if err != nil {
+		return Outcome{}, fmt.Errorf("unexpected count from %s: %q", t.table, body)
+	}
+
+	if dryRun {
+		return Outcome{Status: StatusDryRun, Matched: matched}, nil
+	}
+	if matched == 0 {
+		return Outcome{Status: StatusDeleted}, nil
+	}
+
+	if _, err := t.client.Exec(ctx, fmt.Sprintf("ALTER TABLE %s DELETE WHERE %s", table, where), params); err != nil {
+		return Outcome{}, fmt.Errorf("failed to delete expired rows in %s: %v", t.table, err)
+	}
+	return Outcome{Status: StatusScheduled, Matched: matched, Deleted: matched, Detail: "mutation submitted"}, nil
+}
+
+func (t *ClickHouseTarget) where(scope Scope, cutoff time.Time) (string, map[string]string) {
+	clauses := []string{fmt.Sprintf("%s < {cutoff:DateTime('UTC')}", t.timeColumn)}
+	params := map[string]string{"cutoff": cutoff.UTC().Format("2006-01-02 15:04:05")}
+
+	if scope.CollectionID != "" {
+		clauses = append(clauses, fmt.Sprintf("%s = {collection:String}", t.collectionColumn))
+		params["collection"] = scope.CollectionID
+	} else if len(scope.Exclude) > 0 {
+		clauses = append(clauses, fmt.Sprintf("%s NOT IN {exclude:Array(String)}", t.collectionColumn))
+		params["exclude"] = clickhouse.ArrayParam(scope.Exclude)
+	}
+	return strings.Join(clauses, " AND "), params
+}
@@ -0,0 +1,75 @@
+package retention
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverriddenExcludesCollectionsWithOwnPolicy(t *testing.T) {
+	policies := []Policy{
+		{CollectionID: DefaultScope, Dataset: "history", RetentionDays: 30},
+		{CollectionID: "legal", Dataset: "history", RetentionDays: 365},
+		{CollectionID: "marketing", Dataset: "search_logs", RetentionDays: 7},
+	}
+
+	assert.Equal(t, []string{"legal"}, overridden(policies, policies[0]))
+	assert.Nil(t, overridden(policies, policies[1]))
+}
+
+func TestCutoff(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), Cutoff(now, 30))
+}
+
+func TestPostgresWhere(t *testing.T) {
+	target := NewPostgresTarget(nil, "search_history", "created_at", "collection_id")
+	cutoff := time.Now()
+
+	where, args := target.where(Scope{CollectionID: "legal"}, cutoff)
+	assert.Equal(t, "created_at < $1 AND collection_id::text = $2", where)
+	assert.Equal(t, []interface{}{cutoff, "legal"}, args)
+
+	where, args = target.where(Scope{Exclude: []string{"legal"}}, cutoff)
+	assert.Equal(t, "created_at < $1 AND (collection_id IS NULL OR NOT collection_id::text = ANY($2))", where)
+	assert.Len(t, args, 2)
+
+	where, _ = target.where(Scope{}, cutoff)
+	assert.Equal(t, "created_at < $1", where)
+}
+
+func TestClickHouseDryRunOnlyCounts(t *testing.T) {
+	var statements []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		statements = append(statements, string(body))
+		assert.Equal(t, "['legal']", r.URL.Query().Get("param_exclude"))
+		w.Write([]byte("12\n"))
+	}))
+	defer server.Close()
+
+	client := clickhouse.NewClient(server.URL, "", "", "dataflux")
+	target := NewClickHouseTarget(client, "search_events", "timestamp", "collection_id")
+
+	outcome, err := target.Expire(context.Background(), Scope{Exclude: []string{"legal"}}, time.Now(), true)
+	require.NoError(t, err)
+	assert.Equal(t, StatusDryRun, outcome.Status)
+	assert.Equal(t, int64(12), outcome.Matched)
+	require.Len(t, statements, 1)
+	assert.Equal(t, "SELECT count() FROM dataflux.search_events WHERE timestamp < {cutoff:DateTime('UTC')} AND collection_id NOT IN {exclude:Array(String)}", statements[0])
+
+	outcome, err = target.Expire(context.Background(), Scope{Exclude: []string{"legal"}}, time.Now(), false)
+	require.NoError(t, err)
+	assert.Equal(t, StatusScheduled, outcome.Status)
+	require.Len(t, statements, 3)
+	assert.True(t, strings.HasPrefix(statements[2], "ALTER TABLE dataflux.search_events DELETE WHERE"))
+}
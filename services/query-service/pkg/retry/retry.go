@@ -0,0 +1,150 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Policy bounds how often and how long a request is retried
+type Policy struct {
+	// Attempts is the total number of tries, including the first
+	Attempts int
+	// BaseDelay is the backoff before the first retry; it doubles for each
+	// retry after that, up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Default is the policy the backend clients use
+var Default = Policy{Attempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+// Counters counts the retries made for one backend
+type Counters struct {
+	Backend string `json:"backend"`
+	// Retries is the number of requests sent again after a transient failure
+	Retries int64 `json:"retries"`
+	// Recovered counts requests that succeeded after at least one retry
+	Recovered int64 `json:"recovered"`
+	// Exhausted counts requests that failed transiently when the policy
+	// gave up, because attempts or the caller's deadline ran out
+	Exhausted int64 `json:"exhausted"`
+}
+
+var (
+	countersMu sync.Mutex
+	counters   = map[string]*Counters{}
+)
+
+func record(backend string, update func(*Counters)) {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+
+	c, ok := counters[backend]
+	if !ok {
+		c = &Counters{Backend: backend}
+		counters[backend] = c
+	}
+	update(c)
+}
+
+// Stats returns the retry counters of every backend that has retried a
+// request, ordered by backend name
+func Stats() []Counters {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+
+	stats := make([]Counters, 0, len(counters))
+	for _, c := range counters {
+		stats = append(stats, *c)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Backend < stats[j].Backend })
+	return stats
+}
+
+// TransientStatus reports whether a response status means the backend or a
+// proxy in front of it is briefly unavailable
+func TransientStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// Transient reports whether err is a failure worth retrying: a reset or
+// dropped connection, or a timeout such as the HTTP client's own
+func Transient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// delay returns the backoff before the given retry, counting from zero,
+// with full jitter so clients that failed together do not retry together
+func (p Policy) delay(retry int) time.Duration {
+	backoff := p.BaseDelay << uint(retry)
+	if backoff <= 0 || backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// wait sleeps for d unless ctx ends first or its deadline is too close for
+// another attempt to fit; it reports whether to retry
+func wait(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d {
+		return false
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Send issues the request built by newRequest, sending a fresh one after a
+// transient error or a 502, 503 or 504 response. Only idempotent requests
+// may be sent this way. Nothing is retried once ctx is done, and no retry
+// starts that would run past its deadline. Once the policy gives up the last response or error
+// is returned as is, so callers handle it as they would without retries.
+func (p Policy) Send(ctx context.Context, backend string, client *http.Client, newRequest func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	for retry := 0; ; retry++ {
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		transient := ctx.Err() == nil && (Transient(err) || err == nil && TransientStatus(resp.StatusCode))
+		if !transient {
+			if retry > 0 && err == nil {
+				record(backend, func(c *Counters) { c.Recovered++ })
+			}
+			return resp, err
+		}
+		if retry+1 >= p.Attempts || !wait(ctx, p.delay(retry)) {
+			record(backend, func(c *Counters) { c.Exhausted++ })
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		record(backend, func(c *Counters) { c.Retries++ })
+	}
+}
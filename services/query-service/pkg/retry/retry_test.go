@@ -0,0 +1,124 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fast = Policy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+// statusServer answers with the given statuses in turn, then with 200
+func statusServer(statuses ...int) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= len(statuses) {
+			w.WriteHeader(statuses[requests-1])
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return server, &requests
+}
+
+func send(ctx context.Context, p Policy, backend, url string) (*http.Response, error) {
+	return p.Send(ctx, backend, http.DefaultClient, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", url, nil)
+	})
+}
+
+func statsFor(backend string) Counters {
+	for _, c := range Stats() {
+		if c.Backend == backend {
+			return c
+		}
+	}
+	return Counters{Backend: backend}
+}
+
+func TestSendRetriesTransientStatus(t *testing.T) {
+	server, requests := statusServer(http.StatusBadGateway, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	resp, err := send(context.Background(), fast, "recovering", server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, *requests)
+	assert.Equal(t, Counters{Backend: "recovering", Retries: 2, Recovered: 1}, statsFor("recovering"))
+}
+
+func TestSendReturnsLastResponseWhenExhausted(t *testing.T) {
+	server, requests := statusServer(503, 503, 503, 503)
+	defer server.Close()
+
+	resp, err := send(context.Background(), fast, "down", server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 3, *requests)
+	assert.Equal(t, Counters{Backend: "down", Retries: 2, Exhausted: 1}, statsFor("down"))
+}
+
+func TestSendLeavesOtherStatusesAlone(t *testing.T) {
+	server, requests := statusServer(http.StatusInternalServerError)
+	defer server.Close()
+
+	resp, err := send(context.Background(), fast, "failing", server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, 1, *requests)
+}
+
+func TestSendHonorsDeadline(t *testing.T) {
+	server, requests := statusServer(503, 503)
+	defer server.Close()
+
+	// The first backoff cannot finish before the deadline
+	slow := Policy{Attempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	resp, err := send(ctx, slow, "slow", server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 1, *requests)
+	assert.Less(t, time.Since(start), time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = send(ctx, fast, "cancelled", server.URL)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, *requests)
+}
+
+func TestTransient(t *testing.T) {
+	assert.True(t, Transient(fmt.Errorf("read: %w", syscall.ECONNRESET)))
+	assert.True(t, Transient(context.DeadlineExceeded))
+	assert.False(t, Transient(nil))
+	assert.False(t, Transient(errors.New("syntax error")))
+	assert.False(t, Transient(syscall.ECONNREFUSED))
+
+	assert.True(t, TransientStatus(http.StatusGatewayTimeout))
+	assert.False(t, TransientStatus(http.StatusTooManyRequests))
+}
+
+func TestDelayIsBounded(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, p.delay(0), 100*time.Millisecond)
+		assert.LessOrEqual(t, p.delay(2), 400*time.Millisecond)
+		assert.LessOrEqual(t, p.delay(70), time.Second)
+	}
+	assert.Equal(t, time.Duration(0), Policy{}.delay(3))
+}
@@ -0,0 +1,327 @@
+package savedsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/webhooks"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Schedules a saved search can be re-run on, with their periods
+var Schedules = map[string]time.Duration{
+	"hourly": time.Hour,
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// MaxPerOwner bounds the saved searches of one user or API key
+const MaxPerOwner = 100
+
+// ErrNotFound is returned for saved searches that do not exist or belong
+// to someone else
+var ErrNotFound = errors.New("saved search not found")
+
+// ValidationError reports an invalid saved search
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// SavedSearch is a search request kept under a name so its owner can run
+// it again. A scheduled one is re-run every period and its webhook hears
+// about assets that were not among the previous run's results.
+type SavedSearch struct {
+	ID string `json:"id"`
+	// OwnerID is the user, or the API key of keys issued to no user
+	OwnerID  string `json:"owner_id"`
+	TenantID string `json:"tenant_id,omitempty"`
+	Name     string `json:"name"`
+	// Request is the body of a search request, run as saved
+	Request json.RawMessage `json:"request"`
+	// Collections is the scope of the caller that saved the search, which
+	// scheduled runs keep to; nil means every collection
+	Collections []string `json:"-"`
+	// Schedule is hourly, daily or weekly; empty only runs it on demand
+	Schedule   string `json:"schedule,omitempty"`
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// WebhookSecret signs the webhook deliveries
+	WebhookSecret string     `json:"webhook_secret,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt     *time.Time `json:"next_run_at,omitempty"`
+	// SeenAssetIDs are the results of the last scheduled run
+	SeenAssetIDs []string `json:"-"`
+}
+
+// Validate checks the saved search and normalises its fields
+func Validate(search *SavedSearch) error {
+	search.Name = strings.TrimSpace(search.Name)
+	search.Schedule = strings.ToLower(strings.TrimSpace(search.Schedule))
+	search.WebhookURL = strings.TrimSpace(search.WebhookURL)
+
+	if search.Name == "" || len(search.Name) > 255 {
+		return &ValidationError{Message: "name must be 1-255 characters"}
+	}
+	if len(search.Request) == 0 || !json.Valid(search.Request) {
+		return &ValidationError{Message: "request must be a search request"}
+	}
+	if _, ok := Schedules[search.Schedule]; search.Schedule != "" && !ok {
+		names := make([]string, 0, len(Schedules))
+		for name := range Schedules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return &ValidationError{Message: fmt.Sprintf("schedule must be one of %s", strings.Join(names, ", "))}
+	}
+	if search.WebhookURL != "" {
+		parsed, err := url.Parse(search.WebhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return &ValidationError{Message: "webhook_url must be an http or https URL"}
+		}
+		if search.Schedule == "" {
+			return &ValidationError{Message: "webhook_url needs a schedule"}
+		}
+	}
+	return nil
+}
+
+// checkWebhookURL refuses webhook URLs whose host is unknown or resolves to
+// an internal address, as registered webhooks are
+func checkWebhookURL(ctx context.Context, webhookURL string) error {
+	if webhookURL == "" {
+		return nil
+	}
+	if err := webhooks.CheckURL(ctx, webhookURL); err != nil {
+		return &ValidationError{Message: "webhook_" + err.Error()}
+	}
+	return nil
+}
+
+// Store keeps the saved searches in PostgreSQL
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// NewStore creates a saved search store
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// EnsureSchema creates the saved_searches table
+func (s *Store) EnsureSchema(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS saved_searches (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			owner_id VARCHAR(255) NOT NULL,
+			tenant_id VARCHAR(40) NOT NULL DEFAULT '',
+			name VARCHAR(255) NOT NULL,
+			request JSONB NOT NULL,
+			collections TEXT[],
+			schedule VARCHAR(20) NOT NULL DEFAULT '',
+			webhook_url TEXT NOT NULL DEFAULT '',
+			webhook_secret VARCHAR(64) NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			last_run_at TIMESTAMP WITH TIME ZONE,
+			next_run_at TIMESTAMP WITH TIME ZONE,
+			seen_asset_ids TEXT[] NOT NULL DEFAULT '{}'
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_saved_searches_owner ON saved_searches(tenant_id, owner_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_saved_searches_next_run ON saved_searches(next_run_at) WHERE next_run_at IS NOT NULL`,
+	}
+	for _, statement := range statements {
+		if _, err := s.pool.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// savedSearchColumns are read by scanSavedSearches, in order
+const savedSearchColumns = `id::text, owner_id, tenant_id, name, request, collections, schedule, webhook_url, webhook_secret,
+	created_at, updated_at, last_run_at, next_run_at, seen_asset_ids`
+
+// List returns the owner's saved searches, oldest first. Owners are only
+// unique within their tenant.
+func (s *Store) List(ctx context.Context, tenantID, ownerID string) ([]SavedSearch, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+savedSearchColumns+`
+		FROM saved_searches
+		WHERE tenant_id = $1 AND owner_id = $2
+		ORDER BY created_at
+	`, tenantID, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list saved searches: %v", err)
+	}
+	return scanSavedSearches(rows)
+}
+
+// Get returns one of the owner's saved searches
+func (s *Store) Get(ctx context.Context, tenantID, ownerID, id string) (*SavedSearch, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+savedSearchColumns+`
+		FROM saved_searches
+		WHERE id::text = $1 AND tenant_id = $2 AND owner_id = $3
+	`, id, tenantID, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saved search: %v", err)
+	}
+	searches, err := scanSavedSearches(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(searches) == 0 {
+		return nil, ErrNotFound
+	}
+	return &searches[0], nil
+}
+
+// Create validates and stores a saved search. A scheduled one is due at
+// once, so its first run records the results to compare later runs with.
+func (s *Store) Create(ctx context.Context, search SavedSearch) (*SavedSearch, error) {
+	if err := Validate(&search); err != nil {
+		return nil, err
+	}
+	if err := checkWebhookURL(ctx, search.WebhookURL); err != nil {
+		return nil, err
+	}
+	var count int
+	if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM saved_searches WHERE tenant_id = $1 AND owner_id = $2`, search.TenantID, search.OwnerID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count saved searches: %v", err)
+	}
+	if count >= MaxPerOwner {
+		return nil, &ValidationError{Message: fmt.Sprintf("at most %d saved searches are allowed per owner", MaxPerOwner)}
+	}
+	if search.WebhookURL != "" {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			return nil, err
+		}
+		search.WebhookSecret = secret
+	}
+
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO saved_searches (owner_id, tenant_id, name, request, collections, schedule, webhook_url, webhook_secret, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CASE WHEN $6 = '' THEN NULL ELSE NOW() END)
+		RETURNING id::text, created_at, updated_at, next_run_at
+	`, search.OwnerID, search.TenantID, search.Name, []byte(search.Request), search.Collections, search.Schedule,
+		search.WebhookURL, search.WebhookSecret).Scan(&search.ID, &search.CreatedAt, &search.UpdatedAt, &search.NextRunAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create saved search: %v", err)
+	}
+	return &search, nil
+}
+
+// Update replaces the name, request, schedule and webhook of one of the
+// owner's saved searches. A changed request or schedule starts the
+// comparison of scheduled runs over; the webhook secret is kept unless the
+// webhook is removed.
+func (s *Store) Update(ctx context.Context, search SavedSearch) (*SavedSearch, error) {
+	if err := Validate(&search); err != nil {
+		return nil, err
+	}
+	if err := checkWebhookURL(ctx, search.WebhookURL); err != nil {
+		return nil, err
+	}
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.pool.Query(ctx, `
+		UPDATE saved_searches SET
+			name = $3,
+			request = $4,
+			collections = $5,
+			schedule = $6,
+			webhook_url = $7,
+			webhook_secret = CASE WHEN $7 = '' THEN '' WHEN webhook_secret = '' THEN $8 ELSE webhook_secret END,
+			updated_at = NOW(),
+			last_run_at = CASE WHEN request = $4::jsonb AND schedule = $6 THEN last_run_at END,
+			next_run_at = CASE WHEN $6 = '' THEN NULL WHEN request = $4::jsonb AND schedule = $6 THEN next_run_at ELSE NOW() END,
+			seen_asset_ids = CASE WHEN request = $4::jsonb AND schedule = $6 THEN seen_asset_ids ELSE '{}' END
+		WHERE id::text = $1 AND owner_id = $2 AND tenant_id = $9
+		RETURNING `+savedSearchColumns+`
+	`, search.ID, search.OwnerID, search.Name, []byte(search.Request), search.Collections, search.Schedule, search.WebhookURL, secret, search.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update saved search: %v", err)
+	}
+	updated, err := scanSavedSearches(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(updated) == 0 {
+		return nil, ErrNotFound
+	}
+	return &updated[0], nil
+}
+
+// Delete removes one of the owner's saved searches
+func (s *Store) Delete(ctx context.Context, tenantID, ownerID, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM saved_searches WHERE id::text = $1 AND tenant_id = $2 AND owner_id = $3`, id, tenantID, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete saved search: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Due returns up to limit scheduled searches whose next run is at or
+// before now, longest overdue first
+func (s *Store) Due(ctx context.Context, now time.Time, limit int) ([]SavedSearch, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+savedSearchColumns+`
+		FROM saved_searches
+		WHERE next_run_at <= $1
+		ORDER BY next_run_at
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due saved searches: %v", err)
+	}
+	return scanSavedSearches(rows)
+}
+
+// MarkRun records a scheduled run's results and when the search is next due
+func (s *Store) MarkRun(ctx context.Context, id string, ranAt time.Time, assetIDs []string, next time.Time) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE saved_searches SET last_run_at = $2, seen_asset_ids = $3, next_run_at = $4
+		WHERE id::text = $1 AND schedule <> ''
+	`, id, ranAt, assetIDs, next)
+	if err != nil {
+		return fmt.Errorf("failed to record saved search run: %v", err)
+	}
+	return nil
+}
+
+func scanSavedSearches(rows pgx.Rows) ([]SavedSearch, error) {
+	defer rows.Close()
+
+	searches := []SavedSearch{}
+	for rows.Next() {
+		var search SavedSearch
+		var request []byte
+		if err := rows.Scan(&search.ID, &search.OwnerID, &search.TenantID, &search.Name, &request, &search.Collections,
+			&search.Schedule, &search.WebhookURL, &search.WebhookSecret, &search.CreatedAt, &search.UpdatedAt,
+			&search.LastRunAt, &search.NextRunAt, &search.SeenAssetIDs); err != nil {
+			return nil, fmt.Errorf("failed to scan saved search: %v", err)
+		}
+		search.Request = request
+		searches = append(searches, search)
+	}
+	return searches, rows.Err()
+}
@@ -0,0 +1,146 @@
+package savedsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/events"
+	"dataflux/query-service/pkg/webhooks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	search := SavedSearch{Name: " Harbour ", Request: json.RawMessage(`{"query":"harbour"}`), Schedule: " Daily ", WebhookURL: "https://example.com/hook"}
+	require.NoError(t, Validate(&search))
+	assert.Equal(t, "Harbour", search.Name)
+	assert.Equal(t, "daily", search.Schedule)
+
+	for _, invalid := range []SavedSearch{
+		{Name: " ", Request: json.RawMessage(`{}`)},
+		{Name: "x", Request: json.RawMessage(`{`)},
+		{Name: "x", Request: json.RawMessage(`{}`), Schedule: "monthly"},
+		{Name: "x", Request: json.RawMessage(`{}`), Schedule: "daily", WebhookURL: "ftp://example.com"},
+		{Name: "x", Request: json.RawMessage(`{}`), WebhookURL: "https://example.com/hook"},
+	} {
+		var validationErr *ValidationError
+		assert.True(t, errors.As(Validate(&invalid), &validationErr), "%+v", invalid)
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, checkWebhookURL(ctx, ""))
+	assert.NoError(t, checkWebhookURL(ctx, "https://93.184.215.14/hook"))
+	for _, internal := range []string{"http://127.0.0.1:8003/hook", "http://10.1.2.3/hook", "http://169.254.169.254/", "http://localhost/hook"} {
+		var validationErr *ValidationError
+		err := checkWebhookURL(ctx, internal)
+		require.True(t, errors.As(err, &validationErr), internal)
+		assert.Contains(t, err.Error(), "webhook_url", internal)
+	}
+}
+
+type fakeSource struct {
+	due    []SavedSearch
+	marked map[string][]string
+	next   map[string]time.Time
+}
+
+func (f *fakeSource) Due(ctx context.Context, now time.Time, limit int) ([]SavedSearch, error) {
+	return f.due, nil
+}
+
+func (f *fakeSource) MarkRun(ctx context.Context, id string, ranAt time.Time, assetIDs []string, next time.Time) error {
+	f.marked[id] = assetIDs
+	f.next[id] = next
+	return nil
+}
+
+type fakeNotifier struct {
+	matches []Match
+	err     error
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, search SavedSearch, match Match) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.matches = append(f.matches, match)
+	return nil
+}
+
+func TestSchedulerRun(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	source := &fakeSource{
+		due: []SavedSearch{
+			// First runs only record their results
+			{ID: "first", Schedule: "hourly", WebhookURL: "https://example.com/a"},
+			{ID: "again", Name: "Cranes", Schedule: "daily", WebhookURL: "https://example.com/b", LastRunAt: &earlier, SeenAssetIDs: []string{"asset-1"}},
+			{ID: "failing", Schedule: "hourly", LastRunAt: &earlier},
+			// Matches of searches without a webhook are still notified
+			{ID: "quiet", Name: "Quays", Schedule: "hourly", LastRunAt: &earlier, SeenAssetIDs: []string{"asset-2"}},
+		},
+		marked: map[string][]string{},
+		next:   map[string]time.Time{},
+	}
+	run := func(ctx context.Context, search SavedSearch) ([]string, error) {
+		if search.ID == "failing" {
+			return nil, errors.New("weaviate timed out")
+		}
+		return []string{"asset-1", "asset-2"}, nil
+	}
+	notifier := &fakeNotifier{}
+	scheduler := NewScheduler(source, run, notifier, nil, 10)
+
+	notified, err := scheduler.Run(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, notified)
+	require.Len(t, notifier.matches, 2)
+	assert.Equal(t, Match{SavedSearchID: "again", Name: "Cranes", RanAt: now, NewAssetIDs: []string{"asset-2"}}, notifier.matches[0])
+	assert.Equal(t, Match{SavedSearchID: "quiet", Name: "Quays", RanAt: now, NewAssetIDs: []string{"asset-1"}}, notifier.matches[1])
+	assert.Equal(t, []string{"asset-1", "asset-2"}, source.marked["first"])
+	assert.Equal(t, now.Add(time.Hour), source.next["first"])
+	assert.Equal(t, now.Add(24*time.Hour), source.next["again"])
+	assert.NotContains(t, source.marked, "failing")
+
+	// A failed webhook leaves the run to be tried again
+	source.marked = map[string][]string{}
+	notifier.err = errors.New("connection refused")
+	_, err = scheduler.Run(context.Background(), now)
+	require.NoError(t, err)
+	assert.NotContains(t, source.marked, "again")
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var body []byte
+	var signature, event string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(events.SignatureHeader)
+		event = r.Header.Get(events.EventHeader)
+	}))
+	defer server.Close()
+
+	search := SavedSearch{ID: "s1", WebhookURL: server.URL, WebhookSecret: "secret"}
+	// Real notifiers refuse the loopback address the test server listens on
+	_, err := NewWebhookNotifier(time.Second).client.Get(server.URL)
+	assert.ErrorIs(t, err, webhooks.ErrInternalAddress)
+
+	notifier := &WebhookNotifier{client: &http.Client{Timeout: time.Second}}
+	require.NoError(t, notifier.Notify(context.Background(), search, Match{SavedSearchID: "s1", NewAssetIDs: []string{"asset-2"}}))
+	assert.Equal(t, EventMatched, event)
+	assert.NoError(t, events.Verify("secret", signature, body, time.Minute, time.Now()))
+	assert.Contains(t, string(body), `"new_asset_ids":["asset-2"]`)
+}
+
+func TestWebhookNotifierSkipsSearchesWithoutWebhook(t *testing.T) {
+	assert.NoError(t, NewWebhookNotifier(time.Second).Notify(context.Background(), SavedSearch{ID: "s1"}, Match{SavedSearchID: "s1"}))
+}
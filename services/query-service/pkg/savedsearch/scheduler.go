@@ -0,0 +1,183 @@
+package savedsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"dataflux/query-service/pkg/events"
+	"dataflux/query-service/pkg/webhooks"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// lockKey makes sure only one replica runs the scheduled searches at a time
+const lockKey = "savedsearch:schedule:lock"
+
+// EventMatched is the X-DataFlux-Event header of webhook deliveries
+const EventMatched = "saved_search_matched"
+
+// Source provides the due searches and records their runs
+type Source interface {
+	Due(ctx context.Context, now time.Time, limit int) ([]SavedSearch, error)
+	MarkRun(ctx context.Context, id string, ranAt time.Time, assetIDs []string, next time.Time) error
+}
+
+// Runner runs a saved search as its owner and returns the IDs of the assets
+// found. It fails when a backend did, so a partial answer is not taken for
+// assets that disappeared.
+type Runner func(ctx context.Context, search SavedSearch) ([]string, error)
+
+// Match is what a webhook hears about a scheduled run
+type Match struct {
+	SavedSearchID string    `json:"saved_search_id"`
+	Name          string    `json:"name"`
+	RanAt         time.Time `json:"ran_at"`
+	// NewAssetIDs were found by this run but not by the previous one
+	NewAssetIDs []string `json:"new_asset_ids"`
+}
+
+// Notifier tells a saved search's owner about new matches
+type Notifier interface {
+	Notify(ctx context.Context, search SavedSearch, match Match) error
+}
+
+// Scheduler re-runs the scheduled searches when they are due and notifies
+// their webhooks of new matches
+type Scheduler struct {
+	source   Source
+	run      Runner
+	notifier Notifier
+	redis    *redis.Client
+	// batch bounds the searches run per round; later ones wait
+	batch    int
+	instance string
+}
+
+// NewScheduler creates a scheduler running up to batch searches a round
+func NewScheduler(source Source, run Runner, notifier Notifier, redisClient *redis.Client, batch int) *Scheduler {
+	instance, _ := os.Hostname()
+	return &Scheduler{source: source, run: run, notifier: notifier, redis: redisClient, batch: batch, instance: instance}
+}
+
+// Run re-runs the searches due at now and returns how many matches were
+// notified. The first run of a search only records its results. A search
+// that fails, or whose notification does, is tried again on the next round.
+func (s *Scheduler) Run(ctx context.Context, now time.Time) (int, error) {
+	due, err := s.source.Due(ctx, now, s.batch)
+	if err != nil {
+		return 0, err
+	}
+
+	notified := 0
+	for _, search := range due {
+		assetIDs, err := s.run(ctx, search)
+		if err != nil {
+			log.Printf("Warning: saved search %s failed: %v", search.ID, err)
+			continue
+		}
+
+		if search.LastRunAt != nil {
+			seen := make(map[string]bool, len(search.SeenAssetIDs))
+			for _, id := range search.SeenAssetIDs {
+				seen[id] = true
+			}
+			match := Match{SavedSearchID: search.ID, Name: search.Name, RanAt: now.UTC(), NewAssetIDs: []string{}}
+			for _, id := range assetIDs {
+				if !seen[id] {
+					match.NewAssetIDs = append(match.NewAssetIDs, id)
+				}
+			}
+			if len(match.NewAssetIDs) > 0 {
+				if err := s.notifier.Notify(ctx, search, match); err != nil {
+					log.Printf("Warning: webhook of saved search %s failed: %v", search.ID, err)
+					continue
+				}
+				notified++
+			}
+		}
+
+		if err := s.source.MarkRun(ctx, search.ID, now, assetIDs, now.Add(Schedules[search.Schedule])); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return notified, nil
+}
+
+// Start checks for due searches every interval until ctx is cancelled.
+// Replicas share a Redis lock so only one of them runs each round.
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				acquired, err := s.redis.SetNX(ctx, lockKey, s.instance, interval/2).Result()
+				if err != nil {
+					log.Printf("Warning: saved search lock failed: %v", err)
+					continue
+				}
+				if !acquired {
+					continue
+				}
+				if notified, err := s.Run(ctx, time.Now()); err != nil {
+					log.Printf("Warning: saved search round failed: %v", err)
+				} else if notified > 0 {
+					log.Printf("Notified %d saved search matches", notified)
+				}
+			}
+		}
+	}()
+}
+
+// WebhookNotifier POSTs matches to the saved search's webhook, signed
+// with its secret like the service's lifecycle events
+type WebhookNotifier struct {
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier giving up on webhooks after
+// timeout. Like registered webhooks, it never connects to internal
+// addresses.
+func NewWebhookNotifier(timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{client: webhooks.NewClient(timeout)}
+}
+
+// Notify delivers the match and treats any non-2xx response as a failure.
+// Searches without a webhook are skipped.
+func (w *WebhookNotifier) Notify(ctx context.Context, search SavedSearch, match Match) error {
+	if search.WebhookURL == "" {
+		return nil
+	}
+	payload, err := json.Marshal(match)
+	if err != nil {
+		return fmt.Errorf("failed to encode match: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, search.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(events.EventHeader, EventMatched)
+	req.Header.Set(events.SignatureHeader, events.Sign(search.WebhookSecret, time.Now(), payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver match: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
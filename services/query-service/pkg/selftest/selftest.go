@@ -0,0 +1,118 @@
+package selftest
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Check outcome values
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusWarn = "warn"
+)
+
+// CheckFunc performs one check and returns a human-readable detail
+type CheckFunc func(ctx context.Context) (string, error)
+
+// Result is the outcome of a single check
+type Result struct {
+	Name       string `json:"name"`
+	Backend    string `json:"backend"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Report is the structured outcome of a self-test run
+type Report struct {
+	Passed     bool      `json:"passed"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Failed     int       `json:"failed"`
+	Warnings   int       `json:"warnings"`
+	Results    []Result  `json:"results"`
+}
+
+type check struct {
+	name     string
+	backend  string
+	optional bool
+	fn       CheckFunc
+}
+
+// Runner executes registered checks in order
+type Runner struct {
+	timeout time.Duration
+	checks  []check
+}
+
+// NewRunner creates a runner with a per-check timeout
+func NewRunner(timeout time.Duration) *Runner {
+	return &Runner{timeout: timeout}
+}
+
+// Add registers a check whose failure fails the run
+func (r *Runner) Add(name, backend string, fn CheckFunc) {
+	r.checks = append(r.checks, check{name: name, backend: backend, fn: fn})
+}
+
+// AddOptional registers a check whose failure is only reported as a warning
+func (r *Runner) AddOptional(name, backend string, fn CheckFunc) {
+	r.checks = append(r.checks, check{name: name, backend: backend, optional: true, fn: fn})
+}
+
+// Run executes all checks and builds the report
+func (r *Runner) Run(ctx context.Context) Report {
+	report := Report{
+		Passed:    true,
+		StartedAt: time.Now().UTC(),
+		Results:   make([]Result, 0, len(r.checks)),
+	}
+
+	for _, c := range r.checks {
+		report.Results = append(report.Results, r.runOne(ctx, c))
+		switch report.Results[len(report.Results)-1].Status {
+		case StatusFail:
+			report.Failed++
+			report.Passed = false
+		case StatusWarn:
+			report.Warnings++
+		}
+	}
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report
+}
+
+func (r *Runner) runOne(ctx context.Context, c check) (result Result) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	result = Result{Name: c.name, Backend: c.backend}
+	defer func() {
+		if p := recover(); p != nil {
+			result.Status = StatusFail
+			result.Error = fmt.Sprintf("panic: %v", p)
+		}
+		result.DurationMs = time.Since(start).Milliseconds()
+	}()
+
+	detail, err := c.fn(ctx)
+	result.Detail = detail
+	if err == nil {
+		result.Status = StatusPass
+		return result
+	}
+
+	result.Error = err.Error()
+	if c.optional {
+		result.Status = StatusWarn
+	} else {
+		result.Status = StatusFail
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package selftest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReportsEachCheck(t *testing.T) {
+	runner := NewRunner(time.Second)
+	runner.Add("postgres_connect", "postgres", func(ctx context.Context) (string, error) {
+		return "PostgreSQL 15", nil
+	})
+	runner.AddOptional("weaviate_meta", "weaviate", func(ctx context.Context) (string, error) {
+		return "", errors.New("connection refused")
+	})
+
+	report := runner.Run(context.Background())
+	assert.True(t, report.Passed)
+	assert.Equal(t, 0, report.Failed)
+	assert.Equal(t, 1, report.Warnings)
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, Result{Name: "postgres_connect", Backend: "postgres", Status: StatusPass, Detail: "PostgreSQL 15"}, report.Results[0])
+	assert.Equal(t, StatusWarn, report.Results[1].Status)
+	assert.Equal(t, "connection refused", report.Results[1].Error)
+}
+
+func TestRunFailsOnRequiredCheck(t *testing.T) {
+	ran := false
+	runner := NewRunner(time.Second)
+	runner.Add("neo4j_cypher", "neo4j", func(ctx context.Context) (string, error) {
+		return "", errors.New("404 Not Found")
+	})
+	runner.Add("redis_roundtrip", "redis", func(ctx context.Context) (string, error) {
+		ran = true
+		return "read back ok", nil
+	})
+
+	report := runner.Run(context.Background())
+	assert.False(t, report.Passed)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, StatusFail, report.Results[0].Status)
+	// Later checks still run
+	assert.True(t, ran)
+	assert.Equal(t, StatusPass, report.Results[1].Status)
+}
+
+func TestRunRecoversPanics(t *testing.T) {
+	runner := NewRunner(time.Second)
+	runner.AddOptional("clickhouse_ping", "clickhouse", func(ctx context.Context) (string, error) {
+		panic("nil client")
+	})
+
+	report := runner.Run(context.Background())
+	// A panic fails the run even in an optional check
+	assert.False(t, report.Passed)
+	assert.Equal(t, StatusFail, report.Results[0].Status)
+	assert.Equal(t, "panic: nil client", report.Results[0].Error)
+}
+
+func TestRunTimesOutEachCheck(t *testing.T) {
+	runner := NewRunner(10 * time.Millisecond)
+	runner.Add("neo4j_bolt", "neo4j", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	runner.Add("redis_roundtrip", "redis", func(ctx context.Context) (string, error) {
+		// Each check gets its own deadline
+		return "", ctx.Err()
+	})
+
+	report := runner.Run(context.Background())
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Results[0].Error)
+	assert.Equal(t, StatusPass, report.Results[1].Status)
+}
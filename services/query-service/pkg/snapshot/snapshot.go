@@ -0,0 +1,108 @@
+package snapshot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// generationsKey is the Redis hash of each backend's index generation
+const generationsKey = "index:generations"
+
+// Generations maps each backend to the number of reindexes it has completed.
+// Backends never reindexed are absent and at generation zero.
+type Generations map[string]int64
+
+// Equal reports whether both name the same generation of every backend
+func (g Generations) Equal(other Generations) bool {
+	for backend, generation := range g {
+		if other[backend] != generation {
+			return false
+		}
+	}
+	for backend, generation := range other {
+		if g[backend] != generation {
+			return false
+		}
+	}
+	return true
+}
+
+// Registry keeps the index generations in Redis, shared by every replica
+type Registry struct {
+	client *redis.Client
+}
+
+// NewRegistry creates a registry over the Redis client
+func NewRegistry(client *redis.Client) *Registry {
+	return &Registry{client: client}
+}
+
+// Current returns the generation of every backend reindexed at least once
+func (r *Registry) Current(ctx context.Context) (Generations, error) {
+	values, err := r.client.HGetAll(ctx, generationsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index generations: %v", err)
+	}
+	generations := Generations{}
+	for backend, value := range values {
+		generation, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid generation %q of %s", value, backend)
+		}
+		generations[backend] = generation
+	}
+	return generations, nil
+}
+
+// Bump records a completed reindex of the backend and returns its new
+// generation
+func (r *Registry) Bump(ctx context.Context, backend string) (int64, error) {
+	generation, err := r.client.HIncrBy(ctx, generationsKey, backend, 1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump index generation of %s: %v", backend, err)
+	}
+	return generation, nil
+}
+
+// Token names a snapshot: the results of one query materialized at a set of
+// index generations, so every page of it is read from the same state
+type Token struct {
+	ID          string      `json:"id"`
+	Generations Generations `json:"g"`
+}
+
+// NewToken creates a token for a snapshot taken at the generations
+func NewToken(generations Generations) Token {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return Token{ID: strconv.FormatInt(time.Now().UnixNano(), 36), Generations: generations}
+	}
+	return Token{ID: hex.EncodeToString(buf), Generations: generations}
+}
+
+// Encode returns the token as an opaque URL-safe string
+func (t Token) Encode() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseToken reads a token returned by Encode
+func ParseToken(encoded string) (Token, error) {
+	var token Token
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err == nil {
+		err = json.Unmarshal(data, &token)
+	}
+	if err != nil || token.ID == "" {
+		return Token{}, fmt.Errorf("invalid snapshot token")
+	}
+	return token, nil
+}
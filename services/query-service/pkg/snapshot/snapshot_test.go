@@ -0,0 +1,29 @@
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	token := NewToken(Generations{"postgres": 4, "weaviate": 2})
+
+	parsed, err := ParseToken(token.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, token, parsed)
+	assert.NotEqual(t, token.ID, NewToken(nil).ID)
+
+	for _, invalid := range []string{"", "not a token", "e30"} {
+		_, err := ParseToken(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestGenerationsEqual(t *testing.T) {
+	assert.True(t, Generations{"postgres": 1}.Equal(Generations{"postgres": 1, "weaviate": 0}))
+	assert.True(t, Generations(nil).Equal(Generations{}))
+	assert.False(t, Generations{"postgres": 1}.Equal(Generations{"postgres": 2}))
+	assert.False(t, Generations{}.Equal(Generations{"neo4j": 1}))
+}
@@ -0,0 +1,204 @@
+package speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned when the provider cannot decode the clip
+var ErrUnsupported = errors.New("audio format not supported by the speech-to-text provider")
+
+// Transcription is what was said in a clip
+type Transcription struct {
+	Text string `json:"text"`
+	// Language is the language spoken, when the provider detects it
+	Language string `json:"language,omitempty"`
+	// Duration is the length of the clip in seconds, when reported
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// Transcriber turns speech into text
+type Transcriber interface {
+	// Transcribe transcribes the clip; language, when set, tells the
+	// provider what is spoken instead of leaving it to detection
+	Transcribe(ctx context.Context, filename, contentType string, audio io.Reader, language string) (Transcription, error)
+}
+
+// Speech-to-text providers
+const (
+	// ProviderHTTP is a transcription service answering POST /transcribe,
+	// behind which local models are served
+	ProviderHTTP = "http"
+	// ProviderOpenAI is any API compatible with OpenAI's
+	// /audio/transcriptions, which Whisper servers commonly offer
+	ProviderOpenAI = "openai"
+)
+
+// Config selects and configures a speech-to-text provider
+type Config struct {
+	Provider string
+	URL      string
+	// Model is sent to OpenAI-compatible APIs
+	Model   string
+	APIKey  string
+	Timeout time.Duration
+}
+
+// New creates the transcriber of the configured provider, or nil when no
+// provider is configured
+func New(config Config) (Transcriber, error) {
+	client := client{httpClient: &http.Client{Timeout: config.Timeout}, apiKey: config.APIKey}
+	switch config.Provider {
+	case "":
+		return nil, nil
+	case ProviderHTTP:
+		if config.URL == "" {
+			return nil, fmt.Errorf("the %s transcriber needs a URL", config.Provider)
+		}
+		client.url = strings.TrimRight(config.URL, "/")
+		return httpTranscriber{client}, nil
+	case ProviderOpenAI:
+		if config.Model == "" {
+			return nil, fmt.Errorf("the %s transcriber needs a model", config.Provider)
+		}
+		client.url = "https://api.openai.com/v1"
+		if config.URL != "" {
+			client.url = strings.TrimRight(config.URL, "/")
+		}
+		return openAITranscriber{client: client, model: config.Model}, nil
+	}
+	return nil, fmt.Errorf("unknown speech-to-text provider %q", config.Provider)
+}
+
+type client struct {
+	url        string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// upload posts the clip as the multipart field file, along with fields, to
+// path and decodes the reply into result
+func (c client) upload(ctx context.Context, path, filename, contentType string, audio io.Reader, fields map[string]string, result interface{}) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filename))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, audio); err != nil {
+		return fmt.Errorf("failed to read audio: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("speech-to-text request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnsupportedMediaType:
+		return ErrUnsupported
+	case resp.StatusCode != http.StatusOK:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("speech-to-text provider returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode transcription: %v", err)
+	}
+	return nil
+}
+
+// httpTranscriber uploads clips to POST <url>/transcribe, with the optional
+// field language, and reads {"text": ..., "language": ..., "duration": ...}
+type httpTranscriber struct {
+	client
+}
+
+func (h httpTranscriber) Transcribe(ctx context.Context, filename, contentType string, audio io.Reader, language string) (Transcription, error) {
+	var transcription Transcription
+	err := h.upload(ctx, "/transcribe", filename, contentType, audio, map[string]string{"language": language}, &transcription)
+	transcription.Text = strings.TrimSpace(transcription.Text)
+	return transcription, err
+}
+
+// openAITranscriber uploads clips to an OpenAI-compatible
+// /audio/transcriptions API and asks for the verbose reply, which names
+// the detected language
+type openAITranscriber struct {
+	client
+	model string
+}
+
+func (o openAITranscriber) Transcribe(ctx context.Context, filename, contentType string, audio io.Reader, language string) (Transcription, error) {
+	var transcription Transcription
+	err := o.upload(ctx, "/audio/transcriptions", filename, contentType, audio, map[string]string{
+		"model":           o.model,
+		"language":        language,
+		"response_format": "verbose_json",
+		"temperature":     "0",
+	}, &transcription)
+	transcription.Text = strings.TrimSpace(transcription.Text)
+	// Whisper names languages in English, as in "german"
+	transcription.Language = languageCode(transcription.Language)
+	return transcription, err
+}
+
+// whisperLanguages maps the language names Whisper reports to ISO 639-1
+// codes for the languages transcripts are commonly translated into
+var whisperLanguages = map[string]string{
+	"english":    "en",
+	"german":     "de",
+	"french":     "fr",
+	"spanish":    "es",
+	"italian":    "it",
+	"portuguese": "pt",
+	"dutch":      "nl",
+	"polish":     "pl",
+	"russian":    "ru",
+	"ukrainian":  "uk",
+	"turkish":    "tr",
+	"arabic":     "ar",
+	"chinese":    "zh",
+	"japanese":   "ja",
+	"korean":     "ko",
+}
+
+// languageCode turns a language name into its code; codes and unknown
+// names are returned lower-cased
+func languageCode(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if code, ok := whisperLanguages[language]; ok {
+		return code
+	}
+	return language
+}
@@ -0,0 +1,87 @@
+package speech
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	transcriber, err := New(Config{})
+	require.NoError(t, err)
+	assert.Nil(t, transcriber)
+
+	_, err = New(Config{Provider: ProviderHTTP})
+	assert.Error(t, err)
+	_, err = New(Config{Provider: ProviderOpenAI})
+	assert.Error(t, err)
+	_, err = New(Config{Provider: "vosk", URL: "http://stt"})
+	assert.Error(t, err)
+}
+
+func TestHTTPTranscriber(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/transcribe", r.URL.Path)
+		file, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		audio, _ := io.ReadAll(file)
+		assert.Equal(t, "clip-bytes", string(audio))
+		assert.Equal(t, "audio/webm", header.Header.Get("Content-Type"))
+		assert.Equal(t, "de", r.FormValue("language"))
+		w.Write([]byte(`{"text":" Hochwasser in Köln ","language":"de","duration":2.5}`))
+	}))
+	defer server.Close()
+
+	transcriber, err := New(Config{Provider: ProviderHTTP, URL: server.URL + "/", Timeout: time.Second})
+	require.NoError(t, err)
+	transcription, err := transcriber.Transcribe(context.Background(), "clip.webm", "audio/webm", strings.NewReader("clip-bytes"), "de")
+	require.NoError(t, err)
+	assert.Equal(t, Transcription{Text: "Hochwasser in Köln", Language: "de", Duration: 2.5}, transcription)
+}
+
+func TestOpenAITranscriber(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/audio/transcriptions", r.URL.Path)
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		assert.Equal(t, "whisper-1", r.FormValue("model"))
+		assert.Equal(t, "verbose_json", r.FormValue("response_format"))
+		// Detection is left to the model without a language
+		assert.Empty(t, r.FormValue("language"))
+		w.Write([]byte(`{"text":"flood in cologne","language":"english","duration":1.8}`))
+	}))
+	defer server.Close()
+
+	transcriber, err := New(Config{Provider: ProviderOpenAI, URL: server.URL + "/v1", Model: "whisper-1", APIKey: "key", Timeout: time.Second})
+	require.NoError(t, err)
+	transcription, err := transcriber.Transcribe(context.Background(), "clip.m4a", "audio/mp4", strings.NewReader("clip"), "")
+	require.NoError(t, err)
+	assert.Equal(t, "flood in cologne", transcription.Text)
+	assert.Equal(t, "en", transcription.Language)
+}
+
+func TestTranscribeFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/unsupported") {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		http.Error(w, "model overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	transcriber, _ := New(Config{Provider: ProviderHTTP, URL: server.URL + "/unsupported", Timeout: time.Second})
+	_, err := transcriber.Transcribe(context.Background(), "clip.xyz", "audio/xyz", strings.NewReader("clip"), "")
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	transcriber, _ = New(Config{Provider: ProviderHTTP, URL: server.URL, Timeout: time.Second})
+	_, err = transcriber.Transcribe(context.Background(), "clip.webm", "audio/webm", strings.NewReader("clip"), "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+}
@@ -0,0 +1,94 @@
+package spelling
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// LoadFunc reads the vocabulary of a tenant, mapping terms to how often
+// they occur
+type LoadFunc func(ctx context.Context, tenant string) (map[string]int, error)
+
+// buildTimeout bounds a background build; vocabularies are read with a few
+// aggregate queries over the whole index
+const buildTimeout = time.Minute
+
+// Registry keeps a dictionary per tenant, built from the indexed vocabulary
+// in the background on first use and rebuilt once older than the TTL
+type Registry struct {
+	ttl         time.Duration
+	minCount    int
+	maxDistance int
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	dictionary *Dictionary
+	built      time.Time
+	building   bool
+}
+
+// NewRegistry creates a registry whose dictionaries hold the terms occurring
+// at least minCount times and correct up to maxDistance edits
+func NewRegistry(ttl time.Duration, minCount, maxDistance int) *Registry {
+	return &Registry{ttl: ttl, minCount: minCount, maxDistance: maxDistance, entries: map[string]*entry{}}
+}
+
+// Get returns the tenant's last built dictionary, starting a build with load
+// when there is none yet or it is stale. It returns nil until the first
+// build has finished, so searches never wait for one.
+func (r *Registry) Get(tenant string, load LoadFunc) *Dictionary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.entries[tenant]
+	if !ok {
+		current = &entry{}
+		r.entries[tenant] = current
+	}
+	if !current.building && (!ok || time.Since(current.built) > r.ttl) {
+		current.building = true
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), buildTimeout)
+			defer cancel()
+			if err := r.build(ctx, tenant, load); err != nil {
+				log.Printf("Warning: failed to build spelling dictionary: %v", err)
+			}
+		}()
+	}
+	return current.dictionary
+}
+
+// Warm builds the tenant's dictionary now, so the first searches already
+// get corrections
+func (r *Registry) Warm(ctx context.Context, tenant string, load LoadFunc) error {
+	r.mu.Lock()
+	if _, ok := r.entries[tenant]; !ok {
+		r.entries[tenant] = &entry{building: true}
+	}
+	r.mu.Unlock()
+	return r.build(ctx, tenant, load)
+}
+
+// build replaces the tenant's dictionary; a failed build keeps the old one
+// until the next attempt after another TTL
+func (r *Registry) build(ctx context.Context, tenant string, load LoadFunc) error {
+	vocabulary, err := load(ctx, tenant)
+	var dictionary *Dictionary
+	if err == nil {
+		dictionary = NewDictionary(vocabulary, r.minCount, r.maxDistance)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current := r.entries[tenant]
+	current.building = false
+	current.built = time.Now()
+	if dictionary != nil {
+		current.dictionary = dictionary
+	}
+	return err
+}
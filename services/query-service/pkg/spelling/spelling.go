@@ -0,0 +1,249 @@
+package spelling
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// prefixLength is how much of a word its deletes are generated from, as in
+// SymSpell; longer words are told apart by the full distance check
+const prefixLength = 7
+
+// minWordLength is the shortest word corrected; shorter ones are too
+// ambiguous to correct
+const minWordLength = 3
+
+// Candidate is a known term close to a misspelled word
+type Candidate struct {
+	Term     string
+	Distance int
+	// Count is how often the term occurs in the indexed vocabulary
+	Count int
+}
+
+// Dictionary finds the known terms within a small edit distance of a word
+// through an index of the terms with characters deleted (symmetric delete
+// spelling correction), so a lookup costs a few map reads rather than a
+// comparison with every term
+type Dictionary struct {
+	maxDistance int
+	terms       map[string]int
+	deletes     map[string][]string
+}
+
+// NewDictionary indexes the terms, with their counts, that occur at least
+// minCount times. Terms are lower-cased; counts of terms differing only in
+// case are added up.
+func NewDictionary(vocabulary map[string]int, minCount, maxDistance int) *Dictionary {
+	d := &Dictionary{maxDistance: maxDistance, terms: map[string]int{}, deletes: map[string][]string{}}
+	for term, count := range vocabulary {
+		d.terms[strings.ToLower(term)] += count
+	}
+	for term, count := range d.terms {
+		if count < minCount || len([]rune(term)) < minWordLength {
+			delete(d.terms, term)
+			continue
+		}
+		for key := range deletes(prefix(term), maxDistance) {
+			d.deletes[key] = append(d.deletes[key], term)
+		}
+	}
+	return d
+}
+
+// Len is the number of terms known
+func (d *Dictionary) Len() int {
+	return len(d.terms)
+}
+
+// Contains reports whether the word is a known term
+func (d *Dictionary) Contains(word string) bool {
+	_, ok := d.terms[strings.ToLower(word)]
+	return ok
+}
+
+// Lookup returns the known terms within the dictionary's edit distance of
+// word, closest first and then the most common
+func (d *Dictionary) Lookup(word string) []Candidate {
+	word = strings.ToLower(word)
+	if count, ok := d.terms[word]; ok {
+		return []Candidate{{Term: word, Count: count}}
+	}
+	maxDistance := d.distanceFor(word)
+	seen := map[string]bool{}
+	var candidates []Candidate
+	for key := range deletes(prefix(word), maxDistance) {
+		for _, term := range d.deletes[key] {
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			if distance := Distance(word, term); distance <= maxDistance {
+				candidates = append(candidates, Candidate{Term: term, Distance: distance, Count: d.terms[term]})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Distance != candidates[j].Distance {
+			return candidates[i].Distance < candidates[j].Distance
+		}
+		if candidates[i].Count != candidates[j].Count {
+			return candidates[i].Count > candidates[j].Count
+		}
+		return candidates[i].Term < candidates[j].Term
+	})
+	return candidates
+}
+
+// distanceFor allows one edit in short words, where two would turn most
+// words into others
+func (d *Dictionary) distanceFor(word string) int {
+	if len([]rune(word)) <= 4 && d.maxDistance > 1 {
+		return 1
+	}
+	return d.maxDistance
+}
+
+// alternatives is how many corrections of one word are tried
+const alternatives = 3
+
+// Suggest returns up to limit corrections of the query, best first: every
+// unknown word replaced by its closest term, then each unknown word by its
+// next closest. Quoted phrases are corrected too, while operators, fuzzy
+// and wildcard terms and words with digits are left alone. A query whose
+// words are all known, or that has no close terms, gets none.
+func (d *Dictionary) Suggest(query string, limit int) []string {
+	if d == nil || len(d.terms) == 0 || limit <= 0 {
+		return nil
+	}
+	fields := strings.Fields(query)
+	corrections := make([][]string, len(fields))
+	misspelled := false
+	for i, field := range fields {
+		start, end := wordBounds(field)
+		word := field[start:end]
+		if !correctable(word) || d.Contains(word) {
+			continue
+		}
+		for _, candidate := range d.Lookup(word) {
+			replaced := field[:start] + candidate.Term + field[end:]
+			corrections[i] = append(corrections[i], replaced)
+			if len(corrections[i]) == alternatives {
+				break
+			}
+		}
+		misspelled = misspelled || len(corrections[i]) > 0
+	}
+	if !misspelled {
+		return nil
+	}
+
+	best := make([]string, len(fields))
+	for i, field := range fields {
+		best[i] = field
+		if len(corrections[i]) > 0 {
+			best[i] = corrections[i][0]
+		}
+	}
+	suggestions := []string{strings.Join(best, " ")}
+	for i := range fields {
+		for _, alternative := range corrections[i][min(1, len(corrections[i])):] {
+			if len(suggestions) == limit {
+				return suggestions
+			}
+			words := append([]string(nil), best...)
+			words[i] = alternative
+			suggestions = append(suggestions, strings.Join(words, " "))
+		}
+	}
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// wordBounds strips the quotes and punctuation around a word
+func wordBounds(field string) (int, int) {
+	isPunct := func(r rune) bool { return unicode.IsPunct(r) && r != '*' && r != '~' }
+	trimmed := strings.TrimLeftFunc(field, isPunct)
+	start := len(field) - len(trimmed)
+	return start, start + len(strings.TrimRightFunc(trimmed, isPunct))
+}
+
+// correctable reports whether word is long enough and made of letters only,
+// and is not an operator such as NEAR or OR
+func correctable(word string) bool {
+	if len([]rune(word)) < minWordLength {
+		return false
+	}
+	upper := true
+	for _, r := range word {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+		upper = upper && unicode.IsUpper(r)
+	}
+	return !upper
+}
+
+func prefix(word string) string {
+	runes := []rune(word)
+	if len(runes) > prefixLength {
+		return string(runes[:prefixLength])
+	}
+	return word
+}
+
+// deletes returns word and every string made by deleting up to distance
+// characters from it
+func deletes(word string, distance int) map[string]bool {
+	result := map[string]bool{word: true}
+	edits := []string{word}
+	for d := 0; d < distance; d++ {
+		var next []string
+		for _, edit := range edits {
+			runes := []rune(edit)
+			if len(runes) <= 1 {
+				continue
+			}
+			for i := range runes {
+				deleted := string(runes[:i]) + string(runes[i+1:])
+				if !result[deleted] {
+					result[deleted] = true
+					next = append(next, deleted)
+				}
+			}
+		}
+		edits = next
+	}
+	return result
+}
+
+// Distance is the optimal string alignment distance between a and b: the
+// insertions, deletions, substitutions and transpositions of adjacent
+// characters turning one into the other
+func Distance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	rows := make([][]int, len(s)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(t)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(s)][len(t)]
+}
@@ -0,0 +1,96 @@
+package spelling
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var vocabulary = map[string]int{
+	"sunset":       40,
+	"Sunset":       2,
+	"sunrise":      12,
+	"beach":        30,
+	"beech":        3,
+	"bench":        5,
+	"photographer": 8,
+	"harbour":      9,
+	"cologne":      6,
+	"typo":         1,
+	"at":           50,
+}
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, 0, Distance("beach", "beach"))
+	assert.Equal(t, 1, Distance("beach", "beech"))
+	assert.Equal(t, 1, Distance("sunest", "sunset"))
+	assert.Equal(t, 1, Distance("photograhper", "photographer"))
+	assert.Equal(t, 3, Distance("kitten", "sitting"))
+	assert.Equal(t, 1, Distance("köln", "koln"))
+}
+
+func TestLookup(t *testing.T) {
+	dictionary := NewDictionary(vocabulary, 2, 2)
+	// Rare and short terms are left out
+	assert.False(t, dictionary.Contains("typo"))
+	assert.False(t, dictionary.Contains("at"))
+	assert.True(t, dictionary.Contains("SUNSET"))
+
+	assert.Equal(t, []Candidate{{Term: "sunset", Count: 42}}, dictionary.Lookup("Sunset"))
+	assert.Equal(t, []Candidate{
+		{Term: "beach", Distance: 1, Count: 30},
+		{Term: "bench", Distance: 1, Count: 5},
+		{Term: "beech", Distance: 1, Count: 3},
+	}, dictionary.Lookup("becch"))
+
+	candidates := dictionary.Lookup("photograhper")
+	require.NotEmpty(t, candidates)
+	assert.Equal(t, "photographer", candidates[0].Term)
+
+	// Short words are corrected by one edit only
+	assert.Empty(t, dictionary.Lookup("bxxh"))
+	assert.Empty(t, dictionary.Lookup("zzzzzz"))
+}
+
+func TestSuggest(t *testing.T) {
+	dictionary := NewDictionary(vocabulary, 2, 2)
+
+	assert.Nil(t, dictionary.Suggest("sunset beach", 3))
+	assert.Equal(t, []string{"sunset at the beach", "sunset at the bench", "sunset at the beech"},
+		dictionary.Suggest("sunest at the beack", 3))
+	assert.Equal(t, []string{`"harbour crane" NEAR/3 cologne`},
+		dictionary.Suggest(`"harbur crane" NEAR/3 colgne`, 1))
+	// Fuzzy and wildcard terms, words with digits and operators stay as typed
+	assert.Nil(t, dictionary.Suggest("sunest~1 beac* b3ach NEAR", 3))
+	assert.Nil(t, dictionary.Suggest("zzzzzz", 3))
+	assert.Nil(t, (*Dictionary)(nil).Suggest("sunest", 3))
+}
+
+func TestRegistry(t *testing.T) {
+	var loads int32
+	load := func(ctx context.Context, tenant string) (map[string]int, error) {
+		atomic.AddInt32(&loads, 1)
+		if tenant == "broken" {
+			return nil, errors.New("connection refused")
+		}
+		return map[string]int{tenant + "word": 5}, nil
+	}
+	registry := NewRegistry(time.Hour, 1, 2)
+
+	// The first search does not wait for the dictionary
+	assert.Nil(t, registry.Get("acme", load))
+	require.Eventually(t, func() bool { return registry.Get("acme", load) != nil }, time.Second, time.Millisecond)
+	assert.True(t, registry.Get("acme", load).Contains("acmeword"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	require.NoError(t, registry.Warm(context.Background(), "globex", load))
+	assert.Equal(t, 1, registry.Get("globex", load).Len())
+
+	assert.Error(t, registry.Warm(context.Background(), "broken", load))
+	assert.Nil(t, registry.Get("broken", load))
+}
@@ -0,0 +1,211 @@
+package sqlviews
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/analytics"
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Default views: search_log over the search events in ClickHouse, without
+// trace ids, and asset_summary over assets in PostgreSQL
+const (
+	clickHouseViews = `
+		CREATE VIEW IF NOT EXISTS %s AS
+		SELECT timestamp, user_id, collection_id, endpoint, query, result_count, latency_ms, cache_hit
+		FROM %s`
+	postgresViews = `
+		CREATE OR REPLACE VIEW asset_summary AS
+		SELECT a.id::text AS asset_id,
+		       COALESCE(e.parent_id::text, '') AS collection_id,
+		       COALESCE(e.metadata->>'tenant_id', '') AS tenant_id,
+		       a.filename,
+		       a.mime_type,
+		       a.file_size,
+		       COALESCE(a.processing_status, '') AS processing_status,
+		       (SELECT count(*) FROM segments s WHERE s.asset_id = a.id) AS segment_count,
+		       e.created_at,
+		       e.updated_at
+		FROM assets a
+		JOIN entities e ON e.id = a.id`
+)
+
+// ErrTimeout is returned when a query runs longer than its timeout
+var ErrTimeout = errors.New("query timed out")
+
+// ErrNoRole is returned for PostgreSQL views when no restricted role is set
+var ErrNoRole = errors.New("no restricted PostgreSQL role is set")
+
+// StatementError is a statement the database rejected, such as one naming a
+// column the views lack
+type StatementError struct {
+	Message string
+}
+
+func (e *StatementError) Error() string {
+	return e.Message
+}
+
+// Result is the outcome of a query over the views
+type Result struct {
+	Backend string          `json:"backend"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	// Truncated is set when the query matched more than the row cap
+	Truncated bool `json:"truncated"`
+}
+
+// EnsurePostgresViews creates asset_summary
+func EnsurePostgresViews(ctx context.Context, pool *pgxpool.Pool) error {
+	if _, err := pool.Exec(ctx, postgresViews); err != nil {
+		return fmt.Errorf("failed to create asset_summary: %v", err)
+	}
+	return nil
+}
+
+// EnsureClickHouseViews creates search_log over the search events table
+func EnsureClickHouseViews(ctx context.Context, client *clickhouse.Client) error {
+	view, err := client.Table("search_log")
+	if err != nil {
+		return err
+	}
+	events, err := client.Table(analytics.SearchTable)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Exec(ctx, fmt.Sprintf(clickHouseViews, view, events), nil); err != nil {
+		return fmt.Errorf("failed to create %s: %v", view, err)
+	}
+	return nil
+}
+
+// RunPostgres runs a prepared query in a read-only transaction that
+// PostgreSQL cancels after timeout. The role is assumed for the
+// transaction, so grants confine it to the views as well; it is required.
+func RunPostgres(ctx context.Context, pool *pgxpool.Pool, role string, query Query, timeout time.Duration, maxRows int) (*Result, error) {
+	if role == "" {
+		return nil, ErrNoRole
+	}
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())); err != nil {
+		return nil, fmt.Errorf("failed to set statement timeout: %v", err)
+	}
+	if _, err := tx.Exec(ctx, "SET LOCAL ROLE "+pgx.Identifier{role}.Sanitize()); err != nil {
+		return nil, fmt.Errorf("failed to assume role %s: %v", role, err)
+	}
+
+	rows, err := tx.Query(ctx, query.Statement)
+	if err != nil {
+		return nil, postgresError(err)
+	}
+	defer rows.Close()
+
+	result := &Result{Backend: Postgres, Columns: []string{}, Rows: [][]interface{}{}}
+	for _, field := range rows.FieldDescriptions() {
+		result.Columns = append(result.Columns, string(field.Name))
+	}
+	for rows.Next() {
+		if len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		values, err := rows.Values()
+		if err != nil {
+			return nil, postgresError(err)
+		}
+		for i, value := range values {
+			values[i] = jsonValue(value)
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, postgresError(err)
+	}
+	return result, nil
+}
+
+// postgresError tells a cancelled or rejected statement from other failures
+func postgresError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch {
+	case pgErr.Code == "57014":
+		return ErrTimeout
+	case strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") || strings.HasPrefix(pgErr.Code, "XX"):
+		// Connection, resource and internal errors are the server's
+		return err
+	default:
+		return &StatementError{Message: pgErr.Message}
+	}
+}
+
+// jsonValue converts PostgreSQL values without a JSON form of their own,
+// such as UUIDs, to strings
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case [16]byte:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16])
+	case nil, bool, string, int16, int32, int64, float32, float64, time.Time, json.Marshaler:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// RunClickHouse runs a prepared query read-only, stopped by ClickHouse
+// after timeout
+func RunClickHouse(ctx context.Context, client *clickhouse.Client, query Query, timeout time.Duration, maxRows int) (*Result, error) {
+	body, err := client.Select(ctx, query.Statement+"\nFORMAT JSONCompact", map[string]string{
+		"max_execution_time": strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64),
+	})
+	var chErr *clickhouse.Error
+	if errors.As(err, &chErr) {
+		if strings.Contains(chErr.Message, "TIMEOUT_EXCEEDED") {
+			return nil, ErrTimeout
+		}
+		return nil, &StatementError{Message: chErr.Message}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Meta []struct {
+			Name string `json:"name"`
+		} `json:"meta"`
+		Data [][]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode clickhouse response: %v", err)
+	}
+
+	result := &Result{Backend: ClickHouse, Columns: []string{}, Rows: [][]interface{}{}}
+	for _, column := range response.Meta {
+		result.Columns = append(result.Columns, column.Name)
+	}
+	for _, row := range response.Data {
+		if len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, nil
+}
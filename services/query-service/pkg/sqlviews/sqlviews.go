@@ -0,0 +1,316 @@
+package sqlviews
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Backends a view can live in
+const (
+	ClickHouse = "clickhouse"
+	Postgres   = "postgres"
+)
+
+// Views maps each allowlisted view to its backend
+type Views map[string]string
+
+// ParseViews reads a comma-separated list of backend:view pairs, such as
+// clickhouse:search_log,postgres:asset_summary
+func ParseViews(spec string) (Views, error) {
+	views := Views{}
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		backend, name, ok := strings.Cut(entry, ":")
+		if !ok || (backend != ClickHouse && backend != Postgres) {
+			return nil, fmt.Errorf("invalid view %q: use clickhouse:name or postgres:name", entry)
+		}
+		if !isIdentifier(name) {
+			return nil, fmt.Errorf("invalid view name %q", name)
+		}
+		views[strings.ToLower(name)] = backend
+	}
+	return views, nil
+}
+
+// deniedKeywords are the words a statement may not use anywhere: those that
+// write, change settings or send results elsewhere
+var deniedKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "UPSERT": true,
+	"CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true, "RENAME": true,
+	"EXCHANGE": true, "ATTACH": true, "DETACH": true, "OPTIMIZE": true,
+	"GRANT": true, "REVOKE": true, "COPY": true, "INTO": true, "OUTFILE": true,
+	"SET": true, "SETTINGS": true, "FORMAT": true, "SYSTEM": true, "KILL": true,
+	"CALL": true, "LOCK": true, "TABLE": true,
+}
+
+// deniedFunctions read files, other servers or tables named in strings, or
+// run statements given as strings, so they could reach past the allowlist.
+// Functions starting with pg_ or dict are denied as well.
+var deniedFunctions = map[string]bool{
+	// ClickHouse table functions
+	"file": true, "url": true, "remote": true, "remotesecure": true, "s3": true,
+	"s3cluster": true, "gcs": true, "azureblobstorage": true, "hdfs": true,
+	"mysql": true, "postgresql": true, "jdbc": true, "odbc": true, "sqlite": true,
+	"mongodb": true, "redis": true, "input": true, "executable": true,
+	"cluster": true, "clusterallreplicas": true, "merge": true, "view": true,
+	"dictionary": true, "deltalake": true, "hudi": true, "iceberg": true,
+	"getsetting": true,
+	// PostgreSQL functions
+	"dblink": true, "dblink_exec": true, "lo_import": true, "lo_export": true,
+	"lo_get": true, "current_setting": true, "set_config": true,
+	"query_to_xml": true, "query_to_xml_and_xmlschema": true,
+	"cursor_to_xml": true, "table_to_xml": true, "table_to_xml_and_xmlschema": true,
+	"schema_to_xml": true, "database_to_xml": true, "ts_stat": true, "ts_rewrite": true,
+	// ClickHouse functions
+	"joinget": true, "joingetornull": true,
+}
+
+// fromEnding are the clauses that end a FROM list. Join conditions do not,
+// since another table may follow them after a comma.
+var fromEnding = map[string]bool{
+	"WHERE": true, "PREWHERE": true, "GROUP": true, "HAVING": true, "ORDER": true,
+	"LIMIT": true, "OFFSET": true, "UNION": true, "EXCEPT": true, "INTERSECT": true,
+	"WINDOW": true, "QUALIFY": true, "FETCH": true, "FOR": true,
+}
+
+// Query is a statement that passed Prepare, bounded to one row more than
+// the row cap so a truncated result can be told apart
+type Query struct {
+	Statement string
+	// Backend holds the Views the statement reads
+	Backend string
+	Views   []string
+}
+
+// frame is a parenthesized part of a statement, or the statement itself
+type frame struct {
+	// query is set when the part is a query rather than function arguments
+	query bool
+	// inFrom is set within a FROM list, where commas separate tables
+	inFrom bool
+	// expectTable is set where the next word names a table
+	expectTable bool
+	// cte is the common table expression the part defines, if any
+	cte string
+}
+
+// Prepare checks that a statement is a single SELECT reading only
+// allowlisted views, and common table expressions over them, of one
+// backend, and wraps it to return at most maxRows+1 rows. The check is
+// conservative: string literals and quoted names are never looked into, so
+// backslashes and $, which change how PostgreSQL reads them, are refused.
+func Prepare(statement string, views Views, maxRows int) (Query, error) {
+	statement = strings.TrimSpace(statement)
+	statement = strings.TrimSpace(strings.TrimSuffix(statement, ";"))
+	if statement == "" {
+		return Query{}, fmt.Errorf("statement is empty")
+	}
+	if strings.ContainsAny(statement, `\$`) {
+		return Query{}, fmt.Errorf("statements may not contain backslashes or $")
+	}
+	tokens, err := tokenize(statement)
+	if err != nil {
+		return Query{}, err
+	}
+	if first := strings.ToUpper(tokens[0].text); tokens[0].kind != word || (first != "SELECT" && first != "WITH") {
+		return Query{}, fmt.Errorf("statement must be a SELECT")
+	}
+
+	query := Query{}
+	ctes := map[string]bool{}
+	stack := []*frame{{query: true}}
+	for i, tok := range tokens {
+		current := stack[len(stack)-1]
+		var next, previous token
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+		if i > 0 {
+			previous = tokens[i-1]
+		}
+
+		switch {
+		case tok.text == ";":
+			return Query{}, fmt.Errorf("only one statement may be run at a time")
+		case tok.text == "(":
+			inner := &frame{query: next.kind == word && (strings.EqualFold(next.text, "SELECT") || strings.EqualFold(next.text, "WITH"))}
+			// A parenthesis where a table is expected, other than a
+			// subquery, groups joined tables, so those are checked too
+			if current.expectTable && !inner.query {
+				inner.query, inner.inFrom, inner.expectTable = true, true, true
+			}
+			// A parenthesis after name AS at the top level defines a CTE
+			if len(stack) == 1 && i >= 2 && strings.EqualFold(previous.text, "AS") && tokens[i-2].kind != punct {
+				inner.cte = tokens[i-2].name()
+			}
+			current.expectTable = false
+			stack = append(stack, inner)
+		case tok.text == ")":
+			if len(stack) == 1 {
+				return Query{}, fmt.Errorf("unbalanced parentheses")
+			}
+			if closed := stack[len(stack)-1]; closed.cte != "" {
+				ctes[closed.cte] = true
+			}
+			stack = stack[:len(stack)-1]
+		case tok.text == ",":
+			current.expectTable = current.inFrom
+		case tok.kind == punct:
+			current.expectTable = false
+		case current.expectTable:
+			upper := strings.ToUpper(tok.text)
+			if tok.kind == word && (upper == "LATERAL" || upper == "ONLY") {
+				continue
+			}
+			if next.text == "(" || next.text == "." {
+				return Query{}, fmt.Errorf("FROM may only name allowlisted views, common table expressions or subqueries")
+			}
+			name := tok.name()
+			current.expectTable = false
+			if ctes[name] {
+				continue
+			}
+			backend, ok := views[name]
+			if !ok {
+				return Query{}, fmt.Errorf("%s is not an allowlisted view", tok.text)
+			}
+			if query.Backend != "" && query.Backend != backend {
+				return Query{}, fmt.Errorf("a statement may not join %s views with %s views", query.Backend, backend)
+			}
+			query.Backend = backend
+			query.Views = append(query.Views, name)
+		case next.text == "(" && (tok.kind == quoted || previous.text == "."):
+			return Query{}, fmt.Errorf("functions may not be quoted or qualified")
+		case tok.kind == quoted || previous.text == ".":
+			// Quoted names and the parts of qualified names are not keywords
+		default:
+			upper := strings.ToUpper(tok.text)
+			lower := strings.ToLower(tok.text)
+			switch {
+			case deniedKeywords[upper]:
+				return Query{}, fmt.Errorf("%s is not allowed in a read-only statement", upper)
+			case next.text == "(" && (deniedFunctions[lower] || strings.HasPrefix(lower, "pg_") || strings.HasPrefix(lower, "dict")):
+				return Query{}, fmt.Errorf("function %s is not allowed", lower)
+			case upper == "FROM" && current.query && !strings.EqualFold(previous.text, "DISTINCT"):
+				current.inFrom, current.expectTable = true, true
+			case upper == "IN" && next.kind != punct:
+				// ClickHouse reads the right side of IN from a table it names
+				current.expectTable = true
+			case upper == "JOIN" && current.query && !strings.EqualFold(previous.text, "ARRAY"):
+				current.inFrom, current.expectTable = true, true
+			case fromEnding[upper]:
+				current.inFrom = false
+			}
+		}
+	}
+	if len(stack) != 1 {
+		return Query{}, fmt.Errorf("unbalanced parentheses")
+	}
+	if query.Backend == "" {
+		return Query{}, fmt.Errorf("statement must read from an allowlisted view")
+	}
+
+	query.Statement = fmt.Sprintf("SELECT * FROM (\n%s\n) AS _q\nLIMIT %d", statement, maxRows+1)
+	return query, nil
+}
+
+type tokenKind int
+
+const (
+	word tokenKind = iota
+	quoted
+	punct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// name returns the name a word or quoted name refers to; unquoted names
+// are case-insensitive
+func (t token) name() string {
+	if t.kind == word {
+		return strings.ToLower(t.text)
+	}
+	return t.text
+}
+
+// tokenize splits a statement into words, quoted names and punctuation,
+// skipping string literals and comments
+func tokenize(statement string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(statement[i:], "--"):
+			end := strings.IndexByte(statement[i:], '\n')
+			if end < 0 {
+				end = len(statement) - i
+			}
+			i += end
+		case strings.HasPrefix(statement[i:], "/*"):
+			end := strings.Index(statement[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			// A doubled quote stands for itself in both dialects
+			var text strings.Builder
+			end := i + 1
+			for {
+				if end >= len(statement) {
+					return nil, fmt.Errorf("unterminated %c", c)
+				}
+				if statement[end] == c {
+					if end+1 < len(statement) && statement[end+1] == c {
+						text.WriteByte(c)
+						end += 2
+						continue
+					}
+					break
+				}
+				text.WriteByte(statement[end])
+				end++
+			}
+			if c != '\'' {
+				tokens = append(tokens, token{kind: quoted, text: text.String()})
+			} else {
+				tokens = append(tokens, token{kind: punct, text: "'"})
+			}
+			i = end + 1
+		case isWordByte(c):
+			end := i
+			for end < len(statement) && isWordByte(statement[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: word, text: statement[i:end]})
+			i = end
+		default:
+			tokens = append(tokens, token{kind: punct, text: string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentifier(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isWordByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
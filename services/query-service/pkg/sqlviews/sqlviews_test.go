@@ -0,0 +1,113 @@
+package sqlviews
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testViews = Views{"search_log": ClickHouse, "asset_summary": Postgres, "asset_daily": Postgres}
+
+func TestParseViews(t *testing.T) {
+	views, err := ParseViews("clickhouse:search_log, postgres:Asset_Summary,")
+	require.NoError(t, err)
+	assert.Equal(t, Views{"search_log": ClickHouse, "asset_summary": Postgres}, views)
+
+	for _, spec := range []string{"search_log", "mysql:t", "postgres:a.b"} {
+		_, err := ParseViews(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	query, err := Prepare(`
+		WITH recent AS (SELECT * FROM asset_summary WHERE created_at > now() - interval '1 day')
+		SELECT r.mime_type, count(*), extract(hour FROM r.created_at) AS hour
+		FROM recent r
+		JOIN "asset_daily" d ON d.asset_id = r.asset_id, LATERAL (SELECT 1) x
+		WHERE r.filename <> 'DELETE FROM assets' -- not a delete
+		  AND r.tenant_id IS DISTINCT FROM d.tenant_id
+		GROUP BY 1, 3;`, testViews, 100)
+	require.NoError(t, err)
+	assert.Equal(t, Postgres, query.Backend)
+	assert.Equal(t, []string{"asset_summary", "asset_daily"}, query.Views)
+	assert.Contains(t, query.Statement, "SELECT * FROM (\n")
+	assert.Contains(t, query.Statement, "GROUP BY 1, 3\n) AS _q\nLIMIT 101")
+
+	query, err = Prepare("SELECT * FROM asset_summary a JOIN (asset_summary b JOIN asset_daily d ON true) ON a.asset_id = b.asset_id", testViews, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"asset_summary", "asset_summary", "asset_daily"}, query.Views)
+
+	query, err = Prepare("SELECT query, count() FROM search_log WHERE user_id IN (SELECT user_id FROM search_log LIMIT 5) GROUP BY query", testViews, 10)
+	require.NoError(t, err)
+	assert.Equal(t, ClickHouse, query.Backend)
+
+	for name, statement := range map[string]string{
+		"empty":                "",
+		"not a select":         "EXPLAIN SELECT * FROM asset_summary",
+		"no view":              "SELECT 1",
+		"other table":          "SELECT * FROM assets",
+		"qualified table":      "SELECT * FROM public.asset_summary",
+		"comma join":           "SELECT * FROM asset_summary a JOIN asset_summary b ON true, entities",
+		"subquery":             "SELECT (SELECT count(*) FROM api_keys) FROM asset_summary",
+		"array subquery":       "SELECT ARRAY(SELECT key FROM api_keys) FROM asset_summary",
+		"table command":        "SELECT * FROM asset_summary UNION TABLE assets",
+		"clickhouse in table":  "SELECT * FROM search_log WHERE user_id IN audit_events",
+		"shadowing cte":        "WITH assets AS (SELECT * FROM assets) SELECT * FROM assets JOIN asset_summary ON true",
+		"parenthesized join":   "SELECT * FROM asset_summary, (asset_summary x JOIN query_api_keys k ON true)",
+		"nested join":          "SELECT * FROM asset_summary a JOIN ((asset_summary b JOIN api_keys k ON true)) ON true",
+		"parenthesized table":  "SELECT * FROM asset_summary, (api_keys)",
+		"nested cte":           "SELECT * FROM (WITH x AS (SELECT 1) SELECT * FROM x) y, asset_summary",
+		"mixed backends":       "SELECT * FROM asset_summary, search_log",
+		"table function":       "SELECT * FROM url('http://example.com', CSV)",
+		"file read":            "SELECT pg_read_file('/etc/passwd') FROM asset_summary",
+		"query in string":      "SELECT query_to_xml('select * from api_keys', true, true, '') FROM asset_summary",
+		"qualified function":   "SELECT pg_catalog.query_to_xml('x', true, true, '') FROM asset_summary",
+		"two statements":       "SELECT * FROM asset_summary; DROP TABLE assets",
+		"writing cte":          "WITH d AS (DELETE FROM assets RETURNING *) SELECT * FROM asset_summary",
+		"settings":             "SELECT * FROM search_log SETTINGS readonly = 0",
+		"dollar quote":         "SELECT $$x$$ FROM asset_summary",
+		"backslash":            `SELECT 'a\' FROM asset_summary`,
+		"unterminated string":  "SELECT 'x FROM asset_summary",
+		"unbalanced":           "SELECT (1 FROM asset_summary",
+		"unterminated comment": "SELECT 1 FROM asset_summary /* x",
+	} {
+		_, err := Prepare(statement, testViews, 100)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRunPostgresNeedsRole(t *testing.T) {
+	query, err := Prepare("SELECT * FROM asset_summary", testViews, 10)
+	require.NoError(t, err)
+	_, err = RunPostgres(context.Background(), nil, "", query, time.Second, 10)
+	assert.ErrorIs(t, err, ErrNoRole)
+}
+
+func TestRunClickHouse(t *testing.T) {
+	var statement string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		statement = string(body)
+		assert.Equal(t, "2.5", r.URL.Query().Get("max_execution_time"))
+		w.Write([]byte(`{"meta": [{"name": "query", "type": "String"}], "data": [["cats"], ["dogs"], ["owls"]], "rows": 3}`))
+	}))
+	defer server.Close()
+
+	query, err := Prepare("SELECT query FROM search_log", testViews, 2)
+	require.NoError(t, err)
+	result, err := RunClickHouse(context.Background(), clickhouse.NewClient(server.URL, "", "", ""), query, 2500*time.Millisecond, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (\nSELECT query FROM search_log\n) AS _q\nLIMIT 3\nFORMAT JSONCompact", statement)
+	assert.Equal(t, []string{"query"}, result.Columns)
+	assert.Equal(t, [][]interface{}{{"cats"}, {"dogs"}}, result.Rows)
+	assert.True(t, result.Truncated)
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Presigner creates time-limited GET URLs for objects in S3-compatible
+// storage (MinIO) using AWS Signature Version 4 query authentication
+type Presigner struct {
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+	bucket    string
+	expiry    time.Duration
+}
+
+// NewPresigner creates a presigner for path-style URLs under endpoint/bucket.
+// An empty bucket signs objects at the endpoint root (virtual-hosted style).
+func NewPresigner(endpoint, region, accessKey, secretKey, bucket string, expiry time.Duration) (*Presigner, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage endpoint: %v", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid storage endpoint: %s", endpoint)
+	}
+	if expiry <= 0 || expiry > 7*24*time.Hour {
+		return nil, fmt.Errorf("presign expiry must be between 1s and 7 days")
+	}
+
+	return &Presigner{
+		endpoint:  parsed,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		bucket:    bucket,
+		expiry:    expiry,
+	}, nil
+}
+
+// PresignGet returns a URL granting read access to objectKey until now+expiry
+func (p *Presigner) PresignGet(objectKey string, now time.Time) string {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + p.region + "/s3/aws4_request"
+
+	path := "/" + strings.TrimPrefix(objectKey, "/")
+	if p.bucket != "" {
+		path = "/" + p.bucket + path
+	}
+	canonicalPath := encodeURI(path, false)
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    p.accessKey + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       fmt.Sprintf("%d", int(p.expiry.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	canonicalQuery := canonicalQueryString(query)
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		canonicalPath,
+		canonicalQuery,
+		"host:" + p.endpoint.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey(p.secretKey, date, p.region), stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s",
+		p.endpoint.Scheme, p.endpoint.Host, canonicalPath, canonicalQuery, signature)
+}
+
+func canonicalQueryString(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, encodeURI(key, true)+"="+encodeURI(params[key], true))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// encodeURI percent-encodes everything except unreserved characters, and
+// slashes too unless encodeSlash is false, as SigV4 requires
+func encodeURI(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		switch {
+		case ch >= 'A' && ch <= 'Z', ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// signingKey derives the SigV4 key for S3 requests signed on date
+func signingKey(secretKey, date, region string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
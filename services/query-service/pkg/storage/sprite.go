@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+)
+
+// SpriteManifest describes the preview sprite sheets of a video: frames
+// taken every Interval seconds, tiled left to right and top to bottom into
+// sheets of Columns x Rows frames. The analysis pipeline stores it in the
+// asset's metadata under preview_sprites.
+type SpriteManifest struct {
+	Interval    float64 `json:"interval"`
+	FrameWidth  int     `json:"frame_width"`
+	FrameHeight int     `json:"frame_height"`
+	Columns     int     `json:"columns"`
+	Rows        int     `json:"rows"`
+	FrameCount  int     `json:"frame_count"`
+	// Sheets are the object keys of the sheets, in order
+	Sheets []string `json:"sheets"`
+}
+
+// SpriteFrame locates one preview frame within a sheet, in pixels
+type SpriteFrame struct {
+	Sheet  int     `json:"sheet"`
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Time   float64 `json:"time"`
+}
+
+// Validate checks that the manifest describes usable sheets
+func (m SpriteManifest) Validate() error {
+	if m.Interval <= 0 || m.FrameWidth <= 0 || m.FrameHeight <= 0 || m.Columns <= 0 || m.Rows <= 0 {
+		return fmt.Errorf("interval, frame size and grid must be positive")
+	}
+	if len(m.Sheets) == 0 || m.FrameCount <= 0 {
+		return fmt.Errorf("at least one sheet and frame are required")
+	}
+	if m.FrameCount > len(m.Sheets)*m.Columns*m.Rows {
+		return fmt.Errorf("%d frames do not fit in %d sheets", m.FrameCount, len(m.Sheets))
+	}
+	return nil
+}
+
+// FrameAt returns the frame showing the video at seconds, clamped to the
+// first and last frame
+func (m SpriteManifest) FrameAt(seconds float64) SpriteFrame {
+	index := int(math.Floor(seconds / m.Interval))
+	if index < 0 || math.IsNaN(seconds) {
+		index = 0
+	}
+	if index >= m.FrameCount {
+		index = m.FrameCount - 1
+	}
+
+	perSheet := m.Columns * m.Rows
+	cell := index % perSheet
+	return SpriteFrame{
+		Sheet:  index / perSheet,
+		X:      (cell % m.Columns) * m.FrameWidth,
+		Y:      (cell / m.Columns) * m.FrameHeight,
+		Width:  m.FrameWidth,
+		Height: m.FrameHeight,
+		Time:   float64(index) * m.Interval,
+	}
+}
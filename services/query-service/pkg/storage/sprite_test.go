@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpriteFrameAt(t *testing.T) {
+	manifest := SpriteManifest{
+		Interval: 2, FrameWidth: 160, FrameHeight: 90, Columns: 5, Rows: 2, FrameCount: 14,
+		Sheets: []string{"previews/a/sprite-0.jpg", "previews/a/sprite-1.jpg"},
+	}
+	assert.NoError(t, manifest.Validate())
+
+	assert.Equal(t, SpriteFrame{Sheet: 0, X: 0, Y: 0, Width: 160, Height: 90}, manifest.FrameAt(-1))
+	assert.Equal(t, SpriteFrame{Sheet: 0, X: 160, Y: 90, Width: 160, Height: 90, Time: 12}, manifest.FrameAt(13.5))
+	assert.Equal(t, SpriteFrame{Sheet: 1, X: 0, Y: 0, Width: 160, Height: 90, Time: 20}, manifest.FrameAt(20))
+	// Past the end of the video the last frame is used
+	assert.Equal(t, SpriteFrame{Sheet: 1, X: 480, Y: 0, Width: 160, Height: 90, Time: 26}, manifest.FrameAt(600))
+}
+
+func TestSpriteManifestValidate(t *testing.T) {
+	valid := SpriteManifest{Interval: 1, FrameWidth: 160, FrameHeight: 90, Columns: 2, Rows: 2, FrameCount: 4, Sheets: []string{"s.jpg"}}
+	assert.NoError(t, valid.Validate())
+
+	tooMany := valid
+	tooMany.FrameCount = 5
+	assert.Error(t, tooMany.Validate())
+
+	noSheets := valid
+	noSheets.Sheets = nil
+	assert.Error(t, noSheets.Validate())
+
+	assert.Error(t, SpriteManifest{}.Validate())
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Availability tiers of an asset's media
+const (
+	// TierOnline media can be read immediately
+	TierOnline = "online"
+	// TierNearline media can be read immediately at a retrieval cost
+	TierNearline = "nearline"
+	// TierArchived media must be restored before it can be read
+	TierArchived = "archived"
+)
+
+// Tiers lists the availability tiers from fastest to slowest
+var Tiers = []string{TierOnline, TierNearline, TierArchived}
+
+// Classes maps S3 storage classes to availability tiers. Objects without a
+// storage class are in the default STANDARD class.
+var Classes = map[string]string{
+	"STANDARD":            TierOnline,
+	"REDUCED_REDUNDANCY":  TierOnline,
+	"INTELLIGENT_TIERING": TierOnline,
+	"EXPRESS_ONEZONE":     TierOnline,
+	"STANDARD_IA":         TierNearline,
+	"ONEZONE_IA":          TierNearline,
+	"GLACIER_IR":          TierNearline,
+	"GLACIER":             TierArchived,
+	"DEEP_ARCHIVE":        TierArchived,
+}
+
+// restoreEstimates are the standard retrieval times of the archive classes
+var restoreEstimates = map[string]time.Duration{
+	"GLACIER":      5 * time.Hour,
+	"DEEP_ARCHIVE": 12 * time.Hour,
+}
+
+// NormalizeClass upper-cases a storage class and defaults it to STANDARD
+func NormalizeClass(class string) string {
+	class = strings.ToUpper(strings.TrimSpace(class))
+	if class == "" {
+		return "STANDARD"
+	}
+	return class
+}
+
+// TierOf returns the availability tier of a storage class. Unknown classes
+// are reported online, as MinIO and most S3-compatible stores only have one.
+func TierOf(class string) string {
+	if tier, ok := Classes[NormalizeClass(class)]; ok {
+		return tier
+	}
+	return TierOnline
+}
+
+// RestoreEstimate returns how long restoring an object of the class takes
+// before it can be read, and false when the class needs no restore
+func RestoreEstimate(class string) (time.Duration, bool) {
+	estimate, ok := restoreEstimates[NormalizeClass(class)]
+	return estimate, ok
+}
+
+// ClassesIn lists the storage classes of a tier alphabetically
+func ClassesIn(tier string) []string {
+	var classes []string
+	for class, classTier := range Classes {
+		if classTier == tier {
+			classes = append(classes, class)
+		}
+	}
+	sort.Strings(classes)
+	return classes
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTierOf(t *testing.T) {
+	assert.Equal(t, TierOnline, TierOf(""))
+	assert.Equal(t, TierOnline, TierOf("standard"))
+	assert.Equal(t, TierOnline, TierOf("MINIO_CUSTOM"))
+	assert.Equal(t, TierNearline, TierOf("STANDARD_IA"))
+	assert.Equal(t, TierNearline, TierOf(" glacier_ir "))
+	assert.Equal(t, TierArchived, TierOf("GLACIER"))
+	assert.Equal(t, TierArchived, TierOf("DEEP_ARCHIVE"))
+}
+
+func TestRestoreEstimate(t *testing.T) {
+	estimate, ok := RestoreEstimate("deep_archive")
+	assert.True(t, ok)
+	assert.Equal(t, 12*time.Hour, estimate)
+
+	_, ok = RestoreEstimate("GLACIER_IR")
+	assert.False(t, ok)
+
+	// Every archived class has an estimate
+	for _, class := range ClassesIn(TierArchived) {
+		_, ok := RestoreEstimate(class)
+		assert.True(t, ok, class)
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Uploader writes objects to S3-compatible storage with requests signed by
+// AWS Signature Version 4 in the Authorization header
+type Uploader struct {
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+	bucket    string
+	client    *http.Client
+}
+
+// NewUploader creates an uploader for path-style URLs under endpoint/bucket
+func NewUploader(endpoint, region, accessKey, secretKey, bucket string) (*Uploader, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage endpoint: %v", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid storage endpoint: %s", endpoint)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("a bucket is required for uploads")
+	}
+
+	return &Uploader{
+		endpoint:  parsed,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		bucket:    bucket,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Bucket returns the bucket objects are written to
+func (u *Uploader) Bucket() string {
+	return u.bucket
+}
+
+// Put stores body as objectKey, replacing any object already there
+func (u *Uploader) Put(ctx context.Context, objectKey, contentType string, body []byte) error {
+	path := encodeURI("/"+u.bucket+"/"+strings.TrimPrefix(objectKey, "/"), false)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.endpoint.Scheme+"://"+u.endpoint.Host+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(hashed[:])
+	now := time.Now().UTC()
+	headers := map[string]string{
+		"content-type":         contentType,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Authorization", u.authorization(http.MethodPut, path, headers, payloadHash, now))
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", objectKey, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to upload %s: status %d: %s", objectKey, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// authorization signs a request for path, already URI encoded, with the
+// given headers and the host
+func (u *Uploader) authorization(method, path string, headers map[string]string, payloadHash string, now time.Time) string {
+	date := now.Format("20060102")
+	scope := date + "/" + u.region + "/s3/aws4_request"
+
+	signed := map[string]string{"host": u.endpoint.Host}
+	for name, value := range headers {
+		signed[strings.ToLower(name)] = strings.TrimSpace(value)
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		scope,
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(signingKey(u.secretKey, date, u.region), stringToSign))
+
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.accessKey, scope, signedHeaders, signature)
+}
@@ -0,0 +1,165 @@
+package suggest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/analytics"
+	"dataflux/query-service/pkg/cache"
+	"dataflux/query-service/pkg/clickhouse"
+)
+
+// Kinds of completion
+const (
+	// KindQuery is a search other users ran
+	KindQuery = "query"
+	// KindFilename is the filename of an asset
+	KindFilename = "filename"
+	// KindTag is a tag assets carry
+	KindTag = "tag"
+)
+
+// kindWeights rank logged queries, which reflect what users actually look
+// for, above tags and tags above filenames
+var kindWeights = map[string]float64{
+	KindQuery:    1,
+	KindTag:      0.7,
+	KindFilename: 0.5,
+}
+
+// infixPenalty scales completions that match the prefix inside the text
+// rather than at its start, such as a word in the middle of a filename
+const infixPenalty = 0.8
+
+// Candidate is a completion found by one source
+type Candidate struct {
+	Text string
+	Kind string
+	// Count is how many users ran the query, or how many assets carry the
+	// filename or tag
+	Count int
+}
+
+// Suggestion is a ranked completion of what the user is typing
+type Suggestion struct {
+	Text  string  `json:"text"`
+	Kind  string  `json:"kind"`
+	Score float64 `json:"score"`
+	Count int     `json:"count"`
+}
+
+// Rank scores each candidate by its count's share of the largest of its
+// kind, times the kind's weight, and returns the best limit. Candidates
+// differing only in case are merged into the best scored.
+func Rank(candidates []Candidate, prefix string, limit int) []Suggestion {
+	prefix = cache.NormalizeText(prefix)
+	maxCounts := map[string]int{}
+	for _, candidate := range candidates {
+		if candidate.Count > maxCounts[candidate.Kind] {
+			maxCounts[candidate.Kind] = candidate.Count
+		}
+	}
+
+	byText := map[string]Suggestion{}
+	for _, candidate := range candidates {
+		score := kindWeights[candidate.Kind]
+		if maxCounts[candidate.Kind] > 0 {
+			score *= float64(candidate.Count) / float64(maxCounts[candidate.Kind])
+		}
+		normalized := cache.NormalizeText(candidate.Text)
+		if !strings.HasPrefix(normalized, prefix) {
+			score *= infixPenalty
+		}
+		if best, ok := byText[normalized]; ok && best.Score >= score {
+			continue
+		}
+		byText[normalized] = Suggestion{Text: candidate.Text, Kind: candidate.Kind, Score: score, Count: candidate.Count}
+	}
+
+	suggestions := make([]Suggestion, 0, len(byText))
+	for _, suggestion := range byText {
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Text < suggestions[j].Text
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// QueryLog completes prefixes with the searches logged in ClickHouse
+type QueryLog struct {
+	client   *clickhouse.Client
+	window   time.Duration
+	minUsers int
+}
+
+// NewQueryLog completes from the searches of the last window. A query is
+// only suggested once minUsers distinct users ran it, so rare and possibly
+// personal searches are never shown to others.
+func NewQueryLog(client *clickhouse.Client, window time.Duration, minUsers int) *QueryLog {
+	return &QueryLog{client: client, window: window, minUsers: minUsers}
+}
+
+// Enabled reports whether a ClickHouse URL is configured
+func (l *QueryLog) Enabled() bool {
+	return l != nil && l.client.Enabled()
+}
+
+// Complete returns up to limit logged queries starting with prefix, most
+// users first. Without ClickHouse there are none.
+func (l *QueryLog) Complete(ctx context.Context, prefix string, limit int) ([]Candidate, error) {
+	normalized := cache.NormalizeText(prefix)
+	if !l.Enabled() || normalized == "" {
+		return []Candidate{}, nil
+	}
+	table, err := l.client.Table(analytics.SearchTable)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := l.client.Exec(ctx, fmt.Sprintf(`
+		SELECT %[2]s AS normalized, uniqExact(user_id) AS users
+		FROM %[1]s
+		WHERE timestamp >= {since:DateTime('UTC')} AND user_id != ''
+		  AND startsWith(normalized, {prefix:String}) AND normalized != {prefix:String}
+		GROUP BY normalized
+		HAVING users >= {min_users:UInt32}
+		ORDER BY users DESC, normalized
+		LIMIT {limit:UInt32}
+		FORMAT JSON`, table, analytics.NormalizedQuery), map[string]string{
+		"prefix":    normalized,
+		"since":     time.Now().UTC().Add(-l.window).Format("2006-01-02 15:04:05"),
+		"min_users": strconv.Itoa(l.minUsers),
+		"limit":     strconv.Itoa(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query search log: %v", err)
+	}
+
+	var result struct {
+		Data []struct {
+			Normalized string      `json:"normalized"`
+			Users      json.Number `json:"users"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode search log result: %v", err)
+	}
+	candidates := make([]Candidate, 0, len(result.Data))
+	for _, row := range result.Data {
+		users, _ := row.Users.Int64()
+		candidates = append(candidates, Candidate{Text: row.Normalized, Kind: KindQuery, Count: int(users)})
+	}
+	return candidates, nil
+}
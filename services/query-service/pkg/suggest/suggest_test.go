@@ -0,0 +1,61 @@
+package suggest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dataflux/query-service/pkg/clickhouse"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRank(t *testing.T) {
+	suggestions := Rank([]Candidate{
+		{Text: "sunset beach", Kind: KindQuery, Count: 10},
+		{Text: "sunset", Kind: KindQuery, Count: 5},
+		{Text: "Sunset", Kind: KindTag, Count: 40},
+		{Text: "beach_sunset_01.mp4", Kind: KindFilename, Count: 1},
+		{Text: "sunrise", Kind: KindTag, Count: 4},
+	}, "Sun", 4)
+
+	require.Len(t, suggestions, 4)
+	assert.Equal(t, Suggestion{Text: "sunset beach", Kind: KindQuery, Score: 1, Count: 10}, suggestions[0])
+	// The tag outranks the query differing only in case
+	assert.Equal(t, "Sunset", suggestions[1].Text)
+	assert.Equal(t, KindTag, suggestions[1].Kind)
+	assert.InDelta(t, 0.7, suggestions[1].Score, 1e-9)
+	// The filename matches inside rather than at its start
+	assert.Equal(t, "beach_sunset_01.mp4", suggestions[2].Text)
+	assert.InDelta(t, 0.4, suggestions[2].Score, 1e-9)
+	assert.Equal(t, "sunrise", suggestions[3].Text)
+}
+
+func TestQueryLogComplete(t *testing.T) {
+	var statement, prefix string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		statement = string(body)
+		prefix = r.URL.Query().Get("param_prefix")
+		w.Write([]byte(`{"data":[{"normalized":"sunset beach","users":"8"}]}`))
+	}))
+	defer server.Close()
+
+	log := NewQueryLog(clickhouse.NewClient(server.URL, "", "", "dataflux"), 0, 3)
+	candidates, err := log.Complete(context.Background(), "  Sunset ", 5)
+	require.NoError(t, err)
+	assert.Contains(t, statement, "FROM dataflux.search_events")
+	assert.Equal(t, "sunset", prefix)
+	assert.Equal(t, []Candidate{{Text: "sunset beach", Kind: KindQuery, Count: 8}}, candidates)
+}
+
+func TestQueryLogDisabled(t *testing.T) {
+	log := NewQueryLog(clickhouse.NewClient("", "", "", "dataflux"), 0, 3)
+	assert.False(t, log.Enabled())
+	candidates, err := log.Complete(context.Background(), "sunset", 5)
+	require.NoError(t, err)
+	assert.Empty(t, candidates)
+}
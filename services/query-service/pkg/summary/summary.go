@@ -0,0 +1,138 @@
+package summary
+
+import (
+	"fmt"
+	"strings"
+
+	"dataflux/query-service/pkg/ask"
+	"dataflux/query-service/pkg/llm"
+)
+
+// Segment is what one segment of an asset shows
+type Segment struct {
+	StartTime   float64
+	EndTime     float64
+	Description string
+	Objects     []string
+	Text        string
+}
+
+// Document is what is known about one asset for a summary
+type Document struct {
+	// Number is how the prompt and the summary refer to the asset, from 1
+	Number   int
+	AssetID  string
+	Filename string
+	MimeType string
+	Segments []Segment
+	// Transcript is what is said in the asset, in speaking order
+	Transcript string
+}
+
+// Budgets that keep a prompt within the context of small models. A single
+// asset is shown in more detail than each asset of a result set.
+const (
+	assetSegments        = 60
+	assetTranscriptRunes = 12000
+	setSegments          = 8
+	setTranscriptRunes   = 1500
+)
+
+const assetSystemPrompt = `You summarize an asset of a media archive for an editor deciding whether to use it.
+Use only the segment descriptions and transcript you are given; do not guess beyond them.
+Write a short paragraph on what the asset shows and what is said, then list its key moments with their timecodes.`
+
+const setSystemPrompt = `You summarize search results from a media archive for an editor asking what was captured about a topic.
+Use only the numbered assets you are given; do not guess beyond them.
+Cite the assets behind every statement by their number in square brackets, such as [1] or [2, 3].
+Group related assets into themes rather than describing each in turn.`
+
+// AssetPrompt builds the chat messages asking for a summary of one asset,
+// written in language when one is given
+func AssetPrompt(doc Document, language string) []llm.Message {
+	var content strings.Builder
+	writeDocument(&content, doc, assetSegments, assetTranscriptRunes)
+	return []llm.Message{
+		{Role: llm.RoleSystem, Content: assetSystemPrompt + languageInstruction(language)},
+		{Role: llm.RoleUser, Content: content.String() + "Summarize this asset."},
+	}
+}
+
+// ResultSetPrompt builds the chat messages asking for a summary of what the
+// documents, the results of a search for query, capture
+func ResultSetPrompt(query string, docs []Document, language string) []llm.Message {
+	var content strings.Builder
+	for _, doc := range docs {
+		fmt.Fprintf(&content, "[%d] ", doc.Number)
+		writeDocument(&content, doc, setSegments, setTranscriptRunes)
+	}
+	request := "Summarize what these assets capture"
+	if query != "" {
+		request += " about: " + query
+	}
+	return []llm.Message{
+		{Role: llm.RoleSystem, Content: setSystemPrompt + languageInstruction(language)},
+		{Role: llm.RoleUser, Content: content.String() + request},
+	}
+}
+
+// Cited returns the documents a summary cites, in the order first cited
+func Cited(text string, docs []Document) []Document {
+	cited := []Document{}
+	for _, number := range ask.CitedNumbers(text, len(docs)) {
+		cited = append(cited, docs[number-1])
+	}
+	return cited
+}
+
+func languageInstruction(language string) string {
+	if language == "" {
+		return ""
+	}
+	return "\nWrite in the language with code " + language + "."
+}
+
+// writeDocument writes the metadata, the first maxSegments segments and
+// at most maxRunes of the transcript of doc
+func writeDocument(b *strings.Builder, doc Document, maxSegments, maxRunes int) {
+	fmt.Fprintf(b, "asset %s", doc.AssetID)
+	if doc.Filename != "" {
+		fmt.Fprintf(b, ", %s", doc.Filename)
+	}
+	if doc.MimeType != "" {
+		fmt.Fprintf(b, " (%s)", doc.MimeType)
+	}
+	b.WriteString("\n")
+
+	segments := doc.Segments
+	if len(segments) > maxSegments {
+		segments = segments[:maxSegments]
+	}
+	if len(segments) > 0 {
+		b.WriteString("Segments:\n")
+	}
+	for _, segment := range segments {
+		fmt.Fprintf(b, "- %s-%s", ask.Timecode(segment.StartTime), ask.Timecode(segment.EndTime))
+		if segment.Description != "" {
+			fmt.Fprintf(b, " %s", segment.Description)
+		}
+		if len(segment.Objects) > 0 {
+			fmt.Fprintf(b, " (objects: %s)", strings.Join(segment.Objects, ", "))
+		}
+		if segment.Text != "" {
+			fmt.Fprintf(b, " (on screen: %s)", segment.Text)
+		}
+		b.WriteString("\n")
+	}
+	if len(doc.Segments) > maxSegments {
+		fmt.Fprintf(b, "- … %d more segments\n", len(doc.Segments)-maxSegments)
+	}
+
+	if transcript := []rune(strings.TrimSpace(doc.Transcript)); len(transcript) > 0 {
+		if len(transcript) > maxRunes {
+			transcript = append(transcript[:maxRunes], '…')
+		}
+		fmt.Fprintf(b, "Transcript:\n%s\n", string(transcript))
+	}
+	b.WriteString("\n")
+}
@@ -0,0 +1,57 @@
+package summary
+
+import (
+	"strings"
+	"testing"
+
+	"dataflux/query-service/pkg/llm"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssetPrompt(t *testing.T) {
+	doc := Document{
+		AssetID:  "a1",
+		Filename: "flood.mp4",
+		MimeType: "video/mp4",
+		Segments: []Segment{
+			{StartTime: 0, EndTime: 12, Description: "river over its banks", Objects: []string{"river", "house"}},
+			{StartTime: 65, EndTime: 90, Description: "mayor at a press conference", Text: "City Hall"},
+		},
+		Transcript: strings.Repeat("x", assetTranscriptRunes+10),
+	}
+	messages := AssetPrompt(doc, "de")
+	require.Len(t, messages, 2)
+	assert.Equal(t, llm.RoleSystem, messages[0].Role)
+	assert.Contains(t, messages[0].Content, "language with code de")
+	assert.Contains(t, messages[1].Content, "asset a1, flood.mp4 (video/mp4)\n")
+	assert.Contains(t, messages[1].Content, "- 00:00:00-00:00:12 river over its banks (objects: river, house)\n")
+	assert.Contains(t, messages[1].Content, "- 00:01:05-00:01:30 mayor at a press conference (on screen: City Hall)\n")
+	assert.Contains(t, messages[1].Content, "Transcript:\n"+strings.Repeat("x", assetTranscriptRunes)+"…\n")
+
+	assert.NotContains(t, AssetPrompt(doc, "")[0].Content, "language")
+}
+
+func TestResultSetPrompt(t *testing.T) {
+	docs := []Document{{Number: 1, AssetID: "a1"}, {Number: 2, AssetID: "a2"}}
+	for i := 0; i < setSegments+3; i++ {
+		docs[1].Segments = append(docs[1].Segments, Segment{Description: "scene"})
+	}
+	messages := ResultSetPrompt("flood", docs, "")
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[1].Content, "[1] asset a1\n")
+	assert.Contains(t, messages[1].Content, "[2] asset a2\n")
+	assert.Equal(t, setSegments, strings.Count(messages[1].Content, "scene"))
+	assert.Contains(t, messages[1].Content, "- … 3 more segments\n")
+	assert.True(t, strings.HasSuffix(messages[1].Content, "capture about: flood"))
+}
+
+func TestCited(t *testing.T) {
+	docs := []Document{{Number: 1, AssetID: "a1"}, {Number: 2, AssetID: "a2"}, {Number: 3, AssetID: "a3"}}
+	cited := Cited("Rescue boats [3] and the dam [1, 3] [9].", docs)
+	require.Len(t, cited, 2)
+	assert.Equal(t, "a3", cited[0].AssetID)
+	assert.Equal(t, "a1", cited[1].AssetID)
+	assert.Empty(t, Cited("Nothing cited.", docs))
+}
@@ -0,0 +1,350 @@
+package taxonomy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"dataflux/query-service/pkg/neo4j"
+)
+
+// Direction controls which way the hierarchy is walked during expansion
+type Direction string
+
+const (
+	DirectionNone     Direction = "none"
+	DirectionNarrower Direction = "narrower"
+	DirectionBroader  Direction = "broader"
+	DirectionBoth     Direction = "both"
+)
+
+// MaxDepth bounds variable-length traversals so a badly shaped vocabulary
+// cannot turn one expansion into a full graph scan
+const MaxDepth = 5
+
+// CypherExecutor is the subset of the Neo4j client used by the taxonomy
+type CypherExecutor interface {
+	ExecuteCypher(query string, parameters map[string]interface{}) (*neo4j.CypherResponse, error)
+}
+
+// Term represents a controlled vocabulary entry
+type Term struct {
+	ID        string   `json:"id"`
+	Label     string   `json:"label" binding:"required"`
+	Scheme    string   `json:"scheme"`
+	Synonyms  []string `json:"synonyms"`
+	Broader   []string `json:"broader,omitempty"`
+	Narrower  []string `json:"narrower,omitempty"`
+	CreatedAt string   `json:"created_at,omitempty"`
+}
+
+// Client manages taxonomy terms stored in Neo4j
+type Client struct {
+	executor CypherExecutor
+}
+
+// NewClient creates a new taxonomy client
+func NewClient(executor CypherExecutor) *Client {
+	return &Client{executor: executor}
+}
+
+// ParseDirection converts a request value into a Direction
+func ParseDirection(value string) (Direction, error) {
+	switch Direction(strings.ToLower(strings.TrimSpace(value))) {
+	case "", DirectionNarrower:
+		return DirectionNarrower, nil
+	case DirectionNone:
+		return DirectionNone, nil
+	case DirectionBroader:
+		return DirectionBroader, nil
+	case DirectionBoth:
+		return DirectionBoth, nil
+	}
+	return "", fmt.Errorf("invalid taxonomy direction: %s", value)
+}
+
+// TermID derives the stable identifier for a label
+func TermID(label string) string {
+	return strings.Join(strings.Fields(strings.ToLower(label)), "_")
+}
+
+// EnsureSchema creates the uniqueness constraint for term identifiers
+func (c *Client) EnsureSchema() error {
+	_, err := c.executor.ExecuteCypher(
+		`CREATE CONSTRAINT term_id_unique IF NOT EXISTS FOR (t:Term) REQUIRE t.term_id IS UNIQUE`,
+		nil,
+	)
+	return err
+}
+
+// CreateTerm creates or updates a term node
+func (c *Client) CreateTerm(term Term) (*Term, error) {
+	if strings.TrimSpace(term.Label) == "" {
+		return nil, fmt.Errorf("term label is required")
+	}
+	if term.ID == "" {
+		term.ID = TermID(term.Label)
+	}
+	if term.Scheme == "" {
+		term.Scheme = "default"
+	}
+	if term.Synonyms == nil {
+		term.Synonyms = []string{}
+	}
+	term.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	query := `
+		MERGE (t:Term {term_id: $term_id})
+		ON CREATE SET t.created_at = $created_at
+		SET t.label = $label,
+		    t.label_lower = toLower($label),
+		    t.scheme = $scheme,
+		    t.synonyms = $synonyms
+		RETURN t.created_at
+	`
+
+	parameters := map[string]interface{}{
+		"term_id":    term.ID,
+		"label":      term.Label,
+		"scheme":     term.Scheme,
+		"synonyms":   term.Synonyms,
+		"created_at": term.CreatedAt,
+	}
+
+	resp, err := c.executor.ExecuteCypher(query, parameters)
+	if err != nil {
+		return nil, err
+	}
+	if rows := firstRows(resp); len(rows) > 0 {
+		if createdAt, ok := rows[0][0].(string); ok {
+			term.CreatedAt = createdAt
+		}
+	}
+
+	return &term, nil
+}
+
+// GetTerm retrieves a term together with its direct broader and narrower terms
+func (c *Client) GetTerm(termID string) (*Term, error) {
+	query := `
+		MATCH (t:Term {term_id: $term_id})
+		OPTIONAL MATCH (t)-[:BROADER]->(b:Term)
+		OPTIONAL MATCH (n:Term)-[:BROADER]->(t)
+		RETURN t.term_id, t.label, t.scheme, t.synonyms, t.created_at,
+		       collect(DISTINCT b.term_id), collect(DISTINCT n.term_id)
+	`
+
+	resp, err := c.executor.ExecuteCypher(query, map[string]interface{}{"term_id": termID})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := firstRows(resp)
+	if len(rows) == 0 || len(rows[0]) < 7 {
+		return nil, nil
+	}
+
+	row := rows[0]
+	term := &Term{
+		ID:        toString(row[0]),
+		Label:     toString(row[1]),
+		Scheme:    toString(row[2]),
+		Synonyms:  toStrings(row[3]),
+		CreatedAt: toString(row[4]),
+		Broader:   toStrings(row[5]),
+		Narrower:  toStrings(row[6]),
+	}
+	return term, nil
+}
+
+// ListTerms lists terms, optionally restricted to one scheme
+func (c *Client) ListTerms(scheme string, limit int) ([]Term, error) {
+	query := `
+		MATCH (t:Term)
+		WHERE $scheme = '' OR t.scheme = $scheme
+		RETURN t.term_id, t.label, t.scheme, t.synonyms, t.created_at
+		ORDER BY t.label
+		LIMIT $limit
+	`
+
+	resp, err := c.executor.ExecuteCypher(query, map[string]interface{}{
+		"scheme": scheme,
+		"limit":  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	terms := []Term{}
+	for _, row := range firstRows(resp) {
+		if len(row) < 5 {
+			continue
+		}
+		terms = append(terms, Term{
+			ID:        toString(row[0]),
+			Label:     toString(row[1]),
+			Scheme:    toString(row[2]),
+			Synonyms:  toStrings(row[3]),
+			CreatedAt: toString(row[4]),
+		})
+	}
+	return terms, nil
+}
+
+// DeleteTerm removes a term and all of its relations
+func (c *Client) DeleteTerm(termID string) error {
+	_, err := c.executor.ExecuteCypher(
+		`MATCH (t:Term {term_id: $term_id}) DETACH DELETE t`,
+		map[string]interface{}{"term_id": termID},
+	)
+	return err
+}
+
+// AddBroader links a term to a broader term, rejecting links that would form a cycle
+func (c *Client) AddBroader(termID, broaderID string) error {
+	if termID == broaderID {
+		return fmt.Errorf("a term cannot be broader than itself")
+	}
+
+	cycleCheck := `
+		MATCH (b:Term {term_id: $broader_id}), (t:Term {term_id: $term_id})
+		RETURN EXISTS { (b)-[:BROADER*1..]->(t) }
+	`
+	resp, err := c.executor.ExecuteCypher(cycleCheck, map[string]interface{}{
+		"term_id":    termID,
+		"broader_id": broaderID,
+	})
+	if err != nil {
+		return err
+	}
+	rows := firstRows(resp)
+	if len(rows) == 0 {
+		return fmt.Errorf("term not found: %s or %s", termID, broaderID)
+	}
+	if cyclic, ok := rows[0][0].(bool); ok && cyclic {
+		return fmt.Errorf("linking %s under %s would create a cycle", termID, broaderID)
+	}
+
+	query := `
+		MATCH (t:Term {term_id: $term_id}), (b:Term {term_id: $broader_id})
+		MERGE (t)-[r:BROADER]->(b)
+		ON CREATE SET r.created_at = datetime()
+		RETURN t.term_id
+	`
+	_, err = c.executor.ExecuteCypher(query, map[string]interface{}{
+		"term_id":    termID,
+		"broader_id": broaderID,
+	})
+	return err
+}
+
+// RemoveBroader removes the link between a term and a broader term
+func (c *Client) RemoveBroader(termID, broaderID string) error {
+	_, err := c.executor.ExecuteCypher(
+		`MATCH (:Term {term_id: $term_id})-[r:BROADER]->(:Term {term_id: $broader_id}) DELETE r`,
+		map[string]interface{}{"term_id": termID, "broader_id": broaderID},
+	)
+	return err
+}
+
+// Expand returns the input labels plus the labels and synonyms of every term
+// reachable in the given direction within depth hops
+func (c *Client) Expand(labels []string, direction Direction, depth int) ([]string, error) {
+	if len(labels) == 0 || direction == DirectionNone {
+		return labels, nil
+	}
+	if depth <= 0 || depth > MaxDepth {
+		depth = MaxDepth
+	}
+
+	lowered := make([]string, 0, len(labels))
+	for _, label := range labels {
+		lowered = append(lowered, strings.ToLower(label))
+	}
+
+	// Variable-length bounds cannot be parameterized, depth is clamped above
+	narrower := fmt.Sprintf("(t)<-[:BROADER*0..%d]-(x:Term)", depth)
+	broader := fmt.Sprintf("(t)-[:BROADER*0..%d]->(x:Term)", depth)
+	var patterns []string
+	switch direction {
+	case DirectionNarrower:
+		patterns = []string{narrower}
+	case DirectionBroader:
+		patterns = []string{broader}
+	default:
+		// Ancestors and descendants only: an undirected path could climb and
+		// descend again, reaching siblings and cousins
+		patterns = []string{narrower, broader}
+	}
+
+	matches := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		matches[i] = fmt.Sprintf(`
+		MATCH (t:Term)
+		WHERE t.label_lower IN $labels OR any(s IN t.synonyms WHERE toLower(s) IN $labels)
+		MATCH %s
+		RETURN DISTINCT x.label, x.synonyms`, pattern)
+	}
+	query := strings.Join(matches, "\n\t\tUNION") + "\n"
+
+	resp, err := c.executor.ExecuteCypher(query, map[string]interface{}{"labels": lowered})
+	if err != nil {
+		return labels, err
+	}
+
+	seen := make(map[string]bool)
+	expanded := []string{}
+	add := func(value string) {
+		key := strings.ToLower(strings.TrimSpace(value))
+		if key == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		expanded = append(expanded, key)
+	}
+
+	for _, label := range labels {
+		add(label)
+	}
+	for _, row := range firstRows(resp) {
+		if len(row) < 2 {
+			continue
+		}
+		add(toString(row[0]))
+		for _, synonym := range toStrings(row[1]) {
+			add(synonym)
+		}
+	}
+
+	return expanded, nil
+}
+
+func firstRows(resp *neo4j.CypherResponse) [][]interface{} {
+	if resp == nil || len(resp.Results) == 0 {
+		return nil
+	}
+	rows := make([][]interface{}, 0, len(resp.Results[0].Data))
+	for _, data := range resp.Results[0].Data {
+		rows = append(rows, data.Row)
+	}
+	return rows
+}
+
+func toString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return ""
+}
+
+func toStrings(value interface{}) []string {
+	values := []string{}
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
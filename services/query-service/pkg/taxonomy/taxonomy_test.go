@@ -0,0 +1,167 @@
+package taxonomy
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"dataflux/query-service/pkg/neo4j"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeExecutor struct {
+	queries []string
+	params  []map[string]interface{}
+	rows    [][]interface{}
+}
+
+func (f *fakeExecutor) ExecuteCypher(query string, parameters map[string]interface{}) (*neo4j.CypherResponse, error) {
+	f.queries = append(f.queries, query)
+	f.params = append(f.params, parameters)
+
+	resp := &neo4j.CypherResponse{}
+	resp.Results = make([]struct {
+		Columns []string `json:"columns"`
+		Data    []struct {
+			Row []interface{} `json:"row"`
+		} `json:"data"`
+	}, 1)
+	for _, row := range f.rows {
+		resp.Results[0].Data = append(resp.Results[0].Data, struct {
+			Row []interface{} `json:"row"`
+		}{Row: row})
+	}
+	return resp, nil
+}
+
+func TestExpandNarrower(t *testing.T) {
+	executor := &fakeExecutor{rows: [][]interface{}{
+		{"Vehicle", []interface{}{}},
+		{"Car", []interface{}{"automobile"}},
+		{"Truck", []interface{}{}},
+	}}
+	client := NewClient(executor)
+
+	expanded, err := client.Expand([]string{"Vehicle"}, DirectionNarrower, 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vehicle", "car", "automobile", "truck"}, expanded)
+	assert.Contains(t, executor.queries[0], "(t)<-[:BROADER*0..2]-(x:Term)")
+	assert.Equal(t, []string{"vehicle"}, executor.params[0]["labels"])
+}
+
+// graphExecutor evaluates the BROADER traversals of Expand over terms and
+// their broader terms, keyed by label
+type graphExecutor struct {
+	broader map[string][]string
+	queries []string
+}
+
+var traversal = regexp.MustCompile(`\(t\)(<?-)\[:BROADER\*0\.\.(\d+)\](->?)\(x:Term\)`)
+
+func (g *graphExecutor) ExecuteCypher(query string, parameters map[string]interface{}) (*neo4j.CypherResponse, error) {
+	g.queries = append(g.queries, query)
+	neighbours := func(label string, up, down bool) []string {
+		var next []string
+		if up {
+			next = append(next, g.broader[label]...)
+		}
+		if down {
+			for child, parents := range g.broader {
+				for _, parent := range parents {
+					if parent == label {
+						next = append(next, child)
+					}
+				}
+			}
+		}
+		return next
+	}
+
+	var rows [][]interface{}
+	seen := map[string]bool{}
+	for _, match := range traversal.FindAllStringSubmatch(query, -1) {
+		depth, _ := strconv.Atoi(match[2])
+		up, down := match[3] == "->", match[1] == "<-"
+		if !up && !down {
+			up, down = true, true
+		}
+		frontier := parameters["labels"].([]string)
+		for hop := 0; hop <= depth && len(frontier) > 0; hop++ {
+			var next []string
+			for _, label := range frontier {
+				if !seen[label] {
+					seen[label] = true
+					rows = append(rows, []interface{}{label, []interface{}{}})
+				}
+				next = append(next, neighbours(label, up, down)...)
+			}
+			frontier = next
+		}
+	}
+	return (&fakeExecutor{rows: rows}).ExecuteCypher(query, parameters)
+}
+
+func TestExpandBothSkipsSiblings(t *testing.T) {
+	executor := &graphExecutor{broader: map[string][]string{
+		"car":     {"vehicle"},
+		"truck":   {"vehicle"},
+		"sedan":   {"car"},
+		"vehicle": {"transport"},
+	}}
+	client := NewClient(executor)
+
+	expanded, err := client.Expand([]string{"car"}, DirectionBoth, 2)
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"car", "sedan", "vehicle", "transport"}, expanded)
+	assert.NotContains(t, expanded, "truck")
+	assert.Len(t, executor.queries, 1)
+	assert.Contains(t, executor.queries[0], "UNION")
+}
+
+func TestExpandClampsDepth(t *testing.T) {
+	executor := &fakeExecutor{}
+	client := NewClient(executor)
+
+	_, err := client.Expand([]string{"car"}, DirectionBroader, 50)
+
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(executor.queries[0], "(t)-[:BROADER*0..5]->(x:Term)"))
+}
+
+func TestExpandNoneSkipsGraph(t *testing.T) {
+	executor := &fakeExecutor{}
+	client := NewClient(executor)
+
+	expanded, err := client.Expand([]string{"car"}, DirectionNone, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"car"}, expanded)
+	assert.Empty(t, executor.queries)
+}
+
+func TestAddBroaderRejectsCycle(t *testing.T) {
+	executor := &fakeExecutor{rows: [][]interface{}{{true}}}
+	client := NewClient(executor)
+
+	err := client.AddBroader("car", "vehicle")
+
+	assert.Error(t, err)
+	assert.Len(t, executor.queries, 1)
+}
+
+func TestParseDirection(t *testing.T) {
+	direction, err := ParseDirection("")
+	assert.NoError(t, err)
+	assert.Equal(t, DirectionNarrower, direction)
+
+	direction, err = ParseDirection("Both")
+	assert.NoError(t, err)
+	assert.Equal(t, DirectionBoth, direction)
+
+	_, err = ParseDirection("sideways")
+	assert.Error(t, err)
+}
@@ -0,0 +1,316 @@
+package temporal
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Constraints are the creation dates and media durations a query states in
+// words, as in "videos from last summer longer than 2 minutes"
+type Constraints struct {
+	// From and To bound when assets were created; To is exclusive
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// MinDuration and MaxDuration bound the length of media in seconds,
+	// both inclusive
+	MinDuration *float64 `json:"min_duration,omitempty"`
+	MaxDuration *float64 `json:"max_duration,omitempty"`
+	// Phrases are the parts of the query the constraints were read from
+	Phrases []string `json:"phrases,omitempty"`
+}
+
+// Empty reports whether the query stated no constraint
+func (c Constraints) Empty() bool {
+	return c.From == nil && c.To == nil && c.MinDuration == nil && c.MaxDuration == nil
+}
+
+// rule reads one kind of phrase. apply returns false when the match does
+// not name a valid date or duration, which leaves the phrase in the query.
+type rule struct {
+	pattern *regexp.Regexp
+	apply   func(c *Constraints, match []string, now time.Time) bool
+}
+
+const (
+	number   = `(\d+(?:\.\d+)?|an?|one|two|three|four|five|six|seven|eight|nine|ten|eleven|twelve)`
+	unit     = `(seconds?|secs?|minutes?|mins?|hours?|hrs?)`
+	period   = `(days?|weeks?|months?|years?)`
+	season   = `(spring|summer|autumn|fall|winter)`
+	month    = `(january|february|march|april|may|june|july|august|september|october|november|december|jan|feb|mar|apr|jun|jul|aug|sep|sept|oct|nov|dec)`
+	year     = `((?:19|20)\d\d)`
+	duringIn = `(?:(?:from|in|during|of)\s+)?`
+)
+
+func phrase(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b` + pattern + `\b`)
+}
+
+// dateRules are tried in order and the first that applies sets the dates
+var dateRules = []rule{
+	{phrase(`between\s+` + year + `\s+and\s+` + year), func(c *Constraints, m []string, now time.Time) bool {
+		from, to := atoi(m[1]), atoi(m[2])
+		if from > to {
+			return false
+		}
+		c.setDates(yearStart(from), yearStart(to+1))
+		return true
+	}},
+	{phrase(`(since|after|before)\s+` + month + `(?:\s+` + year + `)?`), func(c *Constraints, m []string, now time.Time) bool {
+		start, end := monthRange(m[2], m[3], now)
+		return c.setBound(m[1], start, end)
+	}},
+	{phrase(`(since|after|before)\s+` + year), func(c *Constraints, m []string, now time.Time) bool {
+		y := atoi(m[2])
+		return c.setBound(m[1], yearStart(y), yearStart(y+1))
+	}},
+	{phrase(`(?:(?:from|in|during|over|within)\s+)?(?:the\s+)?(?:last|past)\s+` + number + `\s+` + period), func(c *Constraints, m []string, now time.Time) bool {
+		n, ok := parseNumber(m[1])
+		if !ok || n < 1 || n != float64(int(n)) {
+			return false
+		}
+		from := addPeriod(dayStart(now), m[2], -int(n))
+		c.setDates(from, time.Time{})
+		return true
+	}},
+	{phrase(duringIn + `(today|yesterday)`), func(c *Constraints, m []string, now time.Time) bool {
+		day := dayStart(now)
+		if strings.EqualFold(m[1], "yesterday") {
+			day = day.AddDate(0, 0, -1)
+		}
+		c.setDates(day, day.AddDate(0, 0, 1))
+		return true
+	}},
+	{phrase(duringIn + `(this|last)\s+(week|month|year)`), func(c *Constraints, m []string, now time.Time) bool {
+		var start time.Time
+		switch strings.ToLower(m[2]) {
+		case "week":
+			day := dayStart(now)
+			start = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		case "month":
+			start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		default:
+			start = yearStart(now.Year())
+		}
+		if strings.EqualFold(m[1], "last") {
+			start = addPeriod(start, m[2], -1)
+		}
+		c.setDates(start, addPeriod(start, m[2], 1))
+		return true
+	}},
+	{phrase(duringIn + `(?:the\s+)?(this|last)\s+` + season), func(c *Constraints, m []string, now time.Time) bool {
+		start := lastSeason(m[2], now)
+		if strings.EqualFold(m[1], "this") {
+			start = thisSeason(m[2], now)
+		}
+		c.setDates(start, start.AddDate(0, 3, 0))
+		return true
+	}},
+	{phrase(duringIn + `(?:the\s+)?` + season + `\s+(?:of\s+)?` + year), func(c *Constraints, m []string, now time.Time) bool {
+		start := seasonStart(m[1], atoi(m[2]))
+		c.setDates(start, start.AddDate(0, 3, 0))
+		return true
+	}},
+	{phrase(duringIn + month + `\s+` + year), func(c *Constraints, m []string, now time.Time) bool {
+		start, end := monthRange(m[1], m[2], now)
+		c.setDates(start, end)
+		return true
+	}},
+	// Without a year, as in "photos you may like", a month needs a preposition
+	{phrase(`(?:from|in|during)\s+` + month), func(c *Constraints, m []string, now time.Time) bool {
+		start, end := monthRange(m[1], "", now)
+		c.setDates(start, end)
+		return true
+	}},
+	{phrase(`(?:from|in|during)\s+` + year), func(c *Constraints, m []string, now time.Time) bool {
+		y := atoi(m[1])
+		c.setDates(yearStart(y), yearStart(y+1))
+		return true
+	}},
+}
+
+// durationRules are tried in order and the first that applies sets the durations
+var durationRules = []rule{
+	{phrase(`between\s+` + number + `\s+and\s+` + number + `\s+` + unit + `(?:\s+long)?`), func(c *Constraints, m []string, now time.Time) bool {
+		low, ok1 := seconds(m[1], m[3])
+		high, ok2 := seconds(m[2], m[3])
+		if !ok1 || !ok2 || low > high {
+			return false
+		}
+		c.MinDuration, c.MaxDuration = &low, &high
+		return true
+	}},
+	{phrase(`(longer\s+than|more\s+than|over|at\s+least)\s+` + number + `\s+` + unit + `(?:\s+long)?`), func(c *Constraints, m []string, now time.Time) bool {
+		value, ok := seconds(m[2], m[3])
+		if ok {
+			c.MinDuration = &value
+		}
+		return ok
+	}},
+	{phrase(`(shorter\s+than|less\s+than|under|at\s+most|up\s+to)\s+` + number + `\s+` + unit + `(?:\s+long)?`), func(c *Constraints, m []string, now time.Time) bool {
+		value, ok := seconds(m[2], m[3])
+		if ok {
+			c.MaxDuration = &value
+		}
+		return ok
+	}},
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+// Extract reads the dates and durations an English query states, relative
+// to now for phrases like "last week". It returns them with the query
+// without the phrases they were read from.
+func Extract(query string, now time.Time) (Constraints, string) {
+	now = now.UTC()
+	var constraints Constraints
+	text := query
+	for _, rules := range [][]rule{dateRules, durationRules} {
+		for _, r := range rules {
+			if loc := r.pattern.FindStringSubmatchIndex(text); loc != nil {
+				match := submatches(text, loc)
+				if r.apply(&constraints, match, now) {
+					constraints.Phrases = append(constraints.Phrases, match[0])
+					text = text[:loc[0]] + " " + text[loc[1]:]
+					break
+				}
+			}
+		}
+	}
+	return constraints, strings.TrimSpace(spaces.ReplaceAllString(text, " "))
+}
+
+func submatches(text string, loc []int) []string {
+	match := make([]string, len(loc)/2)
+	for i := range match {
+		if loc[2*i] >= 0 {
+			match[i] = text[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return match
+}
+
+func (c *Constraints) setDates(from, to time.Time) {
+	if !from.IsZero() {
+		c.From = &from
+	}
+	if !to.IsZero() {
+		c.To = &to
+	}
+}
+
+// setBound applies "since", "after" or "before" to the period [start, end)
+func (c *Constraints) setBound(word string, start, end time.Time) bool {
+	switch strings.ToLower(word) {
+	case "since":
+		c.setDates(start, time.Time{})
+	case "after":
+		c.setDates(end, time.Time{})
+	default:
+		c.setDates(time.Time{}, start)
+	}
+	return true
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// monthRange is the named month of year, or the latest one that has begun
+// when no year is given
+func monthRange(name, yearText string, now time.Time) (time.Time, time.Time) {
+	m := months[strings.ToLower(name)[:3]]
+	y := now.Year()
+	if yearText != "" {
+		y = atoi(yearText)
+	} else if m > now.Month() {
+		y--
+	}
+	start := time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Seasons are meteorological, of the northern hemisphere: winter runs from
+// December to February and belongs to the year it starts in
+var seasonMonths = map[string]time.Month{
+	"spring": time.March, "summer": time.June, "autumn": time.September, "fall": time.September, "winter": time.December,
+}
+
+func seasonStart(name string, y int) time.Time {
+	return time.Date(y, seasonMonths[strings.ToLower(name)], 1, 0, 0, 0, 0, time.UTC)
+}
+
+// lastSeason is the latest season of the name that has ended
+func lastSeason(name string, now time.Time) time.Time {
+	start := seasonStart(name, now.Year())
+	for start.AddDate(0, 3, 0).After(now) {
+		start = start.AddDate(-1, 0, 0)
+	}
+	return start
+}
+
+// thisSeason is the season of the name in the current year; in January and
+// February this winter is the one that started in December
+func thisSeason(name string, now time.Time) time.Time {
+	start := seasonStart(name, now.Year())
+	if start.After(now) && start.AddDate(-1, 3, 0).After(now) {
+		start = start.AddDate(-1, 0, 0)
+	}
+	return start
+}
+
+func dayStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func yearStart(y int) time.Time {
+	return time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func addPeriod(t time.Time, period string, n int) time.Time {
+	switch strings.TrimSuffix(strings.ToLower(period), "s") {
+	case "day":
+		return t.AddDate(0, 0, n)
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "month":
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(n, 0, 0)
+}
+
+var numberWords = map[string]float64{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+}
+
+func parseNumber(text string) (float64, bool) {
+	if n, ok := numberWords[strings.ToLower(text)]; ok {
+		return n, true
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	return n, err == nil
+}
+
+// seconds converts an amount of a unit to seconds
+func seconds(amount, unitText string) (float64, bool) {
+	n, ok := parseNumber(amount)
+	if !ok {
+		return 0, false
+	}
+	switch strings.ToLower(unitText)[0] {
+	case 'm':
+		n *= 60
+	case 'h':
+		n *= 3600
+	}
+	return n, true
+}
+
+func atoi(text string) int {
+	n, _ := strconv.Atoi(text)
+	return n
+}
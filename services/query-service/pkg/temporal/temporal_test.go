@@ -0,0 +1,107 @@
+package temporal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// now is a Thursday in autumn
+var now = time.Date(2026, 10, 15, 14, 30, 0, 0, time.UTC)
+
+func date(y int, m time.Month, d int) *time.Time {
+	t := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestExtractDates(t *testing.T) {
+	tests := []struct {
+		query    string
+		from, to *time.Time
+		text     string
+	}{
+		{"videos from last summer", date(2026, 6, 1), date(2026, 9, 1), "videos"},
+		{"harbour this winter", date(2026, 12, 1), date(2027, 3, 1), "harbour"},
+		{"snow in the winter of 2024", date(2024, 12, 1), date(2025, 3, 1), "snow"},
+		{"photos from yesterday", date(2026, 10, 14), date(2026, 10, 15), "photos"},
+		{"Today", date(2026, 10, 15), date(2026, 10, 16), ""},
+		{"uploads this week", date(2026, 10, 12), date(2026, 10, 19), "uploads"},
+		{"uploads last month", date(2026, 9, 1), date(2026, 10, 1), "uploads"},
+		{"crane in the past 3 days", date(2026, 10, 12), nil, "crane"},
+		{"crane over the last two weeks", date(2026, 10, 1), nil, "crane"},
+		{"election coverage from March 2024", date(2024, 3, 1), date(2024, 4, 1), "election coverage"},
+		{"fireworks in december", date(2025, 12, 1), date(2026, 1, 1), "fireworks"},
+		{"flood footage since 2021", date(2021, 1, 1), nil, "flood footage"},
+		{"flood footage after 2021", date(2022, 1, 1), nil, "flood footage"},
+		{"flood footage before June 2020", nil, date(2020, 6, 1), "flood footage"},
+		{"interviews between 2019 and 2021", date(2019, 1, 1), date(2022, 1, 1), "interviews"},
+		{"olympics in 2012", date(2012, 1, 1), date(2013, 1, 1), "olympics"},
+	}
+	for _, test := range tests {
+		constraints, text := Extract(test.query, now)
+		assert.Equal(t, test.from, constraints.From, test.query)
+		assert.Equal(t, test.to, constraints.To, test.query)
+		assert.Equal(t, test.text, text, test.query)
+	}
+}
+
+func TestExtractSeasonsAroundTheYear(t *testing.T) {
+	// In July this summer has not ended, so last summer is a year back
+	constraints, _ := Extract("last summer", time.Date(2026, 7, 10, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, date(2025, 6, 1), constraints.From)
+
+	// In January this winter is the one that started in December
+	constraints, _ = Extract("this winter", time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, date(2025, 12, 1), constraints.From)
+	constraints, _ = Extract("last winter", time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, date(2024, 12, 1), constraints.From)
+}
+
+func TestExtractDurations(t *testing.T) {
+	seconds := func(n float64) *float64 { return &n }
+	tests := []struct {
+		query    string
+		min, max *float64
+		text     string
+	}{
+		{"clips longer than 2 minutes", seconds(120), nil, "clips"},
+		{"clips at least an hour long", seconds(3600), nil, "clips"},
+		{"clips under 30 seconds", nil, seconds(30), "clips"},
+		{"clips shorter than 1.5 hrs", nil, seconds(5400), "clips"},
+		{"clips between 5 and 10 mins", seconds(300), seconds(600), "clips"},
+	}
+	for _, test := range tests {
+		constraints, text := Extract(test.query, now)
+		assert.Equal(t, test.min, constraints.MinDuration, test.query)
+		assert.Equal(t, test.max, constraints.MaxDuration, test.query)
+		assert.Equal(t, test.text, text, test.query)
+	}
+}
+
+func TestExtractDatesAndDurations(t *testing.T) {
+	constraints, text := Extract("videos from last summer longer than 2 minutes", now)
+	assert.Equal(t, "videos", text)
+	assert.Equal(t, date(2026, 6, 1), constraints.From)
+	assert.Equal(t, date(2026, 9, 1), constraints.To)
+	require.NotNil(t, constraints.MinDuration)
+	assert.Equal(t, 120.0, *constraints.MinDuration)
+	assert.Equal(t, []string{"from last summer", "longer than 2 minutes"}, constraints.Phrases)
+}
+
+func TestExtractLeavesOtherQueriesAlone(t *testing.T) {
+	for _, query := range []string{
+		"photos you may like",
+		"harbour crane 2019",
+		"the last samurai",
+		"march of the penguins",
+		"between 10 and 20 people",
+		"interviews between 2021 and 2019",
+		"over the moon",
+	} {
+		constraints, text := Extract(query, now)
+		assert.True(t, constraints.Empty(), query)
+		assert.Equal(t, query, text)
+	}
+}
@@ -0,0 +1,326 @@
+package tokenizer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultStopWords is the built-in English list used when no file is configured for "en"
+var DefaultStopWords = []string{
+	"the", "a", "an", "and", "or", "but", "in", "on", "at", "to",
+	"for", "of", "with", "by",
+}
+
+// BuiltinStopWords are the lists used for other languages when no file is
+// configured for them; they are the common function words of each language
+var BuiltinStopWords = map[string][]string{
+	"de": {
+		"der", "die", "das", "den", "dem", "des", "ein", "eine", "einen", "einem", "einer",
+		"und", "oder", "aber", "im", "in", "am", "an", "auf", "aus", "bei", "beim", "mit",
+		"nach", "von", "vom", "vor", "zu", "zum", "zur", "für", "über", "unter", "ohne",
+		"gegen", "durch", "ist", "sind", "war", "nicht", "auch", "wie", "als",
+	},
+	"es": {
+		"el", "la", "los", "las", "un", "una", "unos", "unas", "y", "o", "pero", "en",
+		"con", "sin", "para", "por", "del", "al", "de", "sobre", "bajo", "entre", "que",
+		"es", "son", "muy", "desde", "hasta",
+	},
+	"fr": {
+		"le", "la", "les", "un", "une", "des", "du", "de", "et", "ou", "mais", "dans",
+		"sur", "sous", "avec", "sans", "pour", "par", "en", "au", "aux", "ce", "cette",
+		"ces", "est", "sont", "qui", "que", "pas", "près", "chez", "entre",
+	},
+	"it": {
+		"il", "lo", "la", "i", "gli", "le", "un", "uno", "una", "e", "o", "ma", "in",
+		"con", "senza", "per", "su", "sotto", "tra", "fra", "del", "della", "dei", "delle",
+		"al", "alla", "nel", "nella", "di", "da", "che", "è", "sono",
+	},
+	"nl": {
+		"de", "het", "een", "en", "of", "maar", "in", "op", "aan", "met", "zonder",
+		"voor", "door", "van", "bij", "uit", "naar", "onder", "over", "tussen", "is",
+		"zijn", "niet", "ook",
+	},
+	"pt": {
+		"o", "a", "os", "as", "um", "uma", "uns", "umas", "e", "ou", "mas", "em", "no",
+		"na", "nos", "nas", "com", "sem", "para", "por", "do", "da", "dos", "das", "ao",
+		"de", "que", "é", "são", "sobre", "entre",
+	},
+}
+
+// Config controls how queries are split into keywords. It is read from a
+// JSON file so each deployment can ship its own stop-word lists.
+type Config struct {
+	// StopWordFiles maps an ISO 639-1 code to a file with one stop word per line
+	StopWordFiles map[string]string `json:"stopword_files"`
+	// DefaultLanguage picks the stop words for queries without a language
+	DefaultLanguage string `json:"default_language"`
+	// TokenPattern is a regular expression matching one token; empty splits on whitespace
+	TokenPattern string `json:"token_pattern"`
+	// MinLength is the minimum token length in characters
+	MinLength int `json:"min_length"`
+}
+
+// DefaultConfig reproduces the historical behaviour: whitespace tokens of at
+// least three characters minus the built-in English stop words
+func DefaultConfig() Config {
+	return Config{DefaultLanguage: "en", MinLength: 3}
+}
+
+// Info describes the active tokenizer
+type Info struct {
+	DefaultLanguage string         `json:"default_language"`
+	TokenPattern    string         `json:"token_pattern"`
+	MinLength       int            `json:"min_length"`
+	StopWords       map[string]int `json:"stop_words"`
+	LoadedAt        time.Time      `json:"loaded_at"`
+}
+
+// Tokenizer is an immutable snapshot of a loaded Config
+type Tokenizer struct {
+	pattern   *regexp.Regexp
+	stopWords map[string]map[string]bool
+	info      Info
+}
+
+// New builds a tokenizer, reading the configured stop-word files
+func New(cfg Config) (*Tokenizer, error) {
+	if cfg.DefaultLanguage == "" {
+		cfg.DefaultLanguage = "en"
+	}
+	if cfg.MinLength < 0 {
+		return nil, fmt.Errorf("min_length must not be negative")
+	}
+
+	t := &Tokenizer{
+		stopWords: map[string]map[string]bool{"en": wordSet(DefaultStopWords)},
+		info: Info{
+			DefaultLanguage: cfg.DefaultLanguage,
+			TokenPattern:    cfg.TokenPattern,
+			MinLength:       cfg.MinLength,
+			StopWords:       map[string]int{},
+			LoadedAt:        time.Now().UTC(),
+		},
+	}
+	if cfg.TokenPattern != "" {
+		pattern, err := regexp.Compile(cfg.TokenPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token_pattern: %v", err)
+		}
+		t.pattern = pattern
+	}
+	for language, words := range BuiltinStopWords {
+		t.stopWords[language] = wordSet(words)
+	}
+	for language, path := range cfg.StopWordFiles {
+		words, err := readWordList(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s stop words: %v", language, err)
+		}
+		t.stopWords[strings.ToLower(language)] = wordSet(words)
+	}
+	for language, words := range t.stopWords {
+		t.info.StopWords[language] = len(words)
+	}
+	return t, nil
+}
+
+// Tokens lowercases text and splits it into tokens without filtering
+func (t *Tokenizer) Tokens(text string) []string {
+	text = strings.ToLower(text)
+	if t.pattern == nil {
+		return strings.Fields(text)
+	}
+	return t.pattern.FindAllString(text, -1)
+}
+
+// Keywords returns the tokens that are long enough and not stop words in the
+// given language; a regional tag such as "fr-CA" uses the list of its
+// language, and an empty or unknown language the default list
+func (t *Tokenizer) Keywords(text, language string) []string {
+	language = strings.ToLower(language)
+	stopWords, ok := t.stopWords[language]
+	if i := strings.IndexAny(language, "-_"); !ok && i > 0 {
+		stopWords, ok = t.stopWords[language[:i]]
+	}
+	if !ok {
+		stopWords = t.stopWords[t.info.DefaultLanguage]
+	}
+
+	var keywords []string
+	for _, token := range t.Tokens(text) {
+		if !stopWords[token] && utf8.RuneCountInString(token) >= t.info.MinLength {
+			keywords = append(keywords, token)
+		}
+	}
+	return keywords
+}
+
+// Info describes the tokenizer configuration
+func (t *Tokenizer) Info() Info {
+	return t.info
+}
+
+// Loader holds the active tokenizer and swaps it when the config changes
+type Loader struct {
+	path    string
+	current atomic.Pointer[Tokenizer]
+
+	mu       sync.Mutex
+	modTimes map[string]time.Time
+	onReload func()
+}
+
+// NewLoader creates a loader for the JSON config at path, starting with the
+// defaults until Reload succeeds; an empty path keeps the defaults
+func NewLoader(path string) *Loader {
+	l := &Loader{path: path}
+	t, _ := New(DefaultConfig())
+	l.current.Store(t)
+	return l
+}
+
+// Current returns the active tokenizer
+func (l *Loader) Current() *Tokenizer {
+	return l.current.Load()
+}
+
+// OnReload registers a callback invoked after a new tokenizer is activated
+func (l *Loader) OnReload(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onReload = fn
+}
+
+// Reload reads the config and stop-word files and activates them. On error
+// the previous tokenizer stays active.
+func (l *Loader) Reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to read tokenizer config: %v", err)
+	}
+	cfg := DefaultConfig()
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse tokenizer config: %v", err)
+	}
+	t, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	l.modTimes = modTimes(l.path, cfg)
+	l.current.Store(t)
+	if l.onReload != nil {
+		l.onReload()
+	}
+	return nil
+}
+
+// Watch polls the config and stop-word files and reloads when any of them
+// changes, until ctx is cancelled
+func (l *Loader) Watch(ctx context.Context, interval time.Duration) {
+	if l.path == "" || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !l.changed() {
+					continue
+				}
+				if err := l.Reload(); err != nil {
+					log.Printf("Warning: tokenizer reload failed, keeping previous config: %v", err)
+				} else {
+					log.Printf("Tokenizer config reloaded from %s", l.path)
+				}
+			}
+		}
+	}()
+}
+
+// changed reports whether a watched file was modified, created or removed
+func (l *Loader) changed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	paths := []string{l.path}
+	for path := range l.modTimes {
+		if path != l.path {
+			paths = append(paths, path)
+		}
+	}
+	for _, path := range paths {
+		var modTime time.Time
+		if stat, err := os.Stat(path); err == nil {
+			modTime = stat.ModTime()
+		}
+		if !modTime.Equal(l.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+func modTimes(configPath string, cfg Config) map[string]time.Time {
+	paths := []string{configPath}
+	for _, path := range cfg.StopWordFiles {
+		paths = append(paths, path)
+	}
+	times := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if stat, err := os.Stat(path); err == nil {
+			times[path] = stat.ModTime()
+		} else {
+			times[path] = time.Time{}
+		}
+	}
+	return times
+}
+
+// readWordList reads one word per line, ignoring blank lines and # comments
+func readWordList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, strings.ToLower(line))
+	}
+	return words, scanner.Err()
+}
+
+func wordSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
@@ -0,0 +1,74 @@
+package tokenizer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultConfigMatchesBuiltInBehaviour(t *testing.T) {
+	tok, err := New(DefaultConfig())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"photos", "beach", "sunset"}, tok.Keywords("The photos of a beach at Sunset", ""))
+}
+
+func TestLanguageStopWordsAndPattern(t *testing.T) {
+	dir := t.TempDir()
+	german := filepath.Join(dir, "de.txt")
+	require.NoError(t, os.WriteFile(german, []byte("# German\nder\ndie\nund\n"), 0o644))
+
+	tok, err := New(Config{
+		StopWordFiles: map[string]string{"de": german},
+		TokenPattern:  `[\p{L}\p{N}]+`,
+		MinLength:     2,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"rede", "premierministers"}, tok.Keywords("Die Rede, der Premierministers!", "de"))
+	// Unknown languages fall back to the default list
+	assert.Equal(t, []string{"die", "rede"}, tok.Keywords("die rede", "sv"))
+	assert.Equal(t, 3, tok.Info().StopWords["de"])
+}
+
+func TestBuiltinStopWords(t *testing.T) {
+	tok, err := New(DefaultConfig())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"hund", "schnee"}, tok.Keywords("Der Hund im Schnee", "de"))
+	assert.Equal(t, []string{"chien", "neige"}, tok.Keywords("Un chien dans la neige", "fr-CA"))
+	assert.Equal(t, len(BuiltinStopWords["es"]), tok.Info().StopWords["es"])
+}
+
+func TestInvalidPattern(t *testing.T) {
+	_, err := New(Config{TokenPattern: "("})
+	assert.Error(t, err)
+}
+
+func TestLoaderReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokenizer.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"min_length": 5}`), 0o644))
+
+	loader := NewLoader(path)
+	reloads := 0
+	loader.OnReload(func() { reloads++ })
+	require.NoError(t, loader.Reload())
+	assert.Equal(t, 5, loader.Current().Info().MinLength)
+	assert.False(t, loader.changed())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"min_length": 2}`), 0o644))
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, later, later))
+	assert.True(t, loader.changed())
+
+	// A broken config keeps the previous tokenizer
+	require.NoError(t, os.WriteFile(path, []byte(`{"token_pattern": "("}`), 0o644))
+	assert.Error(t, loader.Reload())
+	assert.Equal(t, 5, loader.Current().Info().MinLength)
+	assert.Equal(t, 1, reloads)
+}
@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+const contextKey = "trace_context"
+
+// SpanContext carries the W3C trace context of the current request
+type SpanContext struct {
+	TraceID      string `json:"trace_id"`
+	SpanID       string `json:"span_id"`
+	ParentSpanID string `json:"parent_span_id,omitempty"`
+	Sampled      bool   `json:"sampled"`
+}
+
+// ParseTraceparent parses a W3C traceparent header value
+func ParseTraceparent(header string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if parts[0] == "ff" || !isHex(parts[1]) || !isHex(parts[2]) || !isHex(parts[3]) {
+		return SpanContext{}, false
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return SpanContext{}, false
+	}
+
+	flags, _ := hex.DecodeString(parts[3])
+	return SpanContext{
+		TraceID: strings.ToLower(parts[1]),
+		SpanID:  strings.ToLower(parts[2]),
+		Sampled: flags[0]&0x01 == 0x01,
+	}, true
+}
+
+// NewRoot starts a new trace
+func NewRoot() SpanContext {
+	return SpanContext{
+		TraceID: randomHex(16),
+		SpanID:  randomHex(8),
+		Sampled: true,
+	}
+}
+
+// Child returns a new span within the same trace
+func (s SpanContext) Child() SpanContext {
+	return SpanContext{
+		TraceID:      s.TraceID,
+		SpanID:       randomHex(8),
+		ParentSpanID: s.SpanID,
+		Sampled:      s.Sampled,
+	}
+}
+
+// Traceparent formats the span context as a W3C traceparent header value
+func (s SpanContext) Traceparent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", s.TraceID, s.SpanID, flags)
+}
+
+// Middleware continues the caller's trace, or starts one, in a server span
+// carried by the request context, and echoes it in the response
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Spans are named after the route, not the path, to keep names low-cardinality
+		name := c.Request.Method
+		if c.FullPath() != "" {
+			name += " " + c.FullPath()
+		}
+		ctx, otelSpan, span := StartServer(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header), name,
+			semconv.HTTPMethod(c.Request.Method),
+			semconv.HTTPRoute(c.FullPath()),
+		)
+		defer otelSpan.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Set(contextKey, span)
+		c.Header("traceparent", span.Traceparent())
+		c.Header("X-Trace-ID", span.TraceID)
+		c.Next()
+
+		otelSpan.SetAttributes(semconv.HTTPStatusCode(c.Writer.Status()))
+		if c.Writer.Status() >= 500 {
+			otelSpan.SetStatus(codes.Error, http.StatusText(c.Writer.Status()))
+		}
+	}
+}
+
+// FromContext returns the span context of the request, starting one if the middleware did not run
+func FromContext(c *gin.Context) SpanContext {
+	if value, ok := c.Get(contextKey); ok {
+		if span, ok := value.(SpanContext); ok {
+			return span
+		}
+	}
+	return NewRoot()
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+func isHex(value string) bool {
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
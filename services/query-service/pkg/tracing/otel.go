@@ -0,0 +1,138 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the query service
+const instrumentationName = "dataflux/query-service"
+
+// propagator reads and writes W3C traceparent headers; it does not depend on
+// the global propagator so trace continuation works before Setup runs
+var propagator = propagation.TraceContext{}
+
+// Config selects how spans are sampled and where they are exported
+type Config struct {
+	ServiceName string
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://otel-collector:4318;
+	// spans are recorded for sampling and log correlation but not exported when empty
+	Endpoint string
+	// SampleRatio is the share of new traces kept; continued traces follow the caller's decision
+	SampleRatio float64
+}
+
+// Setup installs the OpenTelemetry tracer provider and propagator. The
+// returned function flushes pending spans and should run on shutdown.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tracing resource: %v", err)
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+	if cfg.Endpoint != "" {
+		exporter, err := newExporter(ctx, cfg.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, endpoint string) (sdktrace.SpanExporter, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(parsed.Host)}
+	if parsed.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if parsed.Path != "" && parsed.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(parsed.Path))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+	return exporter, nil
+}
+
+// Start begins a span as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End marks the span as failed when err is set and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// StartServer starts the span of an incoming request, continuing the trace
+// in the carrier's traceparent if there is one. It also returns the IDs used
+// to correlate logs, analytics and events with the trace.
+func StartServer(ctx context.Context, carrier propagation.TextMapCarrier, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span, SpanContext) {
+	ctx = propagator.Extract(ctx, carrier)
+	parent := trace.SpanContextFromContext(ctx)
+
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx, span, correlationIDs(parent, span.SpanContext())
+}
+
+// correlationIDs converts the OpenTelemetry span context. Without a tracer
+// provider the span is a no-op that reuses its parent's IDs, so new ones are
+// generated as before.
+func correlationIDs(parent, current trace.SpanContext) SpanContext {
+	if current.IsValid() && current.SpanID() != parent.SpanID() {
+		span := SpanContext{
+			TraceID: current.TraceID().String(),
+			SpanID:  current.SpanID().String(),
+			Sampled: current.IsSampled(),
+		}
+		if parent.IsValid() {
+			span.ParentSpanID = parent.SpanID().String()
+		}
+		return span
+	}
+
+	if parent.IsValid() {
+		return SpanContext{
+			TraceID: parent.TraceID().String(),
+			SpanID:  parent.SpanID().String(),
+			Sampled: parent.IsSampled(),
+		}.Child()
+	}
+	return NewRoot()
+}
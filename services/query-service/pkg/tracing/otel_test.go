@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestStartServerContinuesIncomingTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	header := http.Header{}
+	header.Set("traceparent", incoming)
+	ctx, server, ids := StartServer(context.Background(), propagation.HeaderCarrier(header), "POST /api/v1/search")
+
+	_, child := Start(ctx, "backend.postgres")
+	End(child, errors.New("timeout"))
+	server.End()
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", ids.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", ids.ParentSpanID)
+	assert.Equal(t, server.SpanContext().SpanID().String(), ids.SpanID)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "backend.postgres", spans[0].Name())
+	assert.Equal(t, server.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, trace.SpanKindServer, spans[1].SpanKind())
+}
+
+func TestStartServerWithoutProviderKeepsCorrelationIDs(t *testing.T) {
+	header := http.Header{}
+	header.Set("traceparent", incoming)
+	_, _, ids := StartServer(context.Background(), propagation.HeaderCarrier(header), "GET /health")
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", ids.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", ids.ParentSpanID)
+	assert.NotEqual(t, "00f067aa0ba902b7", ids.SpanID)
+
+	_, _, root := StartServer(context.Background(), propagation.HeaderCarrier(http.Header{}), "GET /health")
+	assert.Len(t, root.TraceID, 32)
+	assert.Empty(t, root.ParentSpanID)
+}
+
+func TestSetupRejectsInvalidEndpoint(t *testing.T) {
+	_, err := Setup(context.Background(), Config{ServiceName: "query-service", Endpoint: "otel-collector:4318", SampleRatio: 1})
+	assert.Error(t, err)
+}
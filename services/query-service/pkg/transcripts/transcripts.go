@@ -0,0 +1,454 @@
+package transcripts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// textSearchConfigs maps ISO 639-1 codes to PostgreSQL text search configurations
+var textSearchConfigs = map[string]string{
+	"da": "danish",
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fi": "finnish",
+	"fr": "french",
+	"hu": "hungarian",
+	"it": "italian",
+	"nl": "dutch",
+	"no": "norwegian",
+	"pt": "portuguese",
+	"ro": "romanian",
+	"ru": "russian",
+	"sv": "swedish",
+	"tr": "turkish",
+}
+
+// TextSearchConfig returns the PostgreSQL text search configuration for a language code
+func TextSearchConfig(language string) string {
+	if config, ok := textSearchConfigs[NormalizeLanguage(language)]; ok {
+		return config
+	}
+	return "simple"
+}
+
+// NormalizeLanguage reduces a language tag such as "de-AT" to its primary subtag
+func NormalizeLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		language = language[:i]
+	}
+	return language
+}
+
+// Translation is a machine or human translation of a transcript
+type Translation struct {
+	Language  string    `json:"language" binding:"required"`
+	Text      string    `json:"text" binding:"required"`
+	Provider  string    `json:"provider"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Transcript is the spoken text of an asset or segment in its original language
+type Transcript struct {
+	ID           string        `json:"id"`
+	AssetID      string        `json:"asset_id" binding:"required"`
+	SegmentID    string        `json:"segment_id,omitempty"`
+	Language     string        `json:"language" binding:"required"`
+	Text         string        `json:"text" binding:"required"`
+	Translations []Translation `json:"translations,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+// Match is a transcript hit, possibly found through one of its translations
+type Match struct {
+	TranscriptID       string  `json:"transcript_id"`
+	AssetID            string  `json:"asset_id"`
+	SegmentID          string  `json:"segment_id,omitempty"`
+	TranscriptLanguage string  `json:"transcript_language"`
+	MatchLanguage      string  `json:"match_language"`
+	MatchedVia         string  `json:"matched_via"`
+	Rank               float64 `json:"rank"`
+	Snippet            string  `json:"snippet"`
+}
+
+// database is the part of the pool the store uses
+type database interface {
+	queryRower
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// Store persists transcripts and their translations in PostgreSQL
+type Store struct {
+	pool   database
+	tenant string
+}
+
+// NewStore creates a new transcript store
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// ForTenant returns a store whose searches only match transcripts of the
+// tenant's assets
+func (s *Store) ForTenant(tenant string) *Store {
+	return &Store{pool: s.pool, tenant: tenant}
+}
+
+// EnsureSchema creates the transcript tables if they do not exist
+func (s *Store) EnsureSchema(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS transcripts (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			asset_id UUID NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+			segment_id UUID REFERENCES segments(id) ON DELETE CASCADE,
+			language VARCHAR(16) NOT NULL,
+			ts_config REGCONFIG NOT NULL DEFAULT 'simple',
+			text TEXT NOT NULL,
+			search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector(ts_config, text)) STORED,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_transcripts_asset ON transcripts(asset_id);
+		CREATE INDEX IF NOT EXISTS idx_transcripts_language ON transcripts(language);
+		CREATE INDEX IF NOT EXISTS idx_transcripts_search ON transcripts USING gin(search_vector);
+
+		CREATE TABLE IF NOT EXISTS transcript_translations (
+			transcript_id UUID NOT NULL REFERENCES transcripts(id) ON DELETE CASCADE,
+			language VARCHAR(16) NOT NULL,
+			ts_config REGCONFIG NOT NULL DEFAULT 'simple',
+			text TEXT NOT NULL,
+			provider VARCHAR(100) NOT NULL DEFAULT 'machine',
+			search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector(ts_config, text)) STORED,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (transcript_id, language)
+		);
+		CREATE INDEX IF NOT EXISTS idx_transcript_translations_search ON transcript_translations USING gin(search_vector);
+	`)
+	return err
+}
+
+// CreateTranscript stores a transcript together with any supplied translations
+func (s *Store) CreateTranscript(ctx context.Context, transcript Transcript) (*Transcript, error) {
+	transcript.Language = NormalizeLanguage(transcript.Language)
+	if transcript.Language == "" {
+		return nil, fmt.Errorf("transcript language is required")
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var segmentID interface{}
+	if transcript.SegmentID != "" {
+		segmentID = transcript.SegmentID
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO transcripts (asset_id, segment_id, language, ts_config, text)
+		VALUES ($1, $2, $3, $4::regconfig, $5)
+		RETURNING id::text, created_at
+	`, transcript.AssetID, segmentID, transcript.Language, TextSearchConfig(transcript.Language), transcript.Text).Scan(
+		&transcript.ID,
+		&transcript.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert transcript: %v", err)
+	}
+
+	for i := range transcript.Translations {
+		if err := upsertTranslation(ctx, tx, transcript.ID, &transcript.Translations[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transcript: %v", err)
+	}
+
+	return &transcript, nil
+}
+
+// AddTranslation adds or replaces the translation of a transcript in one language
+func (s *Store) AddTranslation(ctx context.Context, transcriptID string, translation Translation) (*Translation, error) {
+	if err := upsertTranslation(ctx, s.pool, transcriptID, &translation); err != nil {
+		return nil, err
+	}
+	return &translation, nil
+}
+
+// queryRower is satisfied by both the pool and an open transaction
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+func upsertTranslation(ctx context.Context, db queryRower, transcriptID string, translation *Translation) error {
+	translation.Language = NormalizeLanguage(translation.Language)
+	if translation.Language == "" {
+		return fmt.Errorf("translation language is required")
+	}
+	if translation.Provider == "" {
+		translation.Provider = "machine"
+	}
+
+	err := db.QueryRow(ctx, `
+		INSERT INTO transcript_translations (transcript_id, language, ts_config, text, provider)
+		VALUES ($1, $2, $3::regconfig, $4, $5)
+		ON CONFLICT (transcript_id, language) DO UPDATE
+		SET ts_config = EXCLUDED.ts_config,
+		    text = EXCLUDED.text,
+		    provider = EXCLUDED.provider,
+		    created_at = NOW()
+		RETURNING created_at
+	`, transcriptID, translation.Language, TextSearchConfig(translation.Language), translation.Text, translation.Provider).Scan(
+		&translation.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store %s translation: %v", translation.Language, err)
+	}
+
+	return nil
+}
+
+// GetTranscript retrieves a transcript and all of its translations
+func (s *Store) GetTranscript(ctx context.Context, transcriptID string) (*Transcript, error) {
+	var transcript Transcript
+	var segmentID *string
+	err := s.pool.QueryRow(ctx, `
+		SELECT id::text, asset_id::text, segment_id::text, language, text, created_at
+		FROM transcripts
+		WHERE id = $1
+	`, transcriptID).Scan(
+		&transcript.ID,
+		&transcript.AssetID,
+		&segmentID,
+		&transcript.Language,
+		&transcript.Text,
+		&transcript.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transcript: %v", err)
+	}
+	if segmentID != nil {
+		transcript.SegmentID = *segmentID
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT language, text, provider, created_at
+		FROM transcript_translations
+		WHERE transcript_id = $1
+		ORDER BY language
+	`, transcriptID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translations: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var translation Translation
+		if err := rows.Scan(&translation.Language, &translation.Text, &translation.Provider, &translation.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan translation: %v", err)
+		}
+		transcript.Translations = append(transcript.Translations, translation)
+	}
+
+	return &transcript, rows.Err()
+}
+
+// inCollections holds for transcripts t whose asset is in one of the
+// collections given as $4, or for every transcript when $4 is null
+const inCollections = `($4::text[] IS NULL OR EXISTS (
+				SELECT 1 FROM entities e WHERE e.id = t.asset_id AND e.parent_id::text = ANY($4)))`
+
+// inTenant holds for transcripts t whose asset belongs to the tenant given
+// as $5, or for every transcript when $5 is empty
+const inTenant = `($5::text = '' OR EXISTS (
+				SELECT 1 FROM entities e WHERE e.id = t.asset_id AND e.metadata->>'tenant_id' = $5))`
+
+// Search matches the query against original transcripts and their translations.
+// When language is set only texts in that language are considered, so a German
+// query finds English transcripts through their German translation. The query
+// uses websearch_to_tsquery syntax, so quoted phrases must match in order.
+// A non-nil collectionIDs keeps only transcripts of assets in those collections.
+func (s *Store) Search(ctx context.Context, query, language string, collectionIDs []string, limit int) ([]Match, error) {
+	language = NormalizeLanguage(language)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT transcript_id, asset_id, segment_id, transcript_language, match_language, matched_via, rank, snippet
+		FROM (
+			SELECT t.id::text AS transcript_id, t.asset_id::text AS asset_id, t.segment_id::text AS segment_id,
+			       t.language AS transcript_language, t.language AS match_language,
+			       'original' AS matched_via,
+			       ts_rank(t.search_vector, websearch_to_tsquery(t.ts_config, $1)) AS rank,
+			       ts_headline(t.ts_config, t.text, websearch_to_tsquery(t.ts_config, $1)) AS snippet
+			FROM transcripts t
+			WHERE ($2 = '' OR t.language = $2)
+			  AND t.search_vector @@ websearch_to_tsquery(t.ts_config, $1)
+			  AND `+inCollections+`
+			  AND `+inTenant+`
+			UNION ALL
+			SELECT t.id::text, t.asset_id::text, t.segment_id::text,
+			       t.language, tr.language,
+			       'translation',
+			       ts_rank(tr.search_vector, websearch_to_tsquery(tr.ts_config, $1)),
+			       ts_headline(tr.ts_config, tr.text, websearch_to_tsquery(tr.ts_config, $1))
+			FROM transcript_translations tr
+			JOIN transcripts t ON t.id = tr.transcript_id
+			WHERE ($2 = '' OR tr.language = $2)
+			  AND tr.search_vector @@ websearch_to_tsquery(tr.ts_config, $1)
+			  AND `+inCollections+`
+			  AND `+inTenant+`
+		) matches
+		ORDER BY rank DESC
+		LIMIT $3
+	`, query, language, limit, collectionIDs, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search transcripts: %v", err)
+	}
+	defer rows.Close()
+
+	matches := []Match{}
+	for rows.Next() {
+		var match Match
+		var segmentID *string
+		var rank float32
+		if err := rows.Scan(
+			&match.TranscriptID,
+			&match.AssetID,
+			&segmentID,
+			&match.TranscriptLanguage,
+			&match.MatchLanguage,
+			&match.MatchedVia,
+			&rank,
+			&match.Snippet,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan transcript match: %v", err)
+		}
+		if segmentID != nil {
+			match.SegmentID = *segmentID
+		}
+		match.Rank = float64(rank)
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
+// Passage is the text of a transcript with the time range of its segment,
+// as quoted to answer a question
+type Passage struct {
+	TranscriptID string   `json:"transcript_id"`
+	AssetID      string   `json:"asset_id"`
+	SegmentID    string   `json:"segment_id,omitempty"`
+	Language     string   `json:"language"`
+	Text         string   `json:"text"`
+	StartTime    *float64 `json:"start_time,omitempty"`
+	EndTime      *float64 `json:"end_time,omitempty"`
+}
+
+// Passages loads the transcripts with the given IDs and those of the given
+// segments. When language is set, a transcript translated into it is
+// returned as the translation, so answers can quote in the asker's language.
+func (s *Store) Passages(ctx context.Context, transcriptIDs, segmentIDs []string, language string) ([]Passage, error) {
+	if len(transcriptIDs) == 0 && len(segmentIDs) == 0 {
+		return []Passage{}, nil
+	}
+	return s.passages(ctx, `(t.id::text = ANY($3) OR t.segment_id::text = ANY($4))`, language, transcriptIDs, segmentIDs)
+}
+
+// AssetPassages loads every transcript of the given assets, asset by asset
+// in speaking order, translated into language like Passages
+func (s *Store) AssetPassages(ctx context.Context, assetIDs []string, language string) ([]Passage, error) {
+	if len(assetIDs) == 0 {
+		return []Passage{}, nil
+	}
+	return s.passages(ctx, `t.asset_id::text = ANY($3)`, language, assetIDs)
+}
+
+// Vocabulary counts the words of the original transcripts, returning the
+// limit most common of at least three letters
+func (s *Store) Vocabulary(ctx context.Context, limit int) (map[string]int, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT word, count(*)::int
+		FROM (
+			SELECT regexp_split_to_table(lower(t.text), '[^[:alpha:]]+') AS word
+			FROM transcripts t
+			WHERE ($1::text = '' OR EXISTS (
+				SELECT 1 FROM entities e WHERE e.id = t.asset_id AND e.metadata->>'tenant_id' = $1))
+		) words
+		WHERE length(word) >= 3
+		GROUP BY word
+		ORDER BY count(*) DESC
+		LIMIT $2
+	`, s.tenant, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript vocabulary: %v", err)
+	}
+	defer rows.Close()
+
+	vocabulary := map[string]int{}
+	for rows.Next() {
+		var word string
+		var count int
+		if err := rows.Scan(&word, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan transcript vocabulary: %v", err)
+		}
+		vocabulary[word] = count
+	}
+	return vocabulary, rows.Err()
+}
+
+// passages loads the transcripts matching where, whose arguments start at $3
+func (s *Store) passages(ctx context.Context, where, language string, args ...interface{}) ([]Passage, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT t.id::text, t.asset_id::text, t.segment_id::text,
+		       COALESCE(tr.language, t.language), COALESCE(tr.text, t.text),
+		       (sg.start_marker->>'time')::float8, (sg.end_marker->>'time')::float8
+		FROM transcripts t
+		LEFT JOIN transcript_translations tr ON tr.transcript_id = t.id AND tr.language = $1
+		LEFT JOIN segments sg ON sg.id = t.segment_id
+		WHERE `+where+`
+		  AND ($2::text = '' OR EXISTS (
+				SELECT 1 FROM entities e WHERE e.id = t.asset_id AND e.metadata->>'tenant_id' = $2))
+		ORDER BY t.asset_id, (sg.start_marker->>'time')::float8 NULLS FIRST, t.created_at
+	`, append([]interface{}{NormalizeLanguage(language), s.tenant}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load passages: %v", err)
+	}
+	defer rows.Close()
+
+	passages := []Passage{}
+	for rows.Next() {
+		var passage Passage
+		var segmentID *string
+		if err := rows.Scan(
+			&passage.TranscriptID,
+			&passage.AssetID,
+			&segmentID,
+			&passage.Language,
+			&passage.Text,
+			&passage.StartTime,
+			&passage.EndTime,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan passage: %v", err)
+		}
+		if segmentID != nil {
+			passage.SegmentID = *segmentID
+		}
+		passages = append(passages, passage)
+	}
+
+	return passages, rows.Err()
+}
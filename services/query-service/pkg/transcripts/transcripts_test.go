@@ -0,0 +1,318 @@
+package transcripts
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// response answers the statements containing match
+type response struct {
+	match string
+	rows  [][]interface{}
+	err   error
+}
+
+// fakeDB answers statements from its responses in order and records each
+// statement with its arguments
+type fakeDB struct {
+	responses  []response
+	statements []string
+	args       [][]interface{}
+	committed  bool
+	rolledBack bool
+}
+
+func (f *fakeDB) answer(sql string, args []interface{}) ([][]interface{}, error) {
+	f.statements = append(f.statements, sql)
+	f.args = append(f.args, args)
+	for _, r := range f.responses {
+		if strings.Contains(sql, r.match) {
+			return r.rows, r.err
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	rows, err := f.answer(sql, args)
+	return &fakeRows{data: rows, err: err, single: true}
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	rows, err := f.answer(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{data: rows}, nil
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	_, err := f.answer(sql, args)
+	return nil, err
+}
+
+func (f *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: f}, nil
+}
+
+// fakeTx runs its statements on the fake database
+type fakeTx struct {
+	pgx.Tx
+	db *fakeDB
+}
+
+func (t *fakeTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return t.db.QueryRow(ctx, sql, args...)
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	t.db.committed = true
+	return nil
+}
+
+func (t *fakeTx) Rollback(ctx context.Context) error {
+	if !t.db.committed {
+		t.db.rolledBack = true
+	}
+	return nil
+}
+
+// fakeRows scans its data into pointers of the same type, leaving nil
+// values unset; a single row without data is pgx.ErrNoRows
+type fakeRows struct {
+	pgx.Rows
+	data   [][]interface{}
+	err    error
+	single bool
+	next   int
+}
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.data)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	if r.single {
+		if r.err != nil {
+			return r.err
+		}
+		if len(r.data) == 0 {
+			return pgx.ErrNoRows
+		}
+		r.next = 1
+	}
+	for i, value := range r.data[r.next-1] {
+		if value == nil {
+			continue
+		}
+		target := reflect.ValueOf(dest[i]).Elem()
+		if target.Kind() == reflect.Ptr {
+			target.Set(reflect.New(target.Type().Elem()))
+			target = target.Elem()
+		}
+		target.Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error { return nil }
+
+func (r *fakeRows) Close() {}
+
+func TestTextSearchConfig(t *testing.T) {
+	assert.Equal(t, "de", NormalizeLanguage(" DE-at "))
+	assert.Equal(t, "pt", NormalizeLanguage("pt_BR"))
+	assert.Equal(t, "german", TextSearchConfig("de-AT"))
+	assert.Equal(t, "english", TextSearchConfig("EN"))
+	// Languages without a configuration are matched word for word
+	assert.Equal(t, "simple", TextSearchConfig("ja"))
+	assert.Equal(t, "simple", TextSearchConfig(""))
+}
+
+func TestCreateTranscript(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	db := &fakeDB{responses: []response{
+		{match: "INSERT INTO transcripts", rows: [][]interface{}{{"tr-1", created}}},
+		{match: "INSERT INTO transcript_translations", rows: [][]interface{}{{created}}},
+	}}
+	store := &Store{pool: db}
+
+	transcript, err := store.CreateTranscript(context.Background(), Transcript{
+		AssetID:  "asset-1",
+		Language: "DE-at",
+		Text:     "Das Schiff legt im Hafen an",
+		Translations: []Translation{
+			{Language: "en-GB", Text: "The ship docks in the harbour"},
+			{Language: "fr", Text: "Le navire accoste au port", Provider: "human"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tr-1", transcript.ID)
+	assert.Equal(t, "de", transcript.Language)
+	assert.Equal(t, created, transcript.CreatedAt)
+	assert.True(t, db.committed)
+	assert.False(t, db.rolledBack)
+
+	// The transcript is stored without a segment and with its language's configuration
+	require.Len(t, db.args, 3)
+	assert.Equal(t, []interface{}{"asset-1", nil, "de", "german", "Das Schiff legt im Hafen an"}, db.args[0])
+
+	// Translations are stored under the new ID, defaulting to machine translations
+	assert.Equal(t, []interface{}{"tr-1", "en", "english", "The ship docks in the harbour", "machine"}, db.args[1])
+	assert.Equal(t, []interface{}{"tr-1", "fr", "french", "Le navire accoste au port", "human"}, db.args[2])
+	assert.Equal(t, Translation{Language: "en", Text: "The ship docks in the harbour", Provider: "machine", CreatedAt: created}, transcript.Translations[0])
+}
+
+func TestCreateTranscriptWithSegment(t *testing.T) {
+	db := &fakeDB{responses: []response{
+		{match: "INSERT INTO transcripts", rows: [][]interface{}{{"tr-1", time.Now()}}},
+	}}
+	store := &Store{pool: db}
+
+	_, err := store.CreateTranscript(context.Background(), Transcript{AssetID: "asset-1", SegmentID: "seg-1", Language: "ja", Text: "港"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"asset-1", "seg-1", "ja", "simple", "港"}, db.args[0])
+}
+
+func TestCreateTranscriptRollsBack(t *testing.T) {
+	store := &Store{pool: &fakeDB{}}
+	_, err := store.CreateTranscript(context.Background(), Transcript{AssetID: "asset-1", Language: " ", Text: "text"})
+	assert.EqualError(t, err, "transcript language is required")
+
+	// A translation that fails leaves nothing behind
+	db := &fakeDB{responses: []response{
+		{match: "INSERT INTO transcripts", rows: [][]interface{}{{"tr-1", time.Now()}}},
+		{match: "INSERT INTO transcript_translations", err: errors.New("value too long")},
+	}}
+	store = &Store{pool: db}
+	_, err = store.CreateTranscript(context.Background(), Transcript{
+		AssetID: "asset-1", Language: "en", Text: "text",
+		Translations: []Translation{{Language: "de", Text: "Text"}},
+	})
+	assert.EqualError(t, err, "failed to store de translation: value too long")
+	assert.False(t, db.committed)
+	assert.True(t, db.rolledBack)
+
+	db = &fakeDB{responses: []response{
+		{match: "INSERT INTO transcripts", rows: [][]interface{}{{"tr-1", time.Now()}}},
+	}}
+	store = &Store{pool: db}
+	_, err = store.CreateTranscript(context.Background(), Transcript{
+		AssetID: "asset-1", Language: "en", Text: "text",
+		Translations: []Translation{{Language: "", Text: "Text"}},
+	})
+	assert.EqualError(t, err, "translation language is required")
+	assert.True(t, db.rolledBack)
+}
+
+func TestAddTranslation(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	db := &fakeDB{responses: []response{
+		{match: "INSERT INTO transcript_translations", rows: [][]interface{}{{created}}},
+	}}
+	store := &Store{pool: db}
+
+	translation, err := store.AddTranslation(context.Background(), "tr-1", Translation{Language: "NL", Text: "Het schip", Provider: "human"})
+	require.NoError(t, err)
+	assert.Equal(t, &Translation{Language: "nl", Text: "Het schip", Provider: "human", CreatedAt: created}, translation)
+	assert.Equal(t, []interface{}{"tr-1", "nl", "dutch", "Het schip", "human"}, db.args[0])
+	// Adding a language again replaces its translation
+	assert.Contains(t, db.statements[0], "ON CONFLICT (transcript_id, language) DO UPDATE")
+}
+
+func TestGetTranscript(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	db := &fakeDB{responses: []response{
+		{match: "WHERE id = $1", rows: [][]interface{}{{"tr-1", "asset-1", "seg-1", "de", "Das Schiff", created}}},
+		{match: "WHERE transcript_id = $1", rows: [][]interface{}{
+			{"en", "The ship", "machine", created},
+			{"fr", "Le navire", "human", created},
+		}},
+	}}
+	store := &Store{pool: db}
+
+	transcript, err := store.GetTranscript(context.Background(), "tr-1")
+	require.NoError(t, err)
+	assert.Equal(t, &Transcript{
+		ID: "tr-1", AssetID: "asset-1", SegmentID: "seg-1", Language: "de", Text: "Das Schiff", CreatedAt: created,
+		Translations: []Translation{
+			{Language: "en", Text: "The ship", Provider: "machine", CreatedAt: created},
+			{Language: "fr", Text: "Le navire", Provider: "human", CreatedAt: created},
+		},
+	}, transcript)
+	assert.Equal(t, []interface{}{"tr-1"}, db.args[1])
+
+	// An unknown transcript is nil without an error
+	transcript, err = (&Store{pool: &fakeDB{}}).GetTranscript(context.Background(), "missing")
+	assert.NoError(t, err)
+	assert.Nil(t, transcript)
+
+	_, err = (&Store{pool: &fakeDB{responses: []response{{match: "WHERE id = $1", err: errors.New("connection reset")}}}}).GetTranscript(context.Background(), "tr-1")
+	assert.EqualError(t, err, "failed to load transcript: connection reset")
+}
+
+func TestSearch(t *testing.T) {
+	db := &fakeDB{responses: []response{
+		{match: "matched_via", rows: [][]interface{}{
+			{"tr-1", "asset-1", nil, "en", "de", "translation", float32(0.5), "Das <b>Schiff</b>"},
+		}},
+	}}
+	store := (&Store{pool: db}).ForTenant("acme")
+
+	matches, err := store.Search(context.Background(), `"das schiff"`, "de-DE", []string{"col-1"}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []Match{{
+		TranscriptID: "tr-1", AssetID: "asset-1", TranscriptLanguage: "en", MatchLanguage: "de",
+		MatchedVia: "translation", Rank: 0.5, Snippet: "Das <b>Schiff</b>",
+	}}, matches)
+	// The language is normalized and the search kept to the tenant's assets
+	assert.Equal(t, []interface{}{`"das schiff"`, "de", 10, []string{"col-1"}, "acme"}, db.args[0])
+
+	matches, err = (&Store{pool: &fakeDB{}}).Search(context.Background(), "ship", "", nil, 10)
+	require.NoError(t, err)
+	assert.NotNil(t, matches)
+	assert.Empty(t, matches)
+}
+
+func TestPassages(t *testing.T) {
+	start, end := 12.5, 18.0
+	db := &fakeDB{responses: []response{
+		{match: "start_marker", rows: [][]interface{}{
+			{"tr-1", "asset-1", "seg-1", "de", "Das Schiff", start, end},
+			{"tr-2", "asset-1", nil, "en", "Untimed", nil, nil},
+		}},
+	}}
+	store := &Store{pool: db}
+
+	passages, err := store.Passages(context.Background(), []string{"tr-2"}, []string{"seg-1"}, "DE")
+	require.NoError(t, err)
+	assert.Equal(t, []Passage{
+		{TranscriptID: "tr-1", AssetID: "asset-1", SegmentID: "seg-1", Language: "de", Text: "Das Schiff", StartTime: &start, EndTime: &end},
+		{TranscriptID: "tr-2", AssetID: "asset-1", Language: "en", Text: "Untimed"},
+	}, passages)
+	assert.Equal(t, []interface{}{"de", "", []string{"tr-2"}, []string{"seg-1"}}, db.args[0])
+
+	_, err = store.AssetPassages(context.Background(), []string{"asset-1"}, "")
+	require.NoError(t, err)
+	assert.Contains(t, db.statements[1], "t.asset_id::text = ANY($3)")
+
+	// Nothing to look up, no query
+	db = &fakeDB{}
+	passages, err = (&Store{pool: db}).Passages(context.Background(), nil, nil, "de")
+	require.NoError(t, err)
+	assert.Empty(t, passages)
+	passages, err = (&Store{pool: db}).AssetPassages(context.Background(), nil, "de")
+	require.NoError(t, err)
+	assert.Empty(t, passages)
+	assert.Empty(t, db.statements)
+}
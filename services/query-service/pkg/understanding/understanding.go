@@ -0,0 +1,175 @@
+package understanding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Intents the planner routes on; services may return others, which are
+// kept but ignored
+const (
+	// IntentKeyword asks for assets matching the words of the query
+	IntentKeyword = "keyword"
+	// IntentSemantic asks for assets like what the query describes
+	IntentSemantic = "semantic"
+	// IntentRelationship asks for assets connected to what the query names
+	IntentRelationship = "relationship"
+)
+
+// Entity types of people and places
+const (
+	EntityPerson   = "person"
+	EntityLocation = "location"
+)
+
+// mediaTypes are the coarse media types searches can be restricted to
+var mediaTypes = map[string]bool{"image": true, "video": true, "audio": true, "document": true}
+
+// Intent is something the query asks for, with the service's confidence
+type Intent struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Entity is a span of the query naming something
+type Entity struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Filters are the constraints the query states in words, as "photos of
+// Anna in Lisbon from last summer"
+type Filters struct {
+	// DateFrom and DateTo bound when assets were created; DateTo is exclusive
+	DateFrom *time.Time `json:"date_from,omitempty"`
+	DateTo   *time.Time `json:"date_to,omitempty"`
+	// MinDuration and MaxDuration bound the length of media in seconds
+	MinDuration *float64 `json:"min_duration,omitempty"`
+	MaxDuration *float64 `json:"max_duration,omitempty"`
+	People      []string `json:"people,omitempty"`
+	Locations   []string `json:"locations,omitempty"`
+}
+
+// Empty reports whether no filter is set
+func (f Filters) Empty() bool {
+	return f.DateFrom == nil && f.DateTo == nil && f.MinDuration == nil && f.MaxDuration == nil &&
+		len(f.People) == 0 && len(f.Locations) == 0
+}
+
+// Understanding is what a query asks for
+type Understanding struct {
+	Intents  []Intent `json:"intents"`
+	Entities []Entity `json:"entities"`
+	Filters  Filters  `json:"filters"`
+	// Keywords are the words to match; empty leaves them to the tokenizer
+	Keywords []string `json:"keywords,omitempty"`
+	// Excluded are the terms the query asks to leave out, as "people" in
+	// "beach scenes without people"
+	Excluded []string `json:"excluded,omitempty"`
+	// Relationships are the graph edges to follow, as "similar_to"
+	Relationships []string `json:"relationships,omitempty"`
+	// MediaType is image, video, audio or document, or empty for any
+	MediaType  string  `json:"media_type,omitempty"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Has reports whether the query has the intent
+func (u Understanding) Has(intent string) bool {
+	for _, candidate := range u.Intents {
+		if candidate.Name == intent {
+			return true
+		}
+	}
+	return false
+}
+
+// Understander parses queries
+type Understander interface {
+	Understand(ctx context.Context, query, language string) (Understanding, error)
+}
+
+// Client asks an external NLP or LLM service to understand queries. The
+// service answers POST <url>/understand, sent {"query": ..., "language": ...},
+// with an Understanding.
+type Client struct {
+	url        string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewClient creates a client of the service at url; apiKey, when set, is
+// sent as a bearer token
+func NewClient(url, apiKey string, timeout time.Duration) *Client {
+	return &Client{url: strings.TrimRight(url, "/"), apiKey: apiKey, httpClient: &http.Client{Timeout: timeout}}
+}
+
+type understandRequest struct {
+	Query    string `json:"query"`
+	Language string `json:"language,omitempty"`
+}
+
+// Understand asks the service about query, written in language when set
+func (c *Client) Understand(ctx context.Context, query, language string) (Understanding, error) {
+	body, err := json.Marshal(understandRequest{Query: query, Language: language})
+	if err != nil {
+		return Understanding{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/understand", bytes.NewReader(body))
+	if err != nil {
+		return Understanding{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Understanding{}, fmt.Errorf("query understanding request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Understanding{}, fmt.Errorf("query understanding service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var understood Understanding
+	if err := json.NewDecoder(resp.Body).Decode(&understood); err != nil {
+		return Understanding{}, fmt.Errorf("failed to decode query understanding: %v", err)
+	}
+	if err := understood.normalize(); err != nil {
+		return Understanding{}, err
+	}
+	return understood, nil
+}
+
+// normalize lower-cases names and types, drops media types searches cannot
+// be restricted to and rejects date and duration ranges that match nothing
+func (u *Understanding) normalize() error {
+	for i := range u.Intents {
+		u.Intents[i].Name = strings.ToLower(strings.TrimSpace(u.Intents[i].Name))
+	}
+	for i := range u.Entities {
+		u.Entities[i].Type = strings.ToLower(strings.TrimSpace(u.Entities[i].Type))
+	}
+	for i := range u.Excluded {
+		u.Excluded[i] = strings.ToLower(strings.TrimSpace(u.Excluded[i]))
+	}
+	u.MediaType = strings.ToLower(strings.TrimSpace(u.MediaType))
+	if !mediaTypes[u.MediaType] {
+		u.MediaType = ""
+	}
+	if from, to := u.Filters.DateFrom, u.Filters.DateTo; from != nil && to != nil && !from.Before(*to) {
+		return fmt.Errorf("query understanding returned an empty date range %s to %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	if min, max := u.Filters.MinDuration, u.Filters.MaxDuration; min != nil && max != nil && *min > *max {
+		return fmt.Errorf("query understanding returned an empty duration range %gs to %gs", *min, *max)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package understanding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnderstand(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/understand", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		var req understandRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "photos of Anna in Lisbon from last summer", req.Query)
+		assert.Equal(t, "en", req.Language)
+		w.Write([]byte(`{
+			"intents": [{"name": "Semantic", "confidence": 0.9}],
+			"entities": [{"type": "PERSON", "text": "Anna"}, {"type": "location", "text": "Lisbon"}],
+			"filters": {"date_from": "2026-06-01T00:00:00Z", "date_to": "2026-09-01T00:00:00Z", "people": ["Anna"], "locations": ["Lisbon"]},
+			"excluded": [" Tourists"],
+			"media_type": "Image",
+			"confidence": 0.8
+		}`))
+	}))
+	defer server.Close()
+
+	understood, err := NewClient(server.URL+"/", "secret", time.Second).Understand(context.Background(), "photos of Anna in Lisbon from last summer", "en")
+	require.NoError(t, err)
+	assert.True(t, understood.Has(IntentSemantic))
+	assert.False(t, understood.Has(IntentRelationship))
+	assert.Equal(t, []Entity{{Type: EntityPerson, Text: "Anna"}, {Type: EntityLocation, Text: "Lisbon"}}, understood.Entities)
+	assert.Equal(t, "image", understood.MediaType)
+	assert.Equal(t, []string{"tourists"}, understood.Excluded)
+	assert.Equal(t, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), understood.Filters.DateFrom.UTC())
+	assert.Equal(t, []string{"Lisbon"}, understood.Filters.Locations)
+	assert.False(t, understood.Filters.Empty())
+	assert.Equal(t, 0.8, understood.Confidence)
+}
+
+func TestUnderstandRejectsBadAnswers(t *testing.T) {
+	answer := ""
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(answer))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, "", time.Second)
+
+	status, answer = http.StatusBadGateway, "model unavailable"
+	_, err := client.Understand(context.Background(), "harbour", "")
+	assert.EqualError(t, err, "query understanding service returned 502: model unavailable")
+
+	status, answer = http.StatusOK, "not json"
+	_, err = client.Understand(context.Background(), "harbour", "")
+	assert.Error(t, err)
+
+	answer = `{"filters": {"date_from": "2026-09-01T00:00:00Z", "date_to": "2026-06-01T00:00:00Z"}}`
+	_, err = client.Understand(context.Background(), "harbour", "")
+	assert.Error(t, err)
+
+	answer = `{"filters": {"min_duration": 600, "max_duration": 60}}`
+	_, err = client.Understand(context.Background(), "harbour", "")
+	assert.Error(t, err)
+
+	// Media types searches cannot be restricted to are dropped
+	answer = `{"media_type": "hologram"}`
+	understood, err := client.Understand(context.Background(), "harbour", "")
+	require.NoError(t, err)
+	assert.Empty(t, understood.MediaType)
+	assert.True(t, understood.Filters.Empty())
+}
@@ -0,0 +1,139 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ReferencePrefix marks an option value that names a Vault secret, as in
+// vault:database/creds/query-service#password
+const ReferencePrefix = "vault:"
+
+// IsReference reports whether an option value names a Vault secret
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, ReferencePrefix)
+}
+
+// ParseReference splits a reference into the secret's path and the key of
+// the value within it
+func ParseReference(reference string) (path, key string, err error) {
+	path, key, found := strings.Cut(strings.TrimPrefix(reference, ReferencePrefix), "#")
+	path = strings.Trim(path, "/")
+	if !found || path == "" || key == "" {
+		return "", "", fmt.Errorf("invalid Vault reference %q, expected vault:<path>#<key>", reference)
+	}
+	return path, key, nil
+}
+
+// Secret is the data of a Vault secret. Dynamic secrets such as database
+// credentials carry a lease and stop working when it ends.
+type Secret struct {
+	Data          map[string]string
+	LeaseDuration time.Duration
+	ReadAt        time.Time
+}
+
+// Stale reports whether a leased secret has used up two thirds of its lease
+// and should be read again for fresh credentials; secrets without a lease
+// never go stale
+func (s *Secret) Stale(now time.Time) bool {
+	return s.LeaseDuration > 0 && now.Sub(s.ReadAt) > s.LeaseDuration*2/3
+}
+
+// Client reads secrets through Vault's HTTP API
+type Client struct {
+	addr       string
+	token      string
+	tokenFile  string
+	namespace  string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the Vault server at addr. With tokenFile
+// set the token is read from it on every request, so a Vault Agent sink
+// renewing the token is followed.
+func NewClient(addr, token, tokenFile, namespace string, timeout time.Duration) *Client {
+	return &Client{
+		addr:       strings.TrimRight(addr, "/"),
+		token:      token,
+		tokenFile:  tokenFile,
+		namespace:  namespace,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *Client) currentToken() (string, error) {
+	if c.tokenFile == "" {
+		return c.token, nil
+	}
+	token, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Vault token: %v", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// Read reads the secret at path. Key/value version 2 secrets, whose values
+// sit under data.data, are unwrapped; values that are not strings are
+// encoded as JSON.
+func (c *Client) Read(ctx context.Context, path string) (*Secret, error) {
+	token, err := c.currentToken()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.addr+"/v1/"+strings.Trim(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Vault request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("Vault returned %d for %s: %s", resp.StatusCode, path, strings.TrimSpace(string(message)))
+	}
+
+	var body struct {
+		LeaseDuration int                        `json:"lease_duration"`
+		Data          map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode Vault secret %s: %v", path, err)
+	}
+	data := body.Data
+	if nested, ok := data["data"]; ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return nil, fmt.Errorf("failed to decode Vault secret %s: %v", path, err)
+			}
+		}
+	}
+
+	secret := &Secret{
+		Data:          make(map[string]string, len(data)),
+		LeaseDuration: time.Duration(body.LeaseDuration) * time.Second,
+		ReadAt:        time.Now(),
+	}
+	for key, value := range data {
+		var text string
+		if json.Unmarshal(value, &text) == nil {
+			secret.Data[key] = text
+		} else {
+			secret.Data[key] = string(value)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,63 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	path, key, err := ParseReference("vault:/secret/data/dataflux/neo4j#password")
+	require.NoError(t, err)
+	assert.Equal(t, "secret/data/dataflux/neo4j", path)
+	assert.Equal(t, "password", key)
+
+	for _, reference := range []string{"vault:secret/data/neo4j", "vault:#password", "vault:secret/data/neo4j#"} {
+		_, _, err := ParseReference(reference)
+		assert.Error(t, err, reference)
+	}
+	assert.True(t, IsReference("vault:a#b"))
+	assert.False(t, IsReference("dataflux_pass"))
+}
+
+func TestRead(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("agent-token\n"), 0o600))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "agent-token", r.Header.Get("X-Vault-Token"))
+		assert.Equal(t, "team", r.Header.Get("X-Vault-Namespace"))
+		switch r.URL.Path {
+		case "/v1/secret/data/neo4j":
+			w.Write([]byte(`{"lease_duration":0,"data":{"data":{"password":"kv_pass","port":7687},"metadata":{"version":3}}}`))
+		case "/v1/database/creds/query-service":
+			w.Write([]byte(`{"lease_duration":3600,"data":{"username":"v-query-1","password":"dyn_pass"}}`))
+		default:
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL+"/", "ignored", tokenFile, "team", time.Second)
+
+	secret, err := client.Read(context.Background(), "secret/data/neo4j")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "kv_pass", "port": "7687"}, secret.Data)
+	assert.False(t, secret.Stale(time.Now().Add(24*time.Hour)))
+
+	secret, err = client.Read(context.Background(), "/database/creds/query-service")
+	require.NoError(t, err)
+	assert.Equal(t, "v-query-1", secret.Data["username"])
+	assert.Equal(t, time.Hour, secret.LeaseDuration)
+	assert.False(t, secret.Stale(secret.ReadAt.Add(30*time.Minute)))
+	assert.True(t, secret.Stale(secret.ReadAt.Add(45*time.Minute)))
+
+	_, err = client.Read(context.Background(), "secret/data/other")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "403")
+}
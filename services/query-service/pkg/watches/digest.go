@@ -0,0 +1,201 @@
+package watches
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"dataflux/query-service/pkg/taxonomy"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// lockKey makes sure only one replica sends the digests at a time
+const lockKey = "watches:digest:lock"
+
+// Source provides the due watches and the new assets to match them against
+type Source interface {
+	Due(ctx context.Context, cutoff time.Time) ([]Watch, error)
+	NewAssets(ctx context.Context, since, until time.Time, limit int) ([]Asset, error)
+	MarkDigested(ctx context.Context, watchIDs []string, through time.Time) error
+}
+
+// Expander walks the taxonomy graph
+type Expander interface {
+	Expand(labels []string, direction taxonomy.Direction, depth int) ([]string, error)
+}
+
+// Config controls how often digests go out and how large they get
+type Config struct {
+	// Period is how often each user gets a digest
+	Period time.Duration
+	// Settle holds back new assets for this long so analysis can finish
+	// before they are matched
+	Settle time.Duration
+	// MaxAssets bounds the new assets checked per run; later ones wait
+	// for the next run
+	MaxAssets int
+	// MaxPerWatch bounds the assets listed per watch
+	MaxPerWatch int
+}
+
+// Digester matches new assets against the standing watches and sends each
+// user a digest of the matches
+type Digester struct {
+	source   Source
+	notifier Notifier
+	taxonomy Expander
+	redis    *redis.Client
+	config   Config
+	instance string
+}
+
+// NewDigester creates a digester; expander may be nil to match topics
+// literally
+func NewDigester(source Source, notifier Notifier, expander Expander, redisClient *redis.Client, config Config) *Digester {
+	instance, _ := os.Hostname()
+	return &Digester{source: source, notifier: notifier, taxonomy: expander, redis: redisClient, config: config, instance: instance}
+}
+
+// Run sends the digests of every watch due at now and returns how many were
+// sent. Watches without matches move on silently; those whose digest could
+// not be sent are retried on the next run.
+func (d *Digester) Run(ctx context.Context, now time.Time) (int, error) {
+	until := now.Add(-d.config.Settle)
+	due, err := d.source.Due(ctx, until.Add(-d.config.Period))
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+
+	since := due[0].DigestedThrough
+	for _, watch := range due[1:] {
+		if watch.DigestedThrough.Before(since) {
+			since = watch.DigestedThrough
+		}
+	}
+	assets, err := d.source.NewAssets(ctx, since, until, d.config.MaxAssets)
+	if err != nil {
+		return 0, err
+	}
+	// A full page may have left assets out, so the window ends at the last one
+	if d.config.MaxAssets > 0 && len(assets) == d.config.MaxAssets {
+		until = assets[len(assets)-1].CreatedAt
+	}
+	words := make([][]string, len(assets))
+	for i, asset := range assets {
+		words[i] = Tokenize(asset.Text)
+	}
+
+	// Due watches come sorted by recipient, one digest each
+	sent := 0
+	expansions := map[string][][]string{}
+	for start := 0; start < len(due); {
+		end := start + 1
+		for end < len(due) && due[end].UserID == due[start].UserID && due[end].Email == due[start].Email {
+			end++
+		}
+		group := due[start:end]
+		start = end
+
+		digest := Digest{UserID: group[0].UserID, Email: group[0].Email, Since: group[0].DigestedThrough, Until: until}
+		ids := make([]string, len(group))
+		for i, watch := range group {
+			ids[i] = watch.ID
+			if watch.DigestedThrough.Before(digest.Since) {
+				digest.Since = watch.DigestedThrough
+			}
+
+			section := Section{Watch: watch, Assets: []Asset{}}
+			terms := d.terms(watch, expansions)
+			for j, asset := range assets {
+				if !asset.CreatedAt.After(watch.DigestedThrough) || asset.CreatedAt.After(until) || !Percolate(watch, terms, asset, words[j]) {
+					continue
+				}
+				section.Total++
+				if d.config.MaxPerWatch <= 0 || len(section.Assets) < d.config.MaxPerWatch {
+					section.Assets = append(section.Assets, asset)
+				}
+			}
+			if section.Total > 0 {
+				digest.Sections = append(digest.Sections, section)
+			}
+		}
+
+		if digest.Total() > 0 {
+			if err := d.notifier.Notify(ctx, digest); err != nil {
+				log.Printf("Warning: digest for %s failed: %v", digest.UserID, err)
+				continue
+			}
+			sent++
+		}
+		if err := d.source.MarkDigested(ctx, ids, until); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return sent, nil
+}
+
+// terms returns the tokenized phrases a person or topic watch matches.
+// Topics include their narrower taxonomy terms; expansions caches them for
+// the run.
+func (d *Digester) terms(watch Watch, expansions map[string][][]string) [][]string {
+	switch watch.Kind {
+	case KindPerson:
+		return [][]string{Tokenize(watch.Value)}
+	case KindTopic:
+	default:
+		return nil
+	}
+
+	if terms, ok := expansions[watch.Value]; ok {
+		return terms
+	}
+	labels := []string{watch.Value}
+	if d.taxonomy != nil {
+		expanded, err := d.taxonomy.Expand(labels, taxonomy.DirectionNarrower, 0)
+		if err != nil {
+			log.Printf("Warning: taxonomy expansion of watch topic %q failed: %v", watch.Value, err)
+		} else {
+			labels = expanded
+		}
+	}
+	terms := make([][]string, 0, len(labels))
+	for _, label := range labels {
+		if words := Tokenize(label); len(words) > 0 {
+			terms = append(terms, words)
+		}
+	}
+	expansions[watch.Value] = terms
+	return terms
+}
+
+// Start checks for due watches every interval until ctx is cancelled.
+// Replicas share a Redis lock so only one of them sends each round.
+func (d *Digester) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				acquired, err := d.redis.SetNX(ctx, lockKey, d.instance, interval/2).Result()
+				if err != nil {
+					log.Printf("Warning: digest lock failed: %v", err)
+					continue
+				}
+				if !acquired {
+					continue
+				}
+				if sent, err := d.Run(ctx, time.Now()); err != nil {
+					log.Printf("Warning: digest run failed: %v", err)
+				} else if sent > 0 {
+					log.Printf("Sent %d watch digests", sent)
+				}
+			}
+		}
+	}()
+}
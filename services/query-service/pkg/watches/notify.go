@@ -0,0 +1,113 @@
+package watches
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Section lists the new assets matching one watch
+type Section struct {
+	Watch  Watch   `json:"watch"`
+	Assets []Asset `json:"assets"`
+	// Total counts every match, including those left out of Assets
+	Total int `json:"total"`
+}
+
+// Digest is one user's new assets across all their watches
+type Digest struct {
+	UserID   string    `json:"user_id"`
+	Email    string    `json:"email"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+	Sections []Section `json:"sections"`
+}
+
+// Total counts the matches of every section
+func (d Digest) Total() int {
+	total := 0
+	for _, section := range d.Sections {
+		total += section.Total
+	}
+	return total
+}
+
+// Subject is the e-mail subject of the digest
+func (d Digest) Subject() string {
+	if d.Total() == 1 {
+		return "DataFlux digest: 1 new asset"
+	}
+	return fmt.Sprintf("DataFlux digest: %d new assets", d.Total())
+}
+
+// Text renders the digest as plain text
+func (d Digest) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "New assets from %s to %s\n", d.Since.UTC().Format(time.RFC1123), d.Until.UTC().Format(time.RFC1123))
+	for _, section := range d.Sections {
+		fmt.Fprintf(&b, "\n%s (%s): %d\n", section.Watch.Label, section.Watch.Kind, section.Total)
+		for _, asset := range section.Assets {
+			fmt.Fprintf(&b, "  - %s [%s] %s\n", asset.Filename, asset.MimeType, asset.ID)
+		}
+		if more := section.Total - len(section.Assets); more > 0 {
+			fmt.Fprintf(&b, "  ... and %d more\n", more)
+		}
+	}
+	return b.String()
+}
+
+// Notifier delivers digests
+type Notifier interface {
+	Notify(ctx context.Context, digest Digest) error
+}
+
+// LogNotifier writes digests to the service log, for development
+type LogNotifier struct{}
+
+// Notify logs the digest
+func (LogNotifier) Notify(ctx context.Context, digest Digest) error {
+	log.Printf("Digest for %s <%s>: %s\n%s", digest.UserID, digest.Email, digest.Subject(), digest.Text())
+	return nil
+}
+
+// SMTPNotifier e-mails digests through an SMTP relay
+type SMTPNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPNotifier creates a notifier sending from the address through the
+// relay at addr (host:port). Credentials are optional.
+func NewSMTPNotifier(addr, from, username, password string) *SMTPNotifier {
+	notifier := &SMTPNotifier{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		notifier.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return notifier
+}
+
+// Notify sends the digest to its recipient
+func (n *SMTPNotifier) Notify(ctx context.Context, digest Digest) error {
+	if err := smtp.SendMail(n.addr, n.auth, n.from, []string{digest.Email}, n.message(digest)); err != nil {
+		return fmt.Errorf("failed to send digest to %s: %v", digest.Email, err)
+	}
+	return nil
+}
+
+func (n *SMTPNotifier) message(digest Digest) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", digest.Email)
+	fmt.Fprintf(&b, "Subject: %s\r\n", digest.Subject())
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(digest.Text(), "\n", "\r\n"))
+	return []byte(b.String())
+}
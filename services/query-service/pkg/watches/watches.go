@@ -0,0 +1,305 @@
+package watches
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+
+	"dataflux/query-service/pkg/fulltext"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Kinds of entity a user can watch
+const (
+	// KindPerson matches assets whose text, such as recognised faces or
+	// captions, names the person
+	KindPerson = "person"
+	// KindTopic matches assets mentioning the topic or one of its narrower
+	// taxonomy terms
+	KindTopic = "topic"
+	// KindCollection matches assets added to the collection
+	KindCollection = "collection"
+)
+
+// Kinds lists the valid watch kinds
+var Kinds = []string{KindPerson, KindTopic, KindCollection}
+
+// MaxWatchesPerUser bounds the standing queries of one user
+const MaxWatchesPerUser = 50
+
+// ValidationError reports an invalid watch
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Watch is a user's standing interest in an entity. New assets matching it
+// are collected into the user's digest.
+type Watch struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Kind   string `json:"kind" binding:"required"`
+	// Value is the person's name, the topic, or the collection ID
+	Value string `json:"value" binding:"required"`
+	// Label names the watch in digests; it defaults to Value
+	Label string `json:"label"`
+	// Email receives the digests
+	Email     string    `json:"email" binding:"required"`
+	CreatedAt time.Time `json:"created_at"`
+	// DigestedThrough is the end of the last window of new assets checked
+	DigestedThrough time.Time `json:"digested_through"`
+}
+
+// Validate checks the watch and normalises its fields
+func Validate(watch *Watch) error {
+	watch.Kind = strings.ToLower(strings.TrimSpace(watch.Kind))
+	watch.Value = strings.TrimSpace(watch.Value)
+	watch.Label = strings.TrimSpace(watch.Label)
+
+	switch watch.Kind {
+	case KindPerson, KindTopic, KindCollection:
+	default:
+		return &ValidationError{Message: fmt.Sprintf("kind must be one of %s", strings.Join(Kinds, ", "))}
+	}
+	if watch.Value == "" || len(watch.Value) > 255 {
+		return &ValidationError{Message: "value must be 1-255 characters"}
+	}
+	if watch.Kind != KindCollection && len(Tokenize(watch.Value)) == 0 {
+		return &ValidationError{Message: "value must contain a word"}
+	}
+	address, err := mail.ParseAddress(watch.Email)
+	if err != nil {
+		return &ValidationError{Message: "email is not a valid address"}
+	}
+	watch.Email = address.Address
+	if watch.Label == "" {
+		watch.Label = watch.Value
+	}
+	return nil
+}
+
+// Asset is a newly indexed asset checked against the watches
+type Asset struct {
+	ID           string    `json:"id"`
+	Filename     string    `json:"filename"`
+	MimeType     string    `json:"mime_type"`
+	CollectionID string    `json:"collection_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Text is every string the asset's filename, metadata and features hold
+	Text string `json:"-"`
+}
+
+// Tokenize lower-cases text and splits it into words
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Percolate reports whether an asset matches a watch. terms are the
+// phrases of person and topic watches, tokenized; words holds the tokenized
+// text of the asset. A phrase matches when its words appear in order.
+func Percolate(watch Watch, terms [][]string, asset Asset, words []string) bool {
+	if watch.Kind == KindCollection {
+		return strings.EqualFold(asset.CollectionID, watch.Value)
+	}
+	for _, term := range terms {
+		if containsPhrase(words, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPhrase(words, phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		matched := true
+		for j, word := range phrase {
+			if words[i+j] != word {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Store keeps the watches in PostgreSQL and finds the assets created since
+// they were last digested
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// NewStore creates a watch store
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// EnsureSchema creates the search_watches table
+func (s *Store) EnsureSchema(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS search_watches (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id VARCHAR(255) NOT NULL,
+			kind VARCHAR(20) NOT NULL,
+			value TEXT NOT NULL,
+			label TEXT NOT NULL,
+			email VARCHAR(320) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			digested_through TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CONSTRAINT valid_watch_kind CHECK (kind IN ('person', 'topic', 'collection')),
+			UNIQUE(user_id, kind, value, email)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_watches_digested ON search_watches(digested_through)`,
+	}
+	for _, statement := range statements {
+		if _, err := s.pool.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the user's watches
+func (s *Store) List(ctx context.Context, userID string) ([]Watch, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id::text, user_id, kind, value, label, email, created_at, digested_through
+		FROM search_watches
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list watches: %v", err)
+	}
+	return scanWatches(rows)
+}
+
+// Create validates and stores a watch. Registering the same watch again
+// returns the existing one.
+func (s *Store) Create(ctx context.Context, watch Watch) (*Watch, error) {
+	if err := Validate(&watch); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM search_watches WHERE user_id = $1`, watch.UserID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count watches: %v", err)
+	}
+	if count >= MaxWatchesPerUser {
+		return nil, &ValidationError{Message: fmt.Sprintf("at most %d watches are allowed per user", MaxWatchesPerUser)}
+	}
+
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO search_watches (user_id, kind, value, label, email)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, kind, value, email) DO UPDATE SET label = EXCLUDED.label
+		RETURNING id::text, created_at, digested_through
+	`, watch.UserID, watch.Kind, watch.Value, watch.Label, watch.Email).Scan(&watch.ID, &watch.CreatedAt, &watch.DigestedThrough)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watch: %v", err)
+	}
+	return &watch, nil
+}
+
+// Delete removes one watch owned by the user
+func (s *Store) Delete(ctx context.Context, userID, watchID string) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM search_watches WHERE id::text = $1 AND user_id = $2`, watchID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete watch: %v", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// Due returns the watches last digested at or before cutoff
+func (s *Store) Due(ctx context.Context, cutoff time.Time) ([]Watch, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id::text, user_id, kind, value, label, email, created_at, digested_through
+		FROM search_watches
+		WHERE digested_through <= $1
+		ORDER BY user_id, email, created_at
+	`, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due watches: %v", err)
+	}
+	return scanWatches(rows)
+}
+
+// NewAssets returns up to limit processed assets created after since and up
+// to until, oldest first. Embargoed assets are left out, since digests go
+// to users whatever their roles.
+func (s *Store) NewAssets(ctx context.Context, since, until time.Time, limit int) ([]Asset, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT e.id::text, a.filename, a.mime_type, COALESCE(e.parent_id::text, ''), e.created_at,
+		       concat_ws(' ', a.filename, a.upload_context,
+		         (SELECT string_agg(v #>> '{}', ' ')
+		          FROM jsonb_path_query(e.metadata, 'strict $.** ? (@.type() == "string")') v),
+		         (SELECT string_agg(v #>> '{}', ' ')
+		          FROM features f, jsonb_path_query(f.feature_data, 'strict $.** ? (@.type() == "string")') v
+		          WHERE f.asset_id = a.id))
+		FROM assets a
+		JOIN entities e ON e.id = a.id
+		WHERE e.created_at > $1 AND e.created_at <= $2
+		  AND e.is_latest AND a.processing_status = 'completed'
+		  AND NOT `+fulltext.EmbargoActive+`
+		ORDER BY e.created_at
+		LIMIT $3
+	`, since, until, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load new assets: %v", err)
+	}
+	defer rows.Close()
+
+	assets := []Asset{}
+	for rows.Next() {
+		var asset Asset
+		if err := rows.Scan(&asset.ID, &asset.Filename, &asset.MimeType, &asset.CollectionID, &asset.CreatedAt, &asset.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan new asset: %v", err)
+		}
+		assets = append(assets, asset)
+	}
+	return assets, rows.Err()
+}
+
+// MarkDigested records that the watches were checked up to through
+func (s *Store) MarkDigested(ctx context.Context, watchIDs []string, through time.Time) error {
+	_, err := s.pool.Exec(ctx, `UPDATE search_watches SET digested_through = $2 WHERE id::text = ANY($1)`, watchIDs, through)
+	if err != nil {
+		return fmt.Errorf("failed to mark watches digested: %v", err)
+	}
+	return nil
+}
+
+type rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close()
+}
+
+func scanWatches(rows rows) ([]Watch, error) {
+	defer rows.Close()
+
+	watches := []Watch{}
+	for rows.Next() {
+		var watch Watch
+		if err := rows.Scan(&watch.ID, &watch.UserID, &watch.Kind, &watch.Value, &watch.Label, &watch.Email,
+			&watch.CreatedAt, &watch.DigestedThrough); err != nil {
+			return nil, fmt.Errorf("failed to scan watch: %v", err)
+		}
+		watches = append(watches, watch)
+	}
+	return watches, rows.Err()
+}
@@ -0,0 +1,191 @@
+package watches
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/taxonomy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	watch := Watch{Kind: " Person ", Value: " Ada Lovelace ", Email: "Ada <ada@example.com>"}
+	require.NoError(t, Validate(&watch))
+	assert.Equal(t, KindPerson, watch.Kind)
+	assert.Equal(t, "Ada Lovelace", watch.Value)
+	assert.Equal(t, "Ada Lovelace", watch.Label)
+	assert.Equal(t, "ada@example.com", watch.Email)
+
+	for _, invalid := range []Watch{
+		{Kind: "place", Value: "Paris", Email: "a@example.com"},
+		{Kind: KindTopic, Value: " ", Email: "a@example.com"},
+		{Kind: KindTopic, Value: "--", Email: "a@example.com"},
+		{Kind: KindTopic, Value: "ships", Email: "not an address"},
+	} {
+		var validationErr *ValidationError
+		assert.True(t, errors.As(Validate(&invalid), &validationErr), "%+v", invalid)
+	}
+}
+
+func TestPercolate(t *testing.T) {
+	asset := Asset{CollectionID: "C1", Text: "harbour_day.mp4 Faces: Ada Lovelace, Charles Babbage"}
+	words := Tokenize(asset.Text)
+
+	assert.True(t, Percolate(Watch{Kind: KindPerson}, [][]string{Tokenize("ada lovelace")}, asset, words))
+	assert.False(t, Percolate(Watch{Kind: KindPerson}, [][]string{Tokenize("lovelace ada")}, asset, words))
+	assert.True(t, Percolate(Watch{Kind: KindTopic}, [][]string{{"ships"}, {"harbour"}}, asset, words))
+	assert.False(t, Percolate(Watch{Kind: KindTopic}, [][]string{{"harb"}}, asset, words))
+	assert.True(t, Percolate(Watch{Kind: KindCollection, Value: "c1"}, nil, asset, words))
+	assert.False(t, Percolate(Watch{Kind: KindCollection, Value: "c2"}, nil, asset, words))
+}
+
+type fakeSource struct {
+	watches  []Watch
+	assets   []Asset
+	marked   map[string]time.Time
+	lastSeen time.Time
+}
+
+func (f *fakeSource) Due(ctx context.Context, cutoff time.Time) ([]Watch, error) {
+	var due []Watch
+	for _, watch := range f.watches {
+		if through, ok := f.marked[watch.ID]; ok {
+			watch.DigestedThrough = through
+		}
+		if !watch.DigestedThrough.After(cutoff) {
+			due = append(due, watch)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeSource) NewAssets(ctx context.Context, since, until time.Time, limit int) ([]Asset, error) {
+	f.lastSeen = since
+	var assets []Asset
+	for _, asset := range f.assets {
+		if asset.CreatedAt.After(since) && !asset.CreatedAt.After(until) && len(assets) < limit {
+			assets = append(assets, asset)
+		}
+	}
+	return assets, nil
+}
+
+func (f *fakeSource) MarkDigested(ctx context.Context, watchIDs []string, through time.Time) error {
+	for _, id := range watchIDs {
+		f.marked[id] = through
+	}
+	return nil
+}
+
+type recordingNotifier struct {
+	digests []Digest
+	err     error
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, digest Digest) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.digests = append(r.digests, digest)
+	return nil
+}
+
+type fakeExpander map[string][]string
+
+func (f fakeExpander) Expand(labels []string, direction taxonomy.Direction, depth int) ([]string, error) {
+	return append(labels, f[labels[0]]...), nil
+}
+
+func TestDigesterRun(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(day + 2*time.Hour)
+
+	source := &fakeSource{
+		watches: []Watch{
+			{ID: "w1", UserID: "u1", Email: "u1@example.com", Kind: KindTopic, Value: "vessels", Label: "Vessels", DigestedThrough: start},
+			{ID: "w2", UserID: "u1", Email: "u1@example.com", Kind: KindCollection, Value: "c1", Label: "Archive", DigestedThrough: start},
+			{ID: "w3", UserID: "u2", Email: "u2@example.com", Kind: KindPerson, Value: "Grace Hopper", Label: "Grace", DigestedThrough: start},
+			// Digested recently, so not due yet
+			{ID: "w4", UserID: "u3", Email: "u3@example.com", Kind: KindTopic, Value: "ships", DigestedThrough: now},
+		},
+		assets: []Asset{
+			{ID: "a1", Filename: "dock.jpg", CreatedAt: start.Add(time.Hour), Text: "dock.jpg ferry at the pier"},
+			{ID: "a2", Filename: "scan.pdf", CollectionID: "c1", CreatedAt: start.Add(2 * time.Hour), Text: "scan.pdf"},
+			{ID: "a3", Filename: "talk.mp4", CreatedAt: start.Add(3 * time.Hour), Text: "talk.mp4 speaker Grace Hopper"},
+			// Still settling after upload
+			{ID: "a4", Filename: "late.jpg", CollectionID: "c1", CreatedAt: now.Add(-30 * time.Minute), Text: "late.jpg"},
+		},
+		marked: map[string]time.Time{},
+	}
+	notifier := &recordingNotifier{}
+	digester := NewDigester(source, notifier, fakeExpander{"vessels": {"Ferry"}}, nil, Config{Period: day, Settle: time.Hour, MaxAssets: 100, MaxPerWatch: 10})
+
+	sent, err := digester.Run(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	require.Len(t, notifier.digests, 2)
+
+	first := notifier.digests[0]
+	assert.Equal(t, "u1@example.com", first.Email)
+	assert.Equal(t, 2, first.Total())
+	require.Len(t, first.Sections, 2)
+	assert.Equal(t, "a1", first.Sections[0].Assets[0].ID)
+	assert.Equal(t, "a2", first.Sections[1].Assets[0].ID)
+	assert.Contains(t, first.Text(), "Vessels (topic): 1")
+	assert.Equal(t, "DataFlux digest: 2 new assets", first.Subject())
+	assert.Equal(t, "a3", notifier.digests[1].Sections[0].Assets[0].ID)
+
+	until := now.Add(-time.Hour)
+	assert.Equal(t, map[string]time.Time{"w1": until, "w2": until, "w3": until}, source.marked)
+
+	// Nothing is due again until another period has passed
+	sent, err = digester.Run(context.Background(), now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+}
+
+func TestDigesterRetriesFailedNotifications(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	source := &fakeSource{
+		watches: []Watch{{ID: "w1", UserID: "u1", Email: "u1@example.com", Kind: KindCollection, Value: "c1", DigestedThrough: start}},
+		assets:  []Asset{{ID: "a1", CollectionID: "c1", CreatedAt: start.Add(time.Hour)}},
+		marked:  map[string]time.Time{},
+	}
+	notifier := &recordingNotifier{err: errors.New("relay down")}
+	digester := NewDigester(source, notifier, nil, nil, Config{Period: time.Hour, MaxAssets: 100})
+
+	sent, err := digester.Run(context.Background(), start.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+	assert.Empty(t, source.marked)
+}
+
+func TestDigesterStopsWindowAtLastLoadedAsset(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	source := &fakeSource{
+		watches: []Watch{{ID: "w1", UserID: "u1", Email: "u1@example.com", Kind: KindCollection, Value: "c1", DigestedThrough: start}},
+		assets: []Asset{
+			{ID: "a1", CollectionID: "c1", CreatedAt: start.Add(time.Minute)},
+			{ID: "a2", CollectionID: "c1", CreatedAt: start.Add(2 * time.Minute)},
+			{ID: "a3", CollectionID: "c1", CreatedAt: start.Add(3 * time.Minute)},
+		},
+		marked: map[string]time.Time{},
+	}
+	notifier := &recordingNotifier{}
+	digester := NewDigester(source, notifier, nil, nil, Config{Period: time.Hour, MaxAssets: 2, MaxPerWatch: 1})
+
+	_, err := digester.Run(context.Background(), start.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, notifier.digests, 1)
+	section := notifier.digests[0].Sections[0]
+	assert.Equal(t, 2, section.Total)
+	assert.Len(t, section.Assets, 1)
+	assert.True(t, strings.Contains(notifier.digests[0].Text(), "and 1 more"))
+	assert.Equal(t, start.Add(2*time.Minute), source.marked["w1"])
+}
@@ -1,42 +1,122 @@
-package main
+package weaviate
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"dataflux/query-service/pkg/querysyntax"
+	"dataflux/query-service/pkg/retry"
 )
 
+// phraseOverfetch widens BM25 retrieval so post-filtering can still fill a page
+const phraseOverfetch = 5
+
 // WeaviateConfig holds Weaviate configuration
 type WeaviateConfig struct {
-	URL     string
 	Timeout time.Duration
+	// BM25Properties are the properties keyword queries search, each with
+	// an optional ^boost such as filename^2; empty searches them all
+	BM25Properties []string
 }
 
 // WeaviateClient handles Weaviate operations
 type WeaviateClient struct {
-	config     WeaviateConfig
+	config WeaviateConfig
+	// current is shared by the client and the views derived from it, so
+	// a new endpoint reaches every view
+	current *atomic.Pointer[endpoint]
+	tenant  string
+}
+
+// endpoint is the server a client talks to and its connection pool. It is
+// replaced as a whole, so a request uses one endpoint from start to finish.
+type endpoint struct {
+	url        string
 	httpClient *http.Client
 }
 
 // NewWeaviateClient creates a new Weaviate client
 func NewWeaviateClient(url string) *WeaviateClient {
-	return &WeaviateClient{
+	w := &WeaviateClient{
 		config: WeaviateConfig{
-			URL:     url,
 			Timeout: 30 * time.Second,
 		},
+		current: &atomic.Pointer[endpoint]{},
+	}
+	w.current.Store(w.newEndpoint(url))
+	return w
+}
+
+func (w *WeaviateClient) newEndpoint(url string) *endpoint {
+	return &endpoint{
+		url: url,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   w.config.Timeout,
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
 		},
 	}
 }
 
+// Reconfigure points the client and its views at a server, with a new
+// connection pool. Requests already sent finish on the old pool, whose
+// connections are closed once they have timed out.
+func (w *WeaviateClient) Reconfigure(url string) {
+	old := w.current.Swap(w.newEndpoint(url))
+	time.AfterFunc(w.config.Timeout, old.httpClient.CloseIdleConnections)
+}
+
+// URL returns the server the client talks to
+func (w *WeaviateClient) URL() string {
+	return w.current.Load().url
+}
+
+// ForTenant returns a client that queries the tenant's own classes, named
+// like Asset_<tenant>, in place of the shared ones
+func (w *WeaviateClient) ForTenant(tenant string) *WeaviateClient {
+	scoped := *w
+	scoped.tenant = tenant
+	return &scoped
+}
+
+// WithBM25Properties returns a client whose keyword and hybrid queries
+// search and weight the properties as listed
+func (w *WeaviateClient) WithBM25Properties(properties []string) *WeaviateClient {
+	tuned := *w
+	tuned.config.BM25Properties = properties
+	return &tuned
+}
+
+// ParseBM25Properties reads a comma-separated list of properties with
+// optional boosts
+func ParseBM25Properties(list string) []string {
+	var properties []string
+	for _, property := range strings.Split(list, ",") {
+		if property = strings.TrimSpace(property); property != "" {
+			properties = append(properties, property)
+		}
+	}
+	return properties
+}
+
+// class returns the name of the class to query for a base class name
+func (w *WeaviateClient) class(name string) string {
+	if w.tenant == "" {
+		return name
+	}
+	return name + "_" + w.tenant
+}
+
 // HealthCheck checks if Weaviate is healthy
 func (w *WeaviateClient) HealthCheck() bool {
-	resp, err := w.httpClient.Get(w.config.URL + "/v1/meta")
+	e := w.current.Load()
+	resp, err := e.httpClient.Get(e.url + "/v1/meta")
 	if err != nil {
 		return false
 	}
@@ -53,6 +133,9 @@ type SearchRequest struct {
 	Offset   int                    `json:"offset"`
 	Where    map[string]interface{} `json:"where,omitempty"`
 	Hybrid   bool                   `json:"hybrid,omitempty"`
+	// Alpha weighs a hybrid query from pure keyword (0) to pure vector (1)
+	Alpha      float64  `json:"alpha"`
+	Properties []string `json:"properties,omitempty"`
 }
 
 // SearchResponse represents a search response from Weaviate
@@ -67,7 +150,8 @@ type WeaviateObject struct {
 	Additional struct {
 		ID       string  `json:"id"`
 		Distance float64 `json:"distance"`
-		Score    float64 `json:"score"`
+		// Score is returned as a string by the GraphQL API
+		Score json.Number `json:"score"`
 	} `json:"_additional"`
 	EntityID         string                 `json:"entity_id"`
 	Filename         string                 `json:"filename"`
@@ -80,6 +164,26 @@ type WeaviateObject struct {
 	CollectionID     string                 `json:"collection_id"`
 }
 
+// Similarity converts the cosine distance of a near-vector hit to a 0-1 score
+func (o WeaviateObject) Similarity() float64 {
+	similarity := 1 - o.Additional.Distance
+	if similarity < 0 {
+		return 0
+	}
+	return similarity
+}
+
+// AssetsNearVector returns the assets whose embeddings are nearest to the
+// vector, most similar first. A nil where filter matches all objects.
+func (w *WeaviateClient) AssetsNearVector(vector []float64, where map[string]interface{}, limit int) ([]WeaviateObject, error) {
+	return w.performSearch(SearchRequest{
+		Class:  w.class(AssetClass),
+		Vector: vector,
+		Limit:  limit,
+		Where:  where,
+	})
+}
+
 // SearchSimilarAssets searches for similar assets using vector similarity
 func (w *WeaviateClient) SearchSimilarAssets(queryVector []float64, limit int, collectionID string) ([]WeaviateObject, error) {
 	whereFilter := make(map[string]interface{})
@@ -92,7 +196,7 @@ func (w *WeaviateClient) SearchSimilarAssets(queryVector []float64, limit int, c
 	}
 
 	searchReq := SearchRequest{
-		Class:  "Asset",
+		Class:  w.class(AssetClass),
 		Vector: queryVector,
 		Limit:  limit,
 		Where:  whereFilter,
@@ -101,23 +205,25 @@ func (w *WeaviateClient) SearchSimilarAssets(queryVector []float64, limit int, c
 	return w.performSearch(searchReq)
 }
 
-// HybridSearch performs hybrid search (text + vector)
-func (w *WeaviateClient) HybridSearch(queryText string, queryVector []float64, limit int) ([]WeaviateObject, error) {
-	searchReq := SearchRequest{
-		Class:  "Asset",
+// HybridSearch fuses BM25 over the query text with a nearVector search,
+// weighted by alpha from pure keyword (0) to pure vector (1). Without a
+// vector it is a plain BM25 search. A nil where filter matches all objects.
+func (w *WeaviateClient) HybridSearch(queryText string, queryVector []float64, alpha float64, where map[string]interface{}, limit int) ([]WeaviateObject, error) {
+	return w.performSearch(SearchRequest{
+		Class:  w.class(AssetClass),
 		Query:  queryText,
 		Vector: queryVector,
 		Limit:  limit,
-		Hybrid: true,
-	}
-
-	return w.performSearch(searchReq)
+		Where:  where,
+		Hybrid: len(queryVector) > 0,
+		Alpha:  alpha,
+	})
 }
 
 // TextSearch performs text-only search
 func (w *WeaviateClient) TextSearch(queryText string, limit int) ([]WeaviateObject, error) {
 	searchReq := SearchRequest{
-		Class: "Asset",
+		Class: w.class(AssetClass),
 		Query: queryText,
 		Limit: limit,
 	}
@@ -125,8 +231,97 @@ func (w *WeaviateClient) TextSearch(queryText string, limit int) ([]WeaviateObje
 	return w.performSearch(searchReq)
 }
 
+// PhraseSearch runs BM25 over the terms of a phrase or proximity query and
+// keeps the objects whose text satisfies the positional constraints, since
+// BM25 itself ignores word order. A nil where filter matches all objects.
+func (w *WeaviateClient) PhraseSearch(query querysyntax.Query, where map[string]interface{}, limit int) ([]WeaviateObject, error) {
+	objects, err := w.performSearch(SearchRequest{
+		Class: w.class(AssetClass),
+		Query: query.BM25Text(),
+		Limit: limit * phraseOverfetch,
+		Where: where,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]WeaviateObject, 0, limit)
+	for _, object := range objects {
+		if query.Matches(objectText(object)) {
+			matched = append(matched, object)
+			if len(matched) == limit {
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+// WithoutTerms drops the objects whose text mentions an excluded term, all
+// of its words for a term of several. Tags are excluded by the where
+// filter; this catches filenames and metadata.
+func WithoutTerms(objects []WeaviateObject, terms []string) []WeaviateObject {
+	if len(terms) == 0 {
+		return objects
+	}
+	kept := objects[:0:0]
+	for _, object := range objects {
+		words := map[string]bool{}
+		for _, word := range querysyntax.Words(objectText(object)) {
+			words[word] = true
+		}
+		if !mentionsAny(words, terms) {
+			kept = append(kept, object)
+		}
+	}
+	return kept
+}
+
+func mentionsAny(words map[string]bool, terms []string) bool {
+	for _, term := range terms {
+		termWords := querysyntax.Words(term)
+		mentioned := len(termWords) > 0
+		for _, word := range termWords {
+			mentioned = mentioned && words[word]
+		}
+		if mentioned {
+			return true
+		}
+	}
+	return false
+}
+
+// objectText is the filename, tags and string metadata that phrase
+// constraints are checked against
+func objectText(object WeaviateObject) string {
+	parts := []string{object.Filename, strings.Join(object.Tags, " ")}
+	for _, value := range object.Metadata {
+		if str, ok := value.(string); ok {
+			parts = append(parts, str)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// graphql posts a GraphQL Get query; queries only read, so transient
+// failures are retried
+func (w *WeaviateClient) graphql(jsonData []byte) (*http.Response, error) {
+	e := w.current.Load()
+	return retry.Default.Send(context.Background(), "weaviate", e.httpClient, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", e.url+"/v1/graphql", bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+}
+
 // performSearch executes a search request
 func (w *WeaviateClient) performSearch(req SearchRequest) ([]WeaviateObject, error) {
+	if req.Query != "" {
+		req.Properties = w.config.BM25Properties
+	}
 	// Build GraphQL query
 	query := w.buildGraphQLQuery(req)
 	
@@ -142,11 +337,7 @@ func (w *WeaviateClient) performSearch(req SearchRequest) ([]WeaviateObject, err
 	}
 
 	// Make HTTP request
-	resp, err := w.httpClient.Post(
-		w.config.URL+"/v1/graphql",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+	resp, err := w.graphql(jsonData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %v", err)
 	}
@@ -174,25 +365,28 @@ func (w *WeaviateClient) performSearch(req SearchRequest) ([]WeaviateObject, err
 
 // buildGraphQLQuery builds a GraphQL query for Weaviate
 func (w *WeaviateClient) buildGraphQLQuery(req SearchRequest) string {
-	var queryParts []string
-	
 	// Base query structure
 	query := fmt.Sprintf(`
-		query($class: String!, $query: String, $vector: [Float], $limit: Int, $offset: Int, $where: WhereFilter) {
+		query($class: String!, $query: String, $vector: [Float], $alpha: Float, $properties: [String], $limit: Int, $offset: Int, $where: WhereFilter) {
 			Get {
 				%s(
 					limit: $limit
 					offset: $offset`, req.Class)
 
 	// Add search parameters
-	if req.Query != "" {
-		query += `
-					bm25: {query: $query}`
-	}
-	
-	if len(req.Vector) > 0 {
+	switch {
+	case req.Hybrid:
 		query += `
+					hybrid: {query: $query, vector: $vector, alpha: $alpha` + propertiesArgument(req) + `}`
+	default:
+		if req.Query != "" {
+			query += `
+					bm25: {query: $query` + propertiesArgument(req) + `}`
+		}
+		if len(req.Vector) > 0 {
+			query += `
 					nearVector: {vector: $vector}`
+		}
 	}
 	
 	if req.Where != nil {
@@ -226,9 +420,20 @@ func (w *WeaviateClient) buildGraphQLQuery(req SearchRequest) string {
 	return query
 }
 
+// propertiesArgument restricts keyword matching to the tuned properties
+func propertiesArgument(req SearchRequest) string {
+	if len(req.Properties) == 0 {
+		return ""
+	}
+	return ", properties: $properties"
+}
+
 // GetObject retrieves an object by ID
 func (w *WeaviateClient) GetObject(objectID string) (*WeaviateObject, error) {
-	resp, err := w.httpClient.Get(w.config.URL + "/v1/objects/" + objectID)
+	e := w.current.Load()
+	resp, err := retry.Default.Send(context.Background(), "weaviate", e.httpClient, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", e.url+"/v1/objects/"+objectID, nil)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get object: %v", err)
 	}
@@ -251,6 +456,61 @@ func (w *WeaviateClient) GetObject(objectID string) (*WeaviateObject, error) {
 	return &obj, nil
 }
 
+// GetAssetByEntityID looks up the Asset object indexed for an entity; it
+// returns nil without an error when the asset is not indexed
+func (w *WeaviateClient) GetAssetByEntityID(entityID string) (*WeaviateObject, error) {
+	value, err := json.Marshal(entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal entity id: %v", err)
+	}
+
+	query := fmt.Sprintf(`{
+		Get {
+			%s(limit: 1, where: {path: ["entity_id"], operator: Equal, valueString: %s}) {
+				_additional { id }
+				entity_id
+				filename
+				mime_type
+				file_size
+				processing_status
+				created_at
+				tags
+				collection_id
+			}
+		}
+	}`, w.class(AssetClass), value)
+
+	jsonData, err := json.Marshal(map[string]interface{}{"query": query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, err := w.graphql(jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		SearchResponse
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("graphql error: %s", result.Errors[0].Message)
+	}
+
+	assets := result.Data.Get[w.class(AssetClass)]
+	if len(assets) == 0 {
+		return nil, nil
+	}
+	return &assets[0], nil
+}
+
 // CreateObject creates a new object in Weaviate
 func (w *WeaviateClient) CreateObject(class string, properties map[string]interface{}, vector []float64) (string, error) {
 	objData := map[string]interface{}{
@@ -267,8 +527,9 @@ func (w *WeaviateClient) CreateObject(class string, properties map[string]interf
 		return "", fmt.Errorf("failed to marshal object: %v", err)
 	}
 
-	resp, err := w.httpClient.Post(
-		w.config.URL+"/v1/objects",
+	e := w.current.Load()
+	resp, err := e.httpClient.Post(
+		e.url+"/v1/objects",
 		"application/json",
 		bytes.NewBuffer(jsonData),
 	)
@@ -309,13 +570,14 @@ func (w *WeaviateClient) UpdateObject(objectID string, properties map[string]int
 		return fmt.Errorf("failed to marshal update: %v", err)
 	}
 
-	req, err := http.NewRequest("PATCH", w.config.URL+"/v1/objects/"+objectID, bytes.NewBuffer(jsonData))
+	e := w.current.Load()
+	req, err := http.NewRequest("PATCH", e.url+"/v1/objects/"+objectID, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := w.httpClient.Do(req)
+	resp, err := e.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to update object: %v", err)
 	}
@@ -331,12 +593,13 @@ func (w *WeaviateClient) UpdateObject(objectID string, properties map[string]int
 
 // DeleteObject deletes an object by ID
 func (w *WeaviateClient) DeleteObject(objectID string) error {
-	req, err := http.NewRequest("DELETE", w.config.URL+"/v1/objects/"+objectID, nil)
+	e := w.current.Load()
+	req, err := http.NewRequest("DELETE", e.url+"/v1/objects/"+objectID, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	resp, err := w.httpClient.Do(req)
+	resp, err := e.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to delete object: %v", err)
 	}
@@ -369,7 +632,7 @@ func (m *MockWeaviateClient) SearchSimilarAssets(queryVector []float64, limit in
 	return []WeaviateObject{}, nil
 }
 
-func (m *MockWeaviateClient) HybridSearch(queryText string, queryVector []float64, limit int) ([]WeaviateObject, error) {
+func (m *MockWeaviateClient) HybridSearch(queryText string, queryVector []float64, alpha float64, where map[string]interface{}, limit int) ([]WeaviateObject, error) {
 	// Mock implementation - return empty results
 	return []WeaviateObject{}, nil
 }
@@ -0,0 +1,78 @@
+package weaviate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHybridSearch(t *testing.T) {
+	var body struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"data":{"Get":{"Asset":[{"_additional":{"id":"o1","score":"0.7"},"entity_id":"a1"}]}}}`))
+	}))
+	defer server.Close()
+	client := NewWeaviateClient(server.URL).WithBM25Properties(ParseBM25Properties(" filename^2, tags ,"))
+
+	objects, err := client.HybridSearch("harbour", []float64{0.5, 0.25}, 0.3, nil, 5)
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Contains(t, body.Query, "hybrid: {query: $query, vector: $vector, alpha: $alpha, properties: $properties}")
+	assert.NotContains(t, body.Query, "nearVector")
+	assert.Equal(t, 0.3, body.Variables["alpha"])
+	assert.Equal(t, []interface{}{"filename^2", "tags"}, body.Variables["properties"])
+
+	// Without a vector the query falls back to plain BM25
+	_, err = client.HybridSearch("harbour", nil, 0.3, nil, 5)
+	require.NoError(t, err)
+	assert.Contains(t, body.Query, "bm25: {query: $query, properties: $properties}")
+	assert.NotContains(t, body.Query, "hybrid")
+}
+
+func TestReconfigureReachesViews(t *testing.T) {
+	object := func(id string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"entity_id":"` + id + `"}`))
+		}))
+	}
+	old := object("old")
+	defer old.Close()
+	rotated := object("rotated")
+	defer rotated.Close()
+
+	client := NewWeaviateClient(old.URL)
+	view := client.WithBM25Properties([]string{"filename"}).ForTenant("acme")
+	obj, err := view.GetObject("o1")
+	require.NoError(t, err)
+	assert.Equal(t, "old", obj.EntityID)
+
+	client.Reconfigure(rotated.URL)
+	obj, err = view.GetObject("o1")
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", obj.EntityID)
+	assert.Equal(t, rotated.URL, view.URL())
+}
+
+func TestWithoutTerms(t *testing.T) {
+	objects := []WeaviateObject{
+		{EntityID: "empty-beach", Filename: "beach.jpg"},
+		{EntityID: "crowded-beach", Filename: "beach-people.jpg"},
+		{EntityID: "red-car", Filename: "street.jpg", Metadata: map[string]interface{}{"caption": "a red car"}},
+		{EntityID: "red-door", Filename: "door.jpg", Tags: []string{"red"}},
+	}
+
+	var kept []string
+	for _, object := range WithoutTerms(objects, []string{"people", "red car"}) {
+		kept = append(kept, object.EntityID)
+	}
+	assert.Equal(t, []string{"empty-beach", "red-door"}, kept)
+	assert.Len(t, WithoutTerms(objects, nil), 4)
+}
@@ -0,0 +1,115 @@
+package weaviate
+
+import (
+	"math"
+	"time"
+
+	"dataflux/query-service/pkg/filter"
+)
+
+// filterProperties are the Asset properties filters can be pushed down to.
+// file_size is an int property, so its bounds are rounded inwards.
+var filterProperties = map[string]string{
+	filter.FieldMimeType:     "valueString",
+	filter.FieldCollectionID: "valueString",
+	filter.FieldTags:         "valueString",
+	filter.FieldFileSize:     "valueInt",
+	filter.FieldCreatedAt:    "valueDate",
+}
+
+// WhereFilter translates filter clauses into a Weaviate where filter. It
+// reports false when a clause uses a property the Asset class does not
+// have or a value no asset can match, in which case the search should be
+// skipped rather than run unfiltered.
+func WhereFilter(clauses []filter.Clause) (map[string]interface{}, bool) {
+	var operands []map[string]interface{}
+	for _, clause := range clauses {
+		valueKey, ok := filterProperties[clause.Field]
+		if !ok {
+			return nil, false
+		}
+		path := []string{clause.Field}
+		operand := func(operator string, value interface{}) map[string]interface{} {
+			return map[string]interface{}{"path": path, "operator": operator, valueKey: whereValue(value)}
+		}
+
+		switch clause.Op {
+		case filter.OpEq, filter.OpIn:
+			var alternatives []map[string]interface{}
+			for _, value := range clause.Values {
+				// No file has a fractional size
+				if number, ok := value.(float64); ok && number != math.Trunc(number) {
+					continue
+				}
+				alternatives = append(alternatives, operand("Equal", value))
+			}
+			if len(alternatives) == 0 {
+				return nil, false
+			}
+			operands = append(operands, combine("Or", alternatives))
+		case filter.OpPrefix:
+			operands = append(operands, operand("Like", clause.Values[0].(string)+"*"))
+		case filter.OpExists:
+			operands = append(operands, map[string]interface{}{"path": path, "operator": "IsNull", "valueBoolean": !clause.Exists})
+		case filter.OpRange:
+			bounds := []struct {
+				operator string
+				value    interface{}
+				round    func(float64) float64
+			}{
+				{"GreaterThan", clause.Range.Gt, math.Floor},
+				{"GreaterThanEqual", clause.Range.Gte, math.Ceil},
+				{"LessThan", clause.Range.Lt, math.Ceil},
+				{"LessThanEqual", clause.Range.Lte, math.Floor},
+			}
+			for _, bound := range bounds {
+				if bound.value == nil {
+					continue
+				}
+				value := bound.value
+				if number, ok := value.(float64); ok {
+					value = bound.round(number)
+				}
+				operands = append(operands, operand(bound.operator, value))
+			}
+		}
+	}
+
+	if len(operands) == 0 {
+		return nil, true
+	}
+	return combine("And", operands), true
+}
+
+// Exclude adds to a where filter, which may be nil, that objects are tagged
+// with none of the excluded terms
+func Exclude(where map[string]interface{}, terms []string) map[string]interface{} {
+	var operands []map[string]interface{}
+	if where != nil {
+		operands = append(operands, where)
+	}
+	for _, term := range terms {
+		operands = append(operands, map[string]interface{}{"path": []string{filter.FieldTags}, "operator": "NotEqual", "valueString": term})
+	}
+	if len(operands) == 0 {
+		return nil
+	}
+	return combine("And", operands)
+}
+
+func combine(operator string, operands []map[string]interface{}) map[string]interface{} {
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	return map[string]interface{}{"operator": operator, "operands": operands}
+}
+
+func whereValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	}
+	return value
+}
@@ -0,0 +1,62 @@
+package weaviate
+
+import (
+	"testing"
+
+	"dataflux/query-service/pkg/filter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhereFilter(t *testing.T) {
+	set, err := filter.FromMap(map[string]interface{}{
+		"tags":       []interface{}{"beach", "sunset"},
+		"file_size":  map[string]interface{}{"range": map[string]interface{}{"gt": 10.5}},
+		"created_at": map[string]interface{}{"exists": true},
+	})
+	require.NoError(t, err)
+
+	where, ok := WhereFilter(set.Clauses())
+	require.True(t, ok)
+	assert.Equal(t, map[string]interface{}{
+		"operator": "And",
+		"operands": []map[string]interface{}{
+			{"path": []string{"created_at"}, "operator": "IsNull", "valueBoolean": false},
+			{"path": []string{"file_size"}, "operator": "GreaterThan", "valueInt": int64(10)},
+			{"operator": "Or", "operands": []map[string]interface{}{
+				{"path": []string{"tags"}, "operator": "Equal", "valueString": "beach"},
+				{"path": []string{"tags"}, "operator": "Equal", "valueString": "sunset"},
+			}},
+		},
+	}, where)
+}
+
+func TestWhereFilterUnsupported(t *testing.T) {
+	where, ok := WhereFilter(nil)
+	assert.True(t, ok)
+	assert.Nil(t, where)
+
+	set, err := filter.FromMap(map[string]interface{}{"duration": map[string]interface{}{"exists": true}})
+	require.NoError(t, err)
+	_, ok = WhereFilter(set.Clauses())
+	assert.False(t, ok)
+
+	set, err = filter.FromMap(map[string]interface{}{"file_size": 10.5})
+	require.NoError(t, err)
+	_, ok = WhereFilter(set.Clauses())
+	assert.False(t, ok)
+}
+
+func TestExclude(t *testing.T) {
+	assert.Nil(t, Exclude(nil, nil))
+
+	tagged := map[string]interface{}{"path": []string{"tags"}, "operator": "Equal", "valueString": "beach"}
+	assert.Equal(t, map[string]interface{}{
+		"operator": "And",
+		"operands": []map[string]interface{}{
+			tagged,
+			{"path": []string{"tags"}, "operator": "NotEqual", "valueString": "people"},
+		},
+	}, Exclude(tagged, []string{"people"}))
+}
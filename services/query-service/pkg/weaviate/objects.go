@@ -0,0 +1,117 @@
+package weaviate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// objectNamespace seeds the IDs of objects upserted by key
+var objectNamespace = []byte("dataflux/weaviate/")
+
+// ObjectID returns the UUID an object of class is stored under for key,
+// the same every time, so writing it again replaces it
+func ObjectID(class, key string) string {
+	sum := sha1.Sum(append(append(append([]byte{}, objectNamespace...), class+"/"...), key...))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// UpsertObject stores an object of the base class under the ID derived
+// from key, replacing the one stored before. A tenant view writes to the
+// tenant's class.
+func (w *WeaviateClient) UpsertObject(ctx context.Context, class, key string, properties map[string]interface{}, vector []float64) error {
+	class = w.class(class)
+	id := ObjectID(class, key)
+	object := map[string]interface{}{
+		"class":      class,
+		"id":         id,
+		"properties": properties,
+	}
+	if len(vector) > 0 {
+		object["vector"] = vector
+	}
+	jsonData, err := json.Marshal(object)
+	if err != nil {
+		return fmt.Errorf("failed to marshal object: %v", err)
+	}
+
+	// Replacing needs the object to exist; a missing one is created
+	status, body, err := w.send(ctx, "PUT", "/v1/objects/"+url.PathEscape(class)+"/"+id, jsonData)
+	if err == nil && status == http.StatusNotFound {
+		status, body, err = w.send(ctx, "POST", "/v1/objects", jsonData)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upsert object: %v", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to upsert object: %d - %s", status, body)
+	}
+	return nil
+}
+
+// DeleteObjectByKey deletes the object of the base class stored for key by
+// UpsertObject; a missing object is not an error
+func (w *WeaviateClient) DeleteObjectByKey(ctx context.Context, class, key string) error {
+	class = w.class(class)
+	status, body, err := w.send(ctx, "DELETE", "/v1/objects/"+url.PathEscape(class)+"/"+ObjectID(class, key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %v", err)
+	}
+	if status != http.StatusNoContent && status != http.StatusNotFound {
+		return fmt.Errorf("failed to delete object: %d - %s", status, body)
+	}
+	return nil
+}
+
+// DeleteObjectsWhere deletes the objects of the base class whose property
+// equals value
+func (w *WeaviateClient) DeleteObjectsWhere(ctx context.Context, class, property, value string) error {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"match": map[string]interface{}{
+			"class": w.class(class),
+			"where": map[string]interface{}{
+				"path":        []string{property},
+				"operator":    "Equal",
+				"valueString": value,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal delete: %v", err)
+	}
+
+	status, body, err := w.send(ctx, "DELETE", "/v1/batch/objects", jsonData)
+	if err != nil {
+		return fmt.Errorf("failed to delete objects: %v", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to delete objects: %d - %s", status, body)
+	}
+	return nil
+}
+
+// send makes a request with a JSON body, if any, and returns the response
+// status and body
+func (w *WeaviateClient) send(ctx context.Context, method, path string, jsonData []byte) (int, []byte, error) {
+	e := w.current.Load()
+	req, err := http.NewRequestWithContext(ctx, method, e.url+path, bytes.NewReader(jsonData))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
@@ -0,0 +1,77 @@
+package weaviate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectID(t *testing.T) {
+	id := ObjectID("Asset", "asset-1")
+	assert.Equal(t, id, ObjectID("Asset", "asset-1"))
+	assert.NotEqual(t, id, ObjectID("Asset_acme", "asset-1"))
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+}
+
+func TestUpsertObject(t *testing.T) {
+	stored := map[string]map[string]interface{}{}
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		var object map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&object))
+		id, _ := object["id"].(string)
+		if r.Method == "PUT" && stored[id] == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		stored[id] = object
+	}))
+	defer server.Close()
+
+	client := NewWeaviateClient(server.URL).ForTenant("acme")
+	properties := map[string]interface{}{"entity_id": "asset-1"}
+	require.NoError(t, client.UpsertObject(context.Background(), AssetClass, "asset-1", properties, []float64{0.5}))
+	require.NoError(t, client.UpsertObject(context.Background(), AssetClass, "asset-1", properties, nil))
+
+	id := ObjectID("Asset_acme", "asset-1")
+	assert.Equal(t, []string{
+		"PUT /v1/objects/Asset_acme/" + id,
+		"POST /v1/objects",
+		"PUT /v1/objects/Asset_acme/" + id,
+	}, requests)
+	require.Len(t, stored, 1)
+	assert.Equal(t, "Asset_acme", stored[id]["class"])
+}
+
+func TestDeleteObjectByKey(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	// A missing object counts as deleted
+	require.NoError(t, NewWeaviateClient(server.URL).DeleteObjectByKey(context.Background(), AssetClass, "asset-1"))
+	assert.Equal(t, []string{"DELETE /v1/objects/Asset/" + ObjectID("Asset", "asset-1")}, paths)
+}
+
+func TestDeleteObjectsWhere(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "DELETE /v1/batch/objects", r.Method+" "+r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer server.Close()
+
+	require.NoError(t, NewWeaviateClient(server.URL).DeleteObjectsWhere(context.Background(), SegmentClass, "asset_id", "asset-1"))
+	match := body["match"].(map[string]interface{})
+	assert.Equal(t, "Segment", match["class"])
+	assert.Equal(t, "asset-1", match["where"].(map[string]interface{})["valueString"])
+}
@@ -0,0 +1,215 @@
+package weaviate
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// AssetClass holds one object per asset
+const AssetClass = "Asset"
+
+// SegmentClass holds one object per analysed segment, embedded like its asset
+const SegmentClass = "Segment"
+
+// Scopes of a similar-segments lookup
+const (
+	// ScopeAsset looks for similar segments within the segment's own asset
+	ScopeAsset = "asset"
+	// ScopeGlobal looks across every asset
+	ScopeGlobal = "global"
+)
+
+// durationOverfetch multiplies the candidates fetched when durations are
+// bounded, as durations are not indexed and are checked after the lookup
+const durationOverfetch = 10
+
+// SegmentConstraints narrow a similar-segments lookup; the zero value keeps
+// every segment
+type SegmentConstraints struct {
+	// SegmentType keeps segments of one type, such as scene
+	SegmentType string
+	// MinDuration and MaxDuration bound end_time - start_time in seconds;
+	// 0 leaves a bound open
+	MinDuration float64
+	MaxDuration float64
+	// ExcludeAsset leaves out the other segments of the segment's own asset
+	ExcludeAsset bool
+}
+
+func (c SegmentConstraints) durationBounded() bool {
+	return c.MinDuration > 0 || c.MaxDuration > 0
+}
+
+func (c SegmentConstraints) allows(segment SegmentObject) bool {
+	duration := segment.EndTime - segment.StartTime
+	return (c.MinDuration <= 0 || duration >= c.MinDuration) && (c.MaxDuration <= 0 || duration <= c.MaxDuration)
+}
+
+// SegmentObject is a segment indexed in Weaviate
+type SegmentObject struct {
+	Additional struct {
+		ID       string  `json:"id"`
+		Distance float64 `json:"distance"`
+	} `json:"_additional"`
+	SegmentID          string  `json:"segment_id"`
+	AssetID            string  `json:"asset_id"`
+	SegmentType        string  `json:"segment_type"`
+	SequenceNumber     int     `json:"sequence_number"`
+	StartTime          float64 `json:"start_time"`
+	EndTime            float64 `json:"end_time"`
+	ConfidenceScore    float64 `json:"confidence_score"`
+	ContentDescription string  `json:"content_description"`
+}
+
+// Similarity converts the cosine distance of a near-object hit to a 0-1 score
+func (s SegmentObject) Similarity() float64 {
+	similarity := 1 - s.Additional.Distance
+	if similarity < 0 {
+		return 0
+	}
+	return similarity
+}
+
+const segmentFields = `
+	_additional { id distance }
+	segment_id
+	asset_id
+	segment_type
+	sequence_number
+	start_time
+	end_time
+	confidence_score
+	content_description`
+
+// GetSegment looks up the Segment object indexed for a segment; it returns
+// nil without an error when the segment is not indexed
+func (w *WeaviateClient) GetSegment(segmentID string) (*SegmentObject, error) {
+	query := `query($where: WhereFilter) {
+		Get {
+			` + w.class(SegmentClass) + `(limit: 1, where: $where) {` + segmentFields + `
+			}
+		}
+	}`
+	segments, err := w.querySegments(query, map[string]interface{}{
+		"where": equal("segment_id", segmentID),
+	})
+	if err != nil || len(segments) == 0 {
+		return nil, err
+	}
+	return &segments[0], nil
+}
+
+// SimilarSegments returns the segments nearest to the given one that meet
+// the constraints, most similar first. With ScopeAsset only segments of the
+// same asset are considered; the segment itself is never returned.
+func (w *WeaviateClient) SimilarSegments(segment SegmentObject, scope string, constraints SegmentConstraints, limit int) ([]SegmentObject, error) {
+	// One extra so the segment itself can be dropped
+	fetch := limit + 1
+	if constraints.durationBounded() {
+		fetch *= durationOverfetch
+	}
+	variables := map[string]interface{}{
+		"id":    segment.Additional.ID,
+		"limit": fetch,
+	}
+	var operands []map[string]interface{}
+	if scope == ScopeAsset {
+		operands = append(operands, equal("asset_id", segment.AssetID))
+	}
+	if constraints.ExcludeAsset {
+		operands = append(operands, map[string]interface{}{
+			"path":        []string{"asset_id"},
+			"operator":    "NotEqual",
+			"valueString": segment.AssetID,
+		})
+	}
+	if constraints.SegmentType != "" {
+		operands = append(operands, equal("segment_type", constraints.SegmentType))
+	}
+	where := ""
+	if len(operands) > 0 {
+		where = `
+				where: $where`
+		variables["where"] = combine("And", operands)
+	}
+
+	query := `query($id: String!, $limit: Int, $where: WhereFilter) {
+		Get {
+			` + w.class(SegmentClass) + `(
+				nearObject: {id: $id}
+				limit: $limit` + where + `
+			) {` + segmentFields + `
+			}
+		}
+	}`
+	segments, err := w.querySegments(query, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	similar := make([]SegmentObject, 0, limit)
+	for _, candidate := range segments {
+		if candidate.SegmentID == segment.SegmentID || candidate.Additional.ID == segment.Additional.ID {
+			continue
+		}
+		if !constraints.allows(candidate) {
+			continue
+		}
+		if len(similar) < limit {
+			similar = append(similar, candidate)
+		}
+	}
+	return similar, nil
+}
+
+// SegmentsNearVector returns the segments whose embeddings are nearest to
+// the vector, most similar first
+func (w *WeaviateClient) SegmentsNearVector(vector []float64, limit int) ([]SegmentObject, error) {
+	query := `query($vector: [Float], $limit: Int) {
+		Get {
+			` + w.class(SegmentClass) + `(
+				nearVector: {vector: $vector}
+				limit: $limit
+			) {` + segmentFields + `
+			}
+		}
+	}`
+	return w.querySegments(query, map[string]interface{}{"vector": vector, "limit": limit})
+}
+
+func equal(property, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"path":        []string{property},
+		"operator":    "Equal",
+		"valueString": value,
+	}
+}
+
+func (w *WeaviateClient) querySegments(query string, variables map[string]interface{}) ([]SegmentObject, error) {
+	jsonData, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, err := w.graphql(jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data struct {
+			Get map[string][]SegmentObject `json:"Get"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("graphql error: %s", result.Errors[0].Message)
+	}
+	return result.Data.Get[w.class(SegmentClass)], nil
+}
@@ -0,0 +1,141 @@
+package weaviate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimilarSegmentsWithinAsset(t *testing.T) {
+	var variables map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Contains(t, body.Query, "nearObject")
+		assert.Contains(t, body.Query, "where: $where")
+		variables = body.Variables
+
+		w.Write([]byte(`{"data":{"Get":{"Segment":[
+			{"_additional":{"id":"o1","distance":0},"segment_id":"s1","asset_id":"a1"},
+			{"_additional":{"id":"o2","distance":0.25},"segment_id":"s2","asset_id":"a1","start_time":12.5},
+			{"_additional":{"id":"o3","distance":0.4},"segment_id":"s3","asset_id":"a1"}
+		]}}}`))
+	}))
+	defer server.Close()
+
+	source := SegmentObject{SegmentID: "s1", AssetID: "a1"}
+	source.Additional.ID = "o1"
+	similar, err := NewWeaviateClient(server.URL).SimilarSegments(source, ScopeAsset, SegmentConstraints{}, 1)
+	require.NoError(t, err)
+
+	require.Len(t, similar, 1)
+	assert.Equal(t, "s2", similar[0].SegmentID)
+	assert.Equal(t, 12.5, similar[0].StartTime)
+	assert.Equal(t, 0.75, similar[0].Similarity())
+	assert.Equal(t, "o1", variables["id"])
+	assert.Equal(t, 2.0, variables["limit"])
+	assert.Equal(t, "a1", variables["where"].(map[string]interface{})["valueString"])
+}
+
+func TestSimilarSegmentsGlobalHasNoFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.NotContains(t, body.Query, "where: $where")
+		assert.NotContains(t, body.Variables, "where")
+		w.Write([]byte(`{"data":{"Get":{"Segment":[]}}}`))
+	}))
+	defer server.Close()
+
+	similar, err := NewWeaviateClient(server.URL).SimilarSegments(SegmentObject{SegmentID: "s1"}, ScopeGlobal, SegmentConstraints{}, 5)
+	require.NoError(t, err)
+	assert.Empty(t, similar)
+}
+
+func TestSimilarSegmentsConstraints(t *testing.T) {
+	var variables map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		variables = body.Variables
+
+		w.Write([]byte(`{"data":{"Get":{"Segment":[
+			{"_additional":{"id":"o2","distance":0.1},"segment_id":"s2","asset_id":"a2","start_time":0,"end_time":2},
+			{"_additional":{"id":"o3","distance":0.2},"segment_id":"s3","asset_id":"a3","start_time":10,"end_time":15},
+			{"_additional":{"id":"o4","distance":0.3},"segment_id":"s4","asset_id":"a4","start_time":20,"end_time":60}
+		]}}}`))
+	}))
+	defer server.Close()
+
+	source := SegmentObject{SegmentID: "s1", AssetID: "a1"}
+	similar, err := NewWeaviateClient(server.URL).SimilarSegments(source, ScopeGlobal, SegmentConstraints{
+		SegmentType: "scene", MinDuration: 3, MaxDuration: 30, ExcludeAsset: true,
+	}, 2)
+	require.NoError(t, err)
+
+	require.Len(t, similar, 1)
+	assert.Equal(t, "s3", similar[0].SegmentID)
+	assert.Equal(t, 30.0, variables["limit"])
+	where := variables["where"].(map[string]interface{})
+	assert.Equal(t, "And", where["operator"])
+	operands := where["operands"].([]interface{})
+	require.Len(t, operands, 2)
+	assert.Equal(t, "NotEqual", operands[0].(map[string]interface{})["operator"])
+	assert.Equal(t, "scene", operands[1].(map[string]interface{})["valueString"])
+}
+
+func TestSegmentsNearVector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Contains(t, body.Query, "nearVector: {vector: $vector}")
+		assert.Contains(t, body.Query, "Segment_acme(")
+		assert.Equal(t, []interface{}{0.5, 0.25}, body.Variables["vector"])
+		w.Write([]byte(`{"data":{"Get":{"Segment_acme":[
+			{"_additional":{"id":"o1","distance":0.2},"segment_id":"s1","asset_id":"a1"}
+		]}}}`))
+	}))
+	defer server.Close()
+
+	segments, err := NewWeaviateClient(server.URL).ForTenant("acme").SegmentsNearVector([]float64{0.5, 0.25}, 3)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	assert.Equal(t, 0.8, segments[0].Similarity())
+}
+
+func TestGetSegmentNotIndexed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"Get":{"Segment":[]}}}`))
+	}))
+	defer server.Close()
+
+	segment, err := NewWeaviateClient(server.URL).GetSegment("missing")
+	assert.NoError(t, err)
+	assert.Nil(t, segment)
+}
+
+func TestGetSegmentGraphQLError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors":[{"message":"Cannot query field \"Segment\""}]}`))
+	}))
+	defer server.Close()
+
+	_, err := NewWeaviateClient(server.URL).GetSegment("s1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package weaviate
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// AssetVector is the embedding and tags of an indexed asset
+type AssetVector struct {
+	EntityID string
+	Vector   []float64
+	Tags     []string
+}
+
+// GetAssetVectors loads the embeddings and tags of the given assets in one
+// query; assets that are not indexed are missing from the result
+func (w *WeaviateClient) GetAssetVectors(entityIDs []string) (map[string]AssetVector, error) {
+	vectors := make(map[string]AssetVector, len(entityIDs))
+	if len(entityIDs) == 0 {
+		return vectors, nil
+	}
+
+	operands := make([]map[string]interface{}, len(entityIDs))
+	for i, entityID := range entityIDs {
+		operands[i] = equal("entity_id", entityID)
+	}
+	query := `query($where: WhereFilter, $limit: Int) {
+		Get {
+			` + w.class(AssetClass) + `(where: $where, limit: $limit) {
+				entity_id
+				tags
+				_additional { vector }
+			}
+		}
+	}`
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"query": query,
+		"variables": map[string]interface{}{
+			"where": map[string]interface{}{"operator": "Or", "operands": operands},
+			"limit": len(entityIDs),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, err := w.graphql(jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data struct {
+			Get map[string][]struct {
+				EntityID   string   `json:"entity_id"`
+				Tags       []string `json:"tags"`
+				Additional struct {
+					Vector []float64 `json:"vector"`
+				} `json:"_additional"`
+			} `json:"Get"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("graphql error: %s", result.Errors[0].Message)
+	}
+
+	for _, asset := range result.Data.Get[w.class(AssetClass)] {
+		if len(asset.Additional.Vector) == 0 {
+			continue
+		}
+		vectors[asset.EntityID] = AssetVector{EntityID: asset.EntityID, Vector: asset.Additional.Vector, Tags: asset.Tags}
+	}
+	return vectors, nil
+}
@@ -0,0 +1,69 @@
+package weaviate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAssetVectors(t *testing.T) {
+	var variables map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		variables = body.Variables
+
+		w.Write([]byte(`{"data":{"Get":{"Asset":[
+			{"entity_id":"a1","tags":["beach"],"_additional":{"vector":[0.1,0.2]}},
+			{"entity_id":"a2","tags":[],"_additional":{"vector":null}}
+		]}}}`))
+	}))
+	defer server.Close()
+
+	vectors, err := NewWeaviateClient(server.URL).GetAssetVectors([]string{"a1", "a2", "a3"})
+	require.NoError(t, err)
+
+	require.Len(t, vectors, 1)
+	assert.Equal(t, []float64{0.1, 0.2}, vectors["a1"].Vector)
+	assert.Equal(t, []string{"beach"}, vectors["a1"].Tags)
+	assert.Equal(t, 3.0, variables["limit"])
+	where := variables["where"].(map[string]interface{})
+	assert.Equal(t, "Or", where["operator"])
+	assert.Len(t, where["operands"], 3)
+}
+
+func TestGetAssetVectorsEmpty(t *testing.T) {
+	vectors, err := NewWeaviateClient("http://localhost:1").GetAssetVectors(nil)
+	require.NoError(t, err)
+	assert.Empty(t, vectors)
+}
+
+func TestGetAssetVectorsForTenant(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query string `json:"query"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		query = body.Query
+
+		w.Write([]byte(`{"data":{"Get":{"Asset_acme":[
+			{"entity_id":"a1","tags":[],"_additional":{"vector":[1,0]}}
+		]}}}`))
+	}))
+	defer server.Close()
+
+	client := NewWeaviateClient(server.URL)
+	vectors, err := client.ForTenant("acme").GetAssetVectors([]string{"a1"})
+	require.NoError(t, err)
+
+	assert.Contains(t, query, "Asset_acme(where: $where")
+	assert.Equal(t, []float64{1, 0}, vectors["a1"].Vector)
+	assert.Equal(t, "Asset", client.class(AssetClass))
+}
@@ -0,0 +1,89 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrInternalAddress is returned for URLs reaching loopback, private,
+// link-local or otherwise internal addresses, which would let callers probe
+// the service's own network
+var ErrInternalAddress = errors.New("url must not point at a loopback, private or link-local address")
+
+// internalIP reports whether ip is an address webhooks may not reach
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		// Carrier-grade NAT, shared between sites like a private range
+		ip.To4() != nil && ip.To4()[0] == 100 && ip.To4()[1]&0xc0 == 64
+}
+
+// checkHost refuses hosts that name an internal address without a lookup:
+// IP literals in internal ranges and localhost
+func checkHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrInternalAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && internalIP(ip) {
+		return ErrInternalAddress
+	}
+	return nil
+}
+
+// CheckURL resolves the host of an http or https URL and returns a
+// ValidationError when it is unknown or any of its addresses is internal.
+// Deliveries check the address they connect to again, since DNS answers
+// can change after registration.
+func CheckURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return &ValidationError{Message: "url must be an http or https URL"}
+	}
+	host := parsed.Hostname()
+	if err := checkHost(host); err != nil {
+		return &ValidationError{Message: err.Error()}
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return &ValidationError{Message: fmt.Sprintf("url host %s could not be resolved", host)}
+	}
+	for _, addr := range addrs {
+		if internalIP(addr.IP) {
+			return &ValidationError{Message: ErrInternalAddress.Error()}
+		}
+	}
+	return nil
+}
+
+// NewClient returns an HTTP client for delivering to user-supplied URLs.
+// It refuses to connect to internal addresses, whatever the host resolves
+// to at the time, and ignores proxy settings so the check sees the real
+// destination.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+				return ErrInternalAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,206 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"dataflux/query-service/pkg/events"
+)
+
+// concurrency bounds the events delivered at the same time
+const concurrency = 8
+
+// Registry provides the webhooks subscribed to an event and keeps their
+// delivery log
+type Registry interface {
+	Subscribers(ctx context.Context, tenantID, eventType string) ([]Webhook, error)
+	RecordDelivery(ctx context.Context, delivery Delivery) error
+	PruneDeliveries(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// pending is an event waiting to be delivered to its tenant's webhooks
+type pending struct {
+	event    events.Event
+	tenantID string
+}
+
+// Dispatcher delivers events to the webhooks subscribed to them, signed
+// with each webhook's secret, and retries failed deliveries with
+// exponential backoff. Every attempt is logged.
+type Dispatcher struct {
+	registry    Registry
+	client      *http.Client
+	queue       chan pending
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewDispatcher creates a dispatcher making up to maxAttempts attempts per
+// delivery, the first retry after backoff, each waiting for timeout.
+// Events beyond queueSize pending ones are dropped. Deliveries never
+// connect to internal addresses.
+func NewDispatcher(registry Registry, queueSize, maxAttempts int, backoff, timeout time.Duration) *Dispatcher {
+	return &Dispatcher{
+		registry:    registry,
+		client:      NewClient(timeout),
+		queue:       make(chan pending, queueSize),
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+	}
+}
+
+// Start delivers queued events until ctx is cancelled. Attempts older
+// than retention are pruned from the log every hour.
+func (d *Dispatcher) Start(ctx context.Context, retention time.Duration) {
+	slots := make(chan struct{}, concurrency)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case next := <-d.queue:
+				slots <- struct{}{}
+				go func() {
+					defer func() { <-slots }()
+					d.deliver(ctx, next)
+				}()
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if pruned, err := d.registry.PruneDeliveries(ctx, time.Now().Add(-retention)); err != nil {
+					log.Printf("Warning: %v", err)
+				} else if pruned > 0 {
+					log.Printf("Pruned %d webhook deliveries", pruned)
+				}
+			}
+		}
+	}()
+}
+
+// Dispatch queues an event of a tenant, empty for none, without blocking
+// the caller. A nil dispatcher drops it.
+func (d *Dispatcher) Dispatch(eventType, tenantID string, data map[string]interface{}) {
+	if d == nil {
+		return
+	}
+	event := events.Event{
+		ID:     newEventID(),
+		Type:   eventType,
+		Source: "query-service",
+		Time:   time.Now().UTC(),
+		Data:   data,
+	}
+	select {
+	case d.queue <- pending{event: event, tenantID: tenantID}:
+	default:
+		log.Printf("Warning: webhook queue full, dropping %s event %s", event.Type, event.ID)
+	}
+}
+
+// deliver sends the event to every subscribed webhook and returns when
+// each has succeeded or run out of attempts
+func (d *Dispatcher) deliver(ctx context.Context, next pending) {
+	webhooks, err := d.registry.Subscribers(ctx, next.tenantID, next.event.Type)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	payload, err := json.Marshal(next.event)
+	if err != nil {
+		log.Printf("Warning: failed to encode %s event: %v", next.event.Type, err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, webhook := range webhooks {
+		wg.Add(1)
+		go func(webhook Webhook) {
+			defer wg.Done()
+			backoff := d.backoff
+			for attempt := 1; ; attempt++ {
+				delivery := d.attempt(ctx, webhook, next.event, payload, attempt)
+				if err := d.registry.RecordDelivery(context.Background(), delivery); err != nil {
+					log.Printf("Warning: %v", err)
+				}
+				if delivery.Status == StatusDelivered {
+					return
+				}
+				if attempt >= d.maxAttempts || ctx.Err() != nil {
+					log.Printf("Warning: giving up on %s event %s for webhook %s: %s", next.event.Type, next.event.ID, webhook.ID, delivery.Error)
+					return
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(backoff):
+				}
+				backoff *= 2
+			}
+		}(webhook)
+	}
+	wg.Wait()
+}
+
+// attempt POSTs the event once and treats any non-2xx response as a failure
+func (d *Dispatcher) attempt(ctx context.Context, webhook Webhook, event events.Event, payload []byte, attempt int) (delivery Delivery) {
+	start := time.Now()
+	delivery = Delivery{
+		WebhookID: webhook.ID,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Attempt:   attempt,
+		Status:    StatusFailed,
+		CreatedAt: start.UTC(),
+	}
+	defer func() { delivery.DurationMs = time.Since(start).Milliseconds() }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		delivery.Error = fmt.Sprintf("failed to create request: %v", err)
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(events.EventHeader, event.Type)
+	req.Header.Set(events.DeliveryHeader, event.ID)
+	req.Header.Set(events.SignatureHeader, events.Sign(webhook.Secret, time.Now(), payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		delivery.Error = fmt.Sprintf("failed to deliver event: %v", err)
+		return delivery
+	}
+	resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		delivery.Error = fmt.Sprintf("webhook returned status %d", resp.StatusCode)
+		return delivery
+	}
+	delivery.Status = StatusDelivered
+	return delivery
+}
+
+func newEventID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,364 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Event types webhooks can subscribe to
+const (
+	EventAssetIndexed      = "asset.indexed"
+	EventSearchZeroResults = "search.zero_results"
+	EventSavedSearchMatch  = "saved_search.new_match"
+)
+
+// Events lists every event type, in the order they are documented
+var Events = []string{EventAssetIndexed, EventSearchZeroResults, EventSavedSearchMatch}
+
+// MaxPerTenant bounds the webhooks registered by one tenant
+const MaxPerTenant = 25
+
+// Delivery outcomes
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// ErrNotFound is returned for webhooks that do not exist or belong to
+// another tenant
+var ErrNotFound = errors.New("webhook not found")
+
+// ValidationError reports an invalid webhook
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Webhook is a URL that is sent the events it subscribes to. Webhooks of
+// a tenant hear about its events only; those registered outside any
+// tenant hear about every event.
+type Webhook struct {
+	ID       string   `json:"id"`
+	TenantID string   `json:"tenant_id,omitempty"`
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	// Secret signs the deliveries, as the service's lifecycle events
+	Secret    string    `json:"secret"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Delivery is one attempt to deliver an event to a webhook
+type Delivery struct {
+	ID        int64  `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	Attempt   int    `json:"attempt"`
+	// Status is delivered or failed; a failed attempt is retried until the
+	// dispatcher's attempts run out
+	Status     string    `json:"status"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Validate checks the webhook and normalises its URL and events. Hosts
+// are not looked up; CheckURL does that.
+func Validate(webhook *Webhook) error {
+	webhook.URL = strings.TrimSpace(webhook.URL)
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return &ValidationError{Message: "url must be an http or https URL"}
+	}
+	if err := checkHost(parsed.Hostname()); err != nil {
+		return &ValidationError{Message: err.Error()}
+	}
+
+	seen := map[string]bool{}
+	var subscribed []string
+	for _, event := range webhook.Events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if !contains(Events, event) {
+			return &ValidationError{Message: fmt.Sprintf("events must be among %s", strings.Join(Events, ", "))}
+		}
+		if !seen[event] {
+			seen[event] = true
+			subscribed = append(subscribed, event)
+		}
+	}
+	if len(subscribed) == 0 {
+		return &ValidationError{Message: "events must name at least one event"}
+	}
+	sort.Strings(subscribed)
+	webhook.Events = subscribed
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret returns a random secret for signing webhook deliveries
+func NewSecret() (string, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %v", err)
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// Store keeps the webhooks and their delivery log in PostgreSQL
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// NewStore creates a webhook store
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// EnsureSchema creates the webhooks and webhook_deliveries tables
+func (s *Store) EnsureSchema(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			tenant_id VARCHAR(40) NOT NULL DEFAULT '',
+			url TEXT NOT NULL,
+			events TEXT[] NOT NULL,
+			secret VARCHAR(64) NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhooks_tenant ON webhooks(tenant_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			event_id VARCHAR(64) NOT NULL,
+			event_type VARCHAR(64) NOT NULL,
+			attempt INTEGER NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			duration_ms BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC)`,
+	}
+	for _, statement := range statements {
+		if _, err := s.pool.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webhookColumns are read by scanWebhooks, in order
+const webhookColumns = `id::text, tenant_id, url, events, secret, active, created_at, updated_at`
+
+// List returns the tenant's webhooks, oldest first
+func (s *Store) List(ctx context.Context, tenantID string) ([]Webhook, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+webhookColumns+`
+		FROM webhooks
+		WHERE tenant_id = $1
+		ORDER BY created_at
+	`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %v", err)
+	}
+	return scanWebhooks(rows)
+}
+
+// Get returns one of the tenant's webhooks
+func (s *Store) Get(ctx context.Context, tenantID, id string) (*Webhook, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+webhookColumns+`
+		FROM webhooks
+		WHERE id::text = $1 AND tenant_id = $2
+	`, id, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook: %v", err)
+	}
+	webhooks, err := scanWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, ErrNotFound
+	}
+	return &webhooks[0], nil
+}
+
+// Create validates and stores a webhook with a new secret
+func (s *Store) Create(ctx context.Context, webhook Webhook) (*Webhook, error) {
+	if err := Validate(&webhook); err != nil {
+		return nil, err
+	}
+	if err := CheckURL(ctx, webhook.URL); err != nil {
+		return nil, err
+	}
+	var count int
+	if err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM webhooks WHERE tenant_id = $1`, webhook.TenantID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count webhooks: %v", err)
+	}
+	if count >= MaxPerTenant {
+		return nil, &ValidationError{Message: fmt.Sprintf("at most %d webhooks are allowed per tenant", MaxPerTenant)}
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = secret
+
+	err = s.pool.QueryRow(ctx, `
+		INSERT INTO webhooks (tenant_id, url, events, secret, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id::text, created_at, updated_at
+	`, webhook.TenantID, webhook.URL, webhook.Events, webhook.Secret, webhook.Active).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %v", err)
+	}
+	return &webhook, nil
+}
+
+// Update replaces the URL, events and active flag of one of the tenant's
+// webhooks; its secret is kept
+func (s *Store) Update(ctx context.Context, webhook Webhook) (*Webhook, error) {
+	if err := Validate(&webhook); err != nil {
+		return nil, err
+	}
+	if err := CheckURL(ctx, webhook.URL); err != nil {
+		return nil, err
+	}
+	rows, err := s.pool.Query(ctx, `
+		UPDATE webhooks SET url = $3, events = $4, active = $5, updated_at = NOW()
+		WHERE id::text = $1 AND tenant_id = $2
+		RETURNING `+webhookColumns+`
+	`, webhook.ID, webhook.TenantID, webhook.URL, webhook.Events, webhook.Active)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %v", err)
+	}
+	updated, err := scanWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(updated) == 0 {
+		return nil, ErrNotFound
+	}
+	return &updated[0], nil
+}
+
+// Delete removes one of the tenant's webhooks with its delivery log
+func (s *Store) Delete(ctx context.Context, tenantID, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM webhooks WHERE id::text = $1 AND tenant_id = $2`, id, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Subscribers returns the active webhooks to send a tenant's event to:
+// the tenant's own and those registered outside any tenant
+func (s *Store) Subscribers(ctx context.Context, tenantID, eventType string) ([]Webhook, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+webhookColumns+`
+		FROM webhooks
+		WHERE active AND $2 = ANY(events) AND (tenant_id = $1 OR tenant_id = '')
+	`, tenantID, eventType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscribers: %v", err)
+	}
+	return scanWebhooks(rows)
+}
+
+// RecordDelivery adds an attempt to the delivery log
+func (s *Store) RecordDelivery(ctx context.Context, delivery Delivery) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, attempt, status, status_code, error, duration_ms, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Attempt, delivery.Status, delivery.StatusCode,
+		delivery.Error, delivery.DurationMs, delivery.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %v", err)
+	}
+	return nil
+}
+
+// Deliveries returns up to limit attempts of one of the tenant's webhooks,
+// newest first
+func (s *Store) Deliveries(ctx context.Context, tenantID, id string, limit int) ([]Delivery, error) {
+	if _, err := s.Get(ctx, tenantID, id); err != nil {
+		return nil, err
+	}
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, webhook_id::text, event_id, event_type, attempt, status, status_code, error, duration_ms, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id::text = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var delivery Delivery
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Attempt,
+			&delivery.Status, &delivery.StatusCode, &delivery.Error, &delivery.DurationMs, &delivery.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %v", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// PruneDeliveries removes the attempts made before cutoff
+func (s *Store) PruneDeliveries(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM webhook_deliveries WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune webhook deliveries: %v", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func scanWebhooks(rows pgx.Rows) ([]Webhook, error) {
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		if err := rows.Scan(&webhook.ID, &webhook.TenantID, &webhook.URL, &webhook.Events, &webhook.Secret,
+			&webhook.Active, &webhook.CreatedAt, &webhook.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %v", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
@@ -0,0 +1,140 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"dataflux/query-service/pkg/events"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	webhook := Webhook{URL: " https://example.com/hook ", Events: []string{"search.zero_results", "Asset.Indexed", "asset.indexed"}}
+	require.NoError(t, Validate(&webhook))
+	assert.Equal(t, "https://example.com/hook", webhook.URL)
+	assert.Equal(t, []string{"asset.indexed", "search.zero_results"}, webhook.Events)
+
+	for _, invalid := range []Webhook{
+		{URL: "ftp://example.com", Events: []string{EventAssetIndexed}},
+		{URL: "https://example.com/hook"},
+		{URL: "https://example.com/hook", Events: []string{"asset.deleted"}},
+		{URL: "http://127.0.0.1:8080/hook", Events: []string{EventAssetIndexed}},
+		{URL: "http://169.254.169.254/latest/meta-data", Events: []string{EventAssetIndexed}},
+		{URL: "http://[::1]/hook", Events: []string{EventAssetIndexed}},
+		{URL: "http://api.localhost/hook", Events: []string{EventAssetIndexed}},
+	} {
+		var validationErr *ValidationError
+		assert.True(t, errors.As(Validate(&invalid), &validationErr), "%+v", invalid)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, CheckURL(ctx, "https://93.184.215.14/hook"))
+	for _, internal := range []string{
+		"http://localhost:8003/api/v1/admin/api-keys",
+		"http://10.0.0.5/hook",
+		"http://172.16.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[fe80::1]/hook",
+		"http://[fd00::1]/hook",
+	} {
+		var validationErr *ValidationError
+		assert.True(t, errors.As(CheckURL(ctx, internal), &validationErr), internal)
+	}
+}
+
+func TestNewClientRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("an internal address was reached")
+	}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second).Get(server.URL)
+	assert.ErrorIs(t, err, ErrInternalAddress)
+}
+
+type fakeRegistry struct {
+	mu         sync.Mutex
+	webhooks   []Webhook
+	deliveries []Delivery
+	tenant     string
+}
+
+func (f *fakeRegistry) Subscribers(ctx context.Context, tenantID, eventType string) ([]Webhook, error) {
+	f.tenant = tenantID
+	return f.webhooks, nil
+}
+
+func (f *fakeRegistry) RecordDelivery(ctx context.Context, delivery Delivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries = append(f.deliveries, delivery)
+	return nil
+}
+
+func (f *fakeRegistry) PruneDeliveries(ctx context.Context, cutoff time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestDispatcherRetriesFailedDeliveries(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	var body []byte
+	var signature, event string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(events.SignatureHeader)
+		event = r.Header.Get(events.EventHeader)
+	}))
+	defer server.Close()
+
+	registry := &fakeRegistry{webhooks: []Webhook{
+		{ID: "hook-1", URL: server.URL, Secret: "secret"},
+		{ID: "hook-2", URL: "http://127.0.0.1:1/unreachable", Secret: "secret"},
+	}}
+	dispatcher := NewDispatcher(registry, 10, 2, time.Millisecond, time.Second)
+	// The test server listens on loopback, which deliveries refuse
+	dispatcher.client = &http.Client{Timeout: time.Second}
+	dispatcher.Dispatch(EventSearchZeroResults, "acme", map[string]interface{}{"query": "harbour"})
+	dispatcher.deliver(context.Background(), <-dispatcher.queue)
+
+	assert.Equal(t, "acme", registry.tenant)
+	assert.Equal(t, EventSearchZeroResults, event)
+	assert.NoError(t, events.Verify("secret", signature, body, time.Minute, time.Now()))
+	var delivered events.Event
+	require.NoError(t, json.Unmarshal(body, &delivered))
+	assert.Equal(t, "harbour", delivered.Data["query"])
+
+	attempts := map[string][]string{}
+	for _, delivery := range registry.deliveries {
+		assert.Equal(t, delivered.ID, delivery.EventID)
+		attempts[delivery.WebhookID] = append(attempts[delivery.WebhookID], delivery.Status)
+	}
+	assert.Equal(t, []string{StatusFailed, StatusDelivered}, attempts["hook-1"])
+	// Attempts stop at the limit
+	assert.Equal(t, []string{StatusFailed, StatusFailed}, attempts["hook-2"])
+}
+
+func TestNilDispatcherDropsEvents(t *testing.T) {
+	var dispatcher *Dispatcher
+	assert.NotPanics(t, func() { dispatcher.Dispatch(EventAssetIndexed, "", nil) })
+}
@@ -0,0 +1,78 @@
+package workerpool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Pool runs independent tasks with bounded concurrency and a per-task timeout
+type Pool struct {
+	workers int
+	timeout time.Duration
+}
+
+// New creates a pool running at most workers tasks at once; a zero timeout disables it
+func New(workers int, timeout time.Duration) *Pool {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Pool{workers: workers, timeout: timeout}
+}
+
+// Run calls fn for every index in [0, n) and returns the error of each task
+// by index. Tasks receive a context carrying the per-task timeout and must
+// honour it; Run returns once every task has finished.
+func (p *Pool) Run(ctx context.Context, n int, fn func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	if n == 0 {
+		return errs
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := p.workers
+	if workers > n {
+		workers = n
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = p.runTask(ctx, i, fn)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
+
+func (p *Pool) runTask(ctx context.Context, i int, fn func(ctx context.Context, i int) error) (err error) {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	taskCtx := ctx
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		taskCtx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task %d panicked: %v", i, r)
+		}
+	}()
+
+	return fn(taskCtx, i)
+}
@@ -0,0 +1,56 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	pool := New(3, time.Second)
+
+	var running, peak int32
+	results := make([]int, 20)
+	errs := pool.Run(context.Background(), len(results), func(ctx context.Context, i int) error {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if current <= old || atomic.CompareAndSwapInt32(&peak, old, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		results[i] = i * 2
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(3))
+	for i, err := range errs {
+		assert.NoError(t, err)
+		assert.Equal(t, i*2, results[i])
+	}
+}
+
+func TestRunReportsTimeoutsAndPanicsPerTask(t *testing.T) {
+	pool := New(2, 10*time.Millisecond)
+
+	errs := pool.Run(context.Background(), 3, func(ctx context.Context, i int) error {
+		switch i {
+		case 0:
+			<-ctx.Done()
+			return ctx.Err()
+		case 1:
+			panic("boom")
+		}
+		return nil
+	})
+
+	assert.True(t, errors.Is(errs[0], context.DeadlineExceeded))
+	assert.ErrorContains(t, errs[1], "panicked")
+	assert.NoError(t, errs[2])
+}